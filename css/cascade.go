@@ -34,11 +34,27 @@ type StyleResolver struct {
 	userAgentSheet *Stylesheet
 	userSheets     []*Stylesheet
 	authorSheets   []*Stylesheet
+	viewport       Viewport
 }
 
+// DefaultViewport is the viewport styles are resolved against until the
+// size of the window showing the document is known.
+var DefaultViewport = Viewport{Width: 1200, Height: 800, DevicePixelRatio: 1}
+
 // NewStyleResolver creates a new style resolver.
 func NewStyleResolver() *StyleResolver {
-	return &StyleResolver{}
+	return &StyleResolver{viewport: DefaultViewport}
+}
+
+// SetViewport sets the viewport that media queries are evaluated in and
+// that viewport-percentage lengths resolve against.
+func (sr *StyleResolver) SetViewport(vp Viewport) {
+	sr.viewport = vp
+}
+
+// Viewport returns the viewport styles are resolved against.
+func (sr *StyleResolver) Viewport() Viewport {
+	return sr.viewport
 }
 
 // SetUserAgentStylesheet sets the user agent stylesheet.
@@ -63,13 +79,22 @@ func (sr *StyleResolver) ClearAuthorStylesheets() {
 
 // collectMatchingRules collects all rules matching an element.
 func (sr *StyleResolver) collectMatchingRules(el *dom.Element) []MatchedRule {
+	return sr.collectRules(el, matchRuleToElement)
+}
+
+// collectRules collects the rules of all stylesheets that a match function
+// matches to an element, such as those of one of its pseudo-elements.
+func (sr *StyleResolver) collectRules(el *dom.Element, match func(*Rule, *dom.Element) (bool, *ComplexSelector)) []MatchedRule {
 	var matched []MatchedRule
 	order := 0
 
 	// Collect from user agent stylesheet
 	if sr.userAgentSheet != nil {
 		for _, rule := range sr.userAgentSheet.Rules {
-			if matches, sel := matchRuleToElement(&rule, el); matches {
+			if !sr.mediaMatches(&rule) {
+				continue
+			}
+			if matches, sel := match(&rule, el); matches {
 				for _, decl := range rule.Declarations {
 					matched = append(matched, MatchedRule{
 						Rule:        &rule,
@@ -87,8 +112,14 @@ func (sr *StyleResolver) collectMatchingRules(el *dom.Element) []MatchedRule {
 
 	// Collect from user stylesheets
 	for _, ss := range sr.userSheets {
+		if !ss.Media.Matches(sr.viewport) {
+			continue
+		}
 		for _, rule := range ss.Rules {
-			if matches, sel := matchRuleToElement(&rule, el); matches {
+			if !sr.mediaMatches(&rule) {
+				continue
+			}
+			if matches, sel := match(&rule, el); matches {
 				for _, decl := range rule.Declarations {
 					matched = append(matched, MatchedRule{
 						Rule:        &rule,
@@ -106,8 +137,14 @@ func (sr *StyleResolver) collectMatchingRules(el *dom.Element) []MatchedRule {
 
 	// Collect from author stylesheets
 	for _, ss := range sr.authorSheets {
+		if !ss.Media.Matches(sr.viewport) {
+			continue
+		}
 		for _, rule := range ss.Rules {
-			if matches, sel := matchRuleToElement(&rule, el); matches {
+			if !sr.mediaMatches(&rule) {
+				continue
+			}
+			if matches, sel := match(&rule, el); matches {
 				for _, decl := range rule.Declarations {
 					matched = append(matched, MatchedRule{
 						Rule:        &rule,
@@ -126,6 +163,17 @@ func (sr *StyleResolver) collectMatchingRules(el *dom.Element) []MatchedRule {
 	return matched
 }
 
+// mediaMatches reports whether the @media conditions a rule is nested in
+// match the viewport.
+func (sr *StyleResolver) mediaMatches(rule *Rule) bool {
+	for _, media := range rule.Media {
+		if !media.Matches(sr.viewport) {
+			return false
+		}
+	}
+	return true
+}
+
 // matchRuleToElement checks if a rule matches an element, returning the matching selector.
 func matchRuleToElement(rule *Rule, el *dom.Element) (bool, *ComplexSelector) {
 	// Parse selector from selector text
@@ -142,6 +190,35 @@ func matchRuleToElement(rule *Rule, el *dom.Element) (bool, *ComplexSelector) {
 	return false, nil
 }
 
+// matchSelectionRule checks if a rule styles the ::selection pseudo-element
+// of an element, returning the matching selector.
+func matchSelectionRule(rule *Rule, el *dom.Element) (bool, *ComplexSelector) {
+	// Most rules style no pseudo-element, and need not be parsed
+	if !strings.Contains(rule.SelectorText, "::") || !strings.Contains(strings.ToLower(rule.SelectorText), "::selection") {
+		return false, nil
+	}
+	sel, err := ParseSelector(rule.SelectorText)
+	if err != nil || sel == nil {
+		return false, nil
+	}
+
+	for _, cs := range sel.ComplexSelectors {
+		n := len(cs.Compounds)
+		if n == 0 || cs.Compounds[n-1].PseudoElement == nil || cs.Compounds[n-1].PseudoElement.Name != "selection" {
+			continue
+		}
+		// The selector without the pseudo-element matches the element it
+		// originates from
+		subject := *cs.Compounds[n-1]
+		subject.PseudoElement = nil
+		originating := &ComplexSelector{Compounds: append(cs.Compounds[:n-1:n-1], &subject)}
+		if originating.MatchElement(el) {
+			return true, cs
+		}
+	}
+	return false, nil
+}
+
 // sortedByPrecedence sorts matched rules by cascade precedence.
 // Order (highest to lowest):
 // 1. Important user agent declarations
@@ -211,6 +288,18 @@ type ComputedStyle struct {
 
 	// Parent computed style (for inheritance)
 	parent *ComputedStyle
+
+	// declared records the order in which declarations set each property,
+	// so that flow-relative and physical properties resolve in cascade order
+	declared     map[string]int
+	declarations int
+
+	// Style of the ::selection pseudo-element, if any rule styles it
+	selection *ComputedStyle
+
+	// Viewport the style was resolved in, which viewport-percentage
+	// lengths resolve against
+	viewport Viewport
 }
 
 // ComputedValue represents a computed CSS value.
@@ -228,12 +317,18 @@ type ComputedValue struct {
 	IsRevert  bool    // Whether this is the 'revert' keyword
 }
 
-// NewComputedStyle creates a new computed style for an element.
+// NewComputedStyle creates a new computed style for an element, in the
+// viewport of its parent style.
 func NewComputedStyle(el *dom.Element, parent *ComputedStyle) *ComputedStyle {
+	viewport := DefaultViewport
+	if parent != nil {
+		viewport = parent.viewport
+	}
 	return &ComputedStyle{
-		element: el,
-		values:  make(map[string]*ComputedValue),
-		parent:  parent,
+		element:  el,
+		values:   make(map[string]*ComputedValue),
+		parent:   parent,
+		viewport: viewport,
 	}
 }
 
@@ -252,6 +347,7 @@ func (cs *ComputedStyle) SetPropertyValue(property string, value *ComputedValue)
 // ResolveStyles computes the final style for an element.
 func (sr *StyleResolver) ResolveStyles(el *dom.Element, parent *ComputedStyle) *ComputedStyle {
 	computed := NewComputedStyle(el, parent)
+	computed.viewport = sr.viewport
 
 	// Step 1: Apply default/initial values
 	applyInitialValues(computed)
@@ -267,25 +363,80 @@ func (sr *StyleResolver) ResolveStyles(el *dom.Element, parent *ComputedStyle) *
 	// Step 4: Sort by cascade precedence
 	sortByPrecedence(matched)
 
-	// Step 5: Apply declarations in order (later declarations override earlier ones)
+	// Step 5: Apply declarations in order (later declarations override earlier ones).
+	// SVG presentation attributes slot in between user agent and other rules.
+	hintsApplied := false
 	for _, mr := range matched {
+		if !hintsApplied && cascadeLayer(mr.Origin, mr.Important) > cascadeLayer(OriginUserAgent, false) {
+			applyPresentationHints(computed, el, parent)
+			hintsApplied = true
+		}
 		for _, decl := range mr.Rule.Declarations {
 			applyDeclaration(computed, &decl, parent)
 		}
 	}
 
+	if !hintsApplied {
+		applyPresentationHints(computed, el, parent)
+	}
+
 	// Step 6: Parse and apply inline styles
 	if el.HasAttribute("style") {
 		inlineStyle := el.GetAttribute("style")
 		applyInlineStyle(computed, inlineStyle, parent)
 	}
 
+	// Flow-relative properties such as margin-inline-start set their
+	// physical counterparts
+	resolveLogicalProperties(computed)
+
 	// Step 7: Compute relative values (em, rem, %, etc.)
-	resolveRelativeValues(computed, parent)
+	resolveRelativeValues(computed, parent, sr.viewport)
+
+	// Step 8: Resolve the style of the selected text
+	computed.selection = sr.resolveSelectionStyle(el, parent)
 
 	return computed
 }
 
+// SelectionStyle returns the style of the ::selection pseudo-element of the
+// element, which paints its text while it is selected, or nil if no rule
+// styles the ::selection of the element or its ancestors. Only the
+// properties those rules declare are set.
+func (cs *ComputedStyle) SelectionStyle() *ComputedStyle {
+	return cs.selection
+}
+
+// resolveSelectionStyle computes the style of the ::selection pseudo-element
+// of an element. Highlight pseudo-elements inherit from those of the parent
+// element, so an element without ::selection rules of its own shares the
+// style of its parent's.
+// Reference: https://drafts.csswg.org/css-pseudo-4/#highlight-cascade
+func (sr *StyleResolver) resolveSelectionStyle(el *dom.Element, parent *ComputedStyle) *ComputedStyle {
+	var inherited *ComputedStyle
+	if parent != nil {
+		inherited = parent.selection
+	}
+	matched := sr.collectRules(el, matchSelectionRule)
+	if len(matched) == 0 {
+		return inherited
+	}
+	sortByPrecedence(matched)
+
+	selection := NewComputedStyle(el, inherited)
+	if inherited != nil {
+		for prop, val := range inherited.values {
+			selection.values[prop] = val
+		}
+	}
+	for _, mr := range matched {
+		for _, decl := range mr.Rule.Declarations {
+			applyDeclaration(selection, &decl, inherited)
+		}
+	}
+	return selection
+}
+
 // applyInitialValues sets initial values for all properties.
 func applyInitialValues(cs *ComputedStyle) {
 	for prop, def := range PropertyDefaults {
@@ -313,6 +464,11 @@ func applyInheritedProperties(cs *ComputedStyle, parent *ComputedStyle) {
 // applyDeclaration applies a single declaration to computed style.
 func applyDeclaration(cs *ComputedStyle, decl *Declaration, parent *ComputedStyle) {
 	prop := strings.ToLower(decl.Property)
+	if cs.declared == nil {
+		cs.declared = make(map[string]int)
+	}
+	cs.declarations++
+	cs.declared[prop] = cs.declarations
 
 	// Handle CSS-wide keywords
 	switch strings.ToLower(decl.Value.Keyword) {
@@ -390,6 +546,17 @@ func computeValue(val *Value, property string) *ComputedValue {
 	switch val.Type {
 	case KeywordValue:
 		cv.Keyword = val.Keyword
+		// Named colors keep their keyword but also carry the resolved color.
+		if c, ok := NamedColors[strings.ToLower(val.Keyword)]; ok && !strings.EqualFold(val.Keyword, "currentcolor") {
+			cv.Color = c
+		}
+	case ListValue:
+		// Color functions such as rgba(...) arrive as token lists.
+		if parts := NonWhitespaceComponents(ParseComponentValueList(val.Raw)); len(parts) == 1 {
+			if c, ok := ComponentColor(parts[0]); ok {
+				cv.Color = c
+			}
+		}
 	case LengthValue:
 		cv.Length = val.Length
 	case ColorValue:
@@ -404,25 +571,10 @@ func computeValue(val *Value, property string) *ComputedValue {
 }
 
 // resolveRelativeValues resolves relative units to absolute values.
-func resolveRelativeValues(cs *ComputedStyle, parent *ComputedStyle) {
-	// Get the font-size for em calculations
-	var fontSize float64 = 16 // Default
-	if fs := cs.values["font-size"]; fs != nil {
-		fontSize = fs.Length
-		if fontSize == 0 {
-			fontSize = 16
-		}
-	}
-
-	// Get root font-size for rem calculations
-	var rootFontSize float64 = 16 // Default
-	rootStyle := cs
-	for rootStyle.parent != nil {
-		rootStyle = rootStyle.parent
-	}
-	if rfs := rootStyle.values["font-size"]; rfs != nil && rfs.Length > 0 {
-		rootFontSize = rfs.Length
-	}
+func resolveRelativeValues(cs *ComputedStyle, parent *ComputedStyle, vp Viewport) {
+	// Get the font-size for em calculations and the root font-size for rem
+	// calculations
+	fontSize, rootFontSize := cs.fontSize(), cs.rootFontSize()
 
 	for prop, val := range cs.values {
 		if val == nil {
@@ -431,7 +583,11 @@ func resolveRelativeValues(cs *ComputedStyle, parent *ComputedStyle) {
 
 		switch val.Value.Type {
 		case LengthValue:
-			val.Length = resolveLength(val.Value.Length, val.Value.Unit, fontSize, rootFontSize)
+			if length, ok := resolveViewportLength(val.Value.Length, val.Value.Unit, vp); ok {
+				val.Length = length
+			} else {
+				val.Length = resolveLength(val.Value.Length, val.Value.Unit, fontSize, rootFontSize)
+			}
 		case PercentageValue:
 			// Resolve percentages based on property
 			val.Length = resolvePercentage(val.Value.Length, prop, parent)
@@ -439,6 +595,76 @@ func resolveRelativeValues(cs *ComputedStyle, parent *ComputedStyle) {
 	}
 }
 
+// fontSize returns the font size em lengths of the style resolve against.
+func (cs *ComputedStyle) fontSize() float64 {
+	if fs := cs.values["font-size"]; fs != nil && fs.Length != 0 {
+		return fs.Length
+	}
+	return 16
+}
+
+// rootFontSize returns the font size of the root element, which rem lengths
+// of the style resolve against.
+func (cs *ComputedStyle) rootFontSize() float64 {
+	rootStyle := cs
+	for rootStyle.parent != nil {
+		rootStyle = rootStyle.parent
+	}
+	if rfs := rootStyle.values["font-size"]; rfs != nil && rfs.Length > 0 {
+		return rfs.Length
+	}
+	return 16
+}
+
+// ResolveLength converts a length in a unit to pixels, as the cascade
+// resolves the lengths of the style: font-relative units against the font
+// sizes of the element and the root element, and viewport-percentage units
+// against the viewport the style was resolved in.
+func (cs *ComputedStyle) ResolveLength(value float64, unit string) float64 {
+	if length, ok := resolveViewportLength(value, unit, cs.viewport); ok {
+		return length
+	}
+	return resolveLength(value, unit, cs.fontSize(), cs.rootFontSize())
+}
+
+// LengthPercentage parses a single length or percentage, such as a value
+// of a shorthand the cascade keeps as text, and resolves it like
+// ResolveLength, percentages against size. It reports false for anything
+// else.
+// Reference: https://www.w3.org/TR/css-values-4/#typedef-length-percentage
+func (cs *ComputedStyle) LengthPercentage(text string, size float64) (float64, bool) {
+	parts := NonWhitespaceComponents(ParseComponentValueList(text))
+	if len(parts) != 1 {
+		return 0, false
+	}
+	value, unit, tokenType, ok := ComponentNumber(parts[0])
+	switch {
+	case !ok:
+		return 0, false
+	case tokenType == TokenPercentage:
+		return value / 100 * size, true
+	case tokenType == TokenNumber:
+		// Only zero may omit its unit
+		return 0, value == 0
+	case !isLengthUnit(unit):
+		return 0, false
+	}
+	return cs.ResolveLength(value, unit), true
+}
+
+// isLengthUnit reports whether a unit is one of the absolute, font-relative
+// or viewport-percentage length units.
+func isLengthUnit(unit string) bool {
+	if _, ok := resolveViewportLength(0, unit, DefaultViewport); ok {
+		return true
+	}
+	switch strings.ToLower(unit) {
+	case "px", "em", "rem", "pt", "pc", "in", "cm", "mm", "q", "ex", "ch":
+		return true
+	}
+	return false
+}
+
 // resolveLength converts a length value to pixels.
 func resolveLength(value float64, unit string, fontSize, rootFontSize float64) float64 {
 	switch strings.ToLower(unit) {
@@ -472,6 +698,23 @@ func resolveLength(value float64, unit string, fontSize, rootFontSize float64) f
 	}
 }
 
+// resolveViewportLength converts a length in viewport-percentage units
+// to pixels, reporting false for other units.
+// Reference: https://www.w3.org/TR/css-values-4/#viewport-relative-lengths
+func resolveViewportLength(value float64, unit string, vp Viewport) (float64, bool) {
+	switch strings.ToLower(unit) {
+	case "vw", "svw", "lvw", "dvw", "vi", "svi", "lvi", "dvi":
+		return value * vp.Width / 100, true
+	case "vh", "svh", "lvh", "dvh", "vb", "svb", "lvb", "dvb":
+		return value * vp.Height / 100, true
+	case "vmin", "svmin", "lvmin", "dvmin":
+		return value * min(vp.Width, vp.Height) / 100, true
+	case "vmax", "svmax", "lvmax", "dvmax":
+		return value * max(vp.Width, vp.Height) / 100, true
+	}
+	return 0, false
+}
+
 // resolvePercentage resolves a percentage value based on property.
 func resolvePercentage(percent float64, property string, parent *ComputedStyle) float64 {
 	// Percentage resolution depends on the property
@@ -525,8 +768,8 @@ var PropertyDefaults = map[string]PropertyDefault{
 	// Sizing
 	"width":      {InitialValue: "auto", Inherited: false},
 	"height":     {InitialValue: "auto", Inherited: false},
-	"min-width":  {InitialValue: "0", Inherited: false},
-	"min-height": {InitialValue: "0", Inherited: false},
+	"min-width":  {InitialValue: "auto", Inherited: false},
+	"min-height": {InitialValue: "auto", Inherited: false},
 	"max-width":  {InitialValue: "none", Inherited: false},
 	"max-height": {InitialValue: "none", Inherited: false},
 
@@ -563,6 +806,18 @@ var PropertyDefaults = map[string]PropertyDefault{
 	"border-left-color":   {InitialValue: "currentcolor", Inherited: false},
 	"border-radius":       {InitialValue: "0", Inherited: false},
 
+	"border-top-left-radius":     {InitialValue: "0", Inherited: false},
+	"border-top-right-radius":    {InitialValue: "0", Inherited: false},
+	"border-bottom-right-radius": {InitialValue: "0", Inherited: false},
+	"border-bottom-left-radius":  {InitialValue: "0", Inherited: false},
+	"box-shadow":                 {InitialValue: "none", Inherited: false},
+
+	// Outline
+	"outline-width":  {InitialValue: "medium", Inherited: false},
+	"outline-style":  {InitialValue: "none", Inherited: false},
+	"outline-color":  {InitialValue: "currentcolor", Inherited: false},
+	"outline-offset": {InitialValue: "0", Inherited: false},
+
 	// Positioning
 	"top":    {InitialValue: "auto", Inherited: false},
 	"right":  {InitialValue: "auto", Inherited: false},
@@ -584,9 +839,20 @@ var PropertyDefaults = map[string]PropertyDefault{
 	"text-transform":  {InitialValue: "none", Inherited: true},
 	"text-indent":     {InitialValue: "0", Inherited: true},
 	"white-space":     {InitialValue: "normal", Inherited: true},
+	"white-space-collapse": {InitialValue: "collapse", Inherited: true},
+	"text-wrap":       {InitialValue: "wrap", Inherited: true},
+	"text-wrap-mode":  {InitialValue: "wrap", Inherited: true},
+	"tab-size":        {InitialValue: "8", Inherited: true},
+	"text-align-last": {InitialValue: "auto", Inherited: true},
+	"word-break":      {InitialValue: "normal", Inherited: true},
+	"overflow-wrap":   {InitialValue: "normal", Inherited: true},
+	"line-break":      {InitialValue: "auto", Inherited: true},
+	"hyphens":         {InitialValue: "manual", Inherited: true},
 	"vertical-align":  {InitialValue: "baseline", Inherited: false},
 	"direction":       {InitialValue: "ltr", Inherited: true},
 	"unicode-bidi":    {InitialValue: "normal", Inherited: false},
+	"writing-mode":     {InitialValue: "horizontal-tb", Inherited: true},
+	"text-orientation": {InitialValue: "mixed", Inherited: true},
 
 	// Background
 	"background":            {InitialValue: "transparent", Inherited: false},
@@ -596,6 +862,8 @@ var PropertyDefaults = map[string]PropertyDefault{
 	"background-position":   {InitialValue: "0% 0%", Inherited: false},
 	"background-attachment": {InitialValue: "scroll", Inherited: false},
 	"background-size":       {InitialValue: "auto", Inherited: false},
+	"background-clip":       {InitialValue: "border-box", Inherited: false},
+	"background-origin":     {InitialValue: "padding-box", Inherited: false},
 
 	// Lists
 	"list-style":          {InitialValue: "disc", Inherited: true},
@@ -621,6 +889,7 @@ var PropertyDefaults = map[string]PropertyDefault{
 	"flex-basis":      {InitialValue: "auto", Inherited: false},
 	"order":           {InitialValue: "0", Inherited: false},
 	"align-self":      {InitialValue: "auto", Inherited: false},
+	"flex":            {InitialValue: "0 1 auto", Inherited: false},
 
 	// Grid
 	"grid-template-columns": {InitialValue: "none", Inherited: false},
@@ -628,14 +897,109 @@ var PropertyDefaults = map[string]PropertyDefault{
 	"grid-column":           {InitialValue: "auto", Inherited: false},
 	"grid-row":              {InitialValue: "auto", Inherited: false},
 	"gap":                   {InitialValue: "0", Inherited: false},
+	"row-gap":               {InitialValue: "normal", Inherited: false},
+
+	// Flow-relative sizes and box edges
+	"inline-size":               {InitialValue: "auto", Inherited: false},
+	"block-size":                {InitialValue: "auto", Inherited: false},
+	"min-inline-size":           {InitialValue: "auto", Inherited: false},
+	"min-block-size":            {InitialValue: "auto", Inherited: false},
+	"max-inline-size":           {InitialValue: "none", Inherited: false},
+	"max-block-size":            {InitialValue: "none", Inherited: false},
+	"margin-inline":             {InitialValue: "0", Inherited: false},
+	"margin-block":              {InitialValue: "0", Inherited: false},
+	"margin-inline-start":       {InitialValue: "0", Inherited: false},
+	"margin-inline-end":         {InitialValue: "0", Inherited: false},
+	"margin-block-start":        {InitialValue: "0", Inherited: false},
+	"margin-block-end":          {InitialValue: "0", Inherited: false},
+	"padding-inline":            {InitialValue: "0", Inherited: false},
+	"padding-block":             {InitialValue: "0", Inherited: false},
+	"padding-inline-start":      {InitialValue: "0", Inherited: false},
+	"padding-inline-end":        {InitialValue: "0", Inherited: false},
+	"padding-block-start":       {InitialValue: "0", Inherited: false},
+	"padding-block-end":         {InitialValue: "0", Inherited: false},
+	"border-inline-width":       {InitialValue: "medium", Inherited: false},
+	"border-block-width":        {InitialValue: "medium", Inherited: false},
+	"border-inline-start-width": {InitialValue: "medium", Inherited: false},
+	"border-inline-end-width":   {InitialValue: "medium", Inherited: false},
+	"border-block-start-width":  {InitialValue: "medium", Inherited: false},
+	"border-block-end-width":    {InitialValue: "medium", Inherited: false},
+	"border-inline-style":       {InitialValue: "none", Inherited: false},
+	"border-block-style":        {InitialValue: "none", Inherited: false},
+	"border-inline-start-style": {InitialValue: "none", Inherited: false},
+	"border-inline-end-style":   {InitialValue: "none", Inherited: false},
+	"border-block-start-style":  {InitialValue: "none", Inherited: false},
+	"border-block-end-style":    {InitialValue: "none", Inherited: false},
+	"border-inline-color":       {InitialValue: "currentcolor", Inherited: false},
+	"border-block-color":        {InitialValue: "currentcolor", Inherited: false},
+	"border-inline-start-color": {InitialValue: "currentcolor", Inherited: false},
+	"border-inline-end-color":   {InitialValue: "currentcolor", Inherited: false},
+	"border-block-start-color":  {InitialValue: "currentcolor", Inherited: false},
+	"border-block-end-color":    {InitialValue: "currentcolor", Inherited: false},
+	"inset-inline":              {InitialValue: "auto", Inherited: false},
+	"inset-block":               {InitialValue: "auto", Inherited: false},
+	"inset-inline-start":        {InitialValue: "auto", Inherited: false},
+	"inset-inline-end":          {InitialValue: "auto", Inherited: false},
+	"inset-block-start":         {InitialValue: "auto", Inherited: false},
+	"inset-block-end":           {InitialValue: "auto", Inherited: false},
+
+	// Multi-column layout
+	"columns":           {InitialValue: "auto", Inherited: false},
+	"column-count":      {InitialValue: "auto", Inherited: false},
+	"column-width":      {InitialValue: "auto", Inherited: false},
+	"column-gap":        {InitialValue: "normal", Inherited: false},
+	"column-rule":       {InitialValue: "none", Inherited: false},
+	"column-rule-width": {InitialValue: "medium", Inherited: false},
+	"column-rule-style": {InitialValue: "none", Inherited: false},
+	"column-rule-color": {InitialValue: "currentcolor", Inherited: false},
+	"column-span":       {InitialValue: "none", Inherited: false},
+	"column-fill":       {InitialValue: "balance", Inherited: false},
+	"break-inside":      {InitialValue: "auto", Inherited: false},
 
 	// Other
-	"cursor":        {InitialValue: "auto", Inherited: true},
-	"opacity":       {InitialValue: "1", Inherited: false},
-	"content":       {InitialValue: "normal", Inherited: false},
-	"quotes":        {InitialValue: "auto", Inherited: true},
-	"counter-reset": {InitialValue: "none", Inherited: false},
-	"outline":       {InitialValue: "none", Inherited: false},
+	"cursor":         {InitialValue: "auto", Inherited: true},
+	"pointer-events": {InitialValue: "auto", Inherited: true},
+	"opacity":        {InitialValue: "1", Inherited: false},
+	"content":        {InitialValue: "normal", Inherited: false},
+	"quotes":         {InitialValue: "auto", Inherited: true},
+	"counter-reset":  {InitialValue: "none", Inherited: false},
+	"outline":        {InitialValue: "none", Inherited: false},
+
+	// Transforms
+	"transform":        {InitialValue: "none", Inherited: false},
+	"transform-origin": {InitialValue: "50% 50%", Inherited: false},
+
+	// Compositing
+	"filter":         {InitialValue: "none", Inherited: false},
+	"mix-blend-mode": {InitialValue: "normal", Inherited: false},
+	"isolation":      {InitialValue: "auto", Inherited: false},
+
+	// Clipping and masking
+	"clip-path":      {InitialValue: "none", Inherited: false},
+	"mask-image":     {InitialValue: "none", Inherited: false},
+	"mask-size":      {InitialValue: "auto", Inherited: false},
+	"mask-position":  {InitialValue: "0% 0%", Inherited: false},
+	"mask-repeat":    {InitialValue: "repeat", Inherited: false},
+	"mask-origin":    {InitialValue: "border-box", Inherited: false},
+	"mask-clip":      {InitialValue: "border-box", Inherited: false},
+	"mask-mode":      {InitialValue: "match-source", Inherited: false},
+	"mask-composite": {InitialValue: "add", Inherited: false},
+
+	// SVG painting
+	"fill":              {InitialValue: "black", Inherited: true},
+	"fill-opacity":      {InitialValue: "1", Inherited: true},
+	"fill-rule":         {InitialValue: "nonzero", Inherited: true},
+	"stroke":            {InitialValue: "none", Inherited: true},
+	"stroke-width":      {InitialValue: "1", Inherited: true},
+	"stroke-opacity":    {InitialValue: "1", Inherited: true},
+	"stroke-linecap":    {InitialValue: "butt", Inherited: true},
+	"stroke-linejoin":   {InitialValue: "miter", Inherited: true},
+	"stroke-miterlimit": {InitialValue: "4", Inherited: true},
+	"stroke-dasharray":  {InitialValue: "none", Inherited: true},
+	"stroke-dashoffset": {InitialValue: "0", Inherited: true},
+	"stop-color":        {InitialValue: "black", Inherited: false},
+	"stop-opacity":      {InitialValue: "1", Inherited: false},
+	"text-anchor":       {InitialValue: "start", Inherited: true},
 }
 
 // GetComputedStyleProperty is a helper to get a specific property value.
@@ -255,6 +255,35 @@ func TestInlineStyles(t *testing.T) {
 	}
 }
 
+func TestSVGPresentationAttributes(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body><div fill="red"></div><svg><rect fill="red" stroke="blue" stroke-width="2"/><circle fill="red" style="fill: green"/></svg></body></html>`)
+
+	resolver := NewStyleResolver()
+	resolver.SetUserAgentStylesheet(GetUserAgentStylesheet())
+	resolver.AddAuthorStylesheet(NewParser(`rect { stroke: black }`).Parse())
+
+	rect := resolver.ResolveStyles(doc.GetElementsByTagName("rect").Item(0), nil)
+	if got := rect.GetComputedStyleProperty("fill"); got != "red" {
+		t.Errorf("fill = %q, want presentation attribute red", got)
+	}
+	if got := rect.GetComputedStyleProperty("stroke"); got != "black" {
+		t.Errorf("stroke = %q, want author rule to override the attribute", got)
+	}
+	if got := rect.GetPropertyValue("stroke-width"); got == nil || got.Length != 2 {
+		t.Errorf("stroke-width = %v, want 2", got)
+	}
+
+	circle := resolver.ResolveStyles(doc.GetElementsByTagName("circle").Item(0), nil)
+	if got := circle.GetComputedStyleProperty("fill"); got != "green" {
+		t.Errorf("fill = %q, want inline style to override the attribute", got)
+	}
+
+	div := resolver.ResolveStyles(doc.GetElementsByTagName("div").Item(0), nil)
+	if got := div.GetComputedStyleProperty("fill"); got != "black" {
+		t.Errorf("fill = %q, want HTML elements to ignore presentation attributes", got)
+	}
+}
+
 func TestLengthUnits(t *testing.T) {
 	tests := []struct {
 		value    float64
@@ -455,3 +484,139 @@ func findStyledNodeByTag(node *StyledNode, tag string) *StyledNode {
 	}
 	return nil
 }
+
+func TestLogicalProperties(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body><div id="a" dir="rtl"></div><div id="b"></div></body></html>`)
+	resolver := NewStyleResolver()
+	resolver.SetUserAgentStylesheet(GetUserAgentStylesheet())
+	resolver.AddAuthorStylesheet(NewParser(`
+		div { margin-inline-start: 10px; padding-inline-end: 5px; inset-block-start: 3px }
+		#b { margin-left: 2px }
+	`).Parse())
+
+	a := resolver.ResolveStyles(doc.GetElementById("a"), nil)
+	if got := a.GetPropertyValue("margin-right"); got == nil || got.Length != 10 {
+		t.Errorf("rtl margin-right = %v, want 10", got)
+	}
+	if got := a.GetPropertyValue("padding-left"); got == nil || got.Length != 5 {
+		t.Errorf("rtl padding-left = %v, want 5", got)
+	}
+	if got := a.GetPropertyValue("top"); got == nil || got.Length != 3 {
+		t.Errorf("top = %v, want 3", got)
+	}
+
+	// A physical property declared later in the cascade wins
+	b := resolver.ResolveStyles(doc.GetElementById("b"), nil)
+	if got := b.GetPropertyValue("margin-left"); got == nil || got.Length != 2 {
+		t.Errorf("margin-left = %v, want the later physical declaration", got)
+	}
+}
+
+func TestLogicalPropertiesInVerticalWritingModes(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body><div id="rl"></div><div id="lr"></div></body></html>`)
+	resolver := NewStyleResolver()
+	resolver.SetUserAgentStylesheet(GetUserAgentStylesheet())
+	resolver.AddAuthorStylesheet(NewParser(`
+		div { margin-block: 1px 2px; padding-inline-start: 3px; inline-size: 40px; max-block-size: 50px }
+		#rl { writing-mode: vertical-rl }
+		#lr { writing-mode: vertical-lr }
+	`).Parse())
+
+	tests := []struct {
+		id   string
+		want map[string]float64
+	}{
+		{"rl", map[string]float64{"margin-right": 1, "margin-left": 2, "padding-top": 3, "height": 40, "max-width": 50}},
+		{"lr", map[string]float64{"margin-left": 1, "margin-right": 2, "padding-top": 3, "height": 40, "max-width": 50}},
+	}
+	for _, tt := range tests {
+		style := resolver.ResolveStyles(doc.GetElementById(tt.id), nil)
+		for property, want := range tt.want {
+			if got := style.GetPropertyValue(property); got == nil || got.Length != want {
+				t.Errorf("%s: %s = %v, want %v", tt.id, property, got, want)
+			}
+		}
+	}
+}
+
+func TestSelectionStyle(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body><p id="p">a <em id="em">b</em> <b id="b">c</b></p><div id="d"></div></body></html>`)
+	resolver := NewStyleResolver()
+	resolver.AddAuthorStylesheet(NewParser(`
+		p::selection { background-color: yellow; color: black }
+		#b::selection { color: red }
+		p::before { color: blue }
+	`).Parse())
+
+	body := resolver.ResolveStyles(doc.Body(), nil)
+	if body.SelectionStyle() != nil {
+		t.Error("body has a ::selection style without rules for it")
+	}
+	p := resolver.ResolveStyles(doc.GetElementById("p"), body)
+	sel := p.SelectionStyle()
+	if sel == nil {
+		t.Fatal("p has no ::selection style")
+	}
+	if got := sel.GetPropertyValue("background-color"); got == nil || got.Keyword != "yellow" {
+		t.Errorf("p::selection background-color = %v, want yellow", got)
+	}
+	if p.GetPropertyValue("color").Keyword == "blue" || p.GetPropertyValue("background-color").Keyword == "yellow" {
+		t.Error("pseudo-element rules styled the element itself")
+	}
+
+	// Children inherit the ::selection of their parent, overriding what
+	// their own rules declare
+	em := resolver.ResolveStyles(doc.GetElementById("em"), p)
+	if em.SelectionStyle() != sel {
+		t.Error("em does not share the ::selection style of p")
+	}
+	b := resolver.ResolveStyles(doc.GetElementById("b"), p).SelectionStyle()
+	if got := b.GetPropertyValue("color"); got == nil || got.Keyword != "red" {
+		t.Errorf("#b::selection color = %v, want red", got)
+	}
+	if got := b.GetPropertyValue("background-color"); got == nil || got.Keyword != "yellow" {
+		t.Errorf("#b::selection background-color = %v, want it inherited", got)
+	}
+
+	if d := resolver.ResolveStyles(doc.GetElementById("d"), body); d.SelectionStyle() != nil {
+		t.Error("div has a ::selection style without rules for it")
+	}
+}
+
+func TestComputedStyleLengthPercentage(t *testing.T) {
+	doc, err := dom.ParseHTML(`<p id="p">x</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := NewStyleResolver()
+	resolver.AddAuthorStylesheet(NewParser(`html { font-size: 20px } p { font-size: 10px }`).Parse())
+	resolver.SetViewport(Viewport{Width: 1000, Height: 500, DevicePixelRatio: 1})
+	html := resolver.ResolveStyles(doc.DocumentElement(), nil)
+	body := resolver.ResolveStyles(doc.Body(), html)
+	p := resolver.ResolveStyles(doc.GetElementById("p"), body)
+
+	tests := []struct {
+		text string
+		want float64
+		ok   bool
+	}{
+		{"12px", 12, true},
+		{"2em", 20, true},
+		{"2rem", 40, true},
+		{"10vw", 100, true},
+		{"10vmin", 50, true},
+		{"25%", 50, true},
+		{"0", 0, true},
+		{"-1.5em", -15, true},
+		{"12", 0, false},
+		{"12furlongs", 0, false},
+		{"auto", 0, false},
+		{"1px 2px", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := p.LengthPercentage(tt.text, 200)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("LengthPercentage(%q) = %v, %v, want %v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package css provides the flow-relative (logical) properties.
+// Reference: https://www.w3.org/TR/css-logical-1/
+package css
+
+import (
+	"sort"
+	"strings"
+)
+
+// logicalProperty describes a flow-relative property: the physical
+// property it sets, with %s standing for a side or dimension, and the
+// flow-relative sides or dimensions its values set, in order. Shorthands
+// with one value set both.
+type logicalProperty struct {
+	pattern string
+	flow    []string
+}
+
+// logicalProperties maps flow-relative properties to the physical
+// properties they set.
+var logicalProperties = map[string]logicalProperty{
+	"margin-inline-start":       {"margin-%s", []string{"inline-start"}},
+	"margin-inline-end":         {"margin-%s", []string{"inline-end"}},
+	"margin-block-start":        {"margin-%s", []string{"block-start"}},
+	"margin-block-end":          {"margin-%s", []string{"block-end"}},
+	"margin-inline":             {"margin-%s", []string{"inline-start", "inline-end"}},
+	"margin-block":              {"margin-%s", []string{"block-start", "block-end"}},
+	"padding-inline-start":      {"padding-%s", []string{"inline-start"}},
+	"padding-inline-end":        {"padding-%s", []string{"inline-end"}},
+	"padding-block-start":       {"padding-%s", []string{"block-start"}},
+	"padding-block-end":         {"padding-%s", []string{"block-end"}},
+	"padding-inline":            {"padding-%s", []string{"inline-start", "inline-end"}},
+	"padding-block":             {"padding-%s", []string{"block-start", "block-end"}},
+	"border-inline-start-width": {"border-%s-width", []string{"inline-start"}},
+	"border-inline-end-width":   {"border-%s-width", []string{"inline-end"}},
+	"border-block-start-width":  {"border-%s-width", []string{"block-start"}},
+	"border-block-end-width":    {"border-%s-width", []string{"block-end"}},
+	"border-inline-width":       {"border-%s-width", []string{"inline-start", "inline-end"}},
+	"border-block-width":        {"border-%s-width", []string{"block-start", "block-end"}},
+	"border-inline-start-style": {"border-%s-style", []string{"inline-start"}},
+	"border-inline-end-style":   {"border-%s-style", []string{"inline-end"}},
+	"border-block-start-style":  {"border-%s-style", []string{"block-start"}},
+	"border-block-end-style":    {"border-%s-style", []string{"block-end"}},
+	"border-inline-style":       {"border-%s-style", []string{"inline-start", "inline-end"}},
+	"border-block-style":        {"border-%s-style", []string{"block-start", "block-end"}},
+	"border-inline-start-color": {"border-%s-color", []string{"inline-start"}},
+	"border-inline-end-color":   {"border-%s-color", []string{"inline-end"}},
+	"border-block-start-color":  {"border-%s-color", []string{"block-start"}},
+	"border-block-end-color":    {"border-%s-color", []string{"block-end"}},
+	"border-inline-color":       {"border-%s-color", []string{"inline-start", "inline-end"}},
+	"border-block-color":        {"border-%s-color", []string{"block-start", "block-end"}},
+	"inset-inline-start":        {"%s", []string{"inline-start"}},
+	"inset-inline-end":          {"%s", []string{"inline-end"}},
+	"inset-block-start":         {"%s", []string{"block-start"}},
+	"inset-block-end":           {"%s", []string{"block-end"}},
+	"inset-inline":              {"%s", []string{"inline-start", "inline-end"}},
+	"inset-block":               {"%s", []string{"block-start", "block-end"}},
+	"inline-size":               {"%s", []string{"inline-size"}},
+	"block-size":                {"%s", []string{"block-size"}},
+	"min-inline-size":           {"min-%s", []string{"inline-size"}},
+	"min-block-size":            {"min-%s", []string{"block-size"}},
+	"max-inline-size":           {"max-%s", []string{"inline-size"}},
+	"max-block-size":            {"max-%s", []string{"block-size"}},
+}
+
+// flowSides lists the physical sides that are inline-start, inline-end,
+// block-start and block-end in each writing mode, for the ltr direction.
+// Reference: https://www.w3.org/TR/css-writing-modes-4/#logical-to-physical
+var flowSides = map[string][4]string{
+	"horizontal-tb": {"left", "right", "top", "bottom"},
+	"vertical-rl":   {"top", "bottom", "right", "left"},
+	"vertical-lr":   {"top", "bottom", "left", "right"},
+	"sideways-rl":   {"top", "bottom", "right", "left"},
+	"sideways-lr":   {"bottom", "top", "left", "right"},
+}
+
+// IsVerticalWritingMode reports whether a writing-mode value lays lines
+// out vertically.
+func IsVerticalWritingMode(mode string) bool {
+	return strings.HasPrefix(mode, "vertical-") || strings.HasPrefix(mode, "sideways-")
+}
+
+// physicalFlow returns the physical side or dimension of a flow-relative
+// one in a writing mode and direction.
+func physicalFlow(flow, writingMode string, rtl bool) string {
+	sides, ok := flowSides[writingMode]
+	if !ok {
+		sides = flowSides["horizontal-tb"]
+	}
+	vertical := IsVerticalWritingMode(writingMode)
+	switch flow {
+	case "inline-start", "inline-end":
+		if (flow == "inline-start") == rtl {
+			return sides[1]
+		}
+		return sides[0]
+	case "block-start":
+		return sides[2]
+	case "block-end":
+		return sides[3]
+	case "inline-size":
+		if vertical {
+			return "height"
+		}
+		return "width"
+	case "block-size":
+		if vertical {
+			return "width"
+		}
+		return "height"
+	}
+	return flow
+}
+
+// resolveLogicalProperties copies each declared flow-relative property to
+// its physical counterpart for the element's writing mode and direction,
+// unless the physical property was declared later in the cascade.
+func resolveLogicalProperties(cs *ComputedStyle) {
+	if len(cs.declared) == 0 {
+		return
+	}
+	rtl := false
+	if val := cs.values["direction"]; val != nil && val.Keyword == "rtl" {
+		rtl = true
+	}
+	writingMode := ""
+	if val := cs.values["writing-mode"]; val != nil {
+		writingMode = val.Keyword
+	}
+	// Properties declared later overwrite the sides set by earlier ones
+	var declared []string
+	for logical := range logicalProperties {
+		if _, ok := cs.declared[logical]; ok {
+			declared = append(declared, logical)
+		}
+	}
+	sort.Slice(declared, func(i, j int) bool {
+		return cs.declared[declared[i]] < cs.declared[declared[j]]
+	})
+	for _, logical := range declared {
+		prop, order := logicalProperties[logical], cs.declared[logical]
+		value := cs.values[logical]
+		for i, flow := range prop.flow {
+			target := strings.Replace(prop.pattern, "%s", physicalFlow(flow, writingMode, rtl), 1)
+			if cs.declared[target] > order {
+				continue
+			}
+			// Each of the two values of a shorthand sets one side, a single
+			// value both
+			if values := value.Value.Values; len(prop.flow) == 2 && value.Value.Type == ListValue && len(values) == 2 {
+				cs.values[target] = computeValue(&values[i], target)
+				continue
+			}
+			val := *value
+			cs.values[target] = &val
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/chrisuehlinger/viberowser/dom"
+	"golang.org/x/text/unicode/bidi"
 )
 
 // MatchContext holds context for selector matching.
@@ -419,14 +420,31 @@ func matchPseudoClassWithContext(pc *PseudoClassSelector, el *dom.Element, ctx *
 	case "visited":
 		return isLink(el) && isVisited(el)
 
-	case "hover", "active", "focus", "focus-within", "focus-visible":
-		// These are dynamic states that need to be tracked elsewhere
-		// For now, return false
-		return false
+	case "hover":
+		doc := el.AsNode().OwnerDocument()
+		return doc != nil && isInclusiveAncestor(el, doc.HoveredElement())
+
+	case "active":
+		doc := el.AsNode().OwnerDocument()
+		return doc != nil && isInclusiveAncestor(el, doc.PressedElement())
+
+	case "focus":
+		doc := el.AsNode().OwnerDocument()
+		return doc != nil && doc.GetFocusedElement() == el
+
+	case "focus-within":
+		doc := el.AsNode().OwnerDocument()
+		return doc != nil && isInclusiveAncestor(el, doc.GetFocusedElement())
+
+	case "focus-visible":
+		// Focus given by a pointer is only indicated in text controls,
+		// where it shows where typed text goes
+		doc := el.AsNode().OwnerDocument()
+		return doc != nil && doc.GetFocusedElement() == el && (el.IsTextControl() || !doc.FocusedByPointer())
 
 	case "target":
-		// Would need to know the current fragment identifier
-		return false
+		doc := el.AsNode().OwnerDocument()
+		return doc != nil && doc.TargetElement() == el
 
 	case "lang":
 		return matchLang(pc.Argument, el)
@@ -807,6 +825,26 @@ func isLink(el *dom.Element) bool {
 	return false
 }
 
+// isInclusiveAncestor reports whether el is target or one of its ancestors,
+// going from shadow roots on to their hosts.
+func isInclusiveAncestor(el, target *dom.Element) bool {
+	if target == nil {
+		return false
+	}
+	for n := target.AsNode(); n != nil; n = n.ParentNode() {
+		if n == el.AsNode() {
+			return true
+		}
+		if sr := n.GetShadowRoot(); sr != nil && sr.Host() != nil {
+			n = sr.Host().AsNode()
+			if n == el.AsNode() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func isVisited(el *dom.Element) bool {
 	// We don't track visited links for privacy reasons
 	return false
@@ -929,18 +967,93 @@ func matchLang(lang string, el *dom.Element) bool {
 }
 
 func matchDir(dir string, el *dom.Element) bool {
-	dir = strings.ToLower(dir)
+	return strings.ToLower(dir) == Directionality(el)
+}
 
-	// Walk up the tree looking for dir attribute
+// Directionality returns the directionality of an element, "ltr" or "rtl",
+// from its own or an ancestor's dir attribute. dir=auto, and bdi elements
+// without a valid dir, take the direction of their first strong character.
+// Reference: https://html.spec.whatwg.org/multipage/dom.html#the-directionality
+func Directionality(el *dom.Element) string {
 	for current := el; current != nil; current = current.AsNode().ParentElement() {
-		if current.HasAttribute("dir") {
-			elDir := strings.ToLower(current.GetAttribute("dir"))
-			return elDir == dir
+		switch strings.ToLower(current.GetAttribute("dir")) {
+		case "ltr":
+			return "ltr"
+		case "rtl":
+			return "rtl"
+		case "auto":
+			return autoDirectionality(current)
+		}
+		if current.LocalName() == "bdi" {
+			return autoDirectionality(current)
 		}
+		if current.LocalName() == "input" && strings.EqualFold(current.GetAttribute("type"), "tel") {
+			return "ltr"
+		}
+	}
+	return "ltr"
+}
+
+// autoDirectionality returns the direction of the first strong character
+// in the text of an element, skipping descendants that set their own
+// direction, or "ltr" when there is none.
+func autoDirectionality(el *dom.Element) string {
+	switch el.LocalName() {
+	case "input", "textarea":
+		if dir := firstStrongDirection(el.GetAttribute("value")); dir != "" {
+			return dir
+		}
+		if dir := firstStrongDirection(el.AsNode().TextContent()); dir != "" {
+			return dir
+		}
+		return "ltr"
+	}
+	if dir := subtreeDirection(el.AsNode()); dir != "" {
+		return dir
 	}
+	return "ltr"
+}
 
-	// Default is ltr
-	return dir == "ltr"
+// subtreeDirection returns the direction of the first strong character in
+// the text descendants of n, or "" when there is none.
+func subtreeDirection(n *dom.Node) string {
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		switch child.NodeType() {
+		case dom.TextNode:
+			if dir := firstStrongDirection(child.NodeValue()); dir != "" {
+				return dir
+			}
+		case dom.ElementNode:
+			el := (*dom.Element)(child)
+			switch el.LocalName() {
+			case "bdi", "script", "style", "textarea":
+				continue
+			}
+			switch strings.ToLower(el.GetAttribute("dir")) {
+			case "ltr", "rtl", "auto":
+				continue
+			}
+			if dir := subtreeDirection(child); dir != "" {
+				return dir
+			}
+		}
+	}
+	return ""
+}
+
+// firstStrongDirection returns the direction of the first character of s
+// with a strong bidi class, or "" when there is none.
+func firstStrongDirection(s string) string {
+	for _, r := range s {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.L:
+			return "ltr"
+		case bidi.R, bidi.AL:
+			return "rtl"
+		}
+	}
+	return ""
 }
 
 // QuerySelector returns the first element matching the selector.
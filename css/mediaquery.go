@@ -0,0 +1,566 @@
+// Package css provides media query parsing and evaluation.
+// Media queries select the style rules of @media blocks and of stylesheets
+// with a media attribute, and back window.matchMedia.
+// Reference: https://www.w3.org/TR/mediaqueries-4/
+package css
+
+import (
+	"strings"
+)
+
+// Viewport describes the environment that media queries are evaluated in
+// and that viewport-percentage lengths resolve against. Sizes are in CSS
+// pixels.
+type Viewport struct {
+	Width            float64
+	Height           float64
+	DevicePixelRatio float64
+}
+
+// MediaQueryList is a parsed comma-separated list of media queries. It
+// matches when any of its queries matches, and an empty list matches all
+// media.
+type MediaQueryList struct {
+	text    string
+	queries []*mediaQuery
+}
+
+// mediaQuery is a single media query: an optional media type and a
+// condition on media features.
+type mediaQuery struct {
+	not       bool
+	mediaType string         // Lowercased media type, empty for all
+	condition mediaCondition // nil when only a media type is given
+	invalid   bool           // Queries that fail to parse match nothing
+}
+
+// mediaCondition is a node of a media condition tree.
+type mediaCondition interface {
+	matches(vp Viewport) bool
+}
+
+type mediaNot struct{ condition mediaCondition }
+type mediaAnd []mediaCondition
+type mediaOr []mediaCondition
+
+// mediaFeature tests a media feature, either in a boolean context, as a
+// plain min-/max- prefixed or exact test, or in a range.
+type mediaFeature struct {
+	name string
+
+	// Comparisons the feature value must pass, e.g. >= 600 for
+	// (min-width: 600px) or (600px <= width)
+	comparisons []mediaComparison
+
+	// keyword is the value of a discrete feature test such as
+	// (orientation: portrait)
+	keyword string
+}
+
+type mediaComparison struct {
+	op    string // One of "<", "<=", "=", ">=", ">"
+	value float64
+}
+
+// generalEnclosed is a parenthesized condition of an unknown form, which
+// evaluates to false.
+type generalEnclosed struct{}
+
+func (generalEnclosed) matches(Viewport) bool { return false }
+
+// ParseMediaQueryList parses a comma-separated list of media queries, such
+// as the prelude of an @media rule or the media attribute of a <link>.
+func ParseMediaQueryList(text string) *MediaQueryList {
+	mql := &MediaQueryList{text: strings.TrimSpace(text)}
+	if mql.text == "" {
+		return mql
+	}
+	for _, group := range SplitComponentValuesByComma(ParseComponentValueList(text)) {
+		mql.queries = append(mql.queries, parseMediaQuery(NonWhitespaceComponents(group)))
+	}
+	return mql
+}
+
+// MediaText returns the text the list was parsed from.
+func (mql *MediaQueryList) MediaText() string {
+	return mql.text
+}
+
+// Matches reports whether any query of the list matches a viewport. A nil
+// or empty list matches.
+func (mql *MediaQueryList) Matches(vp Viewport) bool {
+	if mql == nil || len(mql.queries) == 0 {
+		return true
+	}
+	for _, q := range mql.queries {
+		if q.matches(vp) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *mediaQuery) matches(vp Viewport) bool {
+	if q.invalid {
+		return false
+	}
+	result := true
+	switch q.mediaType {
+	case "", "all", "screen":
+	default:
+		// This is a screen, never a printer or speech synthesizer
+		result = false
+	}
+	if result && q.condition != nil {
+		result = q.condition.matches(vp)
+	}
+	if q.not {
+		return !result
+	}
+	return result
+}
+
+// parseMediaQuery parses a media query from its non-whitespace component
+// values.
+func parseMediaQuery(cvs []ComponentValue) *mediaQuery {
+	q := &mediaQuery{}
+	if len(cvs) == 0 {
+		q.invalid = true
+		return q
+	}
+
+	// A query made of a media condition alone
+	if _, ok := cvs[0].(*Block); ok {
+		condition, ok := parseMediaCondition(cvs, true)
+		if !ok {
+			q.invalid = true
+		}
+		q.condition = condition
+		return q
+	}
+	if ident, _ := ComponentIdent(cvs[0]); ident == "not" && len(cvs) > 1 {
+		if _, ok := cvs[1].(*Block); ok {
+			condition, ok := parseMediaCondition(cvs, true)
+			if !ok {
+				q.invalid = true
+			}
+			q.condition = condition
+			return q
+		}
+	}
+
+	// [not | only]? <media-type> [and <media-condition-without-or>]?
+	ident, ok := ComponentIdent(cvs[0])
+	if ok && (ident == "not" || ident == "only") {
+		q.not = ident == "not"
+		cvs = cvs[1:]
+		if len(cvs) == 0 {
+			q.invalid = true
+			return q
+		}
+		ident, ok = ComponentIdent(cvs[0])
+	}
+	switch {
+	case !ok, ident == "not", ident == "only", ident == "and", ident == "or", ident == "layer":
+		q.invalid = true
+		return q
+	}
+	q.mediaType = ident
+	cvs = cvs[1:]
+	if len(cvs) == 0 {
+		return q
+	}
+	if and, _ := ComponentIdent(cvs[0]); and != "and" || len(cvs) == 1 {
+		q.invalid = true
+		return q
+	}
+	condition, ok := parseMediaCondition(cvs[1:], false)
+	if !ok {
+		q.invalid = true
+	}
+	q.condition = condition
+	return q
+}
+
+// parseMediaCondition parses a media condition: a negation, or parenthesized
+// conditions joined by and, or by or where allowOr is set.
+func parseMediaCondition(cvs []ComponentValue, allowOr bool) (mediaCondition, bool) {
+	if len(cvs) == 0 {
+		return nil, false
+	}
+	if ident, _ := ComponentIdent(cvs[0]); ident == "not" {
+		if len(cvs) != 2 {
+			return nil, false
+		}
+		inner, ok := parseMediaInParens(cvs[1])
+		if !ok {
+			return nil, false
+		}
+		return mediaNot{inner}, true
+	}
+
+	first, ok := parseMediaInParens(cvs[0])
+	if !ok {
+		return nil, false
+	}
+	if len(cvs) == 1 {
+		return first, true
+	}
+	combinator, _ := ComponentIdent(cvs[1])
+	if combinator != "and" && (combinator != "or" || !allowOr) {
+		return nil, false
+	}
+	conditions := []mediaCondition{first}
+	for i := 1; i < len(cvs); i += 2 {
+		if ident, _ := ComponentIdent(cvs[i]); ident != combinator || i+1 >= len(cvs) {
+			return nil, false
+		}
+		next, ok := parseMediaInParens(cvs[i+1])
+		if !ok {
+			return nil, false
+		}
+		conditions = append(conditions, next)
+	}
+	if combinator == "and" {
+		return mediaAnd(conditions), true
+	}
+	return mediaOr(conditions), true
+}
+
+// parseMediaInParens parses a parenthesized media condition or feature.
+// Other parenthesized content and functions are general enclosed.
+func parseMediaInParens(cv ComponentValue) (mediaCondition, bool) {
+	switch v := cv.(type) {
+	case *Function:
+		return generalEnclosed{}, true
+	case *Block:
+		if v.Token.Type != TokenOpenParen {
+			return nil, false
+		}
+		inner := NonWhitespaceComponents(v.Values)
+		if len(inner) == 0 {
+			return generalEnclosed{}, true
+		}
+		if _, ok := inner[0].(*Block); ok {
+			if condition, ok := parseMediaCondition(inner, true); ok {
+				return condition, true
+			}
+			return generalEnclosed{}, true
+		}
+		if ident, _ := ComponentIdent(inner[0]); ident == "not" {
+			if condition, ok := parseMediaCondition(inner, true); ok {
+				return condition, true
+			}
+			return generalEnclosed{}, true
+		}
+		if feature, ok := parseMediaFeature(inner); ok {
+			return feature, true
+		}
+		return generalEnclosed{}, true
+	}
+	return nil, false
+}
+
+// parseMediaFeature parses the contents of a media feature test.
+func parseMediaFeature(cvs []ComponentValue) (*mediaFeature, bool) {
+	// Boolean context, e.g. (hover)
+	if len(cvs) == 1 {
+		name, ok := ComponentIdent(cvs[0])
+		if !ok || !isMediaFeature(name) {
+			return nil, false
+		}
+		return &mediaFeature{name: name}, true
+	}
+
+	// Plain test, e.g. (min-width: 600px)
+	if pt, ok := cvs[1].(PreservedToken); ok && pt.Token.Type == TokenColon {
+		name, ok := ComponentIdent(cvs[0])
+		if !ok {
+			return nil, false
+		}
+		op := "="
+		switch {
+		case strings.HasPrefix(name, "min-"):
+			name, op = strings.TrimPrefix(name, "min-"), ">="
+		case strings.HasPrefix(name, "max-"):
+			name, op = strings.TrimPrefix(name, "max-"), "<="
+		case strings.HasPrefix(name, "-webkit-min-"):
+			name, op = "-webkit-"+strings.TrimPrefix(name, "-webkit-min-"), ">="
+		case strings.HasPrefix(name, "-webkit-max-"):
+			name, op = "-webkit-"+strings.TrimPrefix(name, "-webkit-max-"), "<="
+		}
+		if !isMediaFeature(name) {
+			return nil, false
+		}
+		valueComponents := cvs[2:]
+		if mediaKeywordFeatures[name] != nil {
+			keyword, ok := ComponentIdent(singleComponent(valueComponents))
+			if !ok || op != "=" {
+				return nil, false
+			}
+			return &mediaFeature{name: name, keyword: keyword}, true
+		}
+		value, ok := parseMediaValue(valueComponents)
+		if !ok {
+			return nil, false
+		}
+		return &mediaFeature{name: name, comparisons: []mediaComparison{{op, value}}}, true
+	}
+
+	return parseMediaRange(cvs)
+}
+
+// parseMediaRange parses a range test such as (width >= 600px),
+// (600px < width) or (400px <= width <= 700px).
+func parseMediaRange(cvs []ComponentValue) (*mediaFeature, bool) {
+	// Split the components into operands at comparison operators
+	var operands [][]ComponentValue
+	var ops []string
+	current := []ComponentValue{}
+	for i := 0; i < len(cvs); i++ {
+		pt, ok := cvs[i].(PreservedToken)
+		if !ok || pt.Token.Type != TokenDelim || !strings.ContainsRune("<>=", pt.Token.Delim) {
+			current = append(current, cvs[i])
+			continue
+		}
+		op := string(pt.Token.Delim)
+		if op != "=" && i+1 < len(cvs) {
+			if next, ok := cvs[i+1].(PreservedToken); ok && next.Token.Type == TokenDelim && next.Token.Delim == '=' {
+				op += "="
+				i++
+			}
+		}
+		operands = append(operands, current)
+		ops = append(ops, op)
+		current = []ComponentValue{}
+	}
+	operands = append(operands, current)
+
+	switch len(ops) {
+	case 1:
+		if name, ok := ComponentIdent(singleComponent(operands[0])); ok && isRangeFeature(name) {
+			value, ok := parseMediaValue(operands[1])
+			if !ok {
+				return nil, false
+			}
+			return &mediaFeature{name: name, comparisons: []mediaComparison{{ops[0], value}}}, true
+		}
+		if name, ok := ComponentIdent(singleComponent(operands[1])); ok && isRangeFeature(name) {
+			value, ok := parseMediaValue(operands[0])
+			if !ok {
+				return nil, false
+			}
+			return &mediaFeature{name: name, comparisons: []mediaComparison{{flipComparison(ops[0]), value}}}, true
+		}
+	case 2:
+		// Both operators must point the same way
+		if ops[0][0] != ops[1][0] || ops[0] == "=" || ops[1] == "=" {
+			return nil, false
+		}
+		name, ok := ComponentIdent(singleComponent(operands[1]))
+		if !ok || !isRangeFeature(name) {
+			return nil, false
+		}
+		low, ok := parseMediaValue(operands[0])
+		if !ok {
+			return nil, false
+		}
+		high, ok := parseMediaValue(operands[2])
+		if !ok {
+			return nil, false
+		}
+		return &mediaFeature{name: name, comparisons: []mediaComparison{
+			{flipComparison(ops[0]), low},
+			{ops[1], high},
+		}}, true
+	}
+	return nil, false
+}
+
+// singleComponent returns the only component of a list, or nil.
+func singleComponent(cvs []ComponentValue) ComponentValue {
+	if len(cvs) != 1 {
+		return nil
+	}
+	return cvs[0]
+}
+
+// flipComparison returns the operator that compares the other way round,
+// so that "600px < width" becomes "width > 600px".
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// parseMediaValue parses the value of a range feature to CSS pixels for
+// lengths, dots per pixel for resolutions, or a plain number for ratios
+// and other numbers.
+func parseMediaValue(cvs []ComponentValue) (float64, bool) {
+	switch len(cvs) {
+	case 1:
+		value, unit, tokenType, ok := ComponentNumber(cvs[0])
+		if !ok {
+			return 0, false
+		}
+		switch tokenType {
+		case TokenNumber:
+			return value, true
+		case TokenDimension:
+			switch unit {
+			case "dppx", "x":
+				return value, true
+			case "dpi":
+				return value / 96, true
+			case "dpcm":
+				return value * 2.54 / 96, true
+			case "px", "em", "rem", "pt", "pc", "in", "cm", "mm", "q", "ex", "ch":
+				return resolveLength(value, unit, 16, 16), true
+			}
+		}
+	case 3:
+		// A ratio such as 16/9
+		numerator, _, numType, ok := ComponentNumber(cvs[0])
+		if !ok || numType != TokenNumber {
+			return 0, false
+		}
+		if pt, ok := cvs[1].(PreservedToken); !ok || pt.Token.Type != TokenDelim || pt.Token.Delim != '/' {
+			return 0, false
+		}
+		denominator, _, denType, ok := ComponentNumber(cvs[2])
+		if !ok || denType != TokenNumber || denominator == 0 {
+			return 0, false
+		}
+		return numerator / denominator, true
+	}
+	return 0, false
+}
+
+// mediaKeywordFeatures lists the discrete media features and the value
+// each has in this browser.
+var mediaKeywordFeatures = map[string]func(vp Viewport) string{
+	"orientation": func(vp Viewport) string {
+		if vp.Height >= vp.Width {
+			return "portrait"
+		}
+		return "landscape"
+	},
+	"hover":                  func(Viewport) string { return "hover" },
+	"any-hover":              func(Viewport) string { return "hover" },
+	"pointer":                func(Viewport) string { return "fine" },
+	"any-pointer":            func(Viewport) string { return "fine" },
+	"prefers-color-scheme":   func(Viewport) string { return "light" },
+	"prefers-reduced-motion": func(Viewport) string { return "no-preference" },
+	"prefers-contrast":       func(Viewport) string { return "no-preference" },
+	"forced-colors":          func(Viewport) string { return "none" },
+	"inverted-colors":        func(Viewport) string { return "none" },
+	"display-mode":           func(Viewport) string { return "browser" },
+	"scripting":              func(Viewport) string { return "enabled" },
+	"update":                 func(Viewport) string { return "fast" },
+	"overflow-block":         func(Viewport) string { return "scroll" },
+	"overflow-inline":        func(Viewport) string { return "scroll" },
+	"color-gamut":            func(Viewport) string { return "srgb" },
+	"dynamic-range":          func(Viewport) string { return "standard" },
+}
+
+// mediaRangeFeature returns the value of a range media feature.
+func mediaRangeFeature(name string, vp Viewport) (float64, bool) {
+	switch name {
+	case "width", "device-width":
+		return vp.Width, true
+	case "height", "device-height":
+		return vp.Height, true
+	case "aspect-ratio", "device-aspect-ratio":
+		if vp.Height == 0 {
+			return 0, true
+		}
+		return vp.Width / vp.Height, true
+	case "resolution", "-webkit-device-pixel-ratio":
+		if vp.DevicePixelRatio == 0 {
+			return 1, true
+		}
+		return vp.DevicePixelRatio, true
+	case "color":
+		return 8, true
+	case "color-index", "monochrome", "grid":
+		return 0, true
+	}
+	return 0, false
+}
+
+// isMediaFeature reports whether a name is a known media feature.
+func isMediaFeature(name string) bool {
+	return mediaKeywordFeatures[name] != nil || isRangeFeature(name)
+}
+
+// isRangeFeature reports whether a name is a known numeric media feature.
+func isRangeFeature(name string) bool {
+	_, ok := mediaRangeFeature(name, Viewport{})
+	return ok
+}
+
+func (f *mediaFeature) matches(vp Viewport) bool {
+	if valueOf := mediaKeywordFeatures[f.name]; valueOf != nil {
+		value := valueOf(vp)
+		if f.keyword == "" {
+			return value != "none" && value != "no-preference"
+		}
+		return value == f.keyword
+	}
+	value, _ := mediaRangeFeature(f.name, vp)
+	if len(f.comparisons) == 0 {
+		return value != 0
+	}
+	for _, c := range f.comparisons {
+		var ok bool
+		switch c.op {
+		case "<":
+			ok = value < c.value
+		case "<=":
+			ok = value <= c.value+mediaEpsilon
+		case "=":
+			ok = value >= c.value-mediaEpsilon && value <= c.value+mediaEpsilon
+		case ">=":
+			ok = value >= c.value-mediaEpsilon
+		case ">":
+			ok = value > c.value
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaEpsilon absorbs rounding, e.g. of ratios, in inclusive comparisons.
+const mediaEpsilon = 1e-6
+
+func (n mediaNot) matches(vp Viewport) bool {
+	return !n.condition.matches(vp)
+}
+
+func (a mediaAnd) matches(vp Viewport) bool {
+	for _, c := range a {
+		if !c.matches(vp) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o mediaOr) matches(vp Viewport) bool {
+	for _, c := range o {
+		if c.matches(vp) {
+			return true
+		}
+	}
+	return false
+}
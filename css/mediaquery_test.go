@@ -0,0 +1,93 @@
+package css
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+func TestMediaQueryMatches(t *testing.T) {
+	landscape := Viewport{Width: 1024, Height: 768, DevicePixelRatio: 2}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"all", true},
+		{"screen", true},
+		{"print", false},
+		{"not print", true},
+		{"only screen and (min-width: 1000px)", true},
+		{"screen and (max-width: 600px)", false},
+		{"print, (orientation: landscape)", true},
+		{"(orientation: portrait)", false},
+		{"(width >= 1024px)", true},
+		{"(width > 1024px)", false},
+		{"(600px < width <= 1024px)", true},
+		{"(800px < height)", false},
+		{"(min-aspect-ratio: 4/3)", true},
+		{"(max-aspect-ratio: 1/1)", false},
+		{"(min-resolution: 2dppx)", true},
+		{"(-webkit-min-device-pixel-ratio: 1.5)", true},
+		{"(min-resolution: 192dpi)", true},
+		{"(min-width: 40em)", true},
+		{"(hover) and (pointer: fine)", true},
+		{"(prefers-color-scheme: dark)", false},
+		{"not (prefers-reduced-motion: reduce)", true},
+		{"((min-width: 2000px) or (min-height: 700px))", true},
+		{"(min-width: 500px) and (max-width: 900px)", false},
+		{"screen and (min-width: 500px) or (max-width: 900px)", false},
+		{"(unknown-feature)", false},
+		{"garbage and", false},
+	}
+	for _, tt := range tests {
+		if got := ParseMediaQueryList(tt.query).Matches(landscape); got != tt.want {
+			t.Errorf("%q matches = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMediaRulesFollowViewport(t *testing.T) {
+	doc, err := dom.ParseHTML(`<div id="box"></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	div := doc.GetElementById("box")
+	resolver := NewStyleResolver()
+	resolver.AddAuthorStylesheet(NewParser(`
+		div { width: 50vw; height: 25vh; color: red }
+		@media (max-width: 600px) {
+			div { color: green }
+			@media (orientation: portrait) { div { color: blue } }
+		}
+	`).Parse())
+	printSheet := NewParser(`div { display: none }`).Parse()
+	printSheet.Media = ParseMediaQueryList("print")
+	resolver.AddAuthorStylesheet(printSheet)
+
+	tests := []struct {
+		viewport      Viewport
+		width, height float64
+		color         string
+	}{
+		{Viewport{Width: 1000, Height: 800}, 500, 200, "red"},
+		{Viewport{Width: 500, Height: 400}, 250, 100, "green"},
+		{Viewport{Width: 400, Height: 800}, 200, 200, "blue"},
+	}
+	for _, tt := range tests {
+		resolver.SetViewport(tt.viewport)
+		style := resolver.ResolveStyles(div, nil)
+		if got := style.GetPropertyValue("width").Length; got != tt.width {
+			t.Errorf("%v: width = %v, want %v", tt.viewport, got, tt.width)
+		}
+		if got := style.GetPropertyValue("height").Length; got != tt.height {
+			t.Errorf("%v: height = %v, want %v", tt.viewport, got, tt.height)
+		}
+		if got := style.GetComputedStyleProperty("color"); got != tt.color {
+			t.Errorf("%v: color = %v, want %v", tt.viewport, got, tt.color)
+		}
+		if got := style.GetComputedStyleProperty("display"); got == "none" {
+			t.Errorf("%v: print stylesheet applied", tt.viewport)
+		}
+	}
+}
@@ -8,7 +8,17 @@ import (
 
 // Stylesheet represents a parsed CSS stylesheet with high-level API.
 type Stylesheet struct {
-	Rules []Rule
+	Rules     []Rule
+	FontFaces []FontFace
+
+	// Media is the media query list of the element that linked or embedded
+	// the stylesheet, or nil when it applies to all media
+	Media *MediaQueryList
+}
+
+// FontFace represents an @font-face rule and its descriptors.
+type FontFace struct {
+	Declarations []Declaration
 }
 
 // Rule represents a CSS style rule (qualified rule with selector and declarations).
@@ -17,6 +27,9 @@ type Rule struct {
 	Declarations []Declaration
 	SelectorText string
 	Specificity  Specificity
+
+	// Media holds the conditions of the @media rules the rule is nested in
+	Media []*MediaQueryList
 }
 
 // Selector represents a CSS selector (legacy API - use CSSSelector for full support).
@@ -114,21 +127,40 @@ func (p *Parser) Parse() *Stylesheet {
 // convertParsedStylesheet converts a ParsedStylesheet to the legacy Stylesheet format.
 func convertParsedStylesheet(parsed *ParsedStylesheet) *Stylesheet {
 	ss := &Stylesheet{}
+	convertRules(ss, parsed.Rules, nil)
+	return ss
+}
 
-	for _, cssRule := range parsed.Rules {
+// convertRules appends style and @font-face rules to a stylesheet. Style
+// rules nested in @media blocks carry their media conditions.
+func convertRules(ss *Stylesheet, rules []CSSRule, media []*MediaQueryList) {
+	for _, cssRule := range rules {
 		switch r := cssRule.(type) {
 		case *QualifiedRule:
 			rule := convertQualifiedRule(r)
 			if rule != nil {
+				rule.Media = media
 				ss.Rules = append(ss.Rules, *rule)
 			}
 		case *AtRule:
 			// Handle at-rules (like @media, @import, etc.)
-			// For now, skip them as we focus on style rules
+			// For now, only @media and @font-face are kept besides style rules
+			switch {
+			case strings.EqualFold(r.Name, "media") && r.Block != nil:
+				var prelude strings.Builder
+				writeComponentValue(&prelude, r.Prelude)
+				nested := append(media[:len(media):len(media)], ParseMediaQueryList(prelude.String()))
+				blockParser := &CSSParser{tokens: componentValuesToTokens(r.Block.Values)}
+				convertRules(ss, blockParser.consumeRuleList(false), nested)
+			case strings.EqualFold(r.Name, "font-face") && r.Block != nil:
+				var rule FontFace
+				for _, decl := range ParseBlockContents(r.Block) {
+					rule.Declarations = append(rule.Declarations, convertDeclaration(decl))
+				}
+				ss.FontFaces = append(ss.FontFaces, rule)
+			}
 		}
 	}
-
-	return ss
 }
 
 // writeComponentValue writes component values to a string builder for selector text.
@@ -341,49 +373,19 @@ func convertDeclaration(decl *CSSDeclaration) Declaration {
 	// Build raw value string
 	var rawValue strings.Builder
 	for _, cv := range decl.Value {
-		switch v := cv.(type) {
-		case PreservedToken:
-			switch v.Token.Type {
-			case TokenIdent:
-				rawValue.WriteString(v.Token.Value)
-			case TokenNumber:
-				rawValue.WriteString(v.Token.Value)
-			case TokenPercentage:
-				rawValue.WriteString(v.Token.Value)
-				rawValue.WriteString("%")
-			case TokenDimension:
-				rawValue.WriteString(v.Token.Value)
-				rawValue.WriteString(v.Token.Unit)
-			case TokenString:
-				rawValue.WriteString("\"")
-				rawValue.WriteString(v.Token.Value)
-				rawValue.WriteString("\"")
-			case TokenHash:
-				rawValue.WriteString("#")
-				rawValue.WriteString(v.Token.Value)
-			case TokenWhitespace:
-				rawValue.WriteString(" ")
-			case TokenDelim:
-				rawValue.WriteRune(v.Token.Delim)
-			case TokenComma:
-				rawValue.WriteString(",")
-			case TokenURL:
-				rawValue.WriteString("url(")
-				rawValue.WriteString(v.Token.Value)
-				rawValue.WriteString(")")
-			}
-		case *Function:
-			rawValue.WriteString(v.Name)
-			rawValue.WriteString("(")
-			// Function arguments would go here
-			rawValue.WriteString(")")
-		}
+		writeSerializedComponent(&rawValue, cv)
 	}
 	d.RawValue = strings.TrimSpace(rawValue.String())
 
 	// Parse value
 	d.Value = parseValue(decl.Value)
 
+	// Multi-component values keep their source text so painting and layout
+	// can interpret shorthands, lists and functions.
+	if d.Value.Type == ListValue && d.Value.Raw == "" {
+		d.Value.Raw = d.RawValue
+	}
+
 	return d
 }
 
@@ -536,7 +538,7 @@ func parseFunctionValue(fn *Function) Value {
 	default:
 		return Value{
 			Type: FunctionValue,
-			Raw:  fn.String(),
+			Raw:  serializeFunction(fn),
 		}
 	}
 }
@@ -563,7 +565,7 @@ func parseRGBFunction(fn *Function) Value {
 			B: uint8(b),
 			A: uint8(a * 255),
 		},
-		Raw: fn.String(),
+		Raw: serializeFunction(fn),
 	}
 }
 
@@ -592,7 +594,7 @@ func parseHSLFunction(fn *Function) Value {
 			B: uint8(b * 255),
 			A: uint8(a * 255),
 		},
-		Raw: fn.String(),
+		Raw: serializeFunction(fn),
 	}
 }
 
@@ -663,7 +665,7 @@ func parseURLFunction(fn *Function) Value {
 func parseMathFunction(fn *Function) Value {
 	return Value{
 		Type: FunctionValue,
-		Raw:  fn.String(),
+		Raw:  serializeFunction(fn),
 	}
 }
 
@@ -345,6 +345,37 @@ func TestParserSpecificity(t *testing.T) {
 	}
 }
 
+func TestParserFontFace(t *testing.T) {
+	css := `
+		@font-face {
+			font-family: "Open Sans";
+			src: url(open-sans.woff2) format("woff2"), local(Arial);
+			unicode-range: U+0000-00FF, U+20AC;
+		}
+		p { font-family: "Open Sans" }
+	`
+
+	stylesheet := NewParser(css).Parse()
+	if len(stylesheet.Rules) != 1 || len(stylesheet.FontFaces) != 1 {
+		t.Fatalf("expected 1 rule and 1 @font-face, got %d and %d", len(stylesheet.Rules), len(stylesheet.FontFaces))
+	}
+
+	want := map[string]string{
+		"font-family":   `"Open Sans"`,
+		"src":           `url(open-sans.woff2) format("woff2"), local(Arial)`,
+		"unicode-range": "U+0-FF, U+20AC",
+	}
+	decls := stylesheet.FontFaces[0].Declarations
+	if len(decls) != len(want) {
+		t.Fatalf("expected %d descriptors, got %d", len(want), len(decls))
+	}
+	for _, decl := range decls {
+		if decl.RawValue != want[decl.Property] {
+			t.Errorf("%s: expected %q, got %q", decl.Property, want[decl.Property], decl.RawValue)
+		}
+	}
+}
+
 func TestCSSParserStylesheet(t *testing.T) {
 	css := `
 		/* Comment */
@@ -0,0 +1,64 @@
+// Package css provides the presentation attributes of SVG elements.
+// Reference: https://www.w3.org/TR/SVG2/styling.html#PresentationAttributes
+package css
+
+import (
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// svgPresentationAttributes lists the SVG attributes that map directly onto
+// CSS properties of the same name.
+var svgPresentationAttributes = []string{
+	"color",
+	"display",
+	"fill",
+	"fill-opacity",
+	"fill-rule",
+	"font-family",
+	"font-size",
+	"font-style",
+	"font-weight",
+	"opacity",
+	"stop-color",
+	"stop-opacity",
+	"stroke",
+	"stroke-dasharray",
+	"stroke-dashoffset",
+	"stroke-linecap",
+	"stroke-linejoin",
+	"stroke-miterlimit",
+	"stroke-opacity",
+	"stroke-width",
+	"text-anchor",
+	"visibility",
+}
+
+// applyPresentationHints applies the presentation attributes of an SVG
+// element. They behave like author declarations that come before all other
+// author rules.
+func applyPresentationHints(cs *ComputedStyle, el *dom.Element, parent *ComputedStyle) {
+	if el == nil || el.NamespaceURI() != dom.SVGNamespace {
+		return
+	}
+	var sb strings.Builder
+	for _, name := range svgPresentationAttributes {
+		if !el.HasAttribute(name) {
+			continue
+		}
+		value := el.GetAttribute(name)
+		// Each attribute holds a single value; anything that could end the
+		// declaration is invalid
+		if strings.ContainsAny(value, ";{}") {
+			continue
+		}
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(value)
+		sb.WriteString("; ")
+	}
+	if sb.Len() > 0 {
+		applyInlineStyle(cs, sb.String(), parent)
+	}
+}
@@ -545,3 +545,115 @@ func TestParseAnPlusB(t *testing.T) {
 		}
 	}
 }
+
+func TestDirectionality(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body>
+		<div id="rtl" dir="rtl"><p id="inherited">x</p><span id="ltr" dir="ltr">y</span></div>
+		<p id="auto" dir="auto"><span dir="ltr">skipped</span> שלום</p>
+		<p id="auto-ltr" dir="auto">123 abc</p>
+		<div dir="rtl"><bdi id="bdi">abc</bdi></div>
+		<p id="default">z</p>
+	</body></html>`)
+	tests := map[string]string{
+		"rtl":       "rtl",
+		"inherited": "rtl",
+		"ltr":       "ltr",
+		"auto":      "rtl",
+		"auto-ltr":  "ltr",
+		"bdi":       "ltr",
+		"default":   "ltr",
+	}
+	for id, want := range tests {
+		el := doc.GetElementById(id)
+		if got := Directionality(el); got != want {
+			t.Errorf("Directionality(#%s) = %q, want %q", id, got, want)
+		}
+		sel, _ := ParseSelector(":dir(" + want + ")")
+		if !sel.MatchElement(el) {
+			t.Errorf(":dir(%s) does not match #%s", want, id)
+		}
+	}
+}
+
+func TestHoverAndActiveMatching(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body>
+		<div id="outer"><a id="link" href="#"><span id="inner">x</span></a></div>
+		<p id="other">y</p>
+	</body></html>`)
+	hover, _ := ParseSelector(":hover")
+	active, _ := ParseSelector(":active")
+	ids := []string{"outer", "link", "inner", "other"}
+	matching := func(sel *CSSSelector) map[string]bool {
+		got := map[string]bool{}
+		for _, id := range ids {
+			if sel.MatchElement(doc.GetElementById(id)) {
+				got[id] = true
+			}
+		}
+		return got
+	}
+
+	if got := matching(hover); len(got) != 0 {
+		t.Errorf(":hover matched %v without a hovered element", got)
+	}
+	doc.SetHoveredElement(doc.GetElementById("inner"))
+	doc.SetPressedElement(doc.GetElementById("link"))
+	if got := matching(hover); !got["outer"] || !got["link"] || !got["inner"] || got["other"] {
+		t.Errorf(":hover matched %v, want the hovered element and its ancestors", got)
+	}
+	if got := matching(active); !got["outer"] || !got["link"] || got["inner"] || got["other"] {
+		t.Errorf(":active matched %v, want the pressed element and its ancestors", got)
+	}
+	doc.SetPressedElement(nil)
+	if got := matching(active); len(got) != 0 {
+		t.Errorf(":active matched %v after the button was released", got)
+	}
+}
+
+func TestFocusMatching(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body>
+		<form id="form"><button id="button">b</button><input id="field"></form>
+	</body></html>`)
+	match := func(selector, id string) bool {
+		sel, err := ParseSelector(selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sel.MatchElement(doc.GetElementById(id))
+	}
+
+	if match(":focus", "button") || match(":focus-within", "form") {
+		t.Error("focus pseudo-classes matched without a focused element")
+	}
+	doc.SetFocusedElement(doc.GetElementById("button"))
+	if !match(":focus", "button") || match(":focus", "form") || match(":focus", "field") {
+		t.Error(":focus should match only the focused element")
+	}
+	if !match(":focus-within", "form") || !match(":focus-within", "button") || match(":focus-within", "field") {
+		t.Error(":focus-within should match the focused element and its ancestors")
+	}
+	if !match(":focus-visible", "button") {
+		t.Error(":focus-visible should match keyboard focus")
+	}
+	doc.SetFocusedByPointer(true)
+	if match(":focus-visible", "button") {
+		t.Error(":focus-visible should not match a button focused with the pointer")
+	}
+	doc.SetFocusedElement(doc.GetElementById("field"))
+	if !match(":focus-visible", "field") {
+		t.Error(":focus-visible should match a text field focused with the pointer")
+	}
+}
+
+func TestTargetMatching(t *testing.T) {
+	doc := createTestDocumentFromHTML(`<html><body><h2 id="notes">Notes</h2><p id="other">x</p></body></html>`)
+	target, _ := ParseSelector(":target")
+	notes, other := doc.GetElementById("notes"), doc.GetElementById("other")
+	if target.MatchElement(notes) {
+		t.Error(":target matched without a target element")
+	}
+	doc.SetTargetElement(doc.IndicatedElement("notes"))
+	if !target.MatchElement(notes) || target.MatchElement(other) {
+		t.Error(":target should match only the element the fragment indicates")
+	}
+}
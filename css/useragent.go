@@ -364,13 +364,29 @@ rp {
 	display: none;
 }
 
-/* Bdi/Bdo */
-bdi {
+/* Bidirectional text */
+[dir], bdi, output {
 	unicode-bidi: isolate;
 }
 
 bdo {
-	unicode-bidi: bidi-override;
+	unicode-bidi: isolate-override;
+}
+
+bdo[dir] {
+	unicode-bidi: isolate-override;
+}
+
+pre[dir=auto], textarea[dir=auto] {
+	unicode-bidi: plaintext;
+}
+
+[dir]:dir(ltr), bdi:dir(ltr) {
+	direction: ltr;
+}
+
+[dir]:dir(rtl), bdi:dir(rtl) {
+	direction: rtl;
 }
 
 /* BR and WBR */
@@ -0,0 +1,224 @@
+// Package css provides helpers for working with raw CSS component values.
+// Painting and layout use these to interpret properties (shadows, gradients,
+// radii) whose values are richer than a single keyword, length or color.
+// Reference: https://www.w3.org/TR/css-values-4/
+package css
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseComponentValueList parses text into a list of component values.
+// Functions and blocks are nested, unlike the flat token lists stored on declarations.
+func ParseComponentValueList(text string) []ComponentValue {
+	parser := NewCSSParser(text)
+	var values []ComponentValue
+	for parser.current().Type != TokenEOF {
+		values = append(values, parser.consumeComponentValue())
+	}
+	return values
+}
+
+// SplitComponentValuesByComma splits a component value list at top-level commas.
+// Each resulting group has leading and trailing whitespace removed.
+func SplitComponentValuesByComma(values []ComponentValue) [][]ComponentValue {
+	var groups [][]ComponentValue
+	var current []ComponentValue
+	for _, cv := range values {
+		if pt, ok := cv.(PreservedToken); ok && pt.Token.Type == TokenComma {
+			groups = append(groups, TrimComponentWhitespace(current))
+			current = nil
+			continue
+		}
+		current = append(current, cv)
+	}
+	groups = append(groups, TrimComponentWhitespace(current))
+	return groups
+}
+
+// TrimComponentWhitespace removes leading and trailing whitespace tokens.
+func TrimComponentWhitespace(values []ComponentValue) []ComponentValue {
+	start, end := 0, len(values)
+	for start < end && IsWhitespaceComponent(values[start]) {
+		start++
+	}
+	for end > start && IsWhitespaceComponent(values[end-1]) {
+		end--
+	}
+	return values[start:end]
+}
+
+// NonWhitespaceComponents returns the component values that are not whitespace.
+func NonWhitespaceComponents(values []ComponentValue) []ComponentValue {
+	result := make([]ComponentValue, 0, len(values))
+	for _, cv := range values {
+		if !IsWhitespaceComponent(cv) {
+			result = append(result, cv)
+		}
+	}
+	return result
+}
+
+// IsWhitespaceComponent reports whether a component value is a whitespace token.
+func IsWhitespaceComponent(cv ComponentValue) bool {
+	pt, ok := cv.(PreservedToken)
+	return ok && pt.Token.Type == TokenWhitespace
+}
+
+// ComponentIdent returns the lowercased identifier of a component value, if it is one.
+func ComponentIdent(cv ComponentValue) (string, bool) {
+	pt, ok := cv.(PreservedToken)
+	if !ok || pt.Token.Type != TokenIdent {
+		return "", false
+	}
+	return strings.ToLower(pt.Token.Value), true
+}
+
+// ComponentNumber returns the numeric value, unit and token type of a number,
+// percentage or dimension component value.
+func ComponentNumber(cv ComponentValue) (value float64, unit string, tokenType TokenType, ok bool) {
+	pt, isToken := cv.(PreservedToken)
+	if !isToken {
+		return 0, "", TokenEOF, false
+	}
+	switch pt.Token.Type {
+	case TokenNumber:
+		return pt.Token.NumValue, "", TokenNumber, true
+	case TokenPercentage:
+		return pt.Token.NumValue, "%", TokenPercentage, true
+	case TokenDimension:
+		return pt.Token.NumValue, strings.ToLower(pt.Token.Unit), TokenDimension, true
+	}
+	return 0, "", TokenEOF, false
+}
+
+// ComponentColor interprets a component value as a color.
+// The currentcolor keyword is reported as not a color so callers can substitute the element's color.
+func ComponentColor(cv ComponentValue) (Color, bool) {
+	switch v := cv.(type) {
+	case PreservedToken:
+		switch v.Token.Type {
+		case TokenHash:
+			return parseHashColor(v.Token.Value), true
+		case TokenIdent:
+			name := strings.ToLower(v.Token.Value)
+			if name == "currentcolor" {
+				return Color{}, false
+			}
+			c, ok := NamedColors[name]
+			return c, ok
+		}
+	case *Function:
+		switch strings.ToLower(v.Name) {
+		case "rgb", "rgba":
+			return parseRGBFunction(v).Color, true
+		case "hsl", "hsla":
+			return parseHSLFunction(v).Color, true
+		}
+	}
+	return Color{}, false
+}
+
+// SerializeComponentValues converts component values back to CSS text.
+func SerializeComponentValues(values []ComponentValue) string {
+	var sb strings.Builder
+	for _, cv := range values {
+		writeSerializedComponent(&sb, cv)
+	}
+	return sb.String()
+}
+
+func writeSerializedComponent(sb *strings.Builder, cv ComponentValue) {
+	switch v := cv.(type) {
+	case PreservedToken:
+		writeSerializedToken(sb, v.Token)
+	case *Function:
+		sb.WriteString(v.Name)
+		sb.WriteString("(")
+		for _, inner := range v.Values {
+			writeSerializedComponent(sb, inner)
+		}
+		sb.WriteString(")")
+	case *Block:
+		open, closing := "(", ")"
+		switch v.Token.Type {
+		case TokenOpenSquare:
+			open, closing = "[", "]"
+		case TokenOpenCurly:
+			open, closing = "{", "}"
+		}
+		sb.WriteString(open)
+		for _, inner := range v.Values {
+			writeSerializedComponent(sb, inner)
+		}
+		sb.WriteString(closing)
+	}
+}
+
+// writeSerializedToken writes a single token back as CSS text.
+func writeSerializedToken(sb *strings.Builder, tok Token) {
+	switch tok.Type {
+	case TokenIdent:
+		sb.WriteString(tok.Value)
+	case TokenFunction:
+		sb.WriteString(tok.Value)
+		sb.WriteString("(")
+	case TokenAtKeyword:
+		sb.WriteString("@")
+		sb.WriteString(tok.Value)
+	case TokenHash:
+		sb.WriteString("#")
+		sb.WriteString(tok.Value)
+	case TokenString:
+		sb.WriteString(`"`)
+		sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tok.Value))
+		sb.WriteString(`"`)
+	case TokenURL:
+		sb.WriteString("url(")
+		sb.WriteString(tok.Value)
+		sb.WriteString(")")
+	case TokenDelim:
+		sb.WriteRune(tok.Delim)
+	case TokenNumber:
+		sb.WriteString(tok.Value)
+	case TokenPercentage:
+		sb.WriteString(tok.Value)
+		sb.WriteString("%")
+	case TokenDimension:
+		sb.WriteString(tok.Value)
+		sb.WriteString(tok.Unit)
+	case TokenWhitespace:
+		sb.WriteString(" ")
+	case TokenColon:
+		sb.WriteString(":")
+	case TokenSemicolon:
+		sb.WriteString(";")
+	case TokenComma:
+		sb.WriteString(",")
+	case TokenOpenSquare:
+		sb.WriteString("[")
+	case TokenCloseSquare:
+		sb.WriteString("]")
+	case TokenOpenParen:
+		sb.WriteString("(")
+	case TokenCloseParen:
+		sb.WriteString(")")
+	case TokenOpenCurly:
+		sb.WriteString("{")
+	case TokenCloseCurly:
+		sb.WriteString("}")
+	case TokenUnicodeRange:
+		fmt.Fprintf(sb, "U+%X", tok.StartRange)
+		if tok.EndRange != tok.StartRange {
+			fmt.Fprintf(sb, "-%X", tok.EndRange)
+		}
+	}
+}
+
+// serializeFunction converts a function back to CSS text.
+func serializeFunction(fn *Function) string {
+	var sb strings.Builder
+	writeSerializedComponent(&sb, fn)
+	return sb.String()
+}
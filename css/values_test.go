@@ -0,0 +1,90 @@
+package css
+
+import "testing"
+
+func TestParseComponentValueListFunctions(t *testing.T) {
+	values := NonWhitespaceComponents(ParseComponentValueList("2px rgba(0, 0, 0, 0.5) inset"))
+	if len(values) != 3 {
+		t.Fatalf("got %d values, want 3", len(values))
+	}
+	if fn, ok := values[1].(*Function); !ok || fn.Name != "rgba" {
+		t.Errorf("second value = %#v, want rgba function", values[1])
+	}
+	if ident, ok := ComponentIdent(values[2]); !ok || ident != "inset" {
+		t.Errorf("third value ident = %q, %v", ident, ok)
+	}
+}
+
+func TestSplitComponentValuesByComma(t *testing.T) {
+	groups := SplitComponentValuesByComma(ParseComponentValueList("a b, rgb(1, 2, 3) ,c"))
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want 3", len(groups))
+	}
+	if got := SerializeComponentValues(groups[1]); got != "rgb(1, 2, 3)" {
+		t.Errorf("group 1 = %q", got)
+	}
+	if got := SerializeComponentValues(groups[2]); got != "c" {
+		t.Errorf("group 2 = %q", got)
+	}
+}
+
+func TestComponentNumber(t *testing.T) {
+	values := NonWhitespaceComponents(ParseComponentValueList("0 50% 1.5EM"))
+	tests := []struct {
+		value   float64
+		unit    string
+		tokType TokenType
+	}{
+		{0, "", TokenNumber},
+		{50, "%", TokenPercentage},
+		{1.5, "em", TokenDimension},
+	}
+	for i, tt := range tests {
+		value, unit, tokType, ok := ComponentNumber(values[i])
+		if !ok || value != tt.value || unit != tt.unit || tokType != tt.tokType {
+			t.Errorf("ComponentNumber(%d) = %v %q %v %v", i, value, unit, tokType, ok)
+		}
+	}
+}
+
+func TestComponentColor(t *testing.T) {
+	values := NonWhitespaceComponents(ParseComponentValueList("#f00 blue currentcolor hsl(120, 100%, 50%)"))
+
+	if c, ok := ComponentColor(values[0]); !ok || c != (Color{R: 255, A: 255}) {
+		t.Errorf("hash color = %+v, %v", c, ok)
+	}
+	if c, ok := ComponentColor(values[1]); !ok || c != (Color{B: 255, A: 255}) {
+		t.Errorf("named color = %+v, %v", c, ok)
+	}
+	if _, ok := ComponentColor(values[2]); ok {
+		t.Error("currentcolor should not resolve to a fixed color")
+	}
+	if c, ok := ComponentColor(values[3]); !ok || c.G != 255 {
+		t.Errorf("hsl color = %+v, %v", c, ok)
+	}
+}
+
+func TestSerializeComponentValues(t *testing.T) {
+	text := `linear-gradient(to right, #fff 10%, url(a.png)) "q\"s"`
+	if got := SerializeComponentValues(ParseComponentValueList(text)); got != text {
+		t.Errorf("SerializeComponentValues = %q, want %q", got, text)
+	}
+}
+
+func TestComputedNamedAndFunctionColors(t *testing.T) {
+	styles := []struct {
+		value string
+		want  Color
+	}{
+		{"red", Color{R: 255, A: 255}},
+		{"rgb(0, 128, 0)", Color{G: 128, A: 255}},
+	}
+	for _, tt := range styles {
+		sheet := NewParser("p { color: " + tt.value + " }").Parse()
+		decl := sheet.Rules[0].Declarations[0]
+		cv := computeValue(&decl.Value, "color")
+		if cv.Color != tt.want {
+			t.Errorf("computed %q = %+v, want %+v", tt.value, cv.Color, tt.want)
+		}
+	}
+}
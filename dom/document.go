@@ -1930,6 +1930,93 @@ func (d *Document) GetFocusedElement() *Element {
 	return nil
 }
 
+// FocusedByPointer returns true if the focus was last moved by pressing a
+// pointer button rather than with the keyboard. Such focus only matches
+// :focus-visible in text controls.
+func (d *Document) FocusedByPointer() bool {
+	n := d.AsNode()
+	return n.documentData != nil && n.documentData.focusedByPointer
+}
+
+// SetFocusedByPointer records whether the focus was last moved by pressing a
+// pointer button. Focus moved by script keeps the last recorded value.
+func (d *Document) SetFocusedByPointer(byPointer bool) {
+	n := d.AsNode()
+	if n.documentData == nil {
+		return
+	}
+	n.documentData.focusedByPointer = byPointer
+}
+
+// HoveredElement returns the element the pointer is over, or nil.
+func (d *Document) HoveredElement() *Element {
+	n := d.AsNode()
+	if n.documentData == nil || n.documentData.hoveredElement == nil {
+		return nil
+	}
+	return (*Element)(n.documentData.hoveredElement)
+}
+
+// SetHoveredElement sets the element the pointer is over. It and its
+// ancestors match :hover. Pass nil when the pointer left the document.
+func (d *Document) SetHoveredElement(el *Element) {
+	n := d.AsNode()
+	if n.documentData == nil {
+		return
+	}
+	n.documentData.hoveredElement = nil
+	if el != nil {
+		n.documentData.hoveredElement = el.AsNode()
+	}
+}
+
+// PressedElement returns the element a pointer button is held down on, or
+// nil.
+func (d *Document) PressedElement() *Element {
+	n := d.AsNode()
+	if n.documentData == nil || n.documentData.pressedElement == nil {
+		return nil
+	}
+	return (*Element)(n.documentData.pressedElement)
+}
+
+// SetPressedElement sets the element a pointer button is held down on. It
+// and its ancestors match :active until the button is released and nil is
+// set.
+func (d *Document) SetPressedElement(el *Element) {
+	n := d.AsNode()
+	if n.documentData == nil {
+		return
+	}
+	n.documentData.pressedElement = nil
+	if el != nil {
+		n.documentData.pressedElement = el.AsNode()
+	}
+}
+
+// TargetElement returns the element the fragment of the document's URL
+// indicates, which matches :target, or nil.
+func (d *Document) TargetElement() *Element {
+	n := d.AsNode()
+	if n.documentData == nil || n.documentData.targetElement == nil {
+		return nil
+	}
+	return (*Element)(n.documentData.targetElement)
+}
+
+// SetTargetElement sets the element the fragment of the document's URL
+// indicates. Pass nil when the fragment indicates no element.
+func (d *Document) SetTargetElement(el *Element) {
+	n := d.AsNode()
+	if n.documentData == nil {
+		return
+	}
+	n.documentData.targetElement = nil
+	if el != nil {
+		n.documentData.targetElement = el.AsNode()
+	}
+}
+
 // DocumentNamedItem represents the result of a document named item access.
 // It can be a single element or a collection of elements.
 type DocumentNamedItem struct {
@@ -1724,8 +1724,12 @@ func (e *Element) InputValue() string {
 }
 
 // SetInputValue sets the current value for input elements.
-// This sets the dirty value flag to true.
+// This sets the dirty value flag to true. A new value moves the text
+// selection to its end.
 func (e *Element) SetInputValue(value string) {
+	if value != e.InputValue() {
+		e.InputData().selectionSet = false
+	}
 	data := e.InputData()
 	data.valueDirty = true
 	data.value = value
@@ -2337,11 +2341,15 @@ func (e *Element) TextAreaValue() string {
 	return e.TextContent()
 }
 
-// SetTextAreaValue sets the value of a textarea element.
+// SetTextAreaValue sets the value of a textarea element. A new value moves
+// the text selection to its end.
 func (e *Element) SetTextAreaValue(value string) {
 	if strings.ToLower(e.LocalName()) != "textarea" {
 		return
 	}
+	if value != e.TextAreaValue() {
+		e.InputData().selectionSet = false
+	}
 	data := e.InputData()
 	data.valueDirty = true
 	data.value = value
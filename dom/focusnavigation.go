@@ -0,0 +1,112 @@
+package dom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TabIndex returns the tabindex of an element: the value of its tabindex
+// attribute, or 0 for elements that are focusable by default and -1 for
+// the others.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/interaction.html#dom-tabindex
+func (e *Element) TabIndex() int {
+	if e.HasAttribute("tabindex") {
+		var tabIndex int
+		if _, err := fmt.Sscanf(e.GetAttribute("tabindex"), "%d", &tabIndex); err == nil {
+			return tabIndex
+		}
+	}
+	switch strings.ToLower(e.LocalName()) {
+	case "a":
+		if e.HasAttribute("href") {
+			return 0
+		}
+	case "button", "input", "select", "textarea", "summary":
+		return 0
+	}
+	return -1
+}
+
+// NextFocusable returns the element that sequential focus navigation moves
+// to from an element, or from the start of the document if from is nil:
+// the next one in the sequential focus order, or the previous one when
+// going backward. Navigation wraps around at the ends of the order. It
+// returns nil if no element takes part in the order.
+//
+// The order holds the focusable elements with a non-negative tabindex,
+// including those in shadow trees: first those with a positive tabindex
+// by increasing tabindex, then the others, each in tree order.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/interaction.html#sequential-focus-navigation
+func (d *Document) NextFocusable(from *Element, backward bool) *Element {
+	tree, order := d.sequentialFocusOrder()
+	if len(order) == 0 {
+		return nil
+	}
+	position := make(map[*Element]int, len(order))
+	for i, el := range order {
+		position[el] = i
+	}
+	if i, ok := position[from]; ok {
+		if backward {
+			return order[(i+len(order)-1)%len(order)]
+		}
+		return order[(i+1)%len(order)]
+	}
+
+	// Elements outside the order, such as those with a negative tabindex,
+	// navigate from their place in the tree
+	for i, el := range tree {
+		if el != from {
+			continue
+		}
+		if backward {
+			for j := i - 1; j >= 0; j-- {
+				if _, ok := position[tree[j]]; ok {
+					return tree[j]
+				}
+			}
+			break
+		}
+		for _, next := range tree[i+1:] {
+			if _, ok := position[next]; ok {
+				return next
+			}
+		}
+		break
+	}
+	if backward {
+		return order[len(order)-1]
+	}
+	return order[0]
+}
+
+// sequentialFocusOrder returns the elements of the document in shadow
+// including tree order, and those of them in sequential focus navigation
+// order. Elements that are hidden or inert are not in the order.
+func (d *Document) sequentialFocusOrder() (tree, order []*Element) {
+	var visit func(n *Node, excluded bool)
+	visit = func(n *Node, excluded bool) {
+		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+			if child.NodeType() != ElementNode {
+				continue
+			}
+			el := (*Element)(child)
+			excluded := excluded || el.HasAttribute("hidden") || el.HasAttribute("inert")
+			tree = append(tree, el)
+			if !excluded && el.IsFocusable() && el.TabIndex() >= 0 {
+				order = append(order, el)
+			}
+			if sr := el.GetShadowRoot(); sr != nil {
+				visit(sr.AsNode(), excluded)
+			}
+			visit(child, excluded)
+		}
+	}
+	visit(d.AsNode(), false)
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i].TabIndex(), order[j].TabIndex()
+		return a > 0 && (b == 0 || a < b)
+	})
+	return tree, order
+}
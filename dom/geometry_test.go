@@ -205,3 +205,58 @@ func TestElement_ScrollProperties(t *testing.T) {
 		t.Errorf("Expected ScrollLeft=0 after setting negative, got %v", el.ScrollLeft())
 	}
 }
+
+func TestRange_GetClientRects(t *testing.T) {
+	doc := NewDocument()
+	p := doc.CreateElement("p")
+	b := doc.CreateElement("b")
+	first := doc.CreateTextNode("abcd")
+	second := doc.CreateTextNode("ef")
+	p.AsNode().AppendChild(first)
+	p.AsNode().AppendChild(b.AsNode())
+	b.AsNode().AppendChild(second)
+	b.SetGeometry(&ElementGeometry{X: 40, Y: 0, Width: 20, Height: 10})
+
+	// "abcd" wraps after "ab"; the caret positions come from layout
+	(*Text)(first).SetTextFragments([]TextFragment{
+		{X: 0, Y: 0, Width: 20, Height: 10, Start: 0, End: 2, Carets: []float64{0, 10, 20}},
+		{X: 0, Y: 10, Width: 20, Height: 10, Start: 3, End: 4, Carets: []float64{0, 20}},
+	})
+	(*Text)(second).SetTextFragments([]TextFragment{
+		{X: 40, Y: 0, Width: 20, Height: 10, Start: 0, End: 2, Carets: []float64{40, 45, 60}},
+	})
+
+	r := NewRange(doc)
+	r.SetStart(first, 1)
+	r.SetEnd(first, 4)
+	rects := r.GetClientRects()
+	if rects.Length() != 2 {
+		t.Fatalf("Expected 2 rects, got %d", rects.Length())
+	}
+	if got := *rects.Item(0); got != (DOMRect{X: 10, Y: 0, Width: 10, Height: 10}) {
+		t.Errorf("first line rect = %+v", got)
+	}
+	if got := *rects.Item(1); got != (DOMRect{X: 0, Y: 10, Width: 20, Height: 10}) {
+		t.Errorf("second line rect = %+v", got)
+	}
+	bounds := r.GetBoundingClientRect()
+	if *bounds != (DOMRect{X: 0, Y: 0, Width: 20, Height: 20}) {
+		t.Errorf("bounding rect = %+v", *bounds)
+	}
+
+	// A selected element contributes its border box and its text
+	r.SetStart(p.AsNode(), 1)
+	r.SetEnd(p.AsNode(), 2)
+	rects = r.GetClientRects()
+	if rects.Length() != 2 || rects.Item(0).X != 40 || rects.Item(1).Width != 20 {
+		t.Errorf("element rects = %+v", rects.items)
+	}
+
+	// A collapsed range has the zero-width rect of its caret
+	r.SetStart(second, 1)
+	r.Collapse(true)
+	rects = r.GetClientRects()
+	if rects.Length() != 1 || *rects.Item(0) != (DOMRect{X: 45, Y: 0, Width: 0, Height: 10}) {
+		t.Errorf("collapsed rects = %+v", rects.items)
+	}
+}
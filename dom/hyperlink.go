@@ -0,0 +1,92 @@
+package dom
+
+import (
+	"net/url"
+	"strings"
+)
+
+// IsHyperlink returns true for a and area elements with an href attribute,
+// which navigate when activated.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/links.html#hyperlink
+func (e *Element) IsHyperlink() bool {
+	if e.NamespaceURI() != HTMLNamespace || !e.HasAttribute("href") {
+		return false
+	}
+	name := e.LocalName()
+	return name == "a" || name == "area"
+}
+
+// BaseURL returns the URL that relative URLs in the document resolve
+// against: the href of the first base element that has one, resolved
+// against the document's URL, or else the document's URL.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/urls-and-fetching.html#document-base-url
+func (d *Document) BaseURL() string {
+	docURL := d.URL()
+	if base := d.firstBaseWith("href"); base != nil {
+		if documentURL, err := url.Parse(docURL); err == nil {
+			if href, err := documentURL.Parse(strings.TrimSpace(base.GetAttribute("href"))); err == nil {
+				return href.String()
+			}
+		}
+	}
+	return docURL
+}
+
+// BaseTarget returns the target of the first base element that has one,
+// the browsing context links without a target navigate, or "".
+// Per HTML spec: https://html.spec.whatwg.org/multipage/semantics.html#get-an-element's-target
+func (d *Document) BaseTarget() string {
+	if base := d.firstBaseWith("target"); base != nil {
+		return base.GetAttribute("target")
+	}
+	return ""
+}
+
+// firstBaseWith returns the first base element in tree order with an
+// attribute.
+func (d *Document) firstBaseWith(attr string) *Element {
+	bases := d.GetElementsByTagName("base")
+	for i := 0; i < bases.Length(); i++ {
+		if base := bases.Item(i); base != nil && base.HasAttribute(attr) {
+			return base
+		}
+	}
+	return nil
+}
+
+// IndicatedElement returns the element a URL fragment indicates: the
+// element with the fragment as its id, or else the first a element with it
+// as its name, trying the percent-decoded fragment if the fragment itself
+// matches nothing. It returns nil for an empty fragment and for "top",
+// which indicate the top of the document.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/browsing-the-web.html#find-a-potential-indicated-element
+func (d *Document) IndicatedElement(fragment string) *Element {
+	if fragment == "" {
+		return nil
+	}
+	if el := d.potentialIndicatedElement(fragment); el != nil {
+		return el
+	}
+	decoded, err := url.PathUnescape(fragment)
+	if err == nil && decoded != fragment {
+		if el := d.potentialIndicatedElement(decoded); el != nil {
+			return el
+		}
+	}
+	return nil
+}
+
+// potentialIndicatedElement returns the element with an id, or the first a
+// element with it as its name.
+func (d *Document) potentialIndicatedElement(name string) *Element {
+	if el := d.GetElementById(name); el != nil {
+		return el
+	}
+	anchors := d.GetElementsByTagName("a")
+	for i := 0; i < anchors.Length(); i++ {
+		if a := anchors.Item(i); a != nil && a.GetAttribute("name") == name {
+			return a
+		}
+	}
+	return nil
+}
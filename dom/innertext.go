@@ -1,8 +1,10 @@
 package dom
 
 import (
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf16"
 )
 
 // InnerText returns the "rendered" text content of an element.
@@ -44,6 +46,45 @@ func (e *Element) InnerText() string {
 	}
 
 	// Element is being rendered - compute rendered text
+	return e.renderedText(&innerTextContext{}).Text
+}
+
+// RenderedText is the innerText of an element along with the text node
+// each of its characters was rendered from, so text found in it can be
+// located in the document.
+type RenderedText struct {
+	Text  string
+	chars []renderedChar
+}
+
+// renderedChar maps a character of rendered text to the part of a text
+// node it was rendered from.
+type renderedChar struct {
+	index    int // Byte offset in the rendered text
+	node     *Node
+	from, to int // UTF-16 offsets in the node's data
+}
+
+// TextSpan is the data of a text node between two UTF-16 offsets.
+type TextSpan struct {
+	Node       *Node
+	Start, End int
+}
+
+// RenderedText returns the innerText of an element along with where its
+// characters came from. rendered reports whether an element is being
+// rendered, such as whether layout generated boxes for it; the content of
+// elements it rejects is left out, as with elements hidden by their inline
+// style. A nil rendered relies on inline styles alone, as InnerText does.
+func (e *Element) RenderedText(rendered func(*Element) bool) *RenderedText {
+	if rendered != nil && !rendered(e) {
+		return &RenderedText{}
+	}
+	return e.renderedText(&innerTextContext{rendered: rendered, mapped: true})
+}
+
+// renderedText collects the rendered text of an element being rendered.
+func (e *Element) renderedText(ctx *innerTextContext) *RenderedText {
 	var result strings.Builder
 
 	// Determine initial whitespace mode from the element itself
@@ -61,15 +102,10 @@ func (e *Element) InnerText() string {
 		}
 	}
 
-	ctx := &innerTextContext{
-		whiteSpaceMode:        initialWhiteSpace,
-		lastOutputWasNewline:  true, // Start as if after a newline (for leading whitespace)
-		lastOutputWasSpace:    false,
-		afterBlockStart:       true,
-		needsLeadingNewline:   false,
-		needsTrailingNewlines: 0,
-		visibility:            initialVisibility,
-	}
+	ctx.whiteSpaceMode = initialWhiteSpace
+	ctx.lastOutputWasNewline = true // Start as if after a newline (for leading whitespace)
+	ctx.afterBlockStart = true
+	ctx.visibility = initialVisibility
 
 	e.collectInnerText(e.AsNode(), &result, ctx)
 
@@ -77,9 +113,28 @@ func (e *Element) InnerText() string {
 	text := result.String()
 	if initialWhiteSpace == "normal" || initialWhiteSpace == "nowrap" {
 		text = strings.TrimRight(text, " ")
+		ctx.truncateChars(len(text))
 	}
 
-	return text
+	return &RenderedText{Text: text, chars: ctx.chars}
+}
+
+// Spans returns the parts of text nodes the rendered text between two
+// byte offsets came from, in document order. Whitespace collapsed between
+// characters of the same node is included in their span; line breaks
+// between blocks come from no node.
+func (t *RenderedText) Spans(start, end int) []TextSpan {
+	i := sort.Search(len(t.chars), func(i int) bool { return t.chars[i].index >= start })
+	var spans []TextSpan
+	for ; i < len(t.chars) && t.chars[i].index < end; i++ {
+		c := t.chars[i]
+		if n := len(spans); n > 0 && spans[n-1].Node == c.node && c.from >= spans[n-1].End {
+			spans[n-1].End = c.to
+			continue
+		}
+		spans = append(spans, TextSpan{Node: c.node, Start: c.from, End: c.to})
+	}
+	return spans
 }
 
 // innerTextContext tracks state during innerText collection
@@ -91,6 +146,20 @@ type innerTextContext struct {
 	needsLeadingNewline   bool
 	needsTrailingNewlines int    // Number of pending newlines
 	visibility            string // "visible", "hidden", or "collapse"
+
+	// For RenderedText: which elements are being rendered, and whether to
+	// map the characters written to the text nodes they came from
+	rendered func(*Element) bool
+	mapped   bool
+	chars    []renderedChar
+}
+
+// truncateChars forgets the characters mapped at or after a byte offset
+// of the rendered text, once it was trimmed to that length.
+func (ctx *innerTextContext) truncateChars(length int) {
+	for len(ctx.chars) > 0 && ctx.chars[len(ctx.chars)-1].index >= length {
+		ctx.chars = ctx.chars[:len(ctx.chars)-1]
+	}
 }
 
 // isBeingRendered checks if the element is being rendered.
@@ -150,8 +219,7 @@ func (e *Element) collectInnerText(n *Node, result *strings.Builder, ctx *innerT
 	for child := n.firstChild; child != nil; child = child.nextSibling {
 		switch child.nodeType {
 		case TextNode, CDATASectionNode:
-			text := child.NodeValue()
-			e.processText(text, result, ctx)
+			e.processText(child, result, ctx)
 
 		case ElementNode:
 			childEl := (*Element)(child)
@@ -172,8 +240,7 @@ func (e *Element) collectSVGInnerText(n *Node, result *strings.Builder, ctx *inn
 	for child := n.firstChild; child != nil; child = child.nextSibling {
 		switch child.nodeType {
 		case TextNode, CDATASectionNode:
-			text := child.NodeValue()
-			e.processText(text, result, ctx)
+			e.processText(child, result, ctx)
 
 		case ElementNode:
 			childEl := (*Element)(child)
@@ -197,7 +264,8 @@ func (e *Element) collectSVGInnerText(n *Node, result *strings.Builder, ctx *inn
 }
 
 // processText processes a text node's content according to CSS white-space rules
-func (e *Element) processText(text string, result *strings.Builder, ctx *innerTextContext) {
+func (e *Element) processText(node *Node, result *strings.Builder, ctx *innerTextContext) {
+	text := node.NodeValue()
 	if text == "" {
 		return
 	}
@@ -214,7 +282,14 @@ func (e *Element) processText(text string, result *strings.Builder, ctx *innerTe
 	var sb strings.Builder
 	prevWasSpace := ctx.lastOutputWasSpace || ctx.afterBlockStart
 
+	// When mapping, each character written is recorded with the UTF-16
+	// offsets of the character of the node it was written for
+	var chars []renderedChar
+	offset := 0
 	for _, r := range text {
+		written := sb.Len()
+		from := offset
+		offset += utf16.RuneLen(r)
 		switch r {
 		case '\n':
 			if preserveNewlines {
@@ -272,6 +347,9 @@ func (e *Element) processText(text string, result *strings.Builder, ctx *innerTe
 			ctx.lastOutputWasSpace = false
 			ctx.afterBlockStart = false
 		}
+		if ctx.mapped && sb.Len() > written {
+			chars = append(chars, renderedChar{index: written, node: node, from: from, to: offset})
+		}
 	}
 
 	processed := sb.String()
@@ -286,6 +364,10 @@ func (e *Element) processText(text string, result *strings.Builder, ctx *innerTe
 		}
 
 		// Write the processed text
+		for _, c := range chars {
+			c.index += result.Len()
+			ctx.chars = append(ctx.chars, c)
+		}
 		result.WriteString(processed)
 	}
 }
@@ -324,6 +406,9 @@ func (e *Element) processElement(el *Element, result *strings.Builder, ctx *inne
 	if strings.Contains(styleLower, "display") && strings.Contains(styleLower, "none") {
 		return
 	}
+	if ctx.rendered != nil && !ctx.rendered(el) {
+		return
+	}
 
 	// Update visibility for this element
 	oldVisibility := ctx.visibility
@@ -360,7 +445,7 @@ func (e *Element) processElement(el *Element, result *strings.Builder, ctx *inne
 		// They prevent whitespace collapse around them
 		// Check for display:block on these elements
 		if strings.Contains(styleLower, "display") && strings.Contains(styleLower, "block") {
-			e.trimTrailingSpace(result)
+			e.trimTrailingSpace(result, ctx)
 			e.flushNewlines(result, ctx, 1)
 			ctx.afterBlockStart = true
 			ctx.needsTrailingNewlines = 1
@@ -375,7 +460,7 @@ func (e *Element) processElement(el *Element, result *strings.Builder, ctx *inne
 		// Input elements act as atomic inlines - they prevent whitespace collapsing
 		// Check for display:block
 		if strings.Contains(styleLower, "display") && strings.Contains(styleLower, "block") {
-			e.trimTrailingSpace(result)
+			e.trimTrailingSpace(result, ctx)
 			e.flushNewlines(result, ctx, 1)
 			ctx.afterBlockStart = true
 			ctx.needsTrailingNewlines = 1
@@ -390,7 +475,7 @@ func (e *Element) processElement(el *Element, result *strings.Builder, ctx *inne
 		return
 	case "br":
 		// <br> produces a newline - but first trim trailing space
-		e.trimTrailingSpace(result)
+		e.trimTrailingSpace(result, ctx)
 		result.WriteRune('\n')
 		ctx.lastOutputWasNewline = true
 		ctx.lastOutputWasSpace = false
@@ -477,12 +562,13 @@ func (e *Element) processSelectElement(el *Element, result *strings.Builder, ctx
 }
 
 // trimTrailingSpace removes trailing spaces from the result (but not newlines)
-func (e *Element) trimTrailingSpace(result *strings.Builder) {
+func (e *Element) trimTrailingSpace(result *strings.Builder, ctx *innerTextContext) {
 	s := result.String()
 	trimmed := strings.TrimRight(s, " ")
 	if len(trimmed) < len(s) {
 		result.Reset()
 		result.WriteString(trimmed)
+		ctx.truncateChars(len(trimmed))
 	}
 }
 
@@ -0,0 +1,57 @@
+package dom
+
+import (
+	"testing"
+)
+
+func TestElement_RenderedText(t *testing.T) {
+	doc, err := ParseHTML(`<body><p id="a">Hello   <b>big</b>
+ world</p><div id="hidden">secret</div><div>caf&eacute; &#x1F600;x</div></body>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := doc.Body()
+	hidden := doc.GetElementById("hidden")
+	text := body.RenderedText(func(el *Element) bool { return el != hidden })
+
+	want := "Hello big world\n\ncafé 😀x"
+	if text.Text != want {
+		t.Fatalf("Text = %q, want %q", text.Text, want)
+	}
+	if got := body.InnerText(); got != "Hello big world\n\nsecret\ncafé 😀x" {
+		t.Errorf("InnerText = %q", got)
+	}
+
+	// Of collapsed whitespace only the space rendered is in a span
+	p := doc.GetElementById("a").AsNode()
+	spans := text.Spans(0, len("Hello big"))
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Node != p.FirstChild() || spans[0].Start != 0 || spans[0].End != 6 {
+		t.Errorf("first span = %+v, want Hello and a space", spans[0])
+	}
+	if spans[1].Node != p.FirstChild().NextSibling().FirstChild() || spans[1].Start != 0 || spans[1].End != 3 {
+		t.Errorf("second span = %+v, want big", spans[1])
+	}
+
+	// A span covers the whitespace collapsed between characters of a node,
+	// here the line break and indent before world
+	start := len("Hello big")
+	spans = text.Spans(start, start+len(" world"))
+	if len(spans) != 1 || spans[0].Start != 0 || spans[0].End != 7 {
+		t.Errorf("world spans = %+v, want 0-7 of the last node", spans)
+	}
+
+	// Offsets are in UTF-16 code units, so the emoji spans two
+	start = len("Hello big world\n\ncafé ")
+	spans = text.Spans(start, start+len("😀x"))
+	if len(spans) != 1 || spans[0].Start != 5 || spans[0].End != 8 {
+		t.Errorf("emoji spans = %+v, want 5-8", spans)
+	}
+
+	// Line breaks between blocks come from no node
+	if spans := text.Spans(len("Hello big world"), len("Hello big world\n\n")); len(spans) != 0 {
+		t.Errorf("line break spans = %+v, want none", spans)
+	}
+}
@@ -1,5 +1,7 @@
 package dom
 
+import "sync"
+
 // MutationCallback is an interface for receiving notifications about DOM mutations.
 // This is used to implement MutationObserver functionality.
 type MutationCallback interface {
@@ -49,14 +51,27 @@ type MutationCallback interface {
 }
 
 // mutationCallbacks stores registered mutation callbacks for a document.
+// Documents of different pages mutate on their agents' goroutines.
 var mutationCallbacks = make(map[*Document][]MutationCallback)
+var mutationCallbacksMu sync.RWMutex
+
+// callbacksFor returns the mutation callbacks registered for a document.
+func callbacksFor(doc *Document) []MutationCallback {
+	mutationCallbacksMu.RLock()
+	defer mutationCallbacksMu.RUnlock()
+	return mutationCallbacks[doc]
+}
 
 // RegisterMutationCallback registers a callback to receive mutation notifications for a document.
 func RegisterMutationCallback(doc *Document, callback MutationCallback) {
 	if doc == nil || callback == nil {
 		return
 	}
-	mutationCallbacks[doc] = append(mutationCallbacks[doc], callback)
+	mutationCallbacksMu.Lock()
+	defer mutationCallbacksMu.Unlock()
+	// Copy, as notifications may be iterating the registered callbacks
+	callbacks := append([]MutationCallback(nil), mutationCallbacks[doc]...)
+	mutationCallbacks[doc] = append(callbacks, callback)
 }
 
 // UnregisterMutationCallback removes a callback from a document.
@@ -64,10 +79,12 @@ func UnregisterMutationCallback(doc *Document, callback MutationCallback) {
 	if doc == nil {
 		return
 	}
+	mutationCallbacksMu.Lock()
+	defer mutationCallbacksMu.Unlock()
 	callbacks := mutationCallbacks[doc]
 	for i, cb := range callbacks {
 		if cb == callback {
-			mutationCallbacks[doc] = append(callbacks[:i], callbacks[i+1:]...)
+			mutationCallbacks[doc] = append(append([]MutationCallback(nil), callbacks[:i]...), callbacks[i+1:]...)
 			return
 		}
 	}
@@ -75,6 +92,8 @@ func UnregisterMutationCallback(doc *Document, callback MutationCallback) {
 
 // ClearMutationCallbacks removes all callbacks for a document.
 func ClearMutationCallbacks(doc *Document) {
+	mutationCallbacksMu.Lock()
+	defer mutationCallbacksMu.Unlock()
 	delete(mutationCallbacks, doc)
 }
 
@@ -89,7 +108,7 @@ func notifyChildListMutation(
 	if target == nil || target.ownerDoc == nil {
 		return
 	}
-	callbacks := mutationCallbacks[target.ownerDoc]
+	callbacks := callbacksFor(target.ownerDoc)
 	for _, cb := range callbacks {
 		cb.OnChildListMutation(target, addedNodes, removedNodes, previousSibling, nextSibling)
 	}
@@ -105,7 +124,7 @@ func notifyAttributeMutation(
 	if target == nil || target.ownerDoc == nil {
 		return
 	}
-	callbacks := mutationCallbacks[target.ownerDoc]
+	callbacks := callbacksFor(target.ownerDoc)
 	for _, cb := range callbacks {
 		cb.OnAttributeMutation(target, attributeName, attributeNamespace, oldValue)
 	}
@@ -128,7 +147,7 @@ func NotifyCharacterDataMutation(
 	if target == nil || target.ownerDoc == nil {
 		return
 	}
-	callbacks := mutationCallbacks[target.ownerDoc]
+	callbacks := callbacksFor(target.ownerDoc)
 	for _, cb := range callbacks {
 		cb.OnCharacterDataMutation(target, oldValue)
 	}
@@ -156,7 +175,7 @@ func NotifyReplaceData(
 	if target == nil || target.ownerDoc == nil {
 		return
 	}
-	callbacks := mutationCallbacks[target.ownerDoc]
+	callbacks := callbacksFor(target.ownerDoc)
 	for _, cb := range callbacks {
 		cb.OnReplaceData(target, offset, count, data)
 	}
@@ -172,7 +191,7 @@ func NotifySplitText(
 	if oldNode == nil || oldNode.ownerDoc == nil {
 		return
 	}
-	callbacks := mutationCallbacks[oldNode.ownerDoc]
+	callbacks := callbacksFor(oldNode.ownerDoc)
 	for _, cb := range callbacks {
 		cb.OnSplitText(oldNode, splitOffset, newNode)
 	}
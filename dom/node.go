@@ -36,6 +36,9 @@ type Node struct {
 
 	// Shadow DOM support: back-reference when this node is a ShadowRoot's underlying node
 	shadowRoot *ShadowRoot
+
+	// Layout fragments of a Text node, set during layout computation
+	textFragments []TextFragment
 }
 
 // ElementGeometry holds computed layout geometry for an element.
@@ -107,6 +110,10 @@ type InputData struct {
 	valueDirty bool
 	// The current value (for text, etc.)
 	value string
+	// The selection in the value of text controls, in UTF-16 code units,
+	// once set
+	selectionSet                 bool
+	selectionStart, selectionEnd int
 }
 
 // DocumentMode represents the document rendering mode (quirks, limited-quirks, or no-quirks).
@@ -160,7 +167,15 @@ type documentData struct {
 	anchorsCollection *HTMLCollection
 
 	// Focus tracking
-	focusedElement *Node // The currently focused element (or nil if body/document is focused)
+	focusedElement   *Node // The currently focused element (or nil if body/document is focused)
+	focusedByPointer bool  // Whether the last focus move came from a pointer
+
+	// Pointer tracking for the :hover and :active pseudo-classes
+	hoveredElement *Node // The element the pointer is over (or nil)
+	pressedElement *Node // The element a pointer button was pressed on (or nil)
+
+	// Target element of the URL's fragment for the :target pseudo-class
+	targetElement *Node
 }
 
 // docTypeData holds data specific to DocumentType nodes.
@@ -944,6 +944,69 @@ func (r *Range) ToString() string {
 	return result
 }
 
+// GetClientRects returns the border boxes of the elements the range selects,
+// except those inside another selected element, and the rectangles of the
+// selected parts of the text nodes it touches.
+// Reference: https://drafts.csswg.org/cssom-view/#dom-range-getclientrects
+func (r *Range) GetClientRects() *DOMRectList {
+	var rects []*DOMRect
+	var visit func(node *Node, parentSelected bool)
+	visit = func(node *Node, parentSelected bool) {
+		selected := r.containsNode(node)
+		switch node.nodeType {
+		case ElementNode:
+			if selected && !parentSelected {
+				rects = append(rects, (*Element)(node).GetClientRects().items...)
+			}
+		case TextNode:
+			start, end := 0, UTF16Length(node.NodeValue())
+			if node == r.startContainer {
+				start = r.startOffset
+			}
+			if node == r.endContainer {
+				end = r.endOffset
+			}
+			rects = append(rects, (*Text)(node).rects(start, end)...)
+			return
+		}
+		for child := node.firstChild; child != nil; child = child.nextSibling {
+			if r.nodeIntersectsRange(child) {
+				visit(child, selected)
+			}
+		}
+	}
+	visit(r.CommonAncestorContainer(), false)
+	return NewDOMRectList(rects)
+}
+
+// GetBoundingClientRect returns the union of the rectangles of
+// GetClientRects that have a size, or the first of them if none does.
+// Reference: https://drafts.csswg.org/cssom-view/#dom-range-getboundingclientrect
+func (r *Range) GetBoundingClientRect() *DOMRect {
+	list := r.GetClientRects()
+	if list.Length() == 0 {
+		return NewDOMRect(0, 0, 0, 0)
+	}
+	var bounds *DOMRect
+	for _, rect := range list.items {
+		if rect.Width == 0 && rect.Height == 0 {
+			continue
+		}
+		if bounds == nil {
+			bounds = NewDOMRect(rect.Left(), rect.Top(), rect.Right()-rect.Left(), rect.Bottom()-rect.Top())
+			continue
+		}
+		left, top := min(bounds.Left(), rect.Left()), min(bounds.Top(), rect.Top())
+		right, bottom := max(bounds.Right(), rect.Right()), max(bounds.Bottom(), rect.Bottom())
+		bounds = NewDOMRect(left, top, right-left, bottom-top)
+	}
+	if bounds == nil {
+		first := list.items[0]
+		return NewDOMRect(first.X, first.Y, first.Width, first.Height)
+	}
+	return bounds
+}
+
 // traverseTextNodes traverses all text nodes in document order within the range.
 // The callback is called for each text node. Return false from callback to stop traversal.
 func (r *Range) traverseTextNodes(root *Node, callback func(*Node) bool) {
@@ -1,5 +1,7 @@
 package dom
 
+import "strings"
+
 // Selection represents a user's selection of text in the document.
 // Per the Selection API specification, each Document has an associated Selection object.
 type Selection struct {
@@ -9,6 +11,12 @@ type Selection struct {
 	// The ranges that make up this selection.
 	// Per spec, most browsers only support a single range.
 	ranges []*Range
+
+	// Whether the focus of the selection is before its anchor
+	backward bool
+
+	// Called whenever the selection is changed
+	onChange func()
 }
 
 // NewSelection creates a new Selection for the given document.
@@ -19,12 +27,28 @@ func NewSelection(doc *Document) *Selection {
 	}
 }
 
+// SetChangeHandler sets a function called whenever the selection is changed,
+// such as to queue a selectionchange event or repaint the selection.
+func (s *Selection) SetChangeHandler(fn func()) {
+	s.onChange = fn
+}
+
+// changed notifies the change handler of a change to the selection.
+func (s *Selection) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
 // AnchorNode returns the node in which the selection begins.
 // Returns nil if the selection is empty.
 func (s *Selection) AnchorNode() *Node {
 	if len(s.ranges) == 0 {
 		return nil
 	}
+	if s.backward {
+		return s.ranges[0].EndContainer()
+	}
 	return s.ranges[0].StartContainer()
 }
 
@@ -33,6 +57,9 @@ func (s *Selection) AnchorOffset() int {
 	if len(s.ranges) == 0 {
 		return 0
 	}
+	if s.backward {
+		return s.ranges[0].EndOffset()
+	}
 	return s.ranges[0].StartOffset()
 }
 
@@ -42,6 +69,9 @@ func (s *Selection) FocusNode() *Node {
 	if len(s.ranges) == 0 {
 		return nil
 	}
+	if s.backward {
+		return s.ranges[0].StartContainer()
+	}
 	return s.ranges[0].EndContainer()
 }
 
@@ -50,6 +80,9 @@ func (s *Selection) FocusOffset() int {
 	if len(s.ranges) == 0 {
 		return 0
 	}
+	if s.backward {
+		return s.ranges[0].StartOffset()
+	}
 	return s.ranges[0].EndOffset()
 }
 
@@ -80,11 +113,13 @@ func (s *Selection) Type() string {
 
 // Direction returns the direction of the current selection.
 // Returns "none", "forward", or "backward".
-// For now, we always return "forward" since we don't track selection direction.
 func (s *Selection) Direction() string {
 	if len(s.ranges) == 0 {
 		return "none"
 	}
+	if s.backward {
+		return "backward"
+	}
 	return "forward"
 }
 
@@ -106,6 +141,8 @@ func (s *Selection) AddRange(r *Range) {
 	// Most browsers only support one range - we follow that behavior
 	if len(s.ranges) == 0 {
 		s.ranges = append(s.ranges, r)
+		s.backward = false
+		s.changed()
 	}
 	// If a range already exists, some browsers ignore the addition
 }
@@ -118,6 +155,8 @@ func (s *Selection) RemoveRange(r *Range) error {
 	for i, existing := range s.ranges {
 		if existing == r {
 			s.ranges = append(s.ranges[:i], s.ranges[i+1:]...)
+			s.backward = false
+			s.changed()
 			return nil
 		}
 	}
@@ -126,7 +165,12 @@ func (s *Selection) RemoveRange(r *Range) error {
 
 // RemoveAllRanges removes all ranges from the selection.
 func (s *Selection) RemoveAllRanges() {
+	if len(s.ranges) == 0 {
+		return
+	}
 	s.ranges = s.ranges[:0]
+	s.backward = false
+	s.changed()
 }
 
 // Empty is an alias for RemoveAllRanges.
@@ -149,6 +193,8 @@ func (s *Selection) Collapse(node *Node, offset int) error {
 	r.Collapse(true)
 
 	s.ranges = []*Range{r}
+	s.backward = false
+	s.changed()
 	return nil
 }
 
@@ -184,13 +230,8 @@ func (s *Selection) Extend(node *Node, offset int) error {
 		return ErrInvalidState("No ranges in selection")
 	}
 
-	r := s.ranges[0]
-	// Keep the anchor, move the focus (end)
-	if err := r.SetEnd(node, offset); err != nil {
-		return err
-	}
-
-	return nil
+	// Keep the anchor, move the focus
+	return s.SetBaseAndExtent(s.AnchorNode(), s.AnchorOffset(), node, offset)
 }
 
 // SelectAllChildren adds all the children of the specified node to the selection.
@@ -206,10 +247,13 @@ func (s *Selection) SelectAllChildren(node *Node) error {
 	}
 
 	s.ranges = []*Range{r}
+	s.backward = false
+	s.changed()
 	return nil
 }
 
 // SetBaseAndExtent sets the selection to be a range including parts of two DOM nodes.
+// The focus may come before the anchor, making the selection backward.
 func (s *Selection) SetBaseAndExtent(anchorNode *Node, anchorOffset int, focusNode *Node, focusOffset int) error {
 	if anchorNode == nil || focusNode == nil {
 		return ErrNotFound("Node is null")
@@ -219,11 +263,20 @@ func (s *Selection) SetBaseAndExtent(anchorNode *Node, anchorOffset int, focusNo
 	if err := r.SetStart(anchorNode, anchorOffset); err != nil {
 		return err
 	}
-	if err := r.SetEnd(focusNode, focusOffset); err != nil {
+	// A focus before the anchor starts the range instead of ending it
+	backward := anchorNode.GetRootNode() == focusNode.GetRootNode() &&
+		r.comparePoints(focusNode, focusOffset, anchorNode, anchorOffset) < 0
+	if backward {
+		if err := r.SetStart(focusNode, focusOffset); err != nil {
+			return err
+		}
+	} else if err := r.SetEnd(focusNode, focusOffset); err != nil {
 		return err
 	}
 
 	s.ranges = []*Range{r}
+	s.backward = backward
+	s.changed()
 	return nil
 }
 
@@ -258,6 +311,7 @@ func (s *Selection) DeleteFromDocument() error {
 			return err
 		}
 	}
+	s.changed()
 	return nil
 }
 
@@ -274,6 +328,23 @@ func (s *Selection) ToString() string {
 	return result
 }
 
+// ToHTML returns the content of the selection serialized as HTML, such as
+// for copying it to the clipboard. Elements the selection starts or ends
+// inside keep only their selected part.
+func (s *Selection) ToHTML() string {
+	var sb strings.Builder
+	for _, r := range s.ranges {
+		fragment, err := r.CloneContents()
+		if err != nil {
+			continue
+		}
+		for child := fragment.AsNode().firstChild; child != nil; child = child.nextSibling {
+			serializeNode(child, &sb)
+		}
+	}
+	return sb.String()
+}
+
 // Modify changes the current selection.
 // alter is one of "move" or "extend"
 // direction is one of "forward", "backward", "left", or "right"
@@ -290,3 +290,74 @@ func TestSelection_Identity(t *testing.T) {
 		t.Error("GetSelection should return the same Selection object for the same document")
 	}
 }
+
+func TestSelection_Direction(t *testing.T) {
+	doc := NewDocument()
+	div := doc.CreateElement("div")
+	doc.AsNode().AppendChild(div.AsNode())
+
+	text := doc.CreateTextNode("Hello World")
+	div.AsNode().AppendChild(text)
+
+	sel := doc.GetSelection()
+	changes := 0
+	sel.SetChangeHandler(func() { changes++ })
+
+	// A focus before the anchor makes the selection backward
+	if err := sel.SetBaseAndExtent(text, 8, text, 2); err != nil {
+		t.Fatalf("SetBaseAndExtent failed: %v", err)
+	}
+	if sel.Direction() != "backward" {
+		t.Errorf("Expected direction 'backward', got %s", sel.Direction())
+	}
+	if sel.AnchorOffset() != 8 || sel.FocusOffset() != 2 {
+		t.Errorf("Expected anchor 8 and focus 2, got %d and %d", sel.AnchorOffset(), sel.FocusOffset())
+	}
+	r, _ := sel.GetRangeAt(0)
+	if r.StartOffset() != 2 || r.EndOffset() != 8 {
+		t.Errorf("Expected range 2-8, got %d-%d", r.StartOffset(), r.EndOffset())
+	}
+	if sel.ToString() != "llo Wo" {
+		t.Errorf("Expected 'llo Wo', got %q", sel.ToString())
+	}
+
+	// Extending past the anchor makes it forward again
+	if err := sel.Extend(text, 10); err != nil {
+		t.Fatalf("Extend failed: %v", err)
+	}
+	if sel.Direction() != "forward" || sel.AnchorOffset() != 8 || sel.FocusOffset() != 10 {
+		t.Errorf("Expected forward 8-10, got %s %d-%d", sel.Direction(), sel.AnchorOffset(), sel.FocusOffset())
+	}
+
+	if err := sel.Collapse(text, 1); err != nil {
+		t.Fatalf("Collapse failed: %v", err)
+	}
+	sel.RemoveAllRanges()
+	sel.RemoveAllRanges()
+	if changes != 4 {
+		t.Errorf("Expected 4 changes, got %d", changes)
+	}
+}
+
+func TestSelection_ToHTML(t *testing.T) {
+	doc, err := ParseHTML(`<p id="p">Hello <b>bold</b> world</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := doc.GetElementById("p").AsNode()
+	hello, world := p.FirstChild(), p.LastChild()
+
+	sel := doc.GetSelection()
+	if sel.ToHTML() != "" {
+		t.Errorf("Expected no HTML for an empty selection, got %q", sel.ToHTML())
+	}
+	if err := sel.SetBaseAndExtent(world, 3, hello, 2); err != nil {
+		t.Fatalf("SetBaseAndExtent failed: %v", err)
+	}
+	if got := sel.ToHTML(); got != "llo <b>bold</b> wo" {
+		t.Errorf("Expected 'llo <b>bold</b> wo', got %q", got)
+	}
+	if got := sel.ToString(); got != "llo bold wo" {
+		t.Errorf("Expected 'llo bold wo', got %q", got)
+	}
+}
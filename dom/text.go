@@ -280,3 +280,49 @@ func NewTextNode(data string) *Node {
 	node.nodeValue = &data
 	return node
 }
+
+// TextFragment is the layout geometry of the part of a text node that is
+// placed on one line, in viewport coordinates.
+type TextFragment struct {
+	X, Y, Width, Height float64
+
+	// Start and End are the offsets of the text it holds in UTF-16 code
+	// units. Carets holds the x coordinate of the caret at each offset
+	// from Start to End.
+	Start, End int
+	Carets     []float64
+}
+
+// TextFragments returns the layout fragments of a text node, or nil if
+// layout has not placed it.
+func (t *Text) TextFragments() []TextFragment {
+	return t.AsNode().textFragments
+}
+
+// SetTextFragments sets the layout fragments of a text node.
+// This is called by the layout engine after layout computation.
+func (t *Text) SetTextFragments(fragments []TextFragment) {
+	t.AsNode().textFragments = fragments
+}
+
+// rects returns the rectangles of the text between offsets start and end
+// in UTF-16 code units, one for each fragment it touches.
+func (t *Text) rects(start, end int) []*DOMRect {
+	var rects []*DOMRect
+	for _, f := range t.TextFragments() {
+		s, e := max(start, f.Start), min(end, f.End)
+		if s > e || len(f.Carets) != f.End-f.Start+1 {
+			continue
+		}
+		// An empty range only touches the fragment it is inside
+		if s == e && start != end {
+			continue
+		}
+		x0, x1 := f.Carets[s-f.Start], f.Carets[e-f.Start]
+		if x0 > x1 {
+			x0, x1 = x1, x0
+		}
+		rects = append(rects, NewDOMRect(x0, f.Y, x1-x0, f.Height))
+	}
+	return rects
+}
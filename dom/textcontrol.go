@@ -0,0 +1,88 @@
+package dom
+
+import "strings"
+
+// textInputTypes are the types of input elements whose value is edited as
+// text.
+var textInputTypes = map[string]bool{
+	"text": true, "search": true, "url": true, "tel": true, "email": true,
+	"password": true, "number": true,
+}
+
+// IsTextControl returns true for textarea elements and input elements that
+// take typed text.
+func (e *Element) IsTextControl() bool {
+	if e.NamespaceURI() != HTMLNamespace {
+		return false
+	}
+	switch e.LocalName() {
+	case "textarea":
+		return true
+	case "input":
+		return textInputTypes[e.InputType()]
+	}
+	return false
+}
+
+// IsMutableTextControl returns true for text controls whose value the user
+// can edit: those that are neither disabled nor read-only.
+func (e *Element) IsMutableTextControl() bool {
+	return e.IsTextControl() && !e.Disabled() && !e.HasAttribute("readonly")
+}
+
+// TextControlValue returns the value of a text control.
+func (e *Element) TextControlValue() string {
+	if e.LocalName() == "textarea" {
+		return e.TextAreaValue()
+	}
+	return e.InputValue()
+}
+
+// SetTextControlValue sets the value of a text control. The selection
+// collapses to the end of the new value if it changed.
+func (e *Element) SetTextControlValue(value string) {
+	if e.LocalName() == "textarea" {
+		e.SetTextAreaValue(value)
+		return
+	}
+	e.SetInputValue(value)
+}
+
+// SelectionRange returns the start and end of the selection in a text
+// control, in UTF-16 code units. Until it is set, the selection is collapsed
+// at the end of the value.
+func (e *Element) SelectionRange() (start, end int) {
+	length := UTF16Length(e.TextControlValue())
+	data := e.InputData()
+	if !data.selectionSet {
+		return length, length
+	}
+	return min(data.selectionStart, length), min(data.selectionEnd, length)
+}
+
+// SetSelectionRange selects the text between start and end, in UTF-16 code
+// units, clamped to the value. An end before the start collapses the
+// selection at the end.
+// Reference: https://html.spec.whatwg.org/multipage/form-control-infrastructure.html#dom-textarea/input-setselectionrange
+func (e *Element) SetSelectionRange(start, end int) {
+	length := UTF16Length(e.TextControlValue())
+	end = max(0, min(end, length))
+	start = max(0, min(start, end))
+	data := e.InputData()
+	data.selectionSet = true
+	data.selectionStart, data.selectionEnd = start, end
+}
+
+// ReplaceSelection replaces the selected text of a text control, and
+// collapses the selection after the inserted text. Line breaks cannot be
+// inserted into input elements.
+func (e *Element) ReplaceSelection(text string) {
+	if e.LocalName() != "textarea" {
+		text = strings.NewReplacer("\r\n", "", "\n", "", "\r", "").Replace(text)
+	}
+	value := e.TextControlValue()
+	start, end := e.SelectionRange()
+	e.SetTextControlValue(UTF16SliceTo(value, start) + text + UTF16SliceFrom(value, end))
+	caret := start + UTF16Length(text)
+	e.SetSelectionRange(caret, caret)
+}
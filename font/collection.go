@@ -0,0 +1,625 @@
+// Package font provides font faces, the CSS font matching algorithm and
+// text shaping.
+// This file implements face collections and the CSS font matching algorithm.
+// Reference: https://www.w3.org/TR/css-fonts-4/#font-matching-algorithm
+package font
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/segmenter"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomediumitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Style is a font-family list with the weight and style that faces are
+// matched against.
+type Style struct {
+	Families []string
+	Weight   int // 1 to 1000
+	Italic   bool
+}
+
+func (s Style) key() string {
+	return fmt.Sprintf("%q %d %t", s.Families, s.Weight, s.Italic)
+}
+
+// Collection is a set of faces that font-family names are matched against.
+// Besides installed faces it holds the web fonts of a document, which take
+// precedence, and falls back to another collection for names and
+// characters it has no face for.
+type Collection struct {
+	faces []*Face
+	// generic maps the generic families to installed family names
+	generic  map[string]string
+	fallback func() *Collection
+
+	mu        sync.Mutex
+	fontFaces []*FontFace
+	fetch     Fetcher
+	observers []func(*FontFace)
+	// cache holds the face found for a cluster of characters in a style
+	cache map[string]*Face
+}
+
+// faceCacheSize bounds the number of matches kept in a collection.
+const faceCacheSize = 4096
+
+// NewCollection creates an empty collection.
+func NewCollection() *Collection {
+	return &Collection{generic: map[string]string{}, cache: map[string]*Face{}}
+}
+
+// Add adds a face to the collection.
+func (c *Collection) Add(face *Face) {
+	c.faces = append(c.faces, face)
+}
+
+// SetGeneric makes a generic family name, such as sans-serif, refer to an
+// installed family.
+func (c *Collection) SetGeneric(generic, family string) {
+	c.generic[generic] = family
+}
+
+// SetFallback sets the collection searched for families and characters
+// that this one has no face for.
+func (c *Collection) SetFallback(fallback func() *Collection) {
+	c.fallback = fallback
+}
+
+// SetFetcher sets how the files of web fonts are downloaded.
+func (c *Collection) SetFetcher(fetch Fetcher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetch = fetch
+}
+
+// Faces returns the installed faces of the collection.
+func (c *Collection) Faces() []*Face {
+	return c.faces
+}
+
+// AddFontFace adds a web font to the collection. It loads once text
+// needs it.
+func (c *Collection) AddFontFace(f *FontFace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.fontFaces {
+		if existing == f {
+			return
+		}
+	}
+	c.fontFaces = append(c.fontFaces, f)
+	clear(c.cache)
+}
+
+// DeleteFontFace removes a web font, reporting whether it was present.
+func (c *Collection) DeleteFontFace(f *FontFace) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, existing := range c.fontFaces {
+		if existing == f {
+			c.fontFaces = append(c.fontFaces[:i:i], c.fontFaces[i+1:]...)
+			clear(c.cache)
+			return true
+		}
+	}
+	return false
+}
+
+// FontFaces returns the web fonts of the collection in the order they
+// were added.
+func (c *Collection) FontFaces() []*FontFace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.fontFaces)
+}
+
+// Observe registers a function that is called whenever a web font loaded
+// through the collection starts or finishes loading. It may be called on
+// any goroutine.
+func (c *Collection) Observe(fn func(*FontFace)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observers = append(c.observers, fn)
+}
+
+func (c *Collection) notify(f *FontFace) {
+	c.mu.Lock()
+	observers := slices.Clone(c.observers)
+	c.mu.Unlock()
+	for _, fn := range observers {
+		fn(f)
+	}
+}
+
+// Load starts loading a web font with the collection's fetcher unless it
+// has already started, and returns a channel that is closed when it ends.
+func (c *Collection) Load(f *FontFace) <-chan struct{} {
+	c.mu.Lock()
+	fetch := c.fetch
+	c.mu.Unlock()
+	done, started := f.Load(fetch)
+	if started {
+		c.notify(f)
+		go func() {
+			<-done
+			c.notify(f)
+		}()
+	}
+	return done
+}
+
+// Loading reports whether any web font of the collection is loading.
+func (c *Collection) Loading() bool {
+	for _, f := range c.FontFaces() {
+		if f.Status() == Loading {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitBlocking waits for the web fonts that are loading until they finish
+// or their block period ends, reporting whether any finished. Text is laid
+// out again after a wait rather than being hidden while it lasts.
+func (c *Collection) WaitBlocking() bool {
+	finished := false
+	for _, f := range c.FontFaces() {
+		if f.Status() != Loading {
+			continue
+		}
+		timer := time.NewTimer(time.Until(f.blockDeadline()))
+		select {
+		case <-f.Done():
+			finished = true
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	return finished
+}
+
+// FontFacesFor returns the web fonts that text in a style would use: for
+// each family, the faces with the closest descriptors whose unicode-range
+// includes a character of the text. Empty text stands for a space.
+func (c *Collection) FontFacesFor(style Style, text string) []*FontFace {
+	if text == "" {
+		text = " "
+	}
+	var matched []*FontFace
+	for _, family := range style.Families {
+		for _, f := range bestStyle(c.webFaces(family), fontFaceAspect, style) {
+			for _, r := range text {
+				if f.covers(r) {
+					matched = append(matched, f)
+					break
+				}
+			}
+		}
+	}
+	return matched
+}
+
+// Match returns the first available face of a style, which sets the
+// metrics of text: the first family with a face, or the default family,
+// and within it the closest style and weight. nil is only returned for an
+// empty collection.
+func (c *Collection) Match(style Style) *Face {
+	for _, family := range style.Families {
+		if face, _ := c.familyFace(family, style, nil); face != nil {
+			return face
+		}
+	}
+	if face, _ := c.familyFace("serif", style, nil); face != nil {
+		return face
+	}
+	return c.anyFace(style)
+}
+
+// FaceFor returns the face a character is rendered with: the first face of
+// the family list that has a glyph for it, then any installed face that
+// has one, and otherwise the first available face.
+func (c *Collection) FaceFor(r rune, style Style) *Face {
+	return c.clusterFace([]rune{r}, style)
+}
+
+// clusterFace returns the face a grapheme cluster is rendered with,
+// preferring a face that has all of its characters to one that only has
+// the first.
+func (c *Collection) clusterFace(cluster []rune, style Style) *Face {
+	key := style.key() + "\x00" + string(cluster)
+	c.mu.Lock()
+	face, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return face
+	}
+	face, final := c.find(cluster, style)
+	if face == nil && len(cluster) > 1 {
+		var baseFinal bool
+		face, baseFinal = c.find(cluster[:1], style)
+		final = final && baseFinal
+	}
+	if face == nil {
+		face = c.Match(style)
+	}
+	if final {
+		c.mu.Lock()
+		if len(c.cache) >= faceCacheSize {
+			clear(c.cache)
+		}
+		c.cache[key] = face
+		c.mu.Unlock()
+	}
+	return face
+}
+
+// find returns the face of the family list or the installed fallback
+// faces that renders text, or nil. The match is final unless a web font
+// that might render the text hasn't loaded yet.
+func (c *Collection) find(text []rune, style Style) (face *Face, final bool) {
+	final = true
+	for _, family := range style.Families {
+		face, familyFinal := c.familyFace(family, style, text)
+		final = final && familyFinal
+		if face != nil {
+			return face, final
+		}
+	}
+	return c.fallbackFace(text, style), final
+}
+
+// familyFace returns the face of a family that renders text, or any face
+// of the family for nil text. Web fonts shadow installed faces of the same
+// name; those that could render the text but haven't loaded start loading
+// and are skipped, which makes the match not final.
+func (c *Collection) familyFace(family string, style Style, text []rune) (face *Face, final bool) {
+	web := c.webFaces(family)
+	if len(web) == 0 {
+		return c.installedFace(family, style, text), true
+	}
+	first := ' '
+	if len(text) > 0 {
+		first = text[0]
+	}
+	final = true
+	best := bestStyle(web, fontFaceAspect, style)
+	// Among faces with the same descriptors the last defined wins
+	for i := len(best) - 1; i >= 0; i-- {
+		f := best[i]
+		if !f.covers(first) {
+			continue
+		}
+		switch f.Status() {
+		case Unloaded, Loading:
+			c.Load(f)
+			final = false
+		case Loaded:
+			if face := f.Face(); f.Available() && face.renders(text) {
+				return face, final
+			}
+		}
+	}
+	return nil, final
+}
+
+// webFaces returns the web fonts of a family.
+func (c *Collection) webFaces(family string) []*FontFace {
+	var faces []*FontFace
+	for _, f := range c.FontFaces() {
+		if f.Status() != Error && strings.EqualFold(f.Family(), family) {
+			faces = append(faces, f)
+		}
+	}
+	return faces
+}
+
+// installedFace returns the closest installed face of a family if it
+// renders text, resolving generic family names.
+func (c *Collection) installedFace(family string, style Style, text []rune) *Face {
+	if installed, ok := c.generic[strings.ToLower(family)]; ok {
+		family = installed
+	}
+	var candidates []*Face
+	for _, face := range c.faces {
+		if strings.EqualFold(face.Family, family) {
+			candidates = append(candidates, face)
+		}
+	}
+	if len(candidates) == 0 {
+		if fallback := c.fallbackCollection(); fallback != nil {
+			return fallback.installedFace(family, style, text)
+		}
+		return nil
+	}
+	if face := matchStyle(candidates, style); face.renders(text) {
+		return face
+	}
+	return nil
+}
+
+// fallbackFace returns the closest face of the first installed family
+// that renders text, searching the fallback collections in turn.
+func (c *Collection) fallbackFace(text []rune, style Style) *Face {
+	key := "fallback " + style.key() + "\x00" + string(text)
+	c.mu.Lock()
+	face, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok {
+		return face
+	}
+	for _, family := range c.families() {
+		if f := matchStyle(family, style); f.renders(text) {
+			face = f
+			break
+		}
+	}
+	if face == nil {
+		if fallback := c.fallbackCollection(); fallback != nil {
+			face = fallback.fallbackFace(text, style)
+		}
+	}
+	c.mu.Lock()
+	if len(c.cache) >= faceCacheSize {
+		clear(c.cache)
+	}
+	c.cache[key] = face
+	c.mu.Unlock()
+	return face
+}
+
+// families groups the installed faces by family, in the order the
+// families were first added.
+func (c *Collection) families() [][]*Face {
+	var groups [][]*Face
+	index := map[string]int{}
+	for _, face := range c.faces {
+		name := strings.ToLower(face.Family)
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], face)
+	}
+	return groups
+}
+
+// anyFace returns the closest face of the collection or its fallbacks.
+func (c *Collection) anyFace(style Style) *Face {
+	if len(c.faces) > 0 {
+		return matchStyle(c.faces, style)
+	}
+	if fallback := c.fallbackCollection(); fallback != nil {
+		return fallback.anyFace(style)
+	}
+	return nil
+}
+
+func (c *Collection) fallbackCollection() *Collection {
+	if c.fallback == nil {
+		return nil
+	}
+	return c.fallback()
+}
+
+// local returns the installed face a local() source names: a family name
+// for its regular face, or the family followed by Bold, Italic or both.
+func (c *Collection) local(name string) *Face {
+	for _, face := range c.faces {
+		full := face.Family
+		if face.Weight >= 600 {
+			full += " Bold"
+		}
+		if face.Italic {
+			full += " Italic"
+		}
+		if strings.EqualFold(full, name) {
+			return face
+		}
+	}
+	if fallback := c.fallbackCollection(); fallback != nil {
+		return fallback.local(name)
+	}
+	return nil
+}
+
+// Shape shapes text in a style, splitting it into runs of the faces its
+// grapheme clusters are rendered with. Characters common to several
+// scripts, such as spaces and punctuation, stay in the run before them
+// when its face has them. Glyphs are in visual order with clusters
+// indexing text.
+func (c *Collection) Shape(text []rune, style Style, size float64, rtl bool, lang string) []Glyph {
+	type run struct {
+		start, end int
+		face       *Face
+	}
+	var runs []run
+	var seg segmenter.Segmenter
+	seg.Init(text)
+	for iter := seg.GraphemeIterator(); iter.Next(); {
+		g := iter.Grapheme()
+		start, end := g.Offset, g.Offset+len(g.Text)
+		cluster := text[start:end]
+		n := len(runs)
+		var face *Face
+		if n > 0 && runs[n-1].face != nil && isCommon(cluster[0]) && runs[n-1].face.renders(cluster) {
+			face = runs[n-1].face
+		} else {
+			face = c.clusterFace(cluster, style)
+		}
+		if n > 0 && runs[n-1].face == face {
+			runs[n-1].end = end
+		} else {
+			runs = append(runs, run{start, end, face})
+		}
+	}
+	if len(runs) == 1 {
+		return Shape(text, runs[0].face, size, rtl, lang)
+	}
+	var glyphs []Glyph
+	for i := range runs {
+		r := runs[i]
+		if rtl {
+			r = runs[len(runs)-1-i]
+		}
+		shaped := Shape(text[r.start:r.end], r.face, size, rtl, lang)
+		for k := range shaped {
+			shaped[k].Cluster += r.start
+		}
+		glyphs = append(glyphs, shaped...)
+	}
+	return glyphs
+}
+
+// isCommon reports whether a character is shared by several scripts.
+func isCommon(r rune) bool {
+	switch language.LookupScript(r) {
+	case language.Common, language.Inherited:
+		return true
+	}
+	return false
+}
+
+// renders reports whether the face has a glyph for every character of
+// text.
+func (f *Face) renders(text []rune) bool {
+	for _, r := range text {
+		if !f.HasGlyph(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// covers reports whether a character is in the unicode-range of a web
+// font.
+func (f *FontFace) covers(r rune) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return inRanges(f.ranges, r)
+}
+
+// aspect is the weight range and style a face is matched by.
+type aspect struct {
+	weightMin, weightMax int
+	italic               bool
+}
+
+func faceAspect(f *Face) aspect {
+	return aspect{f.Weight, f.Weight, f.Italic}
+}
+
+func fontFaceAspect(f *FontFace) aspect {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return aspect{f.weightMin, f.weightMax, f.italic}
+}
+
+// matchStyle returns the installed face closest to a style.
+func matchStyle(faces []*Face, style Style) *Face {
+	return bestStyle(faces, faceAspect, style)[0]
+}
+
+// bestStyle narrows faces down by style and then by weight, returning all
+// the faces that match equally well. A face with a weight range matches
+// the weights within it exactly.
+func bestStyle[T any](faces []T, aspectOf func(T) aspect, style Style) []T {
+	var styled []T
+	for _, face := range faces {
+		if aspectOf(face).italic == style.Italic {
+			styled = append(styled, face)
+		}
+	}
+	if len(styled) == 0 {
+		styled = faces
+	}
+	weight := func(face T) int {
+		a := aspectOf(face)
+		return min(max(style.Weight, a.weightMin), a.weightMax)
+	}
+	var best []T
+	for _, face := range styled {
+		switch {
+		case len(best) == 0:
+			best = []T{face}
+		case weight(face) == weight(best[0]):
+			best = append(best, face)
+		case weightPreferred(weight(face), weight(best[0]), style.Weight):
+			best = []T{face}
+		}
+	}
+	return best
+}
+
+// weightPreferred reports whether weight a is a better match than b for
+// the desired weight. Between 400 and 500 the other of the two is tried
+// first, then lighter weights; below 400 lighter weights come first, and
+// above 500 heavier ones.
+func weightPreferred(a, b, desired int) bool {
+	rank := func(w int) (int, int) {
+		switch {
+		case w == desired:
+			return 0, 0
+		case desired >= 400 && desired <= 500:
+			if w > desired && w <= 500 {
+				return 1, w - desired
+			}
+			if w < desired {
+				return 2, desired - w
+			}
+			return 3, w - desired
+		case desired < 400:
+			if w < desired {
+				return 1, desired - w
+			}
+			return 2, w - desired
+		default:
+			if w > desired {
+				return 1, w - desired
+			}
+			return 2, desired - w
+		}
+	}
+	ra, da := rank(a)
+	rb, db := rank(b)
+	return ra < rb || (ra == rb && da < db)
+}
+
+// Default returns the built-in collection of the Go fonts. Go is used for
+// the proportional generic families and Go Mono for monospace; other
+// names and characters fall back to the system fonts.
+var Default = sync.OnceValue(func() *Collection {
+	c := NewCollection()
+	for _, data := range [][]byte{
+		goregular.TTF, gobold.TTF, goitalic.TTF, gobolditalic.TTF,
+		gomedium.TTF, gomediumitalic.TTF,
+		gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF,
+	} {
+		if face, err := Parse(data); err == nil {
+			c.Add(face)
+		}
+	}
+	for _, generic := range []string{"serif", "sans-serif", "cursive", "fantasy", "system-ui", "ui-serif", "ui-sans-serif", "ui-rounded", "math", "emoji", "fangsong"} {
+		c.SetGeneric(generic, "Go")
+	}
+	c.SetGeneric("monospace", "Go Mono")
+	c.SetGeneric("ui-monospace", "Go Mono")
+	c.SetFallback(System)
+	return c
+})
@@ -0,0 +1,181 @@
+// Package font provides font faces, the CSS font matching algorithm and
+// text shaping.
+// This file implements font faces: their metrics and glyph outlines.
+// Reference: https://www.w3.org/TR/css-fonts-4/
+package font
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+)
+
+// GlyphID identifies a glyph within a face.
+type GlyphID = tsfont.GID
+
+// Face is a single font face of a family, such as Go Bold Italic.
+type Face struct {
+	Family string
+	Weight int // 1 to 1000, 400 is normal and 700 bold
+	Italic bool
+
+	// ranges limits a web font to the characters of its unicode-range
+	ranges []RuneRange
+	// open reads the font data of a face found on disk on first use
+	open func() (*tsfont.Face, error)
+	once sync.Once
+	face *tsfont.Face
+	upem float64
+}
+
+// Parse loads a face from OpenType, TrueType, WOFF or WOFF2 data. The
+// family, weight and style are read from the font's own tables.
+func Parse(data []byte) (*Face, error) {
+	data, err := decodeWebFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("font: %w", err)
+	}
+	face, err := tsfont.ParseTTF(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("font: %w", err)
+	}
+	f := &Face{face: face, upem: float64(face.Upem())}
+	f.describe(face.Describe())
+	return f, nil
+}
+
+// describe sets the family, weight and style of a face from the
+// description in its tables.
+func (f *Face) describe(desc tsfont.Description) {
+	f.Family = desc.Family
+	f.Weight = int(desc.Aspect.Weight)
+	f.Italic = desc.Aspect.Style == tsfont.StyleItalic
+	if f.Weight == 0 {
+		f.Weight = 400
+	}
+}
+
+// font returns the parsed font of the face, opening it if needed, or nil
+// when it can't be read.
+func (f *Face) font() *tsfont.Face {
+	f.once.Do(func() {
+		if f.open == nil {
+			return
+		}
+		if face, err := f.open(); err == nil {
+			f.face, f.upem = face, float64(face.Upem())
+		}
+	})
+	return f.face
+}
+
+// opener opens the font of the face for a copy that shares it.
+func (f *Face) opener() (*tsfont.Face, error) {
+	if face := f.font(); face != nil {
+		return face, nil
+	}
+	return nil, fmt.Errorf("font: %s can't be read", f.Family)
+}
+
+// HasGlyph reports whether the face maps r to a glyph, within its
+// unicode-range when it has one.
+func (f *Face) HasGlyph(r rune) bool {
+	if f.ranges != nil && !inRanges(f.ranges, r) {
+		return false
+	}
+	face := f.font()
+	if face == nil {
+		return false
+	}
+	_, ok := face.NominalGlyph(r)
+	return ok
+}
+
+// Metrics returns the ascent and descent of the face at a font size, both
+// positive distances from the baseline.
+func (f *Face) Metrics(size float64) (ascent, descent float64) {
+	face := f.font()
+	if face == nil {
+		return size * 0.8, size * 0.2
+	}
+	extents, ok := face.FontHExtents()
+	if !ok {
+		return size * 0.8, size * 0.2
+	}
+	scale := size / f.upem
+	return float64(extents.Ascender) * scale, -float64(extents.Descender) * scale
+}
+
+// SegmentOp is the drawing operation of an outline segment.
+type SegmentOp int
+
+const (
+	MoveTo SegmentOp = iota
+	LineTo
+	QuadTo
+	CubeTo
+)
+
+// Point is a position in pixels, with y growing downwards.
+type Point struct {
+	X, Y float64
+}
+
+// Segment is one step of a glyph outline. Points holds the end point last,
+// after any control points.
+type Segment struct {
+	Op     SegmentOp
+	Points []Point
+}
+
+// Outline returns the outline of a glyph at a font size, relative to its
+// origin on the baseline. Glyphs without a vector outline, such as bitmap
+// or color glyphs, return nil.
+func (f *Face) Outline(id GlyphID, size float64) []Segment {
+	face := f.font()
+	if face == nil {
+		return nil
+	}
+	var outline tsfont.GlyphOutline
+	switch data := face.GlyphData(id).(type) {
+	case tsfont.GlyphOutline:
+		outline = data
+	case tsfont.GlyphBitmap:
+		if data.Outline == nil {
+			return nil
+		}
+		outline = *data.Outline
+	default:
+		return nil
+	}
+	scale := size / f.upem
+	segments := make([]Segment, len(outline.Segments))
+	for i, seg := range outline.Segments {
+		args := seg.ArgsSlice()
+		points := make([]Point, len(args))
+		for k, p := range args {
+			points[k] = Point{X: float64(p.X) * scale, Y: -float64(p.Y) * scale}
+		}
+		segments[i] = Segment{Op: segmentOps[seg.Op], Points: points}
+	}
+	return segments
+}
+
+var segmentOps = map[ot.SegmentOp]SegmentOp{
+	ot.SegmentOpMoveTo: MoveTo,
+	ot.SegmentOpLineTo: LineTo,
+	ot.SegmentOpQuadTo: QuadTo,
+	ot.SegmentOpCubeTo: CubeTo,
+}
+
+// String returns the family and style of the face.
+func (f *Face) String() string {
+	style := "normal"
+	if f.Italic {
+		style = "italic"
+	}
+	return fmt.Sprintf("%s %d %s", f.Family, f.Weight, style)
+}
@@ -0,0 +1,111 @@
+package font
+
+import "testing"
+
+func TestDefaultMatch(t *testing.T) {
+	fonts := Default()
+	tests := []struct {
+		name     string
+		families []string
+		weight   int
+		italic   bool
+		want     string
+	}{
+		{"generic serif", []string{"serif"}, 400, false, "Go 400 normal"},
+		{"monospace", []string{"monospace"}, 400, false, "Go Mono 400 normal"},
+		{"first installed family wins", []string{"Missing", "Go Mono", "serif"}, 400, false, "Go Mono 400 normal"},
+		{"family names ignore case", []string{"go medium"}, 400, false, "Go Medium 500 normal"},
+		{"bold takes the heaviest face", []string{"sans-serif"}, 700, false, "Go 600 normal"},
+		{"italic", []string{"sans-serif"}, 400, true, "Go 400 italic"},
+		{"unknown family falls back", []string{"Missing"}, 400, false, "Go 400 normal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			face := fonts.Match(Style{tt.families, tt.weight, tt.italic})
+			if face == nil || face.String() != tt.want {
+				t.Errorf("Match(%q, %d, %v) = %v, want %s", tt.families, tt.weight, tt.italic, face, tt.want)
+			}
+		})
+	}
+	if face := NewCollection().Match(Style{[]string{"serif"}, 400, false}); face != nil {
+		t.Errorf("empty collection matched %v", face)
+	}
+}
+
+func TestWeightPreferred(t *testing.T) {
+	tests := []struct {
+		a, b, desired int
+		want          bool
+	}{
+		{400, 300, 400, true},
+		{500, 300, 400, true},  // 400 tries 500 before lighter weights
+		{300, 600, 400, true},  // then lighter weights before heavier
+		{300, 200, 350, true},  // below 400 lighter weights come first
+		{700, 500, 600, true},  // above 500 heavier weights come first
+		{500, 900, 600, false}, // and lighter ones last
+	}
+	for _, tt := range tests {
+		if got := weightPreferred(tt.a, tt.b, tt.desired); got != tt.want {
+			t.Errorf("weightPreferred(%d, %d, %d) = %v, want %v", tt.a, tt.b, tt.desired, got, tt.want)
+		}
+	}
+}
+
+func TestFaceOutlineAndMetrics(t *testing.T) {
+	face := Default().Match(Style{[]string{"serif"}, 400, false})
+	ascent, descent := face.Metrics(16)
+	if ascent <= 0 || descent <= 0 || ascent+descent > 24 {
+		t.Errorf("metrics = %v, %v", ascent, descent)
+	}
+	glyphs := Shape([]rune("H"), face, 16, false, "")
+	outline := face.Outline(glyphs[0].ID, 16)
+	if len(outline) == 0 || outline[0].Op != MoveTo {
+		t.Fatalf("outline of H = %v", outline)
+	}
+	// The outline of H lies above the baseline, y growing downwards
+	for _, seg := range outline {
+		for _, p := range seg.Points {
+			if p.Y > 0.01 || p.Y < -ascent {
+				t.Errorf("point %v outside the ascent", p)
+			}
+		}
+	}
+	if !face.HasGlyph('H') || face.HasGlyph('א') {
+		t.Error("Go covers Latin but not Hebrew")
+	}
+}
+
+func TestFallbackPerCharacter(t *testing.T) {
+	if !System().local("DejaVu Sans").HasGlyph('א') {
+		t.Skip("DejaVu Sans is not installed")
+	}
+	fonts := Default()
+	style := Style{[]string{"Go Mono", "serif"}, 400, false}
+	if face := fonts.FaceFor('a', style); face.Family != "Go Mono" {
+		t.Errorf("a uses %v, want Go Mono", face)
+	}
+	hebrew := fonts.FaceFor('א', style)
+	if hebrew.Family == "Go Mono" || !hebrew.HasGlyph('א') {
+		t.Errorf("Hebrew uses %v, want an installed face with Hebrew", hebrew)
+	}
+	// A named installed family is matched before the fallback search
+	if face := fonts.Match(Style{[]string{"DejaVu Serif"}, 700, false}); face.String() != "DejaVu Serif 700 normal" {
+		t.Errorf("DejaVu Serif bold = %v", face)
+	}
+
+	// The space between the runs stays with the Latin text before it
+	text := []rune("ab אב")
+	glyphs := fonts.Shape(text, style, 10, false, "")
+	if len(glyphs) != len(text) {
+		t.Fatalf("glyphs = %+v", glyphs)
+	}
+	for _, g := range glyphs {
+		want := "Go Mono"
+		if g.Cluster > 2 {
+			want = hebrew.Family
+		}
+		if g.Face.Family != want || g.ID == 0 {
+			t.Errorf("cluster %d uses %v glyph %d, want %s", g.Cluster, g.Face, g.ID, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package font provides font faces, the CSS font matching algorithm and
+// text shaping.
+// This file implements text shaping: glyph selection and positioning with
+// a HarfBuzz-compatible shaper, and caret positions within shaped runs.
+// Reference: https://www.w3.org/TR/css-text-3/#characters
+package font
+
+import (
+	"sync"
+
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/segmenter"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/math/fixed"
+)
+
+// Glyph is a positioned glyph of a shaped run. Glyphs are stored in visual
+// order, left to right. All glyphs shaped from the same characters share
+// a cluster, the index of the first of those characters in the run's text.
+type Glyph struct {
+	Face     *Face
+	ID       GlyphID
+	Cluster  int
+	XAdvance float64
+	// Offsets of the glyph from its pen position, y growing downwards
+	XOffset, YOffset float64
+}
+
+// Advance returns the total advance of a run of glyphs.
+func Advance(glyphs []Glyph) float64 {
+	width := 0.0
+	for _, g := range glyphs {
+		width += g.XAdvance
+	}
+	return width
+}
+
+// shapeKey identifies a shaped run, which is independent of the font size.
+type shapeKey struct {
+	face *Face
+	text string
+	rtl  bool
+	lang string
+}
+
+// shapeCacheSize bounds the number of runs kept in the cache.
+const shapeCacheSize = 4096
+
+var (
+	shapeMu    sync.Mutex
+	shaper     shaping.HarfbuzzShaper
+	shapeCache = map[shapeKey][]Glyph{}
+)
+
+// Shape shapes text with a face at a font size. rtl sets the direction of
+// the run, and lang the content language that selects localized forms.
+// The script is that of the first character with a specific script.
+func Shape(text []rune, face *Face, size float64, rtl bool, lang string) []Glyph {
+	if len(text) == 0 || face == nil || face.font() == nil {
+		return nil
+	}
+	key := shapeKey{face: face, text: string(text), rtl: rtl, lang: lang}
+	shapeMu.Lock()
+	units, ok := shapeCache[key]
+	if !ok {
+		units = shapeUnits(text, face, rtl, lang)
+		if len(shapeCache) >= shapeCacheSize {
+			clear(shapeCache)
+		}
+		shapeCache[key] = units
+	}
+	shapeMu.Unlock()
+
+	// Runs are shaped in font units and scaled to the size
+	scale := size / face.upem
+	glyphs := make([]Glyph, len(units))
+	for i, g := range units {
+		g.XAdvance *= scale
+		g.XOffset *= scale
+		g.YOffset *= scale
+		glyphs[i] = g
+	}
+	return glyphs
+}
+
+// shapeUnits shapes a run at one unit per font unit. It must be called
+// with shapeMu held.
+func shapeUnits(text []rune, face *Face, rtl bool, lang string) []Glyph {
+	input := shaping.Input{
+		Text:      text,
+		RunStart:  0,
+		RunEnd:    len(text),
+		Direction: di.DirectionLTR,
+		Face:      face.font(),
+		Size:      fixed.I(int(face.upem)),
+		Script:    runScript(text),
+	}
+	if rtl {
+		input.Direction = di.DirectionRTL
+	}
+	if lang != "" {
+		input.Language = language.NewLanguage(lang)
+	}
+	out := shaper.Shape(input)
+	glyphs := make([]Glyph, len(out.Glyphs))
+	for i, g := range out.Glyphs {
+		glyphs[i] = Glyph{
+			Face:     face,
+			ID:       g.GlyphID,
+			Cluster:  g.ClusterIndex,
+			XAdvance: fixedToFloat(g.XAdvance),
+			XOffset:  fixedToFloat(g.XOffset),
+			YOffset:  -fixedToFloat(g.YOffset),
+		}
+	}
+	return glyphs
+}
+
+func fixedToFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
+
+// runScript returns the script of the first character of text that is not
+// common to several scripts, or Latin.
+func runScript(text []rune) language.Script {
+	for _, r := range text {
+		switch script := language.LookupScript(r); script {
+		case language.Common, language.Inherited, language.Unknown:
+		default:
+			return script
+		}
+	}
+	return language.Latin
+}
+
+// Carets returns the caret position at each character boundary of a shaped
+// run, from before the first character to after the last, measured from
+// the left edge of the run. Positions inside a cluster that holds several
+// grapheme clusters, such as a ligature, divide its advance evenly;
+// positions inside a grapheme cluster take the position before it.
+func Carets(text []rune, glyphs []Glyph, rtl bool) []float64 {
+	n := len(text)
+	carets := make([]float64, n+1)
+	if n == 0 {
+		return carets
+	}
+
+	// The extent of each cluster, by its first character
+	type extent struct{ x0, x1 float64 }
+	extents := map[int]*extent{}
+	x := 0.0
+	for _, g := range glyphs {
+		e, ok := extents[g.Cluster]
+		if !ok {
+			e = &extent{x0: x, x1: x}
+			extents[g.Cluster] = e
+		}
+		e.x0 = min(e.x0, x)
+		e.x1 = max(e.x1, x+g.XAdvance)
+		x += g.XAdvance
+	}
+	total := x
+
+	graphemes := make([]bool, n+1)
+	var seg segmenter.Segmenter
+	seg.Init(text)
+	for iter := seg.GraphemeIterator(); iter.Next(); {
+		g := iter.Grapheme()
+		graphemes[g.Offset] = true
+	}
+	graphemes[n] = true
+
+	for start := 0; start < n; {
+		e, ok := extents[start]
+		end := start + 1
+		for end < n {
+			if _, next := extents[end]; next {
+				break
+			}
+			end++
+		}
+		if !ok {
+			// Characters without glyphs sit at the end of what precedes them
+			e = &extent{x0: total, x1: total}
+			if rtl {
+				e = &extent{}
+			}
+		}
+		var stops []int
+		for i := start; i < end; i++ {
+			if graphemes[i] {
+				stops = append(stops, i)
+			}
+		}
+		parts := float64(len(stops))
+		pos := 0.0
+		for i := start; i < end; i++ {
+			if graphemes[i] {
+				k := 0
+				for stops[k] != i {
+					k++
+				}
+				frac := float64(k) / parts
+				pos = e.x0 + frac*(e.x1-e.x0)
+				if rtl {
+					pos = e.x1 - frac*(e.x1-e.x0)
+				}
+			}
+			carets[i] = pos
+		}
+		start = end
+	}
+	if !rtl {
+		carets[n] = total
+	}
+	return carets
+}
@@ -0,0 +1,93 @@
+package font
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestShape(t *testing.T) {
+	face := Default().Match(Style{[]string{"monospace"}, 400, false})
+	glyphs := Shape([]rune("abc"), face, 10, false, "")
+	if len(glyphs) != 3 {
+		t.Fatalf("got %d glyphs, want 3", len(glyphs))
+	}
+	for i, g := range glyphs {
+		if g.Cluster != i || g.Face != face {
+			t.Errorf("glyph %d = %+v", i, g)
+		}
+	}
+	// Go Mono advances are 1229 units of 2048 per em
+	if got, want := Advance(glyphs), 3*10*1229/2048.0; got != want {
+		t.Errorf("advance = %v, want %v", got, want)
+	}
+	// Right-to-left runs are stored in visual order
+	rtl := Shape([]rune("abc"), face, 10, true, "")
+	if rtl[0].Cluster != 2 || rtl[2].Cluster != 0 {
+		t.Errorf("rtl clusters = %d %d %d", rtl[0].Cluster, rtl[1].Cluster, rtl[2].Cluster)
+	}
+}
+
+func TestShapeComposesMarks(t *testing.T) {
+	face := Default().Match(Style{[]string{"serif"}, 400, false})
+	// e followed by a combining acute accent forms a single cluster
+	text := []rune("e\u0301x")
+	glyphs := Shape(text, face, 16, false, "")
+	if len(glyphs) != 2 || glyphs[0].Cluster != 0 || glyphs[1].Cluster != 2 {
+		t.Fatalf("glyphs = %+v", glyphs)
+	}
+	carets := Carets(text, glyphs, false)
+	want := []float64{0, 0, glyphs[0].XAdvance, Advance(glyphs)}
+	if fmt.Sprint(carets) != fmt.Sprint(want) {
+		t.Errorf("carets = %v, want %v", carets, want)
+	}
+}
+
+func TestShapeArabicJoining(t *testing.T) {
+	data, err := os.ReadFile("/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf")
+	if err != nil {
+		t.Skip("DejaVu Sans is not installed")
+	}
+	face, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Beh takes its initial, medial and final forms when joined
+	isolated := Shape([]rune("ب"), face, 16, true, "")
+	joined := Shape([]rune("ببب"), face, 16, true, "")
+	if len(joined) != 3 {
+		t.Fatalf("got %d glyphs, want 3", len(joined))
+	}
+	for i, g := range joined {
+		if g.ID == isolated[0].ID {
+			t.Errorf("glyph %d uses the isolated form", i)
+		}
+	}
+	if joined[0].ID == joined[1].ID || joined[1].ID == joined[2].ID {
+		t.Errorf("joined forms are not distinct: %v %v %v", joined[0].ID, joined[1].ID, joined[2].ID)
+	}
+}
+
+func TestCarets(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		glyphs []Glyph
+		rtl    bool
+		want   []float64
+	}{
+		{"one glyph per character", "ab", []Glyph{{Cluster: 0, XAdvance: 4}, {Cluster: 1, XAdvance: 6}}, false, []float64{0, 4, 10}},
+		{"ligature divides its advance", "fi", []Glyph{{Cluster: 0, XAdvance: 10}}, false, []float64{0, 5, 10}},
+		{"right-to-left", "ab", []Glyph{{Cluster: 1, XAdvance: 6}, {Cluster: 0, XAdvance: 4}}, true, []float64{10, 6, 0}},
+		{"right-to-left ligature", "ab", []Glyph{{Cluster: 0, XAdvance: 8}}, true, []float64{8, 4, 0}},
+		{"cluster of several glyphs", "a", []Glyph{{Cluster: 0, XAdvance: 3}, {Cluster: 0, XAdvance: 2}}, false, []float64{0, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Carets([]rune(tt.text), tt.glyphs, tt.rtl)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Carets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
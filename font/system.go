@@ -0,0 +1,104 @@
+// Package font provides font faces, the CSS font matching algorithm and
+// text shaping.
+// This file implements system fonts, the faces installed in the
+// platform's font directories, described up front and read on first use.
+// Reference: https://www.w3.org/TR/css-fonts-4/#installed-font-fallback
+package font
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	tsfont "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+)
+
+// System returns the collection of the fonts installed on the system.
+var System = sync.OnceValue(func() *Collection {
+	c := NewCollection()
+	for _, dir := range systemFontDirs() {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ttf", ".otf", ".ttc", ".otc":
+				for _, face := range describeFile(path) {
+					c.Add(face)
+				}
+			}
+			return nil
+		})
+	}
+	return c
+})
+
+// systemFontDirs returns the font directories of the platform.
+func systemFontDirs() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "js", "wasip1":
+		return nil
+	case "windows":
+		dirs := []string{filepath.Join(os.Getenv("WINDIR"), "Fonts")}
+		if local := os.Getenv("LOCALAPPDATA"); local != "" {
+			dirs = append(dirs, filepath.Join(local, "Microsoft", "Windows", "Fonts"))
+		}
+		return dirs
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library", "Fonts")}
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(dataHome, "fonts"), filepath.Join(home, ".fonts")}
+}
+
+// describeFile returns a face for each font of a file, described from its
+// tables without loading the rest.
+func describeFile(path string) []*Face {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	loaders, err := ot.NewLoaders(file)
+	if err != nil {
+		return nil
+	}
+	faces := make([]*Face, 0, len(loaders))
+	for i, ld := range loaders {
+		desc, _ := tsfont.Describe(ld, nil)
+		if desc.Family == "" {
+			continue
+		}
+		face := &Face{open: openFile(path, i)}
+		face.describe(desc)
+		faces = append(faces, face)
+	}
+	return faces
+}
+
+// openFile returns a function that reads the font at an index of a file.
+func openFile(path string, index int) func() (*tsfont.Face, error) {
+	return func() (*tsfont.Face, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		faces, err := tsfont.ParseTTC(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if index >= len(faces) {
+			return nil, fs.ErrNotExist
+		}
+		return faces[index], nil
+	}
+}
@@ -0,0 +1,615 @@
+// Package font provides font faces, the CSS font matching algorithm and
+// text shaping.
+// This file implements web fonts, the faces described by @font-face rules
+// or the FontFace API, whose data is downloaded on first use.
+// Reference: https://www.w3.org/TR/css-fonts-4/#font-face-rule
+package font
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// RuneRange is an inclusive range of characters of a unicode-range.
+type RuneRange struct {
+	Lo, Hi rune
+}
+
+func inRanges(ranges []RuneRange, r rune) bool {
+	for _, rr := range ranges {
+		if r >= rr.Lo && r <= rr.Hi {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseUnicodeRange parses a unicode-range descriptor, a comma-separated
+// list of ranges such as U+0025-00FF or U+4??.
+func ParseUnicodeRange(value string) ([]RuneRange, error) {
+	var ranges []RuneRange
+	expectRange := true
+	for _, tok := range css.NewTokenizer(value).TokenizeAllSkipWS() {
+		switch {
+		case tok.Type == css.TokenEOF:
+		case tok.Type == css.TokenUnicodeRange && expectRange:
+			if tok.StartRange > tok.EndRange || tok.EndRange > 0x10FFFF {
+				return nil, fmt.Errorf("invalid unicode range %q", value)
+			}
+			ranges = append(ranges, RuneRange{tok.StartRange, tok.EndRange})
+			expectRange = false
+		case tok.Type == css.TokenComma && !expectRange:
+			expectRange = true
+		default:
+			return nil, fmt.Errorf("invalid unicode range %q", value)
+		}
+	}
+	if expectRange {
+		return nil, fmt.Errorf("invalid unicode range %q", value)
+	}
+	return ranges, nil
+}
+
+// Status is the load status of a FontFace.
+type Status int
+
+const (
+	Unloaded Status = iota
+	Loading
+	Loaded
+	Error
+)
+
+func (s Status) String() string {
+	return [...]string{"unloaded", "loading", "loaded", "error"}[s]
+}
+
+// Display is the font-display policy of a face, which sets how long text
+// waits for the face to load and how late it may still replace fallback
+// text.
+type Display int
+
+const (
+	DisplayAuto Display = iota
+	DisplayBlock
+	DisplaySwap
+	DisplayFallback
+	DisplayOptional
+)
+
+var displayNames = []string{"auto", "block", "swap", "fallback", "optional"}
+
+func (d Display) String() string {
+	return displayNames[d]
+}
+
+// Periods returns the block period, during which text waits for the face,
+// and the swap period that follows, during which a face that finishes
+// loading replaces the fallback. A negative swap period never ends.
+func (d Display) Periods() (block, swap time.Duration) {
+	switch d {
+	case DisplaySwap:
+		return 0, -1
+	case DisplayFallback:
+		return 100 * time.Millisecond, 3 * time.Second
+	case DisplayOptional:
+		return 100 * time.Millisecond, 0
+	}
+	return 3 * time.Second, -1
+}
+
+// Source is one alternative of a src descriptor: a font file to download,
+// a locally installed face, or data given to the FontFace constructor.
+type Source struct {
+	URL    string
+	Format string
+	Local  string
+	Data   []byte
+}
+
+// supportedFormats are the format() hints of files that can be decoded.
+var supportedFormats = map[string]bool{
+	"": true, "woff": true, "woff2": true, "truetype": true, "opentype": true,
+}
+
+// ParseSources parses a src descriptor, resolving URLs against base when
+// it isn't nil.
+func ParseSources(value string, base *url.URL) ([]Source, error) {
+	var sources []Source
+	var src *Source
+	tokens := css.NewTokenizer(value).TokenizeAllSkipWS()
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch tok.Type {
+		case css.TokenEOF:
+			continue
+		case css.TokenComma:
+			if src == nil {
+				return nil, fmt.Errorf("invalid src %q", value)
+			}
+			sources = append(sources, *src)
+			src = nil
+			continue
+		case css.TokenURL:
+			if src != nil {
+				return nil, fmt.Errorf("invalid src %q", value)
+			}
+			src = &Source{URL: resolveURL(tok.Value, base)}
+			continue
+		case css.TokenFunction:
+		default:
+			return nil, fmt.Errorf("invalid src %q", value)
+		}
+
+		// Function arguments up to the closing parenthesis
+		var args []css.Token
+		for i++; i < len(tokens) && tokens[i].Type != css.TokenCloseParen; i++ {
+			args = append(args, tokens[i])
+		}
+		name := strings.ToLower(tok.Value)
+		switch {
+		case name == "url" && src == nil && len(args) == 1 && args[0].Type == css.TokenString:
+			src = &Source{URL: resolveURL(args[0].Value, base)}
+		case name == "local" && src == nil && len(args) > 0:
+			var parts []string
+			for _, arg := range args {
+				if arg.Type != css.TokenString && arg.Type != css.TokenIdent {
+					return nil, fmt.Errorf("invalid src %q", value)
+				}
+				parts = append(parts, arg.Value)
+			}
+			src = &Source{Local: strings.Join(parts, " ")}
+		case name == "format" && src != nil && src.URL != "" && src.Format == "" && len(args) == 1:
+			src.Format = strings.ToLower(args[0].Value)
+		case name == "tech" && src != nil && src.URL != "":
+			// Font technologies are not negotiated
+		default:
+			return nil, fmt.Errorf("invalid src %q", value)
+		}
+	}
+	if src == nil {
+		return nil, fmt.Errorf("invalid src %q", value)
+	}
+	return append(sources, *src), nil
+}
+
+func resolveURL(ref string, base *url.URL) string {
+	if base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// Descriptors are the descriptors of a face as written in CSS.
+type Descriptors struct {
+	Family          string
+	Style           string
+	Weight          string
+	Stretch         string
+	UnicodeRange    string
+	FeatureSettings string
+	Display         string
+}
+
+// withDefaults fills in the initial value of unset descriptors.
+func (d Descriptors) withDefaults() Descriptors {
+	set := func(v *string, initial string) {
+		if strings.TrimSpace(*v) == "" {
+			*v = initial
+		}
+	}
+	set(&d.Style, "normal")
+	set(&d.Weight, "normal")
+	set(&d.Stretch, "normal")
+	set(&d.UnicodeRange, "U+0-10FFFF")
+	set(&d.FeatureSettings, "normal")
+	set(&d.Display, "auto")
+	return d
+}
+
+// Fetcher downloads the font file at an absolute URL.
+type Fetcher func(url string) ([]byte, error)
+
+// FontFace is a face described by an @font-face rule or created with the
+// FontFace API. It takes part in matching through its descriptors before
+// its data has loaded.
+type FontFace struct {
+	// CSSConnected reports whether the face comes from an @font-face rule
+	CSSConnected bool
+
+	mu       sync.Mutex
+	desc     Descriptors
+	sources  []Source
+	status   Status
+	err      error
+	face     *Face
+	done     chan struct{}
+	started  time.Time
+	finished time.Time
+
+	// Parsed descriptors
+	family               string
+	weightMin, weightMax int
+	italic               bool
+	ranges               []RuneRange
+	display              Display
+}
+
+// NewFontFace creates an unloaded face. Invalid descriptors or a missing
+// source leave the face in the Error status.
+func NewFontFace(desc Descriptors, sources []Source) *FontFace {
+	f := &FontFace{sources: sources, done: make(chan struct{})}
+	err := f.setDescriptors(desc.withDefaults())
+	if err == nil && len(sources) == 0 {
+		err = errors.New("no font source")
+	}
+	if err != nil {
+		f.status, f.err = Error, err
+		close(f.done)
+	}
+	return f
+}
+
+// Descriptors returns the descriptors of the face.
+func (f *FontFace) Descriptors() Descriptors {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.desc
+}
+
+// SetDescriptors replaces the descriptors of the face, leaving them
+// unchanged and returning an error when one is invalid.
+func (f *FontFace) SetDescriptors(desc Descriptors) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.setDescriptors(desc.withDefaults())
+}
+
+func (f *FontFace) setDescriptors(desc Descriptors) error {
+	families := ParseFamilies(desc.Family)
+	if len(families) != 1 {
+		return fmt.Errorf("invalid font family %q", desc.Family)
+	}
+	weightMin, weightMax, err := parseWeightRange(desc.Weight)
+	if err != nil {
+		return err
+	}
+	italic, err := parseFaceStyle(desc.Style)
+	if err != nil {
+		return err
+	}
+	ranges, err := ParseUnicodeRange(desc.UnicodeRange)
+	if err != nil {
+		return err
+	}
+	display := -1
+	for i, name := range displayNames {
+		if strings.EqualFold(strings.TrimSpace(desc.Display), name) {
+			display = i
+		}
+	}
+	if display < 0 {
+		return fmt.Errorf("invalid font-display %q", desc.Display)
+	}
+	f.desc = desc
+	f.family, f.weightMin, f.weightMax, f.italic = families[0], weightMin, weightMax, italic
+	f.ranges, f.display = ranges, Display(display)
+	if f.face != nil {
+		f.face.Family, f.face.Weight, f.face.Italic, f.face.ranges = f.family, f.weightMin, f.italic, f.ranges
+	}
+	return nil
+}
+
+// parseWeightRange parses a font-weight descriptor: normal, bold, or one
+// or two numbers for variable fonts.
+func parseWeightRange(value string) (lo, hi int, err error) {
+	fields := strings.Fields(strings.ToLower(value))
+	var weights []int
+	for _, field := range fields {
+		switch field {
+		case "normal":
+			weights = append(weights, 400)
+		case "bold":
+			weights = append(weights, 700)
+		default:
+			w, err := strconv.ParseFloat(field, 64)
+			if err != nil || w < 1 || w > 1000 {
+				return 0, 0, fmt.Errorf("invalid font weight %q", value)
+			}
+			weights = append(weights, int(w))
+		}
+	}
+	switch len(weights) {
+	case 1:
+		return weights[0], weights[0], nil
+	case 2:
+		return min(weights[0], weights[1]), max(weights[0], weights[1]), nil
+	}
+	return 0, 0, fmt.Errorf("invalid font weight %q", value)
+}
+
+// parseFaceStyle parses a font-style descriptor, reporting whether it
+// selects italic or oblique faces.
+func parseFaceStyle(value string) (italic bool, err error) {
+	fields := strings.Fields(strings.ToLower(value))
+	switch {
+	case len(fields) == 1 && fields[0] == "normal":
+		return false, nil
+	case len(fields) == 1 && fields[0] == "italic":
+		return true, nil
+	case len(fields) >= 1 && len(fields) <= 3 && fields[0] == "oblique":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid font style %q", value)
+}
+
+// Family returns the family name of the face.
+func (f *FontFace) Family() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.family
+}
+
+// Status returns the load status of the face.
+func (f *FontFace) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
+
+// Err returns why the face failed to load.
+func (f *FontFace) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// Face returns the loaded face, or nil before it has loaded.
+func (f *FontFace) Face() *Face {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.face
+}
+
+// Done returns a channel that is closed once the face has loaded or
+// failed to.
+func (f *FontFace) Done() <-chan struct{} {
+	return f.done
+}
+
+// Available reports whether the face has loaded in time to be used under
+// its font-display policy: a face that loads after its swap period ended
+// is treated as failed.
+func (f *FontFace) Available() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.available()
+}
+
+func (f *FontFace) available() bool {
+	if f.status != Loaded {
+		return false
+	}
+	block, swap := f.display.Periods()
+	return swap < 0 || f.finished.Sub(f.started) <= block+swap
+}
+
+// blockDeadline returns when the block period of a loading face ends.
+func (f *FontFace) blockDeadline() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	block, _ := f.display.Periods()
+	return f.started.Add(block)
+}
+
+// Load starts loading the face with fetch unless it has already started,
+// and returns a channel that is closed when loading ends. It reports
+// whether this call started the load.
+func (f *FontFace) Load(fetch Fetcher) (<-chan struct{}, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != Unloaded {
+		return f.done, false
+	}
+	f.status = Loading
+	f.started = time.Now()
+	sources := f.sources
+	if len(sources) == 1 && sources[0].Data != nil {
+		// Data given to the constructor is parsed right away
+		f.finish(loadSources(sources, fetch))
+	} else {
+		go func() {
+			face, err := loadSources(sources, fetch)
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.finish(face, err)
+		}()
+	}
+	return f.done, true
+}
+
+// finish records the result of a load. It must be called with f.mu held.
+func (f *FontFace) finish(face *Face, err error) {
+	f.finished = time.Now()
+	if err != nil {
+		f.status, f.err = Error, err
+	} else {
+		face.Family, face.Weight, face.Italic, face.ranges = f.family, f.weightMin, f.italic, f.ranges
+		f.status, f.face = Loaded, face
+	}
+	close(f.done)
+}
+
+// loadSources loads the first source that yields a usable face.
+func loadSources(sources []Source, fetch Fetcher) (*Face, error) {
+	err := errors.New("no usable font source")
+	for _, src := range sources {
+		var face *Face
+		switch {
+		case src.Data != nil:
+			face, err = Parse(src.Data)
+		case src.Local != "":
+			// Faces take their names from the descriptors, so installed
+			// faces are shared through a copy
+			if local := Default().local(src.Local); local != nil {
+				face = &Face{open: local.opener}
+			} else {
+				err = fmt.Errorf("font %q is not installed", src.Local)
+			}
+		case !supportedFormats[src.Format]:
+			err = fmt.Errorf("unsupported font format %q", src.Format)
+		case fetch == nil:
+			err = errors.New("fonts can't be downloaded")
+		default:
+			var data []byte
+			if data, err = fetch(src.URL); err == nil {
+				face, err = Parse(data)
+			}
+		}
+		if face != nil && err == nil {
+			return face, nil
+		}
+	}
+	return nil, err
+}
+
+// ParseFamilies splits a font-family list into family names without
+// quotes.
+func ParseFamilies(value string) []string {
+	var families []string
+	var name []string
+	flush := func() {
+		if len(name) > 0 {
+			families = append(families, strings.Join(name, " "))
+		}
+		name = nil
+	}
+	for _, tok := range css.NewTokenizer(value).TokenizeAllSkipWS() {
+		switch tok.Type {
+		case css.TokenString, css.TokenIdent:
+			name = append(name, tok.Value)
+		case css.TokenComma:
+			flush()
+		}
+	}
+	flush()
+	return families
+}
+
+// ParseFont parses the value of the font shorthand into the style it
+// matches faces with and its font size in pixels.
+func ParseFont(value string) (Style, float64, error) {
+	style := Style{Weight: 400}
+	tokens := css.NewTokenizer(value).TokenizeAllSkipWS()
+	for i, tok := range tokens {
+		switch {
+		case tok.Type == css.TokenIdent:
+			switch strings.ToLower(tok.Value) {
+			case "normal", "small-caps", "ultra-condensed", "extra-condensed", "condensed", "semi-condensed",
+				"semi-expanded", "expanded", "extra-expanded", "ultra-expanded":
+				continue
+			case "italic", "oblique":
+				style.Italic = true
+				continue
+			case "bold", "bolder":
+				style.Weight = 700
+				continue
+			case "lighter":
+				style.Weight = 100
+				continue
+			}
+		case tok.Type == css.TokenNumber && tok.NumValue >= 1 && tok.NumValue <= 1000:
+			style.Weight = int(tok.NumValue)
+			continue
+		case tok.Type == css.TokenDimension || tok.Type == css.TokenPercentage:
+			// Relative sizes are resolved against the initial font size
+			size := tok.NumValue
+			switch unit := strings.ToLower(tok.Unit); {
+			case tok.Type == css.TokenPercentage:
+				size *= 16.0 / 100
+			case unit == "px":
+			case unit == "pt":
+				size *= 4.0 / 3
+			case unit == "em" || unit == "rem":
+				size *= 16
+			default:
+				return style, 0, fmt.Errorf("invalid font %q", value)
+			}
+			rest := tokens[i+1:]
+			if len(rest) > 0 && rest[0].Type == css.TokenDelim && rest[0].Delim == '/' {
+				rest = rest[min(2, len(rest)):] // line-height
+			}
+			var sb strings.Builder
+			for _, t := range rest {
+				switch t.Type {
+				case css.TokenString:
+					sb.WriteString(strconv.Quote(t.Value))
+				case css.TokenIdent:
+					sb.WriteString(t.Value + " ")
+				case css.TokenComma:
+					sb.WriteString(",")
+				}
+			}
+			if style.Families = ParseFamilies(sb.String()); len(style.Families) == 0 {
+				return style, 0, fmt.Errorf("invalid font %q", value)
+			}
+			return style, size, nil
+		}
+		return style, 0, fmt.Errorf("invalid font %q", value)
+	}
+	return style, 0, fmt.Errorf("invalid font %q", value)
+}
+
+// fontFaceDescriptors maps @font-face descriptor names to their fields.
+var fontFaceDescriptors = map[string]func(*Descriptors) *string{
+	"font-family":           func(d *Descriptors) *string { return &d.Family },
+	"font-style":            func(d *Descriptors) *string { return &d.Style },
+	"font-weight":           func(d *Descriptors) *string { return &d.Weight },
+	"font-stretch":          func(d *Descriptors) *string { return &d.Stretch },
+	"unicode-range":         func(d *Descriptors) *string { return &d.UnicodeRange },
+	"font-feature-settings": func(d *Descriptors) *string { return &d.FeatureSettings },
+	"font-display":          func(d *Descriptors) *string { return &d.Display },
+}
+
+// FontFacesFromStylesheet returns a face for every valid @font-face rule
+// of a stylesheet. URLs are resolved against the stylesheet's URL.
+func FontFacesFromStylesheet(sheet *css.Stylesheet, sheetURL string) []*FontFace {
+	base, err := url.Parse(sheetURL)
+	if err != nil || sheetURL == "" {
+		base = nil
+	}
+	var faces []*FontFace
+	for _, rule := range sheet.FontFaces {
+		var desc Descriptors
+		var sources []Source
+		var srcErr error = errors.New("missing src")
+		for _, decl := range rule.Declarations {
+			property := strings.ToLower(decl.Property)
+			if property == "src" {
+				sources, srcErr = ParseSources(decl.RawValue, base)
+			} else if field, ok := fontFaceDescriptors[property]; ok {
+				*field(&desc) = decl.RawValue
+			}
+		}
+		face := NewFontFace(desc, sources)
+		if srcErr != nil || face.Status() == Error {
+			// Rules missing a family or source, or with invalid
+			// descriptors, don't define a face
+			continue
+		}
+		face.CSSConnected = true
+		faces = append(faces, face)
+	}
+	return faces
+}
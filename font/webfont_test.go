@@ -0,0 +1,241 @@
+package font
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestParseUnicodeRange(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []RuneRange
+	}{
+		{"U+0-7F", []RuneRange{{0, 0x7F}}},
+		{"U+0025-00FF, u+4??", []RuneRange{{0x25, 0xFF}, {0x400, 0x4FF}}},
+		{"U+20AC", []RuneRange{{0x20AC, 0x20AC}}},
+		{"", nil},
+		{"U+FF-0", nil},
+		{"U+0-7F,", nil},
+		{"latin", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseUnicodeRange(tt.value)
+		if (err != nil) != (tt.want == nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseUnicodeRange(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	base, _ := url.Parse("https://example.com/css/site.css")
+	tests := []struct {
+		value string
+		want  []Source
+	}{
+		{
+			`url(fonts/a.woff2) format("woff2"), url("/b.ttf") format(truetype) tech(variations)`,
+			[]Source{
+				{URL: "https://example.com/css/fonts/a.woff2", Format: "woff2"},
+				{URL: "https://example.com/b.ttf", Format: "truetype"},
+			},
+		},
+		{
+			`local("Open Sans"), local(Open Sans Bold), url(a.otf)`,
+			[]Source{{Local: "Open Sans"}, {Local: "Open Sans Bold"}, {URL: "https://example.com/css/a.otf"}},
+		},
+		{"", nil},
+		{"url(a.woff),", nil},
+		{"format(woff)", nil},
+		{"local(1)", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseSources(tt.value, base)
+		if (err != nil) != (tt.want == nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSources(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseFont(t *testing.T) {
+	tests := []struct {
+		value string
+		style Style
+		size  float64
+	}{
+		{"16px serif", Style{[]string{"serif"}, 400, false}, 16},
+		{"italic bold 12pt/1.5 \"Open Sans\", sans-serif", Style{[]string{"Open Sans", "sans-serif"}, 700, true}, 16},
+		{"300 2em Go Mono", Style{[]string{"Go Mono"}, 300, false}, 32},
+	}
+	for _, tt := range tests {
+		style, size, err := ParseFont(tt.value)
+		if err != nil || !reflect.DeepEqual(style, tt.style) || size != tt.size {
+			t.Errorf("ParseFont(%q) = %v, %v, %v, want %v, %v", tt.value, style, size, err, tt.style, tt.size)
+		}
+	}
+	for _, value := range []string{"", "serif", "16px", "bold", "16 serif"} {
+		if _, _, err := ParseFont(value); err == nil {
+			t.Errorf("ParseFont(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestFontFaceDescriptors(t *testing.T) {
+	f := NewFontFace(Descriptors{Family: `"My Font"`, Weight: "300 700", Style: "oblique 10deg"}, []Source{{URL: "a.ttf"}})
+	if f.Status() != Unloaded {
+		t.Fatalf("status = %v, want unloaded: %v", f.Status(), f.Err())
+	}
+	if f.Family() != "My Font" || f.weightMin != 300 || f.weightMax != 700 || !f.italic {
+		t.Errorf("parsed descriptors = %q %d-%d %v", f.Family(), f.weightMin, f.weightMax, f.italic)
+	}
+	if d := f.Descriptors(); d.Display != "auto" || d.UnicodeRange != "U+0-10FFFF" {
+		t.Errorf("defaults = %+v", d)
+	}
+
+	desc := f.Descriptors()
+	desc.Weight = "heavy"
+	if err := f.SetDescriptors(desc); err == nil {
+		t.Error("SetDescriptors accepted an invalid weight")
+	}
+	if f.Descriptors().Weight != "300 700" {
+		t.Errorf("an invalid descriptor replaced the weight with %q", f.Descriptors().Weight)
+	}
+
+	invalid := []Descriptors{
+		{Family: "A, B"},
+		{Family: "A", Style: "sideways"},
+		{Family: "A", UnicodeRange: "U+FF-0"},
+		{Family: "A", Display: "later"},
+	}
+	for _, desc := range invalid {
+		if f := NewFontFace(desc, []Source{{URL: "a.ttf"}}); f.Status() != Error {
+			t.Errorf("NewFontFace(%+v) status = %v, want error", desc, f.Status())
+		}
+	}
+	if f := NewFontFace(Descriptors{Family: "A"}, nil); f.Status() != Error {
+		t.Errorf("a face without sources has status %v, want error", f.Status())
+	}
+}
+
+func TestDisplayAvailable(t *testing.T) {
+	tests := []struct {
+		display string
+		delay   time.Duration
+		want    bool
+	}{
+		{"auto", time.Hour, true},
+		{"swap", time.Hour, true},
+		{"fallback", time.Second, true},
+		{"fallback", 4 * time.Second, false},
+		{"optional", 50 * time.Millisecond, true},
+		{"optional", time.Second, false},
+	}
+	for _, tt := range tests {
+		f := NewFontFace(Descriptors{Family: "A", Display: tt.display}, []Source{{URL: "a.ttf"}})
+		f.status, f.started, f.finished = Loaded, time.Unix(0, 0), time.Unix(0, 0).Add(tt.delay)
+		if got := f.Available(); got != tt.want {
+			t.Errorf("font-display %s loaded after %v: Available() = %v, want %v", tt.display, tt.delay, got, tt.want)
+		}
+	}
+}
+
+func TestFontFaceLoad(t *testing.T) {
+	fetched := map[string]int{}
+	fetch := func(url string) ([]byte, error) {
+		fetched[url]++
+		if url == "https://example.com/go.ttf" {
+			return goregular.TTF, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	f := NewFontFace(Descriptors{Family: "Web"}, []Source{
+		{URL: "https://example.com/go.svg", Format: "svg"},
+		{URL: "https://example.com/missing.ttf"},
+		{URL: "https://example.com/go.ttf"},
+	})
+	done, started := f.Load(fetch)
+	if !started {
+		t.Fatal("Load did not start loading")
+	}
+	<-done
+	if f.Status() != Loaded {
+		t.Fatalf("status = %v: %v", f.Status(), f.Err())
+	}
+	// The face takes its names from the descriptors
+	if face := f.Face(); face.Family != "Web" || !face.HasGlyph('a') {
+		t.Errorf("loaded face = %v", face)
+	}
+	if _, started := f.Load(fetch); started {
+		t.Error("a loaded face started loading again")
+	}
+	if fetched["https://example.com/go.svg"] != 0 || fetched["https://example.com/missing.ttf"] != 1 {
+		t.Errorf("fetched %v", fetched)
+	}
+
+	failed := NewFontFace(Descriptors{Family: "Web"}, []Source{{URL: "https://example.com/missing.ttf"}})
+	done, _ = failed.Load(fetch)
+	<-done
+	if failed.Status() != Error || failed.Err() == nil {
+		t.Errorf("status = %v, err = %v, want an error", failed.Status(), failed.Err())
+	}
+}
+
+func TestCollectionWebFonts(t *testing.T) {
+	fetch := func(url string) ([]byte, error) { return goregular.TTF, nil }
+	fonts := NewCollection()
+	fonts.SetFallback(Default)
+	fonts.SetFetcher(fetch)
+
+	sheet := css.NewParser(`
+		@font-face { font-family: Latin; src: url(latin.ttf); unicode-range: U+0-7F; }
+		@font-face { font-family: Latin; src: url(greek.ttf); unicode-range: U+370-3FF; }
+		@font-face { font-family: Latin; src: url(bold.ttf); font-weight: bold; }
+		@font-face { font-family: Broken; }
+		@font-face { src: url(nameless.ttf); }
+	`).Parse()
+	faces := FontFacesFromStylesheet(sheet, "https://example.com/style.css")
+	if len(faces) != 3 {
+		t.Fatalf("got %d faces, want 3", len(faces))
+	}
+	for _, f := range faces {
+		if !f.CSSConnected {
+			t.Error("a face from a stylesheet is not CSS-connected")
+		}
+		fonts.AddFontFace(f)
+	}
+
+	style := Style{Families: []string{"Latin", "sans-serif"}, Weight: 400}
+	if got := fonts.FontFacesFor(style, "abc"); len(got) != 1 || got[0] != faces[0] {
+		t.Errorf("FontFacesFor(abc) = %v, want the latin face", got)
+	}
+	if got := fonts.FontFacesFor(style, "aλ"); len(got) != 2 {
+		t.Errorf("FontFacesFor(aλ) = %d faces, want 2", len(got))
+	}
+
+	// Matching starts loading the faces it needs, and uses them once loaded
+	fonts.Shape([]rune("abc"), style, 16, false, "")
+	if faces[0].Status() == Unloaded || faces[1].Status() != Unloaded {
+		t.Fatalf("statuses after matching = %v, %v", faces[0].Status(), faces[1].Status())
+	}
+	fonts.WaitBlocking()
+	if faces[0].Status() != Loaded {
+		t.Fatalf("status after waiting = %v", faces[0].Status())
+	}
+	glyphs := fonts.Shape([]rune("abc"), style, 16, false, "")
+	if len(glyphs) != 3 || glyphs[0].Face != faces[0].Face() {
+		t.Errorf("text is not shaped with the web font")
+	}
+
+	if !fonts.DeleteFontFace(faces[2]) || fonts.DeleteFontFace(faces[2]) {
+		t.Error("DeleteFontFace did not remove the face exactly once")
+	}
+	if len(fonts.FontFaces()) != 2 {
+		t.Errorf("%d faces left, want 2", len(fonts.FontFaces()))
+	}
+}
@@ -0,0 +1,599 @@
+// Package font provides font faces, the CSS font matching algorithm and
+// text shaping.
+// This file implements WOFF and WOFF2 decoding, which unpacks web font
+// containers into the plain OpenType data they compress.
+// Reference: https://www.w3.org/TR/WOFF2/
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	woffSignature  = 0x774F4646 // wOFF
+	woff2Signature = 0x774F4632 // wOF2
+	ttcSignature   = 0x74746366 // ttcf
+)
+
+var errMalformed = errors.New("malformed web font")
+
+// decodeWebFont returns the OpenType data of a WOFF or WOFF2 file, or data
+// itself when it isn't wrapped.
+func decodeWebFont(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errMalformed
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case woffSignature:
+		return decodeWOFF(data)
+	case woff2Signature:
+		return decodeWOFF2(data)
+	}
+	return data, nil
+}
+
+// sfntTable is one table of an OpenType font.
+type sfntTable struct {
+	tag  uint32
+	data []byte
+}
+
+// buildSFNT assembles tables into an OpenType font with a table directory
+// sorted by tag, every table padded to four bytes.
+func buildSFNT(flavor uint32, tables []sfntTable) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+	n := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	size := 12 + 16*n
+	for _, t := range tables {
+		size += (len(t.data) + 3) &^ 3
+	}
+	out := make([]byte, 12+16*n, size)
+	be := binary.BigEndian
+	be.PutUint32(out[0:], flavor)
+	be.PutUint16(out[4:], uint16(n))
+	be.PutUint16(out[6:], uint16(searchRange))
+	be.PutUint16(out[8:], uint16(entrySelector))
+	be.PutUint16(out[10:], uint16(n*16-searchRange))
+	for i, t := range tables {
+		record := out[12+16*i:]
+		be.PutUint32(record[0:], t.tag)
+		be.PutUint32(record[4:], tableChecksum(t.data))
+		be.PutUint32(record[8:], uint32(len(out)))
+		be.PutUint32(record[12:], uint32(len(t.data)))
+		out = append(out, t.data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// tableChecksum sums a table as big-endian 32-bit words.
+func tableChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// decodeWOFF unpacks a WOFF 1.0 file, whose tables are each compressed
+// with zlib unless that doesn't make them smaller.
+// Reference: https://www.w3.org/TR/WOFF/
+func decodeWOFF(data []byte) ([]byte, error) {
+	if len(data) < 44 {
+		return nil, errMalformed
+	}
+	be := binary.BigEndian
+	flavor := be.Uint32(data[4:])
+	numTables := int(be.Uint16(data[12:]))
+	if len(data) < 44+20*numTables {
+		return nil, errMalformed
+	}
+	tables := make([]sfntTable, numTables)
+	for i := range tables {
+		entry := data[44+20*i:]
+		offset, compLength, origLength := be.Uint32(entry[4:]), be.Uint32(entry[8:]), be.Uint32(entry[12:])
+		if uint64(offset)+uint64(compLength) > uint64(len(data)) || compLength > origLength {
+			return nil, errMalformed
+		}
+		table := data[offset : offset+compLength]
+		if compLength < origLength {
+			r, err := zlib.NewReader(bytes.NewReader(table))
+			if err != nil {
+				return nil, err
+			}
+			table = make([]byte, origLength)
+			if _, err := io.ReadFull(r, table); err != nil {
+				return nil, err
+			}
+		}
+		tables[i] = sfntTable{tag: be.Uint32(entry), data: table}
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// woff2KnownTags are the tags a WOFF2 table directory refers to by index.
+var woff2KnownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post", "cvt ", "fpgm",
+	"glyf", "loca", "prep", "CFF ", "VORG", "EBDT", "EBLC", "gasp", "hdmx", "kern",
+	"LTSH", "PCLT", "VDMX", "vhea", "vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC",
+	"JSTF", "MATH", "CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar", "gvar", "hsty",
+	"just", "lcar", "mort", "morx", "opbd", "prop", "trak", "Zapf", "Silf", "Glat",
+	"Gloc", "Feat", "Sill",
+}
+
+func tagOf(s string) uint32 {
+	return binary.BigEndian.Uint32([]byte(s))
+}
+
+var (
+	tagGlyf = tagOf("glyf")
+	tagLoca = tagOf("loca")
+	tagHmtx = tagOf("hmtx")
+	tagHhea = tagOf("hhea")
+	tagMaxp = tagOf("maxp")
+)
+
+// woff2Entry is a table of the WOFF2 table directory.
+type woff2Entry struct {
+	tag         uint32
+	transformed bool
+	origLength  uint32
+	length      uint32 // length within the decompressed stream
+}
+
+// reader reads big-endian values, remembering the first read past its end.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		r.err = errMalformed
+		return make([]byte, max(n, 0))
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) u8() uint8   { return r.bytes(1)[0] }
+func (r *reader) u16() uint16 { return binary.BigEndian.Uint16(r.bytes(2)) }
+func (r *reader) u32() uint32 { return binary.BigEndian.Uint32(r.bytes(4)) }
+
+// base128 reads a UIntBase128 value.
+func (r *reader) base128() uint32 {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b := r.u8()
+		if (i == 0 && b == 0x80) || v&0xFE000000 != 0 {
+			r.err = errMalformed
+			return 0
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	r.err = errMalformed
+	return 0
+}
+
+// uint255 reads a 255UInt16 value.
+func (r *reader) uint255() uint16 {
+	switch code := r.u8(); code {
+	case 253:
+		return r.u16()
+	case 254:
+		return uint16(r.u8()) + 506
+	case 255:
+		return uint16(r.u8()) + 253
+	default:
+		return uint16(code)
+	}
+}
+
+// decodeWOFF2 unpacks a WOFF2 file: one Brotli stream holding every table,
+// with glyf, loca and hmtx possibly in their transformed forms.
+func decodeWOFF2(data []byte) ([]byte, error) {
+	r := &reader{data: data}
+	r.u32() // signature
+	flavor := r.u32()
+	r.u32() // length
+	numTables := int(r.u16())
+	r.u16() // reserved
+	r.u32() // totalSfntSize
+	compressedSize := r.u32()
+	r.bytes(24) // version, metadata and private data
+	if flavor == ttcSignature {
+		return nil, fmt.Errorf("WOFF2 font collections are not supported")
+	}
+
+	entries := make([]woff2Entry, numTables)
+	streamSize := uint64(0)
+	for i := range entries {
+		flags := r.u8()
+		e := &entries[i]
+		if index := flags & 0x3F; index == 63 {
+			e.tag = r.u32()
+		} else {
+			e.tag = tagOf(woff2KnownTags[index])
+		}
+		version := flags >> 6
+		e.origLength = r.base128()
+		e.length = e.origLength
+		if e.tag == tagGlyf || e.tag == tagLoca {
+			e.transformed = version == 0
+		} else {
+			e.transformed = version != 0
+		}
+		if e.transformed {
+			e.length = r.base128()
+		}
+		streamSize += uint64(e.length)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	compressed := r.bytes(int(compressedSize))
+	if r.err != nil {
+		return nil, r.err
+	}
+	stream, err := io.ReadAll(io.LimitReader(brotli.NewReader(bytes.NewReader(compressed)), int64(streamSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(stream)) != streamSize {
+		return nil, errMalformed
+	}
+
+	tables := make([]sfntTable, 0, numTables)
+	byTag := map[uint32]int{}
+	var glyf, hmtx *woff2Entry
+	var glyfData, hmtxData []byte
+	pos := uint32(0)
+	for i := range entries {
+		e := &entries[i]
+		table := stream[pos : pos+e.length]
+		pos += e.length
+		switch {
+		case e.tag == tagGlyf && e.transformed:
+			glyf, glyfData = e, table
+		case e.tag == tagHmtx && e.transformed:
+			hmtx, hmtxData = e, table
+		}
+		byTag[e.tag] = len(tables)
+		tables = append(tables, sfntTable{tag: e.tag, data: table})
+	}
+
+	var xMins []int16
+	if glyf != nil {
+		if _, ok := byTag[tagLoca]; !ok {
+			return nil, errMalformed
+		}
+		g, loca, mins, err := reconstructGlyf(glyfData)
+		if err != nil {
+			return nil, err
+		}
+		tables[byTag[tagGlyf]].data = g
+		tables[byTag[tagLoca]].data = loca
+		xMins = mins
+	}
+	if hmtx != nil {
+		hhea, okHhea := byTag[tagHhea]
+		maxp, okMaxp := byTag[tagMaxp]
+		if !okHhea || !okMaxp || xMins == nil {
+			return nil, errMalformed
+		}
+		h, err := reconstructHmtx(hmtxData, tables[hhea].data, tables[maxp].data, xMins)
+		if err != nil {
+			return nil, err
+		}
+		tables[byTag[tagHmtx]].data = h
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// Composite glyph flags that determine the size of a component.
+const (
+	argsAreWords     = 0x0001
+	haveScale        = 0x0008
+	moreComponents   = 0x0020
+	haveXYScale      = 0x0040
+	haveTwoByTwo     = 0x0080
+	haveInstructions = 0x0100
+)
+
+// reconstructGlyf rebuilds the glyf and loca tables from a transformed
+// glyf table. It also returns the xMin of every glyph, which stands in for
+// the left side bearings a transformed hmtx table omits.
+func reconstructGlyf(data []byte) (glyf, loca []byte, xMins []int16, err error) {
+	r := &reader{data: data}
+	r.u16() // version
+	optionFlags := r.u16()
+	numGlyphs := int(r.u16())
+	indexFormat := r.u16()
+	var sizes [7]uint32
+	for i := range sizes {
+		sizes[i] = r.u32()
+	}
+	var streams [7]*reader
+	for i, size := range sizes {
+		streams[i] = &reader{data: r.bytes(int(size))}
+	}
+	var overlap []byte
+	if optionFlags&1 != 0 {
+		overlap = r.bytes((numGlyphs + 7) / 8)
+	}
+	if r.err != nil {
+		return nil, nil, nil, r.err
+	}
+	contours, points, flags, glyphs, composites, bboxes, instructions := streams[0], streams[1], streams[2], streams[3], streams[4], streams[5], streams[6]
+	bboxBitmap := bboxes.bytes(4 * ((numGlyphs + 31) / 32))
+
+	be := binary.BigEndian
+	offsets := make([]uint32, numGlyphs+1)
+	xMins = make([]int16, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		offsets[i] = uint32(len(glyf))
+		nContours := int16(contours.u16())
+		explicitBBox := bboxBitmap[i/8]&(0x80>>(i%8)) != 0
+		var bbox [4]int16
+		if explicitBBox {
+			for k := range bbox {
+				bbox[k] = int16(bboxes.u16())
+			}
+		}
+		switch {
+		case nContours == 0:
+			if explicitBBox {
+				return nil, nil, nil, errMalformed
+			}
+		case nContours < 0:
+			if !explicitBBox {
+				return nil, nil, nil, errMalformed
+			}
+			start := composites.pos
+			hasInstructions := false
+			for more := true; more; {
+				f := composites.u16()
+				size := 4 // glyph index and byte arguments
+				if f&argsAreWords != 0 {
+					size = 6
+				}
+				switch {
+				case f&haveScale != 0:
+					size += 2
+				case f&haveXYScale != 0:
+					size += 4
+				case f&haveTwoByTwo != 0:
+					size += 8
+				}
+				composites.bytes(size)
+				hasInstructions = hasInstructions || f&haveInstructions != 0
+				more = f&moreComponents != 0
+			}
+			glyf = appendGlyphHeader(glyf, nContours, bbox)
+			glyf = append(glyf, composites.data[start:composites.pos]...)
+			if hasInstructions {
+				n := glyphs.uint255()
+				glyf = be.AppendUint16(glyf, n)
+				glyf = append(glyf, instructions.bytes(int(n))...)
+			}
+		default:
+			endPoints := make([]uint16, nContours)
+			total := 0
+			for k := range endPoints {
+				total += int(points.uint255())
+				endPoints[k] = uint16(total - 1)
+			}
+			xs, ys := make([]int16, total), make([]int16, total)
+			onCurve := make([]bool, total)
+			x, y := 0, 0
+			for k := 0; k < total; k++ {
+				flag := flags.u8()
+				dx, dy := decodeTriplet(flag&0x7F, glyphs)
+				x, y = x+dx, y+dy
+				xs[k], ys[k], onCurve[k] = int16(x), int16(y), flag&0x80 == 0
+			}
+			if !explicitBBox && total > 0 {
+				bbox = [4]int16{xs[0], ys[0], xs[0], ys[0]}
+				for k := range xs {
+					bbox[0], bbox[1] = min(bbox[0], xs[k]), min(bbox[1], ys[k])
+					bbox[2], bbox[3] = max(bbox[2], xs[k]), max(bbox[3], ys[k])
+				}
+			}
+			n := glyphs.uint255()
+			glyf = appendGlyphHeader(glyf, nContours, bbox)
+			for _, end := range endPoints {
+				glyf = be.AppendUint16(glyf, end)
+			}
+			glyf = be.AppendUint16(glyf, n)
+			glyf = append(glyf, instructions.bytes(int(n))...)
+			overlapping := overlap != nil && overlap[i/8]&(0x80>>(i%8)) != 0
+			glyf = appendSimpleGlyph(glyf, xs, ys, onCurve, overlapping)
+		}
+		xMins[i] = bbox[0]
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+		for _, s := range []*reader{contours, points, flags, glyphs, composites, bboxes, instructions} {
+			if s.err != nil {
+				return nil, nil, nil, s.err
+			}
+		}
+	}
+	offsets[numGlyphs] = uint32(len(glyf))
+
+	for _, off := range offsets {
+		if indexFormat == 0 {
+			loca = be.AppendUint16(loca, uint16(off/2))
+		} else {
+			loca = be.AppendUint32(loca, off)
+		}
+	}
+	return glyf, loca, xMins, nil
+}
+
+// decodeTriplet reads the coordinate deltas a point flag of the
+// transformed glyf table encodes.
+func decodeTriplet(flag uint8, r *reader) (dx, dy int) {
+	withSign := func(flag uint8, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	f := int(flag)
+	switch {
+	case flag < 10:
+		b := r.bytes(1)
+		return 0, withSign(flag, (f&14)<<7+int(b[0]))
+	case flag < 20:
+		b := r.bytes(1)
+		return withSign(flag, ((f-10)&14)<<7+int(b[0])), 0
+	case flag < 84:
+		b0, b1 := f-20, int(r.bytes(1)[0])
+		return withSign(flag, 1+(b0&0x30)+b1>>4), withSign(flag>>1, 1+(b0&0x0C)<<2+b1&0x0F)
+	case flag < 120:
+		b := r.bytes(2)
+		b0 := f - 84
+		return withSign(flag, 1+(b0/12)<<8+int(b[0])), withSign(flag>>1, 1+((b0%12)>>2)<<8+int(b[1]))
+	case flag < 124:
+		b := r.bytes(3)
+		return withSign(flag, int(b[0])<<4+int(b[1])>>4), withSign(flag>>1, int(b[1]&0x0F)<<8+int(b[2]))
+	default:
+		b := r.bytes(4)
+		return withSign(flag, int(b[0])<<8+int(b[1])), withSign(flag>>1, int(b[2])<<8+int(b[3]))
+	}
+}
+
+// appendGlyphHeader appends the contour count and bounding box of a glyph.
+func appendGlyphHeader(glyf []byte, nContours int16, bbox [4]int16) []byte {
+	glyf = binary.BigEndian.AppendUint16(glyf, uint16(nContours))
+	for _, v := range bbox {
+		glyf = binary.BigEndian.AppendUint16(glyf, uint16(v))
+	}
+	return glyf
+}
+
+// Simple glyph flags.
+const (
+	onCurvePoint    = 0x01
+	xShortVector    = 0x02
+	yShortVector    = 0x04
+	xSameOrPositive = 0x10
+	ySameOrPositive = 0x20
+	overlapSimple   = 0x40
+)
+
+// appendSimpleGlyph appends the flags and coordinates of a simple glyph,
+// storing each delta in its shortest form.
+func appendSimpleGlyph(glyf []byte, xs, ys []int16, onCurve []bool, overlapping bool) []byte {
+	var xData, yData []byte
+	lastX, lastY := int16(0), int16(0)
+	for k := range xs {
+		var flag byte
+		if onCurve[k] {
+			flag |= onCurvePoint
+		}
+		if k == 0 && overlapping {
+			flag |= overlapSimple
+		}
+		dx, dy := int(xs[k])-int(lastX), int(ys[k])-int(lastY)
+		lastX, lastY = xs[k], ys[k]
+		switch {
+		case dx == 0:
+			flag |= xSameOrPositive
+		case dx >= -255 && dx <= 255:
+			flag |= xShortVector
+			if dx > 0 {
+				flag |= xSameOrPositive
+			}
+			xData = append(xData, byte(abs(dx)))
+		default:
+			xData = binary.BigEndian.AppendUint16(xData, uint16(int16(dx)))
+		}
+		switch {
+		case dy == 0:
+			flag |= ySameOrPositive
+		case dy >= -255 && dy <= 255:
+			flag |= yShortVector
+			if dy > 0 {
+				flag |= ySameOrPositive
+			}
+			yData = append(yData, byte(abs(dy)))
+		default:
+			yData = binary.BigEndian.AppendUint16(yData, uint16(int16(dy)))
+		}
+		glyf = append(glyf, flag)
+	}
+	glyf = append(glyf, xData...)
+	return append(glyf, yData...)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// reconstructHmtx rebuilds a transformed hmtx table, whose omitted left
+// side bearings equal the xMin of each glyph.
+func reconstructHmtx(data, hhea, maxp []byte, xMins []int16) ([]byte, error) {
+	if len(hhea) < 36 || len(maxp) < 6 {
+		return nil, errMalformed
+	}
+	numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	if numHMetrics > numGlyphs || numGlyphs > len(xMins) {
+		return nil, errMalformed
+	}
+	r := &reader{data: data}
+	flags := r.u8()
+	advances := make([]uint16, numHMetrics)
+	for i := range advances {
+		advances[i] = r.u16()
+	}
+	lsbs := make([]int16, numGlyphs)
+	for i := range lsbs {
+		proportional := i < numHMetrics
+		if (proportional && flags&1 != 0) || (!proportional && flags&2 != 0) {
+			lsbs[i] = xMins[i]
+		} else {
+			lsbs[i] = int16(r.u16())
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	var out []byte
+	for i, lsb := range lsbs {
+		if i < numHMetrics {
+			out = binary.BigEndian.AppendUint16(out, advances[i])
+		}
+		out = binary.BigEndian.AppendUint16(out, uint16(lsb))
+	}
+	return out, nil
+}
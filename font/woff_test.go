@@ -0,0 +1,171 @@
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// sfntTables splits an OpenType font into its tables.
+func sfntTables(t *testing.T, data []byte) []sfntTable {
+	t.Helper()
+	be := binary.BigEndian
+	n := int(be.Uint16(data[4:]))
+	tables := make([]sfntTable, n)
+	for i := range tables {
+		record := data[12+16*i:]
+		offset, length := be.Uint32(record[8:]), be.Uint32(record[12:])
+		tables[i] = sfntTable{tag: be.Uint32(record), data: data[offset : offset+length]}
+	}
+	return tables
+}
+
+// encodeWOFF packs an OpenType font into a WOFF file.
+func encodeWOFF(t *testing.T, data []byte) []byte {
+	tables := sfntTables(t, data)
+	be := binary.BigEndian
+	out := make([]byte, 44+20*len(tables))
+	copy(out, "wOFF")
+	copy(out[4:], data[:4])
+	be.PutUint16(out[12:], uint16(len(tables)))
+	for i, table := range tables {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(table.data)
+		w.Close()
+		stored := compressed.Bytes()
+		if len(stored) >= len(table.data) {
+			stored = table.data
+		}
+		entry := out[44+20*i:]
+		be.PutUint32(entry, table.tag)
+		be.PutUint32(entry[4:], uint32(len(out)))
+		be.PutUint32(entry[8:], uint32(len(stored)))
+		be.PutUint32(entry[12:], uint32(len(table.data)))
+		out = append(out, stored...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	be.PutUint32(out[8:], uint32(len(out)))
+	return out
+}
+
+// encodeWOFF2 packs an OpenType font into a WOFF2 file without
+// transforming any table.
+func encodeWOFF2(t *testing.T, data []byte) []byte {
+	tables := sfntTables(t, data)
+	be := binary.BigEndian
+	var dir, stream bytes.Buffer
+	for _, table := range tables {
+		// The null transform of glyf and loca is version 3
+		flags := byte(63)
+		if table.tag == tagGlyf || table.tag == tagLoca {
+			flags |= 3 << 6
+		}
+		dir.WriteByte(flags)
+		binary.Write(&dir, binary.BigEndian, table.tag)
+		dir.Write(base128(uint32(len(table.data))))
+		stream.Write(table.data)
+	}
+	var compressed bytes.Buffer
+	w := brotli.NewWriter(&compressed)
+	w.Write(stream.Bytes())
+	w.Close()
+
+	out := make([]byte, 48)
+	copy(out, "wOF2")
+	copy(out[4:], data[:4])
+	be.PutUint16(out[12:], uint16(len(tables)))
+	be.PutUint32(out[20:], uint32(compressed.Len()))
+	out = append(out, dir.Bytes()...)
+	out = append(out, compressed.Bytes()...)
+	be.PutUint32(out[8:], uint32(len(out)))
+	return out
+}
+
+// base128 encodes a UIntBase128 value.
+func base128(v uint32) []byte {
+	out := []byte{byte(v & 0x7F)}
+	for v >>= 7; v > 0; v >>= 7 {
+		out = append([]byte{byte(v&0x7F) | 0x80}, out...)
+	}
+	return out
+}
+
+func TestDecodeWebFont(t *testing.T) {
+	want := sfntTables(t, goregular.TTF)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"woff", encodeWOFF(t, goregular.TTF)},
+		{"woff2", encodeWOFF2(t, goregular.TTF)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sfnt, err := decodeWebFont(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := sfntTables(t, sfnt)
+			if len(got) != len(want) {
+				t.Fatalf("got %d tables, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].tag != want[i].tag || !bytes.Equal(got[i].data, want[i].data) {
+					t.Errorf("table %d differs", i)
+				}
+			}
+
+			face, err := Parse(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if face.Family != "Go" || !face.HasGlyph('g') {
+				t.Errorf("parsed face %v lacks the Go glyphs", face)
+			}
+		})
+	}
+}
+
+func TestDecodeWebFontErrors(t *testing.T) {
+	woff2 := encodeWOFF2(t, goregular.TTF)
+	truncated := map[string][]byte{
+		"woff header":  encodeWOFF(t, goregular.TTF)[:40],
+		"woff tables":  encodeWOFF(t, goregular.TTF)[:200],
+		"woff2 stream": woff2[:len(woff2)-100],
+	}
+	for name, data := range truncated {
+		if _, err := decodeWebFont(data); err == nil {
+			t.Errorf("%s: truncated font decoded without error", name)
+		}
+	}
+}
+
+func TestDecodeTriplet(t *testing.T) {
+	tests := []struct {
+		flag   uint8
+		data   []byte
+		dx, dy int
+	}{
+		{0, []byte{5}, 0, -5},
+		{1, []byte{5}, 0, 5},
+		{10, []byte{5}, -5, 0},
+		{20, []byte{0x12}, -2, -3},
+		{84, []byte{5, 6}, -6, -7},
+		{120, []byte{0x12, 0x34, 0x56}, -0x123, -0x456},
+		{124, []byte{0x01, 0x00, 0x02, 0x00}, -256, -512},
+		{127, []byte{0x01, 0x00, 0x02, 0x00}, 256, 512},
+	}
+	for _, tt := range tests {
+		dx, dy := decodeTriplet(tt.flag, &reader{data: tt.data})
+		if dx != tt.dx || dy != tt.dy {
+			t.Errorf("decodeTriplet(%d, % x) = %d, %d, want %d, %d", tt.flag, tt.data, dx, dy, tt.dx, tt.dy)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the agent that runs the event loop of a page on a
+// goroutine of its own.
+package js
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// Agent runs the event loop of a runtime on a goroutine of its own. Once it
+// started, the runtime's scripts run only there, one task at a time: other
+// goroutines, such as those of network responses and user input, queue
+// tasks for it with Post. Between tasks it paints the page at rendering
+// opportunities, runs idle callbacks in idle periods, and otherwise sleeps
+// until there is work.
+// Reference: https://html.spec.whatwg.org/multipage/webappapis.html#agents
+type Agent struct {
+	runtime *Runtime
+
+	mu          sync.Mutex
+	document    *dom.Document // Document whose mutations request rendering, or nil
+	invalidator *renderingInvalidator
+
+	start sync.Once
+	stop  sync.Once
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+// NewAgent creates an agent for a runtime. Until Start is called, the
+// runtime can be used from the creating goroutine as before.
+func NewAgent(runtime *Runtime) *Agent {
+	return &Agent{
+		runtime: runtime,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start starts the agent's goroutine.
+func (a *Agent) Start() {
+	a.start.Do(func() {
+		go a.run()
+	})
+}
+
+// Stop stops the agent once the task it is running, if any, ends. Tasks
+// still queued never run. It does not wait for the goroutine to exit, so
+// it may be called from a task; Done reports when it did.
+func (a *Agent) Stop() {
+	a.stop.Do(func() {
+		close(a.quit)
+		a.mu.Lock()
+		if a.document != nil {
+			dom.UnregisterMutationCallback(a.document, a.invalidator)
+			a.document = nil
+		}
+		a.mu.Unlock()
+	})
+}
+
+// Done returns a channel that is closed when the agent's goroutine exited.
+func (a *Agent) Done() <-chan struct{} {
+	return a.done
+}
+
+// Post queues a function to run as a task of a task source on the agent's
+// goroutine. It is safe to call from any goroutine.
+func (a *Agent) Post(source TaskSource, fn func()) {
+	a.runtime.eventLoop.queueTask(source, fn)
+}
+
+// SetRenderer sets the function that lays out and paints the page at
+// rendering opportunities after rendering was requested. It runs on the
+// agent's goroutine, after the animation frame callbacks.
+func (a *Agent) SetRenderer(renderer func()) {
+	a.runtime.eventLoop.setRenderer(renderer)
+}
+
+// RequestRendering asks for the page to be painted at the next rendering
+// opportunity. It is safe to call from any goroutine, and requests made
+// before a frame is rendered are painted together.
+func (a *Agent) RequestRendering() {
+	a.runtime.eventLoop.requestRendering()
+}
+
+// ObserveDocument makes mutations of a document request rendering.
+func (a *Agent) ObserveDocument(doc *dom.Document) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.document != nil {
+		dom.UnregisterMutationCallback(a.document, a.invalidator)
+	}
+	a.document = doc
+	a.invalidator = &renderingInvalidator{agent: a}
+	dom.RegisterMutationCallback(doc, a.invalidator)
+}
+
+// run processes the event loop until the agent is stopped.
+func (a *Agent) run() {
+	defer close(a.done)
+	el := a.runtime.eventLoop
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-a.quit:
+			return
+		default:
+		}
+		if el.step(a.runtime) {
+			continue
+		}
+
+		// Sleep until work is queued or the event loop has some due
+		var wakeup <-chan time.Time
+		if wait, ok := el.nextWakeup(a.runtime, time.Now()); ok {
+			timer.Reset(wait)
+			wakeup = timer.C
+		}
+		select {
+		case <-a.quit:
+			return
+		case <-el.wake:
+		case <-wakeup:
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+	}
+}
+
+// renderingInvalidator requests rendering whenever the document it is
+// registered for mutates.
+type renderingInvalidator struct {
+	agent *Agent
+}
+
+// OnChildListMutation implements dom.MutationCallback.
+func (ri *renderingInvalidator) OnChildListMutation(target *dom.Node, addedNodes, removedNodes []*dom.Node, previousSibling, nextSibling *dom.Node) {
+	ri.agent.RequestRendering()
+}
+
+// OnAttributeMutation implements dom.MutationCallback.
+func (ri *renderingInvalidator) OnAttributeMutation(target *dom.Node, attributeName, attributeNamespace, oldValue string) {
+	ri.agent.RequestRendering()
+}
+
+// OnCharacterDataMutation implements dom.MutationCallback.
+func (ri *renderingInvalidator) OnCharacterDataMutation(target *dom.Node, oldValue string) {
+	ri.agent.RequestRendering()
+}
+
+// OnReplaceData implements dom.MutationCallback.
+func (ri *renderingInvalidator) OnReplaceData(target *dom.Node, offset, count int, data string) {
+	ri.agent.RequestRendering()
+}
+
+// OnSplitText implements dom.MutationCallback.
+func (ri *renderingInvalidator) OnSplitText(oldNode *dom.Node, splitOffset int, newNode *dom.Node) {
+	ri.agent.RequestRendering()
+}
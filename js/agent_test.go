@@ -0,0 +1,205 @@
+package js
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// evaluate runs a script on an agent's goroutine and returns its result as
+// a string.
+func evaluate(t *testing.T, agent *Agent, script string) string {
+	t.Helper()
+	result := make(chan string, 1)
+	agent.Post(TaskSourceDOMManipulation, func() {
+		v, err := agent.runtime.Execute(script)
+		if err != nil {
+			result <- "error: " + err.Error()
+			return
+		}
+		result <- v.String()
+	})
+	select {
+	case r := <-result:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatalf("agent did not run %q", script)
+		return ""
+	}
+}
+
+// waitOnAgent evaluates a condition on an agent until it is true.
+func waitOnAgent(t *testing.T, agent *Agent, condition string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for evaluate(t, agent, condition) != "true" {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", condition)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAgentSerializesPostedWork(t *testing.T) {
+	runtime := NewRuntime()
+	if _, err := runtime.Execute(`var log = [];`); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent(runtime)
+	agent.Start()
+	defer agent.Stop()
+
+	// Goroutines of network responses and user input post at once
+	log := runtime.VM().Get("log").ToObject(runtime.VM())
+	push, _ := goja.AssertFunction(log.Get("push"))
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		source := TaskSourceNetworking
+		if i%2 == 1 {
+			source = TaskSourceUserInteraction
+		}
+		go func() {
+			defer wg.Done()
+			agent.Post(source, func() {
+				push(log, runtime.VM().ToValue(source.String()))
+			})
+		}()
+	}
+	wg.Wait()
+	waitOnAgent(t, agent, `log.length == 50`)
+
+	// Timers wake the agent, and each task is followed by a microtask
+	// checkpoint
+	evaluate(t, agent, `
+		log = [];
+		setTimeout(function() { log.push("timeout 1"); queueMicrotask(function() { log.push("microtask"); }); }, 5);
+		setTimeout(function() { log.push("timeout 2"); }, 5);
+	`)
+	waitOnAgent(t, agent, `log.length == 3`)
+	if got := evaluate(t, agent, `log.join()`); got != "timeout 1,microtask,timeout 2" {
+		t.Errorf("log = %s", got)
+	}
+
+	agent.Stop()
+	select {
+	case <-agent.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("agent did not stop")
+	}
+}
+
+func TestAgentRendering(t *testing.T) {
+	runtime := NewRuntime()
+	agent := NewAgent(runtime)
+	var mu sync.Mutex
+	renders := 0
+	agent.SetRenderer(func() {
+		mu.Lock()
+		renders++
+		mu.Unlock()
+		runtime.VM().Get("log").ToObject(runtime.VM()).Set("rendered", true)
+	})
+	agent.Start()
+	defer agent.Stop()
+
+	// Animation frame callbacks of one frame share its timestamp and run
+	// before the page is painted; those they request wait for the next one
+	evaluate(t, agent, `
+		var log = [];
+		var cancelled = requestAnimationFrame(function() { log.push("cancelled"); });
+		requestAnimationFrame(function(ts) {
+			log.push("first " + (log.rendered === undefined));
+			log.ts = ts;
+			requestAnimationFrame(function(ts) { log.push("next " + (ts > log.ts)); });
+		});
+		requestAnimationFrame(function(ts) { log.push("second " + (ts === log.ts)); });
+		cancelAnimationFrame(cancelled);
+	`)
+	waitOnAgent(t, agent, `log.length == 3`)
+	if got := evaluate(t, agent, `log.join()`); got != "first true,second true,next true" {
+		t.Errorf("log = %s", got)
+	}
+
+	// Requests for rendering from other goroutines paint the page once
+	mu.Lock()
+	renders = 0
+	mu.Unlock()
+	for i := 0; i < 3; i++ {
+		agent.RequestRendering()
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if renders != 1 {
+		t.Errorf("page painted %d times, want 1", renders)
+	}
+	mu.Unlock()
+}
+
+func TestIdleCallbacks(t *testing.T) {
+	runtime := NewRuntime()
+	agent := NewAgent(runtime)
+	agent.Start()
+	defer agent.Stop()
+
+	evaluate(t, agent, `
+		var log = [];
+		var cancelled = requestIdleCallback(function() { log.push("cancelled"); });
+		requestIdleCallback(function(deadline) {
+			log.push("idle " + (deadline.timeRemaining() > 0) + " " + deadline.didTimeout);
+		});
+		cancelIdleCallback(cancelled);
+	`)
+	waitOnAgent(t, agent, `log.length == 1`)
+	if got := evaluate(t, agent, `log.join()`); got != "idle true false" {
+		t.Errorf("log = %s", got)
+	}
+}
+
+func TestIdleCallbackTimeout(t *testing.T) {
+	// A busy event loop never becomes idle, so the callback runs once its
+	// timeout passed
+	r := NewRuntime()
+	if _, err := r.Execute(`
+		var log = [];
+		requestIdleCallback(function(deadline) {
+			log.push(deadline.didTimeout + " " + deadline.timeRemaining());
+		}, { timeout: 10 });
+		var id = setInterval(function() {}, 4);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r.eventLoop.queueTask(TaskSourceDOMManipulation, func() {})
+		r.RunEventLoop()
+		if v, _ := r.Execute(`log.length`); v.ToInteger() == 1 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if v, _ := r.Execute(`log.join()`); v.String() != "true 0" {
+		t.Errorf("log = %s", v)
+	}
+}
+
+func TestUserInteractionTasksRunFirst(t *testing.T) {
+	executor := NewScriptExecutor(NewRuntime())
+	var order []string
+	executor.QueueTask(TaskSourceNetworking, func() { order = append(order, "networking 1") })
+	executor.QueueTask(TaskSourceDOMManipulation, func() { order = append(order, "DOM manipulation") })
+	executor.QueueTask(TaskSourceUserInteraction, func() { order = append(order, "user interaction") })
+	executor.QueueTask(TaskSourceNetworking, func() { order = append(order, "networking 2") })
+	executor.RunEventLoop()
+
+	want := []string{"user interaction", "networking 1", "DOM manipulation", "networking 2"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+}
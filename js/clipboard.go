@@ -0,0 +1,180 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements copying to the clipboard: the copy event, which lets
+// the page replace what is copied through its clipboardData, and the
+// DataTransfer objects holding that data.
+// Reference: https://w3c.github.io/clipboard-apis/#clipboard-event-copy
+package js
+
+import (
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ClipboardData is what is copied to the clipboard, in the formats it was
+// given in.
+type ClipboardData struct {
+	Text string // text/plain
+	HTML string // text/html
+}
+
+// Copy fires a copy event at the focused element, or the body if nothing
+// has focus, and returns what is to be copied: the text of the selection
+// and its HTML, or if the page canceled the event the data it set on the
+// clipboardData of the event. It returns false if there is nothing to copy.
+// Reference: https://w3c.github.io/clipboard-apis/#fire-a-clipboard-event
+func (se *ScriptExecutor) Copy() (ClipboardData, bool) {
+	doc := se.currentDocument
+	if doc == nil {
+		return ClipboardData{}, false
+	}
+	vm := se.runtime.vm
+	data := &dataTransfer{}
+	if target := se.keyTarget(); target != nil {
+		ctor, ok := goja.AssertConstructor(vm.Get("ClipboardEvent"))
+		if !ok {
+			return ClipboardData{}, false
+		}
+		options := vm.NewObject()
+		options.Set("bubbles", true)
+		options.Set("cancelable", true)
+		options.Set("composed", true)
+		options.Set("clipboardData", se.eventBinder.bindDataTransfer(data))
+		event, err := ctor(nil, vm.ToValue("copy"), options)
+		if err != nil {
+			return ClipboardData{}, false
+		}
+		if !se.eventBinder.DispatchTrustedEvent(se.domBinder.BindElement(target), event) {
+			text, hasText := data.get("text/plain")
+			html, hasHTML := data.get("text/html")
+			return ClipboardData{Text: text, HTML: html}, hasText || hasHTML
+		}
+	}
+
+	sel := doc.GetSelection()
+	if sel.IsCollapsed() {
+		return ClipboardData{}, false
+	}
+	return ClipboardData{Text: sel.ToString(), HTML: sel.ToHTML()}, true
+}
+
+// dataTransfer is the data store of a DataTransfer: data in formats such
+// as text/plain, listed in the order they were first set.
+// Reference: https://html.spec.whatwg.org/multipage/dnd.html#the-drag-data-store
+type dataTransfer struct {
+	formats []string
+	data    map[string]string
+}
+
+// normalizeFormat lowercases a format and maps the legacy text and url
+// formats to their MIME types.
+func normalizeFormat(format string) string {
+	format = strings.ToLower(format)
+	switch format {
+	case "text":
+		return "text/plain"
+	case "url":
+		return "text/uri-list"
+	}
+	return format
+}
+
+// get returns the data set in a format.
+func (dt *dataTransfer) get(format string) (string, bool) {
+	data, ok := dt.data[normalizeFormat(format)]
+	return data, ok
+}
+
+// set sets the data of a format.
+func (dt *dataTransfer) set(format, data string) {
+	format = normalizeFormat(format)
+	if dt.data == nil {
+		dt.data = make(map[string]string)
+	}
+	if _, ok := dt.data[format]; !ok {
+		dt.formats = append(dt.formats, format)
+	}
+	dt.data[format] = data
+}
+
+// clear removes the data of a format, or of all formats for an empty one.
+func (dt *dataTransfer) clear(format string) {
+	if format == "" {
+		dt.formats, dt.data = nil, nil
+		return
+	}
+	format = normalizeFormat(format)
+	if _, ok := dt.data[format]; !ok {
+		return
+	}
+	delete(dt.data, format)
+	for i, f := range dt.formats {
+		if f == format {
+			dt.formats = append(dt.formats[:i], dt.formats[i+1:]...)
+			break
+		}
+	}
+}
+
+// setupDataTransfer sets up the DataTransfer constructor, which creates
+// empty DataTransfer objects.
+func (eb *EventBinder) setupDataTransfer() {
+	vm := eb.runtime.vm
+	proto := vm.NewObject()
+	ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		return eb.bindDataTransfer(&dataTransfer{})
+	}).ToObject(vm)
+	ctor.Set("prototype", proto)
+	proto.Set("constructor", ctor)
+	eb.mu.Lock()
+	eb.dataTransferProto = proto
+	eb.mu.Unlock()
+	vm.Set("DataTransfer", ctor)
+}
+
+// bindDataTransfer creates a DataTransfer object over a data store.
+// Reference: https://html.spec.whatwg.org/multipage/dnd.html#the-datatransfer-interface
+func (eb *EventBinder) bindDataTransfer(dt *dataTransfer) *goja.Object {
+	vm := eb.runtime.vm
+	obj := vm.NewObject()
+	eb.mu.RLock()
+	if eb.dataTransferProto != nil {
+		obj.SetPrototype(eb.dataTransferProto)
+	}
+	eb.mu.RUnlock()
+
+	obj.Set("dropEffect", "none")
+	obj.Set("effectAllowed", "uninitialized")
+	obj.Set("files", vm.NewArray())
+	obj.DefineAccessorProperty("types", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		types := make([]interface{}, len(dt.formats))
+		for i, format := range dt.formats {
+			types[i] = format
+		}
+		return vm.NewArray(types...)
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	obj.Set("getData", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			panic(vm.NewTypeError("Failed to execute 'getData' on 'DataTransfer': 1 argument required, but only 0 present."))
+		}
+		data, _ := dt.get(call.Arguments[0].String())
+		return vm.ToValue(data)
+	})
+	obj.Set("setData", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("Failed to execute 'setData' on 'DataTransfer': 2 arguments required, but only %d present.", len(call.Arguments)))
+		}
+		dt.set(call.Arguments[0].String(), call.Arguments[1].String())
+		return goja.Undefined()
+	})
+	obj.Set("clearData", func(call goja.FunctionCall) goja.Value {
+		format := ""
+		if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
+			format = call.Arguments[0].String()
+		}
+		dt.clear(format)
+		return goja.Undefined()
+	})
+	return obj
+}
@@ -0,0 +1,96 @@
+package js
+
+import (
+	"testing"
+)
+
+func TestCopySelection(t *testing.T) {
+	executor, doc, text, _ := newSelectionTestExecutor(t)
+	if _, ok := executor.Copy(); ok {
+		t.Error("Copy without a selection copied something")
+	}
+
+	if err := doc.GetSelection().SetBaseAndExtent(text, 0, text, 5); err != nil {
+		t.Fatal(err)
+	}
+	_, err := executor.Runtime().Execute(`
+		var copied = [];
+		document.addEventListener("copy", function(e) {
+			copied.push(e.type + "@" + e.target.nodeName + ":" + (e.clipboardData instanceof DataTransfer) + ":" + e.isTrusted);
+		});
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := executor.Copy()
+	if !ok || data.Text != "Hello" || data.HTML != "Hello" {
+		t.Errorf("Copy() = %+v, %v, want Hello", data, ok)
+	}
+	v, err := executor.Runtime().Execute(`copied.join(" ")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "copy@BODY:true:true" {
+		t.Errorf("copy events = %q", got)
+	}
+}
+
+func TestCanceledCopy(t *testing.T) {
+	executor, doc, text, _ := newSelectionTestExecutor(t)
+	if err := doc.GetSelection().SetBaseAndExtent(text, 0, text, 5); err != nil {
+		t.Fatal(err)
+	}
+	_, err := executor.Runtime().Execute(`
+		var types;
+		document.addEventListener("copy", function(e) {
+			e.clipboardData.setData("Text", "replaced");
+			e.clipboardData.setData("text/html", "<i>replaced</i>");
+			e.clipboardData.setData("text/x-custom", "custom");
+			e.clipboardData.clearData("text/x-custom");
+			types = e.clipboardData.types.join(",") + ":" + e.clipboardData.getData("text/plain");
+			e.preventDefault();
+		});
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, ok := executor.Copy()
+	if !ok || data.Text != "replaced" || data.HTML != "<i>replaced</i>" {
+		t.Errorf("Copy() = %+v, %v, want the data the page set", data, ok)
+	}
+	v, err := executor.Runtime().Execute(`types`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "text/plain,text/html:replaced" {
+		t.Errorf("types = %q", got)
+	}
+
+	// A page canceling the event without setting data copies nothing
+	_, err = executor.Runtime().Execute(`
+		document.addEventListener("copy", function(e) { e.stopImmediatePropagation(); e.preventDefault(); }, true);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := executor.Copy(); ok {
+		t.Errorf("Copy() = %+v, want nothing copied", data)
+	}
+}
+
+func TestClipboardEventConstructor(t *testing.T) {
+	executor, _, _, _ := newSelectionTestExecutor(t)
+	v, err := executor.Runtime().Execute(`
+		var dt = new DataTransfer();
+		dt.setData("text/plain", "x");
+		var e = new ClipboardEvent("paste", {clipboardData: dt, bubbles: true});
+		[e instanceof Event, e.bubbles, e.clipboardData.getData("text"),
+		 new ClipboardEvent("cut").clipboardData].join(",");
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "true,true,x," {
+		t.Errorf("got %q", got)
+	}
+}
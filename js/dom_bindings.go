@@ -345,6 +345,11 @@ type DOMBinder struct {
 	// Style resolver for getComputedStyle
 	styleResolver *css.StyleResolver
 
+	// Hit tester for elementFromPoint and caretPositionFromPoint, and how
+	// far the page is scrolled under the viewport it hit tests
+	hitTester    HitTester
+	scrollOffset ScrollOffset
+
 	// Prototype objects for instanceof checks
 	nodeProto                    *goja.Object
 	characterDataProto           *goja.Object
@@ -2446,6 +2451,9 @@ func (b *DOMBinder) BindDocument(doc *dom.Document) *goja.Object {
 		return b.BindSelection(selection)
 	})
 
+	b.bindHitTesting(jsDoc, doc.AsNode())
+	b.bindCaretPositionFromPoint(jsDoc, doc)
+
 	jsDoc.Set("createAttribute", func(call goja.FunctionCall) goja.Value {
 		name := ""
 		if len(call.Arguments) > 0 {
@@ -3149,6 +3157,9 @@ func (b *DOMBinder) bindDocumentInternal(doc *dom.Document) *goja.Object {
 		return b.BindSelection(selection)
 	})
 
+	b.bindHitTesting(jsDoc, doc.AsNode())
+	b.bindCaretPositionFromPoint(jsDoc, doc)
+
 	jsDoc.Set("createAttribute", func(call goja.FunctionCall) goja.Value {
 		name := ""
 		if len(call.Arguments) > 0 {
@@ -5400,6 +5411,8 @@ func (b *DOMBinder) bindTextAreaElementProperties(jsEl *goja.Object, el *dom.Ele
 		}
 		return goja.Undefined()
 	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	b.bindTextSelectionAPI(jsEl, el)
 }
 
 // bindOptionElementProperties adds HTMLOptionElement-specific properties.
@@ -5784,6 +5797,83 @@ func (b *DOMBinder) bindInputProperties(jsEl *goja.Object, el *dom.Element) {
 		}
 		return goja.Undefined()
 	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	b.bindTextSelectionAPI(jsEl, el)
+}
+
+// bindTextSelectionAPI adds the text selection APIs of input and textarea
+// elements. They apply to text controls only: for other inputs the
+// properties are null and the methods throw.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/form-control-infrastructure.html#textFieldSelection
+func (b *DOMBinder) bindTextSelectionAPI(jsEl *goja.Object, el *dom.Element) {
+	vm := b.runtime.vm
+
+	checkTextControl := func() {
+		if !el.IsTextControl() {
+			panic(b.createDOMException("InvalidStateError", "The input element's type ('"+el.InputType()+"') does not support selection."))
+		}
+	}
+	selectionEdge := func(end bool) goja.Value {
+		if !el.IsTextControl() {
+			return goja.Null()
+		}
+		start, stop := el.SelectionRange()
+		if end {
+			return vm.ToValue(stop)
+		}
+		return vm.ToValue(start)
+	}
+
+	jsEl.DefineAccessorProperty("selectionStart", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return selectionEdge(false)
+	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		checkTextControl()
+		if len(call.Arguments) > 0 {
+			start := int(call.Arguments[0].ToInteger())
+			_, end := el.SelectionRange()
+			el.SetSelectionRange(start, max(start, end))
+		}
+		return goja.Undefined()
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	jsEl.DefineAccessorProperty("selectionEnd", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return selectionEdge(true)
+	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		checkTextControl()
+		if len(call.Arguments) > 0 {
+			start, _ := el.SelectionRange()
+			el.SetSelectionRange(start, int(call.Arguments[0].ToInteger()))
+		}
+		return goja.Undefined()
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	jsEl.DefineAccessorProperty("selectionDirection", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if !el.IsTextControl() {
+			return goja.Null()
+		}
+		return vm.ToValue("none")
+	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		checkTextControl()
+		return goja.Undefined()
+	}), goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// setSelectionRange(start, end, direction?) method
+	jsEl.Set("setSelectionRange", func(call goja.FunctionCall) goja.Value {
+		checkTextControl()
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("Failed to execute 'setSelectionRange': 2 arguments required, but only %d present.", len(call.Arguments)))
+		}
+		el.SetSelectionRange(int(call.Arguments[0].ToInteger()), int(call.Arguments[1].ToInteger()))
+		return goja.Undefined()
+	})
+
+	// select() method - selects all the text
+	jsEl.Set("select", func(call goja.FunctionCall) goja.Value {
+		if el.IsTextControl() {
+			el.SetSelectionRange(0, dom.UTF16Length(el.TextControlValue()))
+		}
+		return goja.Undefined()
+	})
 }
 
 // bindValidityState binds a ValidityState object to JavaScript.
@@ -5881,30 +5971,7 @@ func (b *DOMBinder) bindHTMLGlobalAttributes(jsEl *goja.Object, el *dom.Element)
 	// tabIndex - reflects the tabindex attribute
 	// Default is -1 for most elements, 0 for interactive elements
 	jsEl.DefineAccessorProperty("tabIndex", vm.ToValue(func(call goja.FunctionCall) goja.Value {
-		if el.HasAttribute("tabindex") {
-			val := el.GetAttribute("tabindex")
-			// Parse as integer
-			var tabIndex int
-			_, err := fmt.Sscanf(val, "%d", &tabIndex)
-			if err == nil {
-				return vm.ToValue(tabIndex)
-			}
-		}
-		// Default tabindex based on element type
-		// Interactive elements (a with href, button, input, select, textarea) default to 0
-		// Others default to -1
-		localName := el.LocalName()
-		switch localName {
-		case "a":
-			if el.HasAttribute("href") {
-				return vm.ToValue(0)
-			}
-		case "button", "input", "select", "textarea":
-			return vm.ToValue(0)
-		case "summary":
-			return vm.ToValue(0)
-		}
-		return vm.ToValue(-1)
+		return vm.ToValue(el.TabIndex())
 	}), vm.ToValue(func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) > 0 {
 			val := call.Arguments[0].ToInteger()
@@ -7700,6 +7767,8 @@ func (b *DOMBinder) BindShadowRoot(sr *dom.ShadowRoot) *goja.Object {
 		return b.BindElement(el)
 	})
 
+	b.bindHitTesting(jsSR, node)
+
 	// ParentNode mixin properties
 	jsSR.DefineAccessorProperty("children", vm.ToValue(func(call goja.FunctionCall) goja.Value {
 		return b.BindHTMLCollection(sr.Children())
@@ -8235,6 +8304,15 @@ func (b *DOMBinder) BindRange(r *dom.Range) *goja.Object {
 		return vm.ToValue(r.IntersectsNode(node))
 	})
 
+	// Geometry methods
+	jsRange.Set("getClientRects", func(call goja.FunctionCall) goja.Value {
+		return b.BindDOMRectList(r.GetClientRects())
+	})
+
+	jsRange.Set("getBoundingClientRect", func(call goja.FunctionCall) goja.Value {
+		return b.BindDOMRect(r.GetBoundingClientRect())
+	})
+
 	// Cache the binding
 	b.rangeCache[r] = jsRange
 
@@ -11352,6 +11430,10 @@ func (b *DOMBinder) bindComputedStyleDeclaration(cs *css.ComputedStyle, el *dom.
 		if val.Keyword != "" {
 			return val.Keyword
 		}
+		// Relative lengths compute to pixels
+		if val.Value.Type == css.LengthValue && !strings.EqualFold(val.Value.Unit, "px") {
+			return formatCSSLength(val.Length)
+		}
 		if val.Value.Raw != "" {
 			return val.Value.Raw
 		}
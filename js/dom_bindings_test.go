@@ -2976,6 +2976,35 @@ func TestDOMBinderGeometryAPIs(t *testing.T) {
 	}
 }
 
+func TestDOMBinderRangeGeometry(t *testing.T) {
+	r := NewRuntime()
+	binder := NewDOMBinder(r)
+
+	doc, _ := dom.ParseHTML(`<!DOCTYPE html><html><head></head><body><p>hello</p></body></html>`)
+	binder.BindDocument(doc)
+
+	text := (*dom.Text)(doc.GetElementsByTagName("p").Item(0).AsNode().FirstChild())
+	text.SetTextFragments([]dom.TextFragment{
+		{X: 0, Y: 10, Width: 25, Height: 8, Start: 0, End: 5, Carets: []float64{0, 5, 10, 15, 20, 25}},
+	})
+
+	result, err := r.Execute(`
+		var range = document.createRange();
+		var text = document.querySelector('p').firstChild;
+		range.setStart(text, 1);
+		range.setEnd(text, 3);
+		var rects = range.getClientRects();
+		var box = range.getBoundingClientRect();
+		[rects.length, rects[0].x, rects[0].width, box.y, box.height].join(',');
+	`)
+	if err != nil {
+		t.Fatalf("Range geometry failed: %v", err)
+	}
+	if got := result.String(); got != "1,5,10,10,8" {
+		t.Errorf("Range geometry = %s, want 1,5,10,10,8", got)
+	}
+}
+
 func TestDOMBinderDOMRectConstructor(t *testing.T) {
 	r := NewRuntime()
 	binder := NewDOMBinder(r)
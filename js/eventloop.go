@@ -2,29 +2,114 @@ package js
 
 import (
 	"sync"
+	"time"
 
 	"github.com/dop251/goja"
 )
 
+// TaskSource identifies where a task comes from. Tasks of one source run in
+// the order they were queued, while the event loop chooses which source it
+// takes the next task from.
+// Reference: https://html.spec.whatwg.org/multipage/webappapis.html#generic-task-sources
+type TaskSource int
+
+const (
+	TaskSourceDOMManipulation  TaskSource = iota // Reactions to changes of the document, such as iframes loading
+	TaskSourceUserInteraction                    // Mouse and keyboard input
+	TaskSourceNetworking                         // Responses to fetch and XMLHttpRequest
+	TaskSourceHistoryTraversal                   // Traversal of the session history
+	TaskSourceTimer                              // Callbacks of setTimeout and setInterval
+	TaskSourceFontLoading                        // Loading of web fonts through document.fonts
+	TaskSourceIdle                               // Idle callbacks whose timeout passed
+	taskSourceCount
+)
+
+// taskSourceNames are the names of the task sources.
+var taskSourceNames = [taskSourceCount]string{
+	"DOM manipulation",
+	"user interaction",
+	"networking",
+	"history traversal",
+	"timer",
+	"font loading",
+	"idle",
+}
+
+// String returns the name of the task source.
+func (s TaskSource) String() string {
+	if s < 0 || s >= taskSourceCount {
+		return "unknown"
+	}
+	return taskSourceNames[s]
+}
+
+// frameInterval is the time between rendering opportunities, about 60
+// frames a second.
+const frameInterval = 16 * time.Millisecond
+
+// maxIdlePeriod is the longest idle period, which keeps the event loop
+// responsive to work that arrives while idle callbacks run.
+// Reference: https://w3c.github.io/requestidlecallback/#why50
+const maxIdlePeriod = 50 * time.Millisecond
+
 // task represents a queued callback in the event loop.
 type task struct {
 	callback goja.Callable
 	args     []goja.Value
 	goFunc   func() // Optional Go function to run
+	seq      uint64 // Order in which the task was queued
 }
 
-// eventLoop manages the JavaScript event loop for microtasks and macrotasks.
+// animationFrameCallback is a callback of requestAnimationFrame.
+type animationFrameCallback struct {
+	id        int
+	callback  goja.Callable
+	cancelled bool
+}
+
+// idleCallback is a callback of requestIdleCallback.
+type idleCallback struct {
+	id       int
+	callback goja.Callable
+	timeout  time.Time // When the callback runs even without an idle period, or zero
+}
+
+// eventLoop manages the JavaScript event loop: a task queue for each task
+// source, the microtask queue, the rendering opportunities at which
+// animation frame callbacks run and the page is painted, and the idle
+// periods between them.
+// Reference: https://html.spec.whatwg.org/multipage/webappapis.html#event-loop-processing-model
 type eventLoop struct {
 	microtasks []task
-	macrotasks []task
-	mu         sync.Mutex
+	tasks      [taskSourceCount][]task
+	seq        uint64
+
+	animationFrames    []*animationFrameCallback
+	idleCallbacks      []*idleCallback
+	nextCallbackID     int
+	lastFrame          time.Time
+	renderingRequested bool
+	renderer           func()   // Paints the page, or nil
+	frameSteps         []func() // Run at each rendering opportunity before the animation frame callbacks
+
+	wake chan struct{} // Signaled when work is queued
+	mu   sync.Mutex
 }
 
 // newEventLoop creates a new event loop.
 func newEventLoop() *eventLoop {
 	return &eventLoop{
-		microtasks: make([]task, 0),
-		macrotasks: make([]task, 0),
+		microtasks:     make([]task, 0),
+		nextCallbackID: 1,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// signal wakes an agent waiting for work.
+func (el *eventLoop) signal() {
+	select {
+	case el.wake <- struct{}{}:
+	default:
 	}
 }
 
@@ -32,73 +117,402 @@ func newEventLoop() *eventLoop {
 // Microtasks are executed before the next macrotask.
 func (el *eventLoop) queueMicrotask(callback goja.Callable, args []goja.Value) {
 	el.mu.Lock()
-	defer el.mu.Unlock()
 	el.microtasks = append(el.microtasks, task{callback: callback, args: args})
+	el.mu.Unlock()
+	el.signal()
 }
 
-// queueMacrotask adds a macrotask to the queue.
-// Macrotasks are executed after all microtasks are complete.
-func (el *eventLoop) queueMacrotask(callback goja.Callable, args []goja.Value) {
+// queueTask adds a Go function as a task of a task source. It is safe to
+// call from any goroutine.
+func (el *eventLoop) queueTask(source TaskSource, fn func()) {
 	el.mu.Lock()
-	defer el.mu.Unlock()
-	el.macrotasks = append(el.macrotasks, task{callback: callback, args: args})
+	el.seq++
+	el.tasks[source] = append(el.tasks[source], task{goFunc: fn, seq: el.seq})
+	el.mu.Unlock()
+	el.signal()
 }
 
-// queueGoFunc adds a plain Go function as a macrotask.
-// This is useful for internal async operations like XHR.
-func (el *eventLoop) queueGoFunc(fn func()) {
+// nextTask removes the task to run next from its queue. Input is handled
+// before the tasks of other sources, which run in the order they were
+// queued.
+func (el *eventLoop) nextTask() (task, bool) {
 	el.mu.Lock()
 	defer el.mu.Unlock()
-	el.macrotasks = append(el.macrotasks, task{goFunc: fn})
+
+	source := TaskSource(-1)
+	if len(el.tasks[TaskSourceUserInteraction]) > 0 {
+		source = TaskSourceUserInteraction
+	} else {
+		for s := TaskSource(0); s < taskSourceCount; s++ {
+			if len(el.tasks[s]) > 0 && (source < 0 || el.tasks[s][0].seq < el.tasks[source][0].seq) {
+				source = s
+			}
+		}
+	}
+	if source < 0 {
+		return task{}, false
+	}
+	t := el.tasks[source][0]
+	el.tasks[source] = el.tasks[source][1:]
+	return t, true
 }
 
-// runOnce processes one iteration of the event loop.
-// It drains all microtasks, then executes one macrotask.
-// Returns true if there are more events to process.
-func (el *eventLoop) runOnce(r *Runtime) bool {
-	// First, drain all microtasks
+// runTask runs the next task and the microtasks it queued. It returns
+// false if no task was queued.
+func (el *eventLoop) runTask() bool {
+	t, ok := el.nextTask()
+	if !ok {
+		return false
+	}
+	t.run()
+	el.performMicrotaskCheckpoint()
+	return true
+}
+
+// runTasksOf runs the tasks of a task source that are queued, each followed
+// by a microtask checkpoint.
+func (el *eventLoop) runTasksOf(source TaskSource) {
+	el.mu.Lock()
+	tasks := el.tasks[source]
+	el.tasks[source] = nil
+	el.mu.Unlock()
+
+	for _, t := range tasks {
+		t.run()
+		el.performMicrotaskCheckpoint()
+	}
+}
+
+// run executes the task.
+func (t task) run() {
+	if t.goFunc != nil {
+		t.goFunc()
+	} else if t.callback != nil {
+		_, _ = t.callback(goja.Undefined(), t.args...)
+	}
+}
+
+// performMicrotaskCheckpoint runs microtasks until the queue is empty,
+// including those the microtasks queue.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/webappapis.html#perform-a-microtask-checkpoint
+func (el *eventLoop) performMicrotaskCheckpoint() {
 	for {
 		el.mu.Lock()
 		if len(el.microtasks) == 0 {
 			el.mu.Unlock()
-			break
+			return
 		}
 		t := el.microtasks[0]
 		el.microtasks = el.microtasks[1:]
 		el.mu.Unlock()
 
-		// Execute the microtask
-		_, _ = t.callback(goja.Undefined(), t.args...)
+		t.run()
+	}
+}
+
+// step runs one turn of the event loop: the next task, then the rendering
+// if a rendering opportunity came. A turn without either is an idle
+// period. It returns false if there was nothing to do.
+func (el *eventLoop) step(r *Runtime) bool {
+	// Microtasks queued by scripts run outside of a task come first
+	el.performMicrotaskCheckpoint()
+
+	now := time.Now()
+	r.timers.queueDue(r, now)
+	el.queueTimedOutIdleCallbacks(r, now)
+
+	ran := el.runTask()
+	if el.updateRendering(r, time.Now()) {
+		ran = true
+	}
+	if !ran {
+		ran = el.runIdlePeriod(r, time.Now())
+	}
+	return ran
+}
+
+// runOnce processes one iteration of the event loop.
+// Returns true if there are more events to process.
+func (el *eventLoop) runOnce(r *Runtime) bool {
+	if el.step(r) {
+		return true
+	}
+	return el.hasPending() || r.timers.hasPending()
+}
+
+// requestAnimationFrame adds a callback to run at the next rendering
+// opportunity and returns its handle.
+func (el *eventLoop) requestAnimationFrame(callback goja.Callable) int {
+	el.mu.Lock()
+	id := el.nextCallbackID
+	el.nextCallbackID++
+	el.animationFrames = append(el.animationFrames, &animationFrameCallback{id: id, callback: callback})
+	el.mu.Unlock()
+	el.signal()
+	return id
+}
+
+// cancelAnimationFrame cancels an animation frame callback, even one of the
+// frame being rendered that has not run yet.
+func (el *eventLoop) cancelAnimationFrame(id int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	for i, cb := range el.animationFrames {
+		if cb.id == id {
+			cb.cancelled = true
+			el.animationFrames = append(el.animationFrames[:i], el.animationFrames[i+1:]...)
+			return
+		}
+	}
+}
+
+// requestRendering asks for the page to be painted at the next rendering
+// opportunity. It is safe to call from any goroutine.
+func (el *eventLoop) requestRendering() {
+	el.mu.Lock()
+	el.renderingRequested = true
+	el.mu.Unlock()
+	el.signal()
+}
+
+// setRenderer sets the function that paints the page.
+func (el *eventLoop) setRenderer(renderer func()) {
+	el.mu.Lock()
+	el.renderer = renderer
+	el.mu.Unlock()
+}
+
+// addFrameStep adds a step of updating the rendering that runs before
+// the animation frame callbacks of the frames rendering was requested for,
+// such as firing resize events and evaluating media queries.
+func (el *eventLoop) addFrameStep(step func()) {
+	el.mu.Lock()
+	el.frameSteps = append(el.frameSteps, step)
+	el.mu.Unlock()
+}
+
+// wantsRendering reports whether a rendering opportunity has work to do.
+// The caller holds el.mu.
+func (el *eventLoop) wantsRendering() bool {
+	return len(el.animationFrames) > 0 || (el.renderingRequested && (el.renderer != nil || len(el.frameSteps) > 0))
+}
+
+// updateRendering takes a rendering opportunity if one came and there is
+// something to render: the animation frame callbacks run with the frame's
+// timestamp, and the renderer paints the page. The frame steps run first
+// when rendering was requested. Callbacks requested while they run wait
+// for the next frame. It returns false if it did nothing.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/webappapis.html#update-the-rendering
+func (el *eventLoop) updateRendering(r *Runtime, now time.Time) bool {
+	el.mu.Lock()
+	if !el.wantsRendering() || now.Sub(el.lastFrame) < frameInterval {
+		el.mu.Unlock()
+		return false
+	}
+	el.lastFrame = now
+	var steps []func()
+	if el.renderingRequested {
+		steps = el.frameSteps
 	}
+	el.renderingRequested = false
+	renderer := el.renderer
+	el.mu.Unlock()
 
-	// Process timers
-	r.timers.process(r)
+	for _, step := range steps {
+		step()
+		el.performMicrotaskCheckpoint()
+	}
 
-	// Then execute one macrotask if available
 	el.mu.Lock()
-	if len(el.macrotasks) > 0 {
-		t := el.macrotasks[0]
-		el.macrotasks = el.macrotasks[1:]
+	callbacks := el.animationFrames
+	el.animationFrames = nil
+	el.mu.Unlock()
+
+	timestamp := r.vm.ToValue(r.Now())
+	for _, cb := range callbacks {
+		el.mu.Lock()
+		cancelled := cb.cancelled
 		el.mu.Unlock()
+		if !cancelled {
+			_, _ = cb.callback(goja.Undefined(), timestamp)
+			el.performMicrotaskCheckpoint()
+		}
+	}
+	if renderer != nil {
+		renderer()
+	}
+	return true
+}
+
+// requestIdleCallback adds a callback to run in an idle period and returns
+// its handle. A positive timeout makes the callback run as a task once it
+// passed, even if the event loop never became idle.
+func (el *eventLoop) requestIdleCallback(callback goja.Callable, timeout time.Duration) int {
+	el.mu.Lock()
+	id := el.nextCallbackID
+	el.nextCallbackID++
+	cb := &idleCallback{id: id, callback: callback}
+	if timeout > 0 {
+		cb.timeout = time.Now().Add(timeout)
+	}
+	el.idleCallbacks = append(el.idleCallbacks, cb)
+	el.mu.Unlock()
+	el.signal()
+	return id
+}
 
-		// Execute the macrotask
-		if t.goFunc != nil {
-			t.goFunc()
-		} else if t.callback != nil {
-			_, _ = t.callback(goja.Undefined(), t.args...)
+// cancelIdleCallback cancels an idle callback.
+func (el *eventLoop) cancelIdleCallback(id int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	for i, cb := range el.idleCallbacks {
+		if cb.id == id {
+			el.idleCallbacks = append(el.idleCallbacks[:i], el.idleCallbacks[i+1:]...)
+			return
 		}
-		return true
 	}
+}
+
+// queueTimedOutIdleCallbacks queues a task on the idle task source for
+// each idle callback whose timeout passed.
+func (el *eventLoop) queueTimedOutIdleCallbacks(r *Runtime, now time.Time) {
+	el.mu.Lock()
+	var timedOut []*idleCallback
+	pending := el.idleCallbacks[:0]
+	for _, cb := range el.idleCallbacks {
+		if !cb.timeout.IsZero() && !now.Before(cb.timeout) {
+			timedOut = append(timedOut, cb)
+		} else {
+			pending = append(pending, cb)
+		}
+	}
+	el.idleCallbacks = pending
 	el.mu.Unlock()
 
-	return el.hasPending() || r.timers.hasPending()
+	for _, cb := range timedOut {
+		cb := cb
+		el.queueTask(TaskSourceIdle, func() {
+			el.invokeIdleCallback(r, cb, time.Now(), true)
+		})
+	}
+}
+
+// runIdlePeriod runs the idle callbacks that were requested before the
+// idle period started, until its deadline: the next timer, the next
+// rendering opportunity if there is something to render, or the longest
+// idle period. It returns false if no callback ran.
+// Per spec: https://w3c.github.io/requestidlecallback/#start-an-idle-period-algorithm
+func (el *eventLoop) runIdlePeriod(r *Runtime, now time.Time) bool {
+	deadline := now.Add(maxIdlePeriod)
+	if due, ok := r.timers.nextDue(); ok && due.Before(deadline) {
+		deadline = due
+	}
+	el.mu.Lock()
+	if el.wantsRendering() {
+		if frame := el.lastFrame.Add(frameInterval); frame.Before(deadline) {
+			deadline = frame
+		}
+	}
+	callbacks := append([]*idleCallback(nil), el.idleCallbacks...)
+	el.mu.Unlock()
+
+	ran := false
+	for _, cb := range callbacks {
+		if !time.Now().Before(deadline) {
+			break
+		}
+		el.mu.Lock()
+		pending := false
+		for i, c := range el.idleCallbacks {
+			if c == cb {
+				el.idleCallbacks = append(el.idleCallbacks[:i], el.idleCallbacks[i+1:]...)
+				pending = true
+				break
+			}
+		}
+		el.mu.Unlock()
+		if pending {
+			el.invokeIdleCallback(r, cb, deadline, false)
+			ran = true
+		}
+	}
+	return ran
+}
+
+// invokeIdleCallback calls an idle callback with an IdleDeadline for the
+// deadline of its idle period.
+// Reference: https://w3c.github.io/requestidlecallback/#the-idledeadline-interface
+func (el *eventLoop) invokeIdleCallback(r *Runtime, cb *idleCallback, deadline time.Time, didTimeout bool) {
+	vm := r.vm
+	idleDeadline := vm.NewObject()
+	idleDeadline.Set("timeRemaining", func(call goja.FunctionCall) goja.Value {
+		remaining := time.Until(deadline)
+		if didTimeout || remaining < 0 {
+			remaining = 0
+		}
+		return vm.ToValue(float64(remaining) / float64(time.Millisecond))
+	})
+	idleDeadline.Set("didTimeout", didTimeout)
+	_, _ = cb.callback(goja.Undefined(), idleDeadline)
+	el.performMicrotaskCheckpoint()
+}
+
+// nextWakeup returns how long an agent can wait for work before the event
+// loop has something to do: a timer becomes due, a rendering opportunity
+// comes for a frame that has something to render, or an idle callback
+// times out. It returns false if only queued work can wake it.
+func (el *eventLoop) nextWakeup(r *Runtime, now time.Time) (time.Duration, bool) {
+	var next time.Time
+	earliest := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	if due, ok := r.timers.nextDue(); ok {
+		earliest(due)
+	}
+
+	el.mu.Lock()
+	if len(el.microtasks) > 0 || len(el.idleCallbacks) > 0 {
+		earliest(now)
+	}
+	for _, queue := range el.tasks {
+		if len(queue) > 0 {
+			earliest(now)
+		}
+	}
+	if el.wantsRendering() {
+		earliest(el.lastFrame.Add(frameInterval))
+	}
+	for _, cb := range el.idleCallbacks {
+		if !cb.timeout.IsZero() {
+			earliest(cb.timeout)
+		}
+	}
+	el.mu.Unlock()
+
+	if next.IsZero() {
+		return 0, false
+	}
+	if wait := next.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
 }
 
 // hasPending returns true if there are any pending tasks.
 func (el *eventLoop) hasPending() bool {
 	el.mu.Lock()
 	defer el.mu.Unlock()
-	return len(el.microtasks) > 0 || len(el.macrotasks) > 0
+	if len(el.microtasks) > 0 || len(el.animationFrames) > 0 || len(el.idleCallbacks) > 0 {
+		return true
+	}
+	for _, queue := range el.tasks {
+		if len(queue) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // clear removes all pending tasks.
@@ -106,5 +520,9 @@ func (el *eventLoop) clear() {
 	el.mu.Lock()
 	defer el.mu.Unlock()
 	el.microtasks = el.microtasks[:0]
-	el.macrotasks = el.macrotasks[:0]
+	for s := range el.tasks {
+		el.tasks[s] = nil
+	}
+	el.animationFrames = nil
+	el.idleCallbacks = nil
 }
@@ -430,7 +430,8 @@ type ActivationResult struct {
 	Element          *goja.Object // The element with activation behavior
 	PreviousChecked  bool         // Previous checked state (for checkbox/radio)
 	HasActivation    bool         // Whether activation behavior was triggered
-	ActivationType   string       // Type of activation ("checkbox", "radio", etc.)
+	ActivationType   string       // Type of activation ("checkbox", "radio", "hyperlink", etc.)
+	Event            *goja.Object // The click event, whose modifier keys hyperlinks consult
 }
 
 // ActivationHandler is a function that handles activation behavior.
@@ -461,6 +462,7 @@ type EventBinder struct {
 	activationCancelHandler     ActivationCancelHandler // Handler for canceled activation
 	activationCompleteHandler   ActivationCompleteHandler // Handler for successful activation
 	listenerErrorHandler        ListenerErrorHandler    // Handler for exceptions in event listeners
+	dataTransferProto           *goja.Object            // Prototype of DataTransfer objects
 }
 
 // NewEventBinder creates a new event binder.
@@ -686,222 +688,240 @@ func (eb *EventBinder) BindEventTarget(obj *goja.Object) {
 		// This handles the case where a trusted event is captured and re-dispatched by user script
 		event.Set("isTrusted", false)
 
-		// Set target
-		event.Set("target", obj)
-
-		// Per HTML spec: Save the previous window.event value to support nested event dispatch.
-		// We will set window.event appropriately before each listener invocation based on
-		// whether the currentTarget is inside a shadow tree.
-		window := vm.Get("window")
-		var previousWindowEvent goja.Value
-		var windowObj *goja.Object
-		if window != nil && !goja.IsUndefined(window) {
-			windowObj = window.ToObject(vm)
-			if windowObj != nil {
-				previousWindowEvent = windowObj.Get("event")
-			}
+		return vm.ToValue(eb.dispatch(obj, event))
+	})
+}
+
+// DispatchTrustedEvent dispatches an event generated by the user agent, such
+// as one for user input, to a target and its ancestors. It returns false if
+// the event was canceled.
+func (eb *EventBinder) DispatchTrustedEvent(target, event *goja.Object) bool {
+	event.Set("_dispatch", true)
+	event.Set("isTrusted", true)
+	return eb.dispatch(target, event)
+}
+
+// dispatch runs the capturing, at-target and bubbling phases of an event
+// whose dispatch flag is set along the path from obj to the root, followed by
+// any activation behavior. It returns false if the event was canceled.
+func (eb *EventBinder) dispatch(obj, event *goja.Object) bool {
+	vm := eb.runtime.vm
+
+	// Set target
+	event.Set("target", obj)
+
+	// Per HTML spec: Save the previous window.event value to support nested event dispatch.
+	// We will set window.event appropriately before each listener invocation based on
+	// whether the currentTarget is inside a shadow tree.
+	window := vm.Get("window")
+	var previousWindowEvent goja.Value
+	var windowObj *goja.Object
+	if window != nil && !goja.IsUndefined(window) {
+		windowObj = window.ToObject(vm)
+		if windowObj != nil {
+			previousWindowEvent = windowObj.Get("event")
 		}
+	}
 
-		// Defer restoration of window.event
-		defer func() {
-			if windowObj != nil {
-				windowObj.Set("event", previousWindowEvent)
-			}
-		}()
+	// Defer restoration of window.event
+	defer func() {
+		if windowObj != nil {
+			windowObj.Set("event", previousWindowEvent)
+		}
+	}()
 
-		// Helper to set window.event based on currentTarget.
-		// Per HTML spec, window.event should be undefined when listeners inside shadow trees are invoked.
-		setWindowEvent := func(currentTarget *goja.Object) {
-			if windowObj == nil {
-				return
-			}
-			// Check if currentTarget is inside a shadow tree
-			if eb.shadowRootChecker != nil && eb.shadowRootChecker(currentTarget) {
-				// Inside shadow tree - window.event should be undefined
-				windowObj.Set("event", goja.Undefined())
-			} else {
-				// Outside shadow tree - window.event should be the event
-				windowObj.Set("event", event)
-			}
+	// Helper to set window.event based on currentTarget.
+	// Per HTML spec, window.event should be undefined when listeners inside shadow trees are invoked.
+	setWindowEvent := func(currentTarget *goja.Object) {
+		if windowObj == nil {
+			return
+		}
+		// Check if currentTarget is inside a shadow tree
+		if eb.shadowRootChecker != nil && eb.shadowRootChecker(currentTarget) {
+			// Inside shadow tree - window.event should be undefined
+			windowObj.Set("event", goja.Undefined())
+		} else {
+			// Outside shadow tree - window.event should be the event
+			windowObj.Set("event", event)
 		}
+	}
 
-		// Check if the event is composed (crosses shadow boundaries)
-		composed := false
-		if composedVal := event.Get("composed"); composedVal != nil {
-			composed = composedVal.ToBoolean()
-		}
-
-		// Build event path from target up to root
-		// The path is ordered from the target to the root (for bubbling)
-		// For composed events, the path crosses shadow boundaries via the shadow host.
-		eventPath := []*goja.Object{obj}
-		if eb.nodeResolver != nil {
-			current := obj
-			for {
-				parent := eb.nodeResolver(current)
-				if parent == nil {
-					// If no parent and event is composed, check if we're at a shadow root
-					// and need to continue to the shadow host
-					if composed && eb.shadowHostResolver != nil {
-						host := eb.shadowHostResolver(current)
-						if host != nil {
-							// Continue from the shadow host
-							eventPath = append(eventPath, host)
-							current = host
-							continue
-						}
+	// Check if the event is composed (crosses shadow boundaries)
+	composed := false
+	if composedVal := event.Get("composed"); composedVal != nil {
+		composed = composedVal.ToBoolean()
+	}
+
+	// Build event path from target up to root
+	// The path is ordered from the target to the root (for bubbling)
+	// For composed events, the path crosses shadow boundaries via the shadow host.
+	eventPath := []*goja.Object{obj}
+	if eb.nodeResolver != nil {
+		current := obj
+		for {
+			parent := eb.nodeResolver(current)
+			if parent == nil {
+				// If no parent and event is composed, check if we're at a shadow root
+				// and need to continue to the shadow host
+				if composed && eb.shadowHostResolver != nil {
+					host := eb.shadowHostResolver(current)
+					if host != nil {
+						// Continue from the shadow host
+						eventPath = append(eventPath, host)
+						current = host
+						continue
 					}
-					break
 				}
-				eventPath = append(eventPath, parent)
-				current = parent
+				break
 			}
+			eventPath = append(eventPath, parent)
+			current = parent
 		}
+	}
 
-		// Store the path for composedPath() - need to store in event
-		// composedPath returns path from target to root, but we need the full path
-		// which during dispatch is from target through ancestors
-		event.Set("_eventPath", eventPath)
+	// Store the path for composedPath() - need to store in event
+	// composedPath returns path from target to root, but we need the full path
+	// which during dispatch is from target through ancestors
+	event.Set("_eventPath", eventPath)
 
-		// Update composedPath to return the stored path
-		event.Set("composedPath", func(call goja.FunctionCall) goja.Value {
-			pathVal := event.Get("_eventPath")
-			if pathVal == nil || goja.IsUndefined(pathVal) || goja.IsNull(pathVal) {
-				return vm.ToValue([]interface{}{})
-			}
-			// Export and convert to array
-			if exported, ok := pathVal.Export().([]*goja.Object); ok {
-				result := make([]interface{}, len(exported))
-				for i, obj := range exported {
-					result[i] = obj
-				}
-				return vm.ToValue(result)
-			}
+	// Update composedPath to return the stored path
+	event.Set("composedPath", func(call goja.FunctionCall) goja.Value {
+		pathVal := event.Get("_eventPath")
+		if pathVal == nil || goja.IsUndefined(pathVal) || goja.IsNull(pathVal) {
 			return vm.ToValue([]interface{}{})
-		})
-
-		bubbles := false
-		if bubblesVal := event.Get("bubbles"); bubblesVal != nil {
-			bubbles = bubblesVal.ToBoolean()
 		}
-
-		shouldStopPropagation := func() bool {
-			stopProp := event.Get("_stopPropagation")
-			return stopProp != nil && stopProp.ToBoolean()
+		// Export and convert to array
+		if exported, ok := pathVal.Export().([]*goja.Object); ok {
+			result := make([]interface{}, len(exported))
+			for i, obj := range exported {
+				result[i] = obj
+			}
+			return vm.ToValue(result)
 		}
+		return vm.ToValue([]interface{}{})
+	})
 
-		// Pre-click activation behavior (for checkbox, radio, etc.)
-		// Per HTML spec, activation behavior runs BEFORE the click event is dispatched.
-		// This only applies to MouseEvent click events (not plain Event clicks).
-		// See: https://html.spec.whatwg.org/multipage/webappapis.html#activation-behavior
-		var activationResult *ActivationResult
-		if eb.activationHandler != nil {
-			activationResult = eb.activationHandler(eventPath, event)
-		}
+	bubbles := false
+	if bubblesVal := event.Get("bubbles"); bubblesVal != nil {
+		bubbles = bubblesVal.ToBoolean()
+	}
 
-		// Get the original relatedTarget (if any) for retargeting during dispatch
-		// Per DOM spec, relatedTarget must be retargeted against each currentTarget
-		// to prevent leaking shadow DOM internals.
-		originalRelatedTarget := event.Get("relatedTarget")
-		hasRelatedTarget := originalRelatedTarget != nil && !goja.IsUndefined(originalRelatedTarget) && !goja.IsNull(originalRelatedTarget)
-		var originalRelatedTargetObj *goja.Object
-		if hasRelatedTarget {
-			originalRelatedTargetObj = originalRelatedTarget.ToObject(vm)
-		}
+	shouldStopPropagation := func() bool {
+		stopProp := event.Get("_stopPropagation")
+		return stopProp != nil && stopProp.ToBoolean()
+	}
 
+	// Pre-click activation behavior (for checkbox, radio, etc.)
+	// Per HTML spec, activation behavior runs BEFORE the click event is dispatched.
+	// This only applies to MouseEvent click events (not plain Event clicks).
+	// See: https://html.spec.whatwg.org/multipage/webappapis.html#activation-behavior
+	var activationResult *ActivationResult
+	if eb.activationHandler != nil {
+		activationResult = eb.activationHandler(eventPath, event)
+	}
 
-		// Helper to set retargeted relatedTarget for a given currentTarget
-		setRetargetedRelatedTarget := func(currentTarget *goja.Object) {
-			if !hasRelatedTarget {
-				return
-			}
-			if eb.relatedTargetRetargeter == nil {
-				return
-			}
-			retargeted := eb.relatedTargetRetargeter(originalRelatedTargetObj, currentTarget)
-			if retargeted != nil {
-				event.Set("relatedTarget", retargeted)
-			} else {
-				event.Set("relatedTarget", goja.Null())
-			}
+	// Get the original relatedTarget (if any) for retargeting during dispatch
+	// Per DOM spec, relatedTarget must be retargeted against each currentTarget
+	// to prevent leaking shadow DOM internals.
+	originalRelatedTarget := event.Get("relatedTarget")
+	hasRelatedTarget := originalRelatedTarget != nil && !goja.IsUndefined(originalRelatedTarget) && !goja.IsNull(originalRelatedTarget)
+	var originalRelatedTargetObj *goja.Object
+	if hasRelatedTarget {
+		originalRelatedTargetObj = originalRelatedTarget.ToObject(vm)
+	}
+
+
+	// Helper to set retargeted relatedTarget for a given currentTarget
+	setRetargetedRelatedTarget := func(currentTarget *goja.Object) {
+		if !hasRelatedTarget {
+			return
+		}
+		if eb.relatedTargetRetargeter == nil {
+			return
 		}
+		retargeted := eb.relatedTargetRetargeter(originalRelatedTargetObj, currentTarget)
+		if retargeted != nil {
+			event.Set("relatedTarget", retargeted)
+		} else {
+			event.Set("relatedTarget", goja.Null())
+		}
+	}
+
+	// Phase 1: Capturing phase (root to target, excluding target)
+	// Walk from the end of eventPath (root) to the beginning (target)
+	for i := len(eventPath) - 1; i > 0; i-- {
+		if shouldStopPropagation() {
+			break
+		}
+		currentTarget := eventPath[i]
+		event.Set("currentTarget", currentTarget)
+		event.Set("eventPhase", int(EventPhaseCapturing))
+		setWindowEvent(currentTarget)
+		setRetargetedRelatedTarget(currentTarget)
+		target := eb.GetOrCreateTarget(currentTarget)
+		target.DispatchEvent(vm, event, EventPhaseCapturing)
+	}
+
+	// Phase 2: At target (target itself)
+	if !shouldStopPropagation() {
+		event.Set("currentTarget", obj)
+		event.Set("eventPhase", int(EventPhaseAtTarget))
+		setWindowEvent(obj)
+		setRetargetedRelatedTarget(obj)
+		target := eb.GetOrCreateTarget(obj)
+		target.DispatchEvent(vm, event, EventPhaseAtTarget)
+	}
 
-		// Phase 1: Capturing phase (root to target, excluding target)
-		// Walk from the end of eventPath (root) to the beginning (target)
-		for i := len(eventPath) - 1; i > 0; i-- {
+	// Phase 3: Bubbling phase (target to root, excluding target)
+	if bubbles {
+		for i := 1; i < len(eventPath); i++ {
 			if shouldStopPropagation() {
 				break
 			}
 			currentTarget := eventPath[i]
 			event.Set("currentTarget", currentTarget)
-			event.Set("eventPhase", int(EventPhaseCapturing))
+			event.Set("eventPhase", int(EventPhaseBubbling))
 			setWindowEvent(currentTarget)
 			setRetargetedRelatedTarget(currentTarget)
 			target := eb.GetOrCreateTarget(currentTarget)
-			target.DispatchEvent(vm, event, EventPhaseCapturing)
-		}
-
-		// Phase 2: At target (target itself)
-		if !shouldStopPropagation() {
-			event.Set("currentTarget", obj)
-			event.Set("eventPhase", int(EventPhaseAtTarget))
-			setWindowEvent(obj)
-			setRetargetedRelatedTarget(obj)
-			target := eb.GetOrCreateTarget(obj)
-			target.DispatchEvent(vm, event, EventPhaseAtTarget)
-		}
-
-		// Phase 3: Bubbling phase (target to root, excluding target)
-		if bubbles {
-			for i := 1; i < len(eventPath); i++ {
-				if shouldStopPropagation() {
-					break
-				}
-				currentTarget := eventPath[i]
-				event.Set("currentTarget", currentTarget)
-				event.Set("eventPhase", int(EventPhaseBubbling))
-				setWindowEvent(currentTarget)
-				setRetargetedRelatedTarget(currentTarget)
-				target := eb.GetOrCreateTarget(currentTarget)
-				target.DispatchEvent(vm, event, EventPhaseBubbling)
-			}
+			target.DispatchEvent(vm, event, EventPhaseBubbling)
 		}
+	}
 
-		// Clear event path after dispatch
-		event.Set("_eventPath", nil)
+	// Clear event path after dispatch
+	event.Set("_eventPath", nil)
 
-		// Clear dispatch flag and stop propagation flag after dispatch
-		event.Set("_dispatch", false)
-		event.Set("_stopPropagation", false)
-		event.Set("_stopImmediate", false)
-		event.Set("eventPhase", int(EventPhaseNone))
-		event.Set("currentTarget", goja.Null())
+	// Clear dispatch flag and stop propagation flag after dispatch
+	event.Set("_dispatch", false)
+	event.Set("_stopPropagation", false)
+	event.Set("_stopImmediate", false)
+	event.Set("eventPhase", int(EventPhaseNone))
+	event.Set("currentTarget", goja.Null())
 
-		// Check if default was prevented
-		defaultPrevented := false
-		if dp := event.Get("defaultPrevented"); dp != nil {
-			defaultPrevented = dp.ToBoolean()
-		}
+	// Check if default was prevented
+	defaultPrevented := false
+	if dp := event.Get("defaultPrevented"); dp != nil {
+		defaultPrevented = dp.ToBoolean()
+	}
 
-		// Handle post-activation behavior
-		if activationResult != nil && activationResult.HasActivation {
-			if defaultPrevented {
-				// Legacy-canceled-activation-behavior: revert the activation
-				// Per HTML spec, this reverts the checkbox/radio checked state if preventDefault was called
-				if eb.activationCancelHandler != nil {
-					eb.activationCancelHandler(activationResult)
-				}
-			} else {
-				// Activation completed successfully - fire input and change events
-				if eb.activationCompleteHandler != nil {
-					eb.activationCompleteHandler(activationResult)
-				}
+	// Handle post-activation behavior
+	if activationResult != nil && activationResult.HasActivation {
+		if defaultPrevented {
+			// Legacy-canceled-activation-behavior: revert the activation
+			// Per HTML spec, this reverts the checkbox/radio checked state if preventDefault was called
+			if eb.activationCancelHandler != nil {
+				eb.activationCancelHandler(activationResult)
+			}
+		} else {
+			// Activation completed successfully - fire input and change events
+			if eb.activationCompleteHandler != nil {
+				eb.activationCompleteHandler(activationResult)
 			}
 		}
+	}
 
-		// Return true if default wasn't prevented
-		return vm.ToValue(!defaultPrevented)
-	})
+	// Return true if default wasn't prevented
+	return !defaultPrevented
 }
 
 // InitEventObject initializes an existing object with Event properties and methods.
@@ -1843,6 +1863,46 @@ func (eb *EventBinder) SetupEventConstructors() {
 		}
 	})
 
+	// InputEvent - extends UIEvent
+	eb.createEventConstructor("InputEvent", uiEventProto, func(event *goja.Object, call goja.ConstructorCall) {
+		// Set UIEvent defaults
+		event.Set("view", goja.Null())
+		event.Set("detail", 0)
+		// Set InputEvent defaults
+		event.Set("data", goja.Null())
+		event.Set("inputType", "")
+		event.Set("isComposing", false)
+		event.Set("dataTransfer", goja.Null())
+		if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+			optObj := call.Arguments[1].ToObject(vm)
+			if optObj != nil {
+				// UIEvent properties
+				if v := optObj.Get("view"); v != nil && !goja.IsUndefined(v) {
+					event.Set("view", v)
+				}
+				if v := optObj.Get("detail"); v != nil && !goja.IsUndefined(v) {
+					event.Set("detail", v.ToInteger())
+				}
+				// InputEvent properties
+				if v := optObj.Get("data"); v != nil && !goja.IsUndefined(v) && !goja.IsNull(v) {
+					event.Set("data", v.String())
+				}
+				if v := optObj.Get("inputType"); v != nil && !goja.IsUndefined(v) {
+					event.Set("inputType", v.String())
+				}
+				if v := optObj.Get("isComposing"); v != nil && !goja.IsUndefined(v) {
+					event.Set("isComposing", v.ToBoolean())
+				}
+				if v := optObj.Get("dataTransfer"); v != nil && !goja.IsUndefined(v) {
+					event.Set("dataTransfer", v)
+				}
+			}
+		}
+	})
+	eb.GetEventProto("InputEvent").Set("getTargetRanges", func(call goja.FunctionCall) goja.Value {
+		return vm.NewArray()
+	})
+
 	// TextEvent - extends UIEvent (deprecated but needed for compatibility)
 	eb.createEventConstructor("TextEvent", uiEventProto, func(event *goja.Object, call goja.ConstructorCall) {
 		event.Set("view", goja.Null())
@@ -1910,6 +1970,36 @@ func (eb *EventBinder) SetupEventConstructors() {
 		}
 	})
 
+	// FontFaceSetLoadEvent - extends Event
+	eb.createEventConstructor("FontFaceSetLoadEvent", eventProto, func(event *goja.Object, call goja.ConstructorCall) {
+		event.Set("fontfaces", vm.NewArray())
+		if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+			optObj := call.Arguments[1].ToObject(vm)
+			if optObj != nil {
+				if v := optObj.Get("fontfaces"); v != nil && !goja.IsUndefined(v) {
+					event.Set("fontfaces", v)
+				}
+			}
+		}
+	})
+
+	// MediaQueryListEvent - extends Event
+	eb.createEventConstructor("MediaQueryListEvent", eventProto, func(event *goja.Object, call goja.ConstructorCall) {
+		event.Set("media", "")
+		event.Set("matches", false)
+		if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+			optObj := call.Arguments[1].ToObject(vm)
+			if optObj != nil {
+				if v := optObj.Get("media"); v != nil && !goja.IsUndefined(v) {
+					event.Set("media", v.String())
+				}
+				if v := optObj.Get("matches"); v != nil && !goja.IsUndefined(v) {
+					event.Set("matches", v.ToBoolean())
+				}
+			}
+		}
+	})
+
 	// BeforeUnloadEvent - extends Event
 	eb.createEventConstructor("BeforeUnloadEvent", eventProto, func(event *goja.Object, call goja.ConstructorCall) {
 		event.Set("returnValue", "")
@@ -2034,6 +2124,114 @@ func (eb *EventBinder) SetupEventConstructors() {
 		}
 	})
 
+	// PointerEvent - extends MouseEvent
+	eb.createEventConstructor("PointerEvent", mouseEventProto, func(event *goja.Object, call goja.ConstructorCall) {
+		// Set UIEvent defaults
+		event.Set("view", goja.Null())
+		event.Set("detail", 0)
+		// Set MouseEvent defaults
+		event.Set("screenX", 0)
+		event.Set("screenY", 0)
+		event.Set("clientX", 0)
+		event.Set("clientY", 0)
+		event.Set("ctrlKey", false)
+		event.Set("shiftKey", false)
+		event.Set("altKey", false)
+		event.Set("metaKey", false)
+		event.Set("button", 0)
+		event.Set("buttons", 0)
+		event.Set("relatedTarget", goja.Null())
+		// Set PointerEvent-specific defaults
+		event.Set("pointerId", 0)
+		event.Set("width", 1.0)
+		event.Set("height", 1.0)
+		event.Set("pressure", 0.0)
+		event.Set("tangentialPressure", 0.0)
+		event.Set("tiltX", 0)
+		event.Set("tiltY", 0)
+		event.Set("twist", 0)
+		event.Set("pointerType", "")
+		event.Set("isPrimary", false)
+		if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+			optObj := call.Arguments[1].ToObject(vm)
+			if optObj != nil {
+				// UIEvent properties
+				if v := optObj.Get("view"); v != nil && !goja.IsUndefined(v) {
+					event.Set("view", v)
+				}
+				if v := optObj.Get("detail"); v != nil && !goja.IsUndefined(v) {
+					event.Set("detail", v.ToInteger())
+				}
+				// MouseEvent properties
+				if v := optObj.Get("screenX"); v != nil && !goja.IsUndefined(v) {
+					event.Set("screenX", v.ToInteger())
+				}
+				if v := optObj.Get("screenY"); v != nil && !goja.IsUndefined(v) {
+					event.Set("screenY", v.ToInteger())
+				}
+				if v := optObj.Get("clientX"); v != nil && !goja.IsUndefined(v) {
+					event.Set("clientX", v.ToInteger())
+				}
+				if v := optObj.Get("clientY"); v != nil && !goja.IsUndefined(v) {
+					event.Set("clientY", v.ToInteger())
+				}
+				if v := optObj.Get("button"); v != nil && !goja.IsUndefined(v) {
+					event.Set("button", v.ToInteger())
+				}
+				if v := optObj.Get("buttons"); v != nil && !goja.IsUndefined(v) {
+					event.Set("buttons", v.ToInteger())
+				}
+				if v := optObj.Get("relatedTarget"); v != nil && !goja.IsUndefined(v) {
+					event.Set("relatedTarget", v)
+				}
+				// EventModifierInit properties
+				if v := optObj.Get("ctrlKey"); v != nil && !goja.IsUndefined(v) {
+					event.Set("ctrlKey", v.ToBoolean())
+				}
+				if v := optObj.Get("shiftKey"); v != nil && !goja.IsUndefined(v) {
+					event.Set("shiftKey", v.ToBoolean())
+				}
+				if v := optObj.Get("altKey"); v != nil && !goja.IsUndefined(v) {
+					event.Set("altKey", v.ToBoolean())
+				}
+				if v := optObj.Get("metaKey"); v != nil && !goja.IsUndefined(v) {
+					event.Set("metaKey", v.ToBoolean())
+				}
+				// PointerEvent-specific properties
+				if v := optObj.Get("pointerId"); v != nil && !goja.IsUndefined(v) {
+					event.Set("pointerId", v.ToInteger())
+				}
+				if v := optObj.Get("width"); v != nil && !goja.IsUndefined(v) {
+					event.Set("width", v.ToFloat())
+				}
+				if v := optObj.Get("height"); v != nil && !goja.IsUndefined(v) {
+					event.Set("height", v.ToFloat())
+				}
+				if v := optObj.Get("pressure"); v != nil && !goja.IsUndefined(v) {
+					event.Set("pressure", v.ToFloat())
+				}
+				if v := optObj.Get("tangentialPressure"); v != nil && !goja.IsUndefined(v) {
+					event.Set("tangentialPressure", v.ToFloat())
+				}
+				if v := optObj.Get("tiltX"); v != nil && !goja.IsUndefined(v) {
+					event.Set("tiltX", v.ToInteger())
+				}
+				if v := optObj.Get("tiltY"); v != nil && !goja.IsUndefined(v) {
+					event.Set("tiltY", v.ToInteger())
+				}
+				if v := optObj.Get("twist"); v != nil && !goja.IsUndefined(v) {
+					event.Set("twist", v.ToInteger())
+				}
+				if v := optObj.Get("pointerType"); v != nil && !goja.IsUndefined(v) {
+					event.Set("pointerType", v.String())
+				}
+				if v := optObj.Get("isPrimary"); v != nil && !goja.IsUndefined(v) {
+					event.Set("isPrimary", v.ToBoolean())
+				}
+			}
+		}
+	})
+
 	// TouchEvent - extends UIEvent
 	eb.createEventConstructor("TouchEvent", uiEventProto, func(event *goja.Object, call goja.ConstructorCall) {
 		event.Set("view", goja.Null())
@@ -2124,6 +2322,22 @@ func (eb *EventBinder) SetupEventConstructors() {
 		}
 	})
 
+	// ClipboardEvent - extends Event
+	// Per Clipboard API spec: https://w3c.github.io/clipboard-apis/#clipboard-event-interfaces
+	// Properties: clipboardData (DataTransfer or null)
+	eb.setupDataTransfer()
+	eb.createEventConstructor("ClipboardEvent", eventProto, func(event *goja.Object, call goja.ConstructorCall) {
+		event.Set("clipboardData", goja.Null())
+		if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+			optObj := call.Arguments[1].ToObject(vm)
+			if optObj != nil {
+				if v := optObj.Get("clipboardData"); v != nil && !goja.IsUndefined(v) {
+					event.Set("clipboardData", v)
+				}
+			}
+		}
+	})
+
 	// Set up AbortController and AbortSignal
 	eb.setupAbortController()
 }
@@ -2364,10 +2578,10 @@ func (eb *EventBinder) setupAbortController() {
 			var eventInterfaces = [
 				"EventTarget", "Event", "CustomEvent",
 				"UIEvent", "MouseEvent", "FocusEvent", "KeyboardEvent",
-				"CompositionEvent", "TextEvent", "MessageEvent", "StorageEvent",
-				"HashChangeEvent", "BeforeUnloadEvent", "DeviceMotionEvent",
-				"DeviceOrientationEvent", "DragEvent", "WheelEvent", "TouchEvent",
-				"ErrorEvent", "AbortController", "AbortSignal"
+				"InputEvent", "CompositionEvent", "TextEvent", "MessageEvent", "StorageEvent",
+				"HashChangeEvent", "MediaQueryListEvent", "BeforeUnloadEvent", "DeviceMotionEvent",
+				"DeviceOrientationEvent", "DragEvent", "WheelEvent", "PointerEvent", "TouchEvent",
+				"ErrorEvent", "ClipboardEvent", "DataTransfer", "AbortController", "AbortSignal"
 			];
 			var globalObj = typeof window !== 'undefined' ? window : this;
 			eventInterfaces.forEach(function(name) {
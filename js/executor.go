@@ -6,6 +6,7 @@ import (
 
 	"github.com/chrisuehlinger/viberowser/css"
 	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/font"
 	"github.com/dop251/goja"
 )
 
@@ -35,6 +36,13 @@ type ScriptExecutor struct {
 	fetchManager             *FetchManager                   // Fetch API manager
 	historyManager           *HistoryManager                 // History API manager
 	storageManager           *StorageManager                 // Web Storage API manager
+	fontManager              *FontManager                    // CSS Font Loading API manager
+	fonts                    *font.Collection                // Fonts the document is laid out with
+	mouse                    mouseState                      // State of the mouse over the document
+	keyboard                 keyboardState                   // State of the keyboard of the document
+	navigator                Navigator                       // Callback for navigations the document starts
+	sessionHistory           *SessionHistory                 // Session history of the browsing context, shared with later documents
+	viewportManager          *ViewportManager                // Viewport of the window, matchMedia and resize events
 }
 
 // NewScriptExecutor creates a new script executor.
@@ -205,7 +213,11 @@ func NewScriptExecutor(runtime *Runtime) *ScriptExecutor {
 		}
 	})
 
-	// Set activation handlers for click events on checkbox/radio inputs
+	// The executor follows hyperlinks once it is created
+	var se *ScriptExecutor
+
+	// Set activation handlers for click events on checkbox/radio inputs and
+	// hyperlinks
 	// Per HTML spec, activation behavior runs BEFORE onclick fires
 	eventBinder.SetActivationHandlers(
 		// Activation handler: runs pre-click activation for elements with activation behavior
@@ -263,12 +275,23 @@ func NewScriptExecutor(runtime *Runtime) *ScriptExecutor {
 						ActivationType:  el.InputType(),
 					}
 				}
+
+				// Hyperlinks have no pre-click activation; they navigate
+				// after the click unless it is canceled
+				if el.IsHyperlink() {
+					return &ActivationResult{
+						Element:        jsObj,
+						HasActivation:  true,
+						ActivationType: "hyperlink",
+						Event:          event,
+					}
+				}
 			}
 			return nil
 		},
 		// Cancel handler: reverts activation if defaultPrevented
 		func(result *ActivationResult) {
-			if result == nil || !result.HasActivation {
+			if result == nil || !result.HasActivation || result.ActivationType == "hyperlink" {
 				return
 			}
 			// Get the Go element from the JS object
@@ -295,6 +318,10 @@ func NewScriptExecutor(runtime *Runtime) *ScriptExecutor {
 			if !goNode.IsConnected() {
 				return
 			}
+			if result.ActivationType == "hyperlink" {
+				se.followHyperlink((*dom.Element)(goNode), result.Event)
+				return
+			}
 
 			// Fire 'input' event on the element
 			// Per HTML spec, input event bubbles but is not cancelable
@@ -377,13 +404,14 @@ func NewScriptExecutor(runtime *Runtime) *ScriptExecutor {
 	// Create mutation observer manager
 	mutationManager := NewMutationObserverManager()
 
-	se := &ScriptExecutor{
+	se = &ScriptExecutor{
 		runtime:                 runtime,
 		domBinder:               domBinder,
 		eventBinder:             eventBinder,
 		mutationObserverManager: mutationManager,
 		iframeWindows:           make(map[*dom.Element]goja.Value),
 		iframeContents:          make(map[*dom.Element]*iframeContent),
+		viewportManager:         NewViewportManager(runtime, eventBinder),
 	}
 
 	// Set the iframe content provider on DOM binder
@@ -419,9 +447,27 @@ func (se *ScriptExecutor) SetIframeContentLoader(loader IframeContentLoader) {
 // SetStyleResolver sets the style resolver for getComputedStyle.
 func (se *ScriptExecutor) SetStyleResolver(sr *css.StyleResolver) {
 	se.domBinder.SetStyleResolver(sr)
+	se.viewportManager.setStyleResolver(sr)
 	se.setupGetComputedStyle()
 }
 
+// SetViewport resizes the window's viewport. Before the document is set
+// up it takes effect at once; afterwards scripts see the new size, and
+// resize and media query change events fire, at the next rendering
+// opportunity. It is safe to call from any goroutine.
+func (se *ScriptExecutor) SetViewport(vp css.Viewport) {
+	se.viewportManager.SetViewport(vp)
+}
+
+// SetFonts sets the font collection the document is laid out with, which
+// document.fonts reflects. Without one, the document gets its own.
+func (se *ScriptExecutor) SetFonts(fonts *font.Collection) {
+	se.fonts = fonts
+	if se.currentDocument != nil {
+		se.setupFonts(se.currentDocument)
+	}
+}
+
 // setupGetComputedStyle sets up the window.getComputedStyle function.
 func (se *ScriptExecutor) setupGetComputedStyle() {
 	vm := se.runtime.vm
@@ -535,12 +581,20 @@ func (se *ScriptExecutor) SetupDocument(doc *dom.Document) {
 	// Set up window.getSelection() to return the document's selection
 	se.setupGetSelection(doc)
 
+	// Queue selectionchange events and repaint when the selection changes
+	se.setupSelection(doc)
+
 	// Add global addEventListener/removeEventListener/dispatchEvent
 	// These are needed because in browsers, the global scope IS the window,
 	// but in goja they are separate. Many scripts call addEventListener()
 	// without the window. prefix.
 	se.bindGlobalEventTargetMethods()
 
+	// Set up innerWidth, visualViewport and matchMedia
+	if window != nil {
+		se.viewportManager.SetupViewport(window)
+	}
+
 	// Setup XMLHttpRequest with the document's URL as the base
 	se.setupXMLHttpRequest(doc)
 
@@ -553,6 +607,9 @@ func (se *ScriptExecutor) SetupDocument(doc *dom.Document) {
 	// Setup Web Storage API (localStorage/sessionStorage) with the document's URL
 	se.setupStorage(doc)
 
+	// Setup CSS Font Loading API (document.fonts and FontFace)
+	se.setupFonts(doc)
+
 	// Set up named iframe access so iframes with name attributes are accessible as globals
 	se.setupNamedIframeAccess()
 }
@@ -608,7 +665,32 @@ func (se *ScriptExecutor) setupHistory(doc *dom.Document) {
 	}
 
 	se.historyManager = NewHistoryManager(se.runtime, baseURL, documentURL, se.eventBinder)
+	se.historyManager.document = doc
+	se.historyManager.traversalCallback = se.traverseToDocument
+	se.historyManager.sameDocumentCallback = se.traverseWithinDocument
+	if se.sessionHistory != nil {
+		se.historyManager.setSession(se.sessionHistory)
+	}
 	se.historyManager.SetupHistory()
+
+	// The location reflects the document's URL, and setting it navigates
+	lm := se.runtime.LocationManager()
+	if docURL != "" && docURL != "about:blank" {
+		lm.SetURL(docURL)
+	}
+	lm.SetNavigationCallback(se.navigateLocation)
+	lm.SetReloadCallback(se.reload)
+}
+
+// SetSessionHistory makes the document's history use the session history
+// of its browsing context, whose current entry must be the document's.
+// History entries the document adds go there, and traversal reaches the
+// entries of earlier and later documents.
+func (se *ScriptExecutor) SetSessionHistory(session *SessionHistory) {
+	se.sessionHistory = session
+	if se.historyManager != nil {
+		se.historyManager.setSession(session)
+	}
 }
 
 // setupStorage sets up the Web Storage API (localStorage and sessionStorage).
@@ -628,6 +710,23 @@ func (se *ScriptExecutor) setupStorage(doc *dom.Document) {
 	se.storageManager.SetupStorage()
 }
 
+// setupFonts sets up document.fonts and the FontFace constructor.
+func (se *ScriptExecutor) setupFonts(doc *dom.Document) {
+	docURL := doc.URL()
+	var baseURL *url.URL
+	var err error
+
+	if docURL != "" && docURL != "about:blank" {
+		baseURL, err = url.Parse(docURL)
+		if err != nil {
+			baseURL = nil
+		}
+	}
+
+	se.fontManager = NewFontManager(se.runtime, se.fonts, baseURL, se.eventBinder)
+	se.fontManager.SetupFonts()
+}
+
 // setupWindowFrames sets up the window.frames property to provide access to iframe content windows.
 // In browsers, window.frames is an array-like object where frames[i] returns the contentWindow
 // of the i-th iframe element in document order.
@@ -919,7 +1018,7 @@ func (se *ScriptExecutor) getIframeContentWindow(iframe *dom.Element, parentDoc
 func (se *ScriptExecutor) onIframeAdded(iframe *dom.Element) {
 	// Queue a macrotask to fire the load event on the iframe
 	// This simulates the asynchronous nature of iframe loading in browsers
-	se.runtime.eventLoop.queueGoFunc(func() {
+	se.runtime.eventLoop.queueTask(TaskSourceDOMManipulation, func() {
 		se.fireIframeLoadEvent(iframe)
 	})
 }
@@ -921,7 +921,7 @@ func (m *FetchManager) setupAbortController() {
 			// Schedule abort after timeout
 			go func() {
 				time.Sleep(time.Duration(ms) * time.Millisecond)
-				m.runtime.eventLoop.queueGoFunc(func() {
+				m.runtime.eventLoop.queueTask(TaskSourceTimer, func() {
 					if abortFn := signalObj.Get("_abort"); abortFn != nil {
 						if fn, ok := goja.AssertFunction(abortFn); ok {
 							fn(signalObj, vm.NewGoError(timeoutError{message: "The operation timed out."}))
@@ -1235,7 +1235,7 @@ func (m *FetchManager) setupFetchFunction() {
 			abortMu.Unlock()
 
 			if wasAborted {
-				m.runtime.eventLoop.queueGoFunc(func() {
+				m.runtime.eventLoop.queueTask(TaskSourceNetworking, func() {
 					if goja.IsUndefined(reason) || goja.IsNull(reason) {
 						reason = vm.NewGoError(abortError{message: "The operation was aborted."})
 					}
@@ -1245,7 +1245,7 @@ func (m *FetchManager) setupFetchFunction() {
 			}
 
 			if err != nil {
-				m.runtime.eventLoop.queueGoFunc(func() {
+				m.runtime.eventLoop.queueTask(TaskSourceNetworking, func() {
 					rejectPromise(goja.Undefined(), vm.NewTypeError("Network error: "+err.Error()))
 				})
 				return
@@ -1253,14 +1253,14 @@ func (m *FetchManager) setupFetchFunction() {
 
 			// Handle redirect modes
 			if redirect == "error" && (resp.StatusCode >= 300 && resp.StatusCode < 400) {
-				m.runtime.eventLoop.queueGoFunc(func() {
+				m.runtime.eventLoop.queueTask(TaskSourceNetworking, func() {
 					rejectPromise(goja.Undefined(), vm.NewTypeError("Redirect not allowed"))
 				})
 				return
 			}
 
 			// Create Response object
-			m.runtime.eventLoop.queueGoFunc(func() {
+			m.runtime.eventLoop.queueTask(TaskSourceNetworking, func() {
 				// Convert http.Header to map[string][]string
 				headersMap := make(map[string][]string)
 				for name, values := range resp.Headers {
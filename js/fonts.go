@@ -0,0 +1,458 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the CSS Font Loading API.
+package js
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/chrisuehlinger/viberowser/font"
+	"github.com/chrisuehlinger/viberowser/network"
+	"github.com/dop251/goja"
+)
+
+// FontManager manages document.fonts and the FontFace constructor over
+// the font collection a document is laid out with.
+type FontManager struct {
+	runtime     *Runtime
+	fonts       *font.Collection
+	baseURL     *url.URL
+	eventBinder *EventBinder
+
+	set       *goja.Object
+	faceProto *goja.Object
+	objects   map[*font.FontFace]*goja.Object
+	invalid   map[*font.FontFace]bool // faces that failed to parse
+
+	// Loading state of the set, only touched on the event loop
+	loading        bool
+	ready          *goja.Promise
+	resolveReady   func(interface{}) error
+	loaded, failed []*font.FontFace
+}
+
+// NewFontManager creates a new font manager. Without a collection, the
+// document gets one of its own that downloads fonts over the network.
+func NewFontManager(runtime *Runtime, fonts *font.Collection, baseURL *url.URL, eventBinder *EventBinder) *FontManager {
+	if fonts == nil {
+		client, _ := network.NewClient(network.WithFollowRedirect(true))
+		loader := network.NewLoader(client)
+		fonts = font.NewCollection()
+		fonts.SetFallback(font.Default)
+		fonts.SetFetcher(func(url string) ([]byte, error) {
+			resp := loader.LoadFont(context.Background(), url)
+			if !resp.IsSuccess() {
+				if resp.Error != nil {
+					return nil, resp.Error
+				}
+				return nil, fmt.Errorf("failed to load font %s: status %d", url, resp.StatusCode)
+			}
+			return resp.Content, nil
+		})
+	}
+	return &FontManager{
+		runtime:     runtime,
+		fonts:       fonts,
+		baseURL:     baseURL,
+		eventBinder: eventBinder,
+		objects:     make(map[*font.FontFace]*goja.Object),
+		invalid:     make(map[*font.FontFace]bool),
+	}
+}
+
+// SetupFonts installs the FontFace constructor and document.fonts.
+func (m *FontManager) SetupFonts() {
+	m.setupFontFace()
+	m.setupFontFaceSet()
+
+	// Loads finish on other goroutines; the set catches up on the event loop
+	m.fonts.Observe(func(f *font.FontFace) {
+		m.runtime.eventLoop.queueTask(TaskSourceFontLoading, func() {
+			m.faceChanged(f)
+		})
+	})
+}
+
+// setupFontFace installs the FontFace constructor.
+func (m *FontManager) setupFontFace() {
+	vm := m.runtime.VM()
+
+	m.faceProto = vm.NewObject()
+	ctor := vm.ToValue(func(call goja.ConstructorCall) *goja.Object {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("Failed to construct 'FontFace': 2 arguments required"))
+		}
+		desc := font.Descriptors{Family: call.Arguments[0].String()}
+		if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) && !goja.IsNull(call.Arguments[2]) {
+			opts := call.Arguments[2].ToObject(vm)
+			for name, field := range map[string]*string{
+				"style":           &desc.Style,
+				"weight":          &desc.Weight,
+				"stretch":         &desc.Stretch,
+				"unicodeRange":    &desc.UnicodeRange,
+				"featureSettings": &desc.FeatureSettings,
+				"display":         &desc.Display,
+			} {
+				if v := opts.Get(name); v != nil && !goja.IsUndefined(v) {
+					*field = v.String()
+				}
+			}
+		}
+
+		// Binary data is parsed right away; a src string loads on demand
+		var sources []font.Source
+		data, binary := bufferData(call.Arguments[1])
+		if binary {
+			sources = []font.Source{{Data: data}}
+		} else if parsed, err := font.ParseSources(call.Arguments[1].String(), m.baseURL); err == nil {
+			sources = parsed
+		}
+		f := font.NewFontFace(desc, sources)
+		if binary {
+			f.Load(nil)
+		}
+		if f.Status() == font.Error {
+			m.invalid[f] = true
+		}
+		return m.bindFontFace(f, call.This)
+	})
+
+	ctorObj := ctor.ToObject(vm)
+	ctorObj.Set("prototype", m.faceProto)
+	m.faceProto.Set("constructor", ctorObj)
+	vm.Set("FontFace", ctorObj)
+}
+
+// bufferData returns the bytes of an ArrayBuffer or typed array.
+func bufferData(value goja.Value) ([]byte, bool) {
+	switch v := value.Export().(type) {
+	case goja.ArrayBuffer:
+		return v.Bytes(), true
+	case []byte:
+		return v, true
+	}
+	return nil, false
+}
+
+// fontFace returns the JS object of a face, creating it the first time.
+func (m *FontManager) fontFace(f *font.FontFace) *goja.Object {
+	if obj, ok := m.objects[f]; ok {
+		return obj
+	}
+	return m.bindFontFace(f, m.runtime.VM().NewObject())
+}
+
+// bindFontFace sets up obj as the JS object of a face.
+func (m *FontManager) bindFontFace(f *font.FontFace, obj *goja.Object) *goja.Object {
+	vm := m.runtime.VM()
+	obj.SetPrototype(m.faceProto)
+	m.objects[f] = obj
+
+	// Descriptor attributes reject invalid values with a SyntaxError
+	for name, field := range map[string]func(*font.Descriptors) *string{
+		"family":          func(d *font.Descriptors) *string { return &d.Family },
+		"style":           func(d *font.Descriptors) *string { return &d.Style },
+		"weight":          func(d *font.Descriptors) *string { return &d.Weight },
+		"stretch":         func(d *font.Descriptors) *string { return &d.Stretch },
+		"unicodeRange":    func(d *font.Descriptors) *string { return &d.UnicodeRange },
+		"featureSettings": func(d *font.Descriptors) *string { return &d.FeatureSettings },
+		"display":         func(d *font.Descriptors) *string { return &d.Display },
+	} {
+		obj.DefineAccessorProperty(name,
+			vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				desc := f.Descriptors()
+				return vm.ToValue(*field(&desc))
+			}),
+			vm.ToValue(func(call goja.FunctionCall) goja.Value {
+				if len(call.Arguments) < 1 {
+					return goja.Undefined()
+				}
+				desc := f.Descriptors()
+				*field(&desc) = call.Arguments[0].String()
+				if err := f.SetDescriptors(desc); err != nil {
+					panic(m.eventBinder.createDOMException("SyntaxError", err.Error()))
+				}
+				return goja.Undefined()
+			}),
+			goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+
+	obj.DefineAccessorProperty("status", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(f.Status().String())
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// loaded settles once the face has loaded or failed to
+	promise, resolve, reject := vm.NewPromise()
+	go func() {
+		<-f.Done()
+		m.runtime.eventLoop.queueTask(TaskSourceFontLoading, func() {
+			if f.Status() == font.Loaded {
+				resolve(obj)
+			} else {
+				reject(m.loadError(f))
+			}
+		})
+	}()
+	obj.Set("loaded", promise)
+
+	// load() starts loading the face and returns loaded
+	obj.Set("load", func(call goja.FunctionCall) goja.Value {
+		m.fonts.Load(f)
+		return obj.Get("loaded")
+	})
+
+	return obj
+}
+
+// loadError returns the DOMException a face rejects with: a SyntaxError
+// for a face that was invalid from the start, a NetworkError otherwise.
+func (m *FontManager) loadError(f *font.FontFace) goja.Value {
+	name := "NetworkError"
+	if m.invalid[f] {
+		name = "SyntaxError"
+	}
+	return m.eventBinder.createDOMException(name, f.Err().Error())
+}
+
+// setupFontFaceSet installs document.fonts.
+func (m *FontManager) setupFontFaceSet() {
+	vm := m.runtime.VM()
+
+	set := vm.NewObject()
+	m.set = set
+	m.eventBinder.BindEventTarget(set)
+
+	set.DefineAccessorProperty("size", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(len(m.fonts.FontFaces()))
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	set.DefineAccessorProperty("status", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		if m.loading {
+			return vm.ToValue("loading")
+		}
+		return vm.ToValue("loaded")
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// The set starts out loaded, so ready starts out resolved
+	m.ready, m.resolveReady, _ = vm.NewPromise()
+	m.resolveReady(set)
+	set.DefineAccessorProperty("ready", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(m.ready)
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	// add(face) - faces from @font-face rules can't be added again
+	set.Set("add", func(call goja.FunctionCall) goja.Value {
+		f := m.argFontFace(call, "add")
+		if f.CSSConnected {
+			panic(m.eventBinder.createDOMException("InvalidModificationError", "Failed to execute 'add' on 'FontFaceSet': the face comes from an @font-face rule"))
+		}
+		m.fonts.AddFontFace(f)
+		return set
+	})
+
+	// delete(face) - faces from @font-face rules stay in the set
+	set.Set("delete", func(call goja.FunctionCall) goja.Value {
+		f := m.argFontFace(call, "delete")
+		if f.CSSConnected {
+			return vm.ToValue(false)
+		}
+		return vm.ToValue(m.fonts.DeleteFontFace(f))
+	})
+
+	set.Set("has", func(call goja.FunctionCall) goja.Value {
+		f := m.argFontFace(call, "has")
+		return vm.ToValue(slices.Contains(m.fonts.FontFaces(), f))
+	})
+
+	// clear() - removes the faces that were added from script
+	set.Set("clear", func(call goja.FunctionCall) goja.Value {
+		for _, f := range m.fonts.FontFaces() {
+			if !f.CSSConnected {
+				m.fonts.DeleteFontFace(f)
+			}
+		}
+		return goja.Undefined()
+	})
+
+	// forEach(callback[, thisArg])
+	set.Set("forEach", func(call goja.FunctionCall) goja.Value {
+		callback, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(vm.NewTypeError("Failed to execute 'forEach' on 'FontFaceSet': callback is not a function"))
+		}
+		for _, f := range m.fonts.FontFaces() {
+			obj := m.fontFace(f)
+			if _, err := callback(call.Argument(1), obj, obj, set); err != nil {
+				panic(err)
+			}
+		}
+		return goja.Undefined()
+	})
+
+	// Iteration goes over a snapshot of the faces, like a setlike
+	iterator := func(entry func(obj *goja.Object) goja.Value) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			var entries []interface{}
+			for _, f := range m.fonts.FontFaces() {
+				entries = append(entries, entry(m.fontFace(f)))
+			}
+			arr := vm.NewArray(entries...)
+			values, _ := goja.AssertFunction(arr.Get("values"))
+			it, err := values(arr)
+			if err != nil {
+				panic(err)
+			}
+			return it
+		}
+	}
+	values := iterator(func(obj *goja.Object) goja.Value { return obj })
+	set.Set("values", values)
+	set.Set("keys", values)
+	set.Set("entries", iterator(func(obj *goja.Object) goja.Value { return vm.NewArray(obj, obj) }))
+	set.SetSymbol(goja.SymIterator, values)
+
+	// check(font[, text]) - whether text can be rendered without loading
+	set.Set("check", func(call goja.FunctionCall) goja.Value {
+		style, text := m.fontQuery(call, "check")
+		for _, f := range m.fonts.FontFacesFor(style, text) {
+			if f.Status() != font.Loaded {
+				return vm.ToValue(false)
+			}
+		}
+		return vm.ToValue(true)
+	})
+
+	// load(font[, text]) - loads the faces text would use
+	set.Set("load", func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := vm.NewPromise()
+		style, text, err := m.parseFontQuery(call)
+		if err != nil {
+			reject(m.eventBinder.createDOMException("SyntaxError", err.Error()))
+			return vm.ToValue(promise)
+		}
+		faces := m.fonts.FontFacesFor(style, text)
+		for _, f := range faces {
+			m.fonts.Load(f)
+		}
+		go func() {
+			for _, f := range faces {
+				<-f.Done()
+			}
+			m.runtime.eventLoop.queueTask(TaskSourceFontLoading, func() {
+				var objs []interface{}
+				for _, f := range faces {
+					if f.Status() != font.Loaded {
+						reject(m.loadError(f))
+						return
+					}
+					objs = append(objs, m.fontFace(f))
+				}
+				resolve(vm.NewArray(objs...))
+			})
+		}()
+		return vm.ToValue(promise)
+	})
+
+	doc := m.runtime.VM().Get("document")
+	if doc != nil && !goja.IsUndefined(doc) && !goja.IsNull(doc) {
+		doc.ToObject(vm).Set("fonts", set)
+	}
+}
+
+// argFontFace returns the face passed as the first argument of a
+// FontFaceSet method, throwing a TypeError for anything else.
+func (m *FontManager) argFontFace(call goja.FunctionCall, method string) *font.FontFace {
+	if obj, ok := call.Argument(0).(*goja.Object); ok {
+		for f, o := range m.objects {
+			if o == obj {
+				return f
+			}
+		}
+	}
+	panic(m.runtime.VM().NewTypeError(fmt.Sprintf("Failed to execute '%s' on 'FontFaceSet': parameter 1 is not of type 'FontFace'", method)))
+}
+
+// fontQuery parses the font and text arguments of check(), throwing a
+// SyntaxError for an invalid font.
+func (m *FontManager) fontQuery(call goja.FunctionCall, method string) (font.Style, string) {
+	style, text, err := m.parseFontQuery(call)
+	if err != nil {
+		panic(m.eventBinder.createDOMException("SyntaxError", fmt.Sprintf("Failed to execute '%s' on 'FontFaceSet': %v", method, err)))
+	}
+	return style, text
+}
+
+// parseFontQuery parses the font shorthand and optional text arguments of
+// check() and load().
+func (m *FontManager) parseFontQuery(call goja.FunctionCall) (font.Style, string, error) {
+	style, _, err := font.ParseFont(call.Argument(0).String())
+	text := " "
+	if v := call.Argument(1); !goja.IsUndefined(v) {
+		text = v.String()
+	}
+	return style, text, err
+}
+
+// faceChanged updates the loading state of the set after a face started
+// or finished loading. A loading period ends once no face of the set is
+// loading, firing loadingdone and loadingerror and resolving ready.
+func (m *FontManager) faceChanged(f *font.FontFace) {
+	if !slices.Contains(m.fonts.FontFaces(), f) {
+		return
+	}
+	switch f.Status() {
+	case font.Loaded:
+		if !slices.Contains(m.loaded, f) {
+			m.loaded = append(m.loaded, f)
+		}
+	case font.Error:
+		if !slices.Contains(m.failed, f) {
+			m.failed = append(m.failed, f)
+		}
+	}
+
+	loading := m.fonts.Loading()
+	if !m.loading && (loading || len(m.loaded)+len(m.failed) > 0) {
+		m.loading = true
+		m.ready, m.resolveReady, _ = m.runtime.VM().NewPromise()
+		m.dispatch("loading", nil)
+	}
+	if m.loading && !loading {
+		m.loading = false
+		loaded, failed := m.loaded, m.failed
+		m.loaded, m.failed = nil, nil
+		m.dispatch("loadingdone", loaded)
+		if len(failed) > 0 {
+			m.dispatch("loadingerror", failed)
+		}
+		m.resolveReady(m.set)
+	}
+}
+
+// dispatch fires a FontFaceSetLoadEvent on the set.
+func (m *FontManager) dispatch(eventType string, faces []*font.FontFace) {
+	vm := m.runtime.VM()
+
+	event := m.eventBinder.CreateEvent(eventType, map[string]interface{}{
+		"bubbles":    false,
+		"cancelable": false,
+	})
+	if proto := m.eventBinder.GetEventProto("FontFaceSetLoadEvent"); proto != nil {
+		event.SetPrototype(proto)
+	}
+	objs := make([]interface{}, len(faces))
+	for i, f := range faces {
+		objs[i] = m.fontFace(f)
+	}
+	event.Set("fontfaces", vm.NewArray(objs...))
+
+	event.Set("target", m.set)
+	event.Set("currentTarget", m.set)
+	event.Set("eventPhase", int(EventPhaseAtTarget))
+	event.Set("isTrusted", true)
+
+	target := m.eventBinder.GetOrCreateTarget(m.set)
+	target.DispatchEvent(vm, event, EventPhaseAtTarget)
+}
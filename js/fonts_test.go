@@ -0,0 +1,226 @@
+package js
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// setupFontsTest creates a runtime whose document is served by a server
+// that has a font at /font.ttf.
+func setupFontsTest(t *testing.T) *Runtime {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/font.ttf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "font/ttf")
+		w.Write(goregular.TTF)
+	}))
+	t.Cleanup(server.Close)
+
+	runtime := NewRuntime()
+	executor := NewScriptExecutor(runtime)
+	doc := dom.NewDocument()
+	doc.SetURL(server.URL + "/page.html")
+	executor.SetupDocument(doc)
+	runtime.VM().Set("fontData", runtime.VM().NewArrayBuffer(goregular.TTF))
+	return runtime
+}
+
+// waitFor runs the event loop until expr is true.
+func waitFor(t *testing.T, runtime *Runtime, expr string) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		runtime.RunEventLoop()
+		if result, err := runtime.Execute(expr); err == nil && result.ToBoolean() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", expr)
+}
+
+func TestFontFaceConstructor(t *testing.T) {
+	runtime := setupFontsTest(t)
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"typeof FontFace", "function"},
+		{"new FontFace('Test', 'url(font.ttf)') instanceof FontFace", "true"},
+		{"new FontFace('Test', 'url(font.ttf)').family", "Test"},
+		{"new FontFace('Test', 'url(font.ttf)').status", "unloaded"},
+		{"new FontFace('Test', 'url(font.ttf)').weight", "normal"},
+		{"new FontFace('Test', 'url(font.ttf)', {weight: 'bold', unicodeRange: 'U+0-7F'}).weight", "bold"},
+		{"new FontFace('Test', 'url(font.ttf)', {weight: 'bold', unicodeRange: 'U+0-7F'}).unicodeRange", "U+0-7F"},
+		{"new FontFace('Test', 'url(font.ttf)', {display: 'swap'}).display", "swap"},
+		{"new FontFace('Test', 'not a source').status", "error"},
+		{"new FontFace('Test', 'url(font.ttf)', {weight: 'heavy'}).status", "error"},
+		{"new FontFace('Test', fontData).status", "loaded"},
+		{"new FontFace('Test', new Uint8Array(fontData)).status", "loaded"},
+		{"new FontFace('Test', new ArrayBuffer(8)).status", "error"},
+	}
+	for _, tt := range tests {
+		result, err := runtime.Execute(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if result.String() != tt.expected {
+			t.Errorf("%s = %s, want %s", tt.expr, result.String(), tt.expected)
+		}
+	}
+
+	// Invalid descriptor values are rejected by the setters
+	result, err := runtime.Execute(`
+		var face = new FontFace('Test', 'url(font.ttf)');
+		var name = '';
+		try { face.style = 'sideways'; } catch (e) { name = e.name; }
+		face.style = 'italic';
+		name + ' ' + face.style;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.String() != "SyntaxError italic" {
+		t.Errorf("style setter = %q, want %q", result.String(), "SyntaxError italic")
+	}
+}
+
+func TestFontFaceLoad(t *testing.T) {
+	runtime := setupFontsTest(t)
+
+	_, err := runtime.Execute(`
+		var loaded = null, failed = null;
+		var face = new FontFace('Test', 'url(font.ttf)');
+		face.load().then(function(f) { loaded = f; });
+		new FontFace('Missing', 'url(missing.ttf)').load().catch(function(e) { failed = e.name; });
+		new FontFace('Bad', 'not a source').loaded.catch(function(e) { window.bad = e.name; });
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, runtime, "loaded !== null && failed !== null && window.bad !== undefined")
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"loaded === face", "true"},
+		{"face.status", "loaded"},
+		{"failed", "NetworkError"},
+		{"window.bad", "SyntaxError"},
+	}
+	for _, tt := range tests {
+		result, err := runtime.Execute(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if result.String() != tt.expected {
+			t.Errorf("%s = %s, want %s", tt.expr, result.String(), tt.expected)
+		}
+	}
+}
+
+func TestFontFaceSet(t *testing.T) {
+	runtime := setupFontsTest(t)
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"document.fonts.size", "0"},
+		{"document.fonts.status", "loaded"},
+		{"var a = new FontFace('A', 'url(font.ttf)'); document.fonts.add(a) === document.fonts", "true"},
+		{"document.fonts.has(a)", "true"},
+		{"document.fonts.size", "1"},
+		{"var b = new FontFace('B', fontData); document.fonts.add(b); document.fonts.size", "2"},
+		{"var names = []; document.fonts.forEach(function(f) { names.push(f.family); }); names.join()", "A,B"},
+		{"Array.from(document.fonts).map(function(f) { return f.family; }).join()", "A,B"},
+		{"Array.from(document.fonts.values()).length", "2"},
+		{"Array.from(document.fonts.entries())[0][0] === a", "true"},
+		{"document.fonts.check('16px B')", "true"},
+		{"document.fonts.check('16px A')", "false"},
+		{"document.fonts.check('16px Unknown')", "true"},
+		{"document.fonts.delete(a)", "true"},
+		{"document.fonts.delete(a)", "false"},
+		{"document.fonts.has(a)", "false"},
+		{"document.fonts.clear(); document.fonts.size", "0"},
+	}
+	for _, tt := range tests {
+		result, err := runtime.Execute(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if result.String() != tt.expected {
+			t.Errorf("%s = %s, want %s", tt.expr, result.String(), tt.expected)
+		}
+	}
+
+	result, err := runtime.Execute(`
+		var name = '';
+		try { document.fonts.check('not a font'); } catch (e) { name = e.name; }
+		name;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.String() != "SyntaxError" {
+		t.Errorf("check with an invalid font threw %q, want SyntaxError", result.String())
+	}
+}
+
+func TestFontFaceSetLoad(t *testing.T) {
+	runtime := setupFontsTest(t)
+
+	_, err := runtime.Execute(`
+		var events = [];
+		var result = null, ready = false;
+		document.fonts.addEventListener('loading', function(e) { events.push('loading'); });
+		document.fonts.addEventListener('loadingdone', function(e) {
+			events.push('loadingdone:' + e.fontfaces.map(function(f) { return f.family; }).join());
+		});
+		document.fonts.add(new FontFace('Latin', 'url(font.ttf)', {unicodeRange: 'U+0-7F'}));
+		document.fonts.add(new FontFace('Latin', 'url(missing.ttf)', {unicodeRange: 'U+400-4FF'}));
+		document.fonts.load('bold 16px Latin', 'abc').then(function(faces) { result = faces; });
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, runtime, "result !== null && document.fonts.status === 'loaded'")
+	_, err = runtime.Execute("document.fonts.ready.then(function() { ready = true; })")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, runtime, "ready")
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		// Only the face whose unicode-range covers the text is loaded
+		{"result.length", "1"},
+		{"result[0].status", "loaded"},
+		{"events.join(' ')", "loading loadingdone:Latin"},
+		{"Array.from(document.fonts).map(function(f) { return f.status; }).join()", "loaded,unloaded"},
+	}
+	for _, tt := range tests {
+		result, err := runtime.Execute(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if result.String() != tt.expected {
+			t.Errorf("%s = %s, want %s", tt.expr, result.String(), tt.expected)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/chrisuehlinger/viberowser/dom"
 	"github.com/dop251/goja"
 )
 
@@ -15,17 +16,29 @@ type HistoryEntry struct {
 	URL   string
 	Title string // Note: title is largely ignored by browsers per spec
 	State interface{}
+
+	document uint64 // The document the entry belongs to
 }
 
-// HistoryManager manages the History API and session history.
+// HistoryManager manages the History API over the session history of the
+// document's browsing context.
 type HistoryManager struct {
 	runtime     *Runtime
-	entries     []HistoryEntry
-	index       int // Current position in history
+	session     *SessionHistory
+	documentID  uint64        // Entries of the session history that belong to the document
+	document    *dom.Document // The document whose URL the current entry sets (or nil)
 	baseURL     *url.URL
 	documentURL *url.URL
 	eventBinder *EventBinder
 
+	// traversalCallback is called when traversal reaches an entry of
+	// another document, which has to be loaded
+	traversalCallback func(entry HistoryEntry)
+
+	// sameDocumentCallback is called when traversal moves between entries
+	// of the document, after the location was updated
+	sameDocumentCallback func(from, to HistoryEntry)
+
 	// Scroll restoration mode
 	scrollRestoration string // "auto" or "manual"
 
@@ -41,25 +54,40 @@ func NewHistoryManager(runtime *Runtime, baseURL, documentURL *url.URL, eventBin
 
 	hm := &HistoryManager{
 		runtime:           runtime,
-		entries:           make([]HistoryEntry, 0),
-		index:             -1,
 		baseURL:           baseURL,
 		documentURL:       documentURL,
 		eventBinder:       eventBinder,
 		scrollRestoration: "auto",
 	}
 
-	// Add initial entry for the current document
-	hm.entries = append(hm.entries, HistoryEntry{
-		URL:   initialURL,
-		Title: "",
-		State: nil,
-	})
-	hm.index = 0
+	// Until it joins the session history of a browsing context, the
+	// document has one of its own with an initial entry
+	session := NewSessionHistory()
+	session.Navigate(initialURL, false)
+	hm.setSession(session)
 
 	return hm
 }
 
+// setSession makes the history manager use a session history, whose
+// current entry is the document's. An empty session history gets an entry
+// for the document.
+func (m *HistoryManager) setSession(session *SessionHistory) {
+	entry, ok := session.Current()
+	if !ok {
+		initialURL := "about:blank"
+		if m.documentURL != nil {
+			initialURL = m.documentURL.String()
+		}
+		session.Navigate(initialURL, false)
+		entry, _ = session.Current()
+	}
+	m.mu.Lock()
+	m.session = session
+	m.documentID = entry.document
+	m.mu.Unlock()
+}
+
 // SetupHistory installs the history object on the window.
 func (m *HistoryManager) SetupHistory() {
 	vm := m.runtime.VM()
@@ -76,19 +104,12 @@ func (m *HistoryManager) SetupHistory() {
 
 	// history.length - returns the number of entries in the joint session history
 	history.DefineAccessorProperty("length", vm.ToValue(func(call goja.FunctionCall) goja.Value {
-		m.mu.RLock()
-		defer m.mu.RUnlock()
-		return vm.ToValue(len(m.entries))
+		return vm.ToValue(m.session.Len())
 	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
 
 	// history.state - returns the current state object
 	history.DefineAccessorProperty("state", vm.ToValue(func(call goja.FunctionCall) goja.Value {
-		m.mu.RLock()
-		defer m.mu.RUnlock()
-		if m.index < 0 || m.index >= len(m.entries) {
-			return goja.Null()
-		}
-		state := m.entries[m.index].State
+		state := m.GetState()
 		if state == nil {
 			return goja.Null()
 		}
@@ -181,39 +202,29 @@ func (m *HistoryManager) pushState(call goja.FunctionCall) goja.Value {
 		newURL = resolvedURL
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	// Get current URL if not specified
 	if newURL == "" {
-		if m.index >= 0 && m.index < len(m.entries) {
-			newURL = m.entries[m.index].URL
-		} else if m.documentURL != nil {
-			newURL = m.documentURL.String()
-		} else {
-			newURL = "about:blank"
-		}
+		newURL = m.GetCurrentURL()
 	}
 
-	// Truncate forward history
-	if m.index < len(m.entries)-1 {
-		m.entries = m.entries[:m.index+1]
+	// Add new entry after the current one, truncating forward history
+	if m.session.push(HistoryEntry{URL: newURL, Title: title, State: state, document: m.documentID}, false) {
+		// Update document URL and window.location
+		m.updateLocation(newURL)
 	}
 
-	// Add new entry
-	m.entries = append(m.entries, HistoryEntry{
-		URL:   newURL,
-		Title: title,
-		State: state,
-	})
-	m.index = len(m.entries) - 1
-
-	// Update document URL and window.location
-	m.updateLocation(newURL)
-
 	return goja.Undefined()
 }
 
+// pushEntry adds an entry for a URL of the current document to the session
+// history, as navigating to a fragment does, or replaces the current entry
+// with it, and updates the location.
+func (m *HistoryManager) pushEntry(urlStr string, replace bool) {
+	if m.session.push(HistoryEntry{URL: urlStr, document: m.documentID}, replace) {
+		m.updateLocation(urlStr)
+	}
+}
+
 // replaceState replaces the current entry in the session history.
 func (m *HistoryManager) replaceState(call goja.FunctionCall) goja.Value {
 	vm := m.runtime.VM()
@@ -244,32 +255,17 @@ func (m *HistoryManager) replaceState(call goja.FunctionCall) goja.Value {
 		newURL = resolvedURL
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	// Get current URL if not specified
 	if newURL == "" {
-		if m.index >= 0 && m.index < len(m.entries) {
-			newURL = m.entries[m.index].URL
-		} else if m.documentURL != nil {
-			newURL = m.documentURL.String()
-		} else {
-			newURL = "about:blank"
-		}
+		newURL = m.GetCurrentURL()
 	}
 
 	// Replace current entry
-	if m.index >= 0 && m.index < len(m.entries) {
-		m.entries[m.index] = HistoryEntry{
-			URL:   newURL,
-			Title: title,
-			State: state,
-		}
+	if m.session.push(HistoryEntry{URL: newURL, Title: title, State: state, document: m.documentID}, true) {
+		// Update document URL and window.location
+		m.updateLocation(newURL)
 	}
 
-	// Update document URL and window.location
-	m.updateLocation(newURL)
-
 	return goja.Undefined()
 }
 
@@ -286,32 +282,36 @@ func (m *HistoryManager) go_(call goja.FunctionCall) goja.Value {
 		return goja.Undefined()
 	}
 
-	m.mu.Lock()
-	newIndex := m.index + delta
+	m.traverse(delta)
+	return goja.Undefined()
+}
 
-	// Bounds check
-	if newIndex < 0 || newIndex >= len(m.entries) {
-		m.mu.Unlock()
-		return goja.Undefined()
+// traverse moves delta entries through the session history. Between
+// entries of the document the location changes and popstate fires; other
+// documents are loaded through the traversal callback. Traversal beyond
+// either end of the session history does nothing.
+func (m *HistoryManager) traverse(delta int) {
+	from, to, ok := m.session.Traverse(delta)
+	if !ok {
+		return
+	}
+	if to.document != m.documentID {
+		if m.traversalCallback != nil {
+			m.traversalCallback(to)
+		}
+		return
 	}
-
-	m.index = newIndex
-	entry := m.entries[newIndex]
-	m.mu.Unlock()
 
 	// Update location
-	m.mu.Lock()
-	m.updateLocation(entry.URL)
-	m.mu.Unlock()
+	m.updateLocation(to.URL)
 
 	// Fire popstate event asynchronously (per spec)
-	// We use queueGoFunc because we need to call a Go function, not a JS callable
-	state := entry.State // capture for closure
-	m.runtime.eventLoop.queueGoFunc(func() {
-		m.firePopStateEvent(state)
+	m.runtime.eventLoop.queueTask(TaskSourceHistoryTraversal, func() {
+		m.firePopStateEvent(to.State)
 	})
-
-	return goja.Undefined()
+	if m.sameDocumentCallback != nil {
+		m.sameDocumentCallback(from, to)
+	}
 }
 
 // back navigates back one entry.
@@ -366,21 +366,14 @@ func (m *HistoryManager) firePopStateEvent(state interface{}) {
 
 // updateLocation updates the document URL and window.location.
 func (m *HistoryManager) updateLocation(urlStr string) {
-	vm := m.runtime.VM()
-
 	// Update the LocationManager's internal URL state (without triggering navigation)
 	if lm := m.runtime.LocationManager(); lm != nil {
 		lm.UpdateFromURL(urlStr)
 	}
 
-	// Also update document.URL if accessible
-	doc := vm.Get("document")
-	if doc != nil && !goja.IsUndefined(doc) {
-		docObj := doc.ToObject(vm)
-		if docObj != nil {
-			docObj.Set("URL", urlStr)
-			docObj.Set("documentURI", urlStr)
-		}
+	// Also update document.URL
+	if m.document != nil {
+		m.document.SetURL(urlStr)
 	}
 }
 
@@ -445,22 +438,16 @@ func (m *HistoryManager) cloneState(value goja.Value) interface{} {
 
 // GetCurrentURL returns the current URL from the history.
 func (m *HistoryManager) GetCurrentURL() string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	if m.index >= 0 && m.index < len(m.entries) {
-		return m.entries[m.index].URL
+	if entry, ok := m.session.Current(); ok {
+		return entry.URL
 	}
 	return "about:blank"
 }
 
 // GetState returns the current state object.
 func (m *HistoryManager) GetState() interface{} {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	if m.index >= 0 && m.index < len(m.entries) {
-		return m.entries[m.index].State
+	if entry, ok := m.session.Current(); ok {
+		return entry.State
 	}
 	return nil
 }
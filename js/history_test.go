@@ -532,3 +532,87 @@ func TestHistoryManagerDirect(t *testing.T) {
 		}
 	})
 }
+
+func TestSessionHistoryAcrossDocuments(t *testing.T) {
+	session := NewSessionHistory()
+	var requests []NavigationRequest
+	// load sets up a document at the current entry of the session history,
+	// as a tab does after each cross-document navigation
+	load := func(urlStr string) *Runtime {
+		t.Helper()
+		runtime := NewRuntime()
+		executor := NewScriptExecutor(runtime)
+		doc := dom.NewDocument()
+		doc.SetURL(urlStr)
+		executor.SetSessionHistory(session)
+		executor.SetupDocument(doc)
+		executor.SetNavigator(func(req NavigationRequest) {
+			requests = append(requests, req)
+		})
+		if _, err := runtime.Execute(`
+			var log = [];
+			window.addEventListener("popstate", function(e) { log.push("popstate:" + location.pathname + location.hash); });
+			window.addEventListener("hashchange", function(e) { log.push("hashchange:" + e.newURL); });
+		`); err != nil {
+			t.Fatal(err)
+		}
+		return runtime
+	}
+	run := func(runtime *Runtime, script string) string {
+		t.Helper()
+		v, err := runtime.Execute(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for runtime.HasPendingWork() {
+			runtime.RunEventLoop()
+		}
+		return v.String()
+	}
+
+	session.Navigate("https://example.com/a", false)
+	a := load("https://example.com/a")
+	run(a, `history.pushState(null, "", "/a2"); location.hash = "x"`)
+	if got := run(a, `history.length + " " + document.URL`); got != "3 https://example.com/a2#x" {
+		t.Errorf("after pushState and a hash change: %s", got)
+	}
+
+	// Setting the location to another document asks for it to be loaded
+	requests = nil
+	run(a, `location.href = "/b"`)
+	if len(requests) != 1 || requests[0].URL != "https://example.com/b" || requests[0].SameDocument || requests[0].Replace {
+		t.Fatalf("navigations = %+v, want one to /b", requests)
+	}
+	session.Navigate("https://example.com/b", false)
+	b := load("https://example.com/b")
+	if got := run(b, `history.length`); got != "4" {
+		t.Errorf("history.length in the second document = %s, want 4", got)
+	}
+
+	// Going back to an entry of the first document loads it again
+	requests = nil
+	run(b, `history.back()`)
+	if len(requests) != 1 || requests[0].URL != "https://example.com/a2#x" || !requests[0].Traversal {
+		t.Fatalf("navigations = %+v, want a traversal to /a2#x", requests)
+	}
+	if session.Index() != 2 {
+		t.Errorf("session history index = %d, want 2", session.Index())
+	}
+
+	// The reloaded document moves between its entries without loading
+	a = load("https://example.com/a2#x")
+	requests = nil
+	run(a, `history.back()`)
+	run(a, `history.back()`)
+	if got := run(a, `log.join(" ") + " " + document.URL`); got != "popstate:/a2 hashchange:https://example.com/a2 popstate:/a https://example.com/a" {
+		t.Errorf("traversal within the document: %s", got)
+	}
+	for _, req := range requests {
+		if !req.SameDocument {
+			t.Errorf("unexpected cross-document navigation %+v", req)
+		}
+	}
+	if session.Index() != 0 {
+		t.Errorf("session history index = %d, want 0", session.Index())
+	}
+}
@@ -0,0 +1,281 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the hit testing methods of documents and shadow
+// roots: elementFromPoint, elementsFromPoint and caretPositionFromPoint.
+package js
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/dop251/goja"
+)
+
+// HitTester returns the elements whose boxes are at a point of the viewport,
+// topmost first, with each element listed once. It returns false if the
+// point is outside the viewport.
+type HitTester func(x, y float64) (elements []*dom.Element, ok bool)
+
+// ScrollOffset returns how far the page is scrolled under the viewport, in
+// CSS pixels.
+type ScrollOffset func() (x, y float64)
+
+// SetHitTester sets the hit tester the document of the executor uses to find
+// the elements at a point. Without one, no element is at any point.
+func (se *ScriptExecutor) SetHitTester(h HitTester) {
+	se.domBinder.SetHitTester(h)
+}
+
+// SetScrollOffset sets how the executor learns how far the page is
+// scrolled, to map points of the viewport to the page. Without it the page
+// is not scrolled.
+func (se *ScriptExecutor) SetScrollOffset(offset ScrollOffset) {
+	se.domBinder.SetScrollOffset(offset)
+}
+
+// SetHitTester sets the hit tester for elementFromPoint and
+// caretPositionFromPoint.
+func (b *DOMBinder) SetHitTester(h HitTester) {
+	b.hitTester = h
+}
+
+// SetScrollOffset sets how far the page is scrolled under the viewport the
+// hit tester tests.
+func (b *DOMBinder) SetScrollOffset(offset ScrollOffset) {
+	b.scrollOffset = offset
+}
+
+// scrolled returns how far the page is scrolled under the viewport.
+func (b *DOMBinder) scrolled() (x, y float64) {
+	if b.scrollOffset == nil {
+		return 0, 0
+	}
+	return b.scrollOffset()
+}
+
+// hitTest returns the elements at a point of the viewport of the document,
+// topmost first, ending with the root element. It returns false if the
+// point is outside the viewport.
+// Reference: https://drafts.csswg.org/cssom-view/#dom-document-elementsfrompoint
+func (b *DOMBinder) hitTest(doc *dom.Document, x, y float64) ([]*dom.Element, bool) {
+	if b.hitTester == nil || math.IsNaN(x) || math.IsNaN(y) || x < 0 || y < 0 {
+		return nil, false
+	}
+	elements, ok := b.hitTester(x, y)
+	if !ok {
+		return nil, false
+	}
+	if doc == nil {
+		return elements, true
+	}
+	// Boxes laid out for another document, such as that of an earlier
+	// navigation, are not hit
+	hits := elements[:0:0]
+	for _, el := range elements {
+		if el.AsNode().OwnerDocument() == doc && el.AsNode().IsConnected() {
+			hits = append(hits, el)
+		}
+	}
+	if root := doc.DocumentElement(); root != nil && (len(hits) == 0 || hits[len(hits)-1] != root) {
+		hits = append(hits, root)
+	}
+	return hits, true
+}
+
+// bindHitTesting adds elementFromPoint and elementsFromPoint to a document
+// or shadow root. Elements inside shadow trees are retargeted against the
+// root, so a document sees the hosts of the shadow trees it was hit in.
+// Reference: https://drafts.csswg.org/cssom-view/#extensions-to-the-documentorshadowroot-interface
+func (b *DOMBinder) bindHitTesting(obj *goja.Object, root *dom.Node) {
+	vm := b.runtime.vm
+	document := func() *dom.Document {
+		if root.NodeType() == dom.DocumentNode {
+			return (*dom.Document)(root)
+		}
+		return root.OwnerDocument()
+	}
+	point := func(method string, call goja.FunctionCall) (float64, float64) {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("Failed to execute '%s': 2 arguments required, but only %d present.", method, len(call.Arguments)))
+		}
+		return call.Arguments[0].ToFloat(), call.Arguments[1].ToFloat()
+	}
+	elementsAt := func(x, y float64) []*dom.Element {
+		hits, _ := b.hitTest(document(), x, y)
+		var elements []*dom.Element
+		seen := map[*dom.Element]bool{}
+		for _, hit := range hits {
+			if el := retargetElement(hit, root); !seen[el] {
+				seen[el] = true
+				elements = append(elements, el)
+			}
+		}
+		return elements
+	}
+
+	obj.Set("elementFromPoint", func(call goja.FunctionCall) goja.Value {
+		elements := elementsAt(point("elementFromPoint", call))
+		if len(elements) == 0 {
+			return goja.Null()
+		}
+		return b.BindElement(elements[0])
+	})
+
+	obj.Set("elementsFromPoint", func(call goja.FunctionCall) goja.Value {
+		elements := elementsAt(point("elementsFromPoint", call))
+		values := make([]interface{}, len(elements))
+		for i, el := range elements {
+			values[i] = b.BindElement(el)
+		}
+		return vm.NewArray(values...)
+	})
+}
+
+// bindCaretPositionFromPoint adds caretPositionFromPoint to a document.
+// Reference: https://drafts.csswg.org/cssom-view/#dom-document-caretpositionfrompoint
+func (b *DOMBinder) bindCaretPositionFromPoint(obj *goja.Object, doc *dom.Document) {
+	vm := b.runtime.vm
+	obj.Set("caretPositionFromPoint", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 2 {
+			panic(vm.NewTypeError("Failed to execute 'caretPositionFromPoint' on 'Document': 2 arguments required, but only %d present.", len(call.Arguments)))
+		}
+		x, y := call.Arguments[0].ToFloat(), call.Arguments[1].ToFloat()
+		hits, _ := b.hitTest(doc, x, y)
+		if len(hits) == 0 {
+			return goja.Null()
+		}
+		// Text is laid out in the coordinates of the page, and the caret's
+		// rectangle is given in those of the viewport
+		scrollX, scrollY := b.scrolled()
+		node, offset, rect := caretPosition(hits[0], x+scrollX, y+scrollY)
+		if rect != nil {
+			rect = dom.NewDOMRect(rect.X-scrollX, rect.Y-scrollY, rect.Width, rect.Height)
+		}
+
+		// Carets in shadow trees that were not passed in move before their
+		// host
+		shadowRoots := map[*dom.Node]bool{}
+		if len(call.Arguments) > 2 {
+			if options, ok := call.Arguments[2].(*goja.Object); ok {
+				if list, ok := options.Get("shadowRoots").(*goja.Object); ok {
+					length := int(list.Get("length").ToInteger())
+					for i := 0; i < length; i++ {
+						if sr, ok := list.Get(strconv.Itoa(i)).(*goja.Object); ok {
+							if n := b.getGoNode(sr); n != nil && n.IsShadowRoot() {
+								shadowRoots[n] = true
+							}
+						}
+					}
+				}
+			}
+		}
+		for {
+			shadow := node.GetRootNode()
+			if !shadow.IsShadowRoot() || shadowRoots[shadow] || shadow.GetShadowRoot().Host() == nil {
+				break
+			}
+			host := shadow.GetShadowRoot().Host().AsNode()
+			if host.ParentNode() == nil {
+				break
+			}
+			node, offset = host.ParentNode(), nodeIndex(host)
+			rect = nil
+		}
+		return b.bindCaretPosition(node, offset, rect)
+	})
+}
+
+// bindCaretPosition creates a CaretPosition for an offset in a node. Its
+// getClientRect returns the caret's rectangle, or null if it has none.
+func (b *DOMBinder) bindCaretPosition(node *dom.Node, offset int, rect *dom.DOMRect) goja.Value {
+	vm := b.runtime.vm
+	position := vm.NewObject()
+	position.Set("offsetNode", b.BindNode(node))
+	position.Set("offset", offset)
+	position.Set("getClientRect", func(call goja.FunctionCall) goja.Value {
+		if rect == nil {
+			return goja.Null()
+		}
+		return b.BindDOMRect(dom.NewDOMRect(rect.X, rect.Y, rect.Width, rect.Height))
+	})
+	return position
+}
+
+// caretPosition returns the caret position closest to a point in the text
+// of an element: on the line containing the point, or else the nearest
+// line, at the caret nearest to the point along it. An element without text
+// has its caret at its start.
+func caretPosition(el *dom.Element, x, y float64) (*dom.Node, int, *dom.DOMRect) {
+	var best *dom.Node
+	var bestFragment dom.TextFragment
+	bestDX, bestDY := math.Inf(1), math.Inf(1)
+	var visit func(n *dom.Node)
+	visit = func(n *dom.Node) {
+		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+			if child.NodeType() != dom.TextNode {
+				visit(child)
+				continue
+			}
+			for _, f := range (*dom.Text)(child).TextFragments() {
+				if len(f.Carets) != f.End-f.Start+1 {
+					continue
+				}
+				dx, dy := distanceToSpan(x, f.X, f.Width), distanceToSpan(y, f.Y, f.Height)
+				if dy < bestDY || (dy == bestDY && dx < bestDX) {
+					best, bestFragment, bestDX, bestDY = child, f, dx, dy
+				}
+			}
+		}
+	}
+	visit(el.AsNode())
+	if best == nil {
+		return el.AsNode(), 0, nil
+	}
+	f := bestFragment
+	index := 0
+	for i, caret := range f.Carets {
+		if math.Abs(caret-x) < math.Abs(f.Carets[index]-x) {
+			index = i
+		}
+	}
+	return best, f.Start + index, dom.NewDOMRect(f.Carets[index], f.Y, 0, f.Height)
+}
+
+// distanceToSpan returns how far a coordinate is outside the span from start
+// with the given size, zero inside it.
+func distanceToSpan(v, start, size float64) float64 {
+	switch {
+	case v < start:
+		return start - v
+	case v > start+size:
+		return v - start - size
+	}
+	return 0
+}
+
+// retargetElement retargets an element against a node: while the element is
+// in a shadow tree that does not contain the node, it is replaced by the
+// host of that tree.
+// Reference: https://dom.spec.whatwg.org/#retarget
+func retargetElement(el *dom.Element, against *dom.Node) *dom.Element {
+	for {
+		root := el.AsNode().GetRootNode()
+		if !root.IsShadowRoot() || root.IsShadowIncludingAncestorOf(against) {
+			return el
+		}
+		host := root.GetShadowRoot().Host()
+		if host == nil {
+			return el
+		}
+		el = host
+	}
+}
+
+// nodeIndex returns the index of a node among its siblings.
+func nodeIndex(n *dom.Node) int {
+	index := 0
+	for sibling := n.PreviousSibling(); sibling != nil; sibling = sibling.PreviousSibling() {
+		index++
+	}
+	return index
+}
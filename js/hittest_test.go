@@ -0,0 +1,141 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// newHitTestExecutor sets up a document with a card on the left and a shadow
+// host on the right, and a hit tester that places them side by side in a
+// 300px wide viewport.
+func newHitTestExecutor(t *testing.T) (*ScriptExecutor, *dom.Document) {
+	t.Helper()
+	executor, doc, _ := newEventTestExecutor(t, `<div id="card"><span id="label">Hello</span></div><div id="host"></div>`)
+	_, err := executor.Runtime().Execute(`
+		var host = document.getElementById("host");
+		var shadow = host.attachShadow({mode: "open"});
+		shadow.innerHTML = '<b id="inner">x</b>';
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	card, label, host := doc.GetElementById("card"), doc.GetElementById("label"), doc.GetElementById("host")
+	inner := host.ShadowRoot().GetElementById("inner")
+	body, html := doc.Body(), doc.DocumentElement()
+	executor.SetHitTester(func(x, y float64) ([]*dom.Element, bool) {
+		switch {
+		case x >= 300:
+			return nil, false
+		case x < 100:
+			return []*dom.Element{label, card, body, html}, true
+		case x < 200:
+			return []*dom.Element{inner, host, body, html}, true
+		}
+		return []*dom.Element{body, html}, true
+	})
+	return executor, doc
+}
+
+func TestElementFromPoint(t *testing.T) {
+	executor, _ := newHitTestExecutor(t)
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{`document.elementFromPoint(10, 10).id`, "label"},
+		{`document.elementsFromPoint(10, 10).map(function(e) { return e.tagName; }).join()`, "SPAN,DIV,BODY,HTML"},
+		{`document.elementFromPoint(250, 10).tagName`, "BODY"},
+		{`document.elementFromPoint(500, 10)`, "null"},
+		{`document.elementFromPoint(-1, 10)`, "null"},
+		{`document.elementsFromPoint(500, 10).length`, "0"},
+		// Elements in shadow trees are retargeted to their hosts
+		{`document.elementFromPoint(150, 10).id`, "host"},
+		{`document.elementsFromPoint(150, 10).map(function(e) { return e.id; }).join()`, "host,,"},
+		{`shadow.elementFromPoint(150, 10).id`, "inner"},
+		{`shadow.elementsFromPoint(150, 10).map(function(e) { return e.tagName; }).join()`, "B,DIV,BODY,HTML"},
+		{`shadow.elementFromPoint(10, 10).id`, "label"},
+	}
+	for _, tt := range tests {
+		v, err := executor.Runtime().Execute(tt.script)
+		if err != nil {
+			t.Errorf("%s: %v", tt.script, err)
+			continue
+		}
+		if got := v.String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestElementFromPointWithoutHitTester(t *testing.T) {
+	executor := NewScriptExecutor(NewRuntime())
+	doc, err := dom.ParseHTML(`<!DOCTYPE html><html><body></body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor.SetupDocument(doc)
+	v, err := executor.Runtime().Execute(`String(document.elementFromPoint(1, 1)) + " " + document.elementsFromPoint(1, 1).length`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "null 0" {
+		t.Errorf("got %q, want %q", got, "null 0")
+	}
+}
+
+func TestCaretPositionFromPoint(t *testing.T) {
+	executor, doc := newHitTestExecutor(t)
+	text := (*dom.Text)(doc.GetElementById("label").AsNode().FirstChild())
+	text.SetTextFragments([]dom.TextFragment{
+		{X: 0, Y: 0, Width: 30, Height: 10, Start: 0, End: 5, Carets: []float64{0, 6, 12, 18, 24, 30}},
+	})
+
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{`var p = document.caretPositionFromPoint(13, 5); p.offsetNode.data + ":" + p.offset + ":" + p.getClientRect().left`, "Hello:2:12"},
+		// Beyond the end of the text the caret is at its end
+		{`document.caretPositionFromPoint(80, 40).offset`, "5"},
+		{`document.caretPositionFromPoint(500, 5)`, "null"},
+		// A caret in a shadow tree moves before its host unless the shadow
+		// root is passed in
+		{`var p = document.caretPositionFromPoint(150, 5); p.offsetNode.tagName + ":" + p.offset + ":" + p.getClientRect()`, "BODY:1:null"},
+		{`var p = document.caretPositionFromPoint(150, 5, {shadowRoots: [shadow]}); p.offsetNode.id + ":" + p.offset`, "inner:0"},
+	}
+	for _, tt := range tests {
+		v, err := executor.Runtime().Execute(tt.script)
+		if err != nil {
+			t.Errorf("%s: %v", tt.script, err)
+			continue
+		}
+		if got := v.String(); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestCaretPositionFromScrolledPoint(t *testing.T) {
+	executor, doc := newHitTestExecutor(t)
+	text := (*dom.Text)(doc.GetElementById("label").AsNode().FirstChild())
+	text.SetTextFragments([]dom.TextFragment{
+		{X: 0, Y: 0, Width: 12, Height: 10, Start: 0, End: 2, Carets: []float64{0, 6, 12}},
+		{X: 0, Y: 200, Width: 18, Height: 10, Start: 2, End: 5, Carets: []float64{0, 6, 12, 18}},
+	})
+	executor.SetScrollOffset(func() (float64, float64) { return 0, 195 })
+
+	// The point is on the second line of the page, whose caret is given
+	// in the coordinates of the viewport
+	v, err := executor.Runtime().Execute(`
+		var p = document.caretPositionFromPoint(13, 10), r = p.getClientRect();
+		p.offset + ":" + r.left + "," + r.top;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "4:12,5" {
+		t.Errorf("caret = %q, want 4:12,5", got)
+	}
+}
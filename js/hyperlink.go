@@ -0,0 +1,253 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the navigations a document starts by following
+// hyperlinks, setting its location and traversing the session history,
+// including those that stay within the document.
+package js
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/dop251/goja"
+)
+
+// NavigationRequest describes a navigation started by a document.
+type NavigationRequest struct {
+	URL          string // Absolute URL to navigate to
+	Target       string // Browsing context to navigate: "" for the document's own, "_blank" for a new one, or a name
+	NoOpener     bool   // Whether a new browsing context is opened without an opener
+	Referrer     string // URL of the document that started the navigation, or "" for rel=noreferrer
+	Download     bool   // Whether the resource is downloaded rather than navigated to
+	Filename     string // Suggested filename of a download, from the download attribute
+	Replace      bool   // Whether the new document replaces the current entry of the session history rather than adding one
+	Traversal    bool   // Whether traversal of the session history made the entry of the URL current, so no entry is added
+	SameDocument bool   // Whether the navigation only moved within the document, which is already done
+}
+
+// Navigator performs the navigations documents request.
+type Navigator func(req NavigationRequest)
+
+// SetNavigator sets the callback that performs the navigations started by
+// following hyperlinks, setting the location and traversing the session
+// history. Without one, only navigations within the document take place.
+func (se *ScriptExecutor) SetNavigator(navigator Navigator) {
+	se.navigator = navigator
+}
+
+// followHyperlink follows an a or area element whose activation behavior
+// was not canceled. The click's modifier keys open the link in a new
+// browsing context.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/links.html#following-hyperlinks-2
+func (se *ScriptExecutor) followHyperlink(el *dom.Element, click *goja.Object) {
+	doc := el.AsNode().OwnerDocument()
+	if doc == nil || doc != se.currentDocument {
+		return
+	}
+	href := strings.TrimSpace(el.GetAttribute("href"))
+	base, err := url.Parse(doc.BaseURL())
+	if err != nil {
+		return
+	}
+	dest, err := base.Parse(href)
+	if err != nil {
+		return
+	}
+
+	target := doc.BaseTarget()
+	if el.HasAttribute("target") {
+		target = el.GetAttribute("target")
+	}
+	switch strings.ToLower(target) {
+	case "", "_self", "_parent", "_top":
+		// The document is in a top-level browsing context
+		target = ""
+	case "_blank":
+		target = "_blank"
+	}
+	if click != nil && (eventFlag(click, "ctrlKey") || eventFlag(click, "metaKey") || eventFlag(click, "shiftKey")) {
+		target = "_blank"
+	}
+
+	if dest.Scheme == "javascript" {
+		if target == "" {
+			se.runJavaScriptURL(href)
+		}
+		return
+	}
+
+	rel := map[string]bool{}
+	for _, token := range strings.Fields(strings.ToLower(el.GetAttribute("rel"))) {
+		rel[token] = true
+	}
+	req := NavigationRequest{
+		URL:      dest.String(),
+		Target:   target,
+		NoOpener: rel["noopener"] || rel["noreferrer"] || (target == "_blank" && !rel["opener"]),
+	}
+	if !rel["noreferrer"] {
+		req.Referrer = withoutFragment(doc.URL())
+	}
+
+	// Only resources of the document's origin are downloaded, others are
+	// navigated to
+	if el.HasAttribute("download") && (dest.Scheme == "data" || dest.Scheme == "blob" || sameOrigin(dest, doc.URL())) {
+		req.Download = true
+		req.Filename = el.GetAttribute("download")
+	} else if target == "" && isFragmentNavigation(doc, dest, href) {
+		se.navigateToFragment(doc, dest, false)
+		req.SameDocument = true
+	}
+	se.navigate(req)
+}
+
+// navigateLocation navigates the document's browsing context to a URL set
+// as its location, replacing the current entry of the session history if
+// replace is true. URLs that differ from the document's only in their
+// fragment navigate within the document.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/nav-history-apis.html#location-object-navigate
+func (se *ScriptExecutor) navigateLocation(urlStr string, replace bool) {
+	doc := se.currentDocument
+	dest, err := url.Parse(urlStr)
+	if doc == nil || err != nil {
+		return
+	}
+	req := NavigationRequest{URL: dest.String(), Replace: replace, Referrer: withoutFragment(doc.URL())}
+	if isFragmentNavigation(doc, dest, urlStr) {
+		se.navigateToFragment(doc, dest, replace)
+		req.SameDocument = true
+	}
+	se.navigate(req)
+}
+
+// reload loads the document's URL again in place of the document.
+func (se *ScriptExecutor) reload() {
+	if doc := se.currentDocument; doc != nil {
+		se.navigate(NavigationRequest{URL: doc.URL(), Replace: true})
+	}
+}
+
+// TraverseHistory moves delta entries through the session history, as
+// history.go(delta) does. Entries of the document become current without
+// loading it again; other entries are loaded by the navigator.
+func (se *ScriptExecutor) TraverseHistory(delta int) {
+	if se.historyManager != nil {
+		se.historyManager.traverse(delta)
+	}
+}
+
+// traverseToDocument loads the entry of another document that traversal
+// of the session history made current.
+func (se *ScriptExecutor) traverseToDocument(entry HistoryEntry) {
+	se.navigate(NavigationRequest{URL: entry.URL, Traversal: true})
+}
+
+// traverseWithinDocument updates the document after traversal of the
+// session history moved between two of its entries: the :target follows
+// the URL's fragment, and hashchange fires if only the fragment changed.
+func (se *ScriptExecutor) traverseWithinDocument(from, to HistoryEntry) {
+	doc := se.currentDocument
+	dest, err := url.Parse(to.URL)
+	if doc == nil || err != nil {
+		return
+	}
+	doc.SetTargetElement(doc.IndicatedElement(dest.EscapedFragment()))
+	if from.URL != to.URL && withoutFragment(from.URL) == withoutFragment(to.URL) {
+		se.QueueTask(TaskSourceDOMManipulation, func() {
+			se.fireHashChange(from.URL, to.URL)
+		})
+	}
+	se.navigate(NavigationRequest{URL: to.URL, Traversal: true, SameDocument: true})
+}
+
+// navigate passes a navigation to the navigator.
+func (se *ScriptExecutor) navigate(req NavigationRequest) {
+	if se.navigator != nil {
+		se.navigator(req)
+	}
+}
+
+// isFragmentNavigation reports whether navigating a document to a URL only
+// moves to a fragment of it: the URL has a fragment, possibly empty, and
+// is otherwise the document's.
+func isFragmentNavigation(doc *dom.Document, dest *url.URL, raw string) bool {
+	return (dest.Fragment != "" || strings.HasSuffix(strings.TrimSpace(raw), "#")) &&
+		withoutFragment(dest.String()) == withoutFragment(doc.URL())
+}
+
+// navigateToFragment moves the document to a fragment of its URL: the URL
+// changes and gets a history entry, or replaces the current one, the
+// element the fragment indicates becomes the :target, and hashchange fires
+// if the fragment changed.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/browsing-the-web.html#navigate-fragid
+func (se *ScriptExecutor) navigateToFragment(doc *dom.Document, dest *url.URL, replace bool) {
+	oldURL, newURL := doc.URL(), dest.String()
+	doc.SetTargetElement(doc.IndicatedElement(dest.EscapedFragment()))
+	if newURL == oldURL {
+		return
+	}
+	doc.SetURL(newURL)
+	if se.historyManager != nil {
+		se.historyManager.pushEntry(newURL, replace)
+	} else {
+		se.runtime.LocationManager().UpdateFromURL(newURL)
+	}
+	se.QueueTask(TaskSourceDOMManipulation, func() {
+		se.fireHashChange(oldURL, newURL)
+	})
+}
+
+// fireHashChange fires hashchange at the window.
+func (se *ScriptExecutor) fireHashChange(oldURL, newURL string) {
+	vm := se.runtime.vm
+	window := vm.Get("window")
+	if window == nil || goja.IsUndefined(window) {
+		return
+	}
+	ctor, ok := goja.AssertConstructor(vm.Get("HashChangeEvent"))
+	if !ok {
+		return
+	}
+	options := vm.NewObject()
+	options.Set("oldURL", oldURL)
+	options.Set("newURL", newURL)
+	event, err := ctor(nil, vm.ToValue("hashchange"), options)
+	if err != nil {
+		return
+	}
+	se.eventBinder.DispatchTrustedEvent(window.ToObject(vm), event)
+}
+
+// runJavaScriptURL runs the script of a javascript: URL in a task.
+func (se *ScriptExecutor) runJavaScriptURL(href string) {
+	script := href[strings.IndexByte(href, ':')+1:]
+	if unescaped, err := url.PathUnescape(script); err == nil {
+		script = unescaped
+	}
+	se.QueueTask(TaskSourceDOMManipulation, func() {
+		se.runtime.Execute(script)
+	})
+}
+
+// eventFlag returns a boolean property of an event.
+func eventFlag(event *goja.Object, name string) bool {
+	v := event.Get(name)
+	return v != nil && v.ToBoolean()
+}
+
+// withoutFragment returns a URL with its fragment removed.
+func withoutFragment(urlStr string) string {
+	if i := strings.IndexByte(urlStr, '#'); i >= 0 {
+		return urlStr[:i]
+	}
+	return urlStr
+}
+
+// sameOrigin reports whether a URL has the origin of another.
+func sameOrigin(u *url.URL, other string) bool {
+	o, err := url.Parse(other)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == o.Scheme && u.Host == o.Host && u.Scheme != "about"
+}
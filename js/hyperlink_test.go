@@ -0,0 +1,96 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// newHyperlinkTestExecutor sets up a document at a URL, and returns the
+// navigations its hyperlinks request.
+func newHyperlinkTestExecutor(t *testing.T, body string) (*ScriptExecutor, *dom.Document, *[]NavigationRequest) {
+	t.Helper()
+	executor := NewScriptExecutor(NewRuntime())
+	doc, err := dom.ParseHTML("<!DOCTYPE html><html><head><base href=\"/docs/\"></head><body>" + body + "</body></html>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.SetURL("https://example.com/page.html")
+	executor.Runtime().LocationManager().SetURL(doc.URL())
+	executor.SetupDocument(doc)
+	var requests []NavigationRequest
+	executor.SetNavigator(func(req NavigationRequest) {
+		requests = append(requests, req)
+	})
+	return executor, doc, &requests
+}
+
+func TestFollowingHyperlinks(t *testing.T) {
+	executor, doc, requests := newHyperlinkTestExecutor(t, `<a id="plain" href="guide.html"><span id="label">x</span></a>`+
+		`<a id="blank" href="https://other.example/" target="_BLANK"></a>`+
+		`<a id="named" href="/named" target="help" rel="noreferrer"></a>`+
+		`<a id="canceled" href="/canceled" onclick="event.preventDefault()"></a>`+
+		`<a id="download" href="/files/report.pdf" download="q3.pdf"></a>`+
+		`<a id="crossorigin" href="https://other.example/report.pdf" download></a>`+
+		`<a id="nohref">no href</a>`)
+
+	// The user clicks a descendant of the link
+	label := doc.GetElementById("label")
+	executor.MouseDown(label, MouseInput{})
+	executor.MouseUp(label, MouseInput{})
+	if _, err := executor.Runtime().Execute(`
+		["blank", "named", "canceled", "download", "crossorigin", "nohref"].forEach(function(id) {
+			document.getElementById(id).click();
+		});
+	`); err != nil {
+		t.Fatal(err)
+	}
+	executor.MouseDown(label, MouseInput{CtrlKey: true})
+	executor.MouseUp(label, MouseInput{CtrlKey: true})
+
+	want := []NavigationRequest{
+		{URL: "https://example.com/docs/guide.html", Referrer: "https://example.com/page.html"},
+		{URL: "https://other.example/", Target: "_blank", NoOpener: true, Referrer: "https://example.com/page.html"},
+		{URL: "https://example.com/named", Target: "help", NoOpener: true},
+		{URL: "https://example.com/files/report.pdf", Referrer: "https://example.com/page.html", Download: true, Filename: "q3.pdf"},
+		{URL: "https://other.example/report.pdf", Referrer: "https://example.com/page.html"},
+		{URL: "https://example.com/docs/guide.html", Target: "_blank", NoOpener: true, Referrer: "https://example.com/page.html"},
+	}
+	if len(*requests) != len(want) {
+		t.Fatalf("got %d navigations %+v, want %d", len(*requests), *requests, len(want))
+	}
+	for i, req := range *requests {
+		if req != want[i] {
+			t.Errorf("navigation %d = %+v, want %+v", i, req, want[i])
+		}
+	}
+}
+
+func TestFragmentNavigation(t *testing.T) {
+	executor, doc, requests := newHyperlinkTestExecutor(t, `<a id="link" href="/page.html#notes">notes</a><h2 id="notes">Notes</h2>`)
+	if _, err := executor.Runtime().Execute(`
+		var changes = [];
+		window.addEventListener("hashchange", function(e) { changes.push(e.oldURL + " " + e.newURL); });
+		document.getElementById("link").click();
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 || !(*requests)[0].SameDocument {
+		t.Fatalf("navigations = %+v, want one to the same document", *requests)
+	}
+	if got := doc.URL(); got != "https://example.com/page.html#notes" {
+		t.Errorf("document URL = %s", got)
+	}
+	if doc.TargetElement() != doc.GetElementById("notes") {
+		t.Errorf("target element = %v, want #notes", doc.TargetElement())
+	}
+	executor.RunEventLoopOnce()
+	v, err := executor.Runtime().Execute(`location.hash + " " + history.length + " " + changes.join()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "#notes 2 https://example.com/page.html https://example.com/page.html#notes"
+	if got := v.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
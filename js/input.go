@@ -0,0 +1,349 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the dispatch of mouse input to the elements of a
+// document as pointer, mouse and wheel events.
+package js
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/dop251/goja"
+)
+
+// Values of the button property of mouse events.
+const (
+	MouseButtonPrimary   = 0
+	MouseButtonAuxiliary = 1
+	MouseButtonSecondary = 2
+)
+
+// Clicks closer together than this, in time and in pixels, count as one
+// multi-click such as a double click.
+const (
+	multiClickInterval = 500 * time.Millisecond
+	multiClickDistance = 4
+)
+
+// MouseInput describes mouse input at a point of the viewport.
+type MouseInput struct {
+	ClientX, ClientY float64 // Position in the viewport
+	PageX, PageY     float64 // Position in the page, which text is placed in
+	ScreenX, ScreenY float64 // Position on the screen
+	Button           int     // The button pressed or released, one of the MouseButton values
+
+	CtrlKey, ShiftKey, AltKey, MetaKey bool
+
+	DeltaX, DeltaY float64 // Distance scrolled by wheel input, in pixels
+}
+
+// mouseState tracks the mouse of a document across input events.
+type mouseState struct {
+	buttons    int          // Bitmask of the buttons held down
+	pressed    *dom.Element // Target of the last mousedown
+	suppressed bool         // Whether pointerdown was canceled, which suppresses mouse events until pointerup
+	selecting  bool         // Whether the primary button is selecting text
+
+	// The last press, for counting multi-clicks
+	clickTarget    *dom.Element
+	clickTime      time.Time
+	clickX, clickY float64
+	clickCount     int
+}
+
+// buttonBit returns the bit of a button in the buttons property of mouse
+// events.
+// Reference: https://w3c.github.io/uievents/#dom-mouseevent-buttons
+func buttonBit(button int) int {
+	switch button {
+	case MouseButtonPrimary:
+		return 1
+	case MouseButtonSecondary:
+		return 2
+	case MouseButtonAuxiliary:
+		return 4
+	}
+	return 1 << button
+}
+
+// QueueTask queues a function to run as a task of a task source of the
+// event loop. Work from other goroutines, such as user input, reaches the
+// page this way.
+func (se *ScriptExecutor) QueueTask(source TaskSource, fn func()) {
+	se.runtime.eventLoop.queueTask(source, fn)
+}
+
+// MouseMove dispatches the events for the mouse moving to a point over the
+// target element: the transition events if it entered a different element,
+// then pointermove and mousemove.
+func (se *ScriptExecutor) MouseMove(target *dom.Element, in MouseInput) {
+	se.updateHover(target, in)
+	if target == nil {
+		return
+	}
+	se.extendSelection(target, in)
+	in.Button = -1
+	se.dispatchMouseEvent(target, "pointermove", in, nil)
+	if !se.mouse.suppressed {
+		in.Button = 0
+		se.dispatchMouseEvent(target, "mousemove", in, nil)
+	}
+}
+
+// MouseLeave dispatches the transition events for the mouse leaving the
+// document.
+func (se *ScriptExecutor) MouseLeave(in MouseInput) {
+	se.updateHover(nil, in)
+}
+
+// MouseDown dispatches the events for a button pressed over the target
+// element. The first button pressed fires pointerdown, which cancels the
+// mousedown when canceled; the secondary button also opens a contextmenu.
+// Unless the mousedown is canceled, the primary button moves the focus to
+// the element and starts selecting text, and the element matches :active
+// while it is held down.
+// Reference: https://w3c.github.io/pointerevents/#the-pointerdown-event
+func (se *ScriptExecutor) MouseDown(target *dom.Element, in MouseInput) {
+	se.updateHover(target, in)
+	if target == nil {
+		return
+	}
+	m := &se.mouse
+	if target == m.clickTarget && time.Since(m.clickTime) < multiClickInterval &&
+		math.Abs(in.ClientX-m.clickX) <= multiClickDistance && math.Abs(in.ClientY-m.clickY) <= multiClickDistance {
+		m.clickCount++
+	} else {
+		m.clickCount = 1
+	}
+	m.clickTarget, m.clickTime, m.clickX, m.clickY = target, time.Now(), in.ClientX, in.ClientY
+
+	first := m.buttons == 0
+	m.buttons |= buttonBit(in.Button)
+	m.pressed = target
+	if first {
+		m.suppressed = !se.dispatchMouseEvent(target, "pointerdown", in, nil)
+	} else {
+		se.dispatchMouseEvent(target, "pointermove", in, nil)
+	}
+	if !m.suppressed && se.dispatchMouseEvent(target, "mousedown", in, map[string]interface{}{"detail": m.clickCount}) &&
+		in.Button == MouseButtonPrimary {
+		se.focusAt(target)
+		se.startSelection(target, in)
+	}
+	if in.Button == MouseButtonPrimary && se.currentDocument != nil {
+		se.currentDocument.SetPressedElement(target)
+	}
+	if in.Button == MouseButtonSecondary {
+		se.dispatchMouseEvent(target, "contextmenu", in, nil)
+	}
+}
+
+// MouseUp dispatches the events for a button released over the target
+// element, followed by a click on the nearest element containing both the
+// targets of the press and the release: click and, on the second click in a
+// row, dblclick for the primary button, and auxclick for the others.
+// Reference: https://w3c.github.io/uievents/#events-mouseevent-event-order
+func (se *ScriptExecutor) MouseUp(target *dom.Element, in MouseInput) {
+	se.updateHover(target, in)
+	m := &se.mouse
+	m.buttons &^= buttonBit(in.Button)
+	if in.Button == MouseButtonPrimary {
+		m.selecting = false
+		if se.currentDocument != nil {
+			se.currentDocument.SetPressedElement(nil)
+		}
+	}
+	pressed := m.pressed
+	if m.buttons == 0 {
+		m.pressed = nil
+	}
+	if target == nil {
+		return
+	}
+	if m.buttons == 0 {
+		se.dispatchMouseEvent(target, "pointerup", in, nil)
+	} else {
+		se.dispatchMouseEvent(target, "pointermove", in, nil)
+	}
+	if !m.suppressed {
+		se.dispatchMouseEvent(target, "mouseup", in, map[string]interface{}{"detail": m.clickCount})
+	}
+	if m.buttons == 0 {
+		m.suppressed = false
+	}
+
+	clickTarget := commonAncestor(pressed, target)
+	if clickTarget == nil {
+		return
+	}
+	detail := map[string]interface{}{"detail": m.clickCount}
+	if in.Button != MouseButtonPrimary {
+		se.dispatchMouseEvent(clickTarget, "auxclick", in, detail)
+		return
+	}
+	se.dispatchMouseEvent(clickTarget, "click", in, detail)
+	if m.clickCount == 2 {
+		se.dispatchMouseEvent(clickTarget, "dblclick", in, detail)
+	}
+}
+
+// Wheel dispatches a wheel event to the target element. It returns false if
+// the event was canceled, in which case the page must not scroll.
+func (se *ScriptExecutor) Wheel(target *dom.Element, in MouseInput) bool {
+	if target == nil {
+		return true
+	}
+	return se.dispatchMouseEvent(target, "wheel", in, nil)
+}
+
+// updateHover makes the target the element the mouse is over, dispatching
+// the events for leaving the previous one and its ancestors that do not
+// contain the target, and for entering the target and its ancestors that did
+// not contain the previous one.
+// Reference: https://w3c.github.io/uievents/#events-mouseevent-event-order
+func (se *ScriptExecutor) updateHover(target *dom.Element, in MouseInput) {
+	doc := se.currentDocument
+	if doc == nil {
+		return
+	}
+	previous := doc.HoveredElement()
+	if previous == target {
+		return
+	}
+	if previous != nil && !previous.AsNode().IsConnected() {
+		previous = nil
+	}
+	left, entered := inclusiveAncestors(previous), inclusiveAncestors(target)
+	shared := map[*dom.Element]bool{}
+	for _, el := range left {
+		for _, other := range entered {
+			if el == other {
+				shared[el] = true
+			}
+		}
+	}
+
+	in.Button = 0
+	if previous != nil {
+		related := map[string]interface{}{"relatedTarget": target}
+		for _, kind := range []string{"pointer", "mouse"} {
+			se.dispatchMouseEvent(previous, kind+"out", in, related)
+			for _, el := range left {
+				if !shared[el] {
+					se.dispatchMouseEvent(el, kind+"leave", in, related)
+				}
+			}
+		}
+	}
+	doc.SetHoveredElement(target)
+	if target != nil {
+		related := map[string]interface{}{"relatedTarget": previous}
+		for _, kind := range []string{"pointer", "mouse"} {
+			se.dispatchMouseEvent(target, kind+"over", in, related)
+			for i := len(entered) - 1; i >= 0; i-- {
+				if !shared[entered[i]] {
+					se.dispatchMouseEvent(entered[i], kind+"enter", in, related)
+				}
+			}
+		}
+	}
+}
+
+// dispatchMouseEvent creates a trusted pointer, mouse or wheel event for
+// mouse input and dispatches it to an element. Extra options override those
+// derived from the input. It returns false if the event was canceled.
+func (se *ScriptExecutor) dispatchMouseEvent(target *dom.Element, eventType string, in MouseInput, extra map[string]interface{}) bool {
+	vm := se.runtime.vm
+	ctorName := "MouseEvent"
+	options := vm.NewObject()
+
+	// Enter and leave events go to each element entered or left and do not
+	// bubble
+	transition := false
+	switch eventType {
+	case "pointerenter", "pointerleave", "mouseenter", "mouseleave":
+		transition = true
+	}
+	options.Set("bubbles", !transition)
+	options.Set("cancelable", !transition)
+	options.Set("composed", !transition)
+	options.Set("view", vm.Get("window"))
+	options.Set("detail", 0)
+	options.Set("screenX", in.ScreenX)
+	options.Set("screenY", in.ScreenY)
+	options.Set("clientX", in.ClientX)
+	options.Set("clientY", in.ClientY)
+	options.Set("button", in.Button)
+	options.Set("buttons", se.mouse.buttons)
+	options.Set("ctrlKey", in.CtrlKey)
+	options.Set("shiftKey", in.ShiftKey)
+	options.Set("altKey", in.AltKey)
+	options.Set("metaKey", in.MetaKey)
+	options.Set("relatedTarget", goja.Null())
+
+	switch {
+	case eventType == "wheel":
+		ctorName = "WheelEvent"
+		options.Set("deltaX", in.DeltaX)
+		options.Set("deltaY", in.DeltaY)
+		options.Set("deltaMode", 0)
+	case strings.HasPrefix(eventType, "pointer"):
+		ctorName = "PointerEvent"
+		options.Set("pointerId", 1)
+		options.Set("pointerType", "mouse")
+		options.Set("isPrimary", true)
+		pressure := 0.0
+		if se.mouse.buttons != 0 {
+			pressure = 0.5
+		}
+		options.Set("pressure", pressure)
+	}
+	for name, value := range extra {
+		if el, ok := value.(*dom.Element); ok {
+			if el == nil {
+				value = goja.Null()
+			} else {
+				value = se.domBinder.BindElement(el)
+			}
+		}
+		options.Set(name, value)
+	}
+
+	ctor, ok := goja.AssertConstructor(vm.Get(ctorName))
+	if !ok {
+		return true
+	}
+	event, err := ctor(nil, vm.ToValue(eventType), options)
+	if err != nil {
+		return true
+	}
+	return se.eventBinder.DispatchTrustedEvent(se.domBinder.BindElement(target), event)
+}
+
+// inclusiveAncestors returns an element and its ancestors, innermost first.
+func inclusiveAncestors(el *dom.Element) []*dom.Element {
+	var elements []*dom.Element
+	for ; el != nil; el = el.AsNode().ParentElement() {
+		elements = append(elements, el)
+	}
+	return elements
+}
+
+// commonAncestor returns the innermost element that is an inclusive ancestor
+// of both a and b, or nil if they are in different trees.
+func commonAncestor(a, b *dom.Element) *dom.Element {
+	if a == nil || b == nil {
+		return nil
+	}
+	ancestors := map[*dom.Element]bool{}
+	for _, el := range inclusiveAncestors(a) {
+		ancestors[el] = true
+	}
+	for _, el := range inclusiveAncestors(b) {
+		if ancestors[el] {
+			return el
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package js
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// mouseEventTypes are the mouse, pointer and wheel events the input tests
+// log.
+var mouseEventTypes = []string{
+	"pointerover", "pointerenter", "pointerout", "pointerleave", "pointermove",
+	"pointerdown", "pointerup", "mouseover", "mouseenter", "mouseout", "mouseleave",
+	"mousemove", "mousedown", "mouseup", "click", "dblclick", "auxclick",
+	"contextmenu", "wheel",
+}
+
+// newEventTestExecutor sets up a document with a body whose listeners log
+// events of the given types, and returns a function draining the log. An
+// entry is the type and target id of an event, followed by the detail of
+// mouse clicks or the inputType and data of input events.
+func newEventTestExecutor(t *testing.T, body string, types ...string) (*ScriptExecutor, *dom.Document, func() string) {
+	t.Helper()
+	executor := NewScriptExecutor(NewRuntime())
+	doc, err := dom.ParseHTML("<!DOCTYPE html><html><body>" + body + "</body></html>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor.SetupDocument(doc)
+	if types == nil {
+		types = []string{}
+	}
+	listen, err := json.Marshal(types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executor.Runtime().Execute(`
+		var log = [];
+		` + string(listen) + `.forEach(function(type) {
+			document.addEventListener(type, function(e) {
+				var entry = e.type + "@" + e.target.id;
+				if ((e.type === "click" || e.type === "dblclick") && e.detail) entry += ":" + e.detail;
+				if (e.inputType) entry += ":" + e.inputType + ":" + e.data;
+				log.push(entry);
+			}, true);
+		});
+		function drain() { var s = log.join(" "); log = []; return s; }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drain := func() string {
+		v, err := executor.Runtime().Execute("drain()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.String()
+	}
+	return executor, doc, drain
+}
+
+// newInputTestExecutor sets up a document whose listeners log the mouse
+// events, and returns a function draining the log.
+func newInputTestExecutor(t *testing.T, body string) (*ScriptExecutor, *dom.Document, func() string) {
+	t.Helper()
+	return newEventTestExecutor(t, body, mouseEventTypes...)
+}
+
+func TestMouseEventSequence(t *testing.T) {
+	executor, doc, drain := newInputTestExecutor(t, `<div id="a"><span id="b">x</span></div><p id="c">y</p>`)
+	a, b, c := doc.GetElementById("a"), doc.GetElementById("b"), doc.GetElementById("c")
+
+	executor.MouseMove(b, MouseInput{ClientX: 5, ClientY: 5})
+	want := "pointerover@b pointerenter@ pointerenter@ pointerenter@a pointerenter@b " +
+		"mouseover@b mouseenter@ mouseenter@ mouseenter@a mouseenter@b pointermove@b mousemove@b"
+	if got := drain(); got != want {
+		t.Errorf("entering #b:\n got %s\nwant %s", got, want)
+	}
+	if doc.HoveredElement() != b {
+		t.Errorf("hovered element = %v, want #b", doc.HoveredElement())
+	}
+
+	executor.MouseDown(b, MouseInput{ClientX: 5, ClientY: 5})
+	if doc.PressedElement() != b {
+		t.Errorf("pressed element = %v, want #b", doc.PressedElement())
+	}
+	executor.MouseUp(a, MouseInput{ClientX: 6, ClientY: 5})
+	want = "pointerdown@b mousedown@b pointerout@b pointerleave@b mouseout@b mouseleave@b " +
+		"pointerover@a mouseover@a pointerup@a mouseup@a click@a:1"
+	if got := drain(); got != want {
+		t.Errorf("pressing #b and releasing over #a:\n got %s\nwant %s", got, want)
+	}
+	if doc.PressedElement() != nil {
+		t.Errorf("pressed element = %v after release, want nil", doc.PressedElement())
+	}
+
+	// A second press at the same place is a double click
+	executor.MouseDown(a, MouseInput{ClientX: 6, ClientY: 5})
+	executor.MouseUp(a, MouseInput{ClientX: 6, ClientY: 5})
+	executor.MouseDown(a, MouseInput{ClientX: 6, ClientY: 5})
+	executor.MouseUp(a, MouseInput{ClientX: 6, ClientY: 5})
+	want = "pointerdown@a mousedown@a pointerup@a mouseup@a click@a:1 " +
+		"pointerdown@a mousedown@a pointerup@a mouseup@a click@a:2 dblclick@a:2"
+	if got := drain(); got != want {
+		t.Errorf("double click:\n got %s\nwant %s", got, want)
+	}
+
+	executor.MouseDown(c, MouseInput{Button: MouseButtonSecondary})
+	executor.MouseUp(c, MouseInput{Button: MouseButtonSecondary})
+	if got := drain(); !strings.HasSuffix(got, "pointerdown@c mousedown@c contextmenu@c pointerup@c mouseup@c auxclick@c") {
+		t.Errorf("secondary button: got %s", got)
+	}
+
+	executor.MouseLeave(MouseInput{})
+	if got := drain(); got != "pointerout@c pointerleave@c pointerleave@ pointerleave@ mouseout@c mouseleave@c mouseleave@ mouseleave@" {
+		t.Errorf("leaving the document: got %s", got)
+	}
+	if doc.HoveredElement() != nil {
+		t.Errorf("hovered element = %v after leaving, want nil", doc.HoveredElement())
+	}
+}
+
+func TestMouseEventProperties(t *testing.T) {
+	executor, doc, _ := newInputTestExecutor(t, `<button id="b">x</button><input id="check" type="checkbox">`)
+	_, err := executor.Runtime().Execute(`
+		var seen = {};
+		document.getElementById("b").addEventListener("pointerdown", function(e) { seen.down = e; });
+		document.getElementById("b").addEventListener("wheel", function(e) { seen.wheel = e; e.preventDefault(); });
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := doc.GetElementById("b")
+	executor.MouseDown(b, MouseInput{ClientX: 12, ClientY: 34, ShiftKey: true})
+	if executor.Wheel(b, MouseInput{DeltaY: 40}) {
+		t.Error("Wheel should report a canceled wheel event")
+	}
+	v, err := executor.Runtime().Execute(`[
+		seen.down instanceof PointerEvent, seen.down.isTrusted, seen.down.pointerType,
+		seen.down.clientX, seen.down.clientY, seen.down.shiftKey, seen.down.buttons,
+		seen.wheel instanceof WheelEvent, seen.wheel.deltaY
+	].join(",")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v.String(), "true,true,mouse,12,34,true,1,true,40"; got != want {
+		t.Errorf("event properties = %s, want %s", got, want)
+	}
+
+	// Clicking a checkbox runs its activation behavior
+	check := doc.GetElementById("check")
+	executor.MouseUp(b, MouseInput{})
+	executor.MouseDown(check, MouseInput{})
+	executor.MouseUp(check, MouseInput{})
+	if !check.Checked() {
+		t.Error("clicking a checkbox should check it")
+	}
+}
+
+func TestCanceledPointerDownSuppressesMouseEvents(t *testing.T) {
+	executor, doc, drain := newInputTestExecutor(t, `<div id="a">x</div>`)
+	if _, err := executor.Runtime().Execute(`document.addEventListener("pointerdown", function(e) { e.preventDefault(); });`); err != nil {
+		t.Fatal(err)
+	}
+	a := doc.GetElementById("a")
+	executor.MouseMove(a, MouseInput{})
+	drain()
+	executor.MouseDown(a, MouseInput{})
+	executor.MouseMove(a, MouseInput{ClientX: 1})
+	executor.MouseUp(a, MouseInput{ClientX: 1})
+	if got, want := drain(), "pointerdown@a pointermove@a pointerup@a click@a:1"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
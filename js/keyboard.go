@@ -0,0 +1,428 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the dispatch of keyboard input to the focused element
+// of a document as keyboard and input events, sequential focus navigation,
+// and the editing of text controls.
+package js
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/dop251/goja"
+)
+
+// Values of the location property of keyboard events.
+const (
+	KeyLocationStandard = 0
+	KeyLocationLeft     = 1
+	KeyLocationRight    = 2
+	KeyLocationNumpad   = 3
+)
+
+// KeyInput describes a key pressed or released.
+type KeyInput struct {
+	Key      string // The key value: the character typed, or a name such as "Enter" or "ArrowLeft"
+	Code     string // The physical key, such as "KeyA" or "Enter"
+	Location int    // Where the key is on the keyboard, one of the KeyLocation values
+	Repeat   bool   // Whether the key is held down and repeating
+
+	CtrlKey, ShiftKey, AltKey, MetaKey bool
+}
+
+// keyboardState tracks the keyboard of a document across input events.
+type keyboardState struct {
+	spaceTarget *dom.Element // Element a space press activates on its release
+}
+
+// legacyKeyCodes are the keyCode values of named keys.
+var legacyKeyCodes = map[string]int{
+	"Backspace": 8, "Tab": 9, "Enter": 13, "Shift": 16, "Control": 17, "Alt": 18,
+	"Pause": 19, "CapsLock": 20, "Escape": 27, " ": 32, "PageUp": 33, "PageDown": 34,
+	"End": 35, "Home": 36, "ArrowLeft": 37, "ArrowUp": 38, "ArrowRight": 39,
+	"ArrowDown": 40, "Insert": 45, "Delete": 46, "Meta": 91, "ContextMenu": 93,
+	";": 186, "=": 187, ",": 188, "-": 189, ".": 190, "/": 191, "`": 192,
+	"[": 219, "\\": 220, "]": 221, "'": 222,
+}
+
+// KeyDown dispatches the events for a key pressed while the document has
+// focus, and performs its default action unless the page cancels it: keys
+// typing a character fire keypress and edit a focused text control, Tab
+// moves the focus, and Enter and Space activate links and buttons. It
+// returns true if the key is left to the browser, which may scroll the
+// page with it.
+// Reference: https://w3c.github.io/uievents/#events-keyboard-event-order
+func (se *ScriptExecutor) KeyDown(in KeyInput) bool {
+	target := se.keyTarget()
+	if target == nil {
+		return true
+	}
+	if !se.dispatchKeyEvent(target, "keydown", in) {
+		return false
+	}
+	// Listeners may have moved the focus
+	target = se.keyTarget()
+	if target == nil {
+		return false
+	}
+
+	text := keyText(in)
+	if text != "" && !se.dispatchKeyEvent(target, "keypress", in) {
+		return false
+	}
+	switch {
+	case in.Key == "Tab" && !in.CtrlKey && !in.MetaKey && !in.AltKey:
+		se.navigateFocus(in.ShiftKey)
+		return false
+	case target.IsTextControl():
+		if se.editTextControl(target, in, text) {
+			return false
+		}
+	case in.Key == "Enter" && isKeyboardActivatable(target, "Enter"):
+		se.activate(target)
+		return false
+	case in.Key == " " && isKeyboardActivatable(target, " "):
+		se.keyboard.spaceTarget = target
+		return false
+	}
+	return true
+}
+
+// KeyUp dispatches the keyup event for a key released while the document
+// has focus. Releasing Space activates the button it was pressed on.
+func (se *ScriptExecutor) KeyUp(in KeyInput) {
+	target := se.keyTarget()
+	if target == nil {
+		return
+	}
+	pressed := se.keyboard.spaceTarget
+	if in.Key == " " {
+		se.keyboard.spaceTarget = nil
+	}
+	if se.dispatchKeyEvent(target, "keyup", in) && in.Key == " " && pressed == target {
+		se.activate(target)
+	}
+}
+
+// focusAt runs the focusing steps for a press at an element: the nearest
+// focusable inclusive ancestor gets the focus, or the focus moves to the
+// body if there is none.
+func (se *ScriptExecutor) focusAt(target *dom.Element) {
+	doc := se.currentDocument
+	if doc == nil {
+		return
+	}
+	var focus *dom.Element
+	for el := target; el != nil; el = el.AsNode().ParentElement() {
+		if el.IsFocusable() {
+			focus = el
+			break
+		}
+	}
+	doc.SetFocusedByPointer(true)
+	se.focus(focus)
+}
+
+// keyTarget returns the element keyboard events go to: the focused element,
+// or the body if nothing has focus.
+func (se *ScriptExecutor) keyTarget() *dom.Element {
+	doc := se.currentDocument
+	if doc == nil {
+		return nil
+	}
+	if el := doc.GetFocusedElement(); el != nil && el.AsNode().IsConnected() {
+		return el
+	}
+	if body := doc.Body(); body != nil {
+		return body
+	}
+	return doc.DocumentElement()
+}
+
+// focus moves the focus to an element, or off any element if nil, firing
+// the focus events.
+func (se *ScriptExecutor) focus(el *dom.Element) {
+	doc := se.currentDocument
+	if doc == nil {
+		return
+	}
+	previous := doc.GetFocusedElement()
+	if previous != nil && !previous.AsNode().IsConnected() {
+		previous = nil
+	}
+	if previous == el {
+		return
+	}
+	se.domBinder.fireFocusEvents(nil, previous, el, doc)
+}
+
+// navigateFocus moves the focus to the next element in the sequential focus
+// order, or the previous one going backward. Without a focused element,
+// navigation starts from the start of the document.
+func (se *ScriptExecutor) navigateFocus(backward bool) {
+	doc := se.currentDocument
+	if doc == nil {
+		return
+	}
+	from := doc.GetFocusedElement()
+	if from != nil && !from.AsNode().IsConnected() {
+		from = nil
+	}
+	if next := doc.NextFocusable(from, backward); next != nil {
+		doc.SetFocusedByPointer(false)
+		se.focus(next)
+		if next.IsTextControl() {
+			// Text fields reached with the keyboard have their text selected
+			next.SetSelectionRange(0, dom.UTF16Length(next.TextControlValue()))
+		}
+	}
+}
+
+// activate fires a click at an element activated with the keyboard.
+func (se *ScriptExecutor) activate(target *dom.Element) {
+	se.dispatchMouseEvent(target, "click", MouseInput{}, nil)
+}
+
+// isKeyboardActivatable reports whether a key activates an element: Enter
+// follows links and presses buttons, Space presses buttons and toggles
+// checkboxes and radio buttons.
+func isKeyboardActivatable(el *dom.Element, key string) bool {
+	if el.NamespaceURI() != dom.HTMLNamespace || el.Disabled() {
+		return false
+	}
+	switch el.LocalName() {
+	case "a", "area":
+		return key == "Enter" && el.HasAttribute("href")
+	case "button", "summary":
+		return true
+	case "input":
+		switch el.InputType() {
+		case "submit", "reset", "button", "image":
+			return true
+		case "checkbox", "radio":
+			return key == " "
+		}
+	}
+	return false
+}
+
+// editTextControl performs the editing a key does in a focused text
+// control, and reports whether the key was one that edits or moves the
+// caret. Changes to the value fire beforeinput, which cancels them, and
+// input.
+// Reference: https://w3c.github.io/input-events/#event-type-beforeinput
+func (se *ScriptExecutor) editTextControl(el *dom.Element, in KeyInput, text string) bool {
+	value := el.TextControlValue()
+	start, end := el.SelectionRange()
+	length := dom.UTF16Length(value)
+	mutable := el.IsMutableTextControl()
+	textarea := el.LocalName() == "textarea"
+
+	switch {
+	case in.Key == "Enter" && textarea:
+		if mutable {
+			se.editText(el, "insertLineBreak", "\n", start, end)
+		}
+	case in.Key == "Enter":
+		return false
+	case text != "":
+		if mutable {
+			se.editText(el, "insertText", text, start, end)
+		}
+	case in.Key == "Backspace" || in.Key == "Delete":
+		if !mutable {
+			return true
+		}
+		inputType := "deleteContentBackward"
+		if start == end {
+			if in.Key == "Backspace" {
+				start = previousCaret(value, start)
+			} else {
+				end = nextCaret(value, end)
+			}
+		}
+		if in.Key == "Delete" {
+			inputType = "deleteContentForward"
+		}
+		if start != end {
+			se.editText(el, inputType, "", start, end)
+		}
+	case in.Key == "ArrowLeft" || in.Key == "ArrowRight":
+		caret := start
+		if in.Key == "ArrowRight" {
+			caret = end
+		}
+		switch {
+		case in.ShiftKey && in.Key == "ArrowLeft":
+			el.SetSelectionRange(previousCaret(value, start), end)
+		case in.ShiftKey:
+			el.SetSelectionRange(start, nextCaret(value, end))
+		case start == end && in.Key == "ArrowLeft":
+			caret = previousCaret(value, caret)
+			el.SetSelectionRange(caret, caret)
+		case start == end:
+			caret = nextCaret(value, caret)
+			el.SetSelectionRange(caret, caret)
+		default:
+			el.SetSelectionRange(caret, caret)
+		}
+	case in.Key == "Home":
+		if in.ShiftKey {
+			el.SetSelectionRange(0, end)
+		} else {
+			el.SetSelectionRange(0, 0)
+		}
+	case in.Key == "End":
+		if in.ShiftKey {
+			el.SetSelectionRange(start, length)
+		} else {
+			el.SetSelectionRange(length, length)
+		}
+	case strings.EqualFold(in.Key, "a") && (in.CtrlKey || in.MetaKey):
+		el.SetSelectionRange(0, length)
+	default:
+		return false
+	}
+	return true
+}
+
+// editText replaces the text between start and end in a text control,
+// firing beforeinput first and input after.
+func (se *ScriptExecutor) editText(el *dom.Element, inputType, data string, start, end int) {
+	options := map[string]interface{}{"inputType": inputType, "data": goja.Null()}
+	if inputType == "insertText" {
+		options["data"] = data
+	}
+	options["cancelable"] = true
+	if !se.dispatchInputEvent(el, "beforeinput", options) {
+		return
+	}
+	el.SetSelectionRange(start, end)
+	el.ReplaceSelection(data)
+	options["cancelable"] = false
+	se.dispatchInputEvent(el, "input", options)
+}
+
+// previousCaret returns the caret offset before the character that ends at
+// an offset of a string, in UTF-16 code units.
+func previousCaret(s string, offset int) int {
+	if offset <= 0 {
+		return 0
+	}
+	r, _ := utf8.DecodeLastRuneInString(dom.UTF16SliceTo(s, offset))
+	return offset - len(utf16.Encode([]rune{r}))
+}
+
+// nextCaret returns the caret offset after the character that starts at an
+// offset of a string, in UTF-16 code units.
+func nextCaret(s string, offset int) int {
+	rest := dom.UTF16SliceFrom(s, offset)
+	if rest == "" {
+		return offset
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	return offset + len(utf16.Encode([]rune{r}))
+}
+
+// keyText returns the text a key types: its character, or a line break
+// for Enter. Keys pressed with Control or Meta type nothing.
+func keyText(in KeyInput) string {
+	if in.CtrlKey || in.MetaKey {
+		return ""
+	}
+	if in.Key == "Enter" {
+		return "\r"
+	}
+	if utf8.RuneCountInString(in.Key) == 1 {
+		return in.Key
+	}
+	return ""
+}
+
+// legacyKeyCode returns the keyCode of a key: the code of the uppercase
+// letter or the digit for those, or that of the named key.
+func legacyKeyCode(key string) int {
+	if code, ok := legacyKeyCodes[key]; ok {
+		return code
+	}
+	if utf8.RuneCountInString(key) == 1 {
+		r := []rune(strings.ToUpper(key))[0]
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return int(r)
+		}
+	}
+	if len(key) > 1 && key[0] == 'F' {
+		var n int
+		for _, c := range key[1:] {
+			if c < '0' || c > '9' {
+				return 0
+			}
+			n = n*10 + int(c-'0')
+		}
+		return 111 + n
+	}
+	return 0
+}
+
+// dispatchKeyEvent creates a trusted keyboard event for key input and
+// dispatches it to an element. It returns false if the event was canceled.
+func (se *ScriptExecutor) dispatchKeyEvent(target *dom.Element, eventType string, in KeyInput) bool {
+	vm := se.runtime.vm
+	options := vm.NewObject()
+	options.Set("bubbles", true)
+	options.Set("cancelable", true)
+	options.Set("composed", true)
+	options.Set("view", vm.Get("window"))
+	options.Set("key", in.Key)
+	options.Set("code", in.Code)
+	options.Set("location", in.Location)
+	options.Set("repeat", in.Repeat)
+	options.Set("ctrlKey", in.CtrlKey)
+	options.Set("shiftKey", in.ShiftKey)
+	options.Set("altKey", in.AltKey)
+	options.Set("metaKey", in.MetaKey)
+
+	// keypress reports the character typed, the others the key
+	keyCode, charCode := legacyKeyCode(in.Key), 0
+	if eventType == "keypress" {
+		if r, _ := utf8.DecodeRuneInString(keyText(in)); r != utf8.RuneError {
+			keyCode, charCode = int(r), int(r)
+		}
+	}
+	options.Set("keyCode", keyCode)
+	options.Set("charCode", charCode)
+	options.Set("which", keyCode)
+
+	ctor, ok := goja.AssertConstructor(vm.Get("KeyboardEvent"))
+	if !ok {
+		return true
+	}
+	event, err := ctor(nil, vm.ToValue(eventType), options)
+	if err != nil {
+		return true
+	}
+	return se.eventBinder.DispatchTrustedEvent(se.domBinder.BindElement(target), event)
+}
+
+// dispatchInputEvent creates a trusted input event and dispatches it to an
+// element. It returns false if the event was canceled.
+func (se *ScriptExecutor) dispatchInputEvent(target *dom.Element, eventType string, extra map[string]interface{}) bool {
+	vm := se.runtime.vm
+	options := vm.NewObject()
+	options.Set("bubbles", true)
+	options.Set("composed", true)
+	options.Set("view", vm.Get("window"))
+	for name, value := range extra {
+		options.Set(name, value)
+	}
+	ctor, ok := goja.AssertConstructor(vm.Get("InputEvent"))
+	if !ok {
+		return true
+	}
+	event, err := ctor(nil, vm.ToValue(eventType), options)
+	if err != nil {
+		return true
+	}
+	return se.eventBinder.DispatchTrustedEvent(se.domBinder.BindElement(target), event)
+}
@@ -0,0 +1,177 @@
+package js
+
+import (
+	"testing"
+)
+
+// keyboardEventTypes are the keyboard, input and focus events the keyboard
+// tests log.
+var keyboardEventTypes = []string{"keydown", "keypress", "keyup", "beforeinput", "input", "focus", "blur", "click"}
+
+// typeKey presses and releases a key.
+func typeKey(executor *ScriptExecutor, in KeyInput) {
+	executor.KeyDown(in)
+	executor.KeyUp(in)
+}
+
+func TestTypingIntoInput(t *testing.T) {
+	executor, doc, drain := newEventTestExecutor(t, `<input id="field" value="ok">`, keyboardEventTypes...)
+	field := doc.GetElementById("field")
+
+	executor.MouseDown(field, MouseInput{})
+	executor.MouseUp(field, MouseInput{})
+	if doc.GetFocusedElement() != field {
+		t.Fatalf("pressing the input should focus it, focused %v", doc.GetFocusedElement())
+	}
+	drain()
+
+	typeKey(executor, KeyInput{Key: "!", Code: "Digit1", ShiftKey: true})
+	want := "keydown@field keypress@field beforeinput@field:insertText:! input@field:insertText:! keyup@field"
+	if got := drain(); got != want {
+		t.Errorf("typing:\n got %s\nwant %s", got, want)
+	}
+	typeKey(executor, KeyInput{Key: "ArrowLeft", Code: "ArrowLeft"})
+	typeKey(executor, KeyInput{Key: "Backspace", Code: "Backspace"})
+	typeKey(executor, KeyInput{Key: "Enter", Code: "Enter"})
+	if got := field.InputValue(); got != "o!" {
+		t.Errorf("value = %q, want %q", got, "o!")
+	}
+	if start, end := field.SelectionRange(); start != 1 || end != 1 {
+		t.Errorf("selection = %d-%d, want the caret at 1", start, end)
+	}
+
+	// Text selected from script is replaced
+	if _, err := executor.Runtime().Execute(`field.setSelectionRange(0, 2)`); err != nil {
+		t.Fatal(err)
+	}
+	typeKey(executor, KeyInput{Key: "é", Code: "KeyE"})
+	if got := field.InputValue(); got != "é" {
+		t.Errorf("value = %q, want %q", got, "é")
+	}
+}
+
+func TestCanceledKeyEvents(t *testing.T) {
+	executor, doc, drain := newEventTestExecutor(t, `<textarea id="area"></textarea>`, keyboardEventTypes...)
+	area := doc.GetElementById("area")
+	if _, err := executor.Runtime().Execute(`
+		area.focus();
+		area.addEventListener("keydown", function(e) { if (e.key === "x") e.preventDefault(); });
+		area.addEventListener("beforeinput", function(e) { if (e.data === "y") e.preventDefault(); });
+	`); err != nil {
+		t.Fatal(err)
+	}
+	drain()
+
+	if executor.KeyDown(KeyInput{Key: "x", Code: "KeyX"}) {
+		t.Error("a canceled keydown should not be left to the browser")
+	}
+	executor.KeyDown(KeyInput{Key: "y", Code: "KeyY"})
+	executor.KeyDown(KeyInput{Key: "Enter", Code: "Enter"})
+	executor.KeyDown(KeyInput{Key: "z", Code: "KeyZ"})
+	want := "keydown@area " +
+		"keydown@area keypress@area beforeinput@area:insertText:y " +
+		"keydown@area keypress@area beforeinput@area:insertLineBreak:null input@area:insertLineBreak:null " +
+		"keydown@area keypress@area beforeinput@area:insertText:z input@area:insertText:z"
+	if got := drain(); got != want {
+		t.Errorf("events:\n got %s\nwant %s", got, want)
+	}
+	if got := area.TextAreaValue(); got != "\nz" {
+		t.Errorf("value = %q, want %q", got, "\nz")
+	}
+	v, err := executor.Runtime().Execute(`area.selectionStart + "," + area.selectionEnd`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.String(); got != "2,2" {
+		t.Errorf("selection = %s, want 2,2", got)
+	}
+}
+
+func TestTabNavigation(t *testing.T) {
+	executor, doc, _ := newEventTestExecutor(t, `<input id="a" tabindex="2"><button id="b">b</button>`+
+		`<span id="e" tabindex="-1"></span><a id="c" href="#">c</a><a id="x">not a link</a><div id="d" tabindex="1"></div>`+
+		`<button id="f" disabled>f</button><div hidden><button id="g">g</button></div>`, keyboardEventTypes...)
+
+	tab := KeyInput{Key: "Tab", Code: "Tab"}
+	var order string
+	for i := 0; i < 5; i++ {
+		typeKey(executor, tab)
+		order += doc.GetFocusedElement().Id()
+	}
+	if order != "dabcd" {
+		t.Errorf("Tab order = %s, want dabcd", order)
+	}
+	backTab := KeyInput{Key: "Tab", Code: "Tab", ShiftKey: true}
+	typeKey(executor, backTab)
+	if got := doc.GetFocusedElement().Id(); got != "c" {
+		t.Errorf("Shift+Tab from the first element should wrap to the last, got %s", got)
+	}
+
+	// From an element outside the order, navigation continues in tree order
+	if _, err := executor.Runtime().Execute(`document.getElementById("e").focus()`); err != nil {
+		t.Fatal(err)
+	}
+	typeKey(executor, tab)
+	if got := doc.GetFocusedElement().Id(); got != "c" {
+		t.Errorf("Tab from #e = %s, want c", got)
+	}
+}
+
+func TestKeyboardActivation(t *testing.T) {
+	executor, doc, drain := newEventTestExecutor(t, `<button id="button">go</button><input id="box" type="checkbox">`, keyboardEventTypes...)
+	if _, err := executor.Runtime().Execute(`button.focus()`); err != nil {
+		t.Fatal(err)
+	}
+	drain()
+
+	typeKey(executor, KeyInput{Key: "Enter", Code: "Enter"})
+	want := "keydown@button keypress@button click@button keyup@button"
+	if got := drain(); got != want {
+		t.Errorf("Enter on a button:\n got %s\nwant %s", got, want)
+	}
+
+	box := doc.GetElementById("box")
+	if _, err := executor.Runtime().Execute(`box.focus()`); err != nil {
+		t.Fatal(err)
+	}
+	drain()
+	if executor.KeyDown(KeyInput{Key: " ", Code: "Space"}) {
+		t.Error("Space on a checkbox should not scroll the page")
+	}
+	if box.Checked() {
+		t.Error("the checkbox should toggle when Space is released")
+	}
+	executor.KeyUp(KeyInput{Key: " ", Code: "Space"})
+	if !box.Checked() {
+		t.Error("releasing Space should toggle the checkbox")
+	}
+	want = "keydown@box keypress@box keyup@box click@box input@box"
+	if got := drain(); got != want {
+		t.Errorf("Space on a checkbox:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestKeyEventProperties(t *testing.T) {
+	executor, _, _ := newEventTestExecutor(t, ``, keyboardEventTypes...)
+	if _, err := executor.Runtime().Execute(`
+		var seen = [];
+		document.body.addEventListener("keydown", function(e) {
+			seen.push([e instanceof KeyboardEvent, e.key, e.code, e.keyCode, e.ctrlKey, e.repeat, e.isTrusted].join());
+		});
+		document.body.addEventListener("keypress", function(e) {
+			seen.push([e.type, e.charCode, e.keyCode].join());
+		});
+	`); err != nil {
+		t.Fatal(err)
+	}
+	executor.KeyDown(KeyInput{Key: "a", Code: "KeyA", CtrlKey: true, Repeat: true})
+	executor.KeyDown(KeyInput{Key: "A", Code: "KeyA", ShiftKey: true})
+	v, err := executor.Runtime().Execute(`seen.join(" ")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "true,a,KeyA,65,true,true,true true,A,KeyA,65,false,false,true keypress,65,65"
+	if got := v.String(); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
@@ -18,6 +18,10 @@ type LocationManager struct {
 	// navigationCallback is called when location changes trigger navigation
 	// The callback receives the new URL and whether to replace history (vs push)
 	navigationCallback func(newURL string, replace bool)
+
+	// reloadCallback is called by location.reload(), in place of the
+	// navigation callback if set
+	reloadCallback func()
 }
 
 // NewLocationManager creates a new location manager.
@@ -58,6 +62,13 @@ func (m *LocationManager) SetNavigationCallback(callback func(newURL string, rep
 	m.navigationCallback = callback
 }
 
+// SetReloadCallback sets the callback for location.reload().
+func (m *LocationManager) SetReloadCallback(callback func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reloadCallback = callback
+}
+
 // SetupLocation creates and installs the location object on window.
 func (m *LocationManager) SetupLocation() *goja.Object {
 	vm := m.runtime.VM()
@@ -334,8 +345,14 @@ func (m *LocationManager) reload() {
 		currentURL = m.url.String()
 	}
 	callback := m.navigationCallback
+	reloadCallback := m.reloadCallback
 	m.mu.RUnlock()
 
+	if reloadCallback != nil {
+		reloadCallback()
+		return
+	}
+
 	// Trigger navigation callback with current URL
 	if callback != nil && currentURL != "" {
 		callback(currentURL, true) // Replace since we're reloading
@@ -504,11 +521,15 @@ func (m *LocationManager) setHash(hash string) {
 
 	newURL := *m.url
 	newURL.Fragment = fragment
+	newURL.RawFragment = ""
 	m.url = &newURL
+	callback := m.navigationCallback
 	m.mu.Unlock()
 
-	// Hash changes typically don't trigger full navigation
-	// but may trigger hashchange event - not implemented yet
+	// Changing the hash navigates to the fragment within the document
+	if callback != nil {
+		callback(m.url.String(), false)
+	}
 }
 
 // UpdateFromURL updates the location from a URL string without triggering navigation.
@@ -184,9 +184,13 @@ func (r *Runtime) RunEventLoop() bool {
 	return r.eventLoop.runOnce(r)
 }
 
-// ProcessTimers checks and executes any due timers.
+// ProcessTimers runs the callbacks of due timers, and of animation frames
+// if a rendering opportunity came.
 func (r *Runtime) ProcessTimers() {
-	r.timers.process(r)
+	now := time.Now()
+	r.timers.queueDue(r, now)
+	r.eventLoop.runTasksOf(TaskSourceTimer)
+	r.eventLoop.updateRendering(r, now)
 }
 
 // HasPendingWork returns true if there are timers or callbacks waiting.
@@ -401,7 +405,8 @@ func (r *Runtime) setupTimers() {
 		return goja.Undefined()
 	})
 
-	// requestAnimationFrame (simplified - uses 16ms timeout to approximate 60fps)
+	// requestAnimationFrame runs the callback at the next rendering
+	// opportunity, with the frame's timestamp
 	r.vm.Set("requestAnimationFrame", func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) < 1 {
 			return goja.Undefined()
@@ -409,14 +414,10 @@ func (r *Runtime) setupTimers() {
 
 		callback, ok := goja.AssertFunction(call.Arguments[0])
 		if !ok {
-			return goja.Undefined()
+			panic(r.vm.NewTypeError("Failed to execute 'requestAnimationFrame': parameter 1 is not of type 'Function'."))
 		}
 
-		// Pass timestamp as argument
-		timestamp := float64(time.Now().UnixNano()) / 1e6
-		args := []goja.Value{r.vm.ToValue(timestamp)}
-
-		id := r.timers.setTimeout(callback, 16*time.Millisecond, args)
+		id := r.eventLoop.requestAnimationFrame(callback)
 		return r.vm.ToValue(id)
 	})
 
@@ -426,7 +427,40 @@ func (r *Runtime) setupTimers() {
 			return goja.Undefined()
 		}
 		id := int(call.Arguments[0].ToInteger())
-		r.timers.clearTimer(id)
+		r.eventLoop.cancelAnimationFrame(id)
+		return goja.Undefined()
+	})
+
+	// requestIdleCallback runs the callback in an idle period of the event
+	// loop, or once the timeout option passed
+	r.vm.Set("requestIdleCallback", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			return goja.Undefined()
+		}
+
+		callback, ok := goja.AssertFunction(call.Arguments[0])
+		if !ok {
+			panic(r.vm.NewTypeError("Failed to execute 'requestIdleCallback': parameter 1 is not of type 'Function'."))
+		}
+
+		timeout := int64(0)
+		if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+			if t := call.Arguments[1].ToObject(r.vm).Get("timeout"); t != nil && !goja.IsUndefined(t) {
+				timeout = t.ToInteger()
+			}
+		}
+
+		id := r.eventLoop.requestIdleCallback(callback, time.Duration(timeout)*time.Millisecond)
+		return r.vm.ToValue(id)
+	})
+
+	// cancelIdleCallback
+	r.vm.Set("cancelIdleCallback", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			return goja.Undefined()
+		}
+		id := int(call.Arguments[0].ToInteger())
+		r.eventLoop.cancelIdleCallback(id)
 		return goja.Undefined()
 	})
 }
@@ -0,0 +1,93 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements selecting text with the mouse: pressing the primary
+// button places the caret of the document's selection, dragging extends it,
+// and changes of the selection fire selectionchange.
+// Reference: https://w3c.github.io/selection-api/
+package js
+
+import (
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/dop251/goja"
+)
+
+// setupSelection makes changes of the selection of a document queue a
+// selectionchange event and request rendering, so the selection is painted.
+// Changes made before the event fires are reported by one event.
+// Reference: https://w3c.github.io/selection-api/#selectionchange-event
+func (se *ScriptExecutor) setupSelection(doc *dom.Document) {
+	queued := false
+	doc.GetSelection().SetChangeHandler(func() {
+		se.runtime.eventLoop.requestRendering()
+		if queued {
+			return
+		}
+		queued = true
+		se.QueueTask(TaskSourceUserInteraction, func() {
+			queued = false
+			if se.currentDocument == doc {
+				se.dispatchSimpleEvent(se.domBinder.BindDocument(doc), "selectionchange", false, false)
+			}
+		})
+	})
+}
+
+// startSelection places the caret of the selection at the point a primary
+// button press was made over the target element, or with Shift held extends
+// the selection to it. It fires selectstart first, which keeps the
+// selection as it is when canceled. The selection follows the mouse while
+// the button is held down.
+func (se *ScriptExecutor) startSelection(target *dom.Element, in MouseInput) {
+	doc := se.currentDocument
+	if doc == nil {
+		return
+	}
+	sel := doc.GetSelection()
+	node, offset, _ := caretPosition(target, in.PageX, in.PageY)
+	if in.ShiftKey && sel.RangeCount() > 0 {
+		se.mouse.selecting = true
+		_ = sel.Extend(node, offset)
+		return
+	}
+	if !se.dispatchSimpleEvent(se.domBinder.BindNode(node), "selectstart", true, true) {
+		return
+	}
+	se.mouse.selecting = true
+	_ = sel.Collapse(node, offset)
+}
+
+// extendSelection moves the focus of the selection being made with the
+// mouse to the caret position nearest the point the mouse moved to.
+func (se *ScriptExecutor) extendSelection(target *dom.Element, in MouseInput) {
+	doc := se.currentDocument
+	if doc == nil || !se.mouse.selecting || se.mouse.buttons&buttonBit(MouseButtonPrimary) == 0 {
+		return
+	}
+	sel := doc.GetSelection()
+	if sel.RangeCount() == 0 {
+		se.mouse.selecting = false
+		return
+	}
+	node, offset, _ := caretPosition(target, in.PageX, in.PageY)
+	if node == sel.FocusNode() && offset == sel.FocusOffset() {
+		return
+	}
+	_ = sel.Extend(node, offset)
+}
+
+// dispatchSimpleEvent creates a trusted event of an Event type and
+// dispatches it to a target. It returns false if the event was canceled.
+func (se *ScriptExecutor) dispatchSimpleEvent(target *goja.Object, eventType string, bubbles, cancelable bool) bool {
+	vm := se.runtime.vm
+	ctor, ok := goja.AssertConstructor(vm.Get("Event"))
+	if !ok {
+		return true
+	}
+	options := vm.NewObject()
+	options.Set("bubbles", bubbles)
+	options.Set("cancelable", cancelable)
+	event, err := ctor(nil, vm.ToValue(eventType), options)
+	if err != nil {
+		return true
+	}
+	return se.eventBinder.DispatchTrustedEvent(target, event)
+}
@@ -0,0 +1,112 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// newSelectionTestExecutor sets up a document with a line of text laid out
+// at the top of the page, six pixels to a character, and logs selectstart
+// and selectionchange.
+func newSelectionTestExecutor(t *testing.T) (*ScriptExecutor, *dom.Document, *dom.Node, func() string) {
+	t.Helper()
+	executor, doc, drain := newInputTestExecutor(t, `<p id="p">Hello world</p>`)
+	text := doc.GetElementById("p").AsNode().FirstChild()
+	carets := make([]float64, 12)
+	for i := range carets {
+		carets[i] = float64(6 * i)
+	}
+	(*dom.Text)(text).SetTextFragments([]dom.TextFragment{
+		{X: 0, Y: 0, Width: 66, Height: 10, Start: 0, End: 11, Carets: carets},
+	})
+	_, err := executor.Runtime().Execute(`
+		document.addEventListener("selectstart", function(e) { log.push("selectstart@" + e.target.nodeName); });
+		document.addEventListener("selectionchange", function(e) { log.push("selectionchange:" + getSelection()); });
+		drain();
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return executor, doc, text, drain
+}
+
+func TestMouseSelection(t *testing.T) {
+	executor, doc, text, drain := newSelectionTestExecutor(t)
+	p := doc.GetElementById("p")
+	sel := doc.GetSelection()
+
+	executor.MouseMove(p, MouseInput{PageX: 37, PageY: 5})
+	drain()
+	executor.MouseDown(p, MouseInput{PageX: 37, PageY: 5})
+	if sel.AnchorNode() != text || sel.AnchorOffset() != 6 || !sel.IsCollapsed() {
+		t.Fatalf("after press, selection = %v %d collapsed %v, want the caret before world", sel.AnchorNode(), sel.AnchorOffset(), sel.IsCollapsed())
+	}
+
+	// Dragging back extends the selection backwards; the changes are
+	// reported by one selectionchange
+	executor.MouseMove(p, MouseInput{PageX: 14, PageY: 5})
+	executor.MouseMove(p, MouseInput{PageX: 13, PageY: 5})
+	executor.MouseUp(p, MouseInput{PageX: 13, PageY: 5})
+	executor.RunEventLoop()
+	if got := sel.ToString(); got != "llo " {
+		t.Errorf("selection = %q, want %q", got, "llo ")
+	}
+	if sel.Direction() != "backward" || sel.FocusOffset() != 2 {
+		t.Errorf("direction %s focus %d, want backward to 2", sel.Direction(), sel.FocusOffset())
+	}
+	if got, want := drain(), "pointerdown@p mousedown@p selectstart@#text pointermove@p mousemove@p pointermove@p mousemove@p pointerup@p mouseup@p click@p:1 selectionchange:llo "; got != want {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+
+	// Moving after the release leaves the selection alone
+	executor.MouseMove(p, MouseInput{PageX: 60, PageY: 5})
+	if got := sel.ToString(); got != "llo " {
+		t.Errorf("selection after release = %q, want it unchanged", got)
+	}
+
+	// Shift extends the selection from its anchor
+	executor.MouseDown(p, MouseInput{PageX: 66, PageY: 5, ShiftKey: true})
+	executor.MouseUp(p, MouseInput{PageX: 66, PageY: 5, ShiftKey: true})
+	if got := sel.ToString(); got != "world" {
+		t.Errorf("selection after shift click = %q, want %q", got, "world")
+	}
+}
+
+func TestCanceledSelectStart(t *testing.T) {
+	executor, doc, _, drain := newSelectionTestExecutor(t)
+	p := doc.GetElementById("p")
+	_, err := executor.Runtime().Execute(`
+		document.addEventListener("selectstart", function(e) { e.preventDefault(); });
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor.MouseDown(p, MouseInput{PageX: 0, PageY: 5})
+	executor.MouseMove(p, MouseInput{PageX: 30, PageY: 5})
+	executor.MouseUp(p, MouseInput{PageX: 30, PageY: 5})
+	executor.RunEventLoop()
+	if sel := doc.GetSelection(); sel.RangeCount() != 0 {
+		t.Errorf("selection = %q, want none", sel.ToString())
+	}
+	drain()
+}
+
+func TestScriptSelectionChange(t *testing.T) {
+	executor, _, _, drain := newSelectionTestExecutor(t)
+	_, err := executor.Runtime().Execute(`
+		var text = document.getElementById("p").firstChild;
+		getSelection().setBaseAndExtent(text, 0, text, 5);
+		getSelection().extend(text, 4);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := drain(); got != "" {
+		t.Errorf("events before the task ran = %q, want none", got)
+	}
+	executor.RunEventLoop()
+	if got := drain(); got != "selectionchange:Hell" {
+		t.Errorf("events = %q, want one selectionchange", got)
+	}
+}
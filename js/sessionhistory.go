@@ -0,0 +1,120 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the session history of a browsing context, which
+// the successive documents of a tab share.
+package js
+
+import "sync"
+
+// SessionHistory is the list of history entries of a browsing context and
+// the position of the current one. Documents loaded into the browsing
+// context add entries for themselves, and history.pushState and fragment
+// navigations add entries of the current document. Moving between entries
+// of one document does not load it again.
+// Reference: https://html.spec.whatwg.org/multipage/document-sequences.html#tn-session-history-entries
+type SessionHistory struct {
+	mu           sync.Mutex
+	entries      []HistoryEntry
+	index        int
+	nextDocument uint64
+	observers    []func()
+}
+
+// NewSessionHistory creates an empty session history.
+func NewSessionHistory() *SessionHistory {
+	return &SessionHistory{index: -1}
+}
+
+// Observe registers a function called after the entries or the current
+// entry change, on the goroutine that changed them.
+func (h *SessionHistory) Observe(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.observers = append(h.observers, fn)
+}
+
+// Navigate adds an entry for a new document at a URL after the current
+// entry, dropping the entries after it, or replaces the current entry.
+func (h *SessionHistory) Navigate(url string, replace bool) {
+	h.mu.Lock()
+	h.nextDocument++
+	h.add(HistoryEntry{URL: url, document: h.nextDocument}, replace)
+	h.mu.Unlock()
+	h.notify()
+}
+
+// Traverse makes the entry delta entries away from the current one
+// current, and returns the entries that were and became current. It
+// returns false if there is no such entry.
+func (h *SessionHistory) Traverse(delta int) (from, to HistoryEntry, ok bool) {
+	h.mu.Lock()
+	i := h.index + delta
+	if delta == 0 || h.index < 0 || i < 0 || i >= len(h.entries) {
+		h.mu.Unlock()
+		return HistoryEntry{}, HistoryEntry{}, false
+	}
+	from, to = h.entries[h.index], h.entries[i]
+	h.index = i
+	h.mu.Unlock()
+	h.notify()
+	return from, to, true
+}
+
+// Current returns the current entry, or false if there is none.
+func (h *SessionHistory) Current() (HistoryEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.index < 0 {
+		return HistoryEntry{}, false
+	}
+	return h.entries[h.index], true
+}
+
+// Len returns the number of entries.
+func (h *SessionHistory) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries)
+}
+
+// Index returns the position of the current entry, or -1 if there is none.
+func (h *SessionHistory) Index() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.index
+}
+
+// push adds an entry of a document after the current entry, dropping the
+// entries after it, or replaces the current entry. It returns false if the
+// current entry belongs to another document, as when the document was
+// navigated away from.
+func (h *SessionHistory) push(entry HistoryEntry, replace bool) bool {
+	h.mu.Lock()
+	if h.index < 0 || h.entries[h.index].document != entry.document {
+		h.mu.Unlock()
+		return false
+	}
+	h.add(entry, replace)
+	h.mu.Unlock()
+	h.notify()
+	return true
+}
+
+// add adds or replaces the current entry. The caller holds h.mu.
+func (h *SessionHistory) add(entry HistoryEntry, replace bool) {
+	if replace && h.index >= 0 {
+		h.entries[h.index] = entry
+		return
+	}
+	h.entries = append(h.entries[:h.index+1], entry)
+	h.index = len(h.entries) - 1
+}
+
+// notify calls the observers.
+func (h *SessionHistory) notify() {
+	h.mu.Lock()
+	observers := h.observers
+	h.mu.Unlock()
+	for _, fn := range observers {
+		fn()
+	}
+}
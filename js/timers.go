@@ -1,6 +1,7 @@
 package js
 
 import (
+	"sort"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ type timer struct {
 	dueTime  time.Time
 	interval time.Duration // 0 for setTimeout, >0 for setInterval
 	cleared  bool
+	queued   bool // Whether a task to run the callback is queued
 }
 
 // timerManager manages setTimeout and setInterval timers.
@@ -81,38 +83,58 @@ func (tm *timerManager) clearTimer(id int) {
 	}
 }
 
-// process checks and executes any due timers.
-func (tm *timerManager) process(r *Runtime) {
+// queueDue queues a task on the timer task source for each due timer that
+// is not queued yet, in the order they became due.
+// Per HTML spec: https://html.spec.whatwg.org/multipage/timers-and-user-prompts.html#timer-initialisation-steps
+func (tm *timerManager) queueDue(r *Runtime, now time.Time) {
 	tm.mu.Lock()
-	now := time.Now()
 	var dueTimers []*timer
 
 	for _, t := range tm.timers {
-		if !t.cleared && now.After(t.dueTime) || now.Equal(t.dueTime) {
+		if !t.cleared && !t.queued && !now.Before(t.dueTime) {
+			t.queued = true
 			dueTimers = append(dueTimers, t)
 		}
 	}
 	tm.mu.Unlock()
 
-	// Execute due timers outside the lock
-	for _, t := range dueTimers {
-		if t.cleared {
-			continue
+	sort.Slice(dueTimers, func(i, j int) bool {
+		if !dueTimers[i].dueTime.Equal(dueTimers[j].dueTime) {
+			return dueTimers[i].dueTime.Before(dueTimers[j].dueTime)
 		}
+		return dueTimers[i].id < dueTimers[j].id
+	})
+	for _, t := range dueTimers {
+		t := t
+		r.eventLoop.queueTask(TaskSourceTimer, func() {
+			tm.run(t)
+		})
+	}
+}
 
-		// Execute the callback
-		_, _ = t.callback(goja.Undefined(), t.args...)
+// run calls the callback of a queued timer unless it was cleared since,
+// then schedules an interval timer again or removes a one-shot timer.
+func (tm *timerManager) run(t *timer) {
+	tm.mu.Lock()
+	cleared := t.cleared
+	tm.mu.Unlock()
+	if cleared {
+		return
+	}
 
-		tm.mu.Lock()
-		if t.interval > 0 && !t.cleared {
-			// Reschedule interval timer
-			t.dueTime = time.Now().Add(t.interval)
-		} else {
-			// Remove one-shot timer
-			delete(tm.timers, t.id)
-		}
-		tm.mu.Unlock()
+	// Execute the callback
+	_, _ = t.callback(goja.Undefined(), t.args...)
+
+	tm.mu.Lock()
+	t.queued = false
+	if t.interval > 0 && !t.cleared {
+		// Reschedule interval timer
+		t.dueTime = time.Now().Add(t.interval)
+	} else {
+		// Remove one-shot timer
+		delete(tm.timers, t.id)
 	}
+	tm.mu.Unlock()
 }
 
 // hasPending returns true if there are any pending timers.
@@ -122,34 +144,22 @@ func (tm *timerManager) hasPending() bool {
 	return len(tm.timers) > 0
 }
 
-// nextDueTime returns the time until the next timer is due.
-// Returns 0 if no timers are pending, or if a timer is already due.
-func (tm *timerManager) nextDueTime() time.Duration {
+// nextDue returns when the next timer that is not queued yet becomes due,
+// or false if there is none.
+func (tm *timerManager) nextDue() (time.Time, bool) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	if len(tm.timers) == 0 {
-		return 0
-	}
-
-	now := time.Now()
-	var minDuration time.Duration = -1
-
+	var next time.Time
+	found := false
 	for _, t := range tm.timers {
-		if t.cleared {
+		if t.cleared || t.queued {
 			continue
 		}
-		d := t.dueTime.Sub(now)
-		if d <= 0 {
-			return 0
-		}
-		if minDuration < 0 || d < minDuration {
-			minDuration = d
+		if !found || t.dueTime.Before(next) {
+			next = t.dueTime
+			found = true
 		}
 	}
-
-	if minDuration < 0 {
-		return 0
-	}
-	return minDuration
+	return next, found
 }
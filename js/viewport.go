@@ -0,0 +1,263 @@
+// Package js provides JavaScript execution capabilities for the browser.
+// This file implements the window's viewport: innerWidth and innerHeight,
+// window.visualViewport, matchMedia and the resize and change events fired
+// when the browser resizes the viewport.
+package js
+
+import (
+	"sync"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/dop251/goja"
+)
+
+// ViewportManager manages the viewport of a window. The browser resizes
+// it from any goroutine; scripts see the new size, and resize and media
+// query change events fire, at the next rendering opportunity.
+// Reference: https://drafts.csswg.org/cssom-view/#resizing-viewports
+type ViewportManager struct {
+	runtime     *Runtime
+	eventBinder *EventBinder
+
+	mu         sync.Mutex
+	pending    css.Viewport // Size set by the browser, applied at the next frame
+	hasPending bool
+
+	// Only touched on the event loop
+	viewport      css.Viewport
+	styleResolver *css.StyleResolver
+	visual        *goja.Object
+	queries       []*mediaQueryList
+}
+
+// mediaQueryList is a MediaQueryList object returned by matchMedia, along
+// with whether it matched when media queries were last evaluated.
+type mediaQueryList struct {
+	obj     *goja.Object
+	list    *css.MediaQueryList
+	matches bool
+}
+
+// NewViewportManager creates a viewport manager whose viewport starts out
+// with the default size.
+func NewViewportManager(runtime *Runtime, eventBinder *EventBinder) *ViewportManager {
+	m := &ViewportManager{
+		runtime:     runtime,
+		eventBinder: eventBinder,
+		viewport:    css.DefaultViewport,
+	}
+	runtime.eventLoop.addFrameStep(m.runResizeSteps)
+	return m
+}
+
+// SetViewport resizes the viewport. It is safe to call from any goroutine.
+func (m *ViewportManager) SetViewport(vp css.Viewport) {
+	m.mu.Lock()
+	m.pending, m.hasPending = vp, true
+	m.mu.Unlock()
+	m.runtime.eventLoop.requestRendering()
+}
+
+// Viewport returns the viewport scripts currently see.
+func (m *ViewportManager) Viewport() css.Viewport {
+	return m.viewport
+}
+
+// setStyleResolver sets the style resolver whose viewport follows this one,
+// for getComputedStyle.
+func (m *ViewportManager) setStyleResolver(sr *css.StyleResolver) {
+	m.styleResolver = sr
+	if sr != nil {
+		sr.SetViewport(m.viewport)
+	}
+}
+
+// applyPending makes a size set by the browser the viewport's, reporting
+// whether the size changed.
+func (m *ViewportManager) applyPending() (resized, changed bool) {
+	m.mu.Lock()
+	vp, ok := m.pending, m.hasPending
+	m.hasPending = false
+	m.mu.Unlock()
+	if !ok || vp == m.viewport {
+		return false, false
+	}
+	resized = vp.Width != m.viewport.Width || vp.Height != m.viewport.Height
+	m.viewport = vp
+	if m.styleResolver != nil {
+		m.styleResolver.SetViewport(vp)
+	}
+	return resized, true
+}
+
+// SetupViewport installs the window's viewport properties, visualViewport
+// and matchMedia, over the stubs of the runtime.
+func (m *ViewportManager) SetupViewport(window *goja.Object) {
+	vm := m.runtime.VM()
+
+	// Before the first frame, a size the browser set applies at once
+	m.applyPending()
+
+	size := func(get func(vp css.Viewport) float64) goja.Value {
+		return vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			return vm.ToValue(get(m.viewport))
+		})
+	}
+	width := func(vp css.Viewport) float64 { return vp.Width }
+	height := func(vp css.Viewport) float64 { return vp.Height }
+	window.DefineAccessorProperty("innerWidth", size(width), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	window.DefineAccessorProperty("innerHeight", size(height), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	window.DefineAccessorProperty("outerWidth", size(width), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	window.DefineAccessorProperty("outerHeight", size(height), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+	window.DefineAccessorProperty("devicePixelRatio", size(func(vp css.Viewport) float64 {
+		if vp.DevicePixelRatio == 0 {
+			return 1
+		}
+		return vp.DevicePixelRatio
+	}), nil, goja.FLAG_TRUE, goja.FLAG_TRUE)
+
+	// window.visualViewport - the page is never pinch-zoomed, so the visual
+	// viewport is the layout viewport
+	visual := vm.NewObject()
+	m.visual = visual
+	m.eventBinder.BindEventTarget(visual)
+	visual.DefineAccessorProperty("width", size(width), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	visual.DefineAccessorProperty("height", size(height), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	for _, name := range []string{"offsetLeft", "offsetTop", "pageLeft", "pageTop"} {
+		visual.DefineAccessorProperty(name, size(func(css.Viewport) float64 { return 0 }), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	}
+	visual.DefineAccessorProperty("scale", size(func(css.Viewport) float64 { return 1 }), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	m.bindEventHandler(visual, "resize")
+	m.bindEventHandler(visual, "scroll")
+	window.Set("visualViewport", visual)
+
+	// window.matchMedia(query)
+	window.Set("matchMedia", func(call goja.FunctionCall) goja.Value {
+		if len(call.Arguments) < 1 {
+			panic(vm.NewTypeError("Failed to execute 'matchMedia' on 'Window': 1 argument required, but only 0 present."))
+		}
+		return m.matchMedia(call.Arguments[0].String())
+	})
+}
+
+// matchMedia creates a MediaQueryList for a media query list.
+// Reference: https://drafts.csswg.org/cssom-view/#dom-window-matchmedia
+func (m *ViewportManager) matchMedia(query string) *goja.Object {
+	vm := m.runtime.VM()
+	mql := &mediaQueryList{
+		obj:  vm.NewObject(),
+		list: css.ParseMediaQueryList(query),
+	}
+	mql.matches = mql.list.Matches(m.viewport)
+	m.queries = append(m.queries, mql)
+
+	obj := mql.obj
+	m.eventBinder.BindEventTarget(obj)
+	obj.DefineAccessorProperty("media", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(mql.list.MediaText())
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	obj.DefineAccessorProperty("matches", vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return vm.ToValue(mql.list.Matches(m.viewport))
+	}), nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+	m.bindEventHandler(obj, "change")
+
+	// The legacy addListener and removeListener add and remove change
+	// listeners
+	addEventListener := obj.Get("addEventListener")
+	removeEventListener := obj.Get("removeEventListener")
+	legacy := func(method goja.Value) func(call goja.FunctionCall) goja.Value {
+		fn, _ := goja.AssertFunction(method)
+		return func(call goja.FunctionCall) goja.Value {
+			if len(call.Arguments) < 1 || goja.IsNull(call.Arguments[0]) || fn == nil {
+				return goja.Undefined()
+			}
+			_, err := fn(obj, vm.ToValue("change"), call.Arguments[0])
+			if err != nil {
+				panic(err)
+			}
+			return goja.Undefined()
+		}
+	}
+	obj.Set("addListener", legacy(addEventListener))
+	obj.Set("removeListener", legacy(removeEventListener))
+	return obj
+}
+
+// bindEventHandler defines an event handler IDL attribute, such as
+// onresize, on an event target object.
+func (m *ViewportManager) bindEventHandler(obj *goja.Object, eventType string) {
+	vm := m.runtime.VM()
+	var handler goja.Value
+	obj.DefineAccessorProperty("on"+eventType,
+		vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			if handler == nil {
+				return goja.Null()
+			}
+			return handler
+		}),
+		vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			target := m.eventBinder.GetOrCreateTarget(obj)
+			if handler != nil {
+				target.RemoveEventListener(eventType, handler, false)
+				handler = nil
+			}
+			if len(call.Arguments) == 0 {
+				return goja.Undefined()
+			}
+			callable, ok := goja.AssertFunction(call.Arguments[0])
+			if !ok {
+				return goja.Undefined()
+			}
+			handler = call.Arguments[0]
+			target.AddEventListener(eventType, callable, handler, false, nil, listenerOptions{})
+			return goja.Undefined()
+		}),
+		goja.FLAG_FALSE, goja.FLAG_TRUE)
+}
+
+// runResizeSteps applies a size set by the browser at a rendering
+// opportunity: resize fires at the window and its visual viewport, then
+// media query lists whose matches changed fire change.
+// Reference: https://drafts.csswg.org/cssom-view/#run-the-resize-steps
+func (m *ViewportManager) runResizeSteps() {
+	resized, changed := m.applyPending()
+	if !changed || m.visual == nil {
+		return
+	}
+	vm := m.runtime.VM()
+	if resized {
+		if window := vm.Get("window"); window != nil {
+			m.fire(window.ToObject(vm), m.eventBinder.CreateEvent("resize", nil))
+		}
+		m.fire(m.visual, m.eventBinder.CreateEvent("resize", nil))
+	}
+	m.evaluateMediaQueries()
+}
+
+// evaluateMediaQueries fires change at the media query lists whose
+// matches changed since they were last evaluated.
+// Reference: https://drafts.csswg.org/cssom-view/#evaluate-media-queries-and-report-changes
+func (m *ViewportManager) evaluateMediaQueries() {
+	for _, mql := range m.queries {
+		matches := mql.list.Matches(m.viewport)
+		if matches == mql.matches {
+			continue
+		}
+		mql.matches = matches
+		event := m.eventBinder.CreateEvent("change", nil)
+		if proto := m.eventBinder.GetEventProto("MediaQueryListEvent"); proto != nil {
+			event.SetPrototype(proto)
+		}
+		event.Set("media", mql.list.MediaText())
+		event.Set("matches", matches)
+		m.fire(mql.obj, event)
+	}
+}
+
+// fire dispatches a trusted event at a target.
+func (m *ViewportManager) fire(target, event *goja.Object) {
+	if target == nil {
+		return
+	}
+	m.eventBinder.DispatchTrustedEvent(target, event)
+}
@@ -0,0 +1,64 @@
+package js
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+func TestViewportResize(t *testing.T) {
+	runtime := NewRuntime()
+	executor := NewScriptExecutor(runtime)
+	executor.SetViewport(css.Viewport{Width: 800, Height: 600, DevicePixelRatio: 1})
+	doc, err := dom.ParseHTML(`<div id="box" style="width: 50vw"></div>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor.SetupDocument(doc)
+	resolver := css.NewStyleResolver()
+	executor.SetStyleResolver(resolver)
+
+	agent := NewAgent(runtime)
+	agent.Start()
+	defer agent.Stop()
+
+	// The size set before the document was set up applies at once
+	if got := evaluate(t, agent, `innerWidth + "x" + innerHeight + " " + visualViewport.width + " " + devicePixelRatio`); got != "800x600 800 1" {
+		t.Errorf("initial viewport = %s", got)
+	}
+	evaluate(t, agent, `
+		var log = [];
+		var narrow = matchMedia("(max-width: 600px)");
+		var wide = matchMedia("(min-width: 700px)");
+		log.push(narrow.media + " " + narrow.matches);
+		addEventListener("resize", function(e) {
+			log.push("resize " + innerWidth + " " + e.isTrusted + " " + getComputedStyle(document.getElementById("box")).width);
+		});
+		visualViewport.onresize = function() { log.push("visual " + visualViewport.height); };
+		narrow.addListener(function(e) { log.push("narrow " + e.matches + " " + e.media + " " + (e instanceof MediaQueryListEvent)); });
+		wide.onchange = function(e) { log.push("wide " + e.matches); };
+		requestAnimationFrame(function() { log.push("frame"); });
+	`)
+
+	// Resizing fires resize, then change at the lists whose matches
+	// changed, before the animation frame callbacks
+	executor.SetViewport(css.Viewport{Width: 500, Height: 400, DevicePixelRatio: 1})
+	waitOnAgent(t, agent, `log.length == 6`)
+	want := "(max-width: 600px) false,resize 500 true 250px,visual 400,narrow true (max-width: 600px) true,wide false,frame"
+	if got := evaluate(t, agent, `log.join()`); got != want {
+		t.Errorf("log = %s\nwant  %s", got, want)
+	}
+	if got := resolver.Viewport(); got.Width != 500 || got.Height != 400 {
+		t.Errorf("style resolver viewport = %v", got)
+	}
+
+	// A change of the pixel ratio alone re-evaluates media queries without
+	// firing resize
+	evaluate(t, agent, `log = []; var hidpi = matchMedia("(min-resolution: 2dppx)"); hidpi.onchange = function(e) { log.push("hidpi " + e.matches); };`)
+	executor.SetViewport(css.Viewport{Width: 500, Height: 400, DevicePixelRatio: 2})
+	waitOnAgent(t, agent, `log.length == 1`)
+	if got := evaluate(t, agent, `log.join() + " " + devicePixelRatio`); got != "hidpi true 2" {
+		t.Errorf("log = %s", got)
+	}
+}
@@ -649,7 +649,10 @@ func (xhr *XMLHttpRequest) doRequest(body io.Reader) {
 		defer cancel()
 	}
 
-	ctx, xhr.cancelFunc = context.WithCancel(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	xhr.abortMu.Lock()
+	xhr.cancelFunc = cancel
+	xhr.abortMu.Unlock()
 
 	// Build request
 	req := &network.Request{
@@ -681,33 +684,33 @@ func (xhr *XMLHttpRequest) doRequest(body io.Reader) {
 		return
 	}
 
-	// Set response data
-	xhr.status = resp.StatusCode
-	xhr.statusText = http.StatusText(resp.StatusCode)
-	xhr.responseHeaders = resp.Headers
-	xhr.responseURL = resp.URL.String()
-
-	// Transition through states
-	if xhr.async {
-		xhr.runtime.eventLoop.queueGoFunc(func() {
-			xhr.setReadyState(XHRReadyStateHeadersReceived)
-		})
-		xhr.runtime.eventLoop.queueGoFunc(func() {
-			xhr.setReadyState(XHRReadyStateLoading)
-		})
-		xhr.runtime.eventLoop.queueGoFunc(func() {
-			xhr.responseText = string(resp.Body)
-			xhr.setReadyState(XHRReadyStateDone)
-			xhr.fireProgressEvent("load", true, int64(len(resp.Body)), int64(len(resp.Body)))
-			xhr.fireProgressEvent("loadend", false, int64(len(resp.Body)), int64(len(resp.Body)))
-		})
-	} else {
+	// Set response data and transition through states
+	xhr.deliver(func() {
+		xhr.status = resp.StatusCode
+		xhr.statusText = http.StatusText(resp.StatusCode)
+		xhr.responseHeaders = resp.Headers
+		xhr.responseURL = resp.URL.String()
 		xhr.setReadyState(XHRReadyStateHeadersReceived)
+	})
+	xhr.deliver(func() {
 		xhr.setReadyState(XHRReadyStateLoading)
+	})
+	xhr.deliver(func() {
 		xhr.responseText = string(resp.Body)
 		xhr.setReadyState(XHRReadyStateDone)
 		xhr.fireProgressEvent("load", true, int64(len(resp.Body)), int64(len(resp.Body)))
 		xhr.fireProgressEvent("loadend", false, int64(len(resp.Body)), int64(len(resp.Body)))
+	})
+}
+
+// deliver runs a step of processing the response. The steps of
+// asynchronous requests are tasks of the networking task source, as the
+// request runs on a goroutine of its own.
+func (xhr *XMLHttpRequest) deliver(step func()) {
+	if xhr.async {
+		xhr.runtime.eventLoop.queueTask(TaskSourceNetworking, step)
+	} else {
+		step()
 	}
 }
 
@@ -727,38 +730,24 @@ func (xhr *XMLHttpRequest) setReadyState(state int) {
 
 // handleError handles a network error.
 func (xhr *XMLHttpRequest) handleError(message string) {
-	xhr.errorFlag = true
-	xhr.sendFlag = false
-
-	if xhr.async {
-		xhr.runtime.eventLoop.queueGoFunc(func() {
-			xhr.setReadyState(XHRReadyStateDone)
-			xhr.fireProgressEvent("error", false, 0, 0)
-			xhr.fireProgressEvent("loadend", false, 0, 0)
-		})
-	} else {
+	xhr.deliver(func() {
+		xhr.errorFlag = true
+		xhr.sendFlag = false
 		xhr.setReadyState(XHRReadyStateDone)
 		xhr.fireProgressEvent("error", false, 0, 0)
 		xhr.fireProgressEvent("loadend", false, 0, 0)
-	}
+	})
 }
 
 // handleTimeout handles a request timeout.
 func (xhr *XMLHttpRequest) handleTimeout() {
-	xhr.errorFlag = true
-	xhr.sendFlag = false
-
-	if xhr.async {
-		xhr.runtime.eventLoop.queueGoFunc(func() {
-			xhr.setReadyState(XHRReadyStateDone)
-			xhr.fireProgressEvent("timeout", false, 0, 0)
-			xhr.fireProgressEvent("loadend", false, 0, 0)
-		})
-	} else {
+	xhr.deliver(func() {
+		xhr.errorFlag = true
+		xhr.sendFlag = false
 		xhr.setReadyState(XHRReadyStateDone)
 		xhr.fireProgressEvent("timeout", false, 0, 0)
 		xhr.fireProgressEvent("loadend", false, 0, 0)
-	}
+	})
 }
 
 // fireProgressEvent fires a progress event.
@@ -0,0 +1,813 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements the Unicode Bidirectional Algorithm.
+// Reference: https://www.unicode.org/reports/tr9/
+package layout
+
+import (
+	"github.com/go-text/typesetting/segmenter"
+	ucd "github.com/go-text/typesetting/unicodedata"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// maxBidiDepth is the deepest explicit embedding level (BD2).
+const maxBidiDepth = 125
+
+// Directional formatting characters, used to express CSS unicode-bidi.
+const (
+	lre = '\u202A'
+	rle = '\u202B'
+	pdf = '\u202C'
+	lro = '\u202D'
+	rlo = '\u202E'
+	lri = '\u2066'
+	rli = '\u2067'
+	fsi = '\u2068'
+	pdi = '\u2069'
+)
+
+// bidiParagraph holds the state of the bidi algorithm for one paragraph.
+type bidiParagraph struct {
+	text    []rune
+	initial []bidi.Class // the original classes
+	types   []bidi.Class // classes as rules resolve them
+	levels  []int
+	level   int // the paragraph embedding level
+	// matchingPDI maps isolate initiators to their matching PDI and
+	// matchingInitiator maps the other way, or -1 (BD9)
+	matchingPDI       []int
+	matchingInitiator []int
+}
+
+// resolveBidiLevels returns the embedding level of each character of a
+// paragraph. paragraphLevel is 0 or 1, or -1 to take the direction of the
+// first strong character (rules P2 and P3). Explicit formatting characters
+// and boundary neutrals, which the algorithm removes, get the level of the
+// character before them. Line-based rule L1 is left to the caller.
+func resolveBidiLevels(text []rune, paragraphLevel int) []int {
+	p := &bidiParagraph{text: text}
+	p.initial = make([]bidi.Class, len(text))
+	for i, r := range text {
+		props, _ := bidi.LookupRune(r)
+		p.initial[i] = props.Class()
+	}
+	p.types = append([]bidi.Class(nil), p.initial...)
+	p.levels = make([]int, len(text))
+	p.matchIsolates()
+
+	p.level = paragraphLevel
+	if p.level < 0 {
+		p.level = max(p.firstStrongLevel(0, len(text)), 0)
+	}
+	p.resolveExplicitLevels()
+	for _, seq := range p.isolatingRunSequences() {
+		seq.resolveWeakTypes()
+		seq.resolvePairedBrackets()
+		seq.resolveNeutralTypes()
+		seq.resolveImplicitLevels()
+	}
+	for i := range p.levels {
+		if p.removed(i) {
+			if i > 0 {
+				p.levels[i] = p.levels[i-1]
+			} else {
+				p.levels[i] = p.level
+			}
+		}
+	}
+	return p.levels
+}
+
+// matchIsolates pairs isolate initiators with their matching PDIs (BD9).
+func (p *bidiParagraph) matchIsolates() {
+	n := len(p.initial)
+	p.matchingPDI = make([]int, n)
+	p.matchingInitiator = make([]int, n)
+	var open []int
+	for i, t := range p.initial {
+		p.matchingPDI[i] = -1
+		p.matchingInitiator[i] = -1
+		switch t {
+		case bidi.LRI, bidi.RLI, bidi.FSI:
+			open = append(open, i)
+		case bidi.PDI:
+			if k := len(open); k > 0 {
+				p.matchingPDI[open[k-1]] = i
+				p.matchingInitiator[i] = open[k-1]
+				open = open[:k-1]
+			}
+		case bidi.B:
+			open = nil
+		}
+	}
+}
+
+// firstStrongLevel returns the level given by the first strong character
+// in text[start:end], skipping isolates, or -1 when there is none (P2).
+func (p *bidiParagraph) firstStrongLevel(start, end int) int {
+	for i := start; i < end; i++ {
+		switch p.initial[i] {
+		case bidi.L:
+			return 0
+		case bidi.R, bidi.AL:
+			return 1
+		case bidi.LRI, bidi.RLI, bidi.FSI:
+			if p.matchingPDI[i] < 0 {
+				return -1
+			}
+			i = p.matchingPDI[i]
+		case bidi.B:
+			return -1
+		}
+	}
+	return -1
+}
+
+// removed reports whether rule X9 removes the character at i.
+func (p *bidiParagraph) removed(i int) bool {
+	switch p.initial[i] {
+	case bidi.LRE, bidi.RLE, bidi.LRO, bidi.RLO, bidi.PDF, bidi.BN:
+		return true
+	}
+	return false
+}
+
+// bidiStatus is an entry of the directional status stack.
+type bidiStatus struct {
+	level    int
+	override bidi.Class // L, R, or ON for no override
+	isolate  bool
+}
+
+// nextLevel returns the least odd or even level above level.
+func nextLevel(level int, rtl bool) int {
+	if rtl {
+		return (level + 1) | 1
+	}
+	return (level + 2) &^ 1
+}
+
+// resolveExplicitLevels applies rules X1 to X8.
+func (p *bidiParagraph) resolveExplicitLevels() {
+	stack := []bidiStatus{{level: p.level, override: bidi.ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+	for i, t := range p.initial {
+		top := stack[len(stack)-1]
+		switch t {
+		case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO:
+			p.levels[i] = top.level
+			level := nextLevel(top.level, t == bidi.RLE || t == bidi.RLO)
+			if level <= maxBidiDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				override := bidi.ON
+				switch t {
+				case bidi.RLO:
+					override = bidi.R
+				case bidi.LRO:
+					override = bidi.L
+				}
+				stack = append(stack, bidiStatus{level: level, override: override})
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+		case bidi.RLI, bidi.LRI, bidi.FSI:
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+			rtl := t == bidi.RLI
+			if t == bidi.FSI {
+				end := p.matchingPDI[i]
+				if end < 0 {
+					end = len(p.initial)
+				}
+				rtl = p.firstStrongLevel(i+1, end) == 1
+			}
+			level := nextLevel(top.level, rtl)
+			if level <= maxBidiDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, bidiStatus{level: level, override: bidi.ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+		case bidi.PDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+		case bidi.PDF:
+			p.levels[i] = top.level
+			if overflowIsolates > 0 {
+				// Ignored inside an overflowing isolate
+			} else if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !top.isolate && len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case bidi.B:
+			p.levels[i] = p.level
+		case bidi.BN:
+			p.levels[i] = top.level
+		default:
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+		}
+	}
+}
+
+// isolatingRunSequence is a sequence of level runs that the weak, neutral
+// and implicit rules treat as a unit (BD13).
+type isolatingRunSequence struct {
+	p        *bidiParagraph
+	indexes  []int
+	level    int
+	sos, eos bidi.Class
+}
+
+// isolatingRunSequences splits the paragraph into level runs and chains
+// runs joined by matching isolate initiators and PDIs (X10).
+func (p *bidiParagraph) isolatingRunSequences() []*isolatingRunSequence {
+	var runs [][]int
+	var run []int
+	for i := range p.initial {
+		if p.removed(i) {
+			continue
+		}
+		if len(run) > 0 && p.levels[i] != p.levels[run[0]] {
+			runs = append(runs, run)
+			run = nil
+		}
+		run = append(run, i)
+	}
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+	runStartingAt := map[int][]int{}
+	for _, r := range runs {
+		runStartingAt[r[0]] = r
+	}
+
+	var sequences []*isolatingRunSequence
+	for _, r := range runs {
+		// Runs that continue an isolate belong to the initiator's sequence
+		if p.initial[r[0]] == bidi.PDI && p.matchingInitiator[r[0]] >= 0 {
+			continue
+		}
+		indexes := append([]int(nil), r...)
+		for {
+			last := indexes[len(indexes)-1]
+			end := p.matchingPDI[last]
+			if end < 0 {
+				break
+			}
+			next, ok := runStartingAt[end]
+			if !ok {
+				break
+			}
+			indexes = append(indexes, next...)
+		}
+		sequences = append(sequences, p.newSequence(indexes))
+	}
+	return sequences
+}
+
+// newSequence computes the level and sos and eos types of a sequence.
+func (p *bidiParagraph) newSequence(indexes []int) *isolatingRunSequence {
+	seq := &isolatingRunSequence{p: p, indexes: indexes, level: p.levels[indexes[0]]}
+	first, last := indexes[0], indexes[len(indexes)-1]
+
+	before := p.level
+	for i := first - 1; i >= 0; i-- {
+		if !p.removed(i) {
+			before = p.levels[i]
+			break
+		}
+	}
+	after := p.level
+	switch p.initial[last] {
+	case bidi.LRI, bidi.RLI, bidi.FSI:
+		// An unmatched isolate initiator compares with the paragraph
+	default:
+		for i := last + 1; i < len(p.initial); i++ {
+			if !p.removed(i) {
+				after = p.levels[i]
+				break
+			}
+		}
+	}
+	seq.sos = levelType(max(before, seq.level))
+	seq.eos = levelType(max(after, seq.level))
+	return seq
+}
+
+// levelType returns the strong type of the direction of a level.
+func levelType(level int) bidi.Class {
+	if level%2 == 1 {
+		return bidi.R
+	}
+	return bidi.L
+}
+
+// isIsolateControl reports whether t is an isolate initiator or PDI.
+func isIsolateControl(t bidi.Class) bool {
+	switch t {
+	case bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return true
+	}
+	return false
+}
+
+// resolveWeakTypes applies rules W1 to W7.
+func (s *isolatingRunSequence) resolveWeakTypes() {
+	types := s.p.types
+	idx := s.indexes
+
+	// W1: non-spacing marks take the type of the previous character
+	for k, i := range idx {
+		if types[i] != bidi.NSM {
+			continue
+		}
+		switch {
+		case k == 0:
+			types[i] = s.sos
+		case isIsolateControl(types[idx[k-1]]):
+			types[i] = bidi.ON
+		default:
+			types[i] = types[idx[k-1]]
+		}
+	}
+
+	// W2 and W3: European numbers after Arabic letters are Arabic numbers,
+	// and Arabic letters are right-to-left
+	strong := s.sos
+	for _, i := range idx {
+		switch types[i] {
+		case bidi.L, bidi.R, bidi.AL:
+			strong = types[i]
+		case bidi.EN:
+			if strong == bidi.AL {
+				types[i] = bidi.AN
+			}
+		}
+	}
+	for _, i := range idx {
+		if types[i] == bidi.AL {
+			types[i] = bidi.R
+		}
+	}
+
+	// W4: a single separator between two numbers of the same kind
+	for k := 1; k+1 < len(idx); k++ {
+		prev, cur, next := types[idx[k-1]], types[idx[k]], types[idx[k+1]]
+		switch {
+		case cur == bidi.ES && prev == bidi.EN && next == bidi.EN:
+			types[idx[k]] = bidi.EN
+		case cur == bidi.CS && prev == bidi.EN && next == bidi.EN:
+			types[idx[k]] = bidi.EN
+		case cur == bidi.CS && prev == bidi.AN && next == bidi.AN:
+			types[idx[k]] = bidi.AN
+		}
+	}
+
+	// W5: terminators next to European numbers become numbers
+	for k := 0; k < len(idx); k++ {
+		if types[idx[k]] != bidi.ET {
+			continue
+		}
+		end := k
+		for end < len(idx) && types[idx[end]] == bidi.ET {
+			end++
+		}
+		if (k > 0 && types[idx[k-1]] == bidi.EN) || (end < len(idx) && types[idx[end]] == bidi.EN) {
+			for j := k; j < end; j++ {
+				types[idx[j]] = bidi.EN
+			}
+		}
+		k = end - 1
+	}
+
+	// W6: remaining separators and terminators are neutral
+	for _, i := range idx {
+		switch types[i] {
+		case bidi.ES, bidi.ET, bidi.CS:
+			types[i] = bidi.ON
+		}
+	}
+
+	// W7: European numbers after left-to-right text are left-to-right
+	strong = s.sos
+	for _, i := range idx {
+		switch types[i] {
+		case bidi.L, bidi.R:
+			strong = types[i]
+		case bidi.EN:
+			if strong == bidi.L {
+				types[i] = bidi.L
+			}
+		}
+	}
+}
+
+// strongDirection returns the direction a resolved type counts as for the
+// neutral rules: numbers count as right-to-left.
+func strongDirection(t bidi.Class) bidi.Class {
+	switch t {
+	case bidi.L:
+		return bidi.L
+	case bidi.R, bidi.AL, bidi.EN, bidi.AN:
+		return bidi.R
+	}
+	return bidi.ON
+}
+
+// resolvePairedBrackets applies rule N0 to bracket pairs.
+func (s *isolatingRunSequence) resolvePairedBrackets() {
+	types := s.p.types
+	idx := s.indexes
+	embedding := levelType(s.level)
+
+	// BD16: identify bracket pairs with a stack of 63 openers
+	type opener struct {
+		pos   int
+		close rune
+	}
+	var stack []opener
+	var pairs [][2]int
+	for k, i := range idx {
+		if types[i] != bidi.ON {
+			continue
+		}
+		r := s.p.text[i]
+		props, _ := bidi.LookupRune(r)
+		if !props.IsBracket() {
+			continue
+		}
+		if props.IsOpeningBracket() {
+			if len(stack) == 63 {
+				break
+			}
+			closing, _ := ucd.LookupMirrorChar(r)
+			stack = append(stack, opener{pos: k, close: closing})
+			continue
+		}
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j].close == r || (stack[j].close == 0x232A && r == 0x3009) || (stack[j].close == 0x3009 && r == 0x232A) {
+				pairs = append(pairs, [2]int{stack[j].pos, k})
+				stack = stack[:j]
+				break
+			}
+		}
+	}
+	sortPairs(pairs)
+
+	for _, pair := range pairs {
+		open, close := pair[0], pair[1]
+		found := bidi.ON
+		for k := open + 1; k < close; k++ {
+			dir := strongDirection(types[idx[k]])
+			if dir == embedding {
+				found = embedding
+				break
+			}
+			if dir != bidi.ON {
+				found = dir
+			}
+		}
+		if found == bidi.ON {
+			continue
+		}
+		if found != embedding {
+			// Use the context before the brackets
+			context := s.sos
+			for k := open - 1; k >= 0; k-- {
+				if dir := strongDirection(types[idx[k]]); dir != bidi.ON {
+					context = dir
+					break
+				}
+			}
+			if context != found {
+				found = embedding
+			}
+		}
+		for _, k := range []int{open, close} {
+			types[idx[k]] = found
+			// Marks after a bracket follow its new type
+			for j := k + 1; j < len(idx) && s.p.initial[idx[j]] == bidi.NSM; j++ {
+				types[idx[j]] = found
+			}
+		}
+	}
+}
+
+// sortPairs orders bracket pairs by the position of their opener.
+func sortPairs(pairs [][2]int) {
+	for i := 1; i < len(pairs); i++ {
+		for j := i; j > 0 && pairs[j][0] < pairs[j-1][0]; j-- {
+			pairs[j], pairs[j-1] = pairs[j-1], pairs[j]
+		}
+	}
+}
+
+// isNeutral reports whether t is a neutral or isolate formatting type for
+// rules N1 and N2.
+func isNeutral(t bidi.Class) bool {
+	switch t {
+	case bidi.B, bidi.S, bidi.WS, bidi.ON, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return true
+	}
+	return false
+}
+
+// resolveNeutralTypes applies rules N1 and N2.
+func (s *isolatingRunSequence) resolveNeutralTypes() {
+	types := s.p.types
+	idx := s.indexes
+	embedding := levelType(s.level)
+	for k := 0; k < len(idx); k++ {
+		if !isNeutral(types[idx[k]]) {
+			continue
+		}
+		end := k
+		for end < len(idx) && isNeutral(types[idx[end]]) {
+			end++
+		}
+		before := s.sos
+		if k > 0 {
+			before = strongDirection(types[idx[k-1]])
+		}
+		after := s.eos
+		if end < len(idx) {
+			after = strongDirection(types[idx[end]])
+		}
+		resolved := embedding
+		if before == after {
+			resolved = before
+		}
+		for j := k; j < end; j++ {
+			types[idx[j]] = resolved
+		}
+		k = end - 1
+	}
+}
+
+// resolveImplicitLevels applies rules I1 and I2.
+func (s *isolatingRunSequence) resolveImplicitLevels() {
+	for _, i := range s.indexes {
+		level := s.p.levels[i]
+		switch t := s.p.types[i]; {
+		case level%2 == 0 && t == bidi.R:
+			level++
+		case level%2 == 0 && (t == bidi.AN || t == bidi.EN):
+			level += 2
+		case level%2 == 1 && (t == bidi.L || t == bidi.EN || t == bidi.AN):
+			level++
+		}
+		s.p.levels[i] = level
+	}
+}
+
+// visualOrder returns the indexes of items with the given levels in visual
+// order, left to right, by reversing every run at or above each odd level
+// (rule L2).
+func visualOrder(levels []int) []int {
+	order := make([]int, len(levels))
+	for i := range order {
+		order[i] = i
+	}
+	highest, lowestOdd := 0, maxBidiDepth+2
+	for _, l := range levels {
+		highest = max(highest, l)
+		if l%2 == 1 {
+			lowestOdd = min(lowestOdd, l)
+		}
+	}
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(order); i++ {
+			if levels[order[i]] < level {
+				continue
+			}
+			j := i
+			for j < len(order) && levels[order[j]] >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+			}
+			i = j
+		}
+	}
+	return order
+}
+
+// mirrorRune returns the mirrored glyph of a character with the
+// Bidi_Mirrored property, shown in right-to-left text (rule L4).
+func mirrorRune(r rune) rune {
+	if m, ok := ucd.LookupMirrorChar(r); ok {
+		return m
+	}
+	return r
+}
+
+// bidiControls returns the formatting characters that express the
+// unicode-bidi and direction of an inline box at its start and end.
+// Reference: https://www.w3.org/TR/css-writing-modes-3/#bidi-control-codes-injection-table
+func bidiControls(box *LayoutBox) (start, end []rune) {
+	style := box.ComputedStyle
+	rtl := getKeyword(style, "direction") == "rtl"
+	pick := func(ltr, rtlRune rune) rune {
+		if rtl {
+			return rtlRune
+		}
+		return ltr
+	}
+	switch getKeyword(style, "unicode-bidi") {
+	case "embed":
+		return []rune{pick(lre, rle)}, []rune{pdf}
+	case "isolate":
+		return []rune{pick(lri, rli)}, []rune{pdi}
+	case "bidi-override":
+		return []rune{pick(lro, rlo)}, []rune{pdf}
+	case "isolate-override":
+		return []rune{pick(lri, rli), pick(lro, rlo)}, []rune{pdf, pdi}
+	case "plaintext":
+		return []rune{fsi}, []rune{pdi}
+	}
+	return nil, nil
+}
+
+// resolveBidi runs the bidi algorithm over the inline formatting context,
+// with inline boxes contributing formatting characters for their
+// unicode-bidi, and records the level of each segment. Text segments are
+// split where their level changes.
+func (f *inlineFormatter) resolveBidi() {
+	style := f.container.ComputedStyle
+	rtl := getKeyword(f.style, "direction") == "rtl"
+	var text []rune
+	var owners []int // the segment of each character, or -1
+	add := func(owner int, runes ...rune) {
+		for _, r := range runes {
+			text = append(text, r)
+			owners = append(owners, owner)
+		}
+	}
+
+	// An override on the block container applies to all its content
+	var outerEnd []rune
+	switch getKeyword(style, "unicode-bidi") {
+	case "bidi-override", "isolate-override":
+		if rtl {
+			add(-1, rlo)
+		} else {
+			add(-1, lro)
+		}
+		outerEnd = []rune{pdf}
+	}
+	for i, seg := range f.segments {
+		switch seg.Kind {
+		case segmentOpen:
+			start, _ := bidiControls(seg.Box)
+			add(-1, start...)
+		case segmentClose:
+			_, end := bidiControls(seg.Box)
+			add(-1, end...)
+		case segmentText, segmentSpace:
+			add(i, []rune(seg.Text)...)
+		case segmentTab:
+			add(i, '\t')
+		case segmentBreak:
+			// Forced line breaks separate segments within the paragraph
+			add(i, 0x1F)
+		case segmentAtomic:
+			add(i, 0xFFFC)
+		}
+	}
+	add(-1, outerEnd...)
+
+	f.level = 0
+	if rtl {
+		f.level = 1
+	}
+	if getKeyword(style, "unicode-bidi") == "plaintext" {
+		p := &bidiParagraph{text: text, initial: make([]bidi.Class, len(text))}
+		for i, r := range text {
+			props, _ := bidi.LookupRune(r)
+			p.initial[i] = props.Class()
+		}
+		p.matchIsolates()
+		if level := p.firstStrongLevel(0, len(text)); level >= 0 {
+			f.level = level
+		}
+	}
+	levels := resolveBidiLevels(text, f.level)
+
+	// Inline boxes take the level of the embedding they establish, so that
+	// their edges reorder with their content
+	stack := []int{f.level}
+	var segments []*inlineSegment
+	pos := 0
+	for i, seg := range f.segments {
+		for pos < len(owners) && owners[pos] != i && owners[pos] < i {
+			pos++
+		}
+		switch seg.Kind {
+		case segmentOpen:
+			level := stack[len(stack)-1]
+			if start, _ := bidiControls(seg.Box); start != nil {
+				level = min(nextLevel(level, getKeyword(seg.Box.ComputedStyle, "direction") == "rtl"), maxBidiDepth)
+			}
+			seg.Level = level
+			stack = append(stack, level)
+		case segmentClose:
+			seg.Level = stack[len(stack)-1]
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case segmentText, segmentSpace:
+			runes := []rune(seg.Text)
+			start := 0
+			for k := 1; k <= len(runes); k++ {
+				if k < len(runes) && levels[pos+k] == levels[pos+start] {
+					continue
+				}
+				piece := *seg
+				piece.Text = string(runes[start:k])
+				piece.Level = levels[pos+start]
+				if k < len(runes) {
+					piece.BreakAfter, piece.Hyphen = false, false
+				}
+				piece.Offsets = seg.Offsets[start : k+1]
+				if start > 0 || k < len(runes) || piece.Level%2 == 1 {
+					piece.shape()
+				}
+				segments = append(segments, &piece)
+				start = k
+			}
+			continue
+		default:
+			seg.Level = levels[pos]
+		}
+		segments = append(segments, seg)
+	}
+	f.segments = segments
+}
+
+// reorderLine returns the segments of a line in visual order. White space
+// at the end of the line and before tabs and forced breaks takes the
+// paragraph level first (rule L1).
+func (f *inlineFormatter) reorderLine(segments []*inlineSegment) []*inlineSegment {
+	levels := make([]int, len(segments))
+	trailing := true
+	for i := len(segments) - 1; i >= 0; i-- {
+		seg := segments[i]
+		levels[i] = seg.Level
+		switch seg.Kind {
+		case segmentTab, segmentBreak:
+			levels[i] = f.level
+			trailing = true
+		case segmentSpace, segmentOpen, segmentClose:
+			if trailing {
+				levels[i] = f.level
+			}
+		default:
+			trailing = seg.Removed && trailing
+		}
+	}
+	visual := make([]*inlineSegment, len(segments))
+	for i, k := range visualOrder(levels) {
+		visual[i] = segments[k]
+	}
+	return visual
+}
+
+// VisualText returns the text of the item in display order. Right-to-left
+// text is reversed a grapheme cluster at a time, and characters such as
+// brackets are replaced by their mirror image.
+func (item *InlineItem) VisualText() string {
+	if item.Level%2 == 0 {
+		return item.Text
+	}
+	var seg segmenter.Segmenter
+	seg.Init([]rune(item.Text))
+	var clusters [][]rune
+	for iter := seg.GraphemeIterator(); iter.Next(); {
+		clusters = append(clusters, iter.Grapheme().Text)
+	}
+	out := make([]rune, 0, len(item.Text))
+	for i := len(clusters) - 1; i >= 0; i-- {
+		for _, r := range clusters[i] {
+			out = append(out, mirrorRune(r))
+		}
+	}
+	return string(out)
+}
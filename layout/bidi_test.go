@@ -0,0 +1,108 @@
+package layout
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveBidiLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		paragraph int
+		want      []int
+	}{
+		{"hebrew in ltr", "ab אב", 0, []int{0, 0, 0, 1, 1}},
+		{"auto direction", "אב 12", -1, []int{1, 1, 1, 2, 2}},
+		{"numbers between hebrew", "a אב 12 גד", 0, []int{0, 0, 1, 1, 1, 2, 2, 1, 1, 1}},
+		{"arabic digits after arabic letters", "عب 12", 0, []int{1, 1, 1, 2, 2}},
+		{"neutral between directions takes the embedding", "a ב", 1, []int{2, 1, 1}},
+		{"brackets follow the embedding", "אב(c)", 1, []int{1, 1, 1, 2, 1}},
+		{"isolate", "a\u2067אב\u2069c", 0, []int{0, 0, 1, 1, 0, 0}},
+		{"override", "\u202Eab\u202Cc", 0, []int{0, 1, 1, 1, 0}},
+		{"first strong isolate", "\u2068אb\u2069", 0, []int{0, 1, 2, 0}},
+		{"marks follow their base", "ב\u0301a", 0, []int{1, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveBidiLevels([]rune(tt.text), tt.paragraph)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("resolveBidiLevels(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisualOrder(t *testing.T) {
+	got := visualOrder([]int{0, 0, 1, 1, 2, 2, 1})
+	if want := []int{0, 1, 6, 4, 5, 3, 2}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("visualOrder = %v, want %v", got, want)
+	}
+}
+
+// lineItems returns the visual text and offset from the content edge of
+// each item on the first line of a block.
+func lineItems(box *LayoutBox) (texts []string, xs []float64) {
+	for _, item := range box.LineBoxes[0].InlineItems {
+		texts = append(texts, item.VisualText())
+		xs = append(xs, item.Rect.X-box.Dimensions.Content.X)
+	}
+	return texts, xs
+}
+
+func TestInlineBidiReordering(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 100px; margin: 0 }"
+	tests := []struct {
+		name  string
+		html  string
+		texts []string
+		xs    []float64
+	}{
+		{"hebrew in ltr", "<p>ab אבג cd</p>", []string{"ab ", "גבא", " cd"}, []float64{0, 18, 36}},
+		{"rtl paragraph", "<p dir='rtl'>abc אבג</p>", []string{"גבא ", "abc"}, []float64{58, 82}},
+		{"bdo overrides", "<p><bdo dir='rtl'>abc</bdo></p>", []string{"cba"}, []float64{0}},
+		{"plaintext takes the first strong direction", "<p style='unicode-bidi: plaintext'>אב (c)</p>", []string{"(", "c", ") בא"}, []float64{64, 70, 76}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := layoutHTML(t, "<body>"+tt.html+"</body>", stylesheet, "p", nil)
+			texts, xs := lineItems(p)
+			if fmt.Sprint(texts) != fmt.Sprint(tt.texts) || fmt.Sprint(xs) != fmt.Sprint(tt.xs) {
+				t.Errorf("items = %q at %v, want %q at %v", texts, xs, tt.texts, tt.xs)
+			}
+		})
+	}
+}
+
+func TestInlineBidiBoxEdges(t *testing.T) {
+	// The left padding of a right-to-left inline box stays on its left
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 100px; margin: 0 } span { padding-left: 4px }"
+	p := layoutHTML(t, "<body><p dir='rtl'>א <span>בג</span></p></body>", stylesheet, "p", nil)
+	span := findBox(p, "span")
+	text := span.Children[0].Fragments[0]
+	if got := text.Rect.X - span.Dimensions.Content.X; got != 0 {
+		t.Errorf("span text at %v from its content edge, want 0", got)
+	}
+	// The line holds 24px of text and 4px of padding against the right edge
+	if got := span.Dimensions.Content.X - p.Dimensions.Content.X; got != 100-28+4 {
+		t.Errorf("span content x = %v, want %v", got, 100-28+4)
+	}
+}
+
+func TestBlockDirection(t *testing.T) {
+	stylesheet := "body { margin: 0 } section { width: 200px } div { width: 50px; height: 10px }"
+	div := layoutHTML(t, "<body><section dir='rtl'><div></div></section></body>", stylesheet, "div", nil)
+	if div.Dimensions.Margin.Left != 150 || div.Dimensions.Margin.Right != 0 {
+		t.Errorf("margins = %v/%v, want 150/0", div.Dimensions.Margin.Left, div.Dimensions.Margin.Right)
+	}
+
+	div = layoutHTML(t, "<body><section dir='rtl'><div style='float: inline-start'></div></section></body>", stylesheet, "div", nil)
+	if div.Float != FloatRight {
+		t.Errorf("float: inline-start in rtl = %v, want FloatRight", div.Float)
+	}
+
+	div = layoutHTML(t, "<body><section dir='rtl'><div style='margin-inline-start: 10px'></div></section></body>", stylesheet, "div", nil)
+	if div.Dimensions.Margin.Right != 10 {
+		t.Errorf("margin-inline-start in rtl set margin-right = %v, want 10", div.Dimensions.Margin.Right)
+	}
+}
@@ -0,0 +1,181 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements find in page: searching the text a laid out page
+// renders and locating the matches on the page. The text searched is the
+// innerText of the page with the elements layout generated no boxes for
+// left out, so text hidden by display: none is not found.
+// Reference: https://html.spec.whatwg.org/multipage/dom.html#the-innertext-idl-attribute
+package layout
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// FindOptions controls how Find compares text.
+type FindOptions struct {
+	// CaseSensitive matches letters only in the same case
+	CaseSensitive bool
+	// DiacriticSensitive matches letters only with the same accents and
+	// other combining marks
+	DiacriticSensitive bool
+}
+
+// FindMatch is an occurrence of the text searched for on a page.
+type FindMatch struct {
+	// Text is the text matched, as rendered
+	Text string
+	// Spans are the parts of the text nodes the match was rendered from
+	Spans []dom.TextSpan
+	// Rects are the areas the match covers on each line it is placed on,
+	// in the coordinates of the layout tree
+	Rects []Rect
+}
+
+// Find searches the text rendered by a laid out page for a string and
+// returns its occurrences in document order. Matches do not overlap, and
+// ones that are not visible, such as text of visibility: hidden elements,
+// are left out. Runs of whitespace in the query match a single space; they
+// do not match line breaks between blocks.
+func Find(root *LayoutBox, query string, opts FindOptions) []FindMatch {
+	if root == nil || root.Element == nil {
+		return nil
+	}
+	needle, _ := foldText(query, opts)
+	needle = collapseSpaces(needle)
+	if strings.TrimSpace(needle) == "" {
+		return nil
+	}
+
+	// The elements being rendered and the boxes of the text nodes
+	rendered := make(map[*dom.Element]bool)
+	texts := make(map[*dom.Node][]*LayoutBox)
+	var walk func(box *LayoutBox)
+	walk = func(box *LayoutBox) {
+		if box.Element != nil {
+			rendered[box.Element] = true
+		}
+		if box.TextNode != nil {
+			switch getKeyword(box.ComputedStyle, "visibility") {
+			case "hidden", "collapse":
+			default:
+				texts[box.TextNode] = append(texts[box.TextNode], box)
+			}
+		}
+		for _, child := range box.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	text := root.Element.RenderedText(func(el *dom.Element) bool { return rendered[el] })
+	haystack, origins := foldText(text.Text, opts)
+
+	var matches []FindMatch
+	for i := 0; i < len(haystack); {
+		n := strings.Index(haystack[i:], needle)
+		if n < 0 {
+			break
+		}
+		from, to := i+n, i+n+len(needle)
+		i = to
+
+		// The match covers the characters the folded bytes came from
+		start := origins[from]
+		last := origins[to-1]
+		_, size := utf8.DecodeRuneInString(text.Text[last:])
+		end := last + size
+
+		match := FindMatch{Text: text.Text[start:end], Spans: text.Spans(start, end)}
+		for _, span := range match.Spans {
+			for _, box := range texts[span.Node] {
+				match.Rects = append(match.Rects, spanRects(box, span)...)
+			}
+		}
+		if len(match.Rects) > 0 {
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// spanRects returns the areas the part of a text node covers in the
+// fragments of one of its boxes.
+func spanRects(box *LayoutBox, span dom.TextSpan) []Rect {
+	var rects []Rect
+	for _, item := range box.Fragments {
+		s, e := max(span.Start, item.Start), min(span.End, item.End)
+		if s >= e || len(item.Carets) != item.End-item.Start+1 {
+			continue
+		}
+		x0, x1 := item.Carets[s-item.Start], item.Carets[e-item.Start]
+		if x0 > x1 {
+			x0, x1 = x1, x0
+		}
+		rects = append(rects, Rect{X: item.Rect.X + x0, Y: item.Rect.Y, Width: x1 - x0, Height: item.Rect.Height})
+	}
+	return rects
+}
+
+// foldText folds text for comparison under the options, returning the
+// folded text and, for each of its bytes, the byte offset of the character
+// of the text it was folded from. Spaces and no-break spaces fold to a
+// space, letters to lower case unless case matters and to their base
+// letters unless diacritics matter.
+func foldText(text string, opts FindOptions) (string, []int) {
+	var sb strings.Builder
+	origins := make([]int, 0, len(text))
+	for i, r := range text {
+		n := sb.Len()
+		switch {
+		case r == ' ' || r == '\t' || r == '\u00a0':
+			sb.WriteByte(' ')
+		case r < utf8.RuneSelf:
+			if !opts.CaseSensitive {
+				r = unicode.ToLower(r)
+			}
+			sb.WriteRune(r)
+		default:
+			// Decomposing separates the combining marks from base letters
+			decomposed := string(r)
+			if !opts.DiacriticSensitive {
+				decomposed = norm.NFD.String(decomposed)
+			}
+			for _, d := range decomposed {
+				if !opts.DiacriticSensitive && unicode.Is(unicode.Mn, d) {
+					continue
+				}
+				if !opts.CaseSensitive {
+					d = unicode.ToLower(d)
+				}
+				sb.WriteRune(d)
+			}
+		}
+		for ; n < sb.Len(); n++ {
+			origins = append(origins, i)
+		}
+	}
+	return sb.String(), origins
+}
+
+// collapseSpaces collapses runs of whitespace to a single space.
+func collapseSpaces(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				sb.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		sb.WriteRune(r)
+		space = false
+	}
+	return sb.String()
+}
@@ -0,0 +1,70 @@
+package layout
+
+import (
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	root := layoutHTML(t, `<body>
+		<p>Hello <b>World</b>, hello world</p>
+		<p style="display: none">hello inline</p>
+		<div class="gone">hello styled</div>
+		<p class="ghost">hello invisible</p>
+		<p>Café cafe CAFÉ</p>
+	</body>`, `.gone { display: none } .ghost { visibility: hidden }`, "html", nil)
+
+	tests := []struct {
+		query string
+		opts  FindOptions
+		want  []string
+	}{
+		{"hello", FindOptions{}, []string{"Hello", "hello"}},
+		{"hello", FindOptions{CaseSensitive: true}, []string{"hello"}},
+		{"hello  world", FindOptions{}, []string{"Hello World", "hello world"}},
+		{"cafe", FindOptions{}, []string{"Café", "cafe", "CAFÉ"}},
+		{"cafe", FindOptions{DiacriticSensitive: true}, []string{"cafe"}},
+		{"Cafe", FindOptions{CaseSensitive: true}, []string{"Café"}},
+		{"hidden", FindOptions{}, nil},
+		{"  ", FindOptions{}, nil},
+	}
+	for _, tt := range tests {
+		matches := Find(root, tt.query, tt.opts)
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Text)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Find(%q, %+v) = %q, want %q", tt.query, tt.opts, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Find(%q, %+v) = %q, want %q", tt.query, tt.opts, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// A match across elements spans the text nodes and covers their text
+	// on the page
+	matches := Find(root, "hello world", FindOptions{})
+	first := matches[0]
+	if len(first.Spans) != 2 || first.Spans[0].Start != 0 || first.Spans[0].End != 6 ||
+		first.Spans[1].Start != 0 || first.Spans[1].End != 5 {
+		t.Fatalf("spans = %+v, want Hello and World", first.Spans)
+	}
+	if len(first.Rects) != 2 {
+		t.Fatalf("got %d rects, want one for each text node", len(first.Rects))
+	}
+	hello, world := first.Rects[0], first.Rects[1]
+	if hello.X != findBox(root, "p").Dimensions.Content.X || hello.Width <= 0 || hello.Height <= 0 {
+		t.Errorf("Hello rect = %+v, want it at the start of the line", hello)
+	}
+	if world.Y != hello.Y || world.X < hello.X+hello.Width-0.01 {
+		t.Errorf("World rect = %+v, want it after %+v", world, hello)
+	}
+	second := matches[1].Rects[0]
+	if second.Y != hello.Y || second.X <= world.X+world.Width {
+		t.Errorf("second match rect = %+v, want it later on the line", second)
+	}
+}
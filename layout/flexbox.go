@@ -5,6 +5,10 @@ package layout
 import (
 	"math"
 	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
 )
 
 // FlexDirection represents the flex-direction property values.
@@ -47,6 +51,7 @@ const (
 	AlignItemsFlexEnd
 	AlignItemsCenter
 	AlignItemsBaseline
+	AlignItemsLastBaseline
 )
 
 // AlignContent represents the align-content property values.
@@ -59,6 +64,7 @@ const (
 	AlignContentCenter
 	AlignContentSpaceBetween
 	AlignContentSpaceAround
+	AlignContentSpaceEvenly
 )
 
 // AlignSelf represents the align-self property values.
@@ -71,6 +77,7 @@ const (
 	AlignSelfCenter
 	AlignSelfBaseline
 	AlignSelfStretch
+	AlignSelfLastBaseline
 )
 
 // FlexItem holds flex item-specific layout data during flex calculations.
@@ -90,6 +97,21 @@ type FlexItem struct {
 	TargetMainSize float64
 	Frozen         bool
 	Violation      float64
+
+	// The flex base size and the limits of the main size, of the border
+	// box, and the main-axis margins. A zero MaxMainSize is no limit.
+	BaseSize    float64
+	MinMainSize float64
+	MaxMainSize float64
+	MainMargins float64
+
+	// Baseline is the distance from the cross-start margin edge to the
+	// baseline the item is aligned by.
+	Baseline float64
+
+	// flexBasisPercentage is a percentage basis the flex shorthand gave the
+	// item, which resolves against the inner main size of the container.
+	flexBasisPercentage string
 }
 
 // FlexLine represents a line in flex layout (for wrap).
@@ -97,6 +119,16 @@ type FlexLine struct {
 	Items     []*FlexItem
 	MainSize  float64
 	CrossSize float64
+
+	// Gap is the space between adjacent items, CrossPos the offset of the
+	// line from the cross-start edge of the container.
+	Gap      float64
+	CrossPos float64
+	// The largest distances from the cross-start edge to the first
+	// baselines, and from the last baselines to the cross-end edge, of the
+	// items aligned by them
+	Baseline    float64
+	LastDescent float64
 }
 
 // FlexContainer holds flex container layout state.
@@ -111,45 +143,98 @@ type FlexContainer struct {
 	IsRowDirection bool
 	MainSize       float64
 	CrossSize      float64
+
+	// Whether main-start and cross-start are on the right or bottom
+	// rather than the left or top, and whether the cross size is known
+	// before the items are laid out
+	MainReverse   bool
+	CrossReverse  bool
+	CrossDefinite bool
+
+	// The gaps between items and between lines
+	MainGap  float64
+	CrossGap float64
 }
 
 // layoutFlex performs the flexbox layout algorithm.
 func (box *LayoutBox) layoutFlex(ctx *LayoutContext, containingBlock *Dimensions) {
-	// Step 1: Initialize flex container
-	container := initFlexContainer(box)
-
 	// Calculate container's main and cross sizes from containing block
-	box.calculateFlexContainerWidth(containingBlock)
+	box.calculateFlexContainerWidth(ctx, containingBlock)
 	box.calculateFlexContainerPosition(containingBlock, ctx)
 
 	// Handle explicit height if set (important for column flex containers)
-	if box.ComputedStyle != nil {
-		heightVal := box.ComputedStyle.GetPropertyValue("height")
-		if heightVal != nil && (heightVal.Length > 0 || (heightVal.Keyword != "auto" && heightVal.Keyword != "")) {
-			box.Dimensions.Content.Height = heightVal.Length
-		}
+	height, definite := box.definiteHeight()
+	box.Dimensions.Content.Height = height
+	box.layoutFlexContent(ctx, definite)
+	if !definite {
+		box.Dimensions.Content.Height = box.clampHeight(box.Dimensions.Content.Height)
+	}
+
+	// Handle relative positioning
+	if box.Position == PositionRelative {
+		x, y := box.Dimensions.Content.X, box.Dimensions.Content.Y
+		box.applyRelativePosition()
+		dx, dy := box.Dimensions.Content.X-x, box.Dimensions.Content.Y-y
+		box.Dimensions.Content.X, box.Dimensions.Content.Y = x, y
+		translateBox(box, dx, dy)
 	}
+}
+
+// layoutFlexContent lays out the items of a flex container whose content
+// width and position are set, and whose content height is set when it is
+// definite. Otherwise the content height becomes that of the items.
+// Reference: https://www.w3.org/TR/css-flexbox-1/#layout-algorithm
+func (box *LayoutBox) layoutFlexContent(ctx *LayoutContext, definiteHeight bool) {
+	// Step 1: Initialize flex container
+	container := initFlexContainer(box)
+	d := &box.Dimensions
 
 	// Get the available main/cross size
-	availableMain := box.Dimensions.Content.Width
-	availableCross := box.Dimensions.Content.Height
+	availableMain := d.Content.Width
+	availableCross := d.Content.Height
+	mainDefinite := true
+	container.CrossDefinite = definiteHeight
 	if !container.IsRowDirection {
 		availableMain, availableCross = availableCross, availableMain
+		mainDefinite, container.CrossDefinite = definiteHeight, true
+	}
+	container.MainSize, container.CrossSize = availableMain, availableCross
+	rowGap, _ := box.gap("row-gap", d.Content.Height)
+	columnGap, _ := box.gap("column-gap", d.Content.Width)
+	container.MainGap, container.CrossGap = columnGap, rowGap
+	if !container.IsRowDirection {
+		container.MainGap, container.CrossGap = rowGap, columnGap
 	}
 
 	// Step 2: Collect flex items and calculate their properties
 	items := collectFlexItems(box, container, ctx)
 	if len(items) == 0 {
+		if !definiteHeight {
+			d.Content.Height = 0
+		}
 		return
 	}
+	ctx.PushContainingBlock(d)
+	defer ctx.PopContainingBlock()
 
 	// Step 3: Determine the main size of flex items
 	for _, item := range items {
 		calculateHypotheticalMainSize(item, container, availableMain, ctx)
 	}
 
-	// Step 4: Collect flex items into flex lines
+	// Step 4: Collect flex items into flex lines. An indefinite main size
+	// is that of the longest line.
+	if !mainDefinite {
+		availableMain = math.Inf(1)
+	}
 	lines := collectFlexLines(items, container, availableMain)
+	if !mainDefinite {
+		availableMain = 0
+		for _, line := range lines {
+			availableMain = math.Max(availableMain, line.outerHypotheticalSize())
+		}
+		container.MainSize = availableMain
+	}
 
 	// Step 5: Resolve flexible lengths (grow/shrink)
 	for _, line := range lines {
@@ -158,16 +243,22 @@ func (box *LayoutBox) layoutFlex(ctx *LayoutContext, containingBlock *Dimensions
 
 	// Step 6: Determine cross size of each flex line
 	for _, line := range lines {
-		determineLineCrossSize(line, container, ctx, availableCross)
+		determineLineCrossSize(line, container, ctx)
 	}
-
-	// Step 7: Align flex items on cross axis within each line
-	for _, line := range lines {
-		alignItemsCrossAxis(line, container)
+	if len(lines) == 1 && container.Wrap == FlexWrapNowrap && container.CrossDefinite {
+		lines[0].CrossSize = availableCross
 	}
 
-	// Step 8: Align flex lines (if wrapping)
+	// Step 7: Align flex lines, stretching them if wrapping
 	totalCrossSize := alignFlexLines(lines, container, availableCross)
+	if !container.CrossDefinite {
+		container.CrossSize = totalCrossSize
+	}
+
+	// Step 8: Stretch items on the cross axis within each line
+	for _, line := range lines {
+		stretchFlexItems(line, container, ctx)
+	}
 
 	// Step 9: Main axis alignment (justify-content)
 	justifyInfos := make([]*JustifyInfo, len(lines))
@@ -176,22 +267,15 @@ func (box *LayoutBox) layoutFlex(ctx *LayoutContext, containingBlock *Dimensions
 	}
 
 	// Step 10: Position flex items
-	positionFlexItems(box, lines, container, justifyInfos)
+	positionFlexItems(box, lines, container, justifyInfos, ctx)
 
 	// Set the container's height based on content (if auto)
-	heightKeyword := getKeyword(box.ComputedStyle, "height")
-	if heightKeyword == "auto" || heightKeyword == "" {
-		if container.IsRowDirection {
-			box.Dimensions.Content.Height = totalCrossSize
-		} else {
-			box.Dimensions.Content.Height = calculateColumnFlexHeight(lines)
+	if !definiteHeight {
+		d.Content.Height = container.CrossSize
+		if !container.IsRowDirection {
+			d.Content.Height = container.MainSize
 		}
 	}
-
-	// Handle relative positioning
-	if box.Position == PositionRelative {
-		box.applyRelativePosition()
-	}
 }
 
 // initFlexContainer initializes flex container properties from computed style.
@@ -237,7 +321,7 @@ func initFlexContainer(box *LayoutBox) *FlexContainer {
 	}
 
 	// Parse justify-content
-	switch getKeyword(style, "justify-content") {
+	switch alignKeyword(style, "justify-content") {
 	case "flex-start":
 		container.JustifyContent = JustifyFlexStart
 	case "flex-end":
@@ -253,7 +337,7 @@ func initFlexContainer(box *LayoutBox) *FlexContainer {
 	}
 
 	// Parse align-items
-	switch getKeyword(style, "align-items") {
+	switch alignKeyword(style, "align-items") {
 	case "stretch":
 		container.AlignItems = AlignItemsStretch
 	case "flex-start":
@@ -264,15 +348,17 @@ func initFlexContainer(box *LayoutBox) *FlexContainer {
 		container.AlignItems = AlignItemsCenter
 	case "baseline":
 		container.AlignItems = AlignItemsBaseline
+	case "last baseline":
+		container.AlignItems = AlignItemsLastBaseline
 	}
 
 	// Parse align-content
-	switch getKeyword(style, "align-content") {
+	switch alignKeyword(style, "align-content") {
 	case "stretch":
 		container.AlignContent = AlignContentStretch
-	case "flex-start":
+	case "flex-start", "baseline":
 		container.AlignContent = AlignContentFlexStart
-	case "flex-end":
+	case "flex-end", "last baseline":
 		container.AlignContent = AlignContentFlexEnd
 	case "center":
 		container.AlignContent = AlignContentCenter
@@ -280,15 +366,96 @@ func initFlexContainer(box *LayoutBox) *FlexContainer {
 		container.AlignContent = AlignContentSpaceBetween
 	case "space-around":
 		container.AlignContent = AlignContentSpaceAround
+	case "space-evenly":
+		container.AlignContent = AlignContentSpaceEvenly
+	}
+
+	// Reverse directions start from the right or bottom; so do rows, and
+	// the columns of lines, in right-to-left text
+	rtl := getKeyword(box.inheritedStyle(), "direction") == "rtl"
+	reverse := container.Direction == FlexDirectionRowReverse || container.Direction == FlexDirectionColumnReverse
+	wrapReverse := container.Wrap == FlexWrapWrapReverse
+	if container.IsRowDirection {
+		container.MainReverse, container.CrossReverse = reverse != rtl, wrapReverse
+	} else {
+		container.MainReverse, container.CrossReverse = reverse, wrapReverse != rtl
 	}
 
 	return container
 }
 
-// calculateFlexContainerWidth calculates the width of a flex container.
-func (box *LayoutBox) calculateFlexContainerWidth(containingBlock *Dimensions) {
+// alignKeyword returns the value of a box alignment property as a single
+// keyword, with the start and end values as flex-start and flex-end,
+// baseline for first baseline, and no overflow safety.
+// Reference: https://www.w3.org/TR/css-align-3/
+func alignKeyword(style *css.ComputedStyle, property string) string {
+	words := strings.Fields(getText(style, property))
+	if len(words) > 1 && (words[0] == "safe" || words[0] == "unsafe") {
+		words = words[1:]
+	}
+	switch value := strings.Join(words, " "); value {
+	case "start", "self-start", "left":
+		return "flex-start"
+	case "end", "self-end", "right":
+		return "flex-end"
+	case "first baseline":
+		return "baseline"
+	case "normal":
+		return "stretch"
+	default:
+		return value
+	}
+}
+
+// gap returns the row-gap or column-gap of a box, percentages resolving
+// against the given size, falling back to the gap shorthand. It reports
+// false for normal, which is zero in flex layout.
+// Reference: https://www.w3.org/TR/css-align-3/#gaps
+func (box *LayoutBox) gap(property string, size float64) (float64, bool) {
+	style := box.ComputedStyle
+	if style == nil {
+		return 0, false
+	}
+	if val := style.GetPropertyValue(property); val != nil && !val.IsInitial {
+		switch {
+		case val.Value.Type == css.PercentageValue:
+			return val.Value.Length / 100 * size, true
+		case isLength(val):
+			return val.Length, true
+		}
+		return 0, false
+	}
+	// The first value of the shorthand is the row gap, the last the column
+	// gap
+	if val := style.GetPropertyValue("gap"); val == nil || val.IsInitial {
+		return 0, false
+	}
+	parts := strings.Fields(getText(style, "gap"))
+	if len(parts) == 0 {
+		return 0, false
+	}
+	part := parts[0]
+	if property == "column-gap" {
+		part = parts[len(parts)-1]
+	}
+	return style.LengthPercentage(part, size)
+}
+
+// calculateFlexContainerWidth calculates the width of a flex container. An
+// inline flex container with an auto width shrinks to fit its content.
+func (box *LayoutBox) calculateFlexContainerWidth(ctx *LayoutContext, containingBlock *Dimensions) {
+	if box.BoxType == InlineFlexBox {
+		if _, ok := box.resolveWidth(ctx, "width", containingBlock.Content.Width, layoutSize); !ok {
+			margins, edges := box.horizontalEdges()
+			available := *containingBlock
+			available.Content.Width = box.shrinkToFit(ctx, containingBlock.Content.Width-margins-edges) + margins + edges
+			box.calculateBlockWidth(ctx, &available)
+			box.resetInlineMargins()
+			return
+		}
+	}
 	// Flex containers use block-level width calculation
-	box.calculateBlockWidth(containingBlock)
+	box.calculateBlockWidth(ctx, containingBlock)
 }
 
 // calculateFlexContainerPosition calculates the position of a flex container.
@@ -338,10 +505,11 @@ func collectFlexItems(box *LayoutBox, container *FlexContainer, ctx *LayoutConte
 		}
 
 		item := &FlexItem{
-			Box:       child,
-			FlexGrow:  0,
-			FlexShrink: 1,
-			AlignSelf: AlignSelfAuto,
+			Box:           child,
+			FlexGrow:      0,
+			FlexShrink:    1,
+			FlexBasisAuto: true,
+			AlignSelf:     AlignSelfAuto,
 		}
 
 		style := child.ComputedStyle
@@ -352,37 +520,22 @@ func collectFlexItems(box *LayoutBox, container *FlexContainer, ctx *LayoutConte
 				item.Order = int(orderVal.Length)
 			}
 
-			// Parse flex-grow
-			flexGrowVal := style.GetPropertyValue("flex-grow")
-			if flexGrowVal != nil {
-				item.FlexGrow = flexGrowVal.Length
-			}
-
-			// Parse flex-shrink
-			flexShrinkVal := style.GetPropertyValue("flex-shrink")
-			if flexShrinkVal != nil {
-				item.FlexShrink = flexShrinkVal.Length
-			} else {
-				item.FlexShrink = 1 // Default
-			}
+			// Parse flex-grow and flex-shrink
+			item.FlexGrow = flexFactor(style, "flex-grow", 0)
+			item.FlexShrink = flexFactor(style, "flex-shrink", 1)
 
-			// Parse flex-basis
+			// Parse flex-basis; percentages are resolved with the main size
 			flexBasisVal := style.GetPropertyValue("flex-basis")
-			if flexBasisVal != nil {
-				if flexBasisVal.Keyword == "auto" {
-					item.FlexBasisAuto = true
-				} else if flexBasisVal.Length > 0 {
-					item.FlexBasis = flexBasisVal.Length
-					item.FlexBasisAuto = false
-				} else {
-					item.FlexBasisAuto = true
-				}
-			} else {
-				item.FlexBasisAuto = true
+			if flexBasisVal != nil && isLength(flexBasisVal) {
+				item.FlexBasis = flexBasisVal.Length
+				item.FlexBasisAuto = false
 			}
 
+			// The flex shorthand sets the factors and basis not set on their own
+			parseFlexShorthand(item, style)
+
 			// Parse align-self
-			switch getKeyword(style, "align-self") {
+			switch alignKeyword(style, "align-self") {
 			case "auto":
 				item.AlignSelf = AlignSelfAuto
 			case "flex-start":
@@ -393,6 +546,8 @@ func collectFlexItems(box *LayoutBox, container *FlexContainer, ctx *LayoutConte
 				item.AlignSelf = AlignSelfCenter
 			case "baseline":
 				item.AlignSelf = AlignSelfBaseline
+			case "last baseline":
+				item.AlignSelf = AlignSelfLastBaseline
 			case "stretch":
 				item.AlignSelf = AlignSelfStretch
 			}
@@ -412,6 +567,78 @@ func collectFlexItems(box *LayoutBox, container *FlexContainer, ctx *LayoutConte
 	return items
 }
 
+// flexFactor returns a flex factor of a style, which initial values carry
+// as a keyword.
+func flexFactor(style *css.ComputedStyle, property string, fallback float64) float64 {
+	val := style.GetPropertyValue(property)
+	switch {
+	case val == nil:
+		return fallback
+	case val.Keyword != "":
+		if n, err := strconv.ParseFloat(val.Keyword, 64); err == nil {
+			return n
+		}
+		return fallback
+	}
+	return val.Length
+}
+
+// parseFlexShorthand applies the flex shorthand of a style to the flex
+// factors and basis of an item that its longhands leave initial. A single
+// number is a grow factor with a zero basis.
+// Reference: https://www.w3.org/TR/css-flexbox-1/#flex-property
+func parseFlexShorthand(item *FlexItem, style *css.ComputedStyle) {
+	val := style.GetPropertyValue("flex")
+	if val == nil || val.IsInitial {
+		return
+	}
+	grow, shrink, basis := 0.0, 1.0, "auto"
+	switch words := strings.Fields(getText(style, "flex")); {
+	case len(words) == 1 && words[0] == "none":
+		shrink = 0
+	case len(words) == 1 && words[0] == "auto":
+		grow = 1
+	case len(words) == 1 && words[0] == "initial":
+	default:
+		var numbers []float64
+		basis = ""
+		for _, word := range words {
+			if n, err := strconv.ParseFloat(word, 64); err == nil && len(numbers) < 2 {
+				numbers = append(numbers, n)
+			} else {
+				basis = word
+			}
+		}
+		if len(numbers) > 0 {
+			grow = numbers[0]
+		}
+		if len(numbers) > 1 {
+			shrink = numbers[1]
+		}
+		if basis == "" {
+			basis = "0"
+		}
+	}
+	initial := func(property string) bool {
+		v := style.GetPropertyValue(property)
+		return v == nil || v.IsInitial
+	}
+	if initial("flex-grow") {
+		item.FlexGrow = grow
+	}
+	if initial("flex-shrink") {
+		item.FlexShrink = shrink
+	}
+	if initial("flex-basis") {
+		if strings.HasSuffix(basis, "%") {
+			item.flexBasisPercentage = basis
+			return
+		}
+		length, ok := style.LengthPercentage(basis, 0)
+		item.FlexBasis, item.FlexBasisAuto = length, !ok
+	}
+}
+
 // calculateFlexItemBoxModel calculates padding, border, margin for a flex item.
 func calculateFlexItemBoxModel(item *FlexItem, ctx *LayoutContext) {
 	box := item.Box
@@ -436,117 +663,265 @@ func calculateFlexItemBoxModel(item *FlexItem, ctx *LayoutContext) {
 	box.Dimensions.Margin.Bottom = getLength(style, "margin-bottom")
 }
 
-// calculateHypotheticalMainSize calculates the hypothetical main size of a flex item.
-func calculateHypotheticalMainSize(item *FlexItem, container *FlexContainer, availableMain float64, ctx *LayoutContext) {
-	box := item.Box
-	style := box.ComputedStyle
+// sides returns the physical sides at main-start, main-end, cross-start
+// and cross-end.
+func (c *FlexContainer) sides() [4]string {
+	main, cross := [2]string{"left", "right"}, [2]string{"top", "bottom"}
+	if !c.IsRowDirection {
+		main, cross = cross, main
+	}
+	if c.MainReverse {
+		main[0], main[1] = main[1], main[0]
+	}
+	if c.CrossReverse {
+		cross[0], cross[1] = cross[1], cross[0]
+	}
+	return [4]string{main[0], main[1], cross[0], cross[1]}
+}
 
-	var baseSize float64
+// edge returns the size of one side of a set of edges.
+func edge(e *EdgeSizes, side string) *float64 {
+	switch side {
+	case "left":
+		return &e.Left
+	case "right":
+		return &e.Right
+	case "top":
+		return &e.Top
+	}
+	return &e.Bottom
+}
 
-	// Determine base size from flex-basis or content
-	if item.FlexBasisAuto {
-		// Use the main size property if set, otherwise content size
-		if container.IsRowDirection {
-			widthVal := style.GetPropertyValue("width")
-			// Width is explicitly set if it has a length > 0 or is not "auto"
-			if widthVal != nil && (widthVal.Length > 0 || (widthVal.Keyword != "auto" && widthVal.Keyword != "")) {
-				baseSize = widthVal.Length
-			} else {
-				baseSize = estimateContentMainSize(item, container, ctx)
-			}
-		} else {
-			heightVal := style.GetPropertyValue("height")
-			// Height is explicitly set if it has a length > 0 or is not "auto"
-			if heightVal != nil && (heightVal.Length > 0 || (heightVal.Keyword != "auto" && heightVal.Keyword != "")) {
-				baseSize = heightVal.Length
-			} else {
-				baseSize = estimateContentMainSize(item, container, ctx)
-			}
-		}
-	} else {
-		baseSize = item.FlexBasis
+// mainEdges and crossEdges return the padding and borders of a box along
+// the main and cross axes.
+func (c *FlexContainer) mainEdges(d *Dimensions) float64 {
+	if c.IsRowDirection {
+		return d.Padding.Left + d.Padding.Right + d.Border.Left + d.Border.Right
 	}
+	return d.Padding.Top + d.Padding.Bottom + d.Border.Top + d.Border.Bottom
+}
 
-	// Add padding and border in the main axis
-	if container.IsRowDirection {
-		baseSize += box.Dimensions.Padding.Left + box.Dimensions.Padding.Right
-		baseSize += box.Dimensions.Border.Left + box.Dimensions.Border.Right
-	} else {
-		baseSize += box.Dimensions.Padding.Top + box.Dimensions.Padding.Bottom
-		baseSize += box.Dimensions.Border.Top + box.Dimensions.Border.Bottom
+func (c *FlexContainer) crossEdges(d *Dimensions) float64 {
+	if c.IsRowDirection {
+		return d.Padding.Top + d.Padding.Bottom + d.Border.Top + d.Border.Bottom
 	}
+	return d.Padding.Left + d.Padding.Right + d.Border.Left + d.Border.Right
+}
 
-	// Apply min/max constraints
-	baseSize = applyMainSizeConstraints(item, container, baseSize)
+// crossMargins returns the margins of a box along the cross axis, auto
+// ones being zero.
+func (c *FlexContainer) crossMargins(d *Dimensions) float64 {
+	if c.IsRowDirection {
+		return d.Margin.Top + d.Margin.Bottom
+	}
+	return d.Margin.Left + d.Margin.Right
+}
 
-	item.HypotheticalMainSize = baseSize
-	item.MainSize = baseSize
+// autoMargins reports which margins of a box are auto: those at the
+// main-start, main-end, cross-start and cross-end sides.
+func (c *FlexContainer) autoMargins(box *LayoutBox) (auto [4]bool) {
+	for i, side := range c.sides() {
+		auto[i] = getKeyword(box.ComputedStyle, "margin-"+side) == "auto"
+	}
+	return auto
 }
 
-// estimateContentMainSize estimates the content-based main size of a flex item.
-func estimateContentMainSize(item *FlexItem, container *FlexContainer, ctx *LayoutContext) float64 {
-	box := item.Box
+// alignment returns how an item is aligned in the cross axis, resolving
+// auto to the align-items of the container.
+func (item *FlexItem) alignment(container *FlexContainer) AlignSelf {
+	if item.AlignSelf != AlignSelfAuto {
+		return item.AlignSelf
+	}
+	switch container.AlignItems {
+	case AlignItemsFlexStart:
+		return AlignSelfFlexStart
+	case AlignItemsFlexEnd:
+		return AlignSelfFlexEnd
+	case AlignItemsCenter:
+		return AlignSelfCenter
+	case AlignItemsBaseline:
+		return AlignSelfBaseline
+	case AlignItemsLastBaseline:
+		return AlignSelfLastBaseline
+	}
+	return AlignSelfStretch
+}
 
-	// For text content, estimate based on text length
-	if box.TextContent != "" {
-		fontSize := 16.0
-		if box.ComputedStyle != nil {
-			fs := getLength(box.ComputedStyle, "font-size")
-			if fs > 0 {
-				fontSize = fs
-			}
-		}
-		if container.IsRowDirection {
-			return float64(len(box.TextContent)) * fontSize * 0.6
-		}
-		return fontSize * 1.2
+// baselineAligned reports whether an item takes part in baseline
+// alignment, which only applies to the rows of horizontal text.
+func (item *FlexItem) baselineAligned(container *FlexContainer) (aligned, last bool) {
+	switch item.alignment(container) {
+	case AlignSelfBaseline:
+		aligned = true
+	case AlignSelfLastBaseline:
+		aligned, last = true, true
 	}
+	auto := container.autoMargins(item.Box)
+	if !container.IsRowDirection || auto[2] || auto[3] {
+		return false, false
+	}
+	return aligned, last
+}
 
-	// For boxes with children, sum children's main sizes
-	var totalSize float64
-	for _, child := range box.Children {
-		childItem := &FlexItem{Box: child}
-		calculateFlexItemBoxModel(childItem, ctx)
-		childSize := estimateContentMainSize(childItem, container, ctx)
-		if container.IsRowDirection {
-			childSize += child.Dimensions.Margin.Left + child.Dimensions.Margin.Right
-		} else {
-			childSize += child.Dimensions.Margin.Top + child.Dimensions.Margin.Bottom
-		}
-		totalSize += childSize
+// calculateHypotheticalMainSize calculates the flex base size and the
+// hypothetical main size of a flex item: its flex-basis or main size when
+// definite, and otherwise the size of its laid out content, clamped by its
+// min and max main sizes.
+// Reference: https://www.w3.org/TR/css-flexbox-1/#algo-main-item
+func calculateHypotheticalMainSize(item *FlexItem, container *FlexContainer, availableMain float64, ctx *LayoutContext) {
+	box := item.Box
+	d := &box.Dimensions
+	edges := container.mainEdges(d)
+	if container.IsRowDirection {
+		item.MainMargins = d.Margin.Left + d.Margin.Right
+	} else {
+		item.MainMargins = d.Margin.Top + d.Margin.Bottom
+	}
+	containing := availableMain
+	if math.IsInf(availableMain, 1) || (!container.IsRowDirection && containing == 0) {
+		containing = indefinite
+	}
+
+	// Determine base size from flex-basis or content
+	baseSize, ok := item.flexBasis(containing)
+	if ok && box.BoxSizing == BoxSizingBorderBox {
+		baseSize -= edges
+	}
+	if !ok {
+		baseSize, ok = container.mainSizeProperty(ctx, box, "", containing)
 	}
+	if !ok {
+		baseSize = container.contentMainSize(ctx, item)
+	}
+
+	// Add padding and border in the main axis
+	item.BaseSize = math.Max(baseSize, 0) + edges
 
-	return totalSize
+	// Apply min/max constraints
+	item.MinMainSize, item.MaxMainSize = container.mainSizeLimits(ctx, item, containing)
+	item.HypotheticalMainSize = item.clampMain(item.BaseSize)
+	item.MainSize = item.HypotheticalMainSize
 }
 
-// applyMainSizeConstraints applies min/max constraints to the main size.
-func applyMainSizeConstraints(item *FlexItem, container *FlexContainer, size float64) float64 {
+// flexBasis returns the definite flex-basis of an item.
+func (item *FlexItem) flexBasis(containing float64) (float64, bool) {
+	if !item.FlexBasisAuto {
+		return item.FlexBasis, true
+	}
 	style := item.Box.ComputedStyle
-	if style == nil {
-		return size
+	if style == nil || containing == indefinite {
+		return 0, false
+	}
+	if item.flexBasisPercentage != "" {
+		return style.LengthPercentage(item.flexBasisPercentage, containing)
+	}
+	if val := style.GetPropertyValue("flex-basis"); val != nil && val.Value.Type == css.PercentageValue {
+		return val.Value.Length / 100 * containing, true
 	}
+	return 0, false
+}
 
-	var minProp, maxProp string
-	if container.IsRowDirection {
-		minProp, maxProp = "min-width", "max-width"
-	} else {
-		minProp, maxProp = "min-height", "max-height"
+// mainSizeProperty resolves the main size property of a box, or its min-
+// or max- variant given as prefix, to a content-box size.
+func (c *FlexContainer) mainSizeProperty(ctx *LayoutContext, box *LayoutBox, prefix string, containing float64) (float64, bool) {
+	if box.ComputedStyle == nil {
+		return 0, false
+	}
+	if c.IsRowDirection {
+		return box.resolveWidth(ctx, prefix+"width", containing, layoutSize)
+	}
+	return box.resolveHeight(prefix + "height")
+}
+
+// contentMainSize returns the main size of the content of an item: its
+// max-content width in a row, and in a column the height of its content
+// laid out at its cross size.
+func (c *FlexContainer) contentMainSize(ctx *LayoutContext, item *FlexItem) float64 {
+	box := item.Box
+	if box.Replaced != nil && !c.IsRowDirection {
+		saved := box.Dimensions
+		box.setEdges()
+		_, height := box.replacedContentSize(&Dimensions{Content: Rect{Width: c.CrossSize}})
+		box.Dimensions = saved
+		return height
+	}
+	if c.IsRowDirection {
+		_, maxContent := box.intrinsicWidths(ctx)
+		return maxContent
 	}
+	return box.contentHeightAt(ctx, c.columnItemWidth(ctx, item))
+}
 
-	minSize := getLength(style, minProp)
-	if size < minSize {
-		size = minSize
+// columnItemWidth returns the content width of an item in a column: its
+// width, or the width of the container when it is stretched, or else its
+// shrink-to-fit width.
+func (c *FlexContainer) columnItemWidth(ctx *LayoutContext, item *FlexItem) float64 {
+	box := item.Box
+	margins, edges := c.crossMargins(&box.Dimensions), c.crossEdges(&box.Dimensions)
+	available := math.Max(c.CrossSize-margins-edges, 0)
+	if width, ok := box.resolveWidth(ctx, "width", c.CrossSize, layoutSize); ok {
+		return box.clampWidth(ctx, width, c.CrossSize, layoutSize)
+	}
+	if auto := c.autoMargins(box); item.alignment(c) == AlignSelfStretch && !auto[2] && !auto[3] {
+		return box.clampWidth(ctx, available, c.CrossSize, layoutSize)
 	}
+	if box.ComputedStyle == nil {
+		return available
+	}
+	return box.clampWidth(ctx, box.shrinkToFit(ctx, available), c.CrossSize, layoutSize)
+}
 
-	maxKeyword := getKeyword(style, maxProp)
-	if maxKeyword != "none" && maxKeyword != "" {
-		maxSize := getLength(style, maxProp)
-		if maxSize > 0 && size > maxSize {
-			size = maxSize
+// mainSizeLimits returns the min and max main sizes of the border box of an
+// item. An auto minimum keeps an item that does not clip its overflow from
+// shrinking below the min-content size of its content, or its specified
+// size if that is smaller.
+// Reference: https://www.w3.org/TR/css-flexbox-1/#min-size-auto
+func (c *FlexContainer) mainSizeLimits(ctx *LayoutContext, item *FlexItem, containing float64) (minSize, maxSize float64) {
+	box := item.Box
+	edges := c.mainEdges(&box.Dimensions)
+	maxContent, hasMax := c.mainSizeProperty(ctx, box, "max-", containing)
+	if hasMax {
+		maxSize = math.Max(maxContent, 0) + edges
+	}
+	minContent, ok := c.mainSizeProperty(ctx, box, "min-", containing)
+	if !ok && box.Overflow == OverflowVisible && c.autoMinimum(box) {
+		if c.IsRowDirection {
+			minContent, _ = box.intrinsicWidths(ctx)
+		} else {
+			minContent = box.contentHeightAt(ctx, c.columnItemWidth(ctx, item))
+		}
+		if box.Replaced != nil {
+			minContent = c.contentMainSize(ctx, item)
+		}
+		if specified, ok := c.mainSizeProperty(ctx, box, "", containing); ok {
+			minContent = math.Min(minContent, specified)
+		}
+		if hasMax {
+			minContent = math.Min(minContent, maxContent)
 		}
 	}
+	return math.Max(minContent, 0) + edges, maxSize
+}
 
-	return size
+// autoMinimum reports whether the min main size of a box is auto.
+func (c *FlexContainer) autoMinimum(box *LayoutBox) bool {
+	if box.ComputedStyle == nil {
+		return true
+	}
+	property := "min-width"
+	if !c.IsRowDirection {
+		property = "min-height"
+	}
+	val := flowValue(box.ComputedStyle, property)
+	return val == nil || val.Keyword == "auto"
+}
+
+// clampMain applies the min and max main sizes of an item to a size.
+func (item *FlexItem) clampMain(size float64) float64 {
+	if item.MaxMainSize > 0 && size > item.MaxMainSize {
+		size = item.MaxMainSize
+	}
+	return math.Max(size, item.MinMainSize)
 }
 
 // collectFlexLines groups flex items into flex lines.
@@ -557,7 +932,7 @@ func collectFlexLines(items []*FlexItem, container *FlexContainer, availableMain
 
 	// If no wrapping, all items go in one line
 	if container.Wrap == FlexWrapNowrap {
-		return []*FlexLine{{Items: items}}
+		return []*FlexLine{{Items: items, Gap: container.MainGap}}
 	}
 
 	// Multi-line flex container
@@ -574,16 +949,16 @@ func collectFlexLines(items []*FlexItem, container *FlexContainer, availableMain
 		}
 
 		if currentLine == nil {
-			currentLine = &FlexLine{Items: []*FlexItem{item}}
+			currentLine = &FlexLine{Items: []*FlexItem{item}, Gap: container.MainGap}
 			currentMainSize = itemMainSize
-		} else if currentMainSize+itemMainSize > availableMain && len(currentLine.Items) > 0 {
+		} else if currentMainSize+container.MainGap+itemMainSize > availableMain && len(currentLine.Items) > 0 {
 			// Start new line
 			lines = append(lines, currentLine)
-			currentLine = &FlexLine{Items: []*FlexItem{item}}
+			currentLine = &FlexLine{Items: []*FlexItem{item}, Gap: container.MainGap}
 			currentMainSize = itemMainSize
 		} else {
 			currentLine.Items = append(currentLine.Items, item)
-			currentMainSize += itemMainSize
+			currentMainSize += container.MainGap + itemMainSize
 		}
 	}
 
@@ -591,243 +966,300 @@ func collectFlexLines(items []*FlexItem, container *FlexContainer, availableMain
 		lines = append(lines, currentLine)
 	}
 
-	// Handle wrap-reverse
-	if container.Wrap == FlexWrapWrapReverse {
-		for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
-			lines[i], lines[j] = lines[j], lines[i]
-		}
-	}
-
+	// Lines of wrap-reverse containers are stacked from the cross-end
+	// edge when the items are positioned
 	return lines
 }
 
-// resolveFlexibleLengths implements the flexible length resolution algorithm.
+// outerHypotheticalSize returns the main size the items of a line take
+// at their hypothetical main sizes, with the gaps between them.
+func (line *FlexLine) outerHypotheticalSize() float64 {
+	size := line.Gap * float64(len(line.Items)-1)
+	for _, item := range line.Items {
+		size += item.HypotheticalMainSize + item.MainMargins
+	}
+	return size
+}
+
+// resolveFlexibleLengths implements the flexible length resolution
+// algorithm: free space is distributed in proportion to the flex factors
+// of the items, freezing those that a min or max main size stops, until
+// every item is frozen.
+// Reference: https://www.w3.org/TR/css-flexbox-1/#resolve-flexible-lengths
 func resolveFlexibleLengths(line *FlexLine, availableMain float64) {
 	items := line.Items
 	if len(items) == 0 {
 		return
 	}
-
-	// Calculate initial used space (hypothetical sizes + margins)
-	usedMain := 0.0
-	for _, item := range items {
-		usedMain += item.HypotheticalMainSize
-		if item.Box.ComputedStyle != nil {
-			style := item.Box.ComputedStyle
-			usedMain += getLength(style, "margin-left") + getLength(style, "margin-right")
-		}
-	}
-
-	freeSpace := availableMain - usedMain
+	available := availableMain - line.Gap*float64(len(items)-1)
 
 	// Determine if we're growing or shrinking
-	growing := freeSpace > 0
-
-	// Initialize target sizes to hypothetical sizes
+	used := 0.0
 	for _, item := range items {
-		item.TargetMainSize = item.HypotheticalMainSize
+		used += item.HypotheticalMainSize + item.MainMargins
 	}
-
-	// Calculate total flex factor
-	totalFlex := 0.0
-	for _, item := range items {
+	growing := used < available
+	factor := func(item *FlexItem) float64 {
 		if growing {
-			totalFlex += item.FlexGrow
-		} else {
-			totalFlex += item.FlexShrink * item.HypotheticalMainSize
+			return item.FlexGrow
 		}
+		return item.FlexShrink
 	}
 
-	// If no flex, nothing to distribute
-	if totalFlex == 0 {
+	// Items that cannot flex take their hypothetical main size
+	for _, item := range items {
+		item.TargetMainSize = item.BaseSize
+		item.Frozen = factor(item) == 0 ||
+			(growing && item.BaseSize > item.HypotheticalMainSize) ||
+			(!growing && item.BaseSize < item.HypotheticalMainSize)
+		if item.Frozen {
+			item.TargetMainSize = item.HypotheticalMainSize
+		}
+	}
+	freeSpace := func() float64 {
+		free := available
 		for _, item := range items {
-			item.MainSize = item.HypotheticalMainSize
+			if item.Frozen {
+				free -= item.TargetMainSize + item.MainMargins
+			} else {
+				free -= item.BaseSize + item.MainMargins
+			}
 		}
-		return
+		return free
 	}
+	initialFree := freeSpace()
 
-	// Distribute free space according to flex factors
-	for _, item := range items {
-		var ratio float64
-		if growing {
-			if item.FlexGrow > 0 {
-				ratio = item.FlexGrow / totalFlex
-				item.TargetMainSize = item.HypotheticalMainSize + freeSpace*ratio
-			}
-		} else {
-			if item.FlexShrink > 0 && totalFlex > 0 {
-				ratio = (item.FlexShrink * item.HypotheticalMainSize) / totalFlex
-				// For shrinking, freeSpace is negative
-				item.TargetMainSize = item.HypotheticalMainSize + freeSpace*ratio
+	for {
+		var unfrozen []*FlexItem
+		totalFlex := 0.0
+		for _, item := range items {
+			if !item.Frozen {
+				unfrozen = append(unfrozen, item)
+				totalFlex += factor(item)
 			}
 		}
+		if len(unfrozen) == 0 {
+			break
+		}
 
-		// Apply min/max constraints
-		if item.Box.ComputedStyle != nil {
-			minSize := getLength(item.Box.ComputedStyle, "min-width")
-			if item.TargetMainSize < minSize {
-				item.TargetMainSize = minSize
-			}
+		// Flex factors that sum to less than one distribute only that
+		// fraction of the free space
+		free := freeSpace()
+		if totalFlex < 1 && math.Abs(initialFree*totalFlex) < math.Abs(free) {
+			free = initialFree * totalFlex
+		}
 
-			maxKeyword := getKeyword(item.Box.ComputedStyle, "max-width")
-			if maxKeyword != "none" && maxKeyword != "" {
-				maxSize := getLength(item.Box.ComputedStyle, "max-width")
-				if maxSize > 0 && item.TargetMainSize > maxSize {
-					item.TargetMainSize = maxSize
-				}
+		// Distribute free space according to flex factors
+		scaledShrink := 0.0
+		for _, item := range unfrozen {
+			scaledShrink += item.FlexShrink * item.BaseSize
+		}
+		for _, item := range unfrozen {
+			item.TargetMainSize = item.BaseSize
+			switch {
+			case growing && totalFlex > 0:
+				item.TargetMainSize += free * item.FlexGrow / totalFlex
+			case !growing && scaledShrink > 0:
+				// For shrinking, free space is negative
+				item.TargetMainSize += free * item.FlexShrink * item.BaseSize / scaledShrink
 			}
 		}
 
-		// Ensure non-negative
-		if item.TargetMainSize < 0 {
-			item.TargetMainSize = 0
+		// Fix min/max violations, freezing the items that were clamped in
+		// the direction of the total violation
+		total := 0.0
+		for _, item := range unfrozen {
+			clamped := item.clampMain(item.TargetMainSize)
+			item.Violation = clamped - item.TargetMainSize
+			item.TargetMainSize = clamped
+			total += item.Violation
+		}
+		for _, item := range unfrozen {
+			switch {
+			case math.Abs(total) < 1e-9:
+				item.Frozen = true
+			case total > 0 && item.Violation > 0, total < 0 && item.Violation < 0:
+				item.Frozen = true
+			}
 		}
+	}
 
+	for _, item := range items {
 		item.MainSize = item.TargetMainSize
 	}
 }
 
-// determineLineCrossSize determines the cross size of a flex line.
-func determineLineCrossSize(line *FlexLine, container *FlexContainer, ctx *LayoutContext, availableCross float64) {
+// determineLineCrossSize determines the hypothetical cross sizes of the
+// items of a line, laying them out at their main sizes, and the cross size
+// of the line: that of its largest item, or of the items aligned by their
+// baselines taken together.
+func determineLineCrossSize(line *FlexLine, container *FlexContainer, ctx *LayoutContext) {
 	maxCross := 0.0
+	var maxAscent, maxDescent, maxLastAscent float64
 
 	for _, item := range line.Items {
+		box := item.Box
+		d := &box.Dimensions
+		edges := container.crossEdges(d)
+
 		// Calculate cross size based on content or explicit size
 		var crossSize float64
-
-		style := item.Box.ComputedStyle
+		first, last, hasBaseline := 0.0, 0.0, false
 		if container.IsRowDirection {
-			heightVal := style.GetPropertyValue("height")
-			if heightVal != nil && (heightVal.Length > 0 || (heightVal.Keyword != "auto" && heightVal.Keyword != "")) {
-				crossSize = heightVal.Length
-			} else {
-				crossSize = estimateContentCrossSize(item, container, ctx)
+			width := math.Max(item.MainSize-container.mainEdges(d), 0)
+			height, ok := box.resolveHeight("height")
+			if aligned, _ := item.baselineAligned(container); !ok || aligned {
+				var measured float64
+				measured, first, last, hasBaseline = box.measureFlexItem(ctx, width)
+				if !ok {
+					height = measured
+				}
 			}
-			crossSize += item.Box.Dimensions.Padding.Top + item.Box.Dimensions.Padding.Bottom
-			crossSize += item.Box.Dimensions.Border.Top + item.Box.Dimensions.Border.Bottom
+			crossSize = box.clampHeight(height)
 		} else {
-			widthVal := style.GetPropertyValue("width")
-			if widthVal != nil && (widthVal.Length > 0 || (widthVal.Keyword != "auto" && widthVal.Keyword != "")) {
-				crossSize = widthVal.Length
-			} else {
-				crossSize = estimateContentCrossSize(item, container, ctx)
-			}
-			crossSize += item.Box.Dimensions.Padding.Left + item.Box.Dimensions.Padding.Right
-			crossSize += item.Box.Dimensions.Border.Left + item.Box.Dimensions.Border.Right
-		}
-
-		item.CrossSize = crossSize
-		if crossSize > maxCross {
-			maxCross = crossSize
-		}
-	}
-
-	line.CrossSize = maxCross
-
-	// Apply stretch for items with align-self: stretch
-	for _, item := range line.Items {
-		alignSelf := item.AlignSelf
-		if alignSelf == AlignSelfAuto {
-			// Use container's align-items
-			switch container.AlignItems {
-			case AlignItemsStretch:
-				alignSelf = AlignSelfStretch
-			case AlignItemsFlexStart:
-				alignSelf = AlignSelfFlexStart
-			case AlignItemsFlexEnd:
-				alignSelf = AlignSelfFlexEnd
-			case AlignItemsCenter:
-				alignSelf = AlignSelfCenter
-			case AlignItemsBaseline:
-				alignSelf = AlignSelfBaseline
-			}
+			crossSize = container.columnItemWidth(ctx, item)
 		}
+		item.CrossSize = crossSize + edges
 
-		if alignSelf == AlignSelfStretch {
-			item.CrossSize = line.CrossSize
-		}
-	}
-}
-
-// estimateContentCrossSize estimates the cross-axis content size.
-func estimateContentCrossSize(item *FlexItem, container *FlexContainer, ctx *LayoutContext) float64 {
-	box := item.Box
-
-	if box.TextContent != "" {
-		fontSize := 16.0
-		if box.ComputedStyle != nil {
-			fs := getLength(box.ComputedStyle, "font-size")
-			if fs > 0 {
-				fontSize = fs
-			}
+		outer := item.CrossSize + container.crossMargins(d)
+		aligned, lastBaseline := item.baselineAligned(container)
+		if !aligned {
+			maxCross = math.Max(maxCross, outer)
+			continue
 		}
-		if container.IsRowDirection {
-			return fontSize * 1.2
+		// Items without a baseline are aligned by the bottom of their
+		// border box
+		top := d.Margin.Top + d.Border.Top + d.Padding.Top
+		if !hasBaseline {
+			top, first, last = d.Margin.Top, item.CrossSize, item.CrossSize
 		}
-		return float64(len(box.TextContent)) * fontSize * 0.6
-	}
-
-	// For boxes with children, estimate based on content
-	var totalSize float64
-	for _, child := range box.Children {
-		childItem := &FlexItem{Box: child}
-		childSize := estimateContentCrossSize(childItem, container, ctx)
-		if container.IsRowDirection {
-			childSize += child.Dimensions.Margin.Top + child.Dimensions.Margin.Bottom
+		if lastBaseline {
+			item.Baseline = top + last
+			maxLastAscent = math.Max(maxLastAscent, item.Baseline)
+			line.LastDescent = math.Max(line.LastDescent, outer-item.Baseline)
 		} else {
-			childSize += child.Dimensions.Margin.Left + child.Dimensions.Margin.Right
-		}
-		if childSize > totalSize {
-			totalSize = childSize
+			item.Baseline = top + first
+			maxAscent = math.Max(maxAscent, item.Baseline)
+			maxDescent = math.Max(maxDescent, outer-item.Baseline)
 		}
 	}
 
-	return totalSize
+	line.Baseline = maxAscent
+	line.CrossSize = math.Max(maxCross, math.Max(maxAscent+maxDescent, maxLastAscent+line.LastDescent))
 }
 
-// alignItemsCrossAxis aligns items on the cross axis within a line.
-func alignItemsCrossAxis(line *FlexLine, container *FlexContainer) {
-	for _, item := range line.Items {
-		alignSelf := item.AlignSelf
-		if alignSelf == AlignSelfAuto {
-			switch container.AlignItems {
-			case AlignItemsFlexStart:
-				alignSelf = AlignSelfFlexStart
-			case AlignItemsFlexEnd:
-				alignSelf = AlignSelfFlexEnd
-			case AlignItemsCenter:
-				alignSelf = AlignSelfCenter
-			case AlignItemsBaseline:
-				alignSelf = AlignSelfBaseline
-			default:
-				alignSelf = AlignSelfStretch
-			}
-		}
-
-		// The actual offset is calculated during positioning
-		// Store the alignment for use later
+// measureFlexItem lays out the content of an item at the given content
+// width and returns the height it takes and its first and last baselines
+// from the top of its content box, if it has any. The item is left to be
+// laid out again.
+func (box *LayoutBox) measureFlexItem(ctx *LayoutContext, width float64) (height, first, last float64, ok bool) {
+	saved := box.Dimensions
+	box.Dimensions.Content = Rect{Width: width}
+	height = box.layoutFlexItemContent(ctx, false)
+	first, ok = box.lineBaseline(false)
+	last, _ = box.lineBaseline(true)
+	if box.TextContent != "" {
+		metrics := resolveTextMetrics(box.inheritedStyle(), ctx.Fonts)
+		ascent, _ := strutMetrics(metrics)
+		first, last, ok = ascent, height-metrics.LineHeight+ascent, true
 	}
+	resetHeights(box)
+	box.Dimensions = saved
+	return height, first, last, ok
 }
 
-// alignFlexLines aligns flex lines within the container.
+// alignFlexLines distributes the free cross space of the container
+// between the lines, by align-content, and returns the cross size the
+// lines take. Each line records its offset from the cross-start edge.
 func alignFlexLines(lines []*FlexLine, container *FlexContainer, availableCross float64) float64 {
 	if len(lines) == 0 {
 		return 0
 	}
 
 	// Calculate total cross size of all lines
-	totalCross := 0.0
+	totalCross := container.CrossGap * float64(len(lines)-1)
 	for _, line := range lines {
 		totalCross += line.CrossSize
 	}
 
+	var start, between float64
+	if free := availableCross - totalCross; container.CrossDefinite && container.Wrap != FlexWrapNowrap {
+		n := float64(len(lines))
+		switch container.AlignContent {
+		case AlignContentStretch:
+			if free > 0 {
+				for _, line := range lines {
+					line.CrossSize += free / n
+				}
+				totalCross = availableCross
+			}
+		case AlignContentFlexEnd:
+			start = free
+		case AlignContentCenter:
+			start = free / 2
+		case AlignContentSpaceBetween:
+			if free > 0 && n > 1 {
+				between = free / (n - 1)
+			}
+		case AlignContentSpaceAround:
+			if free > 0 {
+				between = free / n
+				start = between / 2
+			} else {
+				start = free / 2
+			}
+		case AlignContentSpaceEvenly:
+			if free > 0 {
+				between = free / (n + 1)
+				start = between
+			} else {
+				start = free / 2
+			}
+		}
+	}
+
+	pos := start
+	for _, line := range lines {
+		line.CrossPos = pos
+		pos += line.CrossSize + container.CrossGap + between
+	}
 	return totalCross
 }
 
+// stretchFlexItems gives the items of a line that stretch the cross size
+// of the line, less their margins.
+func stretchFlexItems(line *FlexLine, container *FlexContainer, ctx *LayoutContext) {
+	for _, item := range line.Items {
+		box := item.Box
+		auto := container.autoMargins(box)
+		if item.alignment(container) != AlignSelfStretch || auto[2] || auto[3] {
+			continue
+		}
+		d := &box.Dimensions
+		edges := container.crossEdges(d)
+		size := math.Max(line.CrossSize-container.crossMargins(d)-edges, 0)
+		if container.IsRowDirection {
+			if _, ok := box.resolveHeight("height"); ok {
+				continue
+			}
+			size = box.clampHeight(size)
+		} else {
+			if _, ok := box.resolveWidth(ctx, "width", container.CrossSize, layoutSize); ok {
+				continue
+			}
+			size = box.clampWidth(ctx, size, container.CrossSize, layoutSize)
+		}
+		item.CrossSize = size + edges
+	}
+}
+
 // JustifyInfo holds justify-content spacing information for a line.
 type JustifyInfo struct {
 	StartOffset  float64
 	BetweenSpace float64
+	// AutoMargin is the size of each auto margin in the main axis, which
+	// take the free space before justify-content
+	AutoMargin float64
 }
 
 // justifyMainAxis calculates spacing for justify-content but doesn't modify items.
@@ -839,25 +1271,29 @@ func justifyMainAxis(line *FlexLine, container *FlexContainer, availableMain flo
 	}
 
 	// Calculate used main size
-	usedMain := 0.0
+	usedMain := line.Gap * float64(len(line.Items)-1)
+	autoMargins := 0
 	for _, item := range line.Items {
-		usedMain += item.MainSize
-		if container.IsRowDirection {
-			usedMain += item.Box.Dimensions.Margin.Left + item.Box.Dimensions.Margin.Right
-		} else {
-			usedMain += item.Box.Dimensions.Margin.Top + item.Box.Dimensions.Margin.Bottom
+		usedMain += item.MainSize + item.MainMargins
+		auto := container.autoMargins(item.Box)
+		for _, a := range auto[:2] {
+			if a {
+				autoMargins++
+			}
 		}
 	}
 
 	freeSpace := availableMain - usedMain
-	if freeSpace < 0 {
-		freeSpace = 0
-	}
-
 	line.MainSize = usedMain
 	numItems := len(line.Items)
 
-	// Calculate spacing based on justify-content
+	if autoMargins > 0 {
+		info.AutoMargin = math.Max(freeSpace, 0) / float64(autoMargins)
+		return info
+	}
+
+	// Calculate spacing based on justify-content. Space that does not fit
+	// overflows at the end, or on both sides of centered items.
 	switch container.JustifyContent {
 	case JustifyFlexStart:
 		info.StartOffset = 0
@@ -870,203 +1306,143 @@ func justifyMainAxis(line *FlexLine, container *FlexContainer, availableMain flo
 		info.BetweenSpace = 0
 	case JustifySpaceBetween:
 		info.StartOffset = 0
-		if numItems > 1 {
+		if numItems > 1 && freeSpace > 0 {
 			info.BetweenSpace = freeSpace / float64(numItems-1)
 		}
 	case JustifySpaceAround:
-		if numItems > 0 {
+		if freeSpace > 0 {
 			info.BetweenSpace = freeSpace / float64(numItems)
 			info.StartOffset = info.BetweenSpace / 2
+		} else {
+			info.StartOffset = freeSpace / 2
 		}
 	case JustifySpaceEvenly:
-		if numItems > 0 {
+		if freeSpace > 0 {
 			info.BetweenSpace = freeSpace / float64(numItems+1)
 			info.StartOffset = info.BetweenSpace
+		} else {
+			info.StartOffset = freeSpace / 2
 		}
 	}
 
 	return info
 }
 
-// positionFlexItems positions all flex items in the container.
-func positionFlexItems(box *LayoutBox, lines []*FlexLine, container *FlexContainer, justifyInfos []*JustifyInfo) {
-	var crossPos float64
-
-	// Handle reverse directions
-	isMainReverse := container.Direction == FlexDirectionRowReverse ||
-		container.Direction == FlexDirectionColumnReverse
-
-	contentX := box.Dimensions.Content.X
-	contentY := box.Dimensions.Content.Y
-	containerMain := box.Dimensions.Content.Width
-	if !container.IsRowDirection {
-		containerMain = box.Dimensions.Content.Height
-	}
+// positionFlexItems positions all flex items in the container and lays
+// out their content. Positions are found along the main and cross axes
+// from their start edges, then mirrored for reversed axes.
+func positionFlexItems(box *LayoutBox, lines []*FlexLine, container *FlexContainer, justifyInfos []*JustifyInfo, ctx *LayoutContext) {
+	content := box.Dimensions.Content
+	sides := container.sides()
 
 	for lineIdx, line := range lines {
 		justifyInfo := justifyInfos[lineIdx]
+		mainPos := justifyInfo.StartOffset
 
-		// Start position for this line
-		var lineMainPos float64
-		if isMainReverse {
-			lineMainPos = containerMain
-		} else {
-			lineMainPos = justifyInfo.StartOffset
-		}
-
-		for i, item := range line.Items {
+		for _, item := range line.Items {
 			itemBox := item.Box
-
-			// Get margins for this item
-			var marginStart, marginEnd float64
-			if container.IsRowDirection {
-				marginStart = itemBox.Dimensions.Margin.Left
-				marginEnd = itemBox.Dimensions.Margin.Right
-			} else {
-				marginStart = itemBox.Dimensions.Margin.Top
-				marginEnd = itemBox.Dimensions.Margin.Bottom
+			d := &itemBox.Dimensions
+			auto := container.autoMargins(itemBox)
+
+			// Auto margins take their share of the free space
+			margins := [4]*float64{}
+			for i, side := range sides {
+				margins[i] = edge(&d.Margin, side)
+				if auto[i] && i < 2 {
+					*margins[i] = justifyInfo.AutoMargin
+				}
 			}
 
 			// Calculate main axis position
-			var itemMainPos float64
-			if isMainReverse {
-				lineMainPos -= item.MainSize + marginEnd
-				itemMainPos = lineMainPos
-			} else {
-				itemMainPos = lineMainPos + marginStart
-				lineMainPos = itemMainPos + item.MainSize + marginEnd
-				// Add between-space for next item
-				if i < len(line.Items)-1 {
-					lineMainPos += justifyInfo.BetweenSpace
-				}
-			}
+			itemMainPos := mainPos + *margins[0]
+			mainPos = itemMainPos + item.MainSize + *margins[1] + line.Gap + justifyInfo.BetweenSpace
 
 			// Calculate cross axis position based on alignment
-			alignSelf := item.AlignSelf
-			if alignSelf == AlignSelfAuto {
-				switch container.AlignItems {
-				case AlignItemsFlexStart:
-					alignSelf = AlignSelfFlexStart
-				case AlignItemsFlexEnd:
-					alignSelf = AlignSelfFlexEnd
-				case AlignItemsCenter:
-					alignSelf = AlignSelfCenter
-				default:
-					alignSelf = AlignSelfStretch
+			outer := item.CrossSize + *margins[2] + *margins[3]
+			free := line.CrossSize - outer
+			var itemCrossPos float64
+			switch aligned, last := item.baselineAligned(container); {
+			case auto[2] && auto[3]:
+				*margins[2], *margins[3] = math.Max(free, 0)/2+*margins[2], math.Max(free, 0)/2+*margins[3]
+			case auto[2]:
+				*margins[2] += math.Max(free, 0)
+			case auto[3]:
+				*margins[3] += math.Max(free, 0)
+			case aligned && last:
+				itemCrossPos = line.CrossSize - line.LastDescent - item.Baseline
+			case aligned:
+				itemCrossPos = line.Baseline - item.Baseline
+			default:
+				switch item.alignment(container) {
+				case AlignSelfFlexEnd:
+					itemCrossPos = free
+				case AlignSelfCenter:
+					itemCrossPos = free / 2
 				}
 			}
+			itemCrossPos += line.CrossPos + *margins[2]
 
-			var itemCrossPos float64
-			var crossMarginStart float64
-			if container.IsRowDirection {
-				crossMarginStart = itemBox.Dimensions.Margin.Top
-			} else {
-				crossMarginStart = itemBox.Dimensions.Margin.Left
+			// Mirror reversed axes
+			if container.MainReverse {
+				itemMainPos = container.MainSize - itemMainPos - item.MainSize
 			}
-
-			switch alignSelf {
-			case AlignSelfFlexStart:
-				itemCrossPos = crossPos + crossMarginStart
-			case AlignSelfFlexEnd:
-				var crossMarginEnd float64
-				if container.IsRowDirection {
-					crossMarginEnd = itemBox.Dimensions.Margin.Bottom
-				} else {
-					crossMarginEnd = itemBox.Dimensions.Margin.Right
-				}
-				itemCrossPos = crossPos + line.CrossSize - item.CrossSize - crossMarginEnd
-			case AlignSelfCenter:
-				itemCrossPos = crossPos + (line.CrossSize-item.CrossSize)/2
-			default: // AlignSelfStretch
-				itemCrossPos = crossPos + crossMarginStart
+			if container.CrossReverse {
+				itemCrossPos = container.CrossSize - itemCrossPos - item.CrossSize
 			}
 
 			// Set final content dimensions
-			if container.IsRowDirection {
-				itemBox.Dimensions.Content.Width = item.MainSize -
-					itemBox.Dimensions.Padding.Left - itemBox.Dimensions.Padding.Right -
-					itemBox.Dimensions.Border.Left - itemBox.Dimensions.Border.Right
-				itemBox.Dimensions.Content.Height = item.CrossSize -
-					itemBox.Dimensions.Padding.Top - itemBox.Dimensions.Padding.Bottom -
-					itemBox.Dimensions.Border.Top - itemBox.Dimensions.Border.Bottom
-
-				itemBox.Dimensions.Content.X = contentX + itemMainPos +
-					itemBox.Dimensions.Border.Left + itemBox.Dimensions.Padding.Left
-				itemBox.Dimensions.Content.Y = contentY + itemCrossPos +
-					itemBox.Dimensions.Border.Top + itemBox.Dimensions.Padding.Top
-			} else {
-				itemBox.Dimensions.Content.Height = item.MainSize -
-					itemBox.Dimensions.Padding.Top - itemBox.Dimensions.Padding.Bottom -
-					itemBox.Dimensions.Border.Top - itemBox.Dimensions.Border.Bottom
-				itemBox.Dimensions.Content.Width = item.CrossSize -
-					itemBox.Dimensions.Padding.Left - itemBox.Dimensions.Padding.Right -
-					itemBox.Dimensions.Border.Left - itemBox.Dimensions.Border.Right
-
-				itemBox.Dimensions.Content.Y = contentY + itemMainPos +
-					itemBox.Dimensions.Border.Top + itemBox.Dimensions.Padding.Top
-				itemBox.Dimensions.Content.X = contentX + itemCrossPos +
-					itemBox.Dimensions.Border.Left + itemBox.Dimensions.Padding.Left
+			x, y := itemMainPos, itemCrossPos
+			width, height := item.MainSize, item.CrossSize
+			if !container.IsRowDirection {
+				x, y, width, height = y, x, height, width
 			}
-
-			// Ensure dimensions are non-negative
-			if itemBox.Dimensions.Content.Width < 0 {
-				itemBox.Dimensions.Content.Width = 0
-			}
-			if itemBox.Dimensions.Content.Height < 0 {
-				itemBox.Dimensions.Content.Height = 0
+			d.Content = Rect{
+				X:      content.X + x + d.Border.Left + d.Padding.Left,
+				Y:      content.Y + y + d.Border.Top + d.Padding.Top,
+				Width:  math.Max(width-d.Border.Left-d.Border.Right-d.Padding.Left-d.Padding.Right, 0),
+				Height: math.Max(height-d.Border.Top-d.Border.Bottom-d.Padding.Top-d.Padding.Bottom, 0),
 			}
 
 			// Layout children of flex item
-			layoutFlexItemChildren(itemBox)
+			itemBox.layoutFlexItemContent(ctx, true)
+			if itemBox.Position == PositionRelative {
+				x, y := d.Content.X, d.Content.Y
+				itemBox.applyRelativePosition()
+				dx, dy := d.Content.X-x, d.Content.Y-y
+				d.Content.X, d.Content.Y = x, y
+				translateBox(itemBox, dx, dy)
+			}
 		}
-
-		crossPos += line.CrossSize
-	}
-}
-
-// layoutFlexItemChildren lays out the children of a flex item.
-func layoutFlexItemChildren(box *LayoutBox) {
-	ctx := &LayoutContext{
-		ViewportWidth:    box.Dimensions.Content.Width,
-		ViewportHeight:   box.Dimensions.Content.Height,
-		ContainingBlocks: []*Dimensions{&box.Dimensions},
-	}
-
-	currentY := box.Dimensions.Content.Y
-	for _, child := range box.Children {
-		child.Layout(ctx)
-		childHeight := child.Dimensions.MarginBox().Height
-		child.Dimensions.Content.Y = currentY + child.Dimensions.Margin.Top +
-			child.Dimensions.Border.Top + child.Dimensions.Padding.Top
-		currentY += childHeight
 	}
 }
 
-// calculateColumnFlexHeight calculates total height for column flex containers.
-func calculateColumnFlexHeight(lines []*FlexLine) float64 {
-	maxHeight := 0.0
-	for _, line := range lines {
-		lineHeight := 0.0
-		for _, item := range line.Items {
-			itemHeight := item.MainSize
-			if container := item.Box; container != nil {
-				itemHeight += item.Box.Dimensions.Margin.Top + item.Box.Dimensions.Margin.Bottom
-			}
-			lineHeight += itemHeight
-		}
-		if lineHeight > maxHeight {
-			maxHeight = lineHeight
+// layoutFlexItemContent lays out the content of a flex item whose
+// dimensions flex layout has set, from the top of its content box, and
+// returns the height the content takes. The item keeps its height.
+func (box *LayoutBox) layoutFlexItemContent(ctx *LayoutContext, definiteHeight bool) float64 {
+	d := &box.Dimensions
+	height := d.Content.Height
+	d.Content.Height = 0
+	switch {
+	case box.Replaced != nil:
+		saved := box.Dimensions
+		_, d.Content.Height = box.replacedContentSize(&Dimensions{Content: Rect{Width: d.Content.Width}})
+		used := d.Content.Height
+		box.Dimensions = saved
+		return used
+	case box.TextContent != "":
+		used := box.contentHeightAt(ctx, d.Content.Width)
+		d.Content.Height = height
+		return used
+	case box.BoxType == FlexBox || box.BoxType == InlineFlexBox:
+		if definiteHeight {
+			d.Content.Height = height
 		}
+		box.layoutFlexContent(ctx, definiteHeight)
+	default:
+		box.layoutBlockChildren(ctx)
 	}
-	return maxHeight
-}
-
-// Helper to get max of two floats
-func maxFloat(a, b float64) float64 {
-	return math.Max(a, b)
-}
-
-// Helper to get min of two floats
-func minFloat(a, b float64) float64 {
-	return math.Min(a, b)
+	used := d.Content.Height
+	d.Content.Height = height
+	return used
 }
@@ -285,8 +285,8 @@ func TestCollectFlexLinesWrap(t *testing.T) {
 
 func TestResolveFlexibleLengthsGrow(t *testing.T) {
 	items := []*FlexItem{
-		{HypotheticalMainSize: 100, FlexGrow: 1, FlexShrink: 0, Box: &LayoutBox{ComputedStyle: css.NewComputedStyle(nil, nil)}},
-		{HypotheticalMainSize: 100, FlexGrow: 2, FlexShrink: 0, Box: &LayoutBox{ComputedStyle: css.NewComputedStyle(nil, nil)}},
+		{HypotheticalMainSize: 100, BaseSize: 100, FlexGrow: 1, FlexShrink: 0, Box: &LayoutBox{ComputedStyle: css.NewComputedStyle(nil, nil)}},
+		{HypotheticalMainSize: 100, BaseSize: 100, FlexGrow: 2, FlexShrink: 0, Box: &LayoutBox{ComputedStyle: css.NewComputedStyle(nil, nil)}},
 	}
 
 	line := &FlexLine{Items: items}
@@ -648,3 +648,108 @@ func TestFlexNormalizeBoxTreeNotApplied(t *testing.T) {
 			originalChildCount, len(parent.Children))
 	}
 }
+
+// flexItemRects lays out a flex container holding the given items and
+// returns the content boxes of its children relative to its own.
+func flexItemRects(t *testing.T, stylesheet, items string) []Rect {
+	t.Helper()
+	base := "body { margin-top: 0; margin-left: 0; font-size: 10px } div { margin-top: 0; margin-bottom: 0 } "
+	section := layoutHTML(t, "<body><section>"+items+"</section></body>", base+stylesheet, "section", nil)
+	origin := section.Dimensions.Content
+	rects := []Rect{{Width: origin.Width, Height: origin.Height}}
+	for _, child := range section.Children {
+		r := child.Dimensions.Content
+		rects = append(rects, Rect{X: r.X - origin.X, Y: r.Y - origin.Y, Width: r.Width, Height: r.Height})
+	}
+	return rects
+}
+
+func TestFlexLayoutFromHTML(t *testing.T) {
+	// Text is 6px a character with 12px lines, and the baseline 9px down
+	tests := []struct {
+		name       string
+		stylesheet string
+		items      string
+		want       []Rect // the container, then its items
+	}{
+		{"column-gap", "section { display: flex; width: 200px; column-gap: 10px } div { width: 50px; height: 20px }",
+			"<div></div><div></div><div></div>",
+			[]Rect{{0, 0, 200, 20}, {0, 0, 50, 20}, {60, 0, 50, 20}, {120, 0, 50, 20}}},
+		{"gap shorthand", "section { display: flex; flex-wrap: wrap; width: 120px; gap: 5px 10px } div { width: 50px; height: 20px }",
+			"<div></div><div></div><div></div>",
+			[]Rect{{0, 0, 120, 45}, {0, 0, 50, 20}, {60, 0, 50, 20}, {0, 25, 50, 20}}},
+		{"wrap-reverse", "section { display: flex; flex-wrap: wrap-reverse; width: 100px } div { width: 60px } #a { height: 10px } #b { height: 20px }",
+			"<div id=a></div><div id=b></div>",
+			[]Rect{{0, 0, 100, 30}, {0, 20, 60, 10}, {0, 0, 60, 20}}},
+		{"auto margins", "section { display: flex; width: 200px; height: 100px } div { width: 50px; height: 20px; margin-left: auto; margin-top: auto; margin-bottom: auto }",
+			"<div></div>",
+			[]Rect{{0, 0, 200, 100}, {150, 40, 50, 20}}},
+		{"baseline", "section { display: flex; align-items: baseline; width: 200px } #b { font-size: 20px; padding-top: 4px }",
+			"<div id=a>a</div><div id=b>b</div>",
+			[]Rect{{0, 0, 200, 28}, {0, 13, 6, 12}, {6, 4, 12, 24}}},
+		{"last baseline", "section { display: flex; align-items: last baseline; width: 200px } #a { width: 6px }",
+			"<div id=a>a a</div><div id=b>b</div>",
+			[]Rect{{0, 0, 200, 24}, {0, 0, 6, 24}, {6, 12, 6, 12}}},
+		{"min-width auto", "section { display: flex; width: 50px }",
+			"<div>aaaaaaaaaa</div><div style='min-width: 0'>bbbbbbbbbb</div>",
+			[]Rect{{0, 0, 50, 12}, {0, 0, 60, 12}, {60, 0, 0, 12}}},
+		{"flex shorthand", "section { display: flex; width: 300px } div { flex: 1 }",
+			"<div>a</div><div>aaaaa</div><div>aaaaaaaaaa</div>",
+			[]Rect{{0, 0, 300, 12}, {0, 0, 100, 12}, {100, 0, 100, 12}, {200, 0, 100, 12}}},
+		{"flex shorthand percentage", "section { display: flex; width: 200px } div { flex: 0 0 50%; height: 10px }",
+			"<div></div><div></div>",
+			[]Rect{{0, 0, 200, 10}, {0, 0, 100, 10}, {100, 0, 100, 10}}},
+		{"flex shorthand rem", "html { font-size: 20px } section { display: flex; width: 200px } div { flex: 0 0 2rem; height: 10px }",
+			"<div></div><div></div>",
+			[]Rect{{0, 0, 200, 10}, {0, 0, 40, 10}, {40, 0, 40, 10}}},
+		{"gap shorthand rem", "html { font-size: 20px } section { display: flex; width: 200px; gap: 1rem } div { width: 50px; height: 20px }",
+			"<div></div><div></div>",
+			[]Rect{{0, 0, 200, 20}, {0, 0, 50, 20}, {70, 0, 50, 20}}},
+		{"gap shorthand percentage", "section { display: flex; width: 200px; gap: 10% } div { width: 50px; height: 20px }",
+			"<div></div><div></div>",
+			[]Rect{{0, 0, 200, 20}, {0, 0, 50, 20}, {70, 0, 50, 20}}},
+		{"content height", "section { display: flex; align-items: flex-start } div { width: 30px }",
+			"<div>aa aa aa</div><div>b</div>",
+			[]Rect{{0, 0, 800, 24}, {0, 0, 30, 24}, {30, 0, 30, 12}}},
+		{"column", "section { display: flex; flex-direction: column; height: 100px; width: 100px } #a { flex-grow: 1 } #b { align-self: center }",
+			"<div id=a>a</div><div id=b>bb</div>",
+			[]Rect{{0, 0, 100, 100}, {0, 0, 100, 88}, {44, 88, 12, 12}}},
+		{"row-reverse", "section { display: flex; flex-direction: row-reverse; justify-content: center; width: 100px } div { width: 20px }",
+			"<div>a</div><div>b</div>",
+			[]Rect{{0, 0, 100, 12}, {50, 0, 20, 12}, {30, 0, 20, 12}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := flexItemRects(t, tt.stylesheet, tt.items)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d boxes, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("box %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestInlineFlexShrinksToFit(t *testing.T) {
+	span := layoutHTML(t, "<body><p>x <span><b>aa</b><b>bb</b></span> y</p></body>",
+		"p { font-size: 10px } span { display: inline-flex; column-gap: 4px }", "span", nil)
+	if got := span.Dimensions.Content.Width; got != 28 {
+		t.Errorf("inline-flex width = %v, want 28", got)
+	}
+}
+
+func TestResolveFlexibleLengthsFreezesClampedItems(t *testing.T) {
+	// The first item stops at its max size and the rest of the free space
+	// goes to the second
+	items := []*FlexItem{
+		{BaseSize: 0, HypotheticalMainSize: 0, FlexGrow: 1, MaxMainSize: 50},
+		{BaseSize: 0, HypotheticalMainSize: 0, FlexGrow: 1},
+	}
+	resolveFlexibleLengths(&FlexLine{Items: items, Gap: 10}, 210)
+	if items[0].MainSize != 50 || items[1].MainSize != 150 {
+		t.Errorf("main sizes = %v, %v, want 50, 150", items[0].MainSize, items[1].MainSize)
+	}
+}
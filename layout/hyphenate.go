@@ -0,0 +1,132 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements automatic hyphenation with Liang's algorithm.
+// Reference: https://www.w3.org/TR/css-text-3/#hyphenation
+package layout
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// The American English patterns and exception list of the hyph-utf8
+// project. See hyphenation/README for their origin and hyphenation/LICENSE
+// for their copyright and license notices.
+var (
+	//go:embed hyphenation/hyph-en-us.pat.txt
+	enUSPatterns string
+	//go:embed hyphenation/hyph-en-us.hyp.txt
+	enUSExceptions string
+)
+
+// hyphenator finds hyphenation points in words using TeX hyphenation
+// patterns.
+type hyphenator struct {
+	// patterns maps the letters of a pattern, with '.' marking a word
+	// boundary, to the values between and around them
+	patterns map[string][]byte
+	// exceptions maps whole words to their hyphenation points
+	exceptions map[string][]int
+	maxLength  int
+	// leftMin and rightMin are the fewest letters kept before and after a
+	// hyphen
+	leftMin, rightMin int
+}
+
+// newHyphenator parses whitespace separated patterns such as "hy3ph" and
+// exceptions such as "ta-ble".
+func newHyphenator(patterns, exceptions string, leftMin, rightMin int) *hyphenator {
+	h := &hyphenator{
+		patterns:   map[string][]byte{},
+		exceptions: map[string][]int{},
+		leftMin:    leftMin,
+		rightMin:   rightMin,
+	}
+	for _, pattern := range strings.Fields(patterns) {
+		var letters []rune
+		values := []byte{0}
+		for _, r := range pattern {
+			if r >= '0' && r <= '9' {
+				values[len(values)-1] = byte(r - '0')
+				continue
+			}
+			letters = append(letters, r)
+			values = append(values, 0)
+		}
+		h.patterns[string(letters)] = values
+		h.maxLength = max(h.maxLength, len(letters))
+	}
+	for _, word := range strings.Fields(exceptions) {
+		var points []int
+		n := 0
+		for _, r := range word {
+			if r == '-' {
+				points = append(points, n)
+				continue
+			}
+			n++
+		}
+		h.exceptions[strings.ReplaceAll(word, "-", "")] = points
+	}
+	return h
+}
+
+// englishHyphenator returns the hyphenator for English, parsing the
+// bundled dictionary on first use.
+var englishHyphenator = sync.OnceValue(func() *hyphenator {
+	return newHyphenator(enUSPatterns, enUSExceptions, 2, 3)
+})
+
+// hyphenate returns the positions, in runes, at which word may be
+// hyphenated. Position i falls between the runes i-1 and i.
+func (h *hyphenator) hyphenate(word string) []int {
+	runes := []rune(strings.ToLower(word))
+	if len(runes) < h.leftMin+h.rightMin {
+		return nil
+	}
+	if points, ok := h.exceptions[string(runes)]; ok {
+		return points
+	}
+
+	// Apply every pattern that matches a substring of ".word.", keeping the
+	// highest value at each position
+	padded := append(append([]rune{'.'}, runes...), '.')
+	values := make([]byte, len(padded)+1)
+	for i := range padded {
+		for j := i + 1; j <= len(padded) && j-i <= h.maxLength; j++ {
+			pattern, ok := h.patterns[string(padded[i:j])]
+			if !ok {
+				continue
+			}
+			for k, v := range pattern {
+				values[i+k] = max(values[i+k], v)
+			}
+		}
+	}
+
+	// Odd values mark hyphenation points. values[i+1] lies before runes[i]
+	var points []int
+	for i := h.leftMin; i <= len(runes)-h.rightMin; i++ {
+		if values[i+1]%2 == 1 {
+			points = append(points, i)
+		}
+	}
+	return points
+}
+
+// hyphenatorFor returns the hyphenator for a language tag, or nil when no
+// dictionary is available for it.
+func hyphenatorFor(lang string) *hyphenator {
+	lang = strings.ToLower(lang)
+	if lang == "en" || strings.HasPrefix(lang, "en-") {
+		return englishHyphenator()
+	}
+	return nil
+}
+
+// isHyphenatable reports whether r can be part of a word hyphenated by
+// hyphens: auto.
+func isHyphenatable(r rune) bool {
+	return unicode.IsLetter(r) && !isEastAsianWide(r)
+}
@@ -0,0 +1,48 @@
+package layout
+
+import "testing"
+
+func TestHyphenate(t *testing.T) {
+	tests := []struct {
+		word string
+		want []int
+	}{
+		{"hyphenation", []int{2, 6, 7}},
+		{"typesetting", []int{4, 7}},
+		{"Academies", []int{4, 5}}, // from the exception list
+		{"table", []int{2}},
+		{"cat", nil}, // too short to keep two letters before and three after
+	}
+	h := hyphenatorFor("en-US")
+	for _, tt := range tests {
+		got := h.hyphenate(tt.word)
+		if len(got) != len(tt.want) {
+			t.Errorf("hyphenate(%q) = %v, want %v", tt.word, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("hyphenate(%q) = %v, want %v", tt.word, got, tt.want)
+				break
+			}
+		}
+	}
+	if hyphenatorFor("fr") != nil {
+		t.Error("hyphenatorFor(\"fr\") returned a dictionary")
+	}
+}
+
+func TestNewHyphenator(t *testing.T) {
+	h := newHyphenator("a1b c1a", "ab-cd", 1, 1)
+	if got := h.hyphenate("aabca"); len(got) != 2 || got[0] != 2 || got[1] != 4 {
+		t.Errorf("hyphenate(aabca) = %v, want [2 4]", got)
+	}
+	// An even value inhibits the break an odd one allows
+	h = newHyphenator("a1b c1a 2b", "", 1, 1)
+	if got := h.hyphenate("aabca"); len(got) != 1 || got[0] != 4 {
+		t.Errorf("hyphenate(aabca) with 2b = %v, want [4]", got)
+	}
+	if got := newHyphenator("", "ab-cd", 1, 1).hyphenate("abcd"); len(got) != 1 || got[0] != 2 {
+		t.Errorf("exception = %v, want [2]", got)
+	}
+}
@@ -0,0 +1,861 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements inline formatting contexts: line boxes, text
+// alignment and inline-level content.
+// Reference: https://www.w3.org/TR/CSS2/visuren.html#inline-formatting
+package layout
+
+import (
+	"math"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/font"
+)
+
+// segmentKind identifies the pieces inline content is broken into.
+type segmentKind int
+
+const (
+	segmentText   segmentKind = iota // a run of text without spaces
+	segmentSpace                     // a run of spaces
+	segmentTab                       // a preserved tab
+	segmentBreak                     // a forced line break
+	segmentOpen                      // the start of an inline box
+	segmentClose                     // the end of an inline box
+	segmentAtomic                    // an atomic inline such as an image
+)
+
+// inlineSegment is one piece of inline content. Lines only break after
+// segments that allow it.
+type inlineSegment struct {
+	Kind    segmentKind
+	Box     *LayoutBox
+	Text    string
+	Width   float64
+	Metrics textMetrics
+
+	// Glyphs are the shaped glyphs of the text. Offsets holds the DOM
+	// offset of each character of the text followed by the offset after
+	// the last.
+	Glyphs  []font.Glyph
+	Offsets []int
+
+	// Collapsible spaces are removed at the start and end of a line;
+	// preserved spaces that hang do not count towards alignment there.
+	Collapsible bool
+	Hangs       bool
+	Removed     bool
+	Hanging     bool // a hanging space at the end of its line
+
+	// BreakAfter marks a soft wrap opportunity after the segment. Hyphen
+	// is set when a hyphen is shown if the line breaks there, and
+	// OverflowWrap when text may be broken anywhere to avoid overflow,
+	// and Anywhere when those breaks also count for min-content sizes.
+	BreakAfter   bool
+	Hyphen       bool
+	OverflowWrap bool
+	Anywhere     bool
+
+	// Level is the bidi embedding level. LeftEdge is set on the open or
+	// close segment that holds the left margin, border and padding of its
+	// box, which for right-to-left boxes is the close segment.
+	Level    int
+	LeftEdge bool
+
+	// Set when the segment is placed on a line
+	X     float64
+	Extra float64 // justification space added to a space segment
+}
+
+// inlineFormatter lays out the inline-level children of a block container.
+type inlineFormatter struct {
+	container *LayoutBox
+	style     *css.ComputedStyle
+	segments  []*inlineSegment
+	state     collapseState
+	level     int // the bidi paragraph embedding level
+	fonts     *font.Collection
+	// placed records the boxes whose geometry has been started, so that
+	// later fragments extend it
+	placed map[*LayoutBox]bool
+	// baselines holds the baseline of each box on the line being placed
+	baselines map[*LayoutBox]float64
+	// sizing is set when the content is measured for its intrinsic sizes
+	// rather than laid out
+	sizing intrinsicMode
+	// width is the width lines are aligned in
+	width float64
+}
+
+// establishesInlineContext reports whether a block container holds only
+// inline-level content and so lays it out in line boxes.
+func (box *LayoutBox) establishesInlineContext() bool {
+	if len(box.Children) == 0 {
+		return false
+	}
+	for _, child := range box.Children {
+		if isBlockLevel(child) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBlockLevel reports whether a box takes part in a block formatting
+// context rather than in lines.
+func isBlockLevel(box *LayoutBox) bool {
+	switch box.BoxType {
+	case BlockBox, AnonymousBlockBox, FlexBox:
+		return true
+	}
+	return false
+}
+
+// inheritedStyle returns the style of a box, or that of its nearest styled
+// ancestor for anonymous boxes.
+func (box *LayoutBox) inheritedStyle() *css.ComputedStyle {
+	for b := box; b != nil; b = b.Parent {
+		if b.ComputedStyle != nil {
+			return b.ComputedStyle
+		}
+	}
+	return css.NewComputedStyle(nil, nil)
+}
+
+// layoutInlineContent lays out the inline-level children of the box in line
+// boxes, breaking lines at soft wrap opportunities and aligning them with
+// text-align. The box's content height grows by the height of its lines.
+func (box *LayoutBox) layoutInlineContent(ctx *LayoutContext) {
+	f := newInlineFormatter(box, ctx, layoutSize)
+	top := box.Dimensions.Content.Y + box.Dimensions.Content.Height
+	box.LineBoxes = f.layoutLines(box.Dimensions.Content.Width, top)
+	for _, line := range box.LineBoxes {
+		box.Dimensions.Content.Height += line.Rect.Height
+	}
+}
+
+// newInlineFormatter collects the inline content of a box, or the text of
+// a text box, into segments ready to be broken into lines.
+func newInlineFormatter(box *LayoutBox, ctx *LayoutContext, sizing intrinsicMode) *inlineFormatter {
+	f := &inlineFormatter{container: box, style: box.inheritedStyle(), fonts: ctx.Fonts, placed: map[*LayoutBox]bool{}, sizing: sizing}
+	f.state.spaceBefore = true
+	if box.TextContent != "" {
+		f.addText(box)
+	} else {
+		f.collect(box, ctx)
+	}
+	f.findBreaks()
+	f.resolveBidi()
+	return f
+}
+
+// layoutLines breaks the content into lines of the given width, the first
+// starting at y.
+func (f *inlineFormatter) layoutLines(width, y float64) []*LineBox {
+	// Percentages of an unknown width resolve to zero when measuring
+	base := width
+	if f.sizing != layoutSize {
+		base = 0
+	}
+	indent, eachLine, hanging := f.textIndent(base)
+	f.width = base
+
+	var lines []*LineBox
+	first := true
+	afterForced := false
+	for start := 0; start < len(f.segments); {
+		lineIndent := 0.0
+		if (first || (eachLine && afterForced)) != hanging {
+			lineIndent = indent
+		}
+		end, forced := f.breakLine(start, width-lineIndent)
+		last := end >= len(f.segments)
+		if line := f.placeLine(f.segments[start:end], y, lineIndent, last || forced); line != nil {
+			lines = append(lines, line)
+			y += line.Rect.Height
+		}
+		first = false
+		afterForced = forced
+		start = end
+	}
+	return lines
+}
+
+// collect flattens the inline content of a box into segments, processing
+// white space along the way.
+func (f *inlineFormatter) collect(box *LayoutBox, ctx *LayoutContext) {
+	for _, child := range box.Children {
+		switch {
+		case child.TextContent != "":
+			f.addText(child)
+		case child.Element != nil && child.Element.LocalName() == "br" && child.Replaced == nil:
+			f.segments = append(f.segments, &inlineSegment{Kind: segmentBreak, Box: child, Metrics: resolveTextMetrics(child.ComputedStyle, f.fonts)})
+			f.state.spaceBefore = true
+		case child.Replaced != nil || child.BoxType != InlineBox:
+			f.addAtomic(child, ctx)
+		default:
+			setInlineEdges(child)
+			if f.sizing == layoutSize {
+				child.Fragments = nil
+			}
+			d := &child.Dimensions
+			left := d.Margin.Left + d.Border.Left + d.Padding.Left
+			right := d.Margin.Right + d.Border.Right + d.Padding.Right
+			// The inline-start edge is on the right in right-to-left boxes
+			rtl := getKeyword(child.ComputedStyle, "direction") == "rtl"
+			open := &inlineSegment{Kind: segmentOpen, Box: child, Width: left, LeftEdge: !rtl, Metrics: resolveTextMetrics(child.ComputedStyle, f.fonts)}
+			close := &inlineSegment{Kind: segmentClose, Box: child, Width: right, LeftEdge: rtl, Metrics: resolveTextMetrics(child.ComputedStyle, f.fonts)}
+			if rtl {
+				open.Width, close.Width = right, left
+			}
+			f.segments = append(f.segments, open)
+			f.collect(child, ctx)
+			f.segments = append(f.segments, close)
+		}
+	}
+}
+
+// addText splits the text of a text box into words, spaces, tabs and forced
+// breaks after white space processing and text-transform.
+func (f *inlineFormatter) addText(box *LayoutBox) {
+	style := box.inheritedStyle()
+	ws := ResolveWhiteSpace(style)
+	metrics := resolveTextMetrics(style, f.fonts)
+	prev := f.state.last
+	text, offsets := processWhiteSpaceOffsets(box.TextContent, ws, &f.state)
+	transformed := applyTextTransform(text, getText(style, "text-transform"), prev)
+	if f.sizing == layoutSize {
+		box.Fragments = nil
+	}
+
+	runes := []rune(transformed)
+	if len(runes) != len(offsets) {
+		// Case mappings that change the length map each character to the
+		// nearest source character
+		offsets = remapOffsets(offsets, len(runes))
+	}
+	offsets = append(offsets, dom.UTF16Length(box.TextContent))
+	for i := 0; i < len(runes); {
+		seg := &inlineSegment{Box: box, Metrics: metrics}
+		start := i
+		switch r := runes[i]; r {
+		case '\n':
+			seg.Kind = segmentBreak
+			i++
+		case '\t':
+			seg.Kind = segmentTab
+			seg.Width = metrics.TabSize
+			seg.BreakAfter = ws.Wrap
+			i++
+		case ' ':
+			seg.Kind = segmentSpace
+			seg.Collapsible = ws.collapsesSpaces()
+			seg.Hangs = ws.Collapse != "break-spaces"
+			j := i + 1
+			// break-spaces allows a break after every space
+			for j < len(runes) && runes[j] == ' ' && ws.Collapse != "break-spaces" {
+				j++
+			}
+			seg.Text = string(runes[i:j])
+			i = j
+		default:
+			seg.Kind = segmentText
+			j := i
+			for j < len(runes) && runes[j] != ' ' && runes[j] != '\t' && runes[j] != '\n' {
+				j++
+			}
+			seg.Text = string(runes[i:j])
+			i = j
+		}
+		seg.Offsets = offsets[start : i+1]
+		if seg.Text != "" {
+			seg.shape()
+		}
+		f.segments = append(f.segments, seg)
+	}
+}
+
+// remapOffsets stretches the offsets of n source characters over n result
+// characters.
+func remapOffsets(offsets []int, n int) []int {
+	mapped := make([]int, n)
+	for i := range mapped {
+		if len(offsets) > 0 {
+			mapped[i] = offsets[i*len(offsets)/n]
+		}
+	}
+	return mapped
+}
+
+// shape sets the glyphs and width of a text or space segment from its
+// text, shaped in the direction of its bidi level.
+func (seg *inlineSegment) shape() {
+	seg.Glyphs = seg.Metrics.shape(seg.Text, seg.Level%2 == 1)
+	if seg.Metrics.Face != nil {
+		seg.Width = font.Advance(seg.Glyphs)
+	} else {
+		seg.Width = seg.Metrics.measure(seg.Text)
+	}
+}
+
+// addAtomic lays out an atomic inline, such as a replaced element or an
+// inline-block, so its size is known when breaking lines. It is moved into
+// place when its line is positioned.
+func (f *inlineFormatter) addAtomic(box *LayoutBox, ctx *LayoutContext) {
+	// When measuring, atomic inlines take their intrinsic contributions
+	var width float64
+	if f.sizing == layoutSize {
+		ctx.PushContainingBlock(&Dimensions{Content: Rect{Width: f.container.Dimensions.Content.Width}})
+		if box.BoxType == InlineBlockBox && box.Replaced == nil && !box.isFlowRoot() {
+			box.layoutInlineBlock(ctx, ctx.CurrentContainingBlock())
+		} else {
+			box.Layout(ctx)
+		}
+		ctx.PopContainingBlock()
+		width = box.Dimensions.MarginBox().Width
+	} else {
+		width = box.intrinsicContribution(ctx, f.sizing)
+	}
+
+	// Atomic inlines can be wrapped before and after
+	f.segments = append(f.segments, &inlineSegment{
+		Kind:       segmentAtomic,
+		Box:        box,
+		Width:      width,
+		BreakAfter: ResolveWhiteSpace(f.style).Wrap,
+	})
+	f.state.spaceBefore = false
+	f.state.last = 0xFFFC // object replacement character
+}
+
+// textIndent resolves text-indent against the line width.
+func (f *inlineFormatter) textIndent(width float64) (indent float64, eachLine, hanging bool) {
+	val := f.style.GetPropertyValue("text-indent")
+	if val == nil {
+		return 0, false, false
+	}
+	switch val.Value.Type {
+	case css.LengthValue, css.NumberValue:
+		return val.Length, false, false
+	case css.PercentageValue:
+		return val.Value.Length / 100 * width, false, false
+	}
+	for _, part := range strings.Fields(getText(f.style, "text-indent")) {
+		switch part {
+		case "each-line":
+			eachLine = true
+		case "hanging":
+			hanging = true
+		default:
+			if n, ok := f.style.LengthPercentage(part, width); ok {
+				indent = n
+			}
+		}
+	}
+	return indent, eachLine, hanging
+}
+
+// breakLine finds the end of the line starting at segment start, breaking at
+// the last soft wrap opportunity that fits in width. A chunk that overflows
+// an otherwise empty line is split when overflow-wrap allows it. It reports
+// whether the line ends with a forced break.
+func (f *inlineFormatter) breakLine(start int, width float64) (end int, forced bool) {
+	lineWidth := 0.0
+	hasContent := false
+	i := start
+	for i < len(f.segments) {
+		// The next unbreakable chunk runs to the next wrap opportunity
+		j := i
+		for j < len(f.segments) && f.segments[j].Kind != segmentBreak {
+			j++
+			if f.segments[j-1].BreakAfter {
+				break
+			}
+		}
+		chunk, trailing := chunkWidth(f.segments[i:j], !hasContent)
+		// A line that ends after a hyphenation opportunity shows a hyphen
+		hyphen := hyphenWidth(f.segments[j-1])
+		if hasContent && chunk > 0 && lineWidth+chunk+hyphen > width {
+			return i, false
+		}
+		if !hasContent && chunk > width && f.splitOverflow(i, j, width) {
+			continue
+		}
+		lineWidth += chunk + trailing
+		if chunk > 0 {
+			hasContent = true
+		}
+		i = j
+		if i < len(f.segments) && f.segments[i].Kind == segmentBreak {
+			return i + 1, true
+		}
+	}
+	return i, false
+}
+
+// chunkWidth returns the width of an unbreakable chunk without its trailing
+// spaces, and the width of those spaces. At the start of a line collapsible
+// spaces take no room.
+func chunkWidth(chunk []*inlineSegment, lineStart bool) (width, trailing float64) {
+	for _, seg := range chunk {
+		if seg.Kind == segmentSpace && (seg.Collapsible || seg.Hangs) {
+			if !(lineStart && seg.Collapsible) {
+				trailing += seg.Width
+			}
+			continue
+		}
+		width += trailing + seg.Width
+		trailing = 0
+		if seg.Kind != segmentOpen && seg.Kind != segmentClose {
+			lineStart = false
+		}
+	}
+	return width, trailing
+}
+
+// placeLine positions the segments of one line starting at top and returns
+// its line box, or nil when the line holds nothing and takes no space.
+func (f *inlineFormatter) placeLine(segments []*inlineSegment, top, indent float64, last bool) *LineBox {
+	// Collapsible spaces at the start and end of the line are removed
+	for _, seg := range segments {
+		if seg.Kind == segmentSpace && seg.Collapsible {
+			seg.Removed = true
+			continue
+		}
+		if seg.Kind != segmentOpen && seg.Kind != segmentClose {
+			break
+		}
+	}
+	hanging := 0.0
+	for i := len(segments) - 1; i >= 0; i-- {
+		seg := segments[i]
+		if seg.Kind == segmentBreak || seg.Kind == segmentOpen || seg.Kind == segmentClose || seg.Removed {
+			continue
+		}
+		if seg.Kind != segmentSpace {
+			break
+		}
+		if seg.Collapsible {
+			seg.Removed = true
+		} else if seg.Hangs {
+			seg.Hanging = true
+			hanging += seg.Width
+		}
+	}
+
+	content := Rect{X: f.container.Dimensions.Content.X, Y: top, Width: f.width}
+	if !lineHasContent(segments) {
+		return nil
+	}
+	// A line that breaks at a hyphenation opportunity ends with a hyphen
+	for i := len(segments) - 1; i >= 0; i-- {
+		seg := segments[i]
+		if seg.Removed || seg.Hanging || seg.Kind == segmentOpen || seg.Kind == segmentClose || seg.Kind == segmentBreak {
+			continue
+		}
+		if hyphenWidth(seg) > 0 && !last {
+			seg.Text += "-"
+			seg.Offsets = append(seg.Offsets[:len(seg.Offsets):len(seg.Offsets)], seg.Offsets[len(seg.Offsets)-1])
+			seg.shape()
+		}
+		break
+	}
+
+	// Measure the line in visual order, laying out tabs against the tab
+	// stops. In right-to-left paragraphs the indent is on the right.
+	segments = f.reorderLine(segments)
+	rtl := f.level%2 == 1
+	x := indent
+	if rtl {
+		x = 0
+	}
+	var spaces []*inlineSegment
+	for _, seg := range segments {
+		seg.X = x
+		seg.Extra = 0
+		switch {
+		case seg.Removed:
+			continue
+		case seg.Kind == segmentTab:
+			seg.Width = nextTabStop(x, seg.Metrics) - x
+		case seg.Kind == segmentSpace && !seg.Hanging:
+			spaces = append(spaces, seg)
+		}
+		x += seg.Width
+	}
+	used := x - hanging
+	if rtl {
+		used += indent
+	}
+	free := math.Max(content.Width-used, 0)
+
+	// Horizontal alignment
+	offset := 0.0
+	align := f.textAlign(last)
+	switch align {
+	case "right":
+		offset = free
+	case "center":
+		offset = free / 2
+	case "justify":
+		if n := countSpaces(spaces); n > 0 {
+			perSpace := free / float64(n)
+			for _, seg := range spaces {
+				seg.Extra = perSpace * float64(len([]rune(seg.Text)))
+			}
+		}
+	}
+	x = content.X + offset
+	if rtl {
+		// Trailing spaces hang off the left end of the line
+		x -= hanging
+	} else {
+		x += indent
+	}
+	for _, seg := range segments {
+		seg.X = x
+		if !seg.Removed {
+			x += seg.Width + seg.Extra
+		}
+	}
+
+	// Vertical metrics: each text run and inline box contributes its own
+	// line-height, and atomic inlines their margin box, around the baseline
+	// vertical-align puts them on
+	line := &LineBox{Rect: content, used: used}
+	f.alignLine(line, segments)
+	if f.sizing == layoutSize {
+		f.positionItems(line, segments)
+	}
+	return line
+}
+
+// textAlign returns the alignment of a line, resolving start and end and
+// applying text-align-last to the last line.
+func (f *inlineFormatter) textAlign(last bool) string {
+	align := getText(f.style, "text-align")
+	if last {
+		if alignLast := getText(f.style, "text-align-last"); alignLast != "" && alignLast != "auto" {
+			align = alignLast
+		} else if align == "justify" {
+			align = "start"
+		}
+	}
+	rtl := f.level%2 == 1
+	switch align {
+	case "left", "-webkit-left":
+		return "left"
+	case "right", "-webkit-right":
+		return "right"
+	case "center", "-webkit-center":
+		return "center"
+	case "justify":
+		return "justify"
+	case "end":
+		if rtl {
+			return "left"
+		}
+		return "right"
+	}
+	if rtl {
+		return "right"
+	}
+	return "left"
+}
+
+// countSpaces counts the justification opportunities in space segments.
+func countSpaces(spaces []*inlineSegment) int {
+	n := 0
+	for _, seg := range spaces {
+		n += len([]rune(seg.Text))
+	}
+	return n
+}
+
+// nextTabStop returns the position of the tab stop after x. A tab that
+// would advance less than half a space moves to the following stop.
+func nextTabStop(x float64, m textMetrics) float64 {
+	if m.TabSize <= 0 {
+		return x
+	}
+	stop := math.Ceil(x/m.TabSize) * m.TabSize
+	if stop-x < m.advance(' ')/2 {
+		stop += m.TabSize
+	}
+	return stop
+}
+
+// strutMetrics returns the ascent and descent, including half-leading, of
+// text with the given metrics.
+func strutMetrics(m textMetrics) (ascent, descent float64) {
+	halfLeading := (m.LineHeight - m.FontSize) / 2
+	return m.FontSize*0.8 + halfLeading, m.FontSize*0.2 + halfLeading
+}
+
+// lineHasContent reports whether a line holds anything that gives it height:
+// text, preserved white space, atomic inlines or inline boxes with margins,
+// borders or padding.
+func lineHasContent(segments []*inlineSegment) bool {
+	for _, seg := range segments {
+		if seg.Removed {
+			continue
+		}
+		switch seg.Kind {
+		case segmentOpen, segmentClose:
+			if seg.Width > 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// positionItems records the placed segments of a line, in visual order, as
+// inline items, merging adjacent text of the same box and level into one
+// fragment, and moves atomic inlines and inline boxes into place.
+func (f *inlineFormatter) positionItems(line *LineBox, segments []*inlineSegment) {
+	var current *InlineItem
+	stops := map[*InlineItem]map[int]float64{}
+	for _, seg := range segments {
+		if seg.Kind != segmentText && seg.Kind != segmentSpace {
+			current = nil
+		}
+		if seg.Removed {
+			continue
+		}
+		switch seg.Kind {
+		case segmentText, segmentSpace:
+			glyphs := justifyGlyphs(seg)
+			if current != nil && current.LayoutBox == seg.Box && current.Level == seg.Level {
+				// Right-to-left text is visually reversed
+				n := len([]rune(seg.Text))
+				if seg.Level%2 == 1 {
+					for i := range current.Glyphs {
+						current.Glyphs[i].Cluster += n
+					}
+					current.Text = seg.Text + current.Text
+				} else {
+					n = len([]rune(current.Text))
+					for i := range glyphs {
+						glyphs[i].Cluster += n
+					}
+					current.Text += seg.Text
+				}
+				current.Glyphs = append(current.Glyphs, glyphs...)
+				current.Rect.Width = seg.X + seg.Width + seg.Extra - current.Rect.X
+				if seg.Extra > 0 {
+					current.WordSpacing = seg.Metrics.WordSpacing + seg.Extra/float64(len([]rune(seg.Text)))
+				}
+			} else {
+				ascent := seg.Metrics.FontSize * 0.8
+				current = &InlineItem{
+					Rect:          Rect{X: seg.X, Y: f.baselines[seg.Box] - ascent, Width: seg.Width + seg.Extra, Height: seg.Metrics.FontSize},
+					LayoutBox:     seg.Box,
+					Text:          seg.Text,
+					LetterSpacing: seg.Metrics.LetterSpacing,
+					WordSpacing:   seg.Metrics.WordSpacing,
+					Level:         seg.Level,
+					Glyphs:        glyphs,
+					Ascent:        ascent,
+				}
+				if seg.Extra > 0 {
+					current.WordSpacing += seg.Extra / float64(len([]rune(seg.Text)))
+				}
+				line.InlineItems = append(line.InlineItems, current)
+				seg.Box.Fragments = append(seg.Box.Fragments, current)
+				stops[current] = map[int]float64{}
+			}
+			// Record where the caret goes at each DOM offset, the first
+			// position in logical order winning
+			carets := segmentCarets(seg)
+			for i, offset := range seg.Offsets {
+				if _, ok := stops[current][offset]; !ok {
+					stops[current][offset] = seg.X + carets[i]
+				}
+			}
+		case segmentAtomic:
+			margin := seg.Box.Dimensions.MarginBox()
+			translateBox(seg.Box, seg.X-margin.X, f.baselines[seg.Box]-seg.Box.baselineOffset()-margin.Y)
+			line.InlineItems = append(line.InlineItems, &InlineItem{Rect: seg.Box.Dimensions.MarginBox(), LayoutBox: seg.Box, Level: seg.Level})
+		case segmentOpen, segmentClose:
+			// The content of the box starts inside its edges
+			edge := seg.X
+			if seg.LeftEdge {
+				edge += seg.Width
+			}
+			f.extendInlineBox(seg.Box, edge, seg.Metrics)
+		}
+		// Enclosing inline boxes grow to include the segment
+		for box := seg.Box.Parent; box != nil && box != f.container; box = box.Parent {
+			if box.BoxType != InlineBox || box.Replaced != nil {
+				continue
+			}
+			m := resolveTextMetrics(box.ComputedStyle, f.fonts)
+			f.extendInlineBox(box, seg.X, m)
+			f.extendInlineBox(box, seg.X+seg.Width+seg.Extra, m)
+		}
+	}
+	for item, offsets := range stops {
+		item.setCarets(offsets)
+	}
+	for _, item := range line.InlineItems {
+		if box := item.LayoutBox; box.TextContent != "" {
+			box.Dimensions.Content = unionRect(box.Dimensions.Content, item.Rect, !f.placed[box])
+			f.placed[box] = true
+		}
+	}
+}
+
+// justifyGlyphs returns the glyphs of a segment with the space added by
+// justification shared among them.
+func justifyGlyphs(seg *inlineSegment) []font.Glyph {
+	glyphs := append([]font.Glyph(nil), seg.Glyphs...)
+	if seg.Extra > 0 && len(glyphs) > 0 {
+		for i := range glyphs {
+			glyphs[i].XAdvance += seg.Extra / float64(len(glyphs))
+		}
+	}
+	return glyphs
+}
+
+// segmentCarets returns the caret positions at the character boundaries of
+// a text or space segment, relative to its left edge, including the space
+// added by justification.
+func segmentCarets(seg *inlineSegment) []float64 {
+	rtl := seg.Level%2 == 1
+	carets := seg.Metrics.carets(seg.Text, seg.Glyphs, rtl)
+	if seg.Extra > 0 {
+		n := float64(len(carets) - 1)
+		for i := range carets {
+			frac := float64(i) / n
+			if rtl {
+				frac = 1 - frac
+			}
+			carets[i] += seg.Extra * frac
+		}
+	}
+	return carets
+}
+
+// setCarets sets the DOM offsets of an item and its caret positions from
+// the positions recorded at offsets. An offset inside collapsed white
+// space takes the position of the next offset that has one.
+func (item *InlineItem) setCarets(positions map[int]float64) {
+	if len(positions) == 0 {
+		return
+	}
+	item.Start, item.End = math.MaxInt, math.MinInt
+	for offset := range positions {
+		item.Start = min(item.Start, offset)
+		item.End = max(item.End, offset)
+	}
+	item.Carets = make([]float64, item.End-item.Start+1)
+	next := positions[item.End]
+	for offset := item.End; offset >= item.Start; offset-- {
+		if x, ok := positions[offset]; ok {
+			next = x
+		}
+		item.Carets[offset-item.Start] = next - item.Rect.X
+	}
+}
+
+// extendInlineBox grows the content area of an inline box to include x on
+// the line being placed.
+func (f *inlineFormatter) extendInlineBox(box *LayoutBox, x float64, m textMetrics) {
+	area := Rect{X: x, Y: f.baselines[box] - m.FontSize*0.8, Height: m.FontSize}
+	box.Dimensions.Content = unionRect(box.Dimensions.Content, area, !f.placed[box])
+	f.placed[box] = true
+}
+
+// unionRect returns the smallest rectangle containing a and b, or b alone
+// when reset is set.
+func unionRect(a, b Rect, reset bool) Rect {
+	if reset {
+		return b
+	}
+	x0 := math.Min(a.X, b.X)
+	y0 := math.Min(a.Y, b.Y)
+	x1 := math.Max(a.X+a.Width, b.X+b.Width)
+	y1 := math.Max(a.Y+a.Height, b.Y+b.Height)
+	return Rect{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+}
+
+// setInlineEdges sets the margins, borders and padding of an inline box.
+// Only the horizontal margins affect layout.
+func setInlineEdges(box *LayoutBox) {
+	style := box.ComputedStyle
+	if style == nil {
+		return
+	}
+	box.Dimensions.Padding.Left = getLength(style, "padding-left")
+	box.Dimensions.Padding.Right = getLength(style, "padding-right")
+	box.Dimensions.Padding.Top = getLength(style, "padding-top")
+	box.Dimensions.Padding.Bottom = getLength(style, "padding-bottom")
+	box.Dimensions.Border.Left = getBorderWidth(style, "border-left-width")
+	box.Dimensions.Border.Right = getBorderWidth(style, "border-right-width")
+	box.Dimensions.Border.Top = getBorderWidth(style, "border-top-width")
+	box.Dimensions.Border.Bottom = getBorderWidth(style, "border-bottom-width")
+	box.Dimensions.Margin.Left = getLength(style, "margin-left")
+	box.Dimensions.Margin.Right = getLength(style, "margin-right")
+}
+
+// translateBox moves a laid out box and everything inside it.
+func translateBox(box *LayoutBox, dx, dy float64) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+	box.Dimensions.Content.X += dx
+	box.Dimensions.Content.Y += dy
+	for i := range box.Columns {
+		box.Columns[i].X += dx
+		box.Columns[i].Y += dy
+	}
+	for _, line := range box.LineBoxes {
+		line.Rect.X += dx
+		line.Rect.Y += dy
+		line.Baseline += dy
+		for _, item := range line.InlineItems {
+			item.Rect.X += dx
+			item.Rect.Y += dy
+		}
+	}
+	for _, child := range box.Children {
+		if child.TextContent != "" {
+			// Text fragments were moved with the line boxes
+			child.Dimensions.Content.X += dx
+			child.Dimensions.Content.Y += dy
+			continue
+		}
+		translateBox(child, dx, dy)
+	}
+}
+
+// collapseFlexItemText processes the white space of text directly inside a
+// flex container. Each run becomes its own anonymous flex item, and runs of
+// collapsible white space alone are not rendered.
+func collapseFlexItemText(box *LayoutBox) {
+	if box.BoxType != FlexBox && box.BoxType != InlineFlexBox {
+		return
+	}
+	children := box.Children[:0]
+	for _, child := range box.Children {
+		if child.TextContent != "" {
+			style := child.inheritedStyle()
+			ws := ResolveWhiteSpace(style)
+			state := collapseState{spaceBefore: true}
+			text := processWhiteSpace(child.TextContent, ws, &state)
+			if ws.collapsesSpaces() {
+				text = strings.TrimSuffix(text, " ")
+			}
+			if text == "" {
+				continue
+			}
+			child.TextContent = applyTextTransform(text, getText(style, "text-transform"), 0)
+		}
+		children = append(children, child)
+	}
+	box.Children = children
+}
@@ -0,0 +1,355 @@
+package layout
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/font"
+)
+
+// lineTexts returns the text placed on each line box of a block.
+func lineTexts(box *LayoutBox) []string {
+	var lines []string
+	for _, line := range box.LineBoxes {
+		var sb strings.Builder
+		for _, item := range line.InlineItems {
+			sb.WriteString(item.Text)
+		}
+		lines = append(lines, sb.String())
+	}
+	return lines
+}
+
+func TestInlineWhiteSpaceAcrossElements(t *testing.T) {
+	p := layoutHTML(t, "<body><p>\n  Hello   <b> big </b>\n  world  </p></body>", "", "p", nil)
+	if got := lineTexts(p); len(got) != 1 || got[0] != "Hello big world" {
+		t.Errorf("lines = %q, want [\"Hello big world\"]", got)
+	}
+}
+
+func TestInlinePreservesPre(t *testing.T) {
+	pre := layoutHTML(t, "<body><pre>a  b\n\tc</pre></body>", "", "pre", nil)
+	got := lineTexts(pre)
+	if len(got) != 2 || got[0] != "a  b" || got[1] != "c" {
+		t.Fatalf("lines = %q, want [\"a  b\" \"c\"]", got)
+	}
+	// The tab advances to the first tab stop, eight spaces in
+	item := pre.LineBoxes[1].InlineItems[0]
+	m := resolveTextMetrics(pre.ComputedStyle, nil)
+	if want := pre.Dimensions.Content.X + m.TabSize; math.Abs(item.Rect.X-want) > 0.01 {
+		t.Errorf("text after tab at x = %v, want %v", item.Rect.X, want)
+	}
+}
+
+func TestInlineWrapping(t *testing.T) {
+	// Each character is 6px wide at a 10px font size
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 60px; margin: 0 }"
+	p := layoutHTML(t, "<body><p>aaaa bbbb cccc dddd eeee</p></body>", stylesheet, "p", nil)
+	got := lineTexts(p)
+	want := []string{"aaaa bbbb", "cccc dddd", "eeee"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	if p.Dimensions.Content.Height != 3*12 {
+		t.Errorf("height = %v, want three 12px lines", p.Dimensions.Content.Height)
+	}
+	if y := p.LineBoxes[1].Rect.Y - p.LineBoxes[0].Rect.Y; y != 12 {
+		t.Errorf("line pitch = %v, want 12", y)
+	}
+
+	p = layoutHTML(t, "<body><p style='white-space: nowrap'>aaaa bbbb cccc dddd eeee</p></body>", stylesheet, "p", nil)
+	if got := lineTexts(p); len(got) != 1 {
+		t.Errorf("nowrap lines = %q, want one line", got)
+	}
+
+	p = layoutHTML(t, "<body><p>one<br>two</p></body>", stylesheet, "p", nil)
+	if got := lineTexts(p); len(got) != 2 || got[1] != "two" {
+		t.Errorf("lines with <br> = %q, want two", got)
+	}
+}
+
+func TestInlineTextAlign(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 100px; margin: 0 }"
+	tests := []struct {
+		align string
+		x     float64
+	}{
+		{"left", 0},
+		{"right", 100 - 24},
+		{"center", (100 - 24) / 2},
+		{"end", 100 - 24},
+	}
+	for _, tt := range tests {
+		p := layoutHTML(t, "<body><p style='text-align: "+tt.align+"'>abcd</p></body>", stylesheet, "p", nil)
+		item := p.LineBoxes[0].InlineItems[0]
+		if got := item.Rect.X - p.Dimensions.Content.X; got != tt.x {
+			t.Errorf("text-align: %s: x = %v, want %v", tt.align, got, tt.x)
+		}
+	}
+}
+
+func TestInlineJustify(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 70px; margin: 0; text-align: justify }"
+	p := layoutHTML(t, "<body><p>aaa bbb ccc dddd eeee</p></body>", stylesheet, "p", nil)
+	if len(p.LineBoxes) != 2 {
+		t.Fatalf("lines = %q, want two", lineTexts(p))
+	}
+	// "aaa bbb ccc" is 66px; the 4px left over is shared by two spaces
+	first := p.LineBoxes[0].InlineItems[0]
+	if math.Abs(first.Rect.Width-70) > 0.01 {
+		t.Errorf("justified width = %v, want 70", first.Rect.Width)
+	}
+	if math.Abs(first.WordSpacing-2) > 0.01 {
+		t.Errorf("word spacing = %v, want 2", first.WordSpacing)
+	}
+	// The last line is not justified
+	if last := p.LineBoxes[1].InlineItems[0]; last.WordSpacing != 0 {
+		t.Errorf("last line word spacing = %v, want 0", last.WordSpacing)
+	}
+}
+
+func TestInlineTextIndentAndSpacing(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 100px; margin: 0 }"
+	p := layoutHTML(t, "<body><p style='text-indent: 20px'>aaaa bbbb cccc</p></body>", stylesheet, "p", nil)
+	lines := p.LineBoxes
+	if got := lines[0].InlineItems[0].Rect.X - p.Dimensions.Content.X; got != 20 {
+		t.Errorf("first line indent = %v, want 20", got)
+	}
+	if got := lineTexts(p); len(got) != 2 || got[0] != "aaaa bbbb" {
+		t.Errorf("indented lines = %q", got)
+	}
+	if got := lines[1].InlineItems[0].Rect.X - p.Dimensions.Content.X; got != 0 {
+		t.Errorf("second line indent = %v, want 0", got)
+	}
+
+	// Hanging indents every line but the first, by lengths and percentages
+	// of the line width
+	for _, indent := range []string{"1.25rem hanging", "20% hanging"} {
+		p = layoutHTML(t, "<body><p style='text-indent: "+indent+"'>aaaa bbbb cccc dddd</p></body>", stylesheet, "p", nil)
+		lines = p.LineBoxes
+		if len(lines) != 2 {
+			t.Fatalf("%s: lines = %q", indent, lineTexts(p))
+		}
+		if first, second := lines[0].InlineItems[0].Rect.X-p.Dimensions.Content.X, lines[1].InlineItems[0].Rect.X-p.Dimensions.Content.X; first != 0 || second != 20 {
+			t.Errorf("%s: indents = %v, %v, want 0, 20", indent, first, second)
+		}
+	}
+
+	p = layoutHTML(t, "<body><p style='letter-spacing: 2px; word-spacing: 5px; text-transform: uppercase'>ab cd</p></body>", stylesheet, "p", nil)
+	item := p.LineBoxes[0].InlineItems[0]
+	if item.Text != "AB CD" {
+		t.Errorf("text = %q, want uppercase", item.Text)
+	}
+	if item.Rect.Width != 5*(6+2)+5 || item.LetterSpacing != 2 || item.WordSpacing != 5 {
+		t.Errorf("spaced item = %+v", item)
+	}
+}
+
+func TestInlineBoxGeometry(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 200px; margin: 0 } span { padding-left: 4px }"
+	p := layoutHTML(t, "<body><p>ab <span>cd</span></p></body>", stylesheet, "p", nil)
+	span := findBox(p, "span")
+	// "ab " is 18px, then 4px of padding
+	if got := span.Dimensions.Content.X - p.Dimensions.Content.X; got != 22 {
+		t.Errorf("span content x = %v, want 22", got)
+	}
+	if span.Dimensions.Content.Width != 12 {
+		t.Errorf("span content width = %v, want 12", span.Dimensions.Content.Width)
+	}
+	text := span.Children[0]
+	if len(text.Fragments) != 1 || text.Dimensions.Content.X != span.Dimensions.Content.X {
+		t.Errorf("span text fragments = %+v", text.Fragments)
+	}
+}
+
+func TestWhiteSpaceOnlyRunsTakeNoSpace(t *testing.T) {
+	body := layoutHTML(t, "<body>\n  <div style='height: 10px'></div>\n  <div style='height: 10px'></div>\n</body>", "body { margin: 0 }", "body", nil)
+	if body.Dimensions.Content.Height != 20 {
+		t.Errorf("body height = %v, want 20", body.Dimensions.Content.Height)
+	}
+}
+
+func TestInlineShapedText(t *testing.T) {
+	doc, err := dom.ParseHTML("<body><p>abc <b>de</b> <span style='letter-spacing: 2px'>fg</span></p></body>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := css.NewStyleResolver()
+	resolver.SetUserAgentStylesheet(css.GetUserAgentStylesheet())
+	resolver.AddAuthorStylesheet(css.NewParser("body { margin: 0 } p { font-family: monospace; font-size: 10px; margin: 0 }").Parse())
+	ctx := NewLayoutContext(800, 600)
+	ctx.Fonts = font.Default()
+	root := BuildLayoutTree(doc.DocumentElement(), resolver, ctx)
+	root.Layout(ctx)
+	p := findBox(root, "p")
+
+	// Go Mono advances are 1229 units of 2048 per em
+	advance := 10 * 1229 / 2048.0
+	items := p.LineBoxes[0].InlineItems
+	if len(items) != 4 {
+		t.Fatalf("items = %d, want 4", len(items))
+	}
+	for _, item := range items {
+		if len(item.Glyphs) != len([]rune(item.Text)) {
+			t.Errorf("%q has %d glyphs", item.Text, len(item.Glyphs))
+		}
+		// The glyphs that are painted span the measured width
+		if got := font.Advance(item.Glyphs); math.Abs(got-item.Rect.Width) > 1e-9 {
+			t.Errorf("%q glyphs advance %v, width %v", item.Text, got, item.Rect.Width)
+		}
+	}
+	if got := items[0].Rect.Width; math.Abs(got-4*advance) > 1e-9 {
+		t.Errorf("%q width = %v, want %v", items[0].Text, got, 4*advance)
+	}
+	if items[1].Glyphs[0].Face.Weight <= items[0].Glyphs[0].Face.Weight {
+		t.Errorf("bold text uses %v", items[1].Glyphs[0].Face)
+	}
+	if got := items[3].Rect.Width; math.Abs(got-2*(advance+2)) > 1e-9 {
+		t.Errorf("letter-spaced width = %v, want %v", got, 2*(advance+2))
+	}
+}
+
+func TestInlineTextCarets(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 200px; margin: 0 }"
+	tests := []struct {
+		name   string
+		html   string
+		carets []float64
+	}{
+		// Offsets in collapsed spaces take the position of the next character
+		{"collapsed spaces", "<p>ab   cd</p>", []float64{0, 6, 12, 18, 18, 18, 24, 30}},
+		{"right-to-left", "<p dir='rtl'>אב</p>", []float64{12, 6, 0}},
+		{"surrogate pair", "<p>\U0001F600a</p>", []float64{0, 6, 6, 12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := layoutHTML(t, "<body>"+tt.html+"</body>", stylesheet, "p", nil)
+			item := p.LineBoxes[0].InlineItems[0]
+			if item.Start != 0 || item.End != len(tt.carets)-1 || fmt.Sprint(item.Carets) != fmt.Sprint(tt.carets) {
+				t.Errorf("offsets %d-%d, carets %v, want 0-%d %v", item.Start, item.End, item.Carets, len(tt.carets)-1, tt.carets)
+			}
+		})
+	}
+}
+
+func TestTextFragmentGeometry(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 40px; margin: 0 }"
+	p := layoutHTML(t, "<body><p>aaa bbb</p></body>", stylesheet, "p", nil)
+	UpdateElementGeometries(p, nil, 0, 0)
+	text := (*dom.Text)(p.Element.AsNode().FirstChild())
+	fragments := text.TextFragments()
+	if len(fragments) != 2 {
+		t.Fatalf("fragments = %+v, want one per line", fragments)
+	}
+	x := p.Dimensions.Content.X
+	second := fragments[1]
+	if second.Start != 4 || second.End != 7 || second.X != x || second.Carets[3] != x+18 {
+		t.Errorf("second line fragment = %+v", second)
+	}
+}
+
+func TestInlineBlockShrinkToFit(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 200px; margin: 0 } .ib { display: inline-block; padding-left: 2px; padding-right: 2px }"
+	p := layoutHTML(t, "<body><p>ab <span class=ib>cdef</span></p></body>", stylesheet, "p", nil)
+	ib := findBox(p, "span")
+	if ib.Dimensions.Content.Width != 24 {
+		t.Errorf("inline-block width = %v, want 24", ib.Dimensions.Content.Width)
+	}
+	// "ab " is 18px, then the left padding
+	if got := ib.Dimensions.Content.X - p.Dimensions.Content.X; got != 20 {
+		t.Errorf("inline-block content x = %v, want 20", got)
+	}
+
+	// A div would close the paragraph
+	section := layoutHTML(t, "<body><section><span class=ib><div>abc</div><div>abcdef</div></span></section></body>", stylesheet+" section { font-size: 10px }", "section", nil)
+	if got := findBox(section, "span").Dimensions.Content.Width; got != 36 {
+		t.Errorf("inline-block around blocks width = %v, want 36", got)
+	}
+
+	// Content wider than the line takes the available width and wraps
+	p = layoutHTML(t, "<body><p style='width: 60px'><span class=ib>aaaa bbbb cccc</span></p></body>", stylesheet, "p", nil)
+	ib = findBox(p, "span")
+	if ib.Dimensions.Content.Width != 56 || len(ib.LineBoxes) != 2 {
+		t.Errorf("wrapped inline-block width = %v with %d lines, want 56 and 2", ib.Dimensions.Content.Width, len(ib.LineBoxes))
+	}
+}
+
+func TestInlineBlockBaseline(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 200px; margin: 0 } .ib { display: inline-block }"
+	// Lines are 12px tall with the baseline 9px down; the inline-block sits
+	// on the baseline of its last line
+	p := layoutHTML(t, "<body><p>ab<span class=ib>x<br>y</span></p></body>", stylesheet, "p", nil)
+	line := p.LineBoxes[0]
+	ib := findBox(p, "span")
+	if line.Rect.Height != 24 || line.Baseline-line.Rect.Y != 21 {
+		t.Errorf("line height %v with baseline at %v, want 24 and 21", line.Rect.Height, line.Baseline-line.Rect.Y)
+	}
+	if ib.Dimensions.Content.Y != line.Rect.Y || ib.LineBoxes[1].Baseline != line.Baseline {
+		t.Errorf("inline-block at y = %v, last baseline %v, want %v and %v", ib.Dimensions.Content.Y, ib.LineBoxes[1].Baseline, line.Rect.Y, line.Baseline)
+	}
+	if got := line.InlineItems[0].Rect.Y; got != line.Baseline-8 {
+		t.Errorf("text at y = %v, want %v", got, line.Baseline-8)
+	}
+
+	// Clipping its overflow puts the baseline at the bottom margin edge
+	p = layoutHTML(t, "<body><p>ab<span class=ib style='overflow: hidden'>x<br>y</span></p></body>", stylesheet, "p", nil)
+	line = p.LineBoxes[0]
+	if line.Rect.Height != 27 || line.Baseline-line.Rect.Y != 24 {
+		t.Errorf("line height %v with baseline at %v, want 27 and 24", line.Rect.Height, line.Baseline-line.Rect.Y)
+	}
+}
+
+func TestVerticalAlign(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; width: 200px; margin: 0 } span { display: inline-block; width: 10px; height: 20px }"
+	// The box is 20px tall with its baseline at the bottom, in a 10px font
+	tests := []struct {
+		align string
+		top   float64 // of the box, relative to the line's baseline
+	}{
+		{"baseline", -20},
+		{"middle", -12.5},
+		{"sub", -18},
+		{"super", -20 - 10.0/3},
+		{"text-top", -8},
+		{"text-bottom", -18},
+		{"5px", -25},
+		{"50%", -26},
+	}
+	for _, tt := range tests {
+		t.Run(tt.align, func(t *testing.T) {
+			p := layoutHTML(t, "<body><p>ab<span style='vertical-align: "+tt.align+"'></span></p></body>", stylesheet, "p", nil)
+			line := p.LineBoxes[0]
+			top := findBox(p, "span").Dimensions.MarginBox().Y
+			if math.Abs(top-line.Baseline-tt.top) > 0.01 {
+				t.Errorf("box top = %v, want %v from the baseline", top-line.Baseline, tt.top)
+			}
+			// The line grows to hold the box
+			if top < line.Rect.Y-0.01 || top+20 > line.Rect.Y+line.Rect.Height+0.01 {
+				t.Errorf("box at %v-%v outside line %+v", top, top+20, line.Rect)
+			}
+		})
+	}
+
+	// Top and bottom alignment sit on the edges of the line
+	p := layoutHTML(t, "<body><p>ab<span style='vertical-align: top'></span></p></body>", stylesheet, "p", nil)
+	line := p.LineBoxes[0]
+	if top := findBox(p, "span").Dimensions.Content.Y; line.Rect.Height != 20 || top != line.Rect.Y || line.Baseline-line.Rect.Y != 9 {
+		t.Errorf("top-aligned box at %v in line %+v with baseline %v", top, line.Rect, line.Baseline)
+	}
+	p = layoutHTML(t, "<body><p>ab<span style='vertical-align: bottom'></span></p></body>", stylesheet, "p", nil)
+	line = p.LineBoxes[0]
+	if top := findBox(p, "span").Dimensions.Content.Y; line.Rect.Height != 20 || top != line.Rect.Y || line.Baseline-line.Rect.Y != 17 {
+		t.Errorf("bottom-aligned box at %v in line %+v with baseline %v", top, line.Rect, line.Baseline)
+	}
+
+	// Text inside a shifted inline box moves with it
+	p = layoutHTML(t, "<body><p>a<b style='vertical-align: super'>b</b></p></body>", "body { margin: 0 } p { font-size: 10px; margin: 0 }", "p", nil)
+	line = p.LineBoxes[0]
+	if shift := line.InlineItems[0].Rect.Y - line.InlineItems[1].Rect.Y; math.Abs(shift-10.0/3) > 0.01 {
+		t.Errorf("superscript raised by %v, want %v", shift, 10.0/3)
+	}
+}
@@ -0,0 +1,398 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements intrinsic sizes: min-content and max-content widths,
+// the sizing keywords, shrink-to-fit and aspect-ratio.
+// Reference: https://www.w3.org/TR/css-sizing-3/#intrinsic-sizes
+package layout
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// intrinsicMode selects how content is sized: laid out in the space it is
+// given, or measured at its narrowest or widest.
+type intrinsicMode int
+
+const (
+	layoutSize     intrinsicMode = iota // laid out for real
+	minContentSize                      // broken at every opportunity
+	maxContentSize                      // broken only where forced
+)
+
+// indefinite marks a containing block width that is not known, as when
+// measuring content.
+const indefinite = -1.0
+
+// intrinsicWidths returns the min-content and max-content widths of the
+// content box of a box.
+func (box *LayoutBox) intrinsicWidths(ctx *LayoutContext) (minContent, maxContent float64) {
+	if sizes, ok := ctx.intrinsic[box]; ok {
+		return sizes[0], sizes[1]
+	}
+	switch {
+	case box.Replaced != nil:
+		saved := box.Dimensions
+		box.setEdges()
+		width, _ := box.replacedContentSize(&Dimensions{})
+		box.Dimensions = saved
+		minContent, maxContent = math.Max(width, 0), math.Max(width, 0)
+	case box.BoxType == FlexBox || box.BoxType == InlineFlexBox:
+		minContent, maxContent = box.flexIntrinsicWidths(ctx)
+	case box.TextContent != "" || box.establishesInlineContext():
+		minContent = widestLine(newInlineFormatter(box, ctx, minContentSize).layoutLines(0, 0))
+		maxContent = widestLine(newInlineFormatter(box, ctx, maxContentSize).layoutLines(math.Inf(1), 0))
+	default:
+		for _, child := range box.Children {
+			if child.Position == PositionAbsolute || child.Position == PositionFixed {
+				continue
+			}
+			minContent = math.Max(minContent, child.intrinsicContribution(ctx, minContentSize))
+			maxContent = math.Max(maxContent, child.intrinsicContribution(ctx, maxContentSize))
+		}
+	}
+	if ctx.intrinsic == nil {
+		ctx.intrinsic = map[*LayoutBox][2]float64{}
+	}
+	ctx.intrinsic[box] = [2]float64{minContent, maxContent}
+	return minContent, maxContent
+}
+
+// widestLine returns the width taken by the content of the widest line.
+func widestLine(lines []*LineBox) float64 {
+	width := 0.0
+	for _, line := range lines {
+		width = math.Max(width, line.used)
+	}
+	return width
+}
+
+// flexIntrinsicWidths returns the intrinsic widths of a flex container.
+// Items in a row sit side by side, with the gaps between them, unless they
+// may wrap onto lines of their own.
+// Reference: https://www.w3.org/TR/css-flexbox-1/#intrinsic-main-sizes
+func (box *LayoutBox) flexIntrinsicWidths(ctx *LayoutContext) (minContent, maxContent float64) {
+	row := !strings.HasPrefix(getKeyword(box.ComputedStyle, "flex-direction"), "column")
+	wrap := getKeyword(box.ComputedStyle, "flex-wrap")
+	gap, _ := box.gap("column-gap", 0)
+	items := 0
+	for _, child := range box.Children {
+		if child.Position == PositionAbsolute || child.Position == PositionFixed {
+			continue
+		}
+		if items++; row && items > 1 {
+			maxContent += gap
+			if wrap == "" || wrap == "nowrap" {
+				minContent += gap
+			}
+		}
+		itemMin := child.intrinsicContribution(ctx, minContentSize)
+		itemMax := child.intrinsicContribution(ctx, maxContentSize)
+		if row {
+			maxContent += itemMax
+			if wrap == "" || wrap == "nowrap" {
+				minContent += itemMin
+			} else {
+				minContent = math.Max(minContent, itemMin)
+			}
+		} else {
+			minContent = math.Max(minContent, itemMin)
+			maxContent = math.Max(maxContent, itemMax)
+		}
+	}
+	return minContent, maxContent
+}
+
+// intrinsicContribution returns the width of the margin box of a box when
+// it is sized under a min-content or max-content constraint, taking its
+// specified width, aspect-ratio and min and max widths into account.
+func (box *LayoutBox) intrinsicContribution(ctx *LayoutContext, mode intrinsicMode) float64 {
+	if box.TextContent != "" {
+		minContent, maxContent := box.intrinsicWidths(ctx)
+		if mode == minContentSize {
+			return minContent
+		}
+		return maxContent
+	}
+	margins, edges := box.horizontalEdges()
+	width, ok := box.resolveWidth(ctx, "width", indefinite, mode)
+	if !ok {
+		if ratio, _ := aspectRatio(box.ComputedStyle); ratio > 0 && box.Replaced == nil {
+			if height, ok := box.definiteHeight(); ok {
+				width, ok = height*ratio, true
+			}
+		}
+	}
+	if !ok {
+		minContent, maxContent := box.intrinsicWidths(ctx)
+		width = maxContent
+		if mode == minContentSize {
+			width = minContent
+		}
+	}
+	return box.clampWidth(ctx, width, indefinite, mode) + edges + margins
+}
+
+// resolveWidth resolves a width property (width, min-width or max-width)
+// to a content-box width, reporting false for auto and none. Percentages
+// of an indefinite containing block are treated the same way, and
+// fit-content is resolved under the given intrinsic mode.
+func (box *LayoutBox) resolveWidth(ctx *LayoutContext, property string, containingWidth float64, mode intrinsicMode) (float64, bool) {
+	style := box.ComputedStyle
+	if style == nil {
+		return 0, false
+	}
+	val := flowValue(style, property)
+	if val == nil {
+		return 0, false
+	}
+	margins, edges := box.horizontalEdges()
+	raw := strings.TrimSpace(val.Value.Raw)
+
+	var width float64
+	switch {
+	case val.Keyword == "min-content" || val.Keyword == "max-content" || val.Keyword == "fit-content":
+		minContent, maxContent := box.intrinsicWidths(ctx)
+		switch {
+		case val.Keyword == "min-content":
+			return minContent, true
+		case val.Keyword == "max-content":
+			return maxContent, true
+		case containingWidth != indefinite:
+			return box.shrinkToFit(ctx, containingWidth-margins-edges), true
+		case mode == minContentSize:
+			return minContent, true
+		}
+		return maxContent, true
+	case strings.HasPrefix(raw, "fit-content(") && strings.HasSuffix(raw, ")"):
+		arg := strings.TrimSpace(raw[len("fit-content(") : len(raw)-1])
+		// A percentage against an indefinite width is no limit
+		limit, ok := style.LengthPercentage(arg, containingWidth)
+		if strings.HasSuffix(arg, "%") && containingWidth == indefinite {
+			ok = false
+		}
+		minContent, maxContent := box.intrinsicWidths(ctx)
+		if !ok {
+			if mode == minContentSize {
+				return minContent, true
+			}
+			return maxContent, true
+		}
+		if box.BoxSizing == BoxSizingBorderBox {
+			limit -= edges
+		}
+		return math.Min(maxContent, math.Max(minContent, limit)), true
+	case val.Value.Type == css.PercentageValue:
+		if containingWidth == indefinite {
+			return 0, false
+		}
+		width = val.Value.Length / 100 * containingWidth
+	case isLength(val):
+		width = val.Length
+	default:
+		return 0, false
+	}
+	if box.BoxSizing == BoxSizingBorderBox {
+		width -= edges
+	}
+	return math.Max(width, 0), true
+}
+
+// isLength reports whether a computed size is a resolved length rather
+// than a keyword, percentage or function.
+func isLength(val *css.ComputedValue) bool {
+	if val.Keyword != "" {
+		return false
+	}
+	switch val.Value.Type {
+	case css.LengthValue, css.NumberValue:
+		return true
+	case css.KeywordValue:
+		// Values set directly rather than parsed only carry a length
+		return val.Length != 0
+	}
+	return false
+}
+
+// clampWidth applies min-width and max-width to a content-box width.
+func (box *LayoutBox) clampWidth(ctx *LayoutContext, width, containingWidth float64, mode intrinsicMode) float64 {
+	if maxWidth, ok := box.resolveWidth(ctx, "max-width", containingWidth, mode); ok && width > maxWidth {
+		width = maxWidth
+	}
+	if minWidth, ok := box.resolveWidth(ctx, "min-width", containingWidth, mode); ok && width < minWidth {
+		width = minWidth
+	}
+	return width
+}
+
+// shrinkToFit returns the shrink-to-fit content width of a box in the
+// available width: its max-content width, unless that does not fit, but
+// never less than its min-content width.
+// Reference: https://www.w3.org/TR/CSS2/visudet.html#shrink-to-fit-float
+func (box *LayoutBox) shrinkToFit(ctx *LayoutContext, available float64) float64 {
+	minContent, maxContent := box.intrinsicWidths(ctx)
+	return math.Min(math.Max(minContent, available), maxContent)
+}
+
+// horizontalEdges returns the specified horizontal margins of a box, auto
+// ones being zero, and its horizontal borders and padding.
+func (box *LayoutBox) horizontalEdges() (margins, edges float64) {
+	style := box.ComputedStyle
+	margins = getLength(style, "margin-left") + getLength(style, "margin-right")
+	edges = getLength(style, "padding-left") + getLength(style, "padding-right") +
+		getBorderWidth(style, "border-left-width") + getBorderWidth(style, "border-right-width")
+	return margins, edges
+}
+
+// setEdges sets the margins, borders and padding of a box from its style,
+// auto margins being zero.
+func (box *LayoutBox) setEdges() {
+	setInlineEdges(box)
+	box.Dimensions.Margin.Top = getLength(box.ComputedStyle, "margin-top")
+	box.Dimensions.Margin.Bottom = getLength(box.ComputedStyle, "margin-bottom")
+}
+
+// definiteHeight returns the content-box height set in CSS as a length.
+func (box *LayoutBox) definiteHeight() (float64, bool) {
+	return box.resolveHeight("height")
+}
+
+// resolveHeight resolves a height property (height, min-height or
+// max-height) set in CSS as a length, or as a percentage of a definite
+// containing block height, to a content-box height.
+func (box *LayoutBox) resolveHeight(property string) (float64, bool) {
+	style := box.ComputedStyle
+	if style == nil {
+		return 0, false
+	}
+	val := flowValue(style, property)
+	if val == nil {
+		return 0, false
+	}
+	var height float64
+	switch {
+	case val.Keyword == "" && val.Value.Type == css.PercentageValue:
+		basis, ok := box.percentageHeightBasis()
+		if !ok {
+			return 0, false
+		}
+		height = val.Value.Length / 100 * basis
+	case isLength(val):
+		height = val.Length
+	default:
+		return 0, false
+	}
+	if box.BoxSizing == BoxSizingBorderBox {
+		height -= getLength(style, "padding-top") + getLength(style, "padding-bottom") +
+			getBorderWidth(style, "border-top-width") + getBorderWidth(style, "border-bottom-width")
+	}
+	return math.Max(height, 0), true
+}
+
+// percentageHeightBasis returns the height that percentage heights of a
+// box resolve against: the viewport height for the root and fixed boxes,
+// and otherwise the height of the containing block, unless that depends
+// on the content.
+// Reference: https://www.w3.org/TR/CSS2/visudet.html#the-height-property
+func (box *LayoutBox) percentageHeightBasis() (float64, bool) {
+	parent := box.Parent
+	for parent != nil && parent.Element == nil {
+		parent = parent.Parent
+	}
+	if parent == nil || box.Position == PositionFixed {
+		root := box
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		return root.viewportHeight, root.viewportHeight > 0
+	}
+	return parent.definiteHeight()
+}
+
+// clampHeight applies min-height and max-height to a content-box height.
+func (box *LayoutBox) clampHeight(height float64) float64 {
+	if maxHeight, ok := box.resolveHeight("max-height"); ok && height > maxHeight {
+		height = maxHeight
+	}
+	if minHeight, ok := box.resolveHeight("min-height"); ok && height < minHeight {
+		height = minHeight
+	}
+	return height
+}
+
+// aspectRatio returns the preferred aspect ratio, width over height, set
+// by the aspect-ratio property, or zero when there is none. auto reports
+// whether a natural ratio of replaced content takes precedence.
+// Reference: https://www.w3.org/TR/css-sizing-4/#aspect-ratio
+func aspectRatio(style *css.ComputedStyle) (ratio float64, auto bool) {
+	value := getText(style, "aspect-ratio")
+	var numbers []float64
+	for _, part := range strings.Fields(strings.ReplaceAll(value, "/", " / ")) {
+		switch part {
+		case "auto":
+			auto = true
+		case "/":
+		default:
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil || n < 0 {
+				return 0, false
+			}
+			numbers = append(numbers, n)
+		}
+	}
+	switch len(numbers) {
+	case 1:
+		ratio = numbers[0]
+	case 2:
+		if numbers[1] > 0 {
+			ratio = numbers[0] / numbers[1]
+		}
+	}
+	return ratio, auto
+}
+
+// applyAspectRatioHeight gives a box with an auto height the height its
+// aspect-ratio sets for its width. Content that does not fit makes it
+// taller unless it clips its overflow.
+func (box *LayoutBox) applyAspectRatioHeight() {
+	ratio, _ := aspectRatio(box.ComputedStyle)
+	if ratio <= 0 {
+		return
+	}
+	d := &box.Dimensions
+	height := d.Content.Width / ratio
+	if box.BoxSizing == BoxSizingBorderBox {
+		border := d.BorderBox()
+		height = border.Width/ratio - (border.Height - d.Content.Height)
+	}
+	if box.Overflow == OverflowVisible {
+		height = math.Max(height, d.Content.Height)
+	}
+	d.Content.Height = math.Max(height, 0)
+}
+
+// contentHeightAt returns the height of the content of a box laid out at
+// the given content width. The box is left to be laid out again.
+func (box *LayoutBox) contentHeightAt(ctx *LayoutContext, width float64) float64 {
+	if box.TextContent != "" {
+		height := 0.0
+		for _, line := range newInlineFormatter(box, ctx, maxContentSize).layoutLines(width, 0) {
+			height += line.Rect.Height
+		}
+		return height
+	}
+	saved := box.Dimensions
+	box.Dimensions.Content.Width = width
+	box.Dimensions.Content.Height = 0
+	if box.BoxType == FlexBox || box.BoxType == InlineFlexBox {
+		box.layoutFlexContent(ctx, false)
+	} else {
+		box.layoutBlockChildren(ctx)
+	}
+	height := box.Dimensions.Content.Height
+	resetHeights(box)
+	box.Dimensions = saved
+	return height
+}
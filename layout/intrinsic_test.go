@@ -0,0 +1,141 @@
+package layout
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSizingKeywords(t *testing.T) {
+	// Each character is 6px wide at a 10px font size: "aaa bbbbb" is 54px
+	// on one line, and its longest word 30px
+	stylesheet := "body { margin: 0 } section { width: 40px; font-size: 10px } p { margin: 0 }"
+	tests := []struct {
+		style string
+		width float64
+	}{
+		{"width: min-content", 30},
+		{"width: max-content", 54},
+		{"width: fit-content", 40},
+		{"width: fit-content(20px)", 30},
+		{"width: fit-content(45px)", 45},
+		{"width: fit-content(2.75rem)", 44},
+		{"width: fit-content(100%)", 40},
+		{"width: 50%", 20},
+		{"width: max-content; max-width: 35px", 35},
+		{"width: min-content; min-width: 50%", 30},
+		{"width: min-content; min-width: max-content", 54},
+		{"width: max-content; padding-left: 5px; padding-right: 5px; box-sizing: border-box", 54},
+		{"width: 30px; padding-left: 5px; padding-right: 5px; box-sizing: border-box", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			section := layoutHTML(t, "<body><section><p style='"+tt.style+"'>aaa bbbbb</p></section></body>", stylesheet, "section", nil)
+			if got := findBox(section, "p").Dimensions.Content.Width; got != tt.width {
+				t.Errorf("width = %v, want %v", got, tt.width)
+			}
+		})
+	}
+}
+
+func TestIntrinsicWidths(t *testing.T) {
+	stylesheet := "body { margin: 0 } section { font-size: 10px } .ib { display: inline-block; width: 100px }"
+	tests := []struct {
+		name     string
+		html     string
+		min, max float64
+	}{
+		{"text", "aaa bbbbb", 30, 54},
+		{"forced break", "<span style='white-space: pre'>aa\nbbbb cc</span>", 42, 42},
+		{"break-word", "<span style='overflow-wrap: break-word'>aaaa</span>", 24, 24},
+		{"anywhere", "<span style='overflow-wrap: anywhere'>aaaa</span>", 6, 24},
+		{"atomic", "aa <span class=ib></span> bb", 100, 136},
+		{"blocks", "<div>aaa bbbbb</div><div style='margin-left: 10px'>cc</div>", 30, 54},
+		{"fixed width child", "<div style='width: 80px; padding-left: 5px'>a</div>", 85, 85},
+		{"flex row", "<div style='display: flex'><div>aa bb</div><div>ccc</div></div>", 30, 48},
+		{"flex wrap", "<div style='display: flex; flex-wrap: wrap'><div>aa bb</div><div>ccc</div></div>", 18, 48},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := layoutHTML(t, "<body><section>"+tt.html+"</section></body>", stylesheet, "section", nil)
+			minContent, maxContent := section.intrinsicWidths(NewLayoutContext(800, 600))
+			if minContent != tt.min || maxContent != tt.max {
+				t.Errorf("intrinsic widths = %v, %v, want %v, %v", minContent, maxContent, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestShrinkToFit(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; margin-top: 0; margin-bottom: 0; padding-left: 2px; padding-right: 2px } .narrow { width: 44px }"
+	body := layoutHTML(t, "<body><p style='float: left'>aaa bbbbb</p></body>", stylesheet, "body", nil)
+	p := findBox(body, "p")
+	if p.Dimensions.Content.Width != 54 || len(p.LineBoxes) != 1 {
+		t.Errorf("float width = %v with %d lines, want 54 on one line", p.Dimensions.Content.Width, len(p.LineBoxes))
+	}
+
+	// Narrower than the content, the float wraps at the available width
+	p = layoutHTML(t, "<body><div class=narrow><p style='float: right'>aaa bbbbb</p></div></body>", stylesheet, "p", nil)
+	if p.Dimensions.Content.Width != 40 || len(p.LineBoxes) != 2 || p.Dimensions.Content.Height != 24 {
+		t.Errorf("narrow float width = %v with %d lines, height %v", p.Dimensions.Content.Width, len(p.LineBoxes), p.Dimensions.Content.Height)
+	}
+
+	// An absolutely positioned box shrinks to its content at its static
+	// position, and takes no space in the flow
+	body = layoutHTML(t, "<body><div style='height: 30px'></div><p style='position: absolute; left: 10px'>aaa bbbbb</p><div style='height: 5px'></div></body>", stylesheet, "body", nil)
+	p = findBox(body, "p")
+	if got := p.Dimensions.Content; got.Width != 54 || got.X != 12 || got.Y != 30 || got.Height != 12 {
+		t.Errorf("absolute box content = %+v", got)
+	}
+	if h := body.Dimensions.Content.Height; h != 35 {
+		t.Errorf("body height = %v, want 35 without the absolute box", h)
+	}
+
+	// Both offsets stretch it instead
+	p = layoutHTML(t, "<body><p style='position: absolute; left: 10px; right: 20px'>aaa bbbbb</p></body>", stylesheet, "p", nil)
+	if got := p.Dimensions.Content.Width; got != 766 {
+		t.Errorf("stretched absolute box width = %v, want 766", got)
+	}
+}
+
+func TestAspectRatio(t *testing.T) {
+	stylesheet := "body { margin: 0 } div { font-size: 10px }"
+	tests := []struct {
+		style         string
+		width, height float64
+	}{
+		{"width: 160px; aspect-ratio: 16 / 9", 160, 90},
+		{"width: 100px; aspect-ratio: 2", 100, 50},
+		{"width: 100px; aspect-ratio: auto 4/1; padding-left: 5px; padding-right: 5px; padding-top: 5px; padding-bottom: 5px; box-sizing: border-box", 90, 15},
+		{"height: 50px; aspect-ratio: 2", 100, 50},
+		{"width: 20px; aspect-ratio: 4", 20, 24}, // content makes it taller
+		{"width: 20px; aspect-ratio: 4; overflow: hidden", 20, 5},
+		{"width: 20px; aspect-ratio: auto", 20, 24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			div := layoutHTML(t, "<body><div style='"+tt.style+"'>aaa bbb</div></body>", stylesheet, "div", nil)
+			if got := div.Dimensions.Content; math.Abs(got.Width-tt.width) > 0.01 || math.Abs(got.Height-tt.height) > 0.01 {
+				t.Errorf("size = %vx%v, want %vx%v", got.Width, got.Height, tt.width, tt.height)
+			}
+		})
+	}
+
+	img := layoutHTML(t, "<body><img width=100 style='aspect-ratio: 2'></body>", "", "img", nil)
+	if got := img.Dimensions.Content; got.Width != 100 || got.Height != 50 {
+		t.Errorf("image size = %vx%v, want 100x50", got.Width, got.Height)
+	}
+}
+
+func TestFlexBaseSizeFromContent(t *testing.T) {
+	stylesheet := "body { margin: 0 } .flex { display: flex; width: 400px; font-size: 10px } .column { flex-direction: column; width: 30px }"
+	flex := layoutHTML(t, "<body><div class=flex><span>aaa bbb</span><span>cc</span></div></body>", stylesheet, "div", nil)
+	if w0, w1 := flex.Children[0].Dimensions.Content.Width, flex.Children[1].Dimensions.Content.Width; w0 != 42 || w1 != 12 {
+		t.Errorf("item widths = %v, %v, want 42 and 12", w0, w1)
+	}
+
+	// In a column, the text wraps at the container's width
+	flex = layoutHTML(t, "<body><div class='flex column'><div>aaa bbb</div></div></body>", stylesheet, "div", nil)
+	if h := flex.Children[0].Dimensions.Content.Height; h != 24 {
+		t.Errorf("column item height = %v, want two 12px lines", h)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/chrisuehlinger/viberowser/css"
 	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/font"
 )
 
 // Dimensions represents the dimensions of a layout box including content, padding, border, and margin.
@@ -107,6 +108,18 @@ type LayoutBox struct {
 	// For inline content
 	LineBoxes    []*LineBox
 	TextContent  string
+	// TextNode is the DOM node a text box was generated from
+	TextNode     *dom.Node
+
+	// Fragments are the pieces of a text box placed on each line
+	Fragments    []*InlineItem
+
+	// Columns are the column boxes of a multi-column container with
+	// content, row by row between spanning elements
+	Columns      []Rect
+
+	// Content of replaced elements such as <svg> and <img>
+	Replaced     *ReplacedContent
 
 	// Overflow handling
 	Overflow     OverflowType
@@ -121,6 +134,10 @@ type LayoutBox struct {
 
 	// Anonymous box parent reference
 	Parent *LayoutBox
+
+	// viewportHeight is the height of the initial containing block, set
+	// on the root box, which percentage heights of the root resolve against
+	viewportHeight float64
 }
 
 // LineBox represents a line of inline content.
@@ -128,6 +145,7 @@ type LineBox struct {
 	Rect        Rect
 	InlineItems []*InlineItem
 	Baseline    float64
+	used        float64 // width taken by the content, before alignment
 }
 
 // InlineItem represents an inline-level item within a line.
@@ -135,8 +153,27 @@ type InlineItem struct {
 	Rect       Rect
 	LayoutBox  *LayoutBox
 	Text       string
-	Start      int // Character offset for text
+	Start      int // DOM offsets of the text in UTF-16 code units
 	End        int
+
+	// Spacing added after each character and each word separator
+	LetterSpacing float64
+	WordSpacing   float64
+
+	// Level is the bidi embedding level; odd levels are right-to-left and
+	// their text is stored in logical order
+	Level int
+
+	// Glyphs are the shaped glyphs of the text in visual order, with the
+	// spacing above included in their advances. They are nil when text is
+	// measured without fonts. Ascent is the distance from the top of Rect
+	// to the baseline.
+	Glyphs []font.Glyph
+	Ascent float64
+
+	// Carets holds the caret position, relative to Rect.X, at each DOM
+	// offset of the text node from Start to End
+	Carets []float64
 }
 
 // Float represents a floated element.
@@ -169,6 +206,16 @@ type LayoutContext struct {
 	// Floats in the current block formatting context
 	LeftFloats  []*Float
 	RightFloats []*Float
+
+	// ImageLoader loads image sources; images are left empty when it is nil
+	ImageLoader ImageLoader
+
+	// Fonts are the faces text is shaped with. Without them text is
+	// measured with estimated character widths.
+	Fonts *font.Collection
+
+	// intrinsic caches the min-content and max-content widths of boxes
+	intrinsic map[*LayoutBox][2]float64
 }
 
 // NewLayoutContext creates a new layout context with the given viewport dimensions.
@@ -215,7 +262,11 @@ func BuildLayoutTree(element *dom.Element, styleResolver *css.StyleResolver, ctx
 	}
 
 	computedStyle := styleResolver.ResolveStyles(element, nil)
-	return buildLayoutBoxRecursive(element, computedStyle, styleResolver, nil, ctx)
+	root := buildLayoutBoxRecursive(element, computedStyle, styleResolver, nil, ctx)
+	if root != nil {
+		root.viewportHeight = ctx.ViewportHeight
+	}
+	return root
 }
 
 func buildLayoutBoxRecursive(element *dom.Element, computedStyle *css.ComputedStyle, styleResolver *css.StyleResolver, parentStyle *css.ComputedStyle, ctx *LayoutContext) *LayoutBox {
@@ -241,7 +292,7 @@ func buildLayoutBoxRecursive(element *dom.Element, computedStyle *css.ComputedSt
 	box.Position = determinePositionType(computedStyle.GetComputedStyleProperty("position"))
 
 	// Determine float type
-	box.Float = determineFloatType(computedStyle.GetComputedStyleProperty("float"))
+	box.Float = determineFloatType(physicalSide(computedStyle.GetComputedStyleProperty("float"), computedStyle))
 
 	// Determine overflow
 	box.Overflow = determineOverflowType(computedStyle.GetComputedStyleProperty("overflow"))
@@ -263,6 +314,12 @@ func buildLayoutBoxRecursive(element *dom.Element, computedStyle *css.ComputedSt
 	// Parse position offsets
 	parsePositionOffsets(box, computedStyle)
 
+	// Replaced elements have no CSS children
+	if replaced := buildReplacedContent(element, computedStyle, styleResolver, ctx); replaced != nil {
+		box.Replaced = replaced
+		return box
+	}
+
 	// Build children recursively
 	node := element.AsNode()
 	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
@@ -275,12 +332,14 @@ func buildLayoutBoxRecursive(element *dom.Element, computedStyle *css.ComputedSt
 				box.Children = append(box.Children, childBox)
 			}
 		} else if child.NodeType() == dom.TextNode {
-			// Create inline box for text
-			textContent := strings.TrimSpace(child.TextContent())
+			// Create inline box for text; white space is processed during
+			// inline layout
+			textContent := child.TextContent()
 			if textContent != "" {
 				textBox := &LayoutBox{
 					BoxType:     InlineBox,
 					TextContent: textContent,
+					TextNode:    child,
 					ComputedStyle: computedStyle,
 					Parent:      box,
 				}
@@ -291,6 +350,7 @@ func buildLayoutBoxRecursive(element *dom.Element, computedStyle *css.ComputedSt
 
 	// Handle anonymous boxes if needed
 	normalizeBoxTree(box)
+	collapseFlexItemText(box)
 
 	return box
 }
@@ -343,6 +403,25 @@ func determineFloatType(float string) FloatType {
 	}
 }
 
+// physicalSide maps the flow-relative values inline-start and inline-end to
+// left or right for the direction of a style.
+func physicalSide(value string, style *css.ComputedStyle) string {
+	rtl := getKeyword(style, "direction") == "rtl"
+	switch value {
+	case "inline-start":
+		if rtl {
+			return "right"
+		}
+		return "left"
+	case "inline-end":
+		if rtl {
+			return "left"
+		}
+		return "right"
+	}
+	return value
+}
+
 // determineOverflowType determines the overflow type from the overflow value.
 func determineOverflowType(overflow string) OverflowType {
 	switch strings.ToLower(overflow) {
@@ -377,6 +456,26 @@ func isStackingContext(box *LayoutBox) bool {
 		if opacity != "" && opacity != "1" {
 			return true
 		}
+		// Filters, blending and isolation composite the element as a group
+		if filter := box.ComputedStyle.GetComputedStyleProperty("filter"); filter != "" && filter != "none" {
+			return true
+		}
+		if blend := box.ComputedStyle.GetComputedStyleProperty("mix-blend-mode"); blend != "" && blend != "normal" {
+			return true
+		}
+		if box.ComputedStyle.GetComputedStyleProperty("isolation") == "isolate" {
+			return true
+		}
+		if transform := box.ComputedStyle.GetComputedStyleProperty("transform"); transform != "" && transform != "none" {
+			return true
+		}
+		// Clipping and masking also paint the element as a group
+		if clip := box.ComputedStyle.GetComputedStyleProperty("clip-path"); clip != "" && clip != "none" {
+			return true
+		}
+		if mask := box.ComputedStyle.GetComputedStyleProperty("mask-image"); mask != "" && mask != "none" {
+			return true
+		}
 	}
 	return false
 }
@@ -387,25 +486,25 @@ func parsePositionOffsets(box *LayoutBox, style *css.ComputedStyle) {
 		return
 	}
 
-	topVal := style.GetPropertyValue("top")
+	topVal := flowValue(style, "top")
 	if topVal != nil && topVal.Keyword != "auto" {
 		box.OffsetTop = topVal.Length
 		box.HasOffsetTop = true
 	}
 
-	rightVal := style.GetPropertyValue("right")
+	rightVal := flowValue(style, "right")
 	if rightVal != nil && rightVal.Keyword != "auto" {
 		box.OffsetRight = rightVal.Length
 		box.HasOffsetRight = true
 	}
 
-	bottomVal := style.GetPropertyValue("bottom")
+	bottomVal := flowValue(style, "bottom")
 	if bottomVal != nil && bottomVal.Keyword != "auto" {
 		box.OffsetBottom = bottomVal.Length
 		box.HasOffsetBottom = true
 	}
 
-	leftVal := style.GetPropertyValue("left")
+	leftVal := flowValue(style, "left")
 	if leftVal != nil && leftVal.Keyword != "auto" {
 		box.OffsetLeft = leftVal.Length
 		box.HasOffsetLeft = true
@@ -429,9 +528,9 @@ func normalizeBoxTree(box *LayoutBox) {
 	hasInlineChildren := false
 
 	for _, child := range box.Children {
-		if child.BoxType == BlockBox {
+		if isBlockLevel(child) {
 			hasBlockChildren = true
-		} else if child.BoxType == InlineBox {
+		} else {
 			hasInlineChildren = true
 		}
 	}
@@ -442,7 +541,7 @@ func normalizeBoxTree(box *LayoutBox) {
 		var currentInlineRun []*LayoutBox
 
 		for _, child := range box.Children {
-			if child.BoxType == BlockBox {
+			if isBlockLevel(child) {
 				// Flush any inline run
 				if len(currentInlineRun) > 0 {
 					anonBox := &LayoutBox{
@@ -544,9 +643,34 @@ func (box *LayoutBox) Layout(ctx *LayoutContext) {
 		return
 	}
 
+	// The root is placed at the top of the initial containing block, whose
+	// height is the viewport's rather than that of content laid out in it
+	if box.Parent == nil && len(ctx.ContainingBlocks) == 1 {
+		initial := *containingBlock
+		initial.Content.Height = 0
+		containingBlock = &initial
+	}
+
+	if box.Replaced != nil {
+		box.layoutReplaced(ctx, containingBlock)
+		return
+	}
+
+	if box.isFlowRoot() {
+		box.layoutFlowRoot(ctx, containingBlock)
+		return
+	}
+
 	switch box.BoxType {
 	case BlockBox, AnonymousBlockBox:
-		box.layoutBlock(ctx, containingBlock)
+		switch {
+		case box.Position == PositionAbsolute || box.Position == PositionFixed:
+			LayoutAbsolutePositioned(box, ctx)
+		case box.Float != FloatNone:
+			LayoutFloat(box, ctx)
+		default:
+			box.layoutBlock(ctx, containingBlock)
+		}
 	case InlineBox, InlineBlockBox:
 		box.layoutInline(ctx, containingBlock)
 	case FlexBox, InlineFlexBox:
@@ -557,7 +681,7 @@ func (box *LayoutBox) Layout(ctx *LayoutContext) {
 // layoutBlock performs block layout algorithm.
 func (box *LayoutBox) layoutBlock(ctx *LayoutContext, containingBlock *Dimensions) {
 	// Calculate width first (depends on containing block)
-	box.calculateBlockWidth(containingBlock)
+	box.calculateBlockWidth(ctx, containingBlock)
 
 	// Position the box
 	box.calculateBlockPosition(containingBlock, ctx)
@@ -575,16 +699,15 @@ func (box *LayoutBox) layoutBlock(ctx *LayoutContext, containingBlock *Dimension
 }
 
 // calculateBlockWidth calculates the width of a block-level box.
-func (box *LayoutBox) calculateBlockWidth(containingBlock *Dimensions) {
+func (box *LayoutBox) calculateBlockWidth(ctx *LayoutContext, containingBlock *Dimensions) {
 	style := box.ComputedStyle
 	if style == nil {
 		box.Dimensions.Content.Width = containingBlock.Content.Width
 		return
 	}
 
-	// Get width value
-	width := getLength(style, "width")
-	widthKeyword := getKeyword(style, "width")
+	// Get the content width, which sizing keywords take from the content
+	width, widthDefinite := box.resolveWidth(ctx, "width", containingBlock.Content.Width, layoutSize)
 
 	// Get margin values
 	marginLeft := getLength(style, "margin-left")
@@ -601,10 +724,28 @@ func (box *LayoutBox) calculateBlockWidth(containingBlock *Dimensions) {
 	borderRight := getBorderWidth(style, "border-right-width")
 
 	// Determine which values are auto (empty string means default/auto for these properties)
-	widthAuto := widthKeyword == "auto" || (widthKeyword == "" && width == 0)
+	widthAuto := !widthDefinite
 	marginLeftAuto := marginLeftKeyword == "auto"
 	marginRightAuto := marginRightKeyword == "auto"
 
+	// An auto width follows a definite height through aspect-ratio
+	if widthAuto {
+		if ratio, _ := aspectRatio(style); ratio > 0 {
+			if height, ok := box.definiteHeight(); ok {
+				width, widthAuto = height*ratio, false
+			}
+		}
+	}
+
+	// min-width and max-width constrain the tentative width
+	tentative := width
+	if widthAuto {
+		tentative = math.Max(containingBlock.Content.Width-marginLeft-marginRight-paddingLeft-paddingRight-borderLeft-borderRight, 0)
+	}
+	if clamped := box.clampWidth(ctx, tentative, containingBlock.Content.Width, layoutSize); clamped != tentative {
+		width, widthAuto = clamped, false
+	}
+
 	// Calculate total horizontal space (use 0 for auto width in initial calculation)
 	widthForCalc := width
 	if widthAuto {
@@ -625,9 +766,17 @@ func (box *LayoutBox) calculateBlockWidth(containingBlock *Dimensions) {
 
 	underflow := containingBlock.Content.Width - total
 
+	// In a right-to-left containing block the left margin absorbs the
+	// difference when the sizes are over-constrained
+	rtl := box.Parent != nil && getKeyword(box.Parent.inheritedStyle(), "direction") == "rtl"
+
 	if !widthAuto && !marginLeftAuto && !marginRightAuto {
 		// Over-constrained: add underflow to margin-right
-		marginRight += underflow
+		if rtl {
+			marginLeft += underflow
+		} else {
+			marginRight += underflow
+		}
 	} else if !widthAuto && !marginLeftAuto && marginRightAuto {
 		marginRight = underflow
 	} else if !widthAuto && marginLeftAuto && !marginRightAuto {
@@ -643,7 +792,11 @@ func (box *LayoutBox) calculateBlockWidth(containingBlock *Dimensions) {
 			width = underflow
 		} else {
 			width = 0
-			marginRight += underflow
+			if rtl {
+				marginLeft += underflow
+			} else {
+				marginRight += underflow
+			}
 		}
 	} else if !widthAuto && marginLeftAuto && marginRightAuto {
 		// Center the element
@@ -651,17 +804,8 @@ func (box *LayoutBox) calculateBlockWidth(containingBlock *Dimensions) {
 		marginRight = underflow / 2
 	}
 
-	// Apply box-sizing adjustment
-	if box.BoxSizing == BoxSizingBorderBox {
-		// Width includes padding and border
-		contentWidth := width - paddingLeft - paddingRight - borderLeft - borderRight
-		if contentWidth < 0 {
-			contentWidth = 0
-		}
-		box.Dimensions.Content.Width = contentWidth
-	} else {
-		box.Dimensions.Content.Width = width
-	}
+	// box-sizing was applied when the width was resolved
+	box.Dimensions.Content.Width = width
 
 	box.Dimensions.Margin.Left = marginLeft
 	box.Dimensions.Margin.Right = marginRight
@@ -712,9 +856,24 @@ func (box *LayoutBox) layoutBlockChildren(ctx *LayoutContext) {
 	ctx.PushContainingBlock(&box.Dimensions)
 	defer ctx.PopContainingBlock()
 
+	if box.isMulticolContainer() {
+		box.layoutMulticol(ctx)
+		return
+	}
+
+	if box.establishesInlineContext() {
+		box.layoutInlineContent(ctx)
+		return
+	}
+
 	for _, child := range box.Children {
 		child.Layout(ctx)
-		// Accumulate child's margin box height
+		// Accumulate child's margin box height. Absolutely positioned boxes
+		// take no space in the flow; floats, which nothing wraps around
+		// yet, still do.
+		if child.Position == PositionAbsolute || child.Position == PositionFixed {
+			continue
+		}
 		box.Dimensions.Content.Height += child.Dimensions.MarginBox().Height
 	}
 }
@@ -729,9 +888,18 @@ func (box *LayoutBox) calculateBlockHeight(containingBlock *Dimensions) {
 	// Check for explicit height
 	height := getLength(style, "height")
 	heightKeyword := getKeyword(style, "height")
-	// Height is explicit if it's not "auto" and not empty with zero length
-	heightExplicit := heightKeyword != "auto" && (heightKeyword != "" || height > 0)
-	if heightExplicit {
+	// Height is explicit if it's not "auto" and not empty with zero length.
+	// The heights of blocks sized by their content are auto.
+	heightExplicit := heightKeyword != "auto" && (heightKeyword != "" || height > 0) &&
+		heightKeyword != "min-content" && heightKeyword != "max-content" && heightKeyword != "fit-content"
+	if val := flowValue(style, "height"); val != nil && heightKeyword == "" && val.Value.Type == css.PercentageValue {
+		// Percentages of a containing block sized by its content are auto
+		if percentHeight, ok := box.definiteHeight(); ok {
+			box.Dimensions.Content.Height = percentHeight
+		} else {
+			box.applyAspectRatioHeight()
+		}
+	} else if heightExplicit {
 
 		// Apply box-sizing adjustment
 		if box.BoxSizing == BoxSizingBorderBox {
@@ -745,22 +913,12 @@ func (box *LayoutBox) calculateBlockHeight(containingBlock *Dimensions) {
 		} else {
 			box.Dimensions.Content.Height = height
 		}
+	} else {
+		box.applyAspectRatioHeight()
 	}
 
-	// Apply min-height
-	minHeight := getLength(style, "min-height")
-	if box.Dimensions.Content.Height < minHeight {
-		box.Dimensions.Content.Height = minHeight
-	}
-
-	// Apply max-height
-	maxHeightKeyword := getKeyword(style, "max-height")
-	if maxHeightKeyword != "none" && maxHeightKeyword != "" {
-		maxHeight := getLength(style, "max-height")
-		if box.Dimensions.Content.Height > maxHeight {
-			box.Dimensions.Content.Height = maxHeight
-		}
-	}
+	// Apply min-height and max-height
+	box.Dimensions.Content.Height = box.clampHeight(box.Dimensions.Content.Height)
 }
 
 // layoutInline performs inline layout algorithm.
@@ -781,19 +939,12 @@ func (box *LayoutBox) layoutInline(ctx *LayoutContext, containingBlock *Dimensio
 		box.Dimensions.Margin.Right = getLength(style, "margin-right")
 	}
 
-	// Inline boxes participate in inline formatting context
-	// For now, estimate content dimensions based on text
+	// Text outside a line box, such as a flex item, is measured as a
+	// single line
 	if box.TextContent != "" {
-		fontSize := 16.0
-		if style != nil {
-			fontSize = getLength(style, "font-size")
-			if fontSize == 0 {
-				fontSize = 16.0
-			}
-		}
-		// Approximate: 0.6 average character width, line height = 1.2 * font-size
-		box.Dimensions.Content.Width = float64(len(box.TextContent)) * fontSize * 0.6
-		box.Dimensions.Content.Height = fontSize * 1.2
+		metrics := resolveTextMetrics(box.inheritedStyle(), ctx.Fonts)
+		box.Dimensions.Content.Width = metrics.measure(box.TextContent)
+		box.Dimensions.Content.Height = metrics.LineHeight
 	}
 
 	// Layout children
@@ -804,7 +955,9 @@ func (box *LayoutBox) layoutInline(ctx *LayoutContext, containingBlock *Dimensio
 
 // applyRelativePosition applies relative positioning offsets.
 func (box *LayoutBox) applyRelativePosition() {
-	if box.HasOffsetLeft {
+	// When both are set, the offset on the inline-start side wins
+	rtl := box.Parent != nil && getKeyword(box.Parent.inheritedStyle(), "direction") == "rtl"
+	if box.HasOffsetLeft && !(rtl && box.HasOffsetRight) {
 		box.Dimensions.Content.X += box.OffsetLeft
 	} else if box.HasOffsetRight {
 		box.Dimensions.Content.X -= box.OffsetRight
@@ -817,24 +970,25 @@ func (box *LayoutBox) applyRelativePosition() {
 	}
 }
 
-// getLength retrieves a length value from computed style.
+// getLength retrieves a length value from computed style. Sides and
+// dimensions are those of the style's flow-relative frame.
 func getLength(style *css.ComputedStyle, property string) float64 {
 	if style == nil {
 		return 0
 	}
-	val := style.GetPropertyValue(property)
+	val := flowValue(style, property)
 	if val == nil {
 		return 0
 	}
 	return val.Length
 }
 
-// getKeyword retrieves a keyword value from computed style.
+// getKeyword retrieves a keyword value from computed style, like getLength.
 func getKeyword(style *css.ComputedStyle, property string) string {
 	if style == nil {
 		return ""
 	}
-	val := style.GetPropertyValue(property)
+	val := flowValue(style, property)
 	if val == nil {
 		return ""
 	}
@@ -846,11 +1000,17 @@ func getBorderWidth(style *css.ComputedStyle, property string) float64 {
 	if style == nil {
 		return 0
 	}
-	val := style.GetPropertyValue(property)
+	val := flowValue(style, property)
 	if val == nil {
 		return 0
 	}
 
+	// A border with style none or hidden has no width
+	styleProperty := strings.Replace(property, "-width", "-style", 1)
+	if borderStyle := getKeyword(style, styleProperty); borderStyle == "none" || borderStyle == "hidden" {
+		return 0
+	}
+
 	// Handle keyword values
 	switch val.Keyword {
 	case "thin":
@@ -899,23 +1059,23 @@ func LayoutAbsolutePositioned(box *LayoutBox, ctx *LayoutContext) {
 		return
 	}
 
+	box.setEdges()
+
 	// Calculate width
-	widthKeyword := getKeyword(style, "width")
-	if widthKeyword == "auto" {
+	width, widthDefinite := box.resolveWidth(ctx, "width", containingBlock.Content.Width, layoutSize)
+	if !widthDefinite {
 		// Shrink-to-fit width or based on left/right constraints
+		available := containingBlock.Content.Width - box.OffsetLeft - box.OffsetRight -
+			box.Dimensions.Margin.Left - box.Dimensions.Margin.Right -
+			box.Dimensions.Padding.Left - box.Dimensions.Padding.Right -
+			box.Dimensions.Border.Left - box.Dimensions.Border.Right
 		if box.HasOffsetLeft && box.HasOffsetRight {
-			box.Dimensions.Content.Width = containingBlock.Content.Width -
-				box.OffsetLeft - box.OffsetRight -
-				box.Dimensions.Margin.Left - box.Dimensions.Margin.Right -
-				box.Dimensions.Padding.Left - box.Dimensions.Padding.Right -
-				box.Dimensions.Border.Left - box.Dimensions.Border.Right
+			width = available
 		} else {
-			// Shrink to fit
-			box.Dimensions.Content.Width = 0 // Will be determined by content
+			width = box.shrinkToFit(ctx, available)
 		}
-	} else {
-		box.Dimensions.Content.Width = getLength(style, "width")
 	}
+	box.Dimensions.Content.Width = box.clampWidth(ctx, width, containingBlock.Content.Width, layoutSize)
 
 	// Calculate height
 	heightKeyword := getKeyword(style, "height")
@@ -929,6 +1089,8 @@ func LayoutAbsolutePositioned(box *LayoutBox, ctx *LayoutContext) {
 		} else {
 			box.Dimensions.Content.Height = 0 // Will be determined by content
 		}
+	} else if val := flowValue(style, "height"); val != nil && val.Value.Type == css.PercentageValue {
+		box.Dimensions.Content.Height = val.Value.Length / 100 * containingBlock.Content.Height
 	} else {
 		box.Dimensions.Content.Height = getLength(style, "height")
 	}
@@ -955,10 +1117,19 @@ func LayoutAbsolutePositioned(box *LayoutBox, ctx *LayoutContext) {
 			box.OffsetBottom - box.Dimensions.Margin.Bottom - box.Dimensions.Border.Bottom -
 			box.Dimensions.Padding.Bottom - box.Dimensions.Content.Height
 	} else {
-		// Use static position
-		box.Dimensions.Content.Y = containingBlock.Content.Y +
+		// Use static position, where the box would be in the flow
+		box.Dimensions.Content.Y = containingBlock.Content.Y + containingBlock.Content.Height +
 			box.Dimensions.Margin.Top + box.Dimensions.Border.Top + box.Dimensions.Padding.Top
 	}
+
+	// Lay out the content; an auto height that is not set by the offsets
+	// comes from it
+	height := box.Dimensions.Content.Height
+	box.Dimensions.Content.Height = 0
+	box.layoutBlockChildren(ctx)
+	if heightKeyword != "auto" || (box.HasOffsetTop && box.HasOffsetBottom) {
+		box.Dimensions.Content.Height = height
+	}
 }
 
 // ClearType represents the CSS clear property values.
@@ -992,29 +1163,16 @@ func LayoutFloat(box *LayoutBox, ctx *LayoutContext) {
 		return
 	}
 
+	// Get padding and borders
+	box.setEdges()
+
 	// Calculate width (floats must have explicit width or shrink-to-fit)
-	style := box.ComputedStyle
-	widthKeyword := getKeyword(style, "width")
-	if widthKeyword == "auto" {
-		// Shrink-to-fit
-		box.Dimensions.Content.Width = 0 // Will be determined by content
-	} else {
-		box.Dimensions.Content.Width = getLength(style, "width")
+	width, widthDefinite := box.resolveWidth(ctx, "width", containingBlock.Content.Width, layoutSize)
+	if !widthDefinite {
+		margins, edges := box.horizontalEdges()
+		width = box.shrinkToFit(ctx, containingBlock.Content.Width-margins-edges)
 	}
-
-	// Get padding and borders
-	box.Dimensions.Padding.Left = getLength(style, "padding-left")
-	box.Dimensions.Padding.Right = getLength(style, "padding-right")
-	box.Dimensions.Padding.Top = getLength(style, "padding-top")
-	box.Dimensions.Padding.Bottom = getLength(style, "padding-bottom")
-	box.Dimensions.Border.Left = getBorderWidth(style, "border-left-width")
-	box.Dimensions.Border.Right = getBorderWidth(style, "border-right-width")
-	box.Dimensions.Border.Top = getBorderWidth(style, "border-top-width")
-	box.Dimensions.Border.Bottom = getBorderWidth(style, "border-bottom-width")
-	box.Dimensions.Margin.Left = getLength(style, "margin-left")
-	box.Dimensions.Margin.Right = getLength(style, "margin-right")
-	box.Dimensions.Margin.Top = getLength(style, "margin-top")
-	box.Dimensions.Margin.Bottom = getLength(style, "margin-bottom")
+	box.Dimensions.Content.Width = box.clampWidth(ctx, width, containingBlock.Content.Width, layoutSize)
 
 	// Position based on float direction
 	if box.Float == FloatLeft {
@@ -1030,18 +1188,11 @@ func LayoutFloat(box *LayoutBox, ctx *LayoutContext) {
 		box.Dimensions.Margin.Top + box.Dimensions.Border.Top + box.Dimensions.Padding.Top
 
 	// Layout children to determine height
-	ctx.PushContainingBlock(&box.Dimensions)
-	for _, child := range box.Children {
-		child.Layout(ctx)
-		box.Dimensions.Content.Height += child.Dimensions.MarginBox().Height
-	}
-	ctx.PopContainingBlock()
+	box.Dimensions.Content.Height = 0
+	box.layoutBlockChildren(ctx)
 
 	// Apply explicit height if set
-	heightKeyword := getKeyword(style, "height")
-	if heightKeyword != "auto" && heightKeyword != "" {
-		box.Dimensions.Content.Height = getLength(style, "height")
-	}
+	box.calculateBlockHeight(containingBlock)
 }
 
 // UpdateElementGeometries walks the layout tree and updates each element's geometry
@@ -1118,6 +1269,22 @@ func UpdateElementGeometries(box *LayoutBox, parentOffsetParent *dom.Element, pa
 		}
 	}
 
+	// Text nodes record their fragments for Range.getClientRects
+	if box.TextNode != nil && box.TextNode.NodeType() == dom.TextNode {
+		var fragments []dom.TextFragment
+		for _, item := range box.Fragments {
+			carets := make([]float64, len(item.Carets))
+			for i, x := range item.Carets {
+				carets[i] = item.Rect.X + x
+			}
+			fragments = append(fragments, dom.TextFragment{
+				X: item.Rect.X, Y: item.Rect.Y, Width: item.Rect.Width, Height: item.Rect.Height,
+				Start: item.Start, End: item.End, Carets: carets,
+			})
+		}
+		(*dom.Text)(box.TextNode).SetTextFragments(fragments)
+	}
+
 	// Recursively update children
 	for _, child := range box.Children {
 		UpdateElementGeometries(child, nextOffsetParent, nextParentX, nextParentY)
@@ -251,6 +251,17 @@ func TestGetBorderWidth(t *testing.T) {
 	}
 }
 
+func TestGetBorderWidthWithoutStyle(t *testing.T) {
+	for _, borderStyle := range []string{"none", "hidden"} {
+		style := css.NewComputedStyle(nil, nil)
+		style.SetPropertyValue("border-top-width", &css.ComputedValue{Keyword: "medium"})
+		style.SetPropertyValue("border-top-style", &css.ComputedValue{Keyword: borderStyle})
+		if got := getBorderWidth(style, "border-top-width"); got != 0 {
+			t.Errorf("border width with style %s = %v, want 0", borderStyle, got)
+		}
+	}
+}
+
 func TestNormalizeBoxTree(t *testing.T) {
 	// Create a block box with mixed inline and block children
 	parent := &LayoutBox{
@@ -300,7 +311,7 @@ func TestBlockLayoutWidth(t *testing.T) {
 
 	// Width should be auto by default, filling containing block
 	containingBlock := ctx.CurrentContainingBlock()
-	box.calculateBlockWidth(containingBlock)
+	box.calculateBlockWidth(ctx, containingBlock)
 
 	if box.Dimensions.Content.Width != 800 {
 		t.Errorf("Auto width should fill containing block: got %v, expected 800", box.Dimensions.Content.Width)
@@ -319,7 +330,7 @@ func TestBlockLayoutWithExplicitWidth(t *testing.T) {
 	}
 
 	containingBlock := ctx.CurrentContainingBlock()
-	box.calculateBlockWidth(containingBlock)
+	box.calculateBlockWidth(ctx, containingBlock)
 
 	if box.Dimensions.Content.Width != 400 {
 		t.Errorf("Explicit width: got %v, expected 400", box.Dimensions.Content.Width)
@@ -340,7 +351,7 @@ func TestBlockLayoutCenteredWithAutoMargins(t *testing.T) {
 	}
 
 	containingBlock := ctx.CurrentContainingBlock()
-	box.calculateBlockWidth(containingBlock)
+	box.calculateBlockWidth(ctx, containingBlock)
 
 	// Both margins should be (800 - 400) / 2 = 200
 	if box.Dimensions.Margin.Left != 200 {
@@ -367,7 +378,7 @@ func TestBlockLayoutWithPaddingAndBorder(t *testing.T) {
 	}
 
 	containingBlock := ctx.CurrentContainingBlock()
-	box.calculateBlockWidth(containingBlock)
+	box.calculateBlockWidth(ctx, containingBlock)
 
 	// Content width should be 800 - 20 - 20 - 5 - 5 = 750
 	if box.Dimensions.Content.Width != 750 {
@@ -393,7 +404,7 @@ func TestBorderBoxSizing(t *testing.T) {
 	}
 
 	containingBlock := ctx.CurrentContainingBlock()
-	box.calculateBlockWidth(containingBlock)
+	box.calculateBlockWidth(ctx, containingBlock)
 
 	// Content width should be 200 - 20 - 20 - 5 - 5 = 150 (border-box)
 	if box.Dimensions.Content.Width != 150 {
@@ -555,3 +566,62 @@ func TestInlineLayoutTextEstimate(t *testing.T) {
 		t.Errorf("Inline text height: got %v, expected %v", box.Dimensions.Content.Height, expectedHeight)
 	}
 }
+
+func TestIsStackingContextCompositing(t *testing.T) {
+	tests := []struct {
+		property string
+		value    string
+		want     bool
+	}{
+		{"opacity", "0.5", true},
+		{"filter", "blur(2px)", true},
+		{"filter", "none", false},
+		{"mix-blend-mode", "multiply", true},
+		{"mix-blend-mode", "normal", false},
+		{"isolation", "isolate", true},
+		{"isolation", "auto", false},
+		{"clip-path", "circle(50%)", true},
+		{"clip-path", "none", false},
+		{"mask-image", "linear-gradient(black, transparent)", true},
+		{"mask-image", "none", false},
+	}
+
+	for _, tt := range tests {
+		style := css.NewComputedStyle(nil, nil)
+		style.SetPropertyValue(tt.property, &css.ComputedValue{Keyword: tt.value})
+		box := &LayoutBox{ComputedStyle: style}
+		if got := isStackingContext(box); got != tt.want {
+			t.Errorf("isStackingContext(%s: %s) = %v, want %v", tt.property, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPercentageHeights(t *testing.T) {
+	tests := []struct {
+		name       string
+		stylesheet string
+		height     float64
+	}{
+		{"of the viewport through the root", "html, body { height: 100%; margin: 0 } div { height: 50% }", 300},
+		{"of a fixed height", "body { margin: 0; height: 200px } div { height: 25% }", 50},
+		{"of an auto height", "body { margin: 0 } div { height: 50% }", 0},
+		{"with min-height", "html, body { height: 100%; margin: 0 } div { min-height: 10%; height: 5px }", 60},
+		{"with border-box sizing", "body { margin: 0; height: 200px } div { box-sizing: border-box; height: 50%; padding-top: 10px; padding-bottom: 10px }", 80},
+		{"of a flex container", "html, body { height: 100%; margin: 0 } body { display: flex; flex-direction: column } div { height: 50% }", 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box := layoutHTML(t, "<body><div></div></body>", tt.stylesheet, "div", nil)
+			if box == nil {
+				t.Fatal("no div box")
+			}
+			if got := box.Dimensions.Content.Height; got != tt.height {
+				t.Errorf("height = %v, want %v", got, tt.height)
+			}
+			// The page starts at the top of the viewport
+			if got := box.Dimensions.BorderBox().Y; got != 0 {
+				t.Errorf("y = %v, want 0", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements soft wrap opportunities: Unicode line breaking,
+// word-break, line-break, overflow-wrap and hyphenation.
+// Reference: https://www.w3.org/TR/css-text-3/#line-breaking
+package layout
+
+import (
+	"unicode"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/go-text/typesetting/segmenter"
+	ucd "github.com/go-text/typesetting/unicodedata"
+)
+
+// softHyphen is U+00AD, a hyphenation opportunity that is only visible when
+// a line breaks there.
+const softHyphen = '\u00AD'
+
+// lineBreakStyle holds the properties that control where the text of a box
+// may wrap.
+type lineBreakStyle struct {
+	WhiteSpace   WhiteSpace
+	WordBreak    string
+	LineBreak    string
+	Hyphens      string
+	OverflowWrap bool // overflow-wrap: anywhere or break-word
+	Anywhere     bool // overflow-wrap: anywhere, whose breaks affect min-content
+	Lang         string
+}
+
+// resolveLineBreakStyle reads the line breaking properties of a text box.
+func resolveLineBreakStyle(box *LayoutBox) lineBreakStyle {
+	style := box.inheritedStyle()
+	lb := lineBreakStyle{
+		WhiteSpace: ResolveWhiteSpace(style),
+		WordBreak:  getKeyword(style, "word-break"),
+		LineBreak:  getKeyword(style, "line-break"),
+		Hyphens:    getKeyword(style, "hyphens"),
+		Lang:       contentLanguage(box),
+	}
+	// word-wrap is the legacy name of overflow-wrap
+	wrap := style.GetPropertyValue("overflow-wrap")
+	if legacy := style.GetPropertyValue("word-wrap"); (wrap == nil || wrap.IsInitial) && legacy != nil {
+		wrap = legacy
+	}
+	if wrap != nil && (wrap.Keyword == "anywhere" || wrap.Keyword == "break-word") {
+		lb.OverflowWrap = true
+		lb.Anywhere = wrap.Keyword == "anywhere"
+	}
+	// word-break: break-word is a legacy synonym of overflow-wrap: anywhere
+	if lb.WordBreak == "break-word" {
+		lb.WordBreak = "normal"
+		lb.OverflowWrap = true
+		lb.Anywhere = true
+	}
+	return lb
+}
+
+// contentLanguage returns the language of a box from the nearest lang
+// attribute on it or its ancestors.
+func contentLanguage(box *LayoutBox) string {
+	var el *dom.Element
+	for b := box; b != nil && el == nil; b = b.Parent {
+		el = b.Element
+	}
+	for ; el != nil; el = el.AsNode().ParentElement() {
+		if el.HasAttribute("lang") {
+			return el.GetAttribute("lang")
+		}
+	}
+	return ""
+}
+
+// findBreaks assigns the soft wrap opportunities of the collected
+// segments. Break opportunities follow the Unicode line breaking algorithm
+// across the whole inline formatting context, adjusted by word-break,
+// line-break and hyphens. Text segments are split at the opportunities
+// inside them, and soft hyphens are removed from their text.
+func (f *inlineFormatter) findBreaks() {
+	var runes []rune
+	var owners []int // the segment of each rune
+	for i, seg := range f.segments {
+		switch seg.Kind {
+		case segmentText, segmentSpace:
+			for _, r := range seg.Text {
+				runes = append(runes, r)
+				owners = append(owners, i)
+			}
+		case segmentTab:
+			runes, owners = append(runes, '\t'), append(owners, i)
+		case segmentBreak:
+			runes, owners = append(runes, '\n'), append(owners, i)
+		case segmentAtomic:
+			runes, owners = append(runes, 0xFFFC), append(owners, i)
+		}
+	}
+	if len(runes) == 0 {
+		return
+	}
+
+	var seg segmenter.Segmenter
+	seg.Init(runes)
+	breaks := make([]bool, len(runes)+1)
+	for lines := seg.LineIterator(); lines.Next(); {
+		line := lines.Line()
+		breaks[line.Offset+len(line.Text)] = true
+	}
+	graphemes := make([]bool, len(runes)+1)
+	for iter := seg.GraphemeIterator(); iter.Next(); {
+		g := iter.Grapheme()
+		graphemes[g.Offset+len(g.Text)] = true
+	}
+
+	styles := map[*LayoutBox]lineBreakStyle{}
+	styleOf := func(i int) lineBreakStyle {
+		box := f.segments[owners[i]].Box
+		if lb, ok := styles[box]; ok {
+			return lb
+		}
+		lb := resolveLineBreakStyle(box)
+		styles[box] = lb
+		return lb
+	}
+
+	hyphens := make([]bool, len(runes)+1)
+	for i := 1; i < len(runes); i++ {
+		if !graphemes[i] {
+			continue
+		}
+		prev, next := runes[i-1], runes[i]
+		lb := styleOf(i - 1)
+		switch lb.LineBreak {
+		case "anywhere":
+			breaks[i] = true
+		case "auto", "normal", "loose":
+			// Small kana and prolonged sound marks may start a line
+			if ucd.LookupLineBreakClass(next) == ucd.BreakCJ && isEastAsianWide(prev) {
+				breaks[i] = true
+			}
+			if lb.LineBreak == "loose" && isLooseBreakBefore(next) && isEastAsianWide(prev) {
+				breaks[i] = true
+			}
+		}
+		switch lb.WordBreak {
+		case "break-all":
+			if isLetterOrNumber(prev) && isLetterOrNumber(next) {
+				breaks[i] = true
+			}
+		case "keep-all":
+			if lb.LineBreak != "anywhere" && isLetterOrNumber(prev) && isLetterOrNumber(next) {
+				breaks[i] = false
+			}
+		}
+		if prev == softHyphen {
+			breaks[i] = lb.Hyphens != "none"
+			hyphens[i] = breaks[i]
+		}
+	}
+	f.hyphenateWords(runes, breaks, hyphens, styleOf)
+
+	// Split text segments at their inner opportunities
+	var segments []*inlineSegment
+	pos := 0
+	for i, s := range f.segments {
+		switch s.Kind {
+		case segmentText:
+			n := len([]rune(s.Text))
+			lb := styleOf(pos)
+			var text []rune
+			var offsets []int
+			for k := pos; k < pos+n; k++ {
+				if runes[k] != softHyphen {
+					text = append(text, runes[k])
+					offsets = append(offsets, s.Offsets[k-pos])
+				}
+				if k+1 < pos+n && !breaks[k+1] {
+					continue
+				}
+				piece := &inlineSegment{
+					Kind:         segmentText,
+					Box:          s.Box,
+					Text:         string(text),
+					Metrics:      s.Metrics,
+					Offsets:      append(offsets, s.Offsets[k+1-pos]),
+					BreakAfter:   lb.WhiteSpace.Wrap && breaks[k+1],
+					Hyphen:       hyphens[k+1],
+					OverflowWrap: lb.OverflowWrap && lb.WhiteSpace.Wrap,
+					Anywhere:     lb.Anywhere && lb.WhiteSpace.Wrap,
+				}
+				piece.shape()
+				if piece.Text != "" {
+					segments = append(segments, piece)
+				}
+				text, offsets = nil, nil
+			}
+			pos += n
+			continue
+		case segmentSpace:
+			n := len([]rune(s.Text))
+			lb := styleOf(pos)
+			s.BreakAfter = lb.WhiteSpace.Wrap && (breaks[pos+n] || lb.WhiteSpace.Collapse == "break-spaces")
+			pos += n
+		case segmentTab, segmentBreak, segmentAtomic:
+			pos++
+		}
+		segments = append(segments, f.segments[i])
+	}
+	f.segments = segments
+}
+
+// hyphenateWords adds the hyphenation opportunities of hyphens: auto to the
+// words of runes, using the dictionary for each word's language. Words that
+// contain soft hyphens are only broken at those.
+func (f *inlineFormatter) hyphenateWords(runes []rune, breaks, hyphens []bool, styleOf func(int) lineBreakStyle) {
+	for i := 0; i < len(runes); {
+		if !isHyphenatable(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		manual := false
+		for j < len(runes) && (isHyphenatable(runes[j]) || runes[j] == softHyphen) {
+			manual = manual || runes[j] == softHyphen
+			j++
+		}
+		lb := styleOf(i)
+		h := hyphenatorFor(lb.Lang)
+		if lb.Hyphens == "auto" && lb.WhiteSpace.Wrap && !manual && h != nil {
+			for _, p := range h.hyphenate(string(runes[i:j])) {
+				// Only hyphenate within text that itself allows it
+				if styleOf(i+p).Hyphens == "auto" && styleOf(i+p-1).Hyphens == "auto" {
+					breaks[i+p] = true
+					hyphens[i+p] = true
+				}
+			}
+		}
+		i = j
+	}
+}
+
+// isLetterOrNumber reports whether r is a letter, number or ideograph,
+// between which word-break adds or removes opportunities.
+func isLetterOrNumber(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// isLooseBreakBefore reports whether line-break: loose allows a break before
+// r after CJK text: iteration marks and CJK hyphens.
+func isLooseBreakBefore(r rune) bool {
+	switch r {
+	case 0x3005, 0x303B, 0x309D, 0x309E, 0x30FD, 0x30FE, // iteration marks
+		0x2010, 0x2013, 0x301C, 0x30A0: // hyphens
+		return true
+	}
+	return false
+}
+
+// splitOverflow breaks the text segment that overflows width, counting
+// from the start of the line at segment start, at the last grapheme
+// boundary that fits. It is used for overflow-wrap when a line has no
+// other opportunity, and reports whether a segment was split.
+func (f *inlineFormatter) splitOverflow(start, end int, width float64) bool {
+	x := 0.0
+	for i := start; i < end; i++ {
+		seg := f.segments[i]
+		if seg.Removed || (seg.Kind == segmentSpace && seg.Collapsible && x == 0) {
+			continue
+		}
+		if x+seg.Width <= width || seg.Kind != segmentText {
+			x += seg.Width
+			continue
+		}
+		if !seg.OverflowWrap || (f.sizing == minContentSize && !seg.Anywhere) {
+			return false
+		}
+		var gs segmenter.Segmenter
+		gs.Init([]rune(seg.Text))
+		var head []rune
+		for iter := gs.GraphemeIterator(); iter.Next(); {
+			g := iter.Grapheme().Text
+			// Keep at least one grapheme so the line makes progress
+			if len(head) > 0 && x+seg.Metrics.measure(string(head)+string(g)) > width {
+				break
+			}
+			head = append(head, g...)
+		}
+		if len(head) == len([]rune(seg.Text)) {
+			return false
+		}
+		rest := *seg
+		rest.Text = string([]rune(seg.Text)[len(head):])
+		rest.Offsets = seg.Offsets[len(head):]
+		rest.shape()
+		seg.Text = string(head)
+		seg.Offsets = seg.Offsets[:len(head)+1]
+		seg.shape()
+		seg.BreakAfter = true
+		seg.Hyphen = false
+		f.segments = append(f.segments[:i+1], append([]*inlineSegment{&rest}, f.segments[i+1:]...)...)
+		return true
+	}
+	return false
+}
+
+// hyphenWidth returns the width of the hyphen shown when a line breaks
+// after seg.
+func hyphenWidth(seg *inlineSegment) float64 {
+	if seg.Kind != segmentText || !seg.Hyphen {
+		return 0
+	}
+	return seg.Metrics.measure("-")
+}
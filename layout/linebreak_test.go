@@ -0,0 +1,52 @@
+package layout
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLineBreaking(t *testing.T) {
+	// Each character is 6px wide at a 10px font size
+	tests := []struct {
+		name  string
+		html  string
+		width int
+		want  []string
+	}{
+		{"CJK wraps between characters", "<p>日本語の文章です</p>", 30, []string{"日本語の文", "章です"}},
+		{"closing punctuation stays with its character", "<p>日本語の。文</p>", 24, []string{"日本語", "の。文"}},
+		{"words do not break", "<p>abcdefghij</p>", 30, []string{"abcdefghij"}},
+		{"break-all", "<p style='word-break: break-all'>abcdefghij</p>", 30, []string{"abcde", "fghij"}},
+		{"keep-all", "<p style='word-break: keep-all'>日本語 文章</p>", 24, []string{"日本語", "文章"}},
+		{"overflow-wrap anywhere", "<p style='overflow-wrap: anywhere'>aaaaaaaaaa bb</p>", 30, []string{"aaaaa", "aaaaa", "bb"}},
+		{"word-wrap break-word", "<p style='word-wrap: break-word'>aaaaaaa</p>", 30, []string{"aaaaa", "aa"}},
+		{"no break across elements", "<p>abc<b>def</b> gh</p>", 30, []string{"abcdef", "gh"}},
+		{"small kana may start a line", "<p>あいうぇ</p>", 18, []string{"あいう", "ぇ"}},
+		{"strict keeps small kana", "<p style='line-break: strict'>あいうぇ</p>", 18, []string{"あい", "うぇ"}},
+		{"line-break anywhere", "<p style='line-break: anywhere'>ab,cd</p>", 18, []string{"ab,", "cd"}},
+		{"soft hyphen", "<p>super&shy;califragilistic</p>", 60, []string{"super-", "califragilistic"}},
+		{"unused soft hyphen", "<p>super&shy;cali</p>", 60, []string{"supercali"}},
+		{"hyphens none", "<p style='hyphens: none'>super&shy;califragilistic</p>", 60, []string{"supercalifragilistic"}},
+		{"hyphens auto", "<p lang='en' style='hyphens: auto'>hyphenation</p>", 42, []string{"hyphen-", "ation"}},
+		{"hyphens auto without a language", "<p style='hyphens: auto'>hyphenation</p>", 42, []string{"hyphenation"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stylesheet := "body { margin: 0 } p { font-size: 10px; margin: 0; width: " + strconv.Itoa(tt.width) + "px }"
+			p := layoutHTML(t, "<body>"+tt.html+"</body>", stylesheet, "p", nil)
+			if got := lineTexts(p); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHyphenIsMeasured(t *testing.T) {
+	stylesheet := "body { margin: 0 } p { font-size: 10px; margin: 0; width: 60px }"
+	p := layoutHTML(t, "<body><p>super&shy;califragilistic</p></body>", stylesheet, "p", nil)
+	item := p.LineBoxes[0].InlineItems[0]
+	if item.Rect.Width != 36 {
+		t.Errorf("hyphenated width = %v, want 36", item.Rect.Width)
+	}
+}
@@ -0,0 +1,332 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements multi-column layout: column sizing, spanning
+// elements and the fragmentation of block and inline content across columns.
+// Reference: https://www.w3.org/TR/css-multicol-1/
+package layout
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// columnPiece is an unbreakable part of the content of a multi-column
+// container: a line box or a box that is not fragmented.
+type columnPiece struct {
+	top, bottom float64
+	box         *LayoutBox // a monolithic box
+	line        *LineBox   // or a line of inline content
+	column      int
+	dx, dy      float64 // how far the piece moved into its column
+}
+
+// columnSplit is a box whose content was broken into pieces, from first to
+// last.
+type columnSplit struct {
+	box         *LayoutBox
+	first, last int
+}
+
+// isMulticolContainer reports whether a block establishes a multi-column
+// formatting context.
+func (box *LayoutBox) isMulticolContainer() bool {
+	if box.Replaced != nil || (box.BoxType != BlockBox && box.BoxType != InlineBlockBox) {
+		return false
+	}
+	count, width := box.columnProperties()
+	return count > 0 || width > 0
+}
+
+// columnProperties returns the column-count and column-width of a box, zero
+// when auto, falling back to the columns shorthand.
+func (box *LayoutBox) columnProperties() (count int, width float64) {
+	style := box.ComputedStyle
+	if style == nil {
+		return 0, 0
+	}
+	for _, part := range strings.Fields(getText(style, "columns")) {
+		if n, err := strconv.Atoi(part); err == nil {
+			count = n
+		} else if w, ok := style.LengthPercentage(part, 0); ok && !strings.HasSuffix(part, "%") {
+			width = w
+		}
+	}
+	if val := style.GetPropertyValue("column-count"); val != nil && !val.IsInitial {
+		count = 0
+		if val.Keyword == "" && val.Value.Type == css.NumberValue {
+			count = int(val.Length)
+		}
+	}
+	if val := style.GetPropertyValue("column-width"); val != nil && !val.IsInitial {
+		width = 0
+		if isLength(val) {
+			width = val.Length
+		}
+	}
+	return max(count, 0), math.Max(width, 0)
+}
+
+// columnGap returns the gap between columns in a container of the given
+// width. normal is 1em.
+func (box *LayoutBox) columnGap(available float64) float64 {
+	if gap, ok := box.gap("column-gap", available); ok {
+		return gap
+	}
+	return getLength(box.ComputedStyle, "font-size")
+}
+
+// columnMetrics returns the number and width of the columns of a container
+// whose content box is the given width, and the gap between them.
+// Reference: https://www.w3.org/TR/css-multicol-1/#pseudo-algorithm
+func (box *LayoutBox) columnMetrics(available float64) (count int, width, gap float64) {
+	count, width = box.columnProperties()
+	gap = box.columnGap(available)
+	if width > 0 {
+		fit := max(1, int(math.Floor((available+gap)/(width+gap))))
+		if count == 0 || fit < count {
+			count = fit
+		}
+	}
+	count = max(count, 1)
+	width = math.Max(0, (available+gap)/float64(count)-gap)
+	return count, width, gap
+}
+
+// layoutMulticol lays out the content of a multi-column container. The
+// content between elements spanning all columns is laid out in a single
+// column, then broken into pieces that are distributed over the columns,
+// balanced unless column-fill is auto and the height is definite.
+func (box *LayoutBox) layoutMulticol(ctx *LayoutContext) {
+	d := &box.Dimensions
+	count, width, gap := box.columnMetrics(d.Content.Width)
+	box.Columns = nil
+
+	if box.establishesInlineContext() {
+		f := newInlineFormatter(box, ctx, layoutSize)
+		box.LineBoxes = f.layoutLines(width, d.Content.Y+d.Content.Height)
+		var pieces []*columnPiece
+		for _, line := range box.LineBoxes {
+			pieces = append(pieces, &columnPiece{top: line.Rect.Y, bottom: line.Rect.Y + line.Rect.Height, line: line})
+		}
+		box.fillColumns(pieces, nil, count, width, gap, true)
+		return
+	}
+
+	// Children are grouped into runs between spanners
+	var run []*LayoutBox
+	flush := func(last bool) {
+		if len(run) == 0 {
+			return
+		}
+		flow := Dimensions{Content: Rect{X: d.Content.X, Y: d.Content.Y + d.Content.Height, Width: width}}
+		ctx.PushContainingBlock(&flow)
+		for _, child := range run {
+			child.Layout(ctx)
+			flow.Content.Height += child.Dimensions.MarginBox().Height
+		}
+		ctx.PopContainingBlock()
+
+		var pieces []*columnPiece
+		var splits []columnSplit
+		for _, child := range run {
+			pieces, splits = collectColumnPieces(child, pieces, splits)
+		}
+		box.fillColumns(pieces, splits, count, width, gap, last)
+		run = nil
+	}
+	for _, child := range box.Children {
+		if getKeyword(child.ComputedStyle, "column-span") == "all" && isInFlow(child) && isBlockLevel(child) {
+			flush(false)
+			child.Layout(ctx)
+			d.Content.Height += child.Dimensions.MarginBox().Height
+			continue
+		}
+		run = append(run, child)
+	}
+	flush(true)
+}
+
+// collectColumnPieces appends the pieces a laid out box breaks into. Boxes
+// that cannot be fragmented are a single piece; the others contribute their
+// lines or the pieces of their children.
+func collectColumnPieces(box *LayoutBox, pieces []*columnPiece, splits []columnSplit) ([]*columnPiece, []columnSplit) {
+	first := len(pieces)
+	switch {
+	case box.isMonolithic():
+		margin := box.Dimensions.MarginBox()
+		return append(pieces, &columnPiece{top: margin.Y, bottom: margin.Y + margin.Height, box: box}), splits
+	case len(box.LineBoxes) > 0:
+		for _, line := range box.LineBoxes {
+			pieces = append(pieces, &columnPiece{top: line.Rect.Y, bottom: line.Rect.Y + line.Rect.Height, line: line})
+		}
+	default:
+		for _, child := range box.Children {
+			pieces, splits = collectColumnPieces(child, pieces, splits)
+		}
+	}
+	return pieces, append(splits, columnSplit{box: box, first: first, last: len(pieces) - 1})
+}
+
+// isMonolithic reports whether a box is kept whole in one column: replaced
+// and atomic boxes, scroll containers, nested multi-column containers,
+// boxes without content and those with break-inside: avoid.
+func (box *LayoutBox) isMonolithic() bool {
+	switch {
+	case box.Replaced != nil, box.BoxType != BlockBox && box.BoxType != AnonymousBlockBox:
+		return true
+	case box.Overflow != OverflowVisible, box.isMulticolContainer():
+		return true
+	case len(box.LineBoxes) == 0 && len(box.Children) == 0:
+		return true
+	}
+	switch getKeyword(box.ComputedStyle, "break-inside") {
+	case "avoid", "avoid-column":
+		return true
+	}
+	return false
+}
+
+// fillColumns distributes the pieces of a run of content over the columns
+// and grows the container by the height of the run. The last run may be
+// given the definite height of the container to fill instead.
+func (box *LayoutBox) fillColumns(pieces []*columnPiece, splits []columnSplit, count int, width, gap float64, last bool) {
+	d := &box.Dimensions
+	if len(pieces) == 0 {
+		return
+	}
+	top := d.Content.Y + d.Content.Height
+
+	// The content is balanced by finding the shortest columns it fits in
+	height := columnHeight(pieces, top, count)
+	if available, ok := box.definiteHeight(); ok && last {
+		available = math.Max(available-d.Content.Height, 0)
+		if getKeyword(box.ComputedStyle, "column-fill") == "auto" || height > available {
+			height = available
+		}
+	}
+	used := breakColumns(pieces, top, height)
+
+	rtl := getKeyword(box.inheritedStyle(), "direction") == "rtl"
+	columnX := func(c int) float64 {
+		if rtl {
+			return d.Content.X + d.Content.Width - width - float64(c)*(width+gap)
+		}
+		return d.Content.X + float64(c)*(width+gap)
+	}
+	moved := map[*LayoutBox]bool{}
+	var texts []*LayoutBox
+	for _, piece := range pieces {
+		piece.dx = columnX(piece.column) - d.Content.X
+		if piece.box != nil {
+			translateBox(piece.box, piece.dx, piece.dy)
+			continue
+		}
+		texts = piece.moveLine(moved, texts)
+	}
+	// Text boxes cover their fragments, wherever they went
+	for _, text := range texts {
+		text.Dimensions.Content = text.Fragments[0].Rect
+		for _, item := range text.Fragments[1:] {
+			text.Dimensions.Content = unionRect(text.Dimensions.Content, item.Rect, false)
+		}
+	}
+	// A fragmented box keeps the position and height of its first fragment
+	for _, split := range splits {
+		if split.last < split.first {
+			continue
+		}
+		first := pieces[split.first]
+		content := &split.box.Dimensions.Content
+		content.X += first.dx
+		content.Y += first.dy
+		end := split.first
+		for end < split.last && pieces[end+1].column == first.column {
+			end++
+		}
+		if end < split.last {
+			content.Height = math.Max(pieces[end].bottom+first.dy-content.Y, 0)
+		}
+	}
+
+	runHeight := 0.0
+	for c, h := range used {
+		runHeight = math.Max(runHeight, h)
+		box.Columns = append(box.Columns, Rect{X: columnX(c), Y: top, Width: width})
+	}
+	for i := len(box.Columns) - len(used); i < len(box.Columns); i++ {
+		box.Columns[i].Height = runHeight
+	}
+	d.Content.Height += runHeight
+}
+
+// moveLine moves a line piece into its column, along with the atomic
+// inlines on it and the inline boxes that start on it, and collects the
+// text boxes it holds.
+func (piece *columnPiece) moveLine(moved map[*LayoutBox]bool, texts []*LayoutBox) []*LayoutBox {
+	line, dx, dy := piece.line, piece.dx, piece.dy
+	line.Rect.X += dx
+	line.Rect.Y += dy
+	line.Baseline += dy
+	for _, item := range line.InlineItems {
+		item.Rect.X += dx
+		item.Rect.Y += dy
+		box := item.LayoutBox
+		if box.TextContent == "" {
+			translateBox(box, dx, dy)
+		} else if !moved[box] {
+			moved[box] = true
+			texts = append(texts, box)
+		}
+		for parent := box.Parent; parent != nil && parent.BoxType == InlineBox && parent.Replaced == nil; parent = parent.Parent {
+			if !moved[parent] {
+				moved[parent] = true
+				parent.Dimensions.Content.X += dx
+				parent.Dimensions.Content.Y += dy
+			}
+		}
+	}
+	return texts
+}
+
+// columnHeight returns the smallest column height at which the pieces fit
+// in the given number of columns.
+func columnHeight(pieces []*columnPiece, top float64, count int) float64 {
+	low, high := 0.0, pieces[len(pieces)-1].bottom-top
+	for high-low > 0.01 {
+		mid := (low + high) / 2
+		if len(breakColumns(pieces, top, mid)) <= count {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	// Settle on the height the content actually takes
+	height := 0.0
+	for _, h := range breakColumns(pieces, top, high) {
+		height = math.Max(height, h)
+	}
+	return height
+}
+
+// breakColumns assigns the pieces to columns of the given height, starting
+// a new column before a piece that does not fit, and returns the height of
+// the content in each column. Each piece records how far it moves up into
+// its column, whose content starts at top.
+func breakColumns(pieces []*columnPiece, top, height float64) []float64 {
+	var used []float64
+	start := top
+	for i, piece := range pieces {
+		if i == 0 {
+			used = append(used, 0)
+		} else if piece.bottom-start > height+1e-9 && used[len(used)-1] > 0 {
+			used = append(used, 0)
+			start = piece.top
+		}
+		piece.column = len(used) - 1
+		piece.dy = top - start
+		used[len(used)-1] = math.Max(used[len(used)-1], piece.bottom-start)
+	}
+	return used
+}
@@ -0,0 +1,153 @@
+package layout
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestColumnMetrics(t *testing.T) {
+	stylesheet := "body { margin: 0 } section { width: 400px; font-size: 10px }"
+	tests := []struct {
+		style string
+		count int
+		width float64
+	}{
+		{"column-count: 2; column-gap: 10px", 2, 195},
+		{"column-width: 100px; column-gap: 0", 4, 100},
+		{"column-width: 150px; column-gap: 20px", 2, 190},
+		{"column-count: 3; column-width: 200px; column-gap: 0", 2, 200},
+		{"columns: 2", 2, 195},
+		{"columns: 3 100px; column-count: 2; column-gap: 5%", 2, 190},
+		{"columns: 6.25rem; column-gap: 0", 4, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			section := layoutHTML(t, "<body><section style='"+tt.style+"'>a</section></body>", stylesheet, "section", nil)
+			count, width, _ := section.columnMetrics(section.Dimensions.Content.Width)
+			if count != tt.count || width != tt.width {
+				t.Errorf("columns = %d of %v, want %d of %v", count, width, tt.count, tt.width)
+			}
+		})
+	}
+}
+
+func TestMulticolBalancesLines(t *testing.T) {
+	// Five 12px lines balance as three and two in columns 190px wide
+	stylesheet := "body { margin: 0 } section { width: 400px; font-size: 10px; column-count: 2; column-gap: 20px }"
+	section := layoutHTML(t, "<body><section>a<br>b<br>c<br>d<br>e</section></body>", stylesheet, "section", nil)
+	content := section.Dimensions.Content
+	if content.Height != 36 {
+		t.Errorf("height = %v, want 36", content.Height)
+	}
+	lines := section.LineBoxes
+	if len(lines) != 5 {
+		t.Fatalf("lines = %d, want 5", len(lines))
+	}
+	for i, want := range []Rect{
+		{X: 0, Y: 0, Width: 190}, {X: 0, Y: 12, Width: 190}, {X: 0, Y: 24, Width: 190},
+		{X: 210, Y: 0, Width: 190}, {X: 210, Y: 12, Width: 190},
+	} {
+		got := lines[i].Rect
+		if got.X != content.X+want.X || got.Y != content.Y+want.Y || got.Width != want.Width {
+			t.Errorf("line %d at %v, want %v", i, got, want)
+		}
+	}
+	if item := lines[3].InlineItems[0]; item.Rect.X != content.X+210 || item.Rect.Y >= content.Y+12 {
+		t.Errorf("%q at %v", item.Text, item.Rect)
+	}
+	if len(section.Columns) != 2 || section.Columns[1].X != content.X+210 || section.Columns[1].Height != 36 {
+		t.Errorf("columns = %v", section.Columns)
+	}
+}
+
+func TestMulticolFragmentsBlocks(t *testing.T) {
+	// A paragraph of four lines and a 24px block balance at 36px: the last
+	// line of the paragraph goes into the second column, above the block
+	stylesheet := "body { margin: 0 } section { width: 400px; font-size: 10px; column-count: 2; column-gap: 20px } p { margin-top: 0; margin-bottom: 0 } div { height: 24px }"
+	html := "<body><section><p%s>a<br>b<br>c<br>d</p><div></div></section></body>"
+	section := layoutHTML(t, fmt.Sprintf(html, ""), stylesheet, "section", nil)
+	content := section.Dimensions.Content
+	p, div := findBox(section, "p"), findBox(section, "div")
+	if content.Height != 36 {
+		t.Errorf("height = %v, want 36", content.Height)
+	}
+	if p.Dimensions.Content.Height != 36 {
+		t.Errorf("first fragment of p is %v high, want 36", p.Dimensions.Content.Height)
+	}
+	if line := p.LineBoxes[3].Rect; line.X != content.X+210 || line.Y != content.Y {
+		t.Errorf("last line at %v", line)
+	}
+	if got := div.Dimensions.Content; got.X != content.X+210 || got.Y != content.Y+12 || got.Width != 190 {
+		t.Errorf("div at %v", got)
+	}
+
+	// The paragraph is kept whole when it avoids breaks
+	section = layoutHTML(t, fmt.Sprintf(html, " style='break-inside: avoid'"), stylesheet, "section", nil)
+	content = section.Dimensions.Content
+	p, div = findBox(section, "p"), findBox(section, "div")
+	if content.Height != 48 {
+		t.Errorf("height = %v, want 48", content.Height)
+	}
+	if p.LineBoxes[3].Rect.X != content.X {
+		t.Errorf("last line at %v", p.LineBoxes[3].Rect)
+	}
+	if got := div.Dimensions.Content; got.X != content.X+210 || got.Y != content.Y {
+		t.Errorf("div at %v", got)
+	}
+}
+
+func TestMulticolSpanner(t *testing.T) {
+	stylesheet := "body { margin: 0 } section { width: 400px; column-count: 2; column-gap: 0 } div { height: 20px } h2 { column-span: all; height: 10px; margin-top: 0; margin-bottom: 0 }"
+	section := layoutHTML(t, "<body><section><div id=a></div><div id=b></div><h2></h2><div id=c></div><div id=d></div></section></body>", stylesheet, "section", nil)
+	content := section.Dimensions.Content
+	if content.Height != 50 {
+		t.Errorf("height = %v, want 50", content.Height)
+	}
+	h2 := findBox(section, "h2").Dimensions.Content
+	if h2.Y != content.Y+20 || h2.Width != 400 {
+		t.Errorf("spanner at %v", h2)
+	}
+	var divs []Rect
+	for _, child := range section.Children {
+		if child.Element != nil && child.Element.LocalName() == "div" {
+			divs = append(divs, child.Dimensions.Content)
+		}
+	}
+	for i, want := range []Rect{{X: 0, Y: 0}, {X: 200, Y: 0}, {X: 0, Y: 30}, {X: 200, Y: 30}} {
+		if divs[i].X != content.X+want.X || divs[i].Y != content.Y+want.Y || divs[i].Width != 200 {
+			t.Errorf("div %d at %v, want %v", i, divs[i], want)
+		}
+	}
+	if len(section.Columns) != 4 || section.Columns[2].Y != content.Y+30 {
+		t.Errorf("columns = %v", section.Columns)
+	}
+}
+
+func TestColumnFill(t *testing.T) {
+	stylesheet := "body { margin: 0 } section { width: 400px; height: 60px; column-count: 2; column-gap: 0 } div { height: 20px }"
+	html := "<body><section style='%s'><div></div><div></div><div></div></section></body>"
+	tests := []struct {
+		fill    string
+		columns int
+		last    Rect
+	}{
+		{"column-fill: balance", 2, Rect{X: 200, Y: 0}},
+		{"column-fill: auto", 1, Rect{X: 0, Y: 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fill, func(t *testing.T) {
+			section := layoutHTML(t, fmt.Sprintf(html, tt.fill), stylesheet, "section", nil)
+			content := section.Dimensions.Content
+			if content.Height != 60 {
+				t.Errorf("height = %v, want 60", content.Height)
+			}
+			if len(section.Columns) != tt.columns {
+				t.Errorf("columns = %v, want %d", section.Columns, tt.columns)
+			}
+			last := section.Children[len(section.Children)-1].Dimensions.Content
+			if last.X != content.X+tt.last.X || last.Y != content.Y+tt.last.Y {
+				t.Errorf("last div at %v, want %v", last, tt.last)
+			}
+		})
+	}
+}
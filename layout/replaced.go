@@ -0,0 +1,360 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements the sizing of replaced elements: inline SVG and
+// images.
+// Reference: https://www.w3.org/TR/CSS21/visudet.html#inline-replaced-width
+package layout
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// Default size of a replaced element without intrinsic dimensions.
+const (
+	defaultReplacedWidth  = 300
+	defaultReplacedHeight = 150
+)
+
+// ReplacedContent is the content of a replaced element. Layout sizes the
+// element as an opaque box; the content itself is painted by the renderer.
+type ReplacedContent struct {
+	// Root is the root element of the content: the <svg> element itself for
+	// inline SVG, or the document element of an SVG image. It is nil when
+	// the content could not be loaded.
+	Root *dom.Element
+
+	// Styles holds the computed style of each element in the content tree.
+	Styles map[*dom.Element]*css.ComputedStyle
+
+	// InstanceStyles holds, for each <use> element, the computed styles of
+	// the elements it instantiates, which inherit from the <use> element.
+	InstanceStyles map[*dom.Element]map[*dom.Element]*css.ComputedStyle
+
+	// Intrinsic dimensions, zero when the content has none in that axis.
+	IntrinsicWidth  float64
+	IntrinsicHeight float64
+
+	// IntrinsicRatio is width divided by height, or zero if there is none.
+	IntrinsicRatio float64
+}
+
+// ImageLoader loads the document behind an image source URL. Only SVG
+// images are supported; it returns nil for anything it cannot load.
+type ImageLoader func(src string) *dom.Document
+
+// isSVGElement reports whether an element is an SVG element with the given local name.
+func isSVGElement(el *dom.Element, localName string) bool {
+	return el != nil && el.NamespaceURI() == dom.SVGNamespace && el.LocalName() == localName
+}
+
+// buildReplacedContent returns the replaced content of an <svg> or <img>
+// element, or nil if the element is not replaced.
+func buildReplacedContent(element *dom.Element, style *css.ComputedStyle, styleResolver *css.StyleResolver, ctx *LayoutContext) *ReplacedContent {
+	if isSVGElement(element, "svg") {
+		return newSVGContent(element, style, styleResolver)
+	}
+	if element.NamespaceURI() != dom.HTMLNamespace || element.LocalName() != "img" {
+		return nil
+	}
+
+	content := &ReplacedContent{}
+	if src := element.GetAttribute("src"); src != "" && ctx.ImageLoader != nil {
+		if doc := ctx.ImageLoader(src); doc != nil && isSVGElement(doc.DocumentElement(), "svg") {
+			// Images are isolated from the embedding document's styles
+			root := doc.DocumentElement()
+			resolver := css.NewStyleResolver()
+			content = newSVGContent(root, resolver.ResolveStyles(root, nil), resolver)
+		}
+	}
+	return content
+}
+
+// newSVGContent resolves the styles of an SVG subtree and its intrinsic size.
+// Reference: https://www.w3.org/TR/SVG2/coords.html#SizingSVGInCSS
+func newSVGContent(root *dom.Element, style *css.ComputedStyle, styleResolver *css.StyleResolver) *ReplacedContent {
+	content := &ReplacedContent{
+		Root:           root,
+		Styles:         map[*dom.Element]*css.ComputedStyle{root: style},
+		InstanceStyles: map[*dom.Element]map[*dom.Element]*css.ComputedStyle{},
+	}
+	content.resolveSVGStyles(root, style, styleResolver, content.Styles, 0)
+
+	fontSize := getLength(style, "font-size")
+	w, hasW := parseSVGLength(root.GetAttribute("width"), fontSize)
+	h, hasH := parseSVGLength(root.GetAttribute("height"), fontSize)
+	if hasW {
+		content.IntrinsicWidth = w
+	}
+	if hasH {
+		content.IntrinsicHeight = h
+	}
+	if viewBox, ok := ParseViewBox(root.GetAttribute("viewBox")); ok {
+		content.IntrinsicRatio = viewBox.Width / viewBox.Height
+	} else if hasW && hasH && h > 0 {
+		content.IntrinsicRatio = w / h
+	}
+	return content
+}
+
+// maxUseDepth limits how deeply <use> elements may instantiate each other.
+const maxUseDepth = 8
+
+// resolveSVGStyles computes the style of every descendant element of an SVG
+// subtree, including the trees instantiated by <use> elements.
+func (content *ReplacedContent) resolveSVGStyles(el *dom.Element, style *css.ComputedStyle, styleResolver *css.StyleResolver, styles map[*dom.Element]*css.ComputedStyle, depth int) {
+	if isSVGElement(el, "use") && depth < maxUseDepth {
+		if target := ResolveSVGReference(el, SVGHref(el)); target != nil {
+			instance := map[*dom.Element]*css.ComputedStyle{}
+			targetStyle := styleResolver.ResolveStyles(target, style)
+			instance[target] = targetStyle
+			content.resolveSVGStyles(target, targetStyle, styleResolver, instance, depth+1)
+			content.InstanceStyles[el] = instance
+		}
+	}
+	for child := el.FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		childStyle := styleResolver.ResolveStyles(child, style)
+		styles[child] = childStyle
+		content.resolveSVGStyles(child, childStyle, styleResolver, styles, depth)
+	}
+}
+
+// SVGHref returns the href of an SVG element, falling back to xlink:href.
+func SVGHref(el *dom.Element) string {
+	if el.HasAttribute("href") {
+		return el.GetAttribute("href")
+	}
+	if href := el.GetAttributeNS(xlinkNamespace, "href"); href != "" {
+		return href
+	}
+	return el.GetAttribute("xlink:href")
+}
+
+// xlinkNamespace is the XLink namespace used by legacy SVG href attributes.
+const xlinkNamespace = "http://www.w3.org/1999/xlink"
+
+// ResolveSVGReference resolves a same-document reference such as "#id" or
+// "url(#id)" to the element it names, searching the tree that contains from.
+func ResolveSVGReference(from *dom.Element, ref string) *dom.Element {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "url(") && strings.HasSuffix(ref, ")") {
+		ref = strings.Trim(strings.TrimSpace(ref[4:len(ref)-1]), `"'`)
+	}
+	if !strings.HasPrefix(ref, "#") || len(ref) == 1 {
+		return nil
+	}
+	id := ref[1:]
+	top := from.AsNode()
+	for parent := top.ParentNode(); parent != nil && parent.NodeType() == dom.ElementNode; parent = parent.ParentNode() {
+		top = parent
+	}
+	return findElementByID((*dom.Element)(top), id)
+}
+
+// findElementByID returns the first element in tree order with the given id.
+func findElementByID(el *dom.Element, id string) *dom.Element {
+	if el.GetAttribute("id") == id {
+		return el
+	}
+	for child := el.FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if found := findElementByID(child, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// parseSVGLength parses an absolute SVG length attribute such as "24" or
+// "2em". Percentages and invalid values report false.
+func parseSVGLength(value string, fontSize float64) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasSuffix(value, "%") {
+		return 0, false
+	}
+	units := map[string]float64{"px": 1, "em": fontSize, "pt": 4.0 / 3, "pc": 16, "in": 96, "cm": 96 / 2.54, "mm": 96 / 25.4}
+	scale := 1.0
+	for unit, factor := range units {
+		if strings.HasSuffix(value, unit) {
+			value = strings.TrimSuffix(value, unit)
+			scale = factor
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n * scale, true
+}
+
+// ParseViewBox parses a viewBox attribute. A viewBox with a non-positive
+// width or height is invalid.
+func ParseViewBox(value string) (Rect, bool) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) != 4 {
+		return Rect{}, false
+	}
+	var v [4]float64
+	for i, f := range fields {
+		n, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return Rect{}, false
+		}
+		v[i] = n
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return Rect{}, false
+	}
+	return Rect{X: v[0], Y: v[1], Width: v[2], Height: v[3]}, true
+}
+
+// layoutReplaced lays out a replaced element, block-level or inline.
+func (box *LayoutBox) layoutReplaced(ctx *LayoutContext, containingBlock *Dimensions) {
+	style := box.ComputedStyle
+	d := &box.Dimensions
+	d.Padding = EdgeSizes{
+		Top:    getLength(style, "padding-top"),
+		Right:  getLength(style, "padding-right"),
+		Bottom: getLength(style, "padding-bottom"),
+		Left:   getLength(style, "padding-left"),
+	}
+	d.Border = EdgeSizes{
+		Top:    getBorderWidth(style, "border-top-width"),
+		Right:  getBorderWidth(style, "border-right-width"),
+		Bottom: getBorderWidth(style, "border-bottom-width"),
+		Left:   getBorderWidth(style, "border-left-width"),
+	}
+	d.Margin = EdgeSizes{
+		Top:    getLength(style, "margin-top"),
+		Right:  getLength(style, "margin-right"),
+		Bottom: getLength(style, "margin-bottom"),
+		Left:   getLength(style, "margin-left"),
+	}
+	d.Content.Width, d.Content.Height = box.replacedContentSize(containingBlock)
+
+	// Block-level replaced elements center with auto margins
+	if box.BoxType == BlockBox && getKeyword(style, "margin-left") == "auto" && getKeyword(style, "margin-right") == "auto" {
+		underflow := containingBlock.Content.Width - d.MarginBox().Width
+		if underflow > 0 {
+			d.Margin.Left, d.Margin.Right = underflow/2, underflow/2
+		}
+	}
+
+	d.Content.X = containingBlock.Content.X + d.Margin.Left + d.Border.Left + d.Padding.Left
+	d.Content.Y = containingBlock.Content.Y + containingBlock.Content.Height +
+		d.Margin.Top + d.Border.Top + d.Padding.Top
+
+	if box.Position == PositionRelative {
+		box.applyRelativePosition()
+	}
+}
+
+// replacedContentSize computes the used content width and height of a
+// replaced element from its specified size, intrinsic size and ratio.
+// Reference: https://www.w3.org/TR/CSS21/visudet.html#inline-replaced-height
+func (box *LayoutBox) replacedContentSize(containingBlock *Dimensions) (float64, float64) {
+	content := box.Replaced
+	width, hasWidth := box.specifiedReplacedLength("width")
+	height, hasHeight := box.specifiedReplacedLength("height")
+	ratio := content.IntrinsicRatio
+	// aspect-ratio overrides the natural ratio, unless it is auto and the
+	// content has one
+	preferred, auto := aspectRatio(box.ComputedStyle)
+	overridden := preferred > 0 && (!auto || ratio == 0)
+	if overridden {
+		ratio = preferred
+	}
+
+	switch {
+	case hasWidth && hasHeight:
+	case hasWidth:
+		switch {
+		case ratio > 0:
+			height = width / ratio
+		case content.IntrinsicHeight > 0:
+			height = content.IntrinsicHeight
+		default:
+			height = defaultReplacedHeight
+		}
+	case hasHeight:
+		switch {
+		case ratio > 0:
+			width = height * ratio
+		case content.IntrinsicWidth > 0:
+			width = content.IntrinsicWidth
+		default:
+			width = defaultReplacedWidth
+		}
+	case content.IntrinsicWidth > 0 && content.IntrinsicHeight > 0:
+		width, height = content.IntrinsicWidth, content.IntrinsicHeight
+		if overridden {
+			height = width / ratio
+		}
+	case content.IntrinsicWidth > 0 && ratio > 0:
+		width = content.IntrinsicWidth
+		height = width / ratio
+	case content.IntrinsicHeight > 0 && ratio > 0:
+		height = content.IntrinsicHeight
+		width = height * ratio
+	case ratio > 0:
+		// Only a ratio: fill the containing block's width
+		width = containingBlock.Content.Width - box.Dimensions.MarginBox().Width
+		height = width / ratio
+	default:
+		width, height = content.IntrinsicWidth, content.IntrinsicHeight
+		if width == 0 {
+			width = defaultReplacedWidth
+		}
+		if height == 0 {
+			height = defaultReplacedHeight
+		}
+	}
+
+	style := box.ComputedStyle
+	if minWidth := getLength(style, "min-width"); width < minWidth {
+		width = minWidth
+	}
+	if kw := getKeyword(style, "max-width"); kw != "none" && kw != "" {
+		if maxWidth := getLength(style, "max-width"); width > maxWidth {
+			width = maxWidth
+		}
+	}
+	if minHeight := getLength(style, "min-height"); height < minHeight {
+		height = minHeight
+	}
+	if kw := getKeyword(style, "max-height"); kw != "none" && kw != "" {
+		if maxHeight := getLength(style, "max-height"); height > maxHeight {
+			height = maxHeight
+		}
+	}
+	return width, height
+}
+
+// specifiedReplacedLength returns the content-box width or height set in CSS,
+// if it is not auto. The width and height attributes of <img> act as
+// presentational hints for the same properties.
+func (box *LayoutBox) specifiedReplacedLength(property string) (float64, bool) {
+	style := box.ComputedStyle
+	val := style.GetPropertyValue(property)
+	if val == nil || val.Keyword == "auto" || (val.Keyword == "" && val.Length == 0 && val.Value.Raw == "") {
+		if el := box.Element; el != nil && el.NamespaceURI() == dom.HTMLNamespace && el.LocalName() == "img" {
+			return parseSVGLength(el.GetAttribute(property), getLength(style, "font-size"))
+		}
+		return 0, false
+	}
+	length := val.Length
+	if box.BoxSizing == BoxSizingBorderBox {
+		d := box.Dimensions
+		if property == "width" {
+			length -= d.Padding.Left + d.Padding.Right + d.Border.Left + d.Border.Right
+		} else {
+			length -= d.Padding.Top + d.Padding.Bottom + d.Border.Top + d.Border.Bottom
+		}
+	}
+	return math.Max(length, 0), true
+}
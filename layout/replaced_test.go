@@ -0,0 +1,161 @@
+package layout
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+)
+
+// layoutHTML parses a document, lays it out in an 800x600 viewport and
+// returns the box of the first element with the given tag name.
+func layoutHTML(t *testing.T, source, stylesheet, tagName string, loader ImageLoader) *LayoutBox {
+	t.Helper()
+	doc, err := dom.ParseHTML(source)
+	if err != nil {
+		t.Fatalf("ParseHTML: %v", err)
+	}
+	resolver := css.NewStyleResolver()
+	resolver.SetUserAgentStylesheet(css.GetUserAgentStylesheet())
+	if stylesheet != "" {
+		resolver.AddAuthorStylesheet(css.NewParser(stylesheet).Parse())
+	}
+	ctx := NewLayoutContext(800, 600)
+	ctx.ImageLoader = loader
+	root := BuildLayoutTree(doc.DocumentElement(), resolver, ctx)
+	root.Layout(ctx)
+	return findBox(root, tagName)
+}
+
+func findBox(box *LayoutBox, tagName string) *LayoutBox {
+	if box.Element != nil && box.Element.LocalName() == tagName {
+		return box
+	}
+	for _, child := range box.Children {
+		if found := findBox(child, tagName); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestReplacedSVGSizing(t *testing.T) {
+	tests := []struct {
+		name          string
+		svg           string
+		stylesheet    string
+		width, height float64
+	}{
+		{"attributes", `<svg width="24" height="16"></svg>`, "", 24, 16},
+		{"no size", `<svg></svg>`, "", 300, 150},
+		{"css width with ratio", `<svg viewBox="0 0 24 12"></svg>`, "svg { width: 48px }", 48, 24},
+		{"css height with ratio", `<svg viewBox="0 0 24 12" width="10" height="10"></svg>`, "svg { height: 36px }", 72, 36},
+		{"em units", `<svg width="2em" height="1em"></svg>`, "body { font-size: 10px }", 20, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box := layoutHTML(t, "<body style='margin:0'>"+tt.svg+"</body>", tt.stylesheet, "svg", nil)
+			if box == nil || box.Replaced == nil {
+				t.Fatal("svg should be a replaced box")
+			}
+			if len(box.Children) != 0 {
+				t.Errorf("replaced box has %d children, want none", len(box.Children))
+			}
+			got := box.Dimensions.Content
+			if got.Width != tt.width || got.Height != tt.height {
+				t.Errorf("size = %vx%v, want %vx%v", got.Width, got.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestReplacedSVGRatioOnly(t *testing.T) {
+	// Without a size, an SVG with only a viewBox fills its containing block
+	box := layoutHTML(t, `<body><svg viewBox="0 0 4 1"></svg></body>`, "svg { display: block }", "svg", nil)
+	available := box.Parent.Dimensions.Content.Width - box.Dimensions.MarginBox().Width + box.Dimensions.Content.Width
+	if got := box.Dimensions.Content; got.Width != available || got.Height != available/4 {
+		t.Errorf("size = %vx%v, want %vx%v", got.Width, got.Height, available, available/4)
+	}
+}
+
+func TestReplacedSVGStyles(t *testing.T) {
+	box := layoutHTML(t, `<body><svg style="color: red"><g fill="blue"><path class="icon" d="M0 0"/></g>
+		<use href="#dot"/></svg><svg><circle id="dot" r="2"/></svg></body>`,
+		".icon { stroke: currentColor }", "svg", nil)
+	content := box.Replaced
+	path := content.Root.QuerySelector("path")
+	style := content.Styles[path]
+	if style == nil {
+		t.Fatal("missing style for <path>")
+	}
+	if got := style.GetComputedStyleProperty("fill"); got != "blue" {
+		t.Errorf("fill = %q, want inherited presentation attribute blue", got)
+	}
+	if got := style.GetComputedStyleProperty("stroke"); got != "currentColor" {
+		t.Errorf("stroke = %q, want author rule value", got)
+	}
+
+	use := content.Root.QuerySelector("use")
+	instance := content.InstanceStyles[use]
+	if len(instance) != 1 {
+		t.Fatalf("use instance has %d styles, want 1", len(instance))
+	}
+}
+
+func TestReplacedImageSVG(t *testing.T) {
+	loader := func(src string) *dom.Document {
+		if src != "icon.svg" {
+			return nil
+		}
+		doc, _ := dom.ParseXML(`<svg xmlns="http://www.w3.org/2000/svg" width="32" height="16"><rect width="32" height="16"/></svg>`)
+		return doc
+	}
+
+	box := layoutHTML(t, `<body><img src="icon.svg"></body>`, "", "img", loader)
+	if box == nil || box.Replaced == nil || box.Replaced.Root == nil {
+		t.Fatal("img should hold the loaded SVG")
+	}
+	if got := box.Dimensions.Content; got.Width != 32 || got.Height != 16 {
+		t.Errorf("size = %vx%v, want 32x16", got.Width, got.Height)
+	}
+
+	box = layoutHTML(t, `<body><img src="icon.svg" width="64"></body>`, "", "img", loader)
+	if got := box.Dimensions.Content; got.Width != 64 || got.Height != 32 {
+		t.Errorf("size with width attribute = %vx%v, want 64x32", got.Width, got.Height)
+	}
+
+	box = layoutHTML(t, `<body><img src="photo.png" width="10" height="20"></body>`, "", "img", loader)
+	if box.Replaced.Root != nil {
+		t.Error("unsupported image should have no content")
+	}
+	if got := box.Dimensions.Content; got.Width != 10 || got.Height != 20 {
+		t.Errorf("size of unloaded image = %vx%v, want 10x20", got.Width, got.Height)
+	}
+}
+
+func TestParseViewBox(t *testing.T) {
+	if r, ok := ParseViewBox("0,0 24 12"); !ok || r.Width != 24 || r.Height != 12 {
+		t.Errorf("ParseViewBox = %+v, %v", r, ok)
+	}
+	for _, invalid := range []string{"", "0 0 24", "0 0 0 10", "a b c d"} {
+		if _, ok := ParseViewBox(invalid); ok {
+			t.Errorf("ParseViewBox(%q) should be invalid", invalid)
+		}
+	}
+}
+
+func TestResolveSVGReference(t *testing.T) {
+	doc, _ := dom.ParseHTML(`<body><svg><use xlink:href="#a"/><use href="url(#b)"/></svg><svg><g id="a"/><g id="b"/></svg></body>`)
+	uses := doc.GetElementsByTagName("use")
+	first := uses.Item(0)
+	if got := ResolveSVGReference(first, SVGHref(first)); got == nil || got.Id() != "a" {
+		t.Errorf("xlink:href reference = %v, want #a", got)
+	}
+	second := uses.Item(1)
+	if got := ResolveSVGReference(second, SVGHref(second)); got == nil || got.Id() != "b" {
+		t.Errorf("url() reference = %v, want #b", got)
+	}
+	if got := ResolveSVGReference(second, "#missing"); got != nil {
+		t.Errorf("missing reference = %v, want nil", got)
+	}
+}
@@ -0,0 +1,486 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements white space processing and text-level properties.
+// Reference: https://www.w3.org/TR/css-text-3/
+package layout
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/font"
+)
+
+// WhiteSpace holds the white space handling of a run of text, combining the
+// white-space shorthand with its white-space-collapse and text-wrap-mode
+// longhands.
+type WhiteSpace struct {
+	// Collapse is one of collapse, preserve, preserve-breaks,
+	// preserve-spaces or break-spaces.
+	Collapse string
+	// Wrap reports whether lines may wrap at soft wrap opportunities.
+	Wrap bool
+}
+
+// collapsesSpaces reports whether sequences of spaces and tabs collapse.
+func (ws WhiteSpace) collapsesSpaces() bool {
+	return ws.Collapse == "collapse" || ws.Collapse == "preserve-breaks"
+}
+
+// preservesBreaks reports whether segment breaks are forced line breaks.
+func (ws WhiteSpace) preservesBreaks() bool {
+	return ws.Collapse != "collapse" && ws.Collapse != "preserve-spaces"
+}
+
+// ResolveWhiteSpace returns the white space handling of a computed style.
+// A longhand set on the element or inherited takes precedence over the
+// shorthand.
+func ResolveWhiteSpace(style *css.ComputedStyle) WhiteSpace {
+	ws := WhiteSpace{Collapse: "collapse", Wrap: true}
+	for _, keyword := range strings.Fields(getText(style, "white-space")) {
+		switch keyword {
+		case "pre":
+			ws = WhiteSpace{Collapse: "preserve", Wrap: false}
+		case "nowrap":
+			ws.Wrap = false
+		case "pre-wrap":
+			ws = WhiteSpace{Collapse: "preserve", Wrap: true}
+		case "break-spaces":
+			ws = WhiteSpace{Collapse: "break-spaces", Wrap: true}
+		case "pre-line":
+			ws = WhiteSpace{Collapse: "preserve-breaks", Wrap: true}
+		case "collapse", "preserve", "preserve-breaks", "preserve-spaces":
+			ws.Collapse = keyword
+		case "wrap":
+			ws.Wrap = true
+		}
+	}
+	if val := style.GetPropertyValue("white-space-collapse"); val != nil && !val.IsInitial {
+		switch val.Keyword {
+		case "collapse", "preserve", "preserve-breaks", "preserve-spaces", "break-spaces":
+			ws.Collapse = val.Keyword
+		}
+	}
+	// text-wrap-mode, or the text-wrap shorthand that includes it
+	for _, property := range []string{"text-wrap-mode", "text-wrap"} {
+		if val := style.GetPropertyValue(property); val == nil || val.IsInitial {
+			continue
+		}
+		for _, keyword := range strings.Fields(getText(style, property)) {
+			switch keyword {
+			case "nowrap":
+				ws.Wrap = false
+			case "wrap", "balance", "pretty", "stable":
+				ws.Wrap = true
+			}
+		}
+		break
+	}
+	return ws
+}
+
+// getText returns the keyword of a property, or its raw text for values with
+// several components.
+func getText(style *css.ComputedStyle, property string) string {
+	if style == nil {
+		return ""
+	}
+	val := style.GetPropertyValue(property)
+	if val == nil {
+		return ""
+	}
+	if val.Keyword != "" {
+		return val.Keyword
+	}
+	return val.Value.Raw
+}
+
+// collapseState carries white space processing across the text runs of an
+// inline formatting context, since collapsing continues across element
+// boundaries.
+type collapseState struct {
+	// spaceBefore is true after a collapsible space.
+	spaceBefore bool
+	// last is the last character kept, used by text-transform: capitalize
+	// and the segment break transformation.
+	last rune
+}
+
+// processWhiteSpace applies phase I of white space processing to a text run:
+// it collapses spaces and transforms segment breaks according to ws.
+// Segment breaks that are preserved are kept as '\n' and preserved tabs as
+// '\t'. Leading and trailing spaces of lines are removed during line layout.
+// Reference: https://www.w3.org/TR/css-text-3/#white-space-phase-1
+func processWhiteSpace(text string, ws WhiteSpace, state *collapseState) string {
+	processed, _ := processWhiteSpaceOffsets(text, ws, state)
+	return processed
+}
+
+// processWhiteSpaceOffsets is processWhiteSpace that also returns, for each
+// character of the result, its offset in UTF-16 code units in text, the
+// offsets the DOM uses for text positions.
+func processWhiteSpaceOffsets(text string, ws WhiteSpace, state *collapseState) (string, []int) {
+	var runes []rune
+	var offsets []int
+	src := []rune(text)
+	pos := 0
+	for i, r := range src {
+		switch {
+		case r == '\r' && i+1 < len(src) && src[i+1] == '\n':
+			// CRLF is a single segment break
+		case r == '\r':
+			runes, offsets = append(runes, '\n'), append(offsets, pos)
+		default:
+			runes, offsets = append(runes, r), append(offsets, pos)
+		}
+		pos += utf16.RuneLen(r)
+	}
+
+	if !ws.collapsesSpaces() {
+		if !ws.preservesBreaks() {
+			// preserve-spaces turns segment breaks into spaces
+			for i, r := range runes {
+				if r == '\n' {
+					runes[i] = ' '
+				}
+			}
+		}
+		if len(runes) > 0 {
+			state.spaceBefore = false
+			state.last = runes[len(runes)-1]
+		}
+		return string(runes), offsets
+	}
+
+	// Remove spaces and tabs around segment breaks
+	var trimmed []rune
+	var trimmedOffsets []int
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == ' ' || r == '\t' {
+			j := i
+			for j < len(runes) && (runes[j] == ' ' || runes[j] == '\t') {
+				j++
+			}
+			if j < len(runes) && runes[j] == '\n' {
+				i = j - 1
+				continue
+			}
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == '\n' {
+				i = j - 1
+				continue
+			}
+		}
+		trimmed = append(trimmed, r)
+		trimmedOffsets = append(trimmedOffsets, offsets[i])
+	}
+
+	var sb strings.Builder
+	var kept []int
+	for i, r := range trimmed {
+		switch r {
+		case '\n':
+			if ws.preservesBreaks() {
+				sb.WriteRune('\n')
+				kept = append(kept, trimmedOffsets[i])
+				state.spaceBefore = false
+				state.last = '\n'
+				continue
+			}
+			// Consecutive segment breaks collapse into the first
+			if i > 0 && trimmed[i-1] == '\n' {
+				continue
+			}
+			// A break between two East Asian wide characters is removed
+			next := rune(0)
+			for _, n := range trimmed[i+1:] {
+				if n != '\n' {
+					next = n
+					break
+				}
+			}
+			if isEastAsianWide(state.last) && isEastAsianWide(next) {
+				continue
+			}
+			r = ' '
+		case '\t':
+			r = ' '
+		}
+		if r == ' ' {
+			if state.spaceBefore {
+				continue
+			}
+			state.spaceBefore = true
+		} else {
+			state.spaceBefore = false
+		}
+		sb.WriteRune(r)
+		kept = append(kept, trimmedOffsets[i])
+		state.last = r
+	}
+	return sb.String(), kept
+}
+
+// isEastAsianWide reports whether r has the East Asian Width property Wide,
+// Fullwidth or Halfwidth, excluding Hangul, for the segment break
+// transformation rules.
+func isEastAsianWide(r rune) bool {
+	switch {
+	case r >= 0x1100 && r <= 0x11FF, r >= 0x3130 && r <= 0x318F, r >= 0xAC00 && r <= 0xD7AF:
+		return false // Hangul
+	case r >= 0x2E80 && r <= 0x303E, r >= 0x3041 && r <= 0x33FF,
+		r >= 0x3400 && r <= 0x4DBF, r >= 0x4E00 && r <= 0x9FFF,
+		r >= 0xF900 && r <= 0xFAFF, r >= 0xFE30 && r <= 0xFE4F,
+		r >= 0xFF00 && r <= 0xFFEF, r >= 0x20000 && r <= 0x3FFFD:
+		return true
+	}
+	return false
+}
+
+// applyTextTransform applies text-transform to a run of text. prev is the
+// character before the run, so that capitalize sees words that span
+// element boundaries.
+// Reference: https://www.w3.org/TR/css-text-3/#text-transform-property
+func applyTextTransform(text, transform string, prev rune) string {
+	for _, keyword := range strings.Fields(transform) {
+		switch keyword {
+		case "uppercase":
+			text = strings.ToUpper(text)
+		case "lowercase":
+			text = strings.ToLower(text)
+		case "capitalize":
+			runes := []rune(text)
+			for i, r := range runes {
+				if isWordCharacter(r) && !isWordCharacter(prev) {
+					runes[i] = unicode.ToTitle(r)
+				}
+				prev = r
+			}
+			text = string(runes)
+		case "full-width":
+			runes := []rune(text)
+			for i, r := range runes {
+				if r == ' ' {
+					runes[i] = 0x3000
+				} else if r >= 0x21 && r <= 0x7E {
+					runes[i] = r - 0x21 + 0xFF01
+				}
+			}
+			text = string(runes)
+		}
+	}
+	return text
+}
+
+// isWordCharacter reports whether r is part of a word for capitalize.
+func isWordCharacter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r) || r == '\'' || r == '’'
+}
+
+// textMetrics holds the font and spacing values that measure a run of text.
+type textMetrics struct {
+	// Face is the primary font face of the style. Without one, text is
+	// measured with estimated advances and painted with a fallback font.
+	Face *font.Face
+	// Fonts and Font select a face for each character, falling back
+	// through the font-family list when Face lacks a glyph.
+	Fonts         *font.Collection
+	Font          font.Style
+	FontSize      float64
+	LetterSpacing float64
+	WordSpacing   float64
+	LineHeight    float64
+	TabSize       float64 // width of a tab stop in pixels
+	// Orientation is the text-orientation of vertical text, in which
+	// upright characters advance by 1em; it is empty in horizontal text
+	Orientation string
+}
+
+// resolveTextMetrics reads the text measurement properties of a style,
+// matching its font against fonts when there are any.
+func resolveTextMetrics(style *css.ComputedStyle, fonts *font.Collection) textMetrics {
+	m := textMetrics{FontSize: 16}
+	if fs := getLength(style, "font-size"); fs > 0 {
+		m.FontSize = fs
+	}
+	if fonts != nil {
+		m.Fonts = fonts
+		m.Font = font.Style{Families: fontFamilies(style), Weight: fontWeight(style), Italic: fontItalic(style)}
+		m.Face = fonts.Match(m.Font)
+	}
+	if getKeyword(style, "letter-spacing") != "normal" {
+		m.LetterSpacing = getLength(style, "letter-spacing")
+	}
+	if getKeyword(style, "word-spacing") != "normal" {
+		m.WordSpacing = getLength(style, "word-spacing")
+	}
+	m.LineHeight = resolveLineHeight(style, m.FontSize)
+	m.Orientation = TextOrientation(style)
+
+	// tab-size is a number of spaces or a length
+	m.TabSize = 8 * (m.advance(' ') + m.LetterSpacing + m.WordSpacing)
+	if val := style.GetPropertyValue("tab-size"); val != nil && !val.IsInitial {
+		switch val.Value.Type {
+		case css.LengthValue:
+			m.TabSize = val.Length
+		case css.NumberValue:
+			m.TabSize = val.Length * (m.advance(' ') + m.LetterSpacing + m.WordSpacing)
+		default:
+			if n, err := strconv.ParseFloat(getText(style, "tab-size"), 64); err == nil {
+				m.TabSize = n * (m.advance(' ') + m.LetterSpacing + m.WordSpacing)
+			}
+		}
+	}
+	return m
+}
+
+// fontFamilies returns the font-family list of a style, without quotes.
+func fontFamilies(style *css.ComputedStyle) []string {
+	return font.ParseFamilies(getText(style, "font-family"))
+}
+
+// fontWeight returns the numeric font-weight of a style.
+func fontWeight(style *css.ComputedStyle) int {
+	val := style.GetPropertyValue("font-weight")
+	if val == nil {
+		return 400
+	}
+	switch val.Keyword {
+	case "bold", "bolder":
+		return 700
+	case "lighter":
+		return 100
+	case "", "normal":
+		if val.Length >= 1 && val.Length <= 1000 {
+			return int(val.Length)
+		}
+	}
+	return 400
+}
+
+// fontItalic reports whether a style selects italic or oblique faces.
+func fontItalic(style *css.ComputedStyle) bool {
+	switch getKeyword(style, "font-style") {
+	case "italic", "oblique":
+		return true
+	}
+	return strings.HasPrefix(getText(style, "font-style"), "oblique")
+}
+
+// resolveLineHeight returns the used line-height of a style in pixels.
+func resolveLineHeight(style *css.ComputedStyle, fontSize float64) float64 {
+	val := style.GetPropertyValue("line-height")
+	if val == nil || val.Keyword != "" {
+		return fontSize * 1.2 // normal
+	}
+	if val.Value.Type == css.NumberValue {
+		return val.Length * fontSize
+	}
+	if val.Length > 0 {
+		return val.Length
+	}
+	return fontSize * 1.2
+}
+
+// advance returns the advance width of a character. Without font data the
+// average character width is estimated as 0.6em.
+func (m textMetrics) advance(r rune) float64 {
+	if UprightRune(r, m.Orientation) {
+		return m.FontSize
+	}
+	if m.Face != nil {
+		return font.Advance(m.Fonts.Shape([]rune{r}, m.Font, m.FontSize, false, ""))
+	}
+	return m.FontSize * 0.6
+}
+
+// measure returns the width of a run of text including letter-spacing and
+// word-spacing.
+func (m textMetrics) measure(text string) float64 {
+	if m.Face != nil {
+		return font.Advance(m.shape(text, false))
+	}
+	width := 0.0
+	for _, r := range text {
+		width += m.advance(r) + m.LetterSpacing
+		if isWordSeparator(r) {
+			width += m.WordSpacing
+		}
+	}
+	return width
+}
+
+// shape shapes a run of text in the given direction into glyphs, in visual
+// order, whose advances include letter-spacing and word-spacing. It returns
+// nil without a font face.
+func (m textMetrics) shape(text string, rtl bool) []font.Glyph {
+	if m.Face == nil || text == "" {
+		return nil
+	}
+	runes := []rune(text)
+	glyphs := m.Fonts.Shape(runes, m.Font, m.FontSize, rtl, "")
+	if m.Orientation != "" {
+		// An upright cluster advances by 1em in all
+		for i := range glyphs {
+			if UprightRune(runes[glyphs[i].Cluster], m.Orientation) {
+				glyphs[i].XAdvance = 0
+				if i == 0 || glyphs[i-1].Cluster != glyphs[i].Cluster {
+					glyphs[i].XAdvance = m.FontSize
+				}
+			}
+		}
+	}
+	if m.LetterSpacing == 0 && m.WordSpacing == 0 {
+		return glyphs
+	}
+	// Spacing follows each cluster, so it goes on the visually last glyph
+	// of the cluster in left-to-right runs and the first in right-to-left
+	for i := range glyphs {
+		edge := i+1 == len(glyphs) || glyphs[i+1].Cluster != glyphs[i].Cluster
+		if rtl {
+			edge = i == 0 || glyphs[i-1].Cluster != glyphs[i].Cluster
+		}
+		if !edge {
+			continue
+		}
+		glyphs[i].XAdvance += m.LetterSpacing
+		if isWordSeparator(runes[glyphs[i].Cluster]) {
+			glyphs[i].XAdvance += m.WordSpacing
+		}
+	}
+	return glyphs
+}
+
+// carets returns the caret position at each character boundary of a run
+// of text, measured from its left edge, given the glyphs it was shaped
+// into.
+func (m textMetrics) carets(text string, glyphs []font.Glyph, rtl bool) []float64 {
+	runes := []rune(text)
+	if m.Face != nil {
+		return font.Carets(runes, glyphs, rtl)
+	}
+	// Estimated advances: every character is its own cluster
+	carets := make([]float64, len(runes)+1)
+	x := 0.0
+	for i, r := range runes {
+		carets[i] = x
+		x += m.advance(r) + m.LetterSpacing
+		if isWordSeparator(r) {
+			x += m.WordSpacing
+		}
+	}
+	carets[len(runes)] = x
+	if rtl {
+		for i := range carets {
+			carets[i] = x - carets[i]
+		}
+	}
+	return carets
+}
+
+// isWordSeparator reports whether word-spacing applies to r.
+func isWordSeparator(r rune) bool {
+	return r == ' ' || r == 0x00A0 || r == 0x3000
+}
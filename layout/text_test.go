@@ -0,0 +1,130 @@
+package layout
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+func TestProcessWhiteSpace(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		ws   WhiteSpace
+		want string
+	}{
+		{"collapse spaces", "a  \t b", WhiteSpace{Collapse: "collapse"}, "a b"},
+		{"segment break becomes space", "a \n  b", WhiteSpace{Collapse: "collapse"}, "a b"},
+		{"break between wide characters", "日本\n語", WhiteSpace{Collapse: "collapse"}, "日本語"},
+		{"leading space after a space", " a", WhiteSpace{Collapse: "collapse"}, "a"},
+		{"preserve", "a  \n\tb", WhiteSpace{Collapse: "preserve"}, "a  \n\tb"},
+		{"preserve breaks", "a  \n  b  c", WhiteSpace{Collapse: "preserve-breaks"}, "a\nb c"},
+		{"preserve spaces", "a \nb", WhiteSpace{Collapse: "preserve-spaces"}, "a  b"},
+		{"carriage return", "a\r\nb", WhiteSpace{Collapse: "preserve"}, "a\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := collapseState{spaceBefore: true}
+			if got := processWhiteSpace(tt.text, tt.ws, &state); got != tt.want {
+				t.Errorf("processWhiteSpace(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessWhiteSpaceAcrossRuns(t *testing.T) {
+	// A space at the end of one element collapses with one at the start of
+	// the next
+	state := collapseState{spaceBefore: true}
+	first := processWhiteSpace("a ", WhiteSpace{Collapse: "collapse"}, &state)
+	second := processWhiteSpace(" b", WhiteSpace{Collapse: "collapse"}, &state)
+	if first+second != "a b" {
+		t.Errorf("collapsed runs = %q + %q, want \"a b\"", first, second)
+	}
+}
+
+func TestProcessWhiteSpaceOffsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		ws      WhiteSpace
+		offsets []int
+	}{
+		{"collapsed spaces keep the first", "a   b", WhiteSpace{Collapse: "collapse"}, []int{0, 1, 4}},
+		{"spaces before a break are removed", "a \n b", WhiteSpace{Collapse: "collapse"}, []int{0, 2, 4}},
+		{"carriage return line feed", "a\r\nb", WhiteSpace{Collapse: "preserve"}, []int{0, 2, 3}},
+		{"offsets count UTF-16 code units", "\U0001F600 x", WhiteSpace{Collapse: "collapse"}, []int{0, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := collapseState{}
+			_, offsets := processWhiteSpaceOffsets(tt.text, tt.ws, &state)
+			if fmt.Sprint(offsets) != fmt.Sprint(tt.offsets) {
+				t.Errorf("offsets = %v, want %v", offsets, tt.offsets)
+			}
+		})
+	}
+}
+
+func TestResolveWhiteSpace(t *testing.T) {
+	tests := []struct {
+		props map[string]string
+		want  WhiteSpace
+	}{
+		{map[string]string{"white-space": "normal"}, WhiteSpace{"collapse", true}},
+		{map[string]string{"white-space": "pre"}, WhiteSpace{"preserve", false}},
+		{map[string]string{"white-space": "nowrap"}, WhiteSpace{"collapse", false}},
+		{map[string]string{"white-space": "pre-wrap"}, WhiteSpace{"preserve", true}},
+		{map[string]string{"white-space": "pre-line"}, WhiteSpace{"preserve-breaks", true}},
+		{map[string]string{"white-space": "break-spaces"}, WhiteSpace{"break-spaces", true}},
+		{map[string]string{"white-space": "normal", "white-space-collapse": "preserve"}, WhiteSpace{"preserve", true}},
+		{map[string]string{"white-space": "pre", "text-wrap-mode": "wrap"}, WhiteSpace{"preserve", true}},
+		{map[string]string{"text-wrap": "nowrap"}, WhiteSpace{"collapse", false}},
+	}
+	for _, tt := range tests {
+		style := css.NewComputedStyle(nil, nil)
+		for prop, value := range tt.props {
+			style.SetPropertyValue(prop, &css.ComputedValue{Keyword: value})
+		}
+		if got := ResolveWhiteSpace(style); got != tt.want {
+			t.Errorf("ResolveWhiteSpace(%v) = %+v, want %+v", tt.props, got, tt.want)
+		}
+	}
+}
+
+func TestApplyTextTransform(t *testing.T) {
+	tests := []struct {
+		text, transform string
+		prev            rune
+		want            string
+	}{
+		{"hello world", "uppercase", 0, "HELLO WORLD"},
+		{"Hello", "lowercase", 0, "hello"},
+		{"hello o'neil-smith", "capitalize", 0, "Hello O'neil-Smith"},
+		{"world", "capitalize", 'o', "world"},
+		{"a1", "full-width", 0, "ａ１"},
+		{"Keep", "none", 0, "Keep"},
+	}
+	for _, tt := range tests {
+		if got := applyTextTransform(tt.text, tt.transform, tt.prev); got != tt.want {
+			t.Errorf("applyTextTransform(%q, %q) = %q, want %q", tt.text, tt.transform, got, tt.want)
+		}
+	}
+}
+
+func TestTextMetricsSpacing(t *testing.T) {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("font-size", &css.ComputedValue{Length: 10})
+	style.SetPropertyValue("letter-spacing", &css.ComputedValue{Length: 1})
+	style.SetPropertyValue("word-spacing", &css.ComputedValue{Length: 4})
+	m := resolveTextMetrics(style, nil)
+
+	// Three characters of 6px each, three letter spacings and one word space
+	if got := m.measure("a b"); got != 3*6+3+4 {
+		t.Errorf("measure = %v, want 25", got)
+	}
+	if m.TabSize != 8*(6+1+4) {
+		t.Errorf("TabSize = %v, want 88", m.TabSize)
+	}
+}
@@ -0,0 +1,232 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements the vertical alignment of inline-level boxes and the
+// sizing of inline blocks.
+// Reference: https://www.w3.org/TR/CSS2/visudet.html#line-height
+package layout
+
+import (
+	"math"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// lineAlignment places a box vertically on a line, relative to the baseline
+// of its alignment root: the line itself, or a top- or bottom-aligned box.
+type lineAlignment struct {
+	root  *LayoutBox // nil for the line
+	shift float64    // distance of the box's baseline below the root's
+}
+
+// lineExtent is the vertical extent of the boxes aligned with a root,
+// relative to the root's baseline.
+type lineExtent struct {
+	top, bottom float64
+}
+
+// alignLine sets the height and baseline of a line from the aligned
+// extents of its segments, and records the baseline of every box on it.
+// Boxes aligned with the top or bottom of the line are laid out as
+// separate subtrees, which grow the line only when they are taller.
+func (f *inlineFormatter) alignLine(line *LineBox, segments []*inlineSegment) {
+	memo := map[*LayoutBox]lineAlignment{}
+	// The strut of the container starts the line
+	ascent, descent := strutMetrics(resolveTextMetrics(f.style, f.fonts))
+	extents := map[*LayoutBox]*lineExtent{nil: {top: -ascent, bottom: descent}}
+	var roots []*LayoutBox
+	for _, seg := range segments {
+		if seg.Removed || seg.Kind == segmentBreak {
+			continue
+		}
+		a := f.align(seg.Box, memo)
+		var ascent, descent float64
+		if seg.Kind == segmentAtomic {
+			ascent, descent = f.boxExtent(seg.Box)
+		} else {
+			ascent, descent = strutMetrics(seg.Metrics)
+		}
+		e, ok := extents[a.root]
+		if !ok {
+			extents[a.root] = &lineExtent{top: a.shift - ascent, bottom: a.shift + descent}
+			roots = append(roots, a.root)
+			continue
+		}
+		e.top = math.Min(e.top, a.shift-ascent)
+		e.bottom = math.Max(e.bottom, a.shift+descent)
+	}
+
+	top, bottom := extents[nil].top, extents[nil].bottom
+	for _, root := range roots {
+		e := extents[root]
+		if getKeyword(root.ComputedStyle, "vertical-align") == "top" {
+			bottom = math.Max(bottom, top+e.bottom-e.top)
+		} else {
+			top = math.Min(top, bottom-(e.bottom-e.top))
+		}
+	}
+	line.Rect.Height = bottom - top
+	line.Baseline = line.Rect.Y - top
+
+	f.baselines = map[*LayoutBox]float64{f.container: line.Baseline}
+	for box, a := range memo {
+		baseline := line.Baseline
+		if a.root != nil {
+			e := extents[a.root]
+			if getKeyword(a.root.ComputedStyle, "vertical-align") == "top" {
+				baseline = line.Rect.Y - e.top
+			} else {
+				baseline = line.Rect.Y + line.Rect.Height - e.bottom
+			}
+		}
+		f.baselines[box] = baseline + a.shift
+	}
+}
+
+// align resolves the vertical-align of a box and its ancestors up to the
+// container. Text sits on the baseline of its parent.
+func (f *inlineFormatter) align(box *LayoutBox, memo map[*LayoutBox]lineAlignment) lineAlignment {
+	if box == nil || box == f.container {
+		return lineAlignment{}
+	}
+	if a, ok := memo[box]; ok {
+		return a
+	}
+	a := f.align(box.Parent, memo)
+	if box.TextContent == "" && box.ComputedStyle != nil {
+		if val := box.ComputedStyle.GetPropertyValue("vertical-align"); val != nil {
+			a = f.verticalAlign(box, val, a)
+		}
+	}
+	memo[box] = a
+	return a
+}
+
+// verticalAlign moves a box from the baseline of its parent, given the
+// parent's alignment, or makes it the root of a top- or bottom-aligned
+// subtree.
+func (f *inlineFormatter) verticalAlign(box *LayoutBox, val *css.ComputedValue, a lineAlignment) lineAlignment {
+	parent := resolveTextMetrics(box.Parent.inheritedStyle(), f.fonts).FontSize
+	switch val.Keyword {
+	case "top", "bottom":
+		return lineAlignment{root: box}
+	case "sub":
+		a.shift += parent / 5
+	case "super":
+		a.shift -= parent / 3
+	case "text-top":
+		ascent, _ := f.boxExtent(box)
+		a.shift += ascent - parent*0.8
+	case "text-bottom":
+		_, descent := f.boxExtent(box)
+		a.shift += parent*0.2 - descent
+	case "middle":
+		// The midpoint of the box sits half an x-height above the baseline
+		ascent, descent := f.boxExtent(box)
+		a.shift += (ascent-descent)/2 - parent*0.25
+	case "", "baseline":
+		switch val.Value.Type {
+		case css.LengthValue:
+			a.shift -= val.Length
+		case css.PercentageValue:
+			a.shift -= val.Value.Length / 100 * resolveTextMetrics(box.ComputedStyle, f.fonts).LineHeight
+		}
+	}
+	return a
+}
+
+// boxExtent returns the ascent and descent of a box around its baseline:
+// the strut of an inline box, or the margin box of an atomic inline.
+func (f *inlineFormatter) boxExtent(box *LayoutBox) (ascent, descent float64) {
+	if box.Replaced == nil && box.BoxType == InlineBox {
+		return strutMetrics(resolveTextMetrics(box.ComputedStyle, f.fonts))
+	}
+	ascent = box.baselineOffset()
+	return ascent, box.Dimensions.MarginBox().Height - ascent
+}
+
+// baselineOffset returns the distance from the top margin edge of an atomic
+// inline to its baseline. An inline-block uses the baseline of its last
+// line box, unless it has none or clips its overflow, and an inline flex
+// container that of its first. Anything else sits on its bottom margin edge.
+func (box *LayoutBox) baselineOffset() float64 {
+	margin := box.Dimensions.MarginBox()
+	if box.Replaced == nil {
+		var y float64
+		var ok bool
+		switch box.BoxType {
+		case InlineBlockBox:
+			if box.Overflow == OverflowVisible {
+				y, ok = box.lineBaseline(true)
+			}
+		case InlineFlexBox:
+			y, ok = box.lineBaseline(false)
+		}
+		if ok {
+			return y - margin.Y
+		}
+	}
+	return margin.Height
+}
+
+// lineBaseline returns the baseline of the first or last line box inside a
+// box, looking into its in-flow children, and whether it has one.
+func (box *LayoutBox) lineBaseline(last bool) (float64, bool) {
+	if n := len(box.LineBoxes); n > 0 {
+		if last {
+			return box.LineBoxes[n-1].Baseline, true
+		}
+		return box.LineBoxes[0].Baseline, true
+	}
+	for i := range box.Children {
+		child := box.Children[i]
+		if last {
+			child = box.Children[len(box.Children)-1-i]
+		}
+		if child.TextContent != "" || !isInFlow(child) {
+			continue
+		}
+		if y, ok := child.lineBaseline(last); ok {
+			return y, true
+		}
+	}
+	return 0, false
+}
+
+// isInFlow reports whether a box is neither floated nor absolutely
+// positioned.
+func isInFlow(box *LayoutBox) bool {
+	return box.Float == FloatNone && box.Position != PositionAbsolute && box.Position != PositionFixed
+}
+
+// layoutInlineBlock lays out an inline-block, which establishes a block
+// formatting context for its content. An auto width shrinks to fit the
+// content in the available width.
+func (box *LayoutBox) layoutInlineBlock(ctx *LayoutContext, containingBlock *Dimensions) {
+	available := *containingBlock
+	if _, ok := box.resolveWidth(ctx, "width", containingBlock.Content.Width, layoutSize); !ok {
+		margins, edges := box.horizontalEdges()
+		available.Content.Width = box.shrinkToFit(ctx, containingBlock.Content.Width-margins-edges) + margins + edges
+	}
+	box.layoutBlock(ctx, &available)
+	box.resetInlineMargins()
+}
+
+// resetInlineMargins gives a box laid out as a block the inline margins it
+// specifies, auto ones being zero, for boxes that do not fill their
+// containing block with their margins as blocks do.
+func (box *LayoutBox) resetInlineMargins() {
+	d := &box.Dimensions
+	left := getLength(box.ComputedStyle, "margin-left")
+	d.Margin.Right = getLength(box.ComputedStyle, "margin-right")
+	dx := left - d.Margin.Left
+	d.Margin.Left = left
+	translateBox(box, dx, 0)
+}
+
+// resetHeights clears the heights that block layout accumulates, so that a
+// laid out box can be laid out again.
+func resetHeights(box *LayoutBox) {
+	box.Dimensions.Content.Height = 0
+	for _, child := range box.Children {
+		resetHeights(child)
+	}
+}
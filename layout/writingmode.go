@@ -0,0 +1,257 @@
+// Package layout handles the CSS visual formatting model and box layout.
+// This file implements writing modes: boxes in vertical writing modes are
+// laid out in a flow-relative frame, where width is the inline size and top
+// the block-start side, and then mapped to physical coordinates.
+// Reference: https://www.w3.org/TR/css-writing-modes-4/
+package layout
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// frameSides maps the sides of the flow-relative frame of each vertical
+// writing mode, named as in horizontal-tb, to the physical sides they are
+// on: left is line-left, top is block-start.
+var frameSides = map[string]map[string]string{
+	"vertical-rl": {"top": "right", "right": "bottom", "bottom": "left", "left": "top"},
+	"sideways-rl": {"top": "right", "right": "bottom", "bottom": "left", "left": "top"},
+	"vertical-lr": {"top": "left", "right": "bottom", "bottom": "right", "left": "top"},
+	"sideways-lr": {"top": "left", "right": "top", "bottom": "right", "left": "bottom"},
+}
+
+// WritingMode returns the writing-mode of a style.
+func WritingMode(style *css.ComputedStyle) string {
+	if style != nil {
+		if val := style.GetPropertyValue("writing-mode"); val != nil {
+			if _, ok := frameSides[val.Keyword]; ok {
+				return val.Keyword
+			}
+		}
+	}
+	return "horizontal-tb"
+}
+
+// TextOrientation returns how the glyphs of text in a style are oriented:
+// upright, mixed or sideways in vertical writing modes, and empty in
+// horizontal ones.
+func TextOrientation(style *css.ComputedStyle) string {
+	mode := WritingMode(style)
+	switch {
+	case !css.IsVerticalWritingMode(mode):
+		return ""
+	case strings.HasPrefix(mode, "sideways-"):
+		return "sideways"
+	}
+	switch orientation := getText(style, "text-orientation"); orientation {
+	case "upright":
+		return orientation
+	case "sideways", "sideways-right":
+		return "sideways"
+	}
+	return "mixed"
+}
+
+// UprightRune reports whether a character is set upright in vertical text
+// with the given text-orientation. Mixed orientation sets the characters of
+// East Asian scripts upright and turns the others sideways.
+// Reference: https://www.unicode.org/reports/tr50/
+func UprightRune(r rune, orientation string) bool {
+	switch orientation {
+	case "upright":
+		return true
+	case "mixed":
+		return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo) ||
+			(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+	}
+	return false
+}
+
+// flowProperty returns the property a style sets for a side or dimension of
+// its flow-relative frame, named as in horizontal-tb: in vertical writing
+// modes width is the height and margin-left the margin on the line-left
+// side.
+func flowProperty(style *css.ComputedStyle, property string) string {
+	sides := frameSides[WritingMode(style)]
+	if sides == nil {
+		return property
+	}
+	switch property {
+	case "width", "min-width", "max-width":
+		return strings.Replace(property, "width", "height", 1)
+	case "height", "min-height", "max-height":
+		return strings.Replace(property, "height", "width", 1)
+	}
+	parts := strings.Split(property, "-")
+	for i, part := range parts {
+		if side, ok := sides[part]; ok {
+			parts[i] = side
+			return strings.Join(parts, "-")
+		}
+	}
+	return property
+}
+
+// flowValue returns the value of a property of a style for its
+// flow-relative frame.
+func flowValue(style *css.ComputedStyle, property string) *css.ComputedValue {
+	return style.GetPropertyValue(flowProperty(style, property))
+}
+
+// isFlowRoot reports whether a box establishes a writing mode of its own,
+// different from that of its parent or, for the root, from the initial
+// horizontal-tb.
+func (box *LayoutBox) isFlowRoot() bool {
+	if box.ComputedStyle == nil || box.Replaced != nil || box.TextContent != "" || box.BoxType == InlineBox {
+		return false
+	}
+	parent := "horizontal-tb"
+	if box.Parent != nil {
+		parent = WritingMode(box.Parent.inheritedStyle())
+	}
+	return WritingMode(box.ComputedStyle) != parent
+}
+
+// layoutFlowRoot lays out a box whose writing mode differs from that of its
+// parent. The box is laid out at the origin of its own frame, then its
+// geometry is mapped through physical coordinates into the frame of its
+// parent, where it is placed like a block. The available inline space of a
+// flow orthogonal to its parent is the size of the viewport in that axis,
+// and its auto inline size fits its content.
+// Reference: https://www.w3.org/TR/css-writing-modes-4/#orthogonal-flows
+func (box *LayoutBox) layoutFlowRoot(ctx *LayoutContext, containingBlock *Dimensions) {
+	mode := WritingMode(box.ComputedStyle)
+	parentMode := "horizontal-tb"
+	if box.Parent != nil {
+		parentMode = WritingMode(box.Parent.inheritedStyle())
+	}
+	vertical := css.IsVerticalWritingMode(mode)
+	orthogonal := vertical != css.IsVerticalWritingMode(parentMode)
+
+	frame := Dimensions{Content: Rect{Width: containingBlock.Content.Width}}
+	if orthogonal {
+		frame.Content.Width = ctx.ViewportWidth
+		if vertical {
+			frame.Content.Width = ctx.ViewportHeight
+		}
+		// The root fills the initial containing block, whose writing mode
+		// is its own
+		if _, ok := box.resolveWidth(ctx, "width", frame.Content.Width, layoutSize); !ok && box.Parent != nil {
+			margins, edges := box.horizontalEdges()
+			frame.Content.Width = box.shrinkToFit(ctx, frame.Content.Width-margins-edges) + margins + edges
+		}
+	}
+	ctx.PushContainingBlock(&frame)
+	switch box.BoxType {
+	case FlexBox, InlineFlexBox:
+		box.layoutFlex(ctx, &frame)
+	default:
+		box.layoutBlock(ctx, &frame)
+	}
+	ctx.PopContainingBlock()
+	if orthogonal && box.Parent != nil {
+		box.resetInlineMargins()
+	}
+
+	margin := box.Dimensions.MarginBox()
+	inline, block := margin.X+margin.Width, margin.Y+margin.Height
+	width, height := inline, block
+	if vertical {
+		width, height = block, inline
+	}
+	x, y := containingBlock.Content.X, containingBlock.Content.Y+containingBlock.Content.Height
+	if box.Parent == nil && (mode == "vertical-rl" || mode == "sideways-rl") {
+		// Lines of a right-to-left block flow start at the right of the page
+		x += containingBlock.Content.Width - width
+	}
+	t := flowTransform{from: mode, to: parentMode, inline: inline, block: block, width: width, height: height, x: x, y: y}
+	t.apply(box)
+}
+
+// flowTransform maps geometry laid out in the frame of one writing mode,
+// with the given extents, to physical coordinates and on into the frame of
+// another, offset by x and y.
+type flowTransform struct {
+	from, to      string
+	inline, block float64 // extents in the source frame
+	width, height float64 // physical extents
+	x, y          float64
+}
+
+// rect maps a rectangle.
+func (t flowTransform) rect(r Rect) Rect {
+	// From the source frame to physical coordinates
+	switch t.from {
+	case "vertical-rl", "sideways-rl":
+		r = Rect{X: t.block - r.Y - r.Height, Y: r.X, Width: r.Height, Height: r.Width}
+	case "vertical-lr":
+		r = Rect{X: r.Y, Y: r.X, Width: r.Height, Height: r.Width}
+	case "sideways-lr":
+		r = Rect{X: r.Y, Y: t.inline - r.X - r.Width, Width: r.Height, Height: r.Width}
+	}
+	// From physical coordinates to the target frame
+	switch t.to {
+	case "vertical-rl", "sideways-rl":
+		r = Rect{X: r.Y, Y: t.width - r.X - r.Width, Width: r.Height, Height: r.Width}
+	case "vertical-lr":
+		r = Rect{X: r.Y, Y: r.X, Width: r.Height, Height: r.Width}
+	case "sideways-lr":
+		r = Rect{X: t.height - r.Y - r.Height, Y: r.X, Width: r.Height, Height: r.Width}
+	}
+	r.X += t.x
+	r.Y += t.y
+	return r
+}
+
+// edges maps the sizes of the sides of a box.
+func (t flowTransform) edges(e EdgeSizes) EdgeSizes {
+	physical := map[string]float64{"top": e.Top, "right": e.Right, "bottom": e.Bottom, "left": e.Left}
+	if sides := frameSides[t.from]; sides != nil {
+		physical = map[string]float64{}
+		for side, size := range map[string]float64{"top": e.Top, "right": e.Right, "bottom": e.Bottom, "left": e.Left} {
+			physical[sides[side]] = size
+		}
+	}
+	sides := frameSides[t.to]
+	side := func(name string) float64 {
+		if sides != nil {
+			name = sides[name]
+		}
+		return physical[name]
+	}
+	return EdgeSizes{Top: side("top"), Right: side("right"), Bottom: side("bottom"), Left: side("left")}
+}
+
+// swapsAxes reports whether the transform exchanges the horizontal and
+// vertical axes.
+func (t flowTransform) swapsAxes() bool {
+	return css.IsVerticalWritingMode(t.from) != css.IsVerticalWritingMode(t.to)
+}
+
+// apply maps a laid out box and everything inside it. Line baselines stay
+// coordinates along the block axis of the lines.
+func (t flowTransform) apply(box *LayoutBox) {
+	d := &box.Dimensions
+	d.Content = t.rect(d.Content)
+	d.Margin, d.Border, d.Padding = t.edges(d.Margin), t.edges(d.Border), t.edges(d.Padding)
+	for _, line := range box.LineBoxes {
+		baseline := t.rect(Rect{X: line.Rect.X, Y: line.Baseline})
+		line.Baseline = baseline.Y
+		if t.swapsAxes() {
+			line.Baseline = baseline.X
+		}
+		line.Rect = t.rect(line.Rect)
+		for _, item := range line.InlineItems {
+			// Atomic inlines are mapped with the children
+			item.Rect = t.rect(item.Rect)
+		}
+	}
+	for i := range box.Columns {
+		box.Columns[i] = t.rect(box.Columns[i])
+	}
+	for _, child := range box.Children {
+		t.apply(child)
+	}
+}
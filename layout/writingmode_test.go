@@ -0,0 +1,89 @@
+package layout
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestVerticalWritingModes(t *testing.T) {
+	// Lines are 12px apart and characters 6px long at a 10px font size. The
+	// second paragraph starts 5px further along the block axis.
+	stylesheet := "body { margin-top: 0; margin-left: 0 } section { font-size: 10px; height: 100px } p { margin-top: 0; margin-bottom: 0 }"
+	html := "<body><section style='writing-mode: %s'><p>aaa</p><p style='margin-block-start: 5px'>bb</p></section><div></div></body>"
+	tests := []struct {
+		mode   string
+		first  Rect // of the first paragraph
+		second Rect
+		text   Rect // of the text of the second paragraph
+	}{
+		{"vertical-rl", Rect{X: 17, Y: 0, Width: 12, Height: 100}, Rect{X: 0, Y: 0, Width: 12, Height: 100}, Rect{X: 1, Y: 0, Width: 10, Height: 12}},
+		{"vertical-lr", Rect{X: 0, Y: 0, Width: 12, Height: 100}, Rect{X: 17, Y: 0, Width: 12, Height: 100}, Rect{X: 18, Y: 0, Width: 10, Height: 12}},
+		{"sideways-lr", Rect{X: 0, Y: 0, Width: 12, Height: 100}, Rect{X: 17, Y: 0, Width: 12, Height: 100}, Rect{X: 18, Y: 88, Width: 10, Height: 12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			body := layoutHTML(t, fmt.Sprintf(html, tt.mode), stylesheet, "body", nil)
+			section := findBox(body, "section")
+			origin := section.Dimensions.Content
+			if origin.Width != 29 || origin.Height != 100 {
+				t.Errorf("section is %vx%v, want 29x100", origin.Width, origin.Height)
+			}
+			at := func(r Rect) Rect {
+				return Rect{X: r.X - origin.X, Y: r.Y - origin.Y, Width: r.Width, Height: r.Height}
+			}
+			first, second := section.Children[0], section.Children[1]
+			if got := at(first.Dimensions.Content); got != tt.first {
+				t.Errorf("first paragraph at %v, want %v", got, tt.first)
+			}
+			if got := at(second.Dimensions.Content); got != tt.second {
+				t.Errorf("second paragraph at %v, want %v", got, tt.second)
+			}
+			if got := at(second.LineBoxes[0].InlineItems[0].Rect); got != tt.text {
+				t.Errorf("text at %v, want %v", got, tt.text)
+			}
+			// The next block follows the physical height of the section
+			if got := findBox(body, "div").Dimensions.Content.Y; got != origin.Y+100 {
+				t.Errorf("next block at y = %v, want %v", got, origin.Y+100)
+			}
+		})
+	}
+}
+
+func TestOrthogonalFlowSize(t *testing.T) {
+	stylesheet := "body { margin-top: 0; margin-left: 0 } section { font-size: 10px; writing-mode: vertical-rl }"
+	tests := []struct {
+		name          string
+		style         string
+		width, height float64
+	}{
+		// The auto inline size fits the content, up to the viewport height
+		{"fit content", "", 12, 44},
+		{"upright", "text-orientation: upright", 12, 60},
+		{"inline-size", "inline-size: 30px", 24, 30},
+		{"block-size", "block-size: 40px; padding-block-start: 3px", 40, 44},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := layoutHTML(t, "<body><section style='"+tt.style+"'>aaa 漢字</section></body>", stylesheet, "section", nil)
+			d := section.Dimensions
+			if d.Content.Width != tt.width || d.Content.Height != tt.height {
+				t.Errorf("section is %vx%v, want %vx%v", d.Content.Width, d.Content.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestHorizontalInVertical(t *testing.T) {
+	// A horizontal block inside vertical text is placed on the block axis
+	// of its parent, right to left
+	stylesheet := "body { margin-top: 0; margin-left: 0 } section { font-size: 10px; writing-mode: vertical-rl; height: 100px } div { writing-mode: horizontal-tb; width: 50px }"
+	section := layoutHTML(t, "<body><section><p style='margin-top: 0; margin-bottom: 0'>aa</p><div>bb</div></section></body>", stylesheet, "section", nil)
+	origin := section.Dimensions.Content
+	div := findBox(section, "div").Dimensions.Content
+	if origin.Width != 62 {
+		t.Errorf("section width = %v, want 62", origin.Width)
+	}
+	if div.X != origin.X || div.Y != origin.Y || div.Width != 50 || div.Height != 12 {
+		t.Errorf("div at %v, want at the left of %v", div, origin)
+	}
+}
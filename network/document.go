@@ -110,6 +110,9 @@ func (dl *DocumentLoader) loadStylesheets(ctx context.Context, doc *dom.Document
 		// Parse the CSS
 		parser := css.NewParser(loaded.Content)
 		loaded.Stylesheet = parser.Parse()
+		if media := el.GetAttribute("media"); media != "" {
+			loaded.Stylesheet.Media = css.ParseMediaQueryList(media)
+		}
 
 		result.Stylesheets = append(result.Stylesheets, loaded)
 	}
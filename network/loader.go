@@ -284,6 +284,11 @@ func (l *Loader) LoadImage(ctx context.Context, urlStr string) *Resource {
 	return l.Load(ctx, urlStr, ResourceTypeImage)
 }
 
+// LoadFont loads a font file.
+func (l *Loader) LoadFont(ctx context.Context, urlStr string) *Resource {
+	return l.Load(ctx, urlStr, ResourceTypeFont)
+}
+
 // LoadDocumentResources finds and loads all external resources in a document.
 // This includes stylesheets, scripts, and images.
 func (l *Loader) LoadDocumentResources(ctx context.Context, doc *dom.Document) (*DocumentResources, error) {
@@ -0,0 +1,355 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements background layers: background-image with size,
+// position, repeat, origin and clip.
+// Reference: https://www.w3.org/TR/css-backgrounds-3/#backgrounds
+package render
+
+import (
+	"math"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// backgroundSize is one layer of background-size. Nil dimensions are auto.
+type backgroundSize struct {
+	Keyword       string // "cover", "contain" or empty
+	Width, Height *lengthPercentage
+}
+
+// BackgroundLayer is one comma-separated layer of the background properties.
+type BackgroundLayer struct {
+	Image *Gradient // nil for none or images that cannot be painted
+	// Unsupported is set when the layer names an image that cannot be painted.
+	Unsupported bool
+	Size        backgroundSize
+	Position    Position
+	RepeatX     string // repeat, no-repeat, space or round
+	RepeatY     string
+	Origin      string // border-box, padding-box or content-box
+	Clip        string
+}
+
+// defaultBackgroundPosition is the initial value of background-position (0% 0%).
+var defaultBackgroundPosition = Position{
+	X: positionComponent{Offset: lengthPercentage{Percent: true}},
+	Y: positionComponent{Offset: lengthPercentage{Percent: true}},
+}
+
+// layerProperties names the longhands that make up a list of image layers,
+// shared by backgrounds and masks.
+type layerProperties struct {
+	Image, Size, Position, Repeat, Origin, Clip string
+}
+
+// backgroundProperties are the background layer longhands.
+var backgroundProperties = layerProperties{
+	Image:    "background-image",
+	Size:     "background-size",
+	Position: "background-position",
+	Repeat:   "background-repeat",
+	Origin:   "background-origin",
+	Clip:     "background-clip",
+}
+
+// parseBackgroundLayers builds the background layers of a style.
+func parseBackgroundLayers(style *css.ComputedStyle) []BackgroundLayer {
+	return parseLayers(style, backgroundProperties, "padding-box")
+}
+
+// parseLayers builds image layers from a set of layer longhands. The number of
+// layers is given by the image property; shorter lists of the other
+// properties repeat to fill it.
+func parseLayers(style *css.ComputedStyle, props layerProperties, defaultOrigin string) []BackgroundLayer {
+	currentColor := getTextColor(style)
+
+	images := styleLayerValues(style, props.Image)
+	if len(images) == 0 {
+		images = [][]css.ComponentValue{nil}
+	}
+	sizes := styleLayerValues(style, props.Size)
+	positions := styleLayerValues(style, props.Position)
+	repeats := styleLayerValues(style, props.Repeat)
+	origins := styleLayerValues(style, props.Origin)
+	clips := styleLayerValues(style, props.Clip)
+
+	layers := make([]BackgroundLayer, len(images))
+	for i, image := range images {
+		layer := BackgroundLayer{
+			Position: defaultBackgroundPosition,
+			RepeatX:  "repeat",
+			RepeatY:  "repeat",
+			Origin:   defaultOrigin,
+			Clip:     "border-box",
+		}
+		if len(image) == 1 {
+			if g, ok := ParseGradient(image[0], currentColor, style); ok {
+				layer.Image = g
+			} else if ident, _ := css.ComponentIdent(image[0]); ident != "none" {
+				layer.Unsupported = true
+			}
+		}
+		if v := cycleLayer(sizes, i); v != nil {
+			layer.Size = parseBackgroundSize(v, style)
+		}
+		if v := cycleLayer(positions, i); v != nil {
+			if pos, ok := parsePosition(v, style); ok {
+				layer.Position = pos
+			}
+		}
+		if v := cycleLayer(repeats, i); v != nil {
+			layer.RepeatX, layer.RepeatY = parseBackgroundRepeat(v)
+		}
+		if v := cycleLayer(origins, i); len(v) == 1 {
+			if ident, ok := css.ComponentIdent(v[0]); ok && isBoxKeyword(ident) {
+				layer.Origin = ident
+			}
+		}
+		if v := cycleLayer(clips, i); len(v) == 1 {
+			if ident, ok := css.ComponentIdent(v[0]); ok && isBoxKeyword(ident) {
+				layer.Clip = ident
+			}
+		}
+		layers[i] = layer
+	}
+	return layers
+}
+
+// styleLayerValues splits a property value into its comma-separated layers.
+func styleLayerValues(style *css.ComputedStyle, property string) [][]css.ComponentValue {
+	raw := styleText(style, property)
+	if raw == "" {
+		return nil
+	}
+	groups := css.SplitComponentValuesByComma(css.ParseComponentValueList(raw))
+	for i := range groups {
+		groups[i] = css.NonWhitespaceComponents(groups[i])
+	}
+	return groups
+}
+
+// cycleLayer returns the value for layer i, repeating the list as needed.
+func cycleLayer(values [][]css.ComponentValue, i int) []css.ComponentValue {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[i%len(values)]
+}
+
+func isBoxKeyword(keyword string) bool {
+	return keyword == "border-box" || keyword == "padding-box" || keyword == "content-box"
+}
+
+// parseBackgroundSize parses one layer of background-size.
+func parseBackgroundSize(parts []css.ComponentValue, style *css.ComputedStyle) backgroundSize {
+	var size backgroundSize
+	if len(parts) == 1 {
+		if ident, ok := css.ComponentIdent(parts[0]); ok && (ident == "cover" || ident == "contain") {
+			size.Keyword = ident
+			return size
+		}
+	}
+	dims := make([]*lengthPercentage, 0, 2)
+	for _, part := range parts {
+		if ident, ok := css.ComponentIdent(part); ok && ident == "auto" {
+			dims = append(dims, nil)
+			continue
+		}
+		lp, ok := parseLengthPercentage(part, style)
+		if !ok || lp.Value < 0 {
+			return backgroundSize{}
+		}
+		dims = append(dims, &lp)
+	}
+	switch len(dims) {
+	case 1:
+		size.Width = dims[0]
+	case 2:
+		size.Width, size.Height = dims[0], dims[1]
+	}
+	return size
+}
+
+// parseBackgroundRepeat parses one layer of background-repeat.
+func parseBackgroundRepeat(parts []css.ComponentValue) (string, string) {
+	var idents []string
+	for _, part := range parts {
+		ident, ok := css.ComponentIdent(part)
+		if !ok {
+			return "repeat", "repeat"
+		}
+		idents = append(idents, ident)
+	}
+	switch len(idents) {
+	case 1:
+		switch idents[0] {
+		case "repeat-x":
+			return "repeat", "no-repeat"
+		case "repeat-y":
+			return "no-repeat", "repeat"
+		case "repeat", "no-repeat", "space", "round":
+			return idents[0], idents[0]
+		}
+	case 2:
+		return idents[0], idents[1]
+	}
+	return "repeat", "repeat"
+}
+
+// boxArea returns the border, padding or content box of a layout box as a
+// rounded rectangle, with radii following the border radius.
+func boxArea(box *layout.LayoutBox, border RoundedRect, keyword string) RoundedRect {
+	switch keyword {
+	case "padding-box":
+		return border.Inset(box.Dimensions.Border)
+	case "content-box":
+		return border.Inset(box.Dimensions.Border).Inset(box.Dimensions.Padding)
+	}
+	return border
+}
+
+// BackgroundImageCommand paints one background image layer, tiling it across
+// the clip area.
+type BackgroundImageCommand struct {
+	Image *Gradient
+	// Tile is the position and size of the anchor tile.
+	Tile layout.Rect
+	// StepX and StepY are the distances between repeated tiles; zero means
+	// the tile is not repeated along that axis.
+	StepX, StepY float64
+	Clip         RoundedRect
+}
+
+// Execute paints the layer.
+func (cmd *BackgroundImageCommand) Execute(c *Canvas) {
+	if cmd.Tile.Width <= 0 || cmd.Tile.Height <= 0 {
+		return
+	}
+	painter := cmd.Image.painterFor(cmd.Tile.Width, cmd.Tile.Height)
+	x0, y0, x1, y1 := c.pixelBounds(cmd.Clip.Rect)
+	for py := y0; py < y1; py++ {
+		ty, ok := tileOffset(float64(py)+0.5-cmd.Tile.Y, cmd.StepY, cmd.Tile.Height)
+		if !ok {
+			continue
+		}
+		for px := x0; px < x1; px++ {
+			tx, ok := tileOffset(float64(px)+0.5-cmd.Tile.X, cmd.StepX, cmd.Tile.Width)
+			if !ok {
+				continue
+			}
+			coverage := cmd.Clip.Coverage(px, py)
+			if coverage <= 0 {
+				continue
+			}
+			c.BlendPixelCoverage(px, py, painter.colorAt(tx, ty), coverage)
+		}
+	}
+}
+
+// tileOffset maps a distance from the anchor tile to a position inside a tile,
+// reporting false for points in the gaps between or outside of tiles.
+func tileOffset(d, step, size float64) (float64, bool) {
+	if step > 0 {
+		d = math.Mod(d, step)
+		if d < 0 {
+			d += step
+		}
+	}
+	return d, d >= 0 && d < size
+}
+
+// paintBackgroundLayers paints the background images of a box, bottom layer
+// (the last one listed) first.
+func (c *Canvas) paintBackgroundLayers(box *layout.LayoutBox, layers []BackgroundLayer, border RoundedRect, ctx *PaintContext) {
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		if layer.Image == nil {
+			continue
+		}
+		area := boxArea(box, border, layer.Origin).Rect
+		clip := boxArea(box, border, layer.Clip)
+		tile, stepX, stepY := layer.placeTile(area)
+		if tile.Width <= 0 || tile.Height <= 0 {
+			continue
+		}
+		ctx.DisplayList = append(ctx.DisplayList, &BackgroundImageCommand{
+			Image: layer.Image,
+			Tile:  tile,
+			StepX: stepX,
+			StepY: stepY,
+			Clip:  clip,
+		})
+	}
+}
+
+// placeTile computes the anchor tile and repeat steps of a layer within its
+// background positioning area. Gradients have no intrinsic size, so auto,
+// cover and contain all fill the positioning area.
+func (layer BackgroundLayer) placeTile(area layout.Rect) (tile layout.Rect, stepX, stepY float64) {
+	width, height := area.Width, area.Height
+	if layer.Size.Keyword == "" {
+		if layer.Size.Width != nil {
+			width = layer.Size.Width.resolve(area.Width)
+		}
+		if layer.Size.Height != nil {
+			height = layer.Size.Height.resolve(area.Height)
+		}
+	}
+
+	// round rescales the tile so a whole number fits; an auto dimension on the
+	// other axis keeps the proportions.
+	if layer.RepeatX == "round" && width > 0 {
+		scaled := area.Width / math.Max(1, math.Round(area.Width/width))
+		if layer.Size.Height == nil && layer.RepeatY != "round" {
+			height *= scaled / width
+		}
+		width = scaled
+	}
+	if layer.RepeatY == "round" && height > 0 {
+		scaled := area.Height / math.Max(1, math.Round(area.Height/height))
+		if layer.Size.Width == nil && layer.RepeatX != "round" {
+			width *= scaled / height
+		}
+		height = scaled
+	}
+
+	tile = layout.Rect{Width: width, Height: height}
+	tile.X, stepX = placeTileAxis(layer.RepeatX, area.X, area.Width, width, layer.Position.X)
+	tile.Y, stepY = placeTileAxis(layer.RepeatY, area.Y, area.Height, height, layer.Position.Y)
+	return tile, stepX, stepY
+}
+
+// placeTileAxis positions the anchor tile along one axis and returns the step
+// between repeated tiles.
+func placeTileAxis(repeat string, start, areaSize, tileSize float64, pos positionComponent) (float64, float64) {
+	switch repeat {
+	case "no-repeat":
+		return start + pos.resolve(areaSize, tileSize), 0
+	case "space":
+		// As many whole tiles as fit, with the first and last touching the edges
+		if n := math.Floor(areaSize / tileSize); n >= 2 {
+			return start, tileSize + (areaSize-n*tileSize)/(n-1)
+		}
+		return start + pos.resolve(areaSize, tileSize), 0
+	}
+	return start + pos.resolve(areaSize, tileSize), tileSize
+}
+
+// backgroundColorClip returns the clip of the background color, which follows
+// the final background layer.
+func backgroundColorClip(layers []BackgroundLayer) string {
+	if len(layers) == 0 {
+		return "border-box"
+	}
+	return layers[len(layers)-1].Clip
+}
+
+// hasBackgroundImage reports whether any layer has a paintable image.
+func hasBackgroundImage(layers []BackgroundLayer) bool {
+	for _, layer := range layers {
+		if layer.Image != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+// Package render tests for background image layers.
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+func TestParseBackgroundLayers(t *testing.T) {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-image", rawValue("linear-gradient(red, blue), none, radial-gradient(white, black)"))
+	style.SetPropertyValue("background-repeat", rawValue("no-repeat, repeat-x"))
+	style.SetPropertyValue("background-clip", &css.ComputedValue{Keyword: "padding-box"})
+
+	layers := parseBackgroundLayers(style)
+	if len(layers) != 3 {
+		t.Fatalf("got %d layers, want 3", len(layers))
+	}
+	if layers[0].Image == nil || layers[0].Image.Kind != LinearGradientKind {
+		t.Error("layer 0 should be a linear gradient")
+	}
+	if layers[1].Image != nil {
+		t.Error("layer 1 should have no image")
+	}
+	if layers[2].Image == nil || layers[2].Image.Kind != RadialGradientKind {
+		t.Error("layer 2 should be a radial gradient")
+	}
+	if layers[1].RepeatX != "repeat" || layers[1].RepeatY != "no-repeat" {
+		t.Errorf("layer 1 repeat = %s %s, want repeat no-repeat", layers[1].RepeatX, layers[1].RepeatY)
+	}
+	// The repeat list cycles
+	if layers[2].RepeatX != "no-repeat" {
+		t.Errorf("layer 2 repeat = %s, want no-repeat", layers[2].RepeatX)
+	}
+	for i, layer := range layers {
+		if layer.Clip != "padding-box" || layer.Origin != "padding-box" {
+			t.Errorf("layer %d origin/clip = %s/%s", i, layer.Origin, layer.Clip)
+		}
+	}
+}
+
+func TestPlaceTile(t *testing.T) {
+	area := layout.Rect{X: 10, Y: 10, Width: 100, Height: 50}
+	w, h := lengthPercentage{Value: 30}, lengthPercentage{Value: 50, Percent: true}
+
+	layer := BackgroundLayer{
+		Size:     backgroundSize{Width: &w, Height: &h},
+		Position: centerPosition,
+		RepeatX:  "no-repeat",
+		RepeatY:  "repeat",
+	}
+	tile, stepX, stepY := layer.placeTile(area)
+	if tile != (layout.Rect{X: 45, Y: 22.5, Width: 30, Height: 25}) {
+		t.Errorf("tile = %+v", tile)
+	}
+	if stepX != 0 || stepY != 25 {
+		t.Errorf("steps = %v, %v, want 0, 25", stepX, stepY)
+	}
+
+	layer.RepeatX, layer.RepeatY = "space", "round"
+	tile, stepX, _ = layer.placeTile(area)
+	if tile.X != 10 || stepX != 35 {
+		t.Errorf("space: tile x = %v, step %v, want 10 and 35", tile.X, stepX)
+	}
+
+	h = lengthPercentage{Value: 40}
+	tile, _, _ = layer.placeTile(area)
+	if tile.Height != 50 {
+		t.Errorf("round: tile height = %v, want 50", tile.Height)
+	}
+}
+
+func TestPaintGradientBackground(t *testing.T) {
+	canvas := NewCanvas(100, 100)
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-color", &css.ComputedValue{Color: css.Color{G: 255, A: 255}})
+	style.SetPropertyValue("background-image", rawValue("linear-gradient(to right, red 50%, blue 50%)"))
+	style.SetPropertyValue("background-size", rawValue("20px 20px"))
+	style.SetPropertyValue("background-repeat", rawValue("repeat-x"))
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 0, Y: 0, Width: 100, Height: 60},
+		},
+	}
+	canvas.Paint(box)
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	if canvas.GetPixel(5, 5) != red || canvas.GetPixel(15, 5) != blue {
+		t.Errorf("first tile = %v, %v", canvas.GetPixel(5, 5), canvas.GetPixel(15, 5))
+	}
+	if canvas.GetPixel(45, 5) != red || canvas.GetPixel(55, 5) != blue {
+		t.Errorf("repeated tile = %v, %v", canvas.GetPixel(45, 5), canvas.GetPixel(55, 5))
+	}
+	if canvas.GetPixel(5, 30) != green {
+		t.Errorf("below the row of tiles = %v, want background color", canvas.GetPixel(5, 30))
+	}
+}
+
+func TestPaintBackgroundLayerOrder(t *testing.T) {
+	canvas := NewCanvas(50, 50)
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-image", rawValue("linear-gradient(red, red), linear-gradient(blue, blue)"))
+	style.SetPropertyValue("background-size", rawValue("10px 10px, auto"))
+	style.SetPropertyValue("background-repeat", rawValue("no-repeat"))
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 0, Y: 0, Width: 50, Height: 50},
+		},
+	}
+	canvas.Paint(box)
+
+	// The first layer is on top
+	if canvas.GetPixel(5, 5) != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("top layer = %v, want red", canvas.GetPixel(5, 5))
+	}
+	if canvas.GetPixel(30, 30) != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("bottom layer = %v, want blue", canvas.GetPixel(30, 30))
+	}
+}
+
+func TestBackgroundColorFollowsFinalLayerClip(t *testing.T) {
+	canvas := NewCanvas(60, 60)
+	white := color.RGBA{255, 255, 255, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-color", &css.ComputedValue{Color: css.Color{R: 255, A: 255}})
+	style.SetPropertyValue("background-image", rawValue("none, none"))
+	style.SetPropertyValue("background-clip", rawValue("border-box, content-box"))
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 10, Y: 10, Width: 40, Height: 40},
+			Padding: layout.EdgeSizes{Top: 10, Right: 10, Bottom: 10, Left: 10},
+		},
+	}
+	canvas.Paint(box)
+
+	if canvas.GetPixel(5, 30) != white {
+		t.Error("background color should be clipped to the content box")
+	}
+}
@@ -0,0 +1,913 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements box decorations: rounded backgrounds and borders,
+// box-shadow, outline and column rules.
+// Reference: https://www.w3.org/TR/css-backgrounds-3/ and https://www.w3.org/TR/css-ui-4/#outline-props
+package render
+
+import (
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// RoundedRectCommand paints an anti-aliased rounded rectangle.
+type RoundedRectCommand struct {
+	Color color.RGBA
+	Shape RoundedRect
+}
+
+// Execute paints the rounded rectangle.
+func (cmd *RoundedRectCommand) Execute(c *Canvas) {
+	c.FillRoundedRect(cmd.Shape, cmd.Color)
+}
+
+// Border side indices, clockwise from the top.
+const (
+	sideTop = iota
+	sideRight
+	sideBottom
+	sideLeft
+)
+
+// RoundedBorderCommand paints a border ring between two rounded rectangles,
+// with a color and style per side.
+type RoundedBorderCommand struct {
+	Outer  RoundedRect
+	Inner  RoundedRect
+	Widths layout.EdgeSizes
+	Colors [4]color.RGBA
+	Styles [4]string
+}
+
+// Execute paints the border ring.
+func (cmd *RoundedBorderCommand) Execute(c *Canvas) {
+	if cmd.isHidden() {
+		return
+	}
+	if cmd.isUniformSolid() {
+		c.FillRoundedRing(cmd.Outer, cmd.Inner, cmd.Colors[sideTop])
+		return
+	}
+
+	x0, y0, x1, y1 := c.pixelBounds(cmd.Outer.Rect)
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			if cmd.Inner.isInterior(px, py) {
+				continue
+			}
+			cmd.paintPixel(c, px, py)
+		}
+	}
+}
+
+// isHidden reports whether no side of the ring is painted.
+func (cmd *RoundedBorderCommand) isHidden() bool {
+	for _, style := range cmd.Styles {
+		if style != "none" && style != "hidden" {
+			return false
+		}
+	}
+	return true
+}
+
+// isUniformSolid reports whether the whole ring is one solid color.
+func (cmd *RoundedBorderCommand) isUniformSolid() bool {
+	for i := 0; i < 4; i++ {
+		if cmd.Colors[i] != cmd.Colors[0] || cmd.Styles[i] != "solid" {
+			return false
+		}
+	}
+	return true
+}
+
+// paintPixel supersamples one pixel of the ring, resolving side, style and color per sample.
+func (cmd *RoundedBorderCommand) paintPixel(c *Canvas, px, py int) {
+	var r, g, b, a float64
+	for sy := 0; sy < coverageSamples; sy++ {
+		y := float64(py) + (float64(sy)+0.5)/coverageSamples
+		for sx := 0; sx < coverageSamples; sx++ {
+			x := float64(px) + (float64(sx)+0.5)/coverageSamples
+			if !cmd.Outer.Contains(x, y) || cmd.Inner.Contains(x, y) {
+				continue
+			}
+			side := cmd.sideAt(x, y)
+			col, ok := cmd.sampleColor(side, x, y)
+			if !ok {
+				continue
+			}
+			alpha := float64(col.A) / 255
+			r += float64(col.R) * alpha
+			g += float64(col.G) * alpha
+			b += float64(col.B) * alpha
+			a += alpha
+		}
+	}
+	if a == 0 {
+		return
+	}
+	n := float64(coverageSamples * coverageSamples)
+	out := color.RGBA{
+		R: uint8(math.Round(r / a)),
+		G: uint8(math.Round(g / a)),
+		B: uint8(math.Round(b / a)),
+		A: 255,
+	}
+	c.BlendPixelCoverage(px, py, out, a/n)
+}
+
+// sideAt determines which border side a point belongs to. Corners are split
+// along the line joining the outer and inner corners, which is where the
+// width-normalized distances to two adjacent edges are equal.
+func (cmd *RoundedBorderCommand) sideAt(x, y float64) int {
+	r := cmd.Outer.Rect
+	dist := [4]float64{
+		normalizedEdgeDistance(y-r.Y, cmd.Widths.Top),
+		normalizedEdgeDistance(r.X+r.Width-x, cmd.Widths.Right),
+		normalizedEdgeDistance(r.Y+r.Height-y, cmd.Widths.Bottom),
+		normalizedEdgeDistance(x-r.X, cmd.Widths.Left),
+	}
+	best := sideTop
+	for i := 1; i < 4; i++ {
+		if dist[i] < dist[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+func normalizedEdgeDistance(d, width float64) float64 {
+	if width <= 0 {
+		return math.Inf(1)
+	}
+	return d / width
+}
+
+// sampleColor returns the color painted at a point on the given side, or false
+// if the side's style leaves that point unpainted.
+func (cmd *RoundedBorderCommand) sampleColor(side int, x, y float64) (color.RGBA, bool) {
+	col := cmd.Colors[side]
+	width := [4]float64{cmd.Widths.Top, cmd.Widths.Right, cmd.Widths.Bottom, cmd.Widths.Left}[side]
+
+	// Position along the side, used for dash patterns.
+	along := x - cmd.Outer.Rect.X
+	if side == sideLeft || side == sideRight {
+		along = y - cmd.Outer.Rect.Y
+	}
+
+	switch cmd.Styles[side] {
+	case "none", "hidden":
+		return col, false
+	case "dashed":
+		dash := math.Max(3*width, 6)
+		if math.Mod(along, dash*1.5) >= dash {
+			return col, false
+		}
+	case "dotted":
+		dot := math.Max(width, 1)
+		if math.Mod(along, dot*2) >= dot {
+			return col, false
+		}
+	case "double":
+		// Two lines with a gap of equal width: skip the middle third of the ring.
+		third := layout.EdgeSizes{Top: cmd.Widths.Top / 3, Right: cmd.Widths.Right / 3, Bottom: cmd.Widths.Bottom / 3, Left: cmd.Widths.Left / 3}
+		mid := cmd.Outer.Inset(third)
+		twoThirds := layout.EdgeSizes{Top: 2 * third.Top, Right: 2 * third.Right, Bottom: 2 * third.Bottom, Left: 2 * third.Left}
+		if mid.Contains(x, y) && !cmd.Outer.Inset(twoThirds).Contains(x, y) {
+			return col, false
+		}
+	case "groove", "ridge":
+		half := layout.EdgeSizes{Top: cmd.Widths.Top / 2, Right: cmd.Widths.Right / 2, Bottom: cmd.Widths.Bottom / 2, Left: cmd.Widths.Left / 2}
+		outerHalf := !cmd.Outer.Inset(half).Contains(x, y)
+		darkTopLeft := outerHalf == (cmd.Styles[side] == "groove")
+		if (side == sideTop || side == sideLeft) == darkTopLeft {
+			return shadeColor(col, 0.5), true
+		}
+	case "inset":
+		if side == sideTop || side == sideLeft {
+			return shadeColor(col, 0.5), true
+		}
+	case "outset":
+		if side == sideBottom || side == sideRight {
+			return shadeColor(col, 0.5), true
+		}
+	}
+	return col, true
+}
+
+// shadeColor darkens a color by the given factor, keeping its alpha.
+func shadeColor(col color.RGBA, factor float64) color.RGBA {
+	return color.RGBA{
+		R: uint8(float64(col.R) * factor),
+		G: uint8(float64(col.G) * factor),
+		B: uint8(float64(col.B) * factor),
+		A: col.A,
+	}
+}
+
+// BoxShadow is one layer of the box-shadow property.
+type BoxShadow struct {
+	Inset   bool
+	OffsetX float64
+	OffsetY float64
+	Blur    float64
+	Spread  float64
+	Color   color.RGBA
+}
+
+// BoxShadowCommand paints one box shadow. Outer shadows are clipped out of the
+// border box; inset shadows are clipped to the padding box.
+type BoxShadowCommand struct {
+	Shadow       BoxShadow
+	BorderShape  RoundedRect
+	PaddingShape RoundedRect
+}
+
+// maxShadowSigma is the largest blur, in cells of its mask, a shadow is
+// blurred with. Larger blurs are blurred over a coarser mask whose cells
+// span several pixels, so the cost of a shadow does not grow with its blur.
+const maxShadowSigma = 8
+
+// Execute paints the shadow.
+func (cmd *BoxShadowCommand) Execute(c *Canvas) {
+	s := cmd.Shadow
+	if s.Color.A == 0 {
+		return
+	}
+	sigma := s.Blur / 2
+	margin := math.Ceil(3*sigma) + 1
+
+	if !s.Inset {
+		shape := cmd.BorderShape.Outset(s.Spread).Translate(s.OffsetX, s.OffsetY)
+		region := shape.Rect.ExpandedBy(layout.EdgeSizes{Top: margin, Right: margin, Bottom: margin, Left: margin})
+		mask := newCoverageMask(c, region, int(margin), sigma, shape.innerRect(), 1, func(px, py int) float64 {
+			return shape.Coverage(px, py)
+		})
+		mask.blur(mask.sigma)
+		mask.composite(c, s.Color, func(px, py int) float64 {
+			return 1 - cmd.BorderShape.Coverage(px, py)
+		})
+		return
+	}
+
+	clip := cmd.PaddingShape
+	hole := clip.Outset(-s.Spread).Translate(s.OffsetX, s.OffsetY)
+	region := clip.Rect.ExpandedBy(layout.EdgeSizes{Top: margin, Right: margin, Bottom: margin, Left: margin})
+	mask := newCoverageMask(c, region, int(margin), sigma, hole.innerRect(), 0, func(px, py int) float64 {
+		return 1 - hole.Coverage(px, py)
+	})
+	mask.blur(mask.sigma)
+	mask.composite(c, s.Color, clip.Coverage)
+}
+
+// coverageMask is an alpha mask over a pixel-aligned region of a canvas.
+type coverageMask struct {
+	x0, y0 int
+	w, h   int
+	alpha  []float64
+	// step is the number of pixels along each axis a cell of the mask
+	// spans, where zero is one
+	step int
+	// sigma is the blur of the mask, in cells
+	sigma float64
+	// The cells from sx0, sy0 up to sx1, sy1 hold solid both before and
+	// after the mask is blurred, so they are neither rasterized nor blurred
+	sx0, sy0, sx1, sy1 int
+	solid              float64
+}
+
+// newCoverageMask rasterizes a coverage function over region, to be blurred
+// with a standard deviation of sigma pixels. The region is limited to the
+// canvas plus the blur margin so off-screen shapes stay cheap. Blurs larger
+// than maxShadowSigma are rasterized over cells of several pixels. Inside
+// solidRect the coverage is solid, so cells too far inside it for the blur
+// to reach an edge are filled directly.
+func newCoverageMask(c *Canvas, region layout.Rect, margin int, sigma float64, solidRect layout.Rect, solid float64, coverage func(px, py int) float64) *coverageMask {
+	x0 := max(int(math.Floor(region.X)), c.X-margin)
+	y0 := max(int(math.Floor(region.Y)), c.Y-margin)
+	x1 := min(int(math.Ceil(region.X+region.Width)), c.X+c.Width+margin)
+	y1 := min(int(math.Ceil(region.Y+region.Height)), c.Y+c.Height+margin)
+	step := 1
+	if sigma > maxShadowSigma {
+		step = int(math.Ceil(sigma / maxShadowSigma))
+	}
+	m := &coverageMask{x0: x0, y0: y0, step: step, sigma: sigma / float64(step), solid: solid}
+	m.w, m.h = max((x1-x0+step-1)/step, 0), max((y1-y0+step-1)/step, 0)
+	m.alpha = make([]float64, m.w*m.h)
+
+	// The cells wholly inside the solid rectangle, less the reach of the
+	// blur
+	reach := blurReach(m.sigma) + 1
+	m.sx0 = max(int(math.Ceil((solidRect.X-float64(x0))/float64(step)))+reach, 0)
+	m.sy0 = max(int(math.Ceil((solidRect.Y-float64(y0))/float64(step)))+reach, 0)
+	m.sx1 = min(int(math.Floor((solidRect.X+solidRect.Width-float64(x0))/float64(step)))-reach, m.w)
+	m.sy1 = min(int(math.Floor((solidRect.Y+solidRect.Height-float64(y0))/float64(step)))-reach, m.h)
+	if m.sx0 >= m.sx1 || m.sy0 >= m.sy1 {
+		m.sx0, m.sy0, m.sx1, m.sy1 = 0, 0, 0, 0
+	}
+
+	// A cell of several pixels averages the coverage of a grid of pixels
+	// spread evenly across it
+	samples := min(step, coverageSamples)
+	for y := 0; y < m.h; y++ {
+		for x := 0; x < m.w; x++ {
+			if m.isSolid(x, y) {
+				m.alpha[y*m.w+x] = solid
+				continue
+			}
+			sum := 0.0
+			for sy := 0; sy < samples; sy++ {
+				py := y0 + y*step + (2*sy+1)*step/(2*samples)
+				for sx := 0; sx < samples; sx++ {
+					sum += coverage(x0+x*step+(2*sx+1)*step/(2*samples), py)
+				}
+			}
+			m.alpha[y*m.w+x] = sum / float64(samples*samples)
+		}
+	}
+	return m
+}
+
+// isSolid reports whether a cell is in the solid part of the mask.
+func (m *coverageMask) isSolid(x, y int) bool {
+	return x >= m.sx0 && x < m.sx1 && y >= m.sy0 && y < m.sy1
+}
+
+// blurReach returns how many cells far the blur with a standard deviation
+// of sigma cells carries the value of a cell.
+func blurReach(sigma float64) int {
+	if sigma <= 0 {
+		return 0
+	}
+	reach := 0
+	for _, size := range boxBlurSizes(sigma, 3) {
+		reach += max((size-1)/2, 0)
+	}
+	return reach
+}
+
+// blur applies an approximate Gaussian blur with three successive box blurs.
+// The passes alternate between two buffers that both hold the solid cells,
+// so the passes can leave those be.
+func (m *coverageMask) blur(sigma float64) {
+	if sigma <= 0 || m.w == 0 || m.h == 0 {
+		return
+	}
+	tmp := make([]float64, len(m.alpha))
+	copy(tmp, m.alpha)
+	for _, size := range boxBlurSizes(sigma, 3) {
+		radius := (size - 1) / 2
+		if radius <= 0 {
+			continue
+		}
+		m.boxBlurHorizontal(m.alpha, tmp, radius)
+		m.boxBlurVertical(tmp, m.alpha, radius)
+	}
+}
+
+// composite blends a color through the mask, further scaled by clip coverage.
+// A mask of cells wider than a pixel is interpolated between the centers of
+// its cells.
+func (m *coverageMask) composite(c *Canvas, col color.RGBA, clip func(px, py int) float64) {
+	step := max(m.step, 1)
+	// Pixels whose cell and neighboring cells are transparent solid cells
+	// are skipped
+	skipX0, skipX1 := m.x0+(m.sx0+1)*step, m.x0+(m.sx1-1)*step
+	skipY0, skipY1 := m.y0+(m.sy0+1)*step, m.y0+(m.sy1-1)*step
+	for py := max(m.y0, c.Y); py < min(m.y0+m.h*step, c.Y+c.Height); py++ {
+		for px := max(m.x0, c.X); px < min(m.x0+m.w*step, c.X+c.Width); px++ {
+			if m.solid <= 0 && py >= skipY0 && py < skipY1 && px >= skipX0 && px < skipX1 {
+				px = skipX1 - 1
+				continue
+			}
+			a := m.at(px, py, step)
+			if a <= 0 {
+				continue
+			}
+			c.BlendPixelCoverage(px, py, col, a*clip(px, py))
+		}
+	}
+}
+
+// at returns the value of the mask at a pixel.
+func (m *coverageMask) at(px, py, step int) float64 {
+	if step == 1 {
+		return m.alpha[(py-m.y0)*m.w+px-m.x0]
+	}
+	fx := (float64(px-m.x0)+0.5)/float64(step) - 0.5
+	fy := (float64(py-m.y0)+0.5)/float64(step) - 0.5
+	x, y := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x), fy-float64(y)
+	cell := func(x, y int) float64 {
+		return m.alpha[min(max(y, 0), m.h-1)*m.w+min(max(x, 0), m.w-1)]
+	}
+	top := cell(x, y)*(1-tx) + cell(x+1, y)*tx
+	bottom := cell(x, y+1)*(1-tx) + cell(x+1, y+1)*tx
+	return top*(1-ty) + bottom*ty
+}
+
+// boxBlurSizes returns n odd box sizes whose successive application approximates
+// a Gaussian with standard deviation sigma.
+// Reference: https://www.w3.org/TR/filter-effects-1/#feGaussianBlurElement
+func boxBlurSizes(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	lower := int(math.Floor(ideal))
+	if lower%2 == 0 {
+		lower--
+	}
+	upper := lower + 2
+	mIdeal := (12*sigma*sigma - float64(n*lower*lower) - 4*float64(n*lower) - 3*float64(n)) / (-4*float64(lower) - 4)
+	m := int(math.Round(mIdeal))
+	sizes := make([]int, n)
+	for i := range sizes {
+		if i < m {
+			sizes[i] = lower
+		} else {
+			sizes[i] = upper
+		}
+	}
+	return sizes
+}
+
+// boxBlurHorizontal blurs the rows of a mask from src into dst with a box
+// of 2*radius+1 cells, skipping the solid cells.
+func (m *coverageMask) boxBlurHorizontal(src, dst []float64, radius int) {
+	w, h := m.w, m.h
+	norm := 1 / float64(2*radius+1)
+	for y := 0; y < h; y++ {
+		row := src[y*w : (y+1)*w]
+		skip := y >= m.sy0 && y < m.sy1
+		x := 0
+		for x < w {
+			// The sum of the window around x
+			sum := 0.0
+			for i := x - radius; i <= x+radius; i++ {
+				if i >= 0 && i < w {
+					sum += row[i]
+				}
+			}
+			for ; x < w; x++ {
+				if skip && x == m.sx0 {
+					x = m.sx1
+					break
+				}
+				dst[y*w+x] = sum * norm
+				if out := x - radius; out >= 0 {
+					sum -= row[out]
+				}
+				if in := x + radius + 1; in < w {
+					sum += row[in]
+				}
+			}
+		}
+	}
+}
+
+// boxBlurVertical blurs the columns of a mask from src into dst with a box
+// of 2*radius+1 cells, skipping the solid cells. The sums of the windows of
+// all columns move down a row at a time, to read the mask in order.
+func (m *coverageMask) boxBlurVertical(src, dst []float64, radius int) {
+	w, h := m.w, m.h
+	norm := 1 / float64(2*radius+1)
+	sums := make([]float64, w)
+	for y := 0; y <= radius && y < h; y++ {
+		for x, v := range src[y*w : (y+1)*w] {
+			sums[x] += v
+		}
+	}
+	for y := 0; y < h; y++ {
+		row := dst[y*w : (y+1)*w]
+		if y >= m.sy0 && y < m.sy1 {
+			for x := 0; x < m.sx0; x++ {
+				row[x] = sums[x] * norm
+			}
+			for x := m.sx1; x < w; x++ {
+				row[x] = sums[x] * norm
+			}
+		} else {
+			for x := range row {
+				row[x] = sums[x] * norm
+			}
+		}
+		if out := y - radius; out >= 0 {
+			for x, v := range src[out*w : (out+1)*w] {
+				sums[x] -= v
+			}
+		}
+		if in := y + radius + 1; in < h {
+			for x, v := range src[in*w : (in+1)*w] {
+				sums[x] += v
+			}
+		}
+	}
+}
+
+// paintBoxShadows paints either the outer or the inset shadows of a box.
+// Shadows are listed front to back, so they are painted in reverse order.
+func (c *Canvas) paintBoxShadows(box *layout.LayoutBox, ctx *PaintContext, inset bool) {
+	style := box.ComputedStyle
+	if style == nil {
+		return
+	}
+	shadows := parseBoxShadows(style)
+	if len(shadows) == 0 {
+		return
+	}
+	borderShape := borderBoxShape(box)
+	paddingShape := borderShape.Inset(box.Dimensions.Border)
+	for i := len(shadows) - 1; i >= 0; i-- {
+		if shadows[i].Inset != inset {
+			continue
+		}
+		ctx.DisplayList = append(ctx.DisplayList, &BoxShadowCommand{
+			Shadow:       shadows[i],
+			BorderShape:  borderShape,
+			PaddingShape: paddingShape,
+		})
+	}
+}
+
+// paintOutline paints the outline of a box outside its border edge.
+func (c *Canvas) paintOutline(box *layout.LayoutBox, ctx *PaintContext) {
+	style := box.ComputedStyle
+	if style == nil {
+		return
+	}
+	outlineStyle, width, col, offset := resolveOutline(style)
+	if outlineStyle == "none" || outlineStyle == "hidden" || width <= 0 || col.A == 0 {
+		return
+	}
+	if outlineStyle == "auto" {
+		outlineStyle = "solid"
+	}
+	inner := borderBoxShape(box).Outset(offset)
+	outer := inner.Outset(width)
+	ctx.DisplayList = append(ctx.DisplayList, &RoundedBorderCommand{
+		Outer:  outer,
+		Inner:  inner,
+		Widths: layout.EdgeSizes{Top: width, Right: width, Bottom: width, Left: width},
+		Colors: [4]color.RGBA{col, col, col, col},
+		Styles: [4]string{outlineStyle, outlineStyle, outlineStyle, outlineStyle},
+	})
+}
+
+// paintColumnRules paints the rules between adjacent columns of a
+// multi-column container, centred in the gaps. Rules take no space, and are
+// only drawn between columns that both have content.
+// Reference: https://www.w3.org/TR/css-multicol-1/#column-gaps-and-rules
+func (c *Canvas) paintColumnRules(box *layout.LayoutBox, ctx *PaintContext) {
+	if len(box.Columns) < 2 || box.ComputedStyle == nil {
+		return
+	}
+	ruleStyle, width, col := resolveColumnRule(box.ComputedStyle)
+	if ruleStyle == "none" || ruleStyle == "hidden" || width <= 0 || col.A == 0 {
+		return
+	}
+	for i := 1; i < len(box.Columns); i++ {
+		prev, next := box.Columns[i-1], box.Columns[i]
+		if prev.Y != next.Y {
+			continue
+		}
+		left, right := math.Min(prev.X, next.X), math.Max(prev.X, next.X)
+		middle := (left + prev.Width + right) / 2
+		ctx.DisplayList = append(ctx.DisplayList, &BorderCommand{
+			Color:     col,
+			Rect:      layout.Rect{X: middle - width/2, Y: next.Y, Width: width, Height: next.Height},
+			LeftWidth: width,
+			Style:     ruleStyle,
+		})
+	}
+}
+
+// resolveColumnRule computes the column rule of a multi-column container from
+// column-rule and its longhands.
+func resolveColumnRule(style *css.ComputedStyle) (ruleStyle string, width float64, col color.RGBA) {
+	ruleStyle = "none"
+	width = 3 // medium
+	col = getTextColor(style)
+
+	for _, cv := range styleComponents(style, "column-rule") {
+		if c, ok := css.ComponentColor(cv); ok {
+			col = toRGBA(c)
+		} else if ident, ok := css.ComponentIdent(cv); ok {
+			if w, ok := borderWidthKeyword(ident); ok {
+				width = w
+			} else if ident != "currentcolor" {
+				ruleStyle = ident
+			}
+		} else if length, ok := resolveComponentLength(cv, style, 0); ok {
+			width = length
+		}
+	}
+
+	if val := style.GetPropertyValue("column-rule-style"); val != nil && !val.IsInitial && val.Keyword != "" {
+		ruleStyle = strings.ToLower(val.Keyword)
+	}
+	if val := style.GetPropertyValue("column-rule-width"); val != nil && !val.IsInitial {
+		if w, ok := borderWidthKeyword(strings.ToLower(val.Keyword)); ok {
+			width = w
+		} else if val.Keyword == "" {
+			width = val.Length
+		}
+	}
+	if val := style.GetPropertyValue("column-rule-color"); val != nil && !val.IsInitial {
+		if c, ok := resolveColorValue(style, val); ok {
+			col = c
+		}
+	}
+	return ruleStyle, width, col
+}
+
+// borderBoxShape returns the rounded border box of a layout box.
+func borderBoxShape(box *layout.LayoutBox) RoundedRect {
+	borderBox := box.Dimensions.BorderBox()
+	return NewRoundedRect(borderBox, resolveBorderRadii(box.ComputedStyle, borderBox))
+}
+
+// borderRadiusLonghands lists the corner longhands in the order of BorderRadii fields.
+var borderRadiusLonghands = [4]string{
+	"border-top-left-radius",
+	"border-top-right-radius",
+	"border-bottom-right-radius",
+	"border-bottom-left-radius",
+}
+
+// resolveBorderRadii computes the corner radii of a box from border-radius and
+// its longhands. Percentages refer to the border box dimensions.
+func resolveBorderRadii(style *css.ComputedStyle, borderBox layout.Rect) BorderRadii {
+	if style == nil {
+		return BorderRadii{}
+	}
+	var corners [4]CornerRadius
+
+	// Shorthand: 1-4 horizontal radii, optionally "/" and 1-4 vertical radii.
+	if parts := styleComponents(style, "border-radius"); len(parts) > 0 {
+		var horizontal, vertical []css.ComponentValue
+		target := &horizontal
+		for _, cv := range parts {
+			if pt, ok := cv.(css.PreservedToken); ok && pt.Token.Type == css.TokenDelim && pt.Token.Delim == '/' {
+				target = &vertical
+				continue
+			}
+			*target = append(*target, cv)
+		}
+		if len(vertical) == 0 {
+			vertical = horizontal
+		}
+		hx := expandCornerValues(horizontal)
+		vy := expandCornerValues(vertical)
+		for i := 0; i < 4; i++ {
+			if hx[i] == nil || vy[i] == nil {
+				continue
+			}
+			corners[i].X, _ = resolveComponentLength(hx[i], style, borderBox.Width)
+			corners[i].Y, _ = resolveComponentLength(vy[i], style, borderBox.Height)
+		}
+	}
+
+	// Longhands: one or two values each.
+	for i, prop := range borderRadiusLonghands {
+		val := style.GetPropertyValue(prop)
+		if val == nil || val.IsInitial {
+			continue
+		}
+		parts := styleComponents(style, prop)
+		if len(parts) == 0 {
+			continue
+		}
+		x, okX := resolveComponentLength(parts[0], style, borderBox.Width)
+		y := x
+		okY := okX
+		if len(parts) > 1 {
+			y, okY = resolveComponentLength(parts[1], style, borderBox.Height)
+		} else if _, unit, _, _ := css.ComponentNumber(parts[0]); unit == "%" {
+			y, okY = resolveComponentLength(parts[0], style, borderBox.Height)
+		}
+		if okX && okY {
+			corners[i] = CornerRadius{X: x, Y: y}
+		}
+	}
+
+	return BorderRadii{TopLeft: corners[0], TopRight: corners[1], BottomRight: corners[2], BottomLeft: corners[3]}
+}
+
+// expandCornerValues expands 1-4 values to the four corners (top-left, top-right,
+// bottom-right, bottom-left) following the usual shorthand rules.
+func expandCornerValues(values []css.ComponentValue) [4]css.ComponentValue {
+	switch len(values) {
+	case 1:
+		return [4]css.ComponentValue{values[0], values[0], values[0], values[0]}
+	case 2:
+		return [4]css.ComponentValue{values[0], values[1], values[0], values[1]}
+	case 3:
+		return [4]css.ComponentValue{values[0], values[1], values[2], values[1]}
+	case 4:
+		return [4]css.ComponentValue{values[0], values[1], values[2], values[3]}
+	}
+	return [4]css.ComponentValue{}
+}
+
+// parseBoxShadows parses the box-shadow property into shadow layers.
+func parseBoxShadows(style *css.ComputedStyle) []BoxShadow {
+	raw := styleText(style, "box-shadow")
+	if raw == "" || strings.EqualFold(raw, "none") {
+		return nil
+	}
+	var shadows []BoxShadow
+	for _, layer := range css.SplitComponentValuesByComma(css.ParseComponentValueList(raw)) {
+		shadow := BoxShadow{Color: getTextColor(style)}
+		var lengths []float64
+		for _, cv := range css.NonWhitespaceComponents(layer) {
+			if ident, ok := css.ComponentIdent(cv); ok && ident == "inset" {
+				shadow.Inset = true
+				continue
+			}
+			if col, ok := css.ComponentColor(cv); ok {
+				shadow.Color = toRGBA(col)
+				continue
+			}
+			if length, ok := resolveComponentLength(cv, style, 0); ok {
+				lengths = append(lengths, length)
+			}
+		}
+		if len(lengths) < 2 {
+			continue
+		}
+		shadow.OffsetX, shadow.OffsetY = lengths[0], lengths[1]
+		if len(lengths) > 2 {
+			shadow.Blur = math.Max(0, lengths[2])
+		}
+		if len(lengths) > 3 {
+			shadow.Spread = lengths[3]
+		}
+		shadows = append(shadows, shadow)
+	}
+	return shadows
+}
+
+// resolveOutline returns the used outline style, width, color and offset,
+// combining the outline shorthand with its longhands.
+func resolveOutline(style *css.ComputedStyle) (outlineStyle string, width float64, col color.RGBA, offset float64) {
+	outlineStyle = "none"
+	width = 3 // medium
+	col = getTextColor(style)
+
+	for _, cv := range styleComponents(style, "outline") {
+		if c, ok := css.ComponentColor(cv); ok {
+			col = toRGBA(c)
+		} else if ident, ok := css.ComponentIdent(cv); ok {
+			if w, ok := borderWidthKeyword(ident); ok {
+				width = w
+			} else if ident != "currentcolor" && ident != "invert" {
+				outlineStyle = ident
+			}
+		} else if length, ok := resolveComponentLength(cv, style, 0); ok {
+			width = length
+		}
+	}
+
+	if val := style.GetPropertyValue("outline-style"); val != nil && !val.IsInitial && val.Keyword != "" {
+		outlineStyle = strings.ToLower(val.Keyword)
+	}
+	if val := style.GetPropertyValue("outline-width"); val != nil && !val.IsInitial {
+		if w, ok := borderWidthKeyword(strings.ToLower(val.Keyword)); ok {
+			width = w
+		} else if val.Keyword == "" {
+			width = val.Length
+		}
+	}
+	if val := style.GetPropertyValue("outline-color"); val != nil && !val.IsInitial {
+		if c, ok := resolveColorValue(style, val); ok {
+			col = c
+		}
+	}
+	if val := style.GetPropertyValue("outline-offset"); val != nil && !val.IsInitial {
+		offset = val.Length
+	}
+	return outlineStyle, width, col, offset
+}
+
+// borderWidthKeyword maps thin/medium/thick to pixels.
+func borderWidthKeyword(keyword string) (float64, bool) {
+	switch keyword {
+	case "thin":
+		return 1, true
+	case "medium":
+		return 3, true
+	case "thick":
+		return 5, true
+	}
+	return 0, false
+}
+
+// styleText returns the source text of a computed property value.
+func styleText(style *css.ComputedStyle, property string) string {
+	if style == nil {
+		return ""
+	}
+	val := style.GetPropertyValue(property)
+	if val == nil {
+		return ""
+	}
+	if val.Keyword != "" {
+		return val.Keyword
+	}
+	return val.Value.Raw
+}
+
+// styleComponents returns the non-whitespace component values of a property.
+func styleComponents(style *css.ComputedStyle, property string) []css.ComponentValue {
+	raw := styleText(style, property)
+	if raw == "" {
+		return nil
+	}
+	return css.NonWhitespaceComponents(css.ParseComponentValueList(raw))
+}
+
+// resolveComponentLength resolves a length or percentage component to pixels
+// against the font sizes and viewport of a style, or the defaults without
+// one. Unitless zero is accepted; percentages resolve against percentBase.
+func resolveComponentLength(cv css.ComponentValue, style *css.ComputedStyle, percentBase float64) (float64, bool) {
+	value, unit, tokType, ok := css.ComponentNumber(cv)
+	if !ok {
+		return 0, false
+	}
+	switch tokType {
+	case css.TokenNumber:
+		return value, value == 0
+	case css.TokenPercentage:
+		return value / 100 * percentBase, true
+	}
+	if style == nil {
+		style = css.NewComputedStyle(nil, nil)
+	}
+	return style.ResolveLength(value, unit), true
+}
+
+// resolveColorValue resolves a computed color value, including named colors,
+// color functions stored as raw text, and currentcolor.
+func resolveColorValue(style *css.ComputedStyle, val *css.ComputedValue) (color.RGBA, bool) {
+	keyword := strings.ToLower(val.Keyword)
+	switch keyword {
+	case "currentcolor":
+		return getTextColor(style), true
+	case "transparent":
+		return color.RGBA{}, true
+	case "":
+	default:
+		if c, ok := css.NamedColors[keyword]; ok {
+			return toRGBA(c), true
+		}
+		return color.RGBA{}, false
+	}
+	if val.Value.Type == css.ColorValue || val.Color != (css.Color{}) {
+		return toRGBA(val.Color), true
+	}
+	if parts := css.NonWhitespaceComponents(css.ParseComponentValueList(val.Value.Raw)); len(parts) == 1 {
+		if c, ok := css.ComponentColor(parts[0]); ok {
+			return toRGBA(c), true
+		}
+	}
+	return color.RGBA{}, false
+}
+
+// toRGBA converts a CSS color to an image color.
+func toRGBA(c css.Color) color.RGBA {
+	return color.RGBA{R: c.R, G: c.G, B: c.B, A: c.A}
+}
+
+// borderSideProperties lists the per-side style and color longhands, clockwise from the top.
+var borderSideProperties = [4][2]string{
+	{"border-top-style", "border-top-color"},
+	{"border-right-style", "border-right-color"},
+	{"border-bottom-style", "border-bottom-color"},
+	{"border-left-style", "border-left-color"},
+}
+
+// borderSides returns the style and color of each border side. Sides whose
+// longhands are absent use the given top values.
+func borderSides(style *css.ComputedStyle, topColor color.RGBA, topStyle string) (colors [4]color.RGBA, styles [4]string) {
+	colors[sideTop], styles[sideTop] = topColor, topStyle
+	for i := sideRight; i <= sideLeft; i++ {
+		colors[i], styles[i] = topColor, topStyle
+		if style.GetPropertyValue(borderSideProperties[i][0]) != nil {
+			styles[i] = getBorderStyle(style, borderSideProperties[i][0])
+		}
+		if style.GetPropertyValue(borderSideProperties[i][1]) != nil {
+			colors[i] = getBorderColor(style, borderSideProperties[i][1])
+		}
+	}
+	return colors, styles
+}
+
+// uniformBorderSides reports whether all four sides share a color and style.
+func uniformBorderSides(colors [4]color.RGBA, styles [4]string) bool {
+	for i := 1; i < 4; i++ {
+		if colors[i] != colors[0] || styles[i] != styles[0] {
+			return false
+		}
+	}
+	return true
+}
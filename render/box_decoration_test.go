@@ -0,0 +1,377 @@
+// Package render tests for border radii, box shadows, outlines and column rules.
+package render
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// rawValue builds a computed value as the cascade stores multi-token declarations.
+func rawValue(text string) *css.ComputedValue {
+	return &css.ComputedValue{Value: css.Value{Type: css.ListValue, Raw: text}}
+}
+
+func TestResolveBorderRadiiShorthand(t *testing.T) {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("border-radius", rawValue("10px 20% / 5px"))
+
+	radii := resolveBorderRadii(style, layout.Rect{Width: 200, Height: 100})
+
+	if radii.TopLeft != (CornerRadius{X: 10, Y: 5}) {
+		t.Errorf("TopLeft = %+v, want {10 5}", radii.TopLeft)
+	}
+	if radii.TopRight != (CornerRadius{X: 40, Y: 5}) {
+		t.Errorf("TopRight = %+v, want {40 5}", radii.TopRight)
+	}
+	if radii.BottomRight != radii.TopLeft || radii.BottomLeft != radii.TopRight {
+		t.Errorf("two-value shorthand should mirror diagonally: %+v", radii)
+	}
+}
+
+func TestResolveBorderRadiiLonghand(t *testing.T) {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("border-radius", &css.ComputedValue{Keyword: "0", IsInitial: true})
+	style.SetPropertyValue("border-bottom-left-radius", rawValue("50%"))
+
+	radii := resolveBorderRadii(style, layout.Rect{Width: 80, Height: 40})
+
+	if radii.BottomLeft != (CornerRadius{X: 40, Y: 20}) {
+		t.Errorf("BottomLeft = %+v, want {40 20}", radii.BottomLeft)
+	}
+	if !radii.TopLeft.IsZero() {
+		t.Errorf("TopLeft = %+v, want square", radii.TopLeft)
+	}
+}
+
+func TestBoxDecorationRelativeLengths(t *testing.T) {
+	// rem resolves against the root font size and vw and vh against the
+	// viewport the style was resolved in
+	doc, err := dom.ParseHTML(`<p id="p">x</p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := css.NewStyleResolver()
+	resolver.AddAuthorStylesheet(css.NewParser(`html { font-size: 20px }
+		p { font-size: 10px; border-radius: 1rem 10vw; box-shadow: 1rem 5vh 2em red }`).Parse())
+	resolver.SetViewport(css.Viewport{Width: 400, Height: 300, DevicePixelRatio: 1})
+	html := resolver.ResolveStyles(doc.DocumentElement(), nil)
+	style := resolver.ResolveStyles(doc.GetElementById("p"), resolver.ResolveStyles(doc.Body(), html))
+
+	radii := resolveBorderRadii(style, layout.Rect{Width: 200, Height: 100})
+	if radii.TopLeft != (CornerRadius{X: 20, Y: 20}) || radii.TopRight != (CornerRadius{X: 40, Y: 40}) {
+		t.Errorf("radii = %+v, want 20 and 40", radii)
+	}
+	shadows := parseBoxShadows(style)
+	if len(shadows) != 1 || shadows[0].OffsetX != 20 || shadows[0].OffsetY != 15 || shadows[0].Blur != 20 {
+		t.Errorf("shadows = %+v, want offset 20, 15 and blur 20", shadows)
+	}
+}
+
+func TestParseBoxShadows(t *testing.T) {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("color", &css.ComputedValue{Color: css.Color{R: 0, G: 0, B: 255, A: 255}})
+	style.SetPropertyValue("box-shadow", rawValue("2px 3px 4px 1px rgba(0, 0, 0, 0.5), inset 0 0 5px"))
+
+	shadows := parseBoxShadows(style)
+	if len(shadows) != 2 {
+		t.Fatalf("got %d shadows, want 2", len(shadows))
+	}
+
+	first := shadows[0]
+	if first.Inset || first.OffsetX != 2 || first.OffsetY != 3 || first.Blur != 4 || first.Spread != 1 {
+		t.Errorf("first shadow = %+v", first)
+	}
+	if first.Color.A != 128 && first.Color.A != 127 {
+		t.Errorf("first shadow alpha = %d, want ~128", first.Color.A)
+	}
+
+	second := shadows[1]
+	if !second.Inset || second.Blur != 5 {
+		t.Errorf("second shadow = %+v", second)
+	}
+	if second.Color != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("shadow without color should use currentcolor, got %v", second.Color)
+	}
+}
+
+func TestParseBoxShadowsNone(t *testing.T) {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("box-shadow", &css.ComputedValue{Keyword: "none"})
+
+	if shadows := parseBoxShadows(style); len(shadows) != 0 {
+		t.Errorf("got %d shadows, want 0", len(shadows))
+	}
+}
+
+func TestResolveOutline(t *testing.T) {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("outline", rawValue("2px dashed red"))
+	style.SetPropertyValue("outline-offset", &css.ComputedValue{Length: 4})
+
+	outlineStyle, width, col, offset := resolveOutline(style)
+	if outlineStyle != "dashed" || width != 2 || offset != 4 {
+		t.Errorf("resolveOutline = %q, %v, offset %v", outlineStyle, width, offset)
+	}
+	if col != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("outline color = %v, want red", col)
+	}
+}
+
+func TestPaintRoundedBackground(t *testing.T) {
+	canvas := NewCanvas(100, 100)
+	red := color.RGBA{255, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-color", &css.ComputedValue{Color: css.Color{R: 255, A: 255}})
+	style.SetPropertyValue("border-radius", rawValue("20px"))
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 10, Y: 10, Width: 60, Height: 60},
+		},
+	}
+	canvas.Paint(box)
+
+	if canvas.GetPixel(40, 40) != red {
+		t.Error("center of rounded background should be red")
+	}
+	if canvas.GetPixel(11, 11) != white {
+		t.Errorf("rounded corner pixel = %v, want white", canvas.GetPixel(11, 11))
+	}
+}
+
+func TestPaintBackgroundClip(t *testing.T) {
+	canvas := NewCanvas(100, 100)
+	white := color.RGBA{255, 255, 255, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-color", &css.ComputedValue{Color: css.Color{G: 255, A: 255}})
+	style.SetPropertyValue("background-clip", &css.ComputedValue{Keyword: "content-box"})
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 20, Y: 20, Width: 40, Height: 40},
+			Padding: layout.EdgeSizes{Top: 10, Right: 10, Bottom: 10, Left: 10},
+		},
+	}
+	canvas.Paint(box)
+
+	if canvas.GetPixel(15, 40) != white {
+		t.Error("padding area should not be painted with background-clip: content-box")
+	}
+	if canvas.GetPixel(40, 40) != (color.RGBA{0, 255, 0, 255}) {
+		t.Error("content area should be painted")
+	}
+}
+
+func TestPaintBoxShadow(t *testing.T) {
+	canvas := NewCanvas(100, 100)
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{0, 0, 0, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("box-shadow", rawValue("10px 10px black"))
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 10, Y: 10, Width: 40, Height: 40},
+		},
+	}
+	canvas.Paint(box)
+
+	if canvas.GetPixel(55, 55) != black {
+		t.Errorf("offset shadow pixel = %v, want black", canvas.GetPixel(55, 55))
+	}
+	if canvas.GetPixel(30, 30) != white {
+		t.Error("outer shadow must not paint beneath the border box")
+	}
+}
+
+func TestPaintBlurredInsetShadow(t *testing.T) {
+	canvas := NewCanvas(100, 100)
+	white := color.RGBA{255, 255, 255, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("box-shadow", rawValue("inset 0 0 10px black"))
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 10, Y: 10, Width: 80, Height: 80},
+		},
+	}
+	canvas.Paint(box)
+
+	edge := canvas.GetPixel(10, 50)
+	if edge == white {
+		t.Error("inset shadow should darken the inner edge")
+	}
+	if canvas.GetPixel(50, 50) != white {
+		t.Errorf("center pixel = %v, want untouched", canvas.GetPixel(50, 50))
+	}
+	if canvas.GetPixel(5, 50) != white {
+		t.Error("inset shadow must not paint outside the padding box")
+	}
+}
+
+func TestPaintWideBlurShadow(t *testing.T) {
+	// A wide blur is blurred over a coarse mask; it should still match a
+	// Gaussian blur of the shadow's shape
+	canvas := NewCanvas(300, 300)
+	shape := NewRoundedRect(layout.Rect{X: 100, Y: 100, Width: 100, Height: 100}, BorderRadii{})
+	cmd := &BoxShadowCommand{
+		Shadow:       BoxShadow{Blur: 100, Spread: 20, Color: color.RGBA{0, 0, 0, 255}},
+		BorderShape:  shape,
+		PaddingShape: shape,
+	}
+	cmd.Execute(canvas)
+
+	sigma := 50.0
+	gauss := func(x, a, b float64) float64 {
+		return (math.Erf((x-a)/(sigma*math.Sqrt2)) - math.Erf((x-b)/(sigma*math.Sqrt2))) / 2
+	}
+	for _, p := range [][2]int{{50, 150}, {150, 70}, {60, 60}, {250, 230}, {10, 10}} {
+		x, y := float64(p[0])+0.5, float64(p[1])+0.5
+		want := gauss(x, 80, 220) * gauss(y, 80, 220)
+		got := 1 - float64(canvas.GetPixel(p[0], p[1]).R)/255
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("shadow at %v = %.3f, want %.3f", p, got, want)
+		}
+	}
+}
+
+func TestCoverageMaskSolid(t *testing.T) {
+	// Skipping the solid inside of a shape leaves the blurred mask as it is
+	// when the whole mask is rasterized and blurred
+	canvas := NewCanvas(200, 200)
+	shape := NewRoundedRect(layout.Rect{X: 20, Y: 30, Width: 150, Height: 120}, BorderRadii{TopLeft: CornerRadius{X: 12, Y: 12}})
+	for _, sigma := range []float64{0, 2.5, 6} {
+		region := shape.Rect.ExpandedBy(layout.EdgeSizes{Top: 20, Right: 20, Bottom: 20, Left: 20})
+		skipped := newCoverageMask(canvas, region, 20, sigma, shape.innerRect(), 1, shape.Coverage)
+		full := newCoverageMask(canvas, region, 20, sigma, layout.Rect{}, 1, shape.Coverage)
+		if skipped.sx0 >= skipped.sx1 {
+			t.Fatalf("sigma %v: no solid cells", sigma)
+		}
+		skipped.blur(skipped.sigma)
+		full.blur(full.sigma)
+		for i := range full.alpha {
+			if math.Abs(skipped.alpha[i]-full.alpha[i]) > 1e-9 {
+				t.Fatalf("sigma %v: cell %d = %v, want %v", sigma, i, skipped.alpha[i], full.alpha[i])
+			}
+		}
+	}
+}
+
+func TestPaintOutline(t *testing.T) {
+	canvas := NewCanvas(100, 100)
+	blue := color.RGBA{0, 0, 255, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("outline-style", &css.ComputedValue{Keyword: "solid"})
+	style.SetPropertyValue("outline-width", &css.ComputedValue{Length: 3})
+	style.SetPropertyValue("outline-color", &css.ComputedValue{Color: css.Color{B: 255, A: 255}})
+	style.SetPropertyValue("outline-offset", &css.ComputedValue{Length: 2})
+
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 20, Y: 20, Width: 40, Height: 40},
+		},
+	}
+	canvas.Paint(box)
+
+	// Outline occupies 15..18 to the left of the border box at x=20
+	if canvas.GetPixel(16, 40) != blue {
+		t.Errorf("outline pixel = %v, want blue", canvas.GetPixel(16, 40))
+	}
+	if canvas.GetPixel(19, 40) == blue {
+		t.Error("outline offset gap should not be painted")
+	}
+}
+
+func TestPaintColumnRules(t *testing.T) {
+	canvas := NewCanvas(100, 100)
+	red := color.RGBA{255, 0, 0, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("column-rule", rawValue("2px solid red"))
+
+	// Two columns with a gap at 40..50, then a third on the next row
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 10, Y: 10, Width: 70, Height: 80},
+		},
+		Columns: []layout.Rect{
+			{X: 10, Y: 10, Width: 30, Height: 40},
+			{X: 50, Y: 10, Width: 30, Height: 40},
+			{X: 10, Y: 60, Width: 30, Height: 30},
+		},
+	}
+	canvas.Paint(box)
+
+	if canvas.GetPixel(44, 30) != red || canvas.GetPixel(45, 30) != red {
+		t.Errorf("rule pixels = %v, %v, want red", canvas.GetPixel(44, 30), canvas.GetPixel(45, 30))
+	}
+	if canvas.GetPixel(43, 30) == red || canvas.GetPixel(46, 30) == red {
+		t.Error("rule should be 2px wide")
+	}
+	if canvas.GetPixel(44, 70) == red {
+		t.Error("a column without a neighbour should have no rule")
+	}
+}
+
+func TestRoundedBorderCommandPerSide(t *testing.T) {
+	canvas := NewCanvas(50, 50)
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	outer := NewRoundedRect(layout.Rect{X: 0, Y: 0, Width: 50, Height: 50}, BorderRadii{})
+	widths := layout.EdgeSizes{Top: 5, Right: 5, Bottom: 5, Left: 5}
+	cmd := &RoundedBorderCommand{
+		Outer:  outer,
+		Inner:  outer.Inset(widths),
+		Widths: widths,
+		Colors: [4]color.RGBA{red, green, red, green},
+		Styles: [4]string{"solid", "solid", "none", "solid"},
+	}
+	cmd.Execute(canvas)
+
+	if canvas.GetPixel(25, 2) != red {
+		t.Errorf("top side = %v, want red", canvas.GetPixel(25, 2))
+	}
+	if canvas.GetPixel(47, 25) != green {
+		t.Errorf("right side = %v, want green", canvas.GetPixel(47, 25))
+	}
+	if canvas.GetPixel(25, 47) != white {
+		t.Error("bottom side with style none should not be painted")
+	}
+}
+
+func TestBoxBlurSizes(t *testing.T) {
+	sizes := boxBlurSizes(5, 3)
+	if len(sizes) != 3 {
+		t.Fatalf("got %d sizes, want 3", len(sizes))
+	}
+	for _, s := range sizes {
+		if s%2 == 0 || s < 1 {
+			t.Errorf("box size %d should be odd and positive", s)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements clip-path and mask-image.
+// Reference: https://www.w3.org/TR/css-masking-1/
+package render
+
+import (
+	"math"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// ClipShape is a region used to clip an element and its descendants.
+type ClipShape interface {
+	Contains(x, y float64) bool
+	Bounds() layout.Rect
+}
+
+// Bounds returns the bounding rectangle of the rounded rectangle.
+func (rr RoundedRect) Bounds() layout.Rect {
+	return rr.Rect
+}
+
+// EllipseShape is an axis-aligned ellipse; circles have equal radii.
+type EllipseShape struct {
+	CX, CY float64
+	RX, RY float64
+}
+
+// Contains reports whether a point lies inside the ellipse.
+func (e EllipseShape) Contains(x, y float64) bool {
+	if e.RX <= 0 || e.RY <= 0 {
+		return false
+	}
+	return insideEllipse(x, y, e.CX, e.CY, CornerRadius{X: e.RX, Y: e.RY})
+}
+
+// Bounds returns the bounding rectangle of the ellipse.
+func (e EllipseShape) Bounds() layout.Rect {
+	return layout.Rect{X: e.CX - e.RX, Y: e.CY - e.RY, Width: 2 * e.RX, Height: 2 * e.RY}
+}
+
+// clipShapeCoverage returns the fraction of a pixel inside a clip shape.
+// Pixels whose center and corners agree are treated as fully in or out.
+func clipShapeCoverage(shape ClipShape, px, py int) float64 {
+	if rr, ok := shape.(RoundedRect); ok {
+		return rr.Coverage(px, py)
+	}
+	x, y := float64(px), float64(py)
+	center := shape.Contains(x+0.5, y+0.5)
+	if shape.Contains(x, y) == center && shape.Contains(x+1, y) == center &&
+		shape.Contains(x, y+1) == center && shape.Contains(x+1, y+1) == center {
+		if center {
+			return 1
+		}
+		return 0
+	}
+	return sampleCoverage(px, py, shape.Contains)
+}
+
+// applyClipShape clears everything in a layer outside the clip shape, with
+// anti-aliased edges.
+func applyClipShape(c *Canvas, shape ClipShape) {
+	bounds := shape.Bounds()
+	for py := 0; py < c.Height; py++ {
+		for px := 0; px < c.Width; px++ {
+			idx := py*c.Width + px
+			if c.Pixels[idx].A == 0 {
+				continue
+			}
+			x, y := c.X+px, c.Y+py
+			if float64(x+1) <= bounds.X || float64(y+1) <= bounds.Y ||
+				float64(x) >= bounds.X+bounds.Width || float64(y) >= bounds.Y+bounds.Height {
+				c.Pixels[idx].A = 0
+				continue
+			}
+			if cov := clipShapeCoverage(shape, x, y); cov < 1 {
+				c.Pixels[idx].A = uint8(math.Round(float64(c.Pixels[idx].A) * cov))
+			}
+		}
+	}
+}
+
+// resolveClipPath computes the clip-path shape of a box, or nil if none applies.
+func resolveClipPath(box *layout.LayoutBox) ClipShape {
+	style := box.ComputedStyle
+	if style == nil {
+		return nil
+	}
+	parts := styleComponents(style, "clip-path")
+	if len(parts) == 0 {
+		return nil
+	}
+	if ident, ok := css.ComponentIdent(parts[0]); ok && ident == "none" && len(parts) == 1 {
+		return nil
+	}
+
+	// A basic shape and/or a reference box, in either order
+	var shapeFn *css.Function
+	referenceBox := "border-box"
+	for _, part := range parts {
+		if fn, ok := part.(*css.Function); ok && shapeFn == nil {
+			shapeFn = fn
+			continue
+		}
+		ident, ok := css.ComponentIdent(part)
+		if !ok {
+			return nil
+		}
+		switch ident {
+		case "margin-box", "border-box", "padding-box", "content-box":
+			referenceBox = ident
+		case "fill-box", "stroke-box", "view-box":
+			// SVG reference boxes map to the border box for CSS boxes
+			referenceBox = "border-box"
+		default:
+			return nil
+		}
+	}
+
+	border := borderBoxShape(box)
+	var ref RoundedRect
+	if referenceBox == "margin-box" {
+		ref = NewRoundedRect(box.Dimensions.MarginBox(), BorderRadii{})
+	} else {
+		ref = boxArea(box, border, referenceBox)
+	}
+	if shapeFn == nil {
+		return ref
+	}
+	shape, ok := parseBasicShape(shapeFn, ref.Rect, style)
+	if !ok {
+		return nil
+	}
+	return shape
+}
+
+// parseBasicShape resolves a basic shape function against a reference box.
+// Reference: https://www.w3.org/TR/css-shapes-1/#basic-shape-functions
+func parseBasicShape(fn *css.Function, ref layout.Rect, style *css.ComputedStyle) (ClipShape, bool) {
+	args := css.NonWhitespaceComponents(fn.Values)
+	switch strings.ToLower(fn.Name) {
+	case "inset":
+		return parseInsetShape(args, ref, style)
+	case "circle", "ellipse":
+		return parseEllipseShape(args, ref, style, strings.EqualFold(fn.Name, "circle"))
+	case "polygon":
+		return parsePolygonShape(fn.Values, ref, style)
+	case "path":
+		return parsePathShape(fn.Values, ref)
+	}
+	return nil, false
+}
+
+// parseInsetShape parses inset(<length-percentage>{1,4} [round <border-radius>]?).
+func parseInsetShape(args []css.ComponentValue, ref layout.Rect, style *css.ComputedStyle) (ClipShape, bool) {
+	var offsets []lengthPercentage
+	i := 0
+	for ; i < len(args); i++ {
+		if ident, ok := css.ComponentIdent(args[i]); ok && ident == "round" {
+			break
+		}
+		lp, ok := parseLengthPercentage(args[i], style)
+		if !ok {
+			return nil, false
+		}
+		offsets = append(offsets, lp)
+	}
+	if len(offsets) == 0 || len(offsets) > 4 {
+		return nil, false
+	}
+	// Expand like margin: top, right, bottom, left
+	for len(offsets) < 4 {
+		switch len(offsets) {
+		case 1:
+			offsets = append(offsets, offsets[0])
+		case 2:
+			offsets = append(offsets, offsets[0])
+		case 3:
+			offsets = append(offsets, offsets[1])
+		}
+	}
+	edges := layout.EdgeSizes{
+		Top:    offsets[0].resolve(ref.Height),
+		Right:  offsets[1].resolve(ref.Width),
+		Bottom: offsets[2].resolve(ref.Height),
+		Left:   offsets[3].resolve(ref.Width),
+	}
+	rect := layout.Rect{
+		X:      ref.X + edges.Left,
+		Y:      ref.Y + edges.Top,
+		Width:  math.Max(0, ref.Width-edges.Left-edges.Right),
+		Height: math.Max(0, ref.Height-edges.Top-edges.Bottom),
+	}
+
+	var radii BorderRadii
+	if i < len(args) {
+		radiusStyle := css.NewComputedStyle(nil, style)
+		radiusStyle.SetPropertyValue("border-radius", &css.ComputedValue{
+			Value: css.Value{Type: css.ListValue, Raw: css.SerializeComponentValues(args[i+1:])},
+		})
+		radiusStyle.SetPropertyValue("font-size", &css.ComputedValue{Length: getFontSize(style)})
+		radii = resolveBorderRadii(radiusStyle, rect)
+	}
+	return NewRoundedRect(rect, radii), true
+}
+
+// parseEllipseShape parses circle() and ellipse().
+func parseEllipseShape(args []css.ComponentValue, ref layout.Rect, style *css.ComputedStyle, circle bool) (ClipShape, bool) {
+	center := centerPosition
+	var radii []css.ComponentValue
+	for i, arg := range args {
+		if ident, ok := css.ComponentIdent(arg); ok && ident == "at" {
+			pos, ok := parsePosition(args[i+1:], style)
+			if !ok {
+				return nil, false
+			}
+			center = pos
+			break
+		}
+		radii = append(radii, arg)
+	}
+	if (circle && len(radii) > 1) || (!circle && len(radii) != 0 && len(radii) != 2) {
+		return nil, false
+	}
+
+	cx := center.X.resolve(ref.Width, 0)
+	cy := center.Y.resolve(ref.Height, 0)
+	left, right := cx, ref.Width-cx
+	top, bottom := cy, ref.Height-cy
+
+	// resolveRadius resolves a <shape-radius> along one axis; the reference
+	// length for circle percentages is the normalized diagonal.
+	resolveRadius := func(cv css.ComponentValue, near, far, base float64) (float64, bool) {
+		if ident, ok := css.ComponentIdent(cv); ok {
+			switch ident {
+			case "closest-side":
+				return math.Min(near, far), true
+			case "farthest-side":
+				return math.Max(near, far), true
+			}
+			return 0, false
+		}
+		lp, ok := parseLengthPercentage(cv, style)
+		if !ok || lp.Value < 0 {
+			return 0, false
+		}
+		return lp.resolve(base), true
+	}
+
+	shape := EllipseShape{CX: ref.X + cx, CY: ref.Y + cy}
+	if circle {
+		if len(radii) == 0 {
+			r := math.Min(math.Min(left, right), math.Min(top, bottom))
+			shape.RX, shape.RY = r, r
+			return shape, true
+		}
+		diagonal := math.Hypot(ref.Width, ref.Height) / math.Sqrt2
+		if ident, ok := css.ComponentIdent(radii[0]); ok {
+			var r float64
+			switch ident {
+			case "closest-side":
+				r = math.Min(math.Min(left, right), math.Min(top, bottom))
+			case "farthest-side":
+				r = math.Max(math.Max(left, right), math.Max(top, bottom))
+			default:
+				return nil, false
+			}
+			shape.RX, shape.RY = r, r
+			return shape, true
+		}
+		r, ok := resolveRadius(radii[0], 0, 0, diagonal)
+		if !ok {
+			return nil, false
+		}
+		shape.RX, shape.RY = r, r
+		return shape, true
+	}
+
+	if len(radii) == 0 {
+		shape.RX = math.Min(left, right)
+		shape.RY = math.Min(top, bottom)
+		return shape, true
+	}
+	rx, okX := resolveRadius(radii[0], left, right, ref.Width)
+	ry, okY := resolveRadius(radii[1], top, bottom, ref.Height)
+	if !okX || !okY {
+		return nil, false
+	}
+	shape.RX, shape.RY = rx, ry
+	return shape, true
+}
+
+// parseFillRule reads an optional leading fill rule argument.
+func parseFillRule(arg []css.ComponentValue) (FillRule, bool) {
+	parts := css.NonWhitespaceComponents(arg)
+	if len(parts) != 1 {
+		return FillRuleNonZero, false
+	}
+	switch ident, _ := css.ComponentIdent(parts[0]); ident {
+	case "nonzero":
+		return FillRuleNonZero, true
+	case "evenodd":
+		return FillRuleEvenOdd, true
+	}
+	return FillRuleNonZero, false
+}
+
+// parsePolygonShape parses polygon([<fill-rule>,]? [<length-percentage>{2}]#).
+func parsePolygonShape(values []css.ComponentValue, ref layout.Rect, style *css.ComputedStyle) (ClipShape, bool) {
+	args := css.SplitComponentValuesByComma(values)
+	rule, hasRule := parseFillRule(args[0])
+	if hasRule {
+		args = args[1:]
+	}
+	points := make([]Point, 0, len(args))
+	for _, arg := range args {
+		parts := css.NonWhitespaceComponents(arg)
+		if len(parts) != 2 {
+			return nil, false
+		}
+		x, okX := parseLengthPercentage(parts[0], style)
+		y, okY := parseLengthPercentage(parts[1], style)
+		if !okX || !okY {
+			return nil, false
+		}
+		points = append(points, Point{X: ref.X + x.resolve(ref.Width), Y: ref.Y + y.resolve(ref.Height)})
+	}
+	if len(points) < 3 {
+		return nil, false
+	}
+	return NewPolygonPath(points, rule), true
+}
+
+// parsePathShape parses path([<fill-rule>,]? <string>), with coordinates
+// relative to the reference box.
+func parsePathShape(values []css.ComponentValue, ref layout.Rect) (ClipShape, bool) {
+	args := css.SplitComponentValuesByComma(values)
+	rule, hasRule := parseFillRule(args[0])
+	if hasRule {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return nil, false
+	}
+	parts := css.NonWhitespaceComponents(args[0])
+	if len(parts) != 1 {
+		return nil, false
+	}
+	pt, ok := parts[0].(css.PreservedToken)
+	if !ok || pt.Token.Type != css.TokenString {
+		return nil, false
+	}
+	path, err := ParsePathData(pt.Token.Value, rule)
+	if err != nil && len(path.Subpaths) == 0 {
+		return nil, false
+	}
+	return path.Transform(func(p Point) Point {
+		return Point{X: p.X + ref.X, Y: p.Y + ref.Y}
+	}), true
+}
+
+// Mask multiplies a layer's alpha by the mask-image layers.
+type Mask struct {
+	Layers []maskLayer
+}
+
+// maskLayer is one resolved mask-image layer.
+type maskLayer struct {
+	Image     *Gradient
+	Tile      layout.Rect
+	StepX     float64
+	StepY     float64
+	Clip      RoundedRect
+	Luminance bool
+	Composite string // add, subtract, intersect or exclude
+	// Opaque marks layers whose image cannot be painted (such as url()
+	// images); they leave the content unmasked rather than hiding it.
+	Opaque bool
+}
+
+// Apply masks the layer. Mask layers are combined bottom (last) to top.
+// Reference: https://www.w3.org/TR/css-masking-1/#the-mask-composite
+func (m *Mask) Apply(c *Canvas) {
+	painters := make([]*gradientPainter, len(m.Layers))
+	for i, layer := range m.Layers {
+		if layer.Image != nil && layer.Tile.Width > 0 && layer.Tile.Height > 0 {
+			painters[i] = layer.Image.painterFor(layer.Tile.Width, layer.Tile.Height)
+		}
+	}
+	for py := 0; py < c.Height; py++ {
+		for px := 0; px < c.Width; px++ {
+			idx := py*c.Width + px
+			if c.Pixels[idx].A == 0 {
+				continue
+			}
+			mask := 0.0
+			for i := len(m.Layers) - 1; i >= 0; i-- {
+				value := m.Layers[i].valueAt(painters[i], c.X+px, c.Y+py)
+				if i == len(m.Layers)-1 {
+					mask = value
+					continue
+				}
+				// Compose the (upper) source layer with the result so far
+				switch m.Layers[i].Composite {
+				case "subtract":
+					mask = value * (1 - mask)
+				case "intersect":
+					mask = value * mask
+				case "exclude":
+					mask = value*(1-mask) + mask*(1-value)
+				default:
+					mask = value + mask*(1-value)
+				}
+			}
+			if mask < 1 {
+				c.Pixels[idx].A = uint8(math.Round(float64(c.Pixels[idx].A) * mask))
+			}
+		}
+	}
+}
+
+// valueAt returns the mask value (0..1) of one layer at a pixel.
+func (layer maskLayer) valueAt(painter *gradientPainter, px, py int) float64 {
+	if layer.Opaque {
+		return 1
+	}
+	if painter == nil {
+		// mask-image: none counts as a transparent black image layer
+		return 0
+	}
+	tx, ok := tileOffset(float64(px)+0.5-layer.Tile.X, layer.StepX, layer.Tile.Width)
+	if !ok {
+		return 0
+	}
+	ty, ok := tileOffset(float64(py)+0.5-layer.Tile.Y, layer.StepY, layer.Tile.Height)
+	if !ok {
+		return 0
+	}
+	coverage := layer.Clip.Coverage(px, py)
+	if coverage <= 0 {
+		return 0
+	}
+	col := painter.colorAt(tx, ty)
+	value := float64(col.A) / 255
+	if layer.Luminance {
+		value *= (0.2125*float64(col.R) + 0.7154*float64(col.G) + 0.0721*float64(col.B)) / 255
+	}
+	return value * coverage
+}
+
+// resolveMask builds the mask of a box from mask-image and related
+// properties, or nil if no layer has a paintable mask image.
+func resolveMask(box *layout.LayoutBox) *Mask {
+	style := box.ComputedStyle
+	if style == nil {
+		return nil
+	}
+	layers := parseLayers(style, layerProperties{
+		Image:    "mask-image",
+		Size:     "mask-size",
+		Position: "mask-position",
+		Repeat:   "mask-repeat",
+		Origin:   "mask-origin",
+		Clip:     "mask-clip",
+	}, "border-box")
+	if !hasBackgroundImage(layers) {
+		return nil
+	}
+	modes := styleLayerValues(style, "mask-mode")
+	composites := styleLayerValues(style, "mask-composite")
+
+	border := borderBoxShape(box)
+	mask := &Mask{}
+	for i, layer := range layers {
+		ml := maskLayer{Image: layer.Image, Composite: "add", Opaque: layer.Unsupported}
+		if v := cycleLayer(modes, i); len(v) == 1 {
+			ident, _ := css.ComponentIdent(v[0])
+			ml.Luminance = ident == "luminance"
+		}
+		if v := cycleLayer(composites, i); len(v) == 1 {
+			if ident, ok := css.ComponentIdent(v[0]); ok {
+				ml.Composite = ident
+			}
+		}
+		if layer.Image != nil {
+			area := boxArea(box, border, layer.Origin).Rect
+			ml.Tile, ml.StepX, ml.StepY = layer.placeTile(area)
+			ml.Clip = boxArea(box, border, layer.Clip)
+		}
+		mask.Layers = append(mask.Layers, ml)
+	}
+	return mask
+}
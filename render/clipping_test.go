@@ -0,0 +1,150 @@
+// Package render tests for clip-path shapes and mask images.
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// clipBox builds a 100x100 box at (10, 10) with 10px padding and the given
+// clip-path value.
+func clipBox(clipPath string) *layout.LayoutBox {
+	box := compositingBox(layout.Rect{X: 20, Y: 20, Width: 80, Height: 80}, css.Color{R: 255, A: 255},
+		map[string]string{"clip-path": clipPath})
+	box.Dimensions.Padding = layout.EdgeSizes{Top: 10, Right: 10, Bottom: 10, Left: 10}
+	return box
+}
+
+func TestResolveClipPathShapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		inside  [][2]float64
+		outside [][2]float64
+	}{
+		{"none", "none", nil, nil},
+		{"inset", "inset(10px 20px)", [][2]float64{{35, 25}, {85, 95}}, [][2]float64{{25, 50}, {50, 15}}},
+		{"inset round", "inset(0 round 20px)", [][2]float64{{60, 60}, {30, 15}}, [][2]float64{{11, 11}, {109, 109}}},
+		{"circle", "circle(50px at 50% 50%)", [][2]float64{{60, 60}, {60, 15}}, [][2]float64{{15, 15}}},
+		{"circle closest-side", "circle(closest-side at 30px 50%)", [][2]float64{{40, 60}}, [][2]float64{{75, 60}}},
+		{"ellipse", "ellipse(50% 25% at center)", [][2]float64{{15, 60}, {60, 40}}, [][2]float64{{60, 30}}},
+		{"polygon", "polygon(50% 0, 100% 100%, 0 100%)", [][2]float64{{60, 80}}, [][2]float64{{20, 20}, {100, 20}}},
+		{"path", "path(evenodd, 'M0 0 H100 V100 H0 Z M25 25 H75 V75 H25 Z')", [][2]float64{{15, 15}}, [][2]float64{{60, 60}}},
+		{"content-box", "content-box", [][2]float64{{50, 50}}, [][2]float64{{15, 15}}},
+		{"shape in padding-box", "circle(10px) padding-box", [][2]float64{{60, 60}}, [][2]float64{{60, 45}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shape := resolveClipPath(clipBox(tt.value))
+			if tt.inside == nil && tt.outside == nil {
+				if shape != nil {
+					t.Errorf("shape = %v, want nil", shape)
+				}
+				return
+			}
+			if shape == nil {
+				t.Fatal("shape = nil")
+			}
+			for _, p := range tt.inside {
+				if !shape.Contains(p[0], p[1]) {
+					t.Errorf("(%v, %v) should be inside", p[0], p[1])
+				}
+			}
+			for _, p := range tt.outside {
+				if shape.Contains(p[0], p[1]) {
+					t.Errorf("(%v, %v) should be outside", p[0], p[1])
+				}
+			}
+		})
+	}
+}
+
+func TestResolveClipPathInvalid(t *testing.T) {
+	for _, value := range []string{"circle(foo)", "polygon(10px)", "path('L 10 10')", "banana"} {
+		if shape := resolveClipPath(clipBox(value)); shape != nil {
+			t.Errorf("resolveClipPath(%q) = %v, want nil", value, shape)
+		}
+	}
+}
+
+func TestClipPathPainting(t *testing.T) {
+	canvas := NewCanvas(120, 120)
+	box := clipBox("circle(50%)")
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{box}}
+
+	canvas.Paint(root)
+
+	if got := canvas.GetPixel(60, 60); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("center = %v, want red", got)
+	}
+	if got := canvas.GetPixel(14, 14); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("corner = %v, want clipped to white", got)
+	}
+}
+
+func TestMaskImageGradient(t *testing.T) {
+	canvas := NewCanvas(100, 20)
+	box := compositingBox(layout.Rect{Width: 100, Height: 20}, css.Color{A: 255}, map[string]string{
+		"mask-image": "linear-gradient(to right, black, transparent)",
+	})
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{box}}
+
+	canvas.Paint(root)
+
+	if got := canvas.GetPixel(0, 10); !colorNear(got, color.RGBA{0, 0, 0, 255}, 4) {
+		t.Errorf("left = %v, want nearly black", got)
+	}
+	if got := canvas.GetPixel(50, 10); !colorNear(got, color.RGBA{128, 128, 128, 255}, 4) {
+		t.Errorf("middle = %v, want half masked", got)
+	}
+	if got := canvas.GetPixel(99, 10); !colorNear(got, color.RGBA{255, 255, 255, 255}, 4) {
+		t.Errorf("right = %v, want nearly white", got)
+	}
+}
+
+func TestMaskComposite(t *testing.T) {
+	tile := layout.Rect{Width: 10, Height: 10}
+	full := maskLayer{Opaque: true, Tile: tile}
+	none := maskLayer{Tile: tile, Clip: NewRoundedRect(tile, BorderRadii{})}
+
+	tests := []struct {
+		composite string
+		want      uint8
+	}{
+		{"add", 255},
+		{"subtract", 255},
+		{"intersect", 0},
+		{"exclude", 255},
+	}
+	for _, tt := range tests {
+		top := full
+		top.Composite = tt.composite
+		c := NewCanvas(10, 10)
+		(&Mask{Layers: []maskLayer{top, none}}).Apply(c)
+		if got := c.GetPixel(5, 5).A; got != tt.want {
+			t.Errorf("%s: alpha = %d, want %d", tt.composite, got, tt.want)
+		}
+	}
+}
+
+func TestMaskUnsupportedImageIsOpaque(t *testing.T) {
+	box := compositingBox(layout.Rect{Width: 10, Height: 10}, css.Color{A: 255}, map[string]string{
+		"mask-image": "url(mask.png), linear-gradient(transparent, transparent)",
+	})
+	mask := resolveMask(box)
+	if mask == nil {
+		t.Fatal("mask = nil")
+	}
+	if len(mask.Layers) != 2 || !mask.Layers[0].Opaque {
+		t.Fatalf("layers = %+v, want an opaque url() layer first", mask.Layers)
+	}
+	c := NewCanvas(10, 10)
+	mask.Apply(c)
+	if got := c.GetPixel(5, 5).A; got != 255 {
+		t.Errorf("alpha = %d, want unmasked", got)
+	}
+}
@@ -0,0 +1,453 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements compositing layers for group opacity, filters and
+// blend modes.
+// Reference: https://www.w3.org/TR/compositing-1/ and https://www.w3.org/TR/filter-effects-1/
+package render
+
+import (
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// NewTransparentCanvas creates a canvas whose pixels are fully transparent,
+// for use as an offscreen compositing layer.
+func NewTransparentCanvas(width, height int) *Canvas {
+	return &Canvas{
+		Pixels: make([]color.RGBA, width*height),
+		Width:  width,
+		Height: height,
+	}
+}
+
+// newLayer creates a transparent layer over the pixels of the canvas from
+// (x0, y0) to (x1, y1), painted in the same coordinates as the canvas.
+func (c *Canvas) newLayer(x0, y0, x1, y1 int) *Canvas {
+	layer := NewTransparentCanvas(max(x1-x0, 0), max(y1-y0, 0))
+	layer.X, layer.Y = x0, y0
+	return layer
+}
+
+// LayerCommand paints a group of commands into an offscreen layer, applies
+// filters, clipping and masking to it and composites it onto the canvas as a
+// single unit.
+type LayerCommand struct {
+	Commands  []DisplayCommand
+	Opacity   float64
+	Filters   []Filter
+	Clip      ClipShape
+	Mask      *Mask
+	BlendMode string
+}
+
+// Execute renders the group and composites it. The layer only covers the
+// part of the canvas the group can paint.
+func (cmd *LayerCommand) Execute(c *Canvas) {
+	x0, y0, x1, y1 := c.X, c.Y, c.X+c.Width, c.Y+c.Height
+	if bounds, ok := cmd.bounds(); ok {
+		x0, y0, x1, y1 = c.pixelBounds(bounds)
+	}
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	layer := c.newLayer(x0, y0, x1, y1)
+	for _, sub := range cmd.Commands {
+		sub.Execute(layer)
+	}
+	for _, f := range cmd.Filters {
+		f.Apply(layer)
+	}
+	if cmd.Clip != nil {
+		applyClipShape(layer, cmd.Clip)
+	}
+	if cmd.Mask != nil {
+		cmd.Mask.Apply(layer)
+	}
+	c.Composite(layer, cmd.Opacity, cmd.BlendMode)
+}
+
+// bounds returns the area the group paints, grown by the reach of its
+// filters and limited to its clip. It is false when a command of the group
+// has no known bounds.
+func (cmd *LayerCommand) bounds() (layout.Rect, bool) {
+	var bounds layout.Rect
+	for _, sub := range cmd.Commands {
+		r, ok := commandBounds(sub)
+		if !ok {
+			return layout.Rect{}, false
+		}
+		bounds = unionRect(bounds, r)
+	}
+	reach := 0.0
+	for _, f := range cmd.Filters {
+		reach += filterReach(f)
+	}
+	bounds = bounds.ExpandedBy(layout.EdgeSizes{Top: reach, Right: reach, Bottom: reach, Left: reach})
+	if cmd.Clip != nil {
+		bounds = intersectRect(bounds, cmd.Clip.Bounds())
+	}
+	return bounds, true
+}
+
+// commandBounds returns the area a display command paints, or false for
+// commands whose bounds are not known.
+func commandBounds(cmd DisplayCommand) (layout.Rect, bool) {
+	switch cmd := cmd.(type) {
+	case *SolidColorCommand:
+		return cmd.Rect, true
+	case *BorderCommand:
+		return cmd.Rect, true
+	case *TextCommand:
+		return cmd.bounds(), true
+	case *RoundedRectCommand:
+		return cmd.Shape.Rect, true
+	case *RoundedBorderCommand:
+		return cmd.Outer.Rect, true
+	case *BoxShadowCommand:
+		s := cmd.Shadow
+		if s.Inset {
+			return cmd.PaddingShape.Rect, true
+		}
+		margin := math.Ceil(3*s.Blur/2) + 1
+		shape := cmd.BorderShape.Outset(s.Spread).Translate(s.OffsetX, s.OffsetY)
+		return shape.Rect.ExpandedBy(layout.EdgeSizes{Top: margin, Right: margin, Bottom: margin, Left: margin}), true
+	case *BackgroundImageCommand:
+		return cmd.Clip.Rect, true
+	case *LayerCommand:
+		return cmd.bounds()
+	}
+	return layout.Rect{}, false
+}
+
+// bounds returns a box around the text. Glyphs may reach past their
+// advances and the line, so it is padded by the font size.
+func (cmd *TextCommand) bounds() layout.Rect {
+	pad := math.Max(cmd.FontSize, 8)
+	// The run spans pen positions from lo to hi along the line
+	pen, lo, hi := 0.0, 0.0, 0.0
+	advance := func(d float64) {
+		pen += d
+		lo, hi = math.Min(lo, pen), math.Max(hi, pen)
+	}
+	if len(cmd.Glyphs) > 0 {
+		for _, g := range cmd.Glyphs {
+			advance(g.XAdvance)
+		}
+	} else {
+		scale := math.Max(cmd.FontSize/7, 1)
+		for _, ch := range cmd.Text {
+			advance(math.Max(6*scale, cmd.FontSize) + cmd.LetterSpacing)
+			if ch == ' ' || ch == 0x00A0 || ch == 0x3000 {
+				advance(cmd.WordSpacing)
+			}
+		}
+	}
+	if cmd.Orientation != "" {
+		top := math.Min(cmd.Y+lo, cmd.Y+cmd.Height-hi)
+		bottom := math.Max(cmd.Y+hi, cmd.Y+cmd.Height-lo)
+		return layout.Rect{X: cmd.X - pad, Y: top - pad, Width: cmd.Width + 2*pad, Height: bottom - top + 2*pad}
+	}
+	return layout.Rect{X: cmd.X + lo - pad, Y: cmd.Y - pad, Width: hi - lo + 2*pad, Height: cmd.Ascent + 3*pad}
+}
+
+// filterReach returns how far a filter can spread the content of a layer.
+func filterReach(f Filter) float64 {
+	switch f := f.(type) {
+	case *BlurFilter:
+		return math.Ceil(3*f.StdDeviation) + 1
+	case *DropShadowFilter:
+		return math.Max(math.Abs(f.OffsetX), math.Abs(f.OffsetY)) + math.Ceil(3*f.StdDeviation) + 1
+	}
+	return 0
+}
+
+// unionRect returns the smallest rectangle containing both rectangles. Empty
+// rectangles are ignored.
+func unionRect(a, b layout.Rect) layout.Rect {
+	if a.Width <= 0 || a.Height <= 0 {
+		return b
+	}
+	if b.Width <= 0 || b.Height <= 0 {
+		return a
+	}
+	x0, y0 := math.Min(a.X, b.X), math.Min(a.Y, b.Y)
+	x1, y1 := math.Max(a.X+a.Width, b.X+b.Width), math.Max(a.Y+a.Height, b.Y+b.Height)
+	return layout.Rect{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+}
+
+// intersectRect returns the overlap of two rectangles, empty when they do
+// not overlap.
+func intersectRect(a, b layout.Rect) layout.Rect {
+	x0, y0 := math.Max(a.X, b.X), math.Max(a.Y, b.Y)
+	x1, y1 := math.Min(a.X+a.Width, b.X+b.Width), math.Min(a.Y+a.Height, b.Y+b.Height)
+	return layout.Rect{X: x0, Y: y0, Width: math.Max(x1-x0, 0), Height: math.Max(y1-y0, 0)}
+}
+
+// Composite draws src over the canvas with the given group opacity and blend
+// mode, over the pixels where the two canvases overlap.
+// Reference: https://www.w3.org/TR/compositing-1/#blending
+func (c *Canvas) Composite(src *Canvas, opacity float64, blendMode string) {
+	blend := blendFunctions[blendMode]
+	x0, y0 := max(c.X, src.X), max(c.Y, src.Y)
+	x1, y1 := min(c.X+c.Width, src.X+src.Width), min(c.Y+c.Height, src.Y+src.Height)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			s := src.Pixels[(y-src.Y)*src.Width+x-src.X]
+			if s.A == 0 {
+				continue
+			}
+			idx := (y-c.Y)*c.Width + x - c.X
+			if blend != nil {
+				b := c.Pixels[idx]
+				if b.A > 0 {
+					s = blendPixel(b, s, blend)
+				}
+			}
+			if opacity < 1 {
+				s.A = uint8(math.Round(float64(s.A) * opacity))
+				if s.A == 0 {
+					continue
+				}
+			}
+			if s.A == 255 {
+				c.Pixels[idx] = s
+			} else {
+				c.SetPixelBlend(x, y, s)
+			}
+		}
+	}
+}
+
+// blendPixel mixes the source color with the blended result according to the
+// backdrop alpha, leaving the source alpha unchanged for the final source-over.
+func blendPixel(backdrop, source color.RGBA, blend blendFunc) color.RGBA {
+	ab := float64(backdrop.A) / 255
+	cb := [3]float64{float64(backdrop.R) / 255, float64(backdrop.G) / 255, float64(backdrop.B) / 255}
+	cs := [3]float64{float64(source.R) / 255, float64(source.G) / 255, float64(source.B) / 255}
+	mixed := blend(cb, cs)
+	channel := func(i int) uint8 {
+		v := (1-ab)*cs[i] + ab*mixed[i]
+		return uint8(math.Round(math.Min(math.Max(v, 0), 1) * 255))
+	}
+	return color.RGBA{R: channel(0), G: channel(1), B: channel(2), A: source.A}
+}
+
+// blendFunc computes the blended color from backdrop and source colors (0..1).
+type blendFunc func(cb, cs [3]float64) [3]float64
+
+// separable lifts a per-channel blend function to a color blend function.
+func separable(f func(cb, cs float64) float64) blendFunc {
+	return func(cb, cs [3]float64) [3]float64 {
+		return [3]float64{f(cb[0], cs[0]), f(cb[1], cs[1]), f(cb[2], cs[2])}
+	}
+}
+
+func blendMultiply(cb, cs float64) float64 { return cb * cs }
+
+func blendScreen(cb, cs float64) float64 { return cb + cs - cb*cs }
+
+func blendHardLight(cb, cs float64) float64 {
+	if cs <= 0.5 {
+		return blendMultiply(cb, 2*cs)
+	}
+	return blendScreen(cb, 2*cs-1)
+}
+
+func blendColorDodge(cb, cs float64) float64 {
+	switch {
+	case cb == 0:
+		return 0
+	case cs == 1:
+		return 1
+	}
+	return math.Min(1, cb/(1-cs))
+}
+
+func blendColorBurn(cb, cs float64) float64 {
+	switch {
+	case cb == 1:
+		return 1
+	case cs == 0:
+		return 0
+	}
+	return 1 - math.Min(1, (1-cb)/cs)
+}
+
+func blendSoftLight(cb, cs float64) float64 {
+	if cs <= 0.5 {
+		return cb - (1-2*cs)*cb*(1-cb)
+	}
+	var d float64
+	if cb <= 0.25 {
+		d = ((16*cb-12)*cb + 4) * cb
+	} else {
+		d = math.Sqrt(cb)
+	}
+	return cb + (2*cs-1)*(d-cb)
+}
+
+// Non-separable blend mode helpers.
+// Reference: https://www.w3.org/TR/compositing-1/#blendingnonseparable
+
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+func clipColor(c [3]float64) [3]float64 {
+	l := lum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	return clipColor([3]float64{c[0] + d, c[1] + d, c[2] + d})
+}
+
+func sat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+func setSat(c [3]float64, s float64) [3]float64 {
+	// Order the channel indices by value
+	iMin, iMid, iMax := 0, 1, 2
+	if c[iMin] > c[iMid] {
+		iMin, iMid = iMid, iMin
+	}
+	if c[iMid] > c[iMax] {
+		iMid, iMax = iMax, iMid
+	}
+	if c[iMin] > c[iMid] {
+		iMin, iMid = iMid, iMin
+	}
+	var out [3]float64
+	if c[iMax] > c[iMin] {
+		out[iMid] = (c[iMid] - c[iMin]) * s / (c[iMax] - c[iMin])
+		out[iMax] = s
+	}
+	return out
+}
+
+// blendFunctions maps mix-blend-mode keywords to blend functions. Normal is
+// absent because it needs no blending step.
+var blendFunctions = map[string]blendFunc{
+	"multiply": separable(blendMultiply),
+	"screen":   separable(blendScreen),
+	"overlay": separable(func(cb, cs float64) float64 {
+		return blendHardLight(cs, cb)
+	}),
+	"darken":      separable(math.Min),
+	"lighten":     separable(math.Max),
+	"color-dodge": separable(blendColorDodge),
+	"color-burn":  separable(blendColorBurn),
+	"hard-light":  separable(blendHardLight),
+	"soft-light":  separable(blendSoftLight),
+	"difference": separable(func(cb, cs float64) float64 {
+		return math.Abs(cb - cs)
+	}),
+	"exclusion": separable(func(cb, cs float64) float64 {
+		return cb + cs - 2*cb*cs
+	}),
+	"hue": func(cb, cs [3]float64) [3]float64 {
+		return setLum(setSat(cs, sat(cb)), lum(cb))
+	},
+	"saturation": func(cb, cs [3]float64) [3]float64 {
+		return setLum(setSat(cb, sat(cs)), lum(cb))
+	},
+	"color": func(cb, cs [3]float64) [3]float64 {
+		return setLum(cs, lum(cb))
+	},
+	"luminosity": func(cb, cs [3]float64) [3]float64 {
+		return setLum(cb, lum(cs))
+	},
+}
+
+// compositingStyle describes how a stacking context is composited.
+type compositingStyle struct {
+	Opacity   float64
+	Filters   []Filter
+	Clip      ClipShape
+	Mask      *Mask
+	BlendMode string
+	Isolate   bool
+}
+
+// needsLayer reports whether the group must be rendered offscreen.
+func (cs compositingStyle) needsLayer() bool {
+	return cs.Opacity < 1 || len(cs.Filters) > 0 || cs.Clip != nil || cs.Mask != nil ||
+		cs.BlendMode != "normal" || cs.Isolate
+}
+
+// resolveCompositingStyle reads opacity, filter, clip-path, mask-image,
+// mix-blend-mode and isolation.
+func resolveCompositingStyle(box *layout.LayoutBox) compositingStyle {
+	cs := compositingStyle{Opacity: 1, BlendMode: "normal"}
+	style := box.ComputedStyle
+	if style == nil {
+		return cs
+	}
+	cs.Opacity = getOpacity(style)
+	cs.Filters = parseFilters(style)
+	cs.Clip = resolveClipPath(box)
+	cs.Mask = resolveMask(box)
+	if mode := strings.ToLower(styleText(style, "mix-blend-mode")); blendFunctions[mode] != nil {
+		cs.BlendMode = mode
+	}
+	cs.Isolate = strings.EqualFold(styleText(style, "isolation"), "isolate")
+	return cs
+}
+
+// getOpacity returns the opacity of an element, clamped to 0..1.
+func getOpacity(style *css.ComputedStyle) float64 {
+	parts := styleComponents(style, "opacity")
+	if len(parts) != 1 {
+		return 1
+	}
+	value, _, tokType, ok := css.ComponentNumber(parts[0])
+	if !ok {
+		return 1
+	}
+	if tokType == css.TokenPercentage {
+		value /= 100
+	}
+	return math.Min(math.Max(value, 0), 1)
+}
+
+// paintStackingContextLayer paints a stacking context, wrapping its display
+// commands in a compositing layer when it has group effects.
+func (c *Canvas) paintStackingContextLayer(sc *StackingContextEntry, ctx *PaintContext) {
+	comp := resolveCompositingStyle(sc.Box)
+	if comp.Opacity == 0 {
+		// Fully transparent groups paint nothing
+		return
+	}
+	if !comp.needsLayer() {
+		c.paintStackingContext(sc, ctx)
+		return
+	}
+
+	outer := ctx.DisplayList
+	ctx.DisplayList = nil
+	c.paintStackingContext(sc, ctx)
+	layer := &LayerCommand{
+		Commands:  ctx.DisplayList,
+		Opacity:   comp.Opacity,
+		Filters:   comp.Filters,
+		Clip:      comp.Clip,
+		Mask:      comp.Mask,
+		BlendMode: comp.BlendMode,
+	}
+	ctx.DisplayList = append(outer, layer)
+}
@@ -0,0 +1,196 @@
+// Package render tests for compositing layers and blend modes.
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// compositingBox builds a stacking context box filled with a solid color.
+func compositingBox(rect layout.Rect, col css.Color, props map[string]string) *layout.LayoutBox {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-color", &css.ComputedValue{Color: col})
+	for prop, value := range props {
+		style.SetPropertyValue(prop, &css.ComputedValue{Keyword: value})
+	}
+	return &layout.LayoutBox{
+		BoxType:           layout.BlockBox,
+		ComputedStyle:     style,
+		IsStackingContext: len(props) > 0,
+		Dimensions:        layout.Dimensions{Content: rect},
+	}
+}
+
+func TestGroupOpacity(t *testing.T) {
+	canvas := NewCanvas(60, 60)
+
+	// Two overlapping opaque children inside a half-transparent group: the
+	// overlap must not show the lower child through the upper one.
+	group := compositingBox(layout.Rect{X: 0, Y: 0, Width: 60, Height: 60}, css.Color{}, map[string]string{"opacity": "0.5"})
+	red := compositingBox(layout.Rect{X: 0, Y: 0, Width: 40, Height: 40}, css.Color{R: 255, A: 255}, nil)
+	blue := compositingBox(layout.Rect{X: 20, Y: 20, Width: 40, Height: 40}, css.Color{B: 255, A: 255}, nil)
+	group.Children = []*layout.LayoutBox{red, blue}
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{group}}
+
+	canvas.Paint(root)
+
+	overlap := canvas.GetPixel(30, 30)
+	if !colorNear(overlap, color.RGBA{128, 128, 255, 255}, 2) {
+		t.Errorf("overlap = %v, want blue at half opacity over white", overlap)
+	}
+	redOnly := canvas.GetPixel(10, 10)
+	if !colorNear(redOnly, color.RGBA{255, 128, 128, 255}, 2) {
+		t.Errorf("red area = %v, want red at half opacity over white", redOnly)
+	}
+}
+
+func TestOpacityZeroPaintsNothing(t *testing.T) {
+	canvas := NewCanvas(20, 20)
+	box := compositingBox(layout.Rect{Width: 20, Height: 20}, css.Color{R: 255, A: 255}, map[string]string{"opacity": "0"})
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{box}}
+
+	canvas.Paint(root)
+
+	if canvas.GetPixel(10, 10) != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel = %v, want untouched", canvas.GetPixel(10, 10))
+	}
+}
+
+func TestMixBlendModeMultiply(t *testing.T) {
+	canvas := NewCanvas(20, 20)
+	backdrop := compositingBox(layout.Rect{Width: 20, Height: 20}, css.Color{R: 255, G: 255, A: 255}, nil)
+	top := compositingBox(layout.Rect{Width: 20, Height: 20}, css.Color{R: 255, B: 255, A: 255}, map[string]string{"mix-blend-mode": "multiply"})
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{backdrop, top}}
+
+	canvas.Paint(root)
+
+	// Yellow multiplied by magenta is red
+	if got := canvas.GetPixel(10, 10); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("pixel = %v, want red", got)
+	}
+}
+
+func TestBlendFunctions(t *testing.T) {
+	cb := [3]float64{0.2, 0.5, 0.8}
+	cs := [3]float64{0.6, 0.5, 0.1}
+
+	if got := blendFunctions["difference"](cb, cs); got[0] < 0.399 || got[0] > 0.401 {
+		t.Errorf("difference red = %v, want 0.4", got[0])
+	}
+	if got := blendFunctions["screen"](cb, cs); got[1] != 0.75 {
+		t.Errorf("screen green = %v, want 0.75", got[1])
+	}
+	// Luminosity keeps the backdrop's hue and takes the source luminance
+	got := blendFunctions["luminosity"](cb, cs)
+	if l := lum(got); l < lum(cs)-1e-9 || l > lum(cs)+1e-9 {
+		t.Errorf("luminosity lum = %v, want %v", l, lum(cs))
+	}
+}
+
+func TestStackingContextNesting(t *testing.T) {
+	inner := &layout.LayoutBox{BoxType: layout.BlockBox, IsStackingContext: true, ZIndex: 1}
+	wrapper := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{inner}}
+	outer := &layout.LayoutBox{BoxType: layout.BlockBox, IsStackingContext: true, Children: []*layout.LayoutBox{wrapper}}
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{outer}}
+
+	contexts := collectStackingContexts(root)
+	if len(contexts) != 3 {
+		t.Fatalf("got %d contexts, want 3", len(contexts))
+	}
+	if len(contexts[0].Children) != 1 || contexts[0].Children[0].Box != outer {
+		t.Error("outer should be the only child of the root context")
+	}
+	outerEntry := contexts[0].Children[0]
+	if len(outerEntry.Children) != 1 || outerEntry.Children[0].Box != inner || outerEntry.Children[0].Parent != outerEntry {
+		t.Error("inner should be nested in the outer context")
+	}
+}
+
+func TestNegativeZIndexPaintsBelowContent(t *testing.T) {
+	canvas := NewCanvas(20, 20)
+	below := compositingBox(layout.Rect{Width: 20, Height: 20}, css.Color{B: 255, A: 255}, map[string]string{"isolation": "isolate"})
+	below.ZIndex = -1
+	content := compositingBox(layout.Rect{Width: 10, Height: 10}, css.Color{R: 255, A: 255}, nil)
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{content, below}}
+
+	canvas.Paint(root)
+
+	if got := canvas.GetPixel(5, 5); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("content = %v, want red over the negative z-index context", got)
+	}
+	if got := canvas.GetPixel(15, 15); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("negative z-index context = %v, want blue", got)
+	}
+}
+
+func TestLayerCoversGroupBounds(t *testing.T) {
+	inner := &LayerCommand{
+		Commands: []DisplayCommand{&SolidColorCommand{Color: color.RGBA{B: 255, A: 255}, Rect: layout.Rect{X: 50, Y: 20, Width: 10, Height: 10}}},
+		Opacity:  0.5,
+		Clip:     RoundedRect{Rect: layout.Rect{X: 50, Y: 20, Width: 6, Height: 10}},
+	}
+	layer := &LayerCommand{
+		Commands: []DisplayCommand{
+			&SolidColorCommand{Color: color.RGBA{R: 255, A: 255}, Rect: layout.Rect{X: 30, Y: 40, Width: 10, Height: 10}},
+			&SolidColorCommand{Color: color.RGBA{G: 255, A: 255}, Rect: layout.Rect{X: -5, Y: 70, Width: 10, Height: 10}},
+			inner,
+		},
+		Opacity: 0.8,
+		Filters: []Filter{
+			&BlurFilter{StdDeviation: 1.5},
+			&DropShadowFilter{OffsetX: 4, OffsetY: -3, StdDeviation: 1, Color: color.RGBA{A: 255}},
+		},
+	}
+
+	canvas := NewCanvas(100, 100)
+	if x0, y0, x1, y1 := canvas.pixelBounds(mustBounds(t, layer)); x0 != 0 || y0 != 6 || x1 != 70 || y1 != 94 {
+		t.Errorf("layer covers (%d, %d)-(%d, %d), want (0, 6)-(70, 94)", x0, y0, x1, y1)
+	}
+	if got := mustBounds(t, inner); got != (layout.Rect{X: 50, Y: 20, Width: 6, Height: 10}) {
+		t.Errorf("clipped group bounds = %v, want its clip", got)
+	}
+	layer.Execute(canvas)
+
+	// A layer over the whole canvas paints the same pixels
+	want := NewCanvas(100, 100)
+	full := NewTransparentCanvas(100, 100)
+	for _, sub := range layer.Commands {
+		sub.Execute(full)
+	}
+	for _, f := range layer.Filters {
+		f.Apply(full)
+	}
+	want.Composite(full, layer.Opacity, "")
+	for i := range want.Pixels {
+		if canvas.Pixels[i] != want.Pixels[i] {
+			t.Fatalf("pixel (%d, %d) = %v, want %v", i%100, i/100, canvas.Pixels[i], want.Pixels[i])
+		}
+	}
+}
+
+func TestLayerOffscreenPaintsNothing(t *testing.T) {
+	canvas := NewCanvas(20, 20)
+	layer := &LayerCommand{
+		Commands: []DisplayCommand{&SolidColorCommand{Color: color.RGBA{R: 255, A: 255}, Rect: layout.Rect{X: 40, Y: 5, Width: 10, Height: 10}}},
+		Opacity:  0.5,
+	}
+	layer.Execute(canvas)
+	for _, px := range canvas.Pixels {
+		if px != (color.RGBA{255, 255, 255, 255}) {
+			t.Fatalf("pixel = %v, want untouched", px)
+		}
+	}
+}
+
+// mustBounds returns the bounds of a layer, failing the test when they are unknown.
+func mustBounds(t *testing.T, layer *LayerCommand) layout.Rect {
+	t.Helper()
+	bounds, ok := layer.bounds()
+	if !ok {
+		t.Fatal("layer bounds unknown")
+	}
+	return bounds
+}
@@ -0,0 +1,284 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements the CSS filter functions applied to compositing
+// layers.
+// Reference: https://www.w3.org/TR/filter-effects-1/#filter-functions
+package render
+
+import (
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// Filter is one filter function applied in place to a layer.
+type Filter interface {
+	Apply(c *Canvas)
+}
+
+// BlurFilter applies a Gaussian blur.
+type BlurFilter struct {
+	StdDeviation float64
+}
+
+// Apply blurs the layer.
+func (f *BlurFilter) Apply(c *Canvas) {
+	blurCanvas(c, f.StdDeviation)
+}
+
+// ColorMatrixFilter applies a 3x3 color matrix plus per-channel offset to
+// every pixel's color, and scales its alpha.
+type ColorMatrixFilter struct {
+	Matrix [3][3]float64
+	Offset float64
+	Alpha  float64
+}
+
+// Apply transforms the colors of the layer.
+func (f *ColorMatrixFilter) Apply(c *Canvas) {
+	for i, px := range c.Pixels {
+		if px.A == 0 {
+			continue
+		}
+		in := [3]float64{float64(px.R) / 255, float64(px.G) / 255, float64(px.B) / 255}
+		var out [3]uint8
+		for row := 0; row < 3; row++ {
+			v := f.Matrix[row][0]*in[0] + f.Matrix[row][1]*in[1] + f.Matrix[row][2]*in[2] + f.Offset
+			out[row] = uint8(math.Round(math.Min(math.Max(v, 0), 1) * 255))
+		}
+		c.Pixels[i] = color.RGBA{R: out[0], G: out[1], B: out[2], A: uint8(math.Round(float64(px.A) * f.Alpha))}
+	}
+}
+
+// DropShadowFilter paints a blurred, offset copy of the layer's alpha mask in
+// a solid color beneath the layer.
+type DropShadowFilter struct {
+	OffsetX, OffsetY float64
+	StdDeviation     float64
+	Color            color.RGBA
+}
+
+// Apply adds the shadow beneath the layer content.
+func (f *DropShadowFilter) Apply(c *Canvas) {
+	shadow := c.newLayer(c.X, c.Y, c.X+c.Width, c.Y+c.Height)
+	dx := int(math.Round(f.OffsetX))
+	dy := int(math.Round(f.OffsetY))
+	for y := 0; y < c.Height; y++ {
+		sy := y - dy
+		if sy < 0 || sy >= c.Height {
+			continue
+		}
+		for x := 0; x < c.Width; x++ {
+			sx := x - dx
+			if sx < 0 || sx >= c.Width {
+				continue
+			}
+			if a := c.Pixels[sy*c.Width+sx].A; a > 0 {
+				col := f.Color
+				col.A = uint8(math.Round(float64(col.A) * float64(a) / 255))
+				shadow.Pixels[y*c.Width+x] = col
+			}
+		}
+	}
+	blurCanvas(shadow, f.StdDeviation)
+	shadow.Composite(c, 1, "normal")
+	copy(c.Pixels, shadow.Pixels)
+}
+
+// blurCanvas blurs all channels of a canvas in premultiplied space.
+func blurCanvas(c *Canvas, sigma float64) {
+	if sigma <= 0 || c.Width == 0 || c.Height == 0 {
+		return
+	}
+	n := len(c.Pixels)
+	var channels [4][]float64
+	for i := range channels {
+		channels[i] = make([]float64, n)
+	}
+	for i, px := range c.Pixels {
+		a := float64(px.A) / 255
+		channels[0][i] = float64(px.R) * a
+		channels[1][i] = float64(px.G) * a
+		channels[2][i] = float64(px.B) * a
+		channels[3][i] = a
+	}
+	for ch := range channels {
+		mask := &coverageMask{w: c.Width, h: c.Height, alpha: channels[ch]}
+		mask.blur(sigma)
+		channels[ch] = mask.alpha
+	}
+	for i := range c.Pixels {
+		a := channels[3][i]
+		if a <= 0 {
+			c.Pixels[i] = color.RGBA{}
+			continue
+		}
+		unpremultiply := func(v float64) uint8 {
+			return uint8(math.Round(math.Min(math.Max(v/a, 0), 255)))
+		}
+		c.Pixels[i] = color.RGBA{
+			R: unpremultiply(channels[0][i]),
+			G: unpremultiply(channels[1][i]),
+			B: unpremultiply(channels[2][i]),
+			A: uint8(math.Round(math.Min(a, 1) * 255)),
+		}
+	}
+}
+
+// identityMatrix is the color matrix that leaves colors unchanged.
+var identityMatrix = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+// scaleMatrix returns a matrix multiplying each channel by s.
+func scaleMatrix(s float64) [3][3]float64 {
+	return [3][3]float64{{s, 0, 0}, {0, s, 0}, {0, 0, s}}
+}
+
+// saturateMatrix returns the feColorMatrix saturate matrix.
+func saturateMatrix(s float64) [3][3]float64 {
+	return [3][3]float64{
+		{0.213 + 0.787*s, 0.715 - 0.715*s, 0.072 - 0.072*s},
+		{0.213 - 0.213*s, 0.715 + 0.285*s, 0.072 - 0.072*s},
+		{0.213 - 0.213*s, 0.715 - 0.715*s, 0.072 + 0.928*s},
+	}
+}
+
+// sepiaMatrix returns the sepia matrix for the given amount.
+func sepiaMatrix(amount float64) [3][3]float64 {
+	a := 1 - amount
+	return [3][3]float64{
+		{0.393 + 0.607*a, 0.769 - 0.769*a, 0.189 - 0.189*a},
+		{0.349 - 0.349*a, 0.686 + 0.314*a, 0.168 - 0.168*a},
+		{0.272 - 0.272*a, 0.534 - 0.534*a, 0.131 + 0.869*a},
+	}
+}
+
+// hueRotateMatrix returns the feColorMatrix hueRotate matrix for an angle in degrees.
+func hueRotateMatrix(degrees float64) [3][3]float64 {
+	rad := degrees * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	return [3][3]float64{
+		{0.213 + cos*0.787 - sin*0.213, 0.715 - cos*0.715 - sin*0.715, 0.072 - cos*0.072 + sin*0.928},
+		{0.213 - cos*0.213 + sin*0.143, 0.715 + cos*0.285 + sin*0.140, 0.072 - cos*0.072 - sin*0.283},
+		{0.213 - cos*0.213 - sin*0.787, 0.715 - cos*0.715 + sin*0.715, 0.072 + cos*0.928 + sin*0.072},
+	}
+}
+
+// parseFilters parses the filter property. An invalid or unsupported function
+// makes the whole list invalid, as if filter were none.
+func parseFilters(style *css.ComputedStyle) []Filter {
+	raw := styleText(style, "filter")
+	if raw == "" || strings.EqualFold(raw, "none") {
+		return nil
+	}
+	var filters []Filter
+	for _, cv := range css.NonWhitespaceComponents(css.ParseComponentValueList(raw)) {
+		fn, ok := cv.(*css.Function)
+		if !ok {
+			return nil
+		}
+		f, ok := parseFilterFunction(fn, style)
+		if !ok {
+			return nil
+		}
+		filters = append(filters, f)
+	}
+	return filters
+}
+
+// parseFilterFunction parses a single filter function.
+func parseFilterFunction(fn *css.Function, style *css.ComputedStyle) (Filter, bool) {
+	args := css.NonWhitespaceComponents(fn.Values)
+	name := strings.ToLower(fn.Name)
+	switch name {
+	case "blur":
+		if len(args) == 0 {
+			return &BlurFilter{}, true
+		}
+		length, ok := resolveComponentLength(args[0], style, 0)
+		if !ok || len(args) > 1 || length < 0 {
+			return nil, false
+		}
+		return &BlurFilter{StdDeviation: length}, true
+	case "hue-rotate":
+		if len(args) == 0 {
+			return &ColorMatrixFilter{Matrix: identityMatrix, Alpha: 1}, true
+		}
+		angle, ok := componentAngle(args[0])
+		if !ok || len(args) > 1 {
+			return nil, false
+		}
+		return &ColorMatrixFilter{Matrix: hueRotateMatrix(angle), Alpha: 1}, true
+	case "drop-shadow":
+		return parseDropShadow(args, style)
+	}
+
+	amount := 1.0
+	if len(args) > 1 {
+		return nil, false
+	}
+	if len(args) == 1 {
+		value, _, tokType, ok := css.ComponentNumber(args[0])
+		if !ok || tokType == css.TokenDimension || value < 0 {
+			return nil, false
+		}
+		if tokType == css.TokenPercentage {
+			value /= 100
+		}
+		amount = value
+	}
+
+	switch name {
+	case "brightness":
+		return &ColorMatrixFilter{Matrix: scaleMatrix(amount), Alpha: 1}, true
+	case "contrast":
+		return &ColorMatrixFilter{Matrix: scaleMatrix(amount), Offset: 0.5 - 0.5*amount, Alpha: 1}, true
+	case "saturate":
+		return &ColorMatrixFilter{Matrix: saturateMatrix(amount), Alpha: 1}, true
+	}
+
+	// The remaining functions clamp their amount to 1
+	amount = math.Min(amount, 1)
+	switch name {
+	case "grayscale":
+		return &ColorMatrixFilter{Matrix: saturateMatrix(1 - amount), Alpha: 1}, true
+	case "sepia":
+		return &ColorMatrixFilter{Matrix: sepiaMatrix(amount), Alpha: 1}, true
+	case "invert":
+		return &ColorMatrixFilter{Matrix: scaleMatrix(1 - 2*amount), Offset: amount, Alpha: 1}, true
+	case "opacity":
+		return &ColorMatrixFilter{Matrix: identityMatrix, Alpha: amount}, true
+	}
+	return nil, false
+}
+
+// parseDropShadow parses drop-shadow(<color>? <length>{2,3}).
+func parseDropShadow(args []css.ComponentValue, style *css.ComputedStyle) (Filter, bool) {
+	f := &DropShadowFilter{Color: getTextColor(style)}
+	var lengths []float64
+	for _, arg := range args {
+		if c, ok := css.ComponentColor(arg); ok {
+			f.Color = toRGBA(c)
+			continue
+		}
+		if ident, ok := css.ComponentIdent(arg); ok && ident == "currentcolor" {
+			continue
+		}
+		length, ok := resolveComponentLength(arg, style, 0)
+		if !ok {
+			return nil, false
+		}
+		lengths = append(lengths, length)
+	}
+	if len(lengths) < 2 || len(lengths) > 3 {
+		return nil, false
+	}
+	f.OffsetX, f.OffsetY = lengths[0], lengths[1]
+	if len(lengths) == 3 {
+		if lengths[2] < 0 {
+			return nil, false
+		}
+		f.StdDeviation = lengths[2]
+	}
+	return f, true
+}
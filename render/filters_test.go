@@ -0,0 +1,106 @@
+// Package render tests for CSS filter functions.
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+func filterStyle(value string) *css.ComputedStyle {
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("filter", rawValue(value))
+	return style
+}
+
+func TestParseFilters(t *testing.T) {
+	filters := parseFilters(filterStyle("blur(2px) brightness(150%) drop-shadow(1px 2px 3px red) hue-rotate(0.5turn)"))
+	if len(filters) != 4 {
+		t.Fatalf("got %d filters, want 4", len(filters))
+	}
+	if blur, ok := filters[0].(*BlurFilter); !ok || blur.StdDeviation != 2 {
+		t.Errorf("filter 0 = %#v", filters[0])
+	}
+	if m, ok := filters[1].(*ColorMatrixFilter); !ok || m.Matrix[0][0] != 1.5 {
+		t.Errorf("filter 1 = %#v", filters[1])
+	}
+	shadow, ok := filters[2].(*DropShadowFilter)
+	if !ok || shadow.OffsetX != 1 || shadow.OffsetY != 2 || shadow.StdDeviation != 3 || shadow.Color != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("filter 2 = %#v", filters[2])
+	}
+}
+
+func TestParseFiltersInvalid(t *testing.T) {
+	for _, value := range []string{"none", "blur(-1px)", "url(#f)", "grayscale(1px)", "brightness(1) bogus(2)"} {
+		if filters := parseFilters(filterStyle(value)); len(filters) != 0 {
+			t.Errorf("parseFilters(%q) = %d filters, want none", value, len(filters))
+		}
+	}
+}
+
+func TestColorMatrixFilters(t *testing.T) {
+	tests := []struct {
+		filter string
+		in     color.RGBA
+		want   color.RGBA
+	}{
+		{"grayscale(1)", color.RGBA{255, 0, 0, 255}, color.RGBA{54, 54, 54, 255}},
+		{"invert(100%)", color.RGBA{255, 0, 100, 255}, color.RGBA{0, 255, 155, 255}},
+		{"brightness(0.5)", color.RGBA{200, 100, 50, 255}, color.RGBA{100, 50, 25, 255}},
+		{"opacity(0.5)", color.RGBA{10, 20, 30, 200}, color.RGBA{10, 20, 30, 100}},
+		{"hue-rotate(360deg)", color.RGBA{10, 200, 30, 255}, color.RGBA{10, 200, 30, 255}},
+	}
+	for _, tt := range tests {
+		filters := parseFilters(filterStyle(tt.filter))
+		if len(filters) != 1 {
+			t.Errorf("%s: parse failed", tt.filter)
+			continue
+		}
+		canvas := NewTransparentCanvas(1, 1)
+		canvas.Pixels[0] = tt.in
+		filters[0].Apply(canvas)
+		if !colorNear(canvas.Pixels[0], tt.want, 1) {
+			t.Errorf("%s(%v) = %v, want %v", tt.filter, tt.in, canvas.Pixels[0], tt.want)
+		}
+	}
+}
+
+func TestBlurFilterSpreadsColor(t *testing.T) {
+	canvas := NewTransparentCanvas(21, 21)
+	canvas.FillRect(8, 8, 5, 5, color.RGBA{0, 0, 255, 255})
+
+	(&BlurFilter{StdDeviation: 2}).Apply(canvas)
+
+	edge := canvas.GetPixel(6, 10)
+	if edge.A == 0 || edge.A == 255 {
+		t.Errorf("pixel beside the square = %v, want partially transparent", edge)
+	}
+	if edge.B != 255 || edge.R != 0 {
+		t.Errorf("blurred color = %v, want pure blue (premultiplied blur)", edge)
+	}
+}
+
+func TestDropShadowFilterPaintsBeneath(t *testing.T) {
+	canvas := NewCanvas(40, 40)
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-color", &css.ComputedValue{Color: css.Color{R: 255, A: 255}})
+	style.SetPropertyValue("filter", rawValue("drop-shadow(5px 5px black)"))
+	box := &layout.LayoutBox{
+		BoxType:           layout.BlockBox,
+		ComputedStyle:     style,
+		IsStackingContext: true,
+		Dimensions:        layout.Dimensions{Content: layout.Rect{X: 5, Y: 5, Width: 20, Height: 20}},
+	}
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{box}}
+
+	canvas.Paint(root)
+
+	if got := canvas.GetPixel(10, 10); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("content = %v, want red above the shadow", got)
+	}
+	if got := canvas.GetPixel(27, 27); got != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("shadow = %v, want black", got)
+	}
+}
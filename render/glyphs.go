@@ -0,0 +1,209 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements glyph painting: shaped glyph runs are filled from
+// their font outlines with a scanline rasterizer.
+// Reference: https://learn.microsoft.com/en-us/typography/opentype/spec/glyf
+package render
+
+import (
+	"image/color"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/chrisuehlinger/viberowser/font"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// glyphKey identifies the outline of a glyph at a font size.
+type glyphKey struct {
+	face *font.Face
+	id   font.GlyphID
+	size float64
+}
+
+// glyphCacheSize bounds the number of flattened outlines kept.
+const glyphCacheSize = 2048
+
+var (
+	glyphMu    sync.Mutex
+	glyphCache = map[glyphKey]*Path{}
+)
+
+// glyphPath returns the flattened outline of a glyph at a font size,
+// relative to its origin on the baseline, or nil for a glyph without one.
+func glyphPath(face *font.Face, id font.GlyphID, size float64) *Path {
+	key := glyphKey{face, id, size}
+	glyphMu.Lock()
+	defer glyphMu.Unlock()
+	if path, ok := glyphCache[key]; ok {
+		return path
+	}
+	b := &pathBuilder{path: &Path{FillRule: FillRuleNonZero}}
+	for _, seg := range face.Outline(id, size) {
+		p := seg.Points
+		switch seg.Op {
+		case font.MoveTo:
+			b.moveTo(Point{p[0].X, p[0].Y})
+		case font.LineTo:
+			b.lineTo(Point{p[0].X, p[0].Y})
+		case font.QuadTo:
+			b.quadTo(Point{p[0].X, p[0].Y}, Point{p[1].X, p[1].Y})
+		case font.CubeTo:
+			b.cubicTo(Point{p[0].X, p[0].Y}, Point{p[1].X, p[1].Y}, Point{p[2].X, p[2].Y})
+		}
+	}
+	path := b.finish()
+	if len(path.Subpaths) == 0 {
+		path = nil
+	}
+	if len(glyphCache) >= glyphCacheSize {
+		clear(glyphCache)
+	}
+	glyphCache[key] = path
+	return path
+}
+
+// drawGlyphs paints a shaped run with its pen starting at x on the
+// baseline y.
+func (c *Canvas) drawGlyphs(glyphs []font.Glyph, x, y float64, size float64, col color.RGBA) {
+	for _, g := range glyphs {
+		if g.Face != nil {
+			if path := glyphPath(g.Face, g.ID, size); path != nil {
+				c.fillPathAt(path, x+g.XOffset, y+g.YOffset, col)
+			}
+		}
+		x += g.XAdvance
+	}
+}
+
+// drawVerticalText paints a run of vertical text. Glyphs turned sideways
+// are rotated a quarter turn clockwise, or anticlockwise in sideways-lr,
+// and upright glyphs are centred across the line. Without glyphs, the
+// bitmap font sets every character upright in the space it advances by.
+// Reference: https://www.w3.org/TR/css-writing-modes-4/#text-orientation
+func (c *Canvas) drawVerticalText(cmd *TextCommand) {
+	runes := []rune(cmd.Text)
+	anticlockwise := cmd.WritingMode == "sideways-lr"
+	baseline := cmd.X + cmd.Width - cmd.Ascent
+	if anticlockwise {
+		baseline = cmd.X + cmd.Ascent
+	}
+	pen := 0.0
+	if len(cmd.Glyphs) == 0 {
+		scale := math.Max(cmd.FontSize/7, 1)
+		for _, r := range runes {
+			advance := cmd.FontSize * 0.6
+			if layout.UprightRune(r, cmd.Orientation) {
+				advance = cmd.FontSize
+			}
+			x := cmd.X + (cmd.Width-5*scale)/2
+			y := cmd.Y + pen
+			if anticlockwise {
+				y = cmd.Y + cmd.Height - pen - advance
+			}
+			c.drawTextSpaced(string(r), x, int(y+(advance-7*scale)/2), cmd.Color, cmd.FontSize, cmd.FontWeight, 0, 0)
+			pen += advance + cmd.LetterSpacing
+		}
+		return
+	}
+	for _, g := range cmd.Glyphs {
+		var path *Path
+		if g.Face != nil {
+			path = glyphPath(g.Face, g.ID, cmd.FontSize)
+		}
+		switch {
+		case path == nil:
+		case !anticlockwise && g.Cluster < len(runes) && layout.UprightRune(runes[g.Cluster], cmd.Orientation):
+			bounds := path.Bounds()
+			c.fillPathAt(path, cmd.X+cmd.Width/2-bounds.X-bounds.Width/2, cmd.Y+pen+cmd.Ascent+g.YOffset, cmd.Color)
+		case anticlockwise:
+			rotated := path.Transform(func(p Point) Point { return Point{p.Y, -p.X} })
+			c.fillPathAt(rotated, baseline+g.YOffset, cmd.Y+cmd.Height-pen-g.XOffset, cmd.Color)
+		default:
+			rotated := path.Transform(func(p Point) Point { return Point{-p.Y, p.X} })
+			c.fillPathAt(rotated, baseline-g.YOffset, cmd.Y+pen+g.XOffset, cmd.Color)
+		}
+		pen += g.XAdvance
+	}
+}
+
+// scanlineSamples is the number of sub-scanlines sampled in each pixel row.
+const scanlineSamples = 4
+
+// fillPathAt fills a path translated by (dx, dy) under its fill rule, with
+// coverage measured exactly along each sub-scanline.
+func (c *Canvas) fillPathAt(path *Path, dx, dy float64, col color.RGBA) {
+	bounds := path.Bounds()
+	bounds.X += dx
+	bounds.Y += dy
+	x0, y0, x1, y1 := c.pixelBounds(bounds)
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	type crossing struct {
+		x       float64
+		winding int
+	}
+	coverage := make([]float64, x1-x0)
+	var crossings []crossing
+	for py := y0; py < y1; py++ {
+		clear(coverage)
+		for s := 0; s < scanlineSamples; s++ {
+			sy := float64(py) + (float64(s)+0.5)/scanlineSamples - dy
+			crossings = crossings[:0]
+			for _, poly := range path.Subpaths {
+				n := len(poly)
+				for i := 0; i < n; i++ {
+					a, b := poly[i], poly[(i+1)%n]
+					if (a.Y <= sy) == (b.Y <= sy) {
+						continue
+					}
+					w := 1
+					if a.Y > b.Y {
+						w = -1
+					}
+					t := (sy - a.Y) / (b.Y - a.Y)
+					crossings = append(crossings, crossing{a.X + t*(b.X-a.X) + dx, w})
+				}
+			}
+			slices.SortFunc(crossings, func(a, b crossing) int {
+				switch {
+				case a.x < b.x:
+					return -1
+				case a.x > b.x:
+					return 1
+				}
+				return 0
+			})
+			winding := 0
+			for i, cr := range crossings {
+				inside := winding != 0
+				if path.FillRule == FillRuleEvenOdd {
+					inside = winding%2 != 0
+				}
+				if inside && i > 0 {
+					addSpanCoverage(coverage, crossings[i-1].x-float64(x0), cr.x-float64(x0))
+				}
+				winding += cr.winding
+			}
+		}
+		for i, cov := range coverage {
+			if cov > 0 {
+				c.BlendPixelCoverage(x0+i, py, col, math.Min(cov/scanlineSamples, 1))
+			}
+		}
+	}
+}
+
+// addSpanCoverage adds the horizontal span from a to b, in pixels from the
+// start of a row, to the coverage of the pixels it overlaps.
+func addSpanCoverage(coverage []float64, a, b float64) {
+	a = math.Max(a, 0)
+	b = math.Min(b, float64(len(coverage)))
+	for a < b {
+		px := int(a)
+		end := math.Min(float64(px+1), b)
+		coverage[px] += end - a
+		a = end
+	}
+}
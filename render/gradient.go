@@ -0,0 +1,779 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements CSS gradient images.
+// Reference: https://www.w3.org/TR/css-images-4/#gradients
+package render
+
+import (
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// GradientKind identifies the gradient function.
+type GradientKind int
+
+const (
+	LinearGradientKind GradientKind = iota
+	RadialGradientKind
+	ConicGradientKind
+)
+
+// lengthPercentage is a length in pixels or a percentage of some reference size.
+type lengthPercentage struct {
+	Value   float64
+	Percent bool
+}
+
+// resolve converts the value to pixels against the reference size.
+func (lp lengthPercentage) resolve(base float64) float64 {
+	if lp.Percent {
+		return lp.Value / 100 * base
+	}
+	return lp.Value
+}
+
+// positionComponent is one axis of a <position>, measured from the start
+// edge (left/top) or, if FromEnd is set, from the end edge.
+type positionComponent struct {
+	Offset  lengthPercentage
+	FromEnd bool
+}
+
+// resolve returns the offset of an object of size objectSize within an area
+// of size areaSize. Percentages align the same point of object and area.
+func (pc positionComponent) resolve(areaSize, objectSize float64) float64 {
+	offset := pc.Offset.resolve(areaSize - objectSize)
+	if pc.FromEnd {
+		return areaSize - objectSize - offset
+	}
+	return offset
+}
+
+// Position is a CSS <position> value.
+type Position struct {
+	X, Y positionComponent
+}
+
+// centerPosition is the default position of radial and conic gradients.
+var centerPosition = Position{
+	X: positionComponent{Offset: lengthPercentage{Value: 50, Percent: true}},
+	Y: positionComponent{Offset: lengthPercentage{Value: 50, Percent: true}},
+}
+
+// gradientStop is a color stop or an interpolation hint as written.
+type gradientStop struct {
+	Color    color.RGBA
+	Position *lengthPercentage // nil when omitted
+	IsHint   bool
+}
+
+// Gradient is a parsed gradient image. Its geometry is resolved against the
+// size of the tile it is painted into.
+type Gradient struct {
+	Kind      GradientKind
+	Repeating bool
+
+	// Linear: angle in degrees, or the side/corner given with "to".
+	Angle    float64
+	ToSide   bool
+	ToX, ToY int // -1 left/top, 0 none, 1 right/bottom
+
+	// Radial
+	Circle      bool
+	SizeKeyword string // closest-side, closest-corner, farthest-side, farthest-corner
+	SizeX       lengthPercentage
+	SizeY       lengthPercentage
+
+	// Radial and conic
+	Center Position
+
+	// Conic: the "from" angle is stored in Angle.
+
+	Stops []gradientStop
+}
+
+// ParseGradient parses a gradient function. currentColor is substituted for
+// the currentcolor keyword; lengths resolve against style.
+func ParseGradient(cv css.ComponentValue, currentColor color.RGBA, style *css.ComputedStyle) (*Gradient, bool) {
+	fn, ok := cv.(*css.Function)
+	if !ok {
+		return nil, false
+	}
+	g := &Gradient{}
+	name := strings.ToLower(fn.Name)
+	if strings.HasPrefix(name, "repeating-") {
+		g.Repeating = true
+		name = strings.TrimPrefix(name, "repeating-")
+	}
+	switch name {
+	case "linear-gradient":
+		g.Kind = LinearGradientKind
+		g.Angle = 180
+	case "radial-gradient":
+		g.Kind = RadialGradientKind
+		g.SizeKeyword = "farthest-corner"
+		g.Center = centerPosition
+	case "conic-gradient":
+		g.Kind = ConicGradientKind
+		g.Center = centerPosition
+	default:
+		return nil, false
+	}
+
+	args := css.SplitComponentValuesByComma(fn.Values)
+	if len(args) == 0 {
+		return nil, false
+	}
+	stopArgs := args
+	if g.parsePrelude(css.NonWhitespaceComponents(args[0]), style) {
+		stopArgs = args[1:]
+	}
+	if !g.parseStops(stopArgs, currentColor, style) {
+		return nil, false
+	}
+	return g, true
+}
+
+// parsePrelude parses the arguments before the color stops. It reports false
+// if the first argument is not a prelude (i.e. it is already a color stop).
+func (g *Gradient) parsePrelude(parts []css.ComponentValue, style *css.ComputedStyle) bool {
+	if len(parts) == 0 {
+		return false
+	}
+	switch g.Kind {
+	case LinearGradientKind:
+		return g.parseLinearPrelude(parts)
+	case RadialGradientKind:
+		return g.parseRadialPrelude(parts, style)
+	default:
+		return g.parseConicPrelude(parts, style)
+	}
+}
+
+func (g *Gradient) parseLinearPrelude(parts []css.ComponentValue) bool {
+	if angle, ok := componentAngle(parts[0]); ok && len(parts) == 1 {
+		g.Angle = angle
+		return true
+	}
+	if ident, ok := css.ComponentIdent(parts[0]); !ok || ident != "to" || len(parts) < 2 || len(parts) > 3 {
+		return false
+	}
+	for _, part := range parts[1:] {
+		ident, _ := css.ComponentIdent(part)
+		switch ident {
+		case "left":
+			g.ToX = -1
+		case "right":
+			g.ToX = 1
+		case "top":
+			g.ToY = -1
+		case "bottom":
+			g.ToY = 1
+		default:
+			return false
+		}
+	}
+	if len(parts) == 3 && (g.ToX == 0 || g.ToY == 0) {
+		return false
+	}
+	g.ToSide = true
+	return true
+}
+
+func (g *Gradient) parseRadialPrelude(parts []css.ComponentValue, style *css.ComputedStyle) bool {
+	var sizes []lengthPercentage
+	shapeGiven := false
+	for i := 0; i < len(parts); i++ {
+		if ident, ok := css.ComponentIdent(parts[i]); ok {
+			switch ident {
+			case "circle":
+				g.Circle = true
+				shapeGiven = true
+			case "ellipse":
+				shapeGiven = true
+			case "closest-side", "closest-corner", "farthest-side", "farthest-corner":
+				g.SizeKeyword = ident
+			case "at":
+				pos, ok := parsePosition(parts[i+1:], style)
+				if !ok {
+					return false
+				}
+				g.Center = pos
+				i = len(parts)
+			default:
+				return false
+			}
+			continue
+		}
+		lp, ok := parseLengthPercentage(parts[i], style)
+		if !ok {
+			return false
+		}
+		sizes = append(sizes, lp)
+	}
+	switch len(sizes) {
+	case 0:
+	case 1:
+		if sizes[0].Percent || (shapeGiven && !g.Circle) {
+			return false
+		}
+		g.Circle = true
+		g.SizeKeyword = ""
+		g.SizeX, g.SizeY = sizes[0], sizes[0]
+	case 2:
+		if g.Circle {
+			return false
+		}
+		g.SizeKeyword = ""
+		g.SizeX, g.SizeY = sizes[0], sizes[1]
+	default:
+		return false
+	}
+	return true
+}
+
+func (g *Gradient) parseConicPrelude(parts []css.ComponentValue, style *css.ComputedStyle) bool {
+	for i := 0; i < len(parts); i++ {
+		ident, ok := css.ComponentIdent(parts[i])
+		if !ok {
+			return false
+		}
+		switch ident {
+		case "from":
+			if i+1 >= len(parts) {
+				return false
+			}
+			angle, ok := componentAngle(parts[i+1])
+			if !ok {
+				return false
+			}
+			g.Angle = angle
+			i++
+		case "at":
+			pos, ok := parsePosition(parts[i+1:], style)
+			if !ok {
+				return false
+			}
+			g.Center = pos
+			i = len(parts)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseStops parses the color stop list. Each argument is a color with up to
+// two positions, or a lone position acting as an interpolation hint.
+func (g *Gradient) parseStops(args [][]css.ComponentValue, currentColor color.RGBA, style *css.ComputedStyle) bool {
+	for _, arg := range args {
+		parts := css.NonWhitespaceComponents(arg)
+		if len(parts) == 0 || len(parts) > 3 {
+			return false
+		}
+		var col color.RGBA
+		hasColor := false
+		var positions []lengthPercentage
+		for _, part := range parts {
+			if c, ok := css.ComponentColor(part); ok && !hasColor {
+				col, hasColor = toRGBA(c), true
+				continue
+			}
+			if ident, ok := css.ComponentIdent(part); ok && ident == "currentcolor" && !hasColor {
+				col, hasColor = currentColor, true
+				continue
+			}
+			lp, ok := g.parseStopPosition(part, style)
+			if !ok {
+				return false
+			}
+			positions = append(positions, lp)
+		}
+		if !hasColor {
+			// Interpolation hint: a single position between two color stops
+			if len(positions) != 1 || len(g.Stops) == 0 || g.Stops[len(g.Stops)-1].IsHint {
+				return false
+			}
+			pos := positions[0]
+			g.Stops = append(g.Stops, gradientStop{Position: &pos, IsHint: true})
+			continue
+		}
+		if len(positions) == 0 {
+			g.Stops = append(g.Stops, gradientStop{Color: col})
+		}
+		for i := range positions {
+			g.Stops = append(g.Stops, gradientStop{Color: col, Position: &positions[i]})
+		}
+	}
+	colorStops := 0
+	for _, s := range g.Stops {
+		if !s.IsHint {
+			colorStops++
+		}
+	}
+	return colorStops >= 2 && !g.Stops[len(g.Stops)-1].IsHint
+}
+
+// parseStopPosition parses a stop position. Conic gradients take angles,
+// expressed as a percentage of a full turn.
+func (g *Gradient) parseStopPosition(cv css.ComponentValue, style *css.ComputedStyle) (lengthPercentage, bool) {
+	if g.Kind == ConicGradientKind {
+		if angle, ok := componentAngle(cv); ok {
+			return lengthPercentage{Value: angle / 360 * 100, Percent: true}, true
+		}
+		if value, _, tokType, ok := css.ComponentNumber(cv); ok && tokType == css.TokenPercentage {
+			return lengthPercentage{Value: value, Percent: true}, true
+		}
+		return lengthPercentage{}, false
+	}
+	return parseLengthPercentage(cv, style)
+}
+
+// componentAngle parses an angle in deg, rad, grad or turn, returning degrees.
+// A unitless zero is accepted.
+func componentAngle(cv css.ComponentValue) (float64, bool) {
+	value, unit, tokType, ok := css.ComponentNumber(cv)
+	if !ok {
+		return 0, false
+	}
+	if tokType == css.TokenNumber {
+		return 0, value == 0
+	}
+	switch unit {
+	case "deg":
+		return value, true
+	case "rad":
+		return value * 180 / math.Pi, true
+	case "grad":
+		return value * 0.9, true
+	case "turn":
+		return value * 360, true
+	}
+	return 0, false
+}
+
+// parseLengthPercentage parses a length or percentage, resolving lengths to pixels.
+func parseLengthPercentage(cv css.ComponentValue, style *css.ComputedStyle) (lengthPercentage, bool) {
+	value, _, tokType, ok := css.ComponentNumber(cv)
+	if ok && tokType == css.TokenPercentage {
+		return lengthPercentage{Value: value, Percent: true}, true
+	}
+	px, ok := resolveComponentLength(cv, style, 0)
+	return lengthPercentage{Value: px}, ok
+}
+
+// parsePosition parses a <position> of one to four values.
+// Reference: https://www.w3.org/TR/css-values-4/#position
+func parsePosition(parts []css.ComponentValue, style *css.ComputedStyle) (Position, bool) {
+	pos := centerPosition
+	type item struct {
+		keyword string
+		offset  lengthPercentage
+		isLen   bool
+	}
+	items := make([]item, 0, len(parts))
+	for _, part := range parts {
+		if ident, ok := css.ComponentIdent(part); ok {
+			switch ident {
+			case "left", "right", "top", "bottom", "center":
+				items = append(items, item{keyword: ident})
+				continue
+			}
+			return pos, false
+		}
+		lp, ok := parseLengthPercentage(part, style)
+		if !ok {
+			return pos, false
+		}
+		items = append(items, item{offset: lp, isLen: true})
+	}
+
+	keywordComponent := func(keyword string) positionComponent {
+		switch keyword {
+		case "left", "top":
+			return positionComponent{Offset: lengthPercentage{Percent: true}}
+		case "right", "bottom":
+			return positionComponent{Offset: lengthPercentage{Percent: true}, FromEnd: true}
+		}
+		return positionComponent{Offset: lengthPercentage{Value: 50, Percent: true}}
+	}
+	isVertical := func(keyword string) bool { return keyword == "top" || keyword == "bottom" }
+	isHorizontal := func(keyword string) bool { return keyword == "left" || keyword == "right" }
+
+	switch len(items) {
+	case 1:
+		if items[0].isLen {
+			pos.X = positionComponent{Offset: items[0].offset}
+		} else if isVertical(items[0].keyword) {
+			pos.Y = keywordComponent(items[0].keyword)
+		} else {
+			pos.X = keywordComponent(items[0].keyword)
+		}
+		return pos, true
+	case 2:
+		first, second := items[0], items[1]
+		if isVertical(first.keyword) || isHorizontal(second.keyword) {
+			if first.isLen || second.isLen {
+				return pos, false
+			}
+			first, second = second, first
+		}
+		if isVertical(first.keyword) || isHorizontal(second.keyword) {
+			return pos, false
+		}
+		if first.isLen {
+			pos.X = positionComponent{Offset: first.offset}
+		} else {
+			pos.X = keywordComponent(first.keyword)
+		}
+		if second.isLen {
+			pos.Y = positionComponent{Offset: second.offset}
+		} else {
+			pos.Y = keywordComponent(second.keyword)
+		}
+		return pos, true
+	case 3, 4:
+		// Keywords, each optionally followed by an offset from that edge
+		var setX, setY bool
+		for i := 0; i < len(items); i++ {
+			it := items[i]
+			if it.isLen {
+				return pos, false
+			}
+			comp := keywordComponent(it.keyword)
+			if i+1 < len(items) && items[i+1].isLen {
+				if it.keyword == "center" {
+					return pos, false
+				}
+				comp.Offset = items[i+1].offset
+				i++
+			}
+			switch {
+			case isHorizontal(it.keyword) && !setX:
+				pos.X, setX = comp, true
+			case isVertical(it.keyword) && !setY:
+				pos.Y, setY = comp, true
+			case it.keyword == "center" && !setX:
+				pos.X, setX = comp, true
+			case it.keyword == "center" && !setY:
+				pos.Y, setY = comp, true
+			default:
+				return pos, false
+			}
+		}
+		return pos, true
+	}
+	return pos, false
+}
+
+// premulColor is a color with premultiplied alpha in the range 0..1.
+type premulColor struct {
+	R, G, B, A float64
+}
+
+func premultiply(c color.RGBA) premulColor {
+	a := float64(c.A) / 255
+	return premulColor{R: float64(c.R) / 255 * a, G: float64(c.G) / 255 * a, B: float64(c.B) / 255 * a, A: a}
+}
+
+func (p premulColor) lerp(q premulColor, t float64) premulColor {
+	return premulColor{
+		R: p.R + (q.R-p.R)*t,
+		G: p.G + (q.G-p.G)*t,
+		B: p.B + (q.B-p.B)*t,
+		A: p.A + (q.A-p.A)*t,
+	}
+}
+
+// rgba converts back to a non-premultiplied color.
+func (p premulColor) rgba() color.RGBA {
+	if p.A <= 0 {
+		return color.RGBA{}
+	}
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(math.Min(math.Max(v/p.A, 0), 1) * 255))
+	}
+	return color.RGBA{R: channel(p.R), G: channel(p.G), B: channel(p.B), A: uint8(math.Round(math.Min(p.A, 1) * 255))}
+}
+
+// resolvedStop is a color stop with its position along the gradient ray, and
+// the hint (as a position, or NaN) for the segment that follows it.
+type resolvedStop struct {
+	Pos   float64
+	Color premulColor
+	Hint  float64
+}
+
+// resolveStops applies the color stop fixup rules against a gradient ray of
+// the given length, returning stop positions in pixels.
+// Reference: https://www.w3.org/TR/css-images-4/#color-stop-fixup
+func resolveStops(stops []gradientStop, length float64) []resolvedStop {
+	type entry struct {
+		pos    float64
+		has    bool
+		isHint bool
+		color  color.RGBA
+	}
+	entries := make([]entry, len(stops))
+	for i, s := range stops {
+		entries[i] = entry{isHint: s.IsHint, color: s.Color}
+		if s.Position != nil {
+			entries[i].pos = s.Position.resolve(length)
+			entries[i].has = true
+		}
+	}
+
+	// Default the first and last color stops to the ends of the ray
+	if !entries[0].has {
+		entries[0].pos, entries[0].has = 0, true
+	}
+	if last := len(entries) - 1; !entries[last].has {
+		entries[last].pos, entries[last].has = length, true
+	}
+
+	// Positions never decrease
+	maxPos := math.Inf(-1)
+	for i := range entries {
+		if !entries[i].has {
+			continue
+		}
+		if entries[i].pos < maxPos {
+			entries[i].pos = maxPos
+		}
+		maxPos = entries[i].pos
+	}
+
+	// Spread runs of unpositioned color stops evenly between their neighbors
+	for i := 0; i < len(entries); i++ {
+		if entries[i].has {
+			continue
+		}
+		start := i - 1
+		end := i
+		for !entries[end].has {
+			end++
+		}
+		n := end - start
+		for j := i; j < end; j++ {
+			entries[j].pos = entries[start].pos + (entries[end].pos-entries[start].pos)*float64(j-start)/float64(n)
+			entries[j].has = true
+		}
+		i = end
+	}
+
+	var resolved []resolvedStop
+	for _, e := range entries {
+		if e.isHint {
+			resolved[len(resolved)-1].Hint = e.pos
+			continue
+		}
+		resolved = append(resolved, resolvedStop{Pos: e.pos, Color: premultiply(e.color), Hint: math.NaN()})
+	}
+	return resolved
+}
+
+// colorAtStops returns the interpolated color at position t along the ray.
+func colorAtStops(stops []resolvedStop, t float64) premulColor {
+	if t <= stops[0].Pos {
+		return stops[0].Color
+	}
+	for i := 0; i < len(stops)-1; i++ {
+		a, b := stops[i], stops[i+1]
+		if t >= b.Pos {
+			continue
+		}
+		span := b.Pos - a.Pos
+		if span <= 0 {
+			return b.Color
+		}
+		frac := (t - a.Pos) / span
+		if !math.IsNaN(a.Hint) {
+			frac = applyHint(frac, (a.Hint-a.Pos)/span)
+		}
+		return a.Color.lerp(b.Color, frac)
+	}
+	return stops[len(stops)-1].Color
+}
+
+// applyHint reshapes the interpolation weight so the midpoint color falls at hint.
+// Reference: https://www.w3.org/TR/css-images-4/#coloring-gradient-line
+func applyHint(frac, hint float64) float64 {
+	switch {
+	case hint <= 0:
+		return 1
+	case hint >= 1:
+		return 0
+	}
+	return math.Pow(frac, math.Log(0.5)/math.Log(hint))
+}
+
+// gradientPainter is a gradient with its geometry resolved for one tile size.
+type gradientPainter struct {
+	g     *Gradient
+	stops []resolvedStop
+	// Linear
+	dirX, dirY float64
+	length     float64
+	// Radial and conic
+	cx, cy float64
+	rx, ry float64
+	// Repeating period
+	start, period float64
+	solid         *premulColor
+}
+
+// painterFor resolves the gradient for a tile of the given size.
+func (g *Gradient) painterFor(width, height float64) *gradientPainter {
+	p := &gradientPainter{g: g}
+	switch g.Kind {
+	case LinearGradientKind:
+		angle := g.Angle
+		if g.ToSide {
+			angle = sideOrCornerAngle(g.ToX, g.ToY, width, height)
+		}
+		rad := angle * math.Pi / 180
+		p.dirX, p.dirY = math.Sin(rad), -math.Cos(rad)
+		p.length = math.Abs(width*p.dirX) + math.Abs(height*p.dirY)
+		p.cx, p.cy = width/2, height/2
+	case RadialGradientKind:
+		p.cx = g.Center.X.resolve(width, 0)
+		p.cy = g.Center.Y.resolve(height, 0)
+		p.rx, p.ry = g.radialSize(p.cx, p.cy, width, height)
+		p.length = p.rx
+	case ConicGradientKind:
+		p.cx = g.Center.X.resolve(width, 0)
+		p.cy = g.Center.Y.resolve(height, 0)
+		p.length = 1
+	}
+
+	p.stops = resolveStops(g.Stops, p.length)
+	first, last := p.stops[0].Pos, p.stops[len(p.stops)-1].Pos
+	if g.Repeating {
+		p.start, p.period = first, last-first
+		if p.period <= 0 {
+			// A zero-length repeating gradient paints its average color
+			avg := averageStopColor(p.stops)
+			p.solid = &avg
+		}
+	}
+	if g.Kind == RadialGradientKind && (p.rx <= 0 || p.ry <= 0) {
+		c := p.stops[len(p.stops)-1].Color
+		p.solid = &c
+	}
+	return p
+}
+
+// averageStopColor is the mean color of the stops.
+func averageStopColor(stops []resolvedStop) premulColor {
+	var sum premulColor
+	for _, s := range stops {
+		sum.R += s.Color.R
+		sum.G += s.Color.G
+		sum.B += s.Color.B
+		sum.A += s.Color.A
+	}
+	n := float64(len(stops))
+	return premulColor{R: sum.R / n, G: sum.G / n, B: sum.B / n, A: sum.A / n}
+}
+
+// sideOrCornerAngle returns the angle for "to <side-or-corner>". For corners
+// the angle is chosen so the 50% line passes through the other two corners.
+func sideOrCornerAngle(toX, toY int, width, height float64) float64 {
+	if toX == 0 {
+		if toY < 0 {
+			return 0
+		}
+		return 180
+	}
+	if toY == 0 {
+		if toX > 0 {
+			return 90
+		}
+		return 270
+	}
+	a := math.Atan2(height, width) * 180 / math.Pi
+	switch {
+	case toX > 0 && toY < 0:
+		return a
+	case toX > 0 && toY > 0:
+		return 180 - a
+	case toX < 0 && toY > 0:
+		return 180 + a
+	default:
+		return 360 - a
+	}
+}
+
+// radialSize returns the horizontal and vertical radii of the ending shape.
+// Reference: https://www.w3.org/TR/css-images-3/#radial-gradient-syntax
+func (g *Gradient) radialSize(cx, cy, width, height float64) (float64, float64) {
+	if g.SizeKeyword == "" {
+		if g.Circle {
+			return g.SizeX.Value, g.SizeX.Value
+		}
+		return g.SizeX.resolve(width), g.SizeY.resolve(height)
+	}
+
+	left, right := math.Abs(cx), math.Abs(width-cx)
+	top, bottom := math.Abs(cy), math.Abs(height-cy)
+	closestX, farthestX := math.Min(left, right), math.Max(left, right)
+	closestY, farthestY := math.Min(top, bottom), math.Max(top, bottom)
+
+	switch g.SizeKeyword {
+	case "closest-side":
+		if g.Circle {
+			r := math.Min(closestX, closestY)
+			return r, r
+		}
+		return closestX, closestY
+	case "farthest-side":
+		if g.Circle {
+			r := math.Max(farthestX, farthestY)
+			return r, r
+		}
+		return farthestX, farthestY
+	case "closest-corner":
+		if g.Circle {
+			r := math.Hypot(closestX, closestY)
+			return r, r
+		}
+		return closestX * math.Sqrt2, closestY * math.Sqrt2
+	default: // farthest-corner
+		if g.Circle {
+			r := math.Hypot(farthestX, farthestY)
+			return r, r
+		}
+		return farthestX * math.Sqrt2, farthestY * math.Sqrt2
+	}
+}
+
+// colorAt returns the gradient color at a point in tile coordinates.
+func (p *gradientPainter) colorAt(x, y float64) color.RGBA {
+	if p.solid != nil {
+		return p.solid.rgba()
+	}
+	var t float64
+	switch p.g.Kind {
+	case LinearGradientKind:
+		t = (x-p.cx)*p.dirX + (y-p.cy)*p.dirY + p.length/2
+	case RadialGradientKind:
+		dx := (x - p.cx) / p.rx
+		dy := (y - p.cy) / p.ry
+		t = math.Hypot(dx, dy) * p.rx
+	case ConicGradientKind:
+		angle := math.Atan2(x-p.cx, -(y-p.cy))*180/math.Pi - p.g.Angle
+		t = math.Mod(angle, 360) / 360
+		if t < 0 {
+			t++
+		}
+	}
+	if p.g.Repeating {
+		t = p.start + math.Mod(t-p.start, p.period)
+		if t < p.start {
+			t += p.period
+		}
+	}
+	return colorAtStops(p.stops, t).rgba()
+}
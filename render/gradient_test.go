@@ -0,0 +1,197 @@
+// Package render tests for gradient parsing and color evaluation.
+package render
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+func mustParseGradient(t *testing.T, text string) *Gradient {
+	t.Helper()
+	values := css.NonWhitespaceComponents(css.ParseComponentValueList(text))
+	if len(values) != 1 {
+		t.Fatalf("%q: got %d component values", text, len(values))
+	}
+	g, ok := ParseGradient(values[0], color.RGBA{0, 0, 0, 255}, nil)
+	if !ok {
+		t.Fatalf("ParseGradient(%q) failed", text)
+	}
+	return g
+}
+
+func colorNear(a, b color.RGBA, tolerance int) bool {
+	d := func(x, y uint8) bool { return int(math.Abs(float64(x)-float64(y))) <= tolerance }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
+
+func TestParseGradientInvalid(t *testing.T) {
+	for _, text := range []string{
+		"linear-gradient(red)",
+		"linear-gradient(to middle, red, blue)",
+		"radial-gradient(circle 10% , red, blue)",
+		"linear-gradient(red, 50%)",
+		"foo-gradient(red, blue)",
+	} {
+		values := css.NonWhitespaceComponents(css.ParseComponentValueList(text))
+		if _, ok := ParseGradient(values[0], color.RGBA{}, nil); ok {
+			t.Errorf("ParseGradient(%q) should fail", text)
+		}
+	}
+}
+
+func TestLinearGradientDefaultDirection(t *testing.T) {
+	g := mustParseGradient(t, "linear-gradient(red, blue)")
+	p := g.painterFor(100, 100)
+
+	if got := p.colorAt(50, 0); !colorNear(got, color.RGBA{255, 0, 0, 255}, 3) {
+		t.Errorf("top = %v, want red", got)
+	}
+	if got := p.colorAt(50, 100); !colorNear(got, color.RGBA{0, 0, 255, 255}, 3) {
+		t.Errorf("bottom = %v, want blue", got)
+	}
+	if got := p.colorAt(50, 50); !colorNear(got, color.RGBA{128, 0, 128, 255}, 3) {
+		t.Errorf("middle = %v, want purple", got)
+	}
+}
+
+func TestLinearGradientAngleAndCorner(t *testing.T) {
+	g := mustParseGradient(t, "linear-gradient(90deg, black, white)")
+	p := g.painterFor(200, 50)
+	if got := p.colorAt(0, 25); !colorNear(got, color.RGBA{0, 0, 0, 255}, 3) {
+		t.Errorf("left = %v, want black", got)
+	}
+	if got := p.colorAt(200, 25); !colorNear(got, color.RGBA{255, 255, 255, 255}, 3) {
+		t.Errorf("right = %v, want white", got)
+	}
+
+	// With "to top right" the other two corners sit on the 50% line
+	g = mustParseGradient(t, "linear-gradient(to top right, black, white)")
+	p = g.painterFor(200, 50)
+	topLeft := p.colorAt(0, 0)
+	bottomRight := p.colorAt(200, 50)
+	if !colorNear(topLeft, bottomRight, 2) || !colorNear(topLeft, color.RGBA{128, 128, 128, 255}, 3) {
+		t.Errorf("corners = %v and %v, want mid gray", topLeft, bottomRight)
+	}
+}
+
+func TestGradientStopFixup(t *testing.T) {
+	g := mustParseGradient(t, "linear-gradient(red 20%, lime, blue 10%, white)")
+	stops := resolveStops(g.Stops, 100)
+
+	want := []float64{20, 20, 20, 100}
+	for i, s := range stops {
+		if math.Abs(s.Pos-want[i]) > 1e-9 {
+			t.Errorf("stop %d at %v, want %v", i, s.Pos, want[i])
+		}
+	}
+}
+
+func TestGradientDoublePositionHardStop(t *testing.T) {
+	g := mustParseGradient(t, "linear-gradient(to right, red 0 50%, blue 50% 100%)")
+	p := g.painterFor(100, 10)
+
+	if got := p.colorAt(49, 5); !colorNear(got, color.RGBA{255, 0, 0, 255}, 0) {
+		t.Errorf("before the hard stop = %v, want red", got)
+	}
+	if got := p.colorAt(51, 5); !colorNear(got, color.RGBA{0, 0, 255, 255}, 0) {
+		t.Errorf("after the hard stop = %v, want blue", got)
+	}
+}
+
+func TestGradientInterpolationHint(t *testing.T) {
+	g := mustParseGradient(t, "linear-gradient(to right, black, 25%, white)")
+	p := g.painterFor(100, 10)
+
+	// The midpoint color sits at the hint
+	if got := p.colorAt(25, 5); !colorNear(got, color.RGBA{128, 128, 128, 255}, 3) {
+		t.Errorf("at hint = %v, want mid gray", got)
+	}
+}
+
+func TestGradientPremultipliedInterpolation(t *testing.T) {
+	g := mustParseGradient(t, "linear-gradient(to right, red, transparent)")
+	p := g.painterFor(100, 10)
+
+	// Fading to transparent black must not darken the color
+	got := p.colorAt(50, 5)
+	if got.R != 255 || got.G != 0 || !colorNear(got, color.RGBA{255, 0, 0, 128}, 2) {
+		t.Errorf("middle = %v, want half-transparent red", got)
+	}
+}
+
+func TestRepeatingLinearGradient(t *testing.T) {
+	g := mustParseGradient(t, "repeating-linear-gradient(to right, black 0, white 10px)")
+	p := g.painterFor(100, 10)
+
+	if got, want := p.colorAt(25, 5), p.colorAt(5, 5); !colorNear(got, want, 1) {
+		t.Errorf("repeat = %v, want %v", got, want)
+	}
+}
+
+func TestRadialGradient(t *testing.T) {
+	g := mustParseGradient(t, "radial-gradient(circle closest-side at 50px 50px, white, black)")
+	p := g.painterFor(200, 100)
+
+	if p.rx != 50 || p.ry != 50 {
+		t.Errorf("radii = %v, %v, want 50, 50", p.rx, p.ry)
+	}
+	if got := p.colorAt(50, 50); !colorNear(got, color.RGBA{255, 255, 255, 255}, 3) {
+		t.Errorf("center = %v, want white", got)
+	}
+	if got := p.colorAt(150, 50); !colorNear(got, color.RGBA{0, 0, 0, 255}, 0) {
+		t.Errorf("outside = %v, want black", got)
+	}
+}
+
+func TestRadialGradientFarthestCornerEllipse(t *testing.T) {
+	g := mustParseGradient(t, "radial-gradient(red, blue)")
+	p := g.painterFor(200, 100)
+
+	if math.Abs(p.rx-100*math.Sqrt2) > 1e-9 || math.Abs(p.ry-50*math.Sqrt2) > 1e-9 {
+		t.Errorf("radii = %v, %v", p.rx, p.ry)
+	}
+}
+
+func TestConicGradient(t *testing.T) {
+	g := mustParseGradient(t, "conic-gradient(from 90deg, red, blue)")
+	p := g.painterFor(100, 100)
+
+	// Just clockwise of the start angle (pointing right) is red
+	if got := p.colorAt(90, 51); !colorNear(got, color.RGBA{255, 0, 0, 255}, 8) {
+		t.Errorf("start = %v, want red", got)
+	}
+	// Half a turn later (pointing left) is the midpoint
+	if got := p.colorAt(10, 50); !colorNear(got, color.RGBA{128, 0, 128, 255}, 3) {
+		t.Errorf("half turn = %v, want purple", got)
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		text  string
+		wantX float64
+		wantY float64
+	}{
+		{"center", 40, 40},
+		{"top", 40, 0},
+		{"right 10px", 80, 10},
+		{"bottom left", 0, 80},
+		{"right 10px bottom 20%", 70, 64},
+		{"25% 75%", 20, 60},
+	}
+	for _, tt := range tests {
+		pos, ok := parsePosition(css.NonWhitespaceComponents(css.ParseComponentValueList(tt.text)), nil)
+		if !ok {
+			t.Errorf("parsePosition(%q) failed", tt.text)
+			continue
+		}
+		x := pos.X.resolve(100, 20)
+		y := pos.Y.resolve(100, 20)
+		if math.Abs(x-tt.wantX) > 1e-9 || math.Abs(y-tt.wantY) > 1e-9 {
+			t.Errorf("parsePosition(%q) = (%v, %v), want (%v, %v)", tt.text, x, y, tt.wantX, tt.wantY)
+		}
+	}
+}
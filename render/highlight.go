@@ -0,0 +1,46 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements highlights: translucent colors painted over a page
+// once it is painted, such as the matches of find in page. They mark text
+// without changing how the page itself is painted.
+// Reference: https://drafts.csswg.org/css-highlight-api-1/
+package render
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// Highlight is a color painted over areas of a page.
+type Highlight struct {
+	// Rects are in CSS pixels, in the coordinates of the layout tree
+	Rects []layout.Rect
+	// Color is blended over the page, so a translucent color leaves what
+	// it covers legible
+	Color color.RGBA
+}
+
+// Colors find in page highlights its matches with.
+var (
+	FindMatchColor       = color.RGBA{255, 235, 59, 140}
+	ActiveFindMatchColor = color.RGBA{255, 150, 50, 170}
+)
+
+// PaintHighlights paints highlights over what was painted on the canvas,
+// later highlights over earlier ones. Highlighted areas are widened to
+// whole device pixels.
+func (c *Canvas) PaintHighlights(highlights []Highlight) {
+	scale := c.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	for _, h := range highlights {
+		for _, r := range h.Rects {
+			r = scaleRect(r, scale)
+			x0, y0 := int(math.Floor(r.X)), int(math.Floor(r.Y))
+			x1, y1 := int(math.Ceil(r.X+r.Width)), int(math.Ceil(r.Y+r.Height))
+			c.FillRect(x0, y0, x1-x0, y1-y0, h.Color)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Package render tests for highlights painted over pages.
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+func TestPaintHighlights(t *testing.T) {
+	canvas := NewCanvas(40, 20)
+	canvas.Scale = 2
+	canvas.Clear(color.RGBA{0, 0, 0, 255})
+	canvas.PaintHighlights([]Highlight{{
+		Rects: []layout.Rect{{X: 2.25, Y: 1, Width: 5.5, Height: 4}},
+		Color: color.RGBA{255, 255, 255, 128},
+	}})
+
+	// The area spans 4.5-15.5 device pixels, widened to 4-16, and the color
+	// is blended with what is below
+	tests := []struct {
+		x           int
+		highlighted bool
+	}{
+		{3, false},
+		{4, true},
+		{15, true},
+		{16, false},
+	}
+	for _, tt := range tests {
+		got := canvas.GetPixel(tt.x, 5)
+		if highlighted := got.R > 0; highlighted != tt.highlighted {
+			t.Errorf("pixel at x = %d is %v, highlighted = %v", tt.x, got, tt.highlighted)
+		}
+		if tt.highlighted && got.R == 255 {
+			t.Errorf("pixel at x = %d is %v, want the highlight blended", tt.x, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements hit testing of layout boxes in paint order.
+// Reference: https://www.w3.org/TR/CSS21/zindex.html
+package render
+
+import (
+	"sort"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// HitTest returns the topmost box whose border box contains the point (x, y),
+// or nil if nothing was hit. Boxes are visited in reverse painting order;
+// points are mapped through the transforms of boxes, areas cut away by
+// clip-path or clipped by overflow do not receive hits, and boxes with
+// pointer-events: none or that are not visible are passed through.
+func HitTest(root *layout.LayoutBox, x, y float64) *layout.LayoutBox {
+	var hit *layout.LayoutBox
+	hitTestTree(root, x, y, func(box *layout.LayoutBox) bool {
+		hit = box
+		return true
+	})
+	return hit
+}
+
+// HitTestAll returns all the boxes hit at the point (x, y), from the
+// topmost down.
+func HitTestAll(root *layout.LayoutBox, x, y float64) []*layout.LayoutBox {
+	var hits []*layout.LayoutBox
+	hitTestTree(root, x, y, func(box *layout.LayoutBox) bool {
+		hits = append(hits, box)
+		return false
+	})
+	return hits
+}
+
+// HitTestElement returns the element that generated the topmost box at the
+// point (x, y): the element itself, or the parent of the text or anonymous
+// box that was hit. It returns nil if nothing was hit.
+func HitTestElement(root *layout.LayoutBox, x, y float64) *dom.Element {
+	return boxElement(HitTest(root, x, y))
+}
+
+// ElementsFromPoint returns the elements that generated the boxes hit at
+// the point (x, y), from the topmost down, each listed once.
+// Reference: https://drafts.csswg.org/cssom-view/#dom-document-elementsfrompoint
+func ElementsFromPoint(root *layout.LayoutBox, x, y float64) []*dom.Element {
+	var elements []*dom.Element
+	seen := map[*dom.Element]bool{}
+	for _, box := range HitTestAll(root, x, y) {
+		if el := boxElement(box); el != nil && !seen[el] {
+			seen[el] = true
+			elements = append(elements, el)
+		}
+	}
+	return elements
+}
+
+// boxElement returns the element a box was generated for, going up from
+// text and anonymous boxes.
+func boxElement(box *layout.LayoutBox) *dom.Element {
+	for ; box != nil; box = box.Parent {
+		if box.Element != nil {
+			return box.Element
+		}
+	}
+	return nil
+}
+
+// hitTestTree calls hit for the boxes at a point, front to back, until it
+// returns true.
+func hitTestTree(root *layout.LayoutBox, x, y float64, hit func(*layout.LayoutBox) bool) {
+	if root == nil {
+		return
+	}
+	contexts := collectStackingContexts(root)
+	hitTestStackingContext(contexts[0], x, y, hit)
+}
+
+// hitTestStackingContext tests a stacking context and its descendants, front
+// to back, and reports whether hit stopped the walk. The point is in the
+// coordinates of the parent of the context.
+func hitTestStackingContext(sc *StackingContextEntry, x, y float64, hit func(*layout.LayoutBox) bool) bool {
+	box := sc.Box
+	if box.BoxType == layout.NoneBox {
+		return false
+	}
+	if m, ok := boxTransform(box); ok {
+		inverse, ok := m.Invert()
+		if !ok {
+			// A box flattened to nothing cannot be hit
+			return false
+		}
+		p := inverse.Apply(Point{X: x, Y: y})
+		x, y = p.X, p.Y
+	}
+	if clip := resolveClipPath(box); clip != nil && !clip.Contains(x, y) {
+		return false
+	}
+
+	children := make([]*StackingContextEntry, len(sc.Children))
+	copy(children, sc.Children)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].ZIndex < children[j].ZIndex
+	})
+
+	testContext := func(child *StackingContextEntry) bool {
+		return !clippedByOverflow(child.Box, box, x, y) && hitTestStackingContext(child, x, y, hit)
+	}
+
+	// Zero and positive z-index contexts paint last, so they are tested first
+	i := len(children) - 1
+	for ; i >= 0 && children[i].ZIndex >= 0; i-- {
+		if testContext(children[i]) {
+			return true
+		}
+	}
+	if !clipsOverflow(box, x, y) && hitTestChildren(box, x, y, hit) {
+		return true
+	}
+	for ; i >= 0; i-- {
+		if testContext(children[i]) {
+			return true
+		}
+	}
+	return hitTestBox(box, x, y) && hit(box)
+}
+
+// hitTestChildren tests the in-flow descendants of a box that do not form
+// their own stacking contexts, last painted first, and reports whether hit
+// stopped the walk.
+func hitTestChildren(box *layout.LayoutBox, x, y float64, hit func(*layout.LayoutBox) bool) bool {
+	for i := len(box.Children) - 1; i >= 0; i-- {
+		child := box.Children[i]
+		if child.IsStackingContext || child.BoxType == layout.NoneBox {
+			continue
+		}
+		if !clipsOverflow(child, x, y) && hitTestChildren(child, x, y, hit) {
+			return true
+		}
+		if hitTestBox(child, x, y) && hit(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// hitTestBox reports whether the point lies within the box's rounded border
+// box and the box is a target of pointer events.
+func hitTestBox(box *layout.LayoutBox, x, y float64) bool {
+	if styleText(box.ComputedStyle, "pointer-events") == "none" {
+		return false
+	}
+	switch styleText(box.ComputedStyle, "visibility") {
+	case "hidden", "collapse":
+		return false
+	}
+	return borderBoxShape(box).Contains(x, y)
+}
+
+// clipsOverflow reports whether a box clips its content to its padding box
+// and the point lies outside of it.
+func clipsOverflow(box *layout.LayoutBox, x, y float64) bool {
+	if box.Overflow == layout.OverflowVisible {
+		return false
+	}
+	padding := box.Dimensions.PaddingBox()
+	return x < padding.X || y < padding.Y || x >= padding.X+padding.Width || y >= padding.Y+padding.Height
+}
+
+// clippedByOverflow reports whether the point is clipped away from a box by
+// one of its ancestors up to and including stop.
+func clippedByOverflow(box, stop *layout.LayoutBox, x, y float64) bool {
+	for parent := box.Parent; parent != nil; parent = parent.Parent {
+		if clipsOverflow(parent, x, y) {
+			return true
+		}
+		if parent == stop {
+			break
+		}
+	}
+	return false
+}
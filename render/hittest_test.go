@@ -0,0 +1,168 @@
+// Package render tests for hit testing.
+package render
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+func TestHitTestPaintOrder(t *testing.T) {
+	root := compositingBox(layout.Rect{Width: 100, Height: 100}, css.Color{}, nil)
+	first := compositingBox(layout.Rect{X: 0, Y: 0, Width: 60, Height: 60}, css.Color{}, nil)
+	second := compositingBox(layout.Rect{X: 40, Y: 40, Width: 60, Height: 60}, css.Color{}, nil)
+	inner := compositingBox(layout.Rect{X: 5, Y: 5, Width: 10, Height: 10}, css.Color{}, nil)
+	first.Children = []*layout.LayoutBox{inner}
+	root.Children = []*layout.LayoutBox{first, second}
+
+	tests := []struct {
+		x, y float64
+		want *layout.LayoutBox
+	}{
+		{50, 50, second},
+		{20, 20, first},
+		{10, 10, inner},
+		{90, 10, root},
+		{150, 150, nil},
+	}
+	for _, tt := range tests {
+		if got := HitTest(root, tt.x, tt.y); got != tt.want {
+			t.Errorf("HitTest(%v, %v) = %p, want %p", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestHitTestZIndex(t *testing.T) {
+	root := compositingBox(layout.Rect{Width: 100, Height: 100}, css.Color{}, nil)
+	flow := compositingBox(layout.Rect{Width: 50, Height: 50}, css.Color{}, nil)
+	behind := compositingBox(layout.Rect{Width: 50, Height: 50}, css.Color{}, map[string]string{"opacity": "0.5"})
+	behind.ZIndex = -1
+	above := compositingBox(layout.Rect{X: 25, Y: 25, Width: 50, Height: 50}, css.Color{}, map[string]string{"opacity": "0.5"})
+	above.ZIndex = 1
+	root.Children = []*layout.LayoutBox{above, flow, behind}
+
+	if got := HitTest(root, 10, 10); got != flow {
+		t.Errorf("in-flow box should be above a negative z-index context, got %p", got)
+	}
+	if got := HitTest(root, 30, 30); got != above {
+		t.Errorf("positive z-index context should be on top, got %p", got)
+	}
+}
+
+func TestHitTestClipPath(t *testing.T) {
+	root := compositingBox(layout.Rect{Width: 200, Height: 200}, css.Color{}, nil)
+	avatar := clipBox("circle(50%)")
+	child := compositingBox(layout.Rect{X: 10, Y: 10, Width: 100, Height: 100}, css.Color{}, nil)
+	avatar.Children = []*layout.LayoutBox{child}
+	root.Children = []*layout.LayoutBox{avatar}
+
+	if got := HitTest(root, 60, 60); got != child {
+		t.Errorf("center should hit the clipped content, got %p", got)
+	}
+	if got := HitTest(root, 14, 14); got != root {
+		t.Errorf("clipped-away corner should fall through to the root, got %p", got)
+	}
+}
+
+func TestHitTestTransform(t *testing.T) {
+	root := compositingBox(layout.Rect{Width: 200, Height: 200}, css.Color{}, nil)
+	moved := compositingBox(layout.Rect{Width: 50, Height: 50}, css.Color{}, map[string]string{"transform": "translate(100px, 20px)"})
+	child := compositingBox(layout.Rect{X: 5, Y: 5, Width: 10, Height: 10}, css.Color{}, nil)
+	moved.Children = []*layout.LayoutBox{child}
+	turned := compositingBox(layout.Rect{Y: 150, Width: 100, Height: 20}, css.Color{}, map[string]string{"transform": "rotate(90deg)"})
+	root.Children = []*layout.LayoutBox{moved, turned}
+
+	tests := []struct {
+		x, y float64
+		want *layout.LayoutBox
+	}{
+		{120, 60, moved},
+		{110, 30, child},
+		{10, 10, root},
+		// The bar turns about its center into a column from y 110 to 210
+		{50, 120, turned},
+		{90, 160, root},
+	}
+	for _, tt := range tests {
+		if got := HitTest(root, tt.x, tt.y); got != tt.want {
+			t.Errorf("HitTest(%v, %v) = %p, want %p", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestHitTestPointerEvents(t *testing.T) {
+	root := compositingBox(layout.Rect{Width: 100, Height: 100}, css.Color{}, nil)
+	button := compositingBox(layout.Rect{Width: 50, Height: 50}, css.Color{}, nil)
+	overlay := compositingBox(layout.Rect{Width: 100, Height: 100}, css.Color{}, map[string]string{"pointer-events": "none"})
+	control := compositingBox(layout.Rect{X: 80, Y: 80, Width: 20, Height: 20}, css.Color{}, nil)
+	overlay.Children = []*layout.LayoutBox{control}
+	root.Children = []*layout.LayoutBox{button, overlay}
+
+	if got := HitTest(root, 10, 10); got != button {
+		t.Errorf("overlay without pointer events should let hits through, got %p", got)
+	}
+	if got := HitTest(root, 90, 90); got != control {
+		t.Errorf("descendant with pointer events should be hit, got %p", got)
+	}
+	if got := HitTest(root, 60, 10); got != root {
+		t.Errorf("expected the root behind the overlay, got %p", got)
+	}
+}
+
+func TestHitTestOverflowClip(t *testing.T) {
+	root := compositingBox(layout.Rect{Width: 200, Height: 200}, css.Color{}, nil)
+	scroller := compositingBox(layout.Rect{Width: 50, Height: 50}, css.Color{}, nil)
+	scroller.Overflow = layout.OverflowHidden
+	content := compositingBox(layout.Rect{X: 40, Y: 40, Width: 40, Height: 40}, css.Color{}, nil)
+	layer := compositingBox(layout.Rect{X: 40, Y: 0, Width: 40, Height: 20}, css.Color{}, map[string]string{"opacity": "0.5"})
+	content.Parent, layer.Parent, scroller.Parent = scroller, scroller, root
+	scroller.Children = []*layout.LayoutBox{content, layer}
+	root.Children = []*layout.LayoutBox{scroller}
+
+	tests := []struct {
+		x, y float64
+		want *layout.LayoutBox
+	}{
+		{45, 45, content},
+		{60, 60, root},
+		{45, 10, layer},
+		{60, 10, root},
+	}
+	for _, tt := range tests {
+		if got := HitTest(root, tt.x, tt.y); got != tt.want {
+			t.Errorf("HitTest(%v, %v) = %p, want %p", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestElementsFromPoint(t *testing.T) {
+	doc := dom.NewDocument()
+	body, card, label := doc.CreateElement("body"), doc.CreateElement("div"), doc.CreateElement("span")
+	root := compositingBox(layout.Rect{Width: 100, Height: 100}, css.Color{}, nil)
+	root.Element = body
+	cardBox := compositingBox(layout.Rect{Width: 60, Height: 60}, css.Color{}, nil)
+	cardBox.Element = card
+	labelBox := compositingBox(layout.Rect{X: 10, Y: 10, Width: 30, Height: 10}, css.Color{}, nil)
+	labelBox.Element = label
+	text := compositingBox(layout.Rect{X: 10, Y: 10, Width: 20, Height: 10}, css.Color{}, nil)
+	text.Parent, labelBox.Parent, cardBox.Parent = labelBox, cardBox, root
+	labelBox.Children = []*layout.LayoutBox{text}
+	cardBox.Children = []*layout.LayoutBox{labelBox}
+	root.Children = []*layout.LayoutBox{cardBox}
+
+	if got := HitTestAll(root, 15, 15); len(got) != 4 || got[0] != text || got[3] != root {
+		t.Errorf("HitTestAll should list the text, label, card and root, got %d boxes", len(got))
+	}
+	got := ElementsFromPoint(root, 15, 15)
+	if len(got) != 3 || got[0] != label || got[1] != card || got[2] != body {
+		t.Errorf("ElementsFromPoint should list each element once, topmost first, got %v", got)
+	}
+	if got := HitTestElement(root, 50, 50); got != card {
+		t.Errorf("HitTestElement(50, 50) = %v, want the card", got)
+	}
+	if got := ElementsFromPoint(root, 150, 150); len(got) != 0 {
+		t.Errorf("expected no elements outside the root, got %v", got)
+	}
+}
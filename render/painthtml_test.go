@@ -0,0 +1,51 @@
+// Package render helpers for tests that lay out and paint HTML documents.
+package render
+
+import (
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/font"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// paintHTML lays out a document with the user agent stylesheet, an author
+// stylesheet and the default fonts in a viewport, and paints it with its
+// selection onto a canvas of the viewport's size. prepare, if not nil, is
+// called with the laid out document before it is painted.
+func paintHTML(t *testing.T, html, styles string, width, height int, prepare func(doc *dom.Document, root *layout.LayoutBox)) (*Canvas, *layout.LayoutBox) {
+	t.Helper()
+	doc, err := dom.ParseHTML(html)
+	if err != nil {
+		t.Fatalf("ParseHTML: %v", err)
+	}
+	resolver := css.NewStyleResolver()
+	resolver.SetUserAgentStylesheet(css.GetUserAgentStylesheet())
+	resolver.AddAuthorStylesheet(css.NewParser(styles).Parse())
+	ctx := layout.NewLayoutContext(float64(width), float64(height))
+	ctx.Fonts = font.Default()
+	root := layout.BuildLayoutTree(doc.DocumentElement(), resolver, ctx)
+	root.Layout(ctx)
+	if prepare != nil {
+		prepare(doc, root)
+	}
+	canvas := NewCanvas(width, height)
+	canvas.Selection = doc.GetSelection()
+	canvas.Paint(root)
+	return canvas, root
+}
+
+// findBox returns the first box of a layout tree, in tree order, that
+// matches a predicate, or nil.
+func findBox(b *layout.LayoutBox, match func(b *layout.LayoutBox) bool) *layout.LayoutBox {
+	if match(b) {
+		return b
+	}
+	for _, child := range b.Children {
+		if found := findBox(child, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements vector paths: SVG path data parsing, curve
+// flattening and point containment with fill rules.
+// Reference: https://www.w3.org/TR/SVG2/paths.html#PathData
+package render
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// Point is a 2D point in canvas coordinates.
+type Point struct {
+	X, Y float64
+}
+
+// FillRule determines which points are inside a self-intersecting path.
+type FillRule int
+
+const (
+	FillRuleNonZero FillRule = iota
+	FillRuleEvenOdd
+)
+
+// Path is a set of polylines approximating a vector path. Curves are
+// flattened into line segments when the path is built. Every subpath is
+// implicitly closed for filling; Closed records which ones were explicitly
+// closed, which matters for stroking.
+type Path struct {
+	Subpaths [][]Point
+	Closed   []bool
+	FillRule FillRule
+}
+
+// NewPolygonPath creates a path consisting of a single closed polygon.
+func NewPolygonPath(points []Point, rule FillRule) *Path {
+	return &Path{Subpaths: [][]Point{points}, Closed: []bool{true}, FillRule: rule}
+}
+
+// Contains reports whether a point lies inside the path under its fill rule.
+func (p *Path) Contains(x, y float64) bool {
+	winding := 0
+	for _, poly := range p.Subpaths {
+		n := len(poly)
+		for i := 0; i < n; i++ {
+			a, b := poly[i], poly[(i+1)%n]
+			if a.Y <= y {
+				if b.Y > y && cross(a, b, x, y) > 0 {
+					winding++
+				}
+			} else if b.Y <= y && cross(a, b, x, y) < 0 {
+				winding--
+			}
+		}
+	}
+	if p.FillRule == FillRuleEvenOdd {
+		return winding%2 != 0
+	}
+	return winding != 0
+}
+
+// cross returns the z component of (b-a) x (p-a), positive if p is left of a->b.
+func cross(a, b Point, x, y float64) float64 {
+	return (b.X-a.X)*(y-a.Y) - (x-a.X)*(b.Y-a.Y)
+}
+
+// Bounds returns the bounding rectangle of the path.
+func (p *Path) Bounds() layout.Rect {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, poly := range p.Subpaths {
+		for _, pt := range poly {
+			minX, maxX = math.Min(minX, pt.X), math.Max(maxX, pt.X)
+			minY, maxY = math.Min(minY, pt.Y), math.Max(maxY, pt.Y)
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return layout.Rect{}
+	}
+	return layout.Rect{X: minX, Y: minY, Width: maxX - minX, Height: maxY - minY}
+}
+
+// Transform returns a copy of the path with every point mapped by f.
+func (p *Path) Transform(f func(Point) Point) *Path {
+	out := &Path{FillRule: p.FillRule, Subpaths: make([][]Point, len(p.Subpaths))}
+	out.Closed = append(out.Closed, p.Closed...)
+	for i, poly := range p.Subpaths {
+		mapped := make([]Point, len(poly))
+		for j, pt := range poly {
+			mapped[j] = f(pt)
+		}
+		out.Subpaths[i] = mapped
+	}
+	return out
+}
+
+// curveSegments is the number of line segments used to flatten each curve.
+const curveSegments = 16
+
+// pathBuilder accumulates subpaths while parsing path data.
+type pathBuilder struct {
+	path    *Path
+	current []Point
+	pos     Point
+	start   Point
+	// Reflected control points for S and T commands
+	lastCubic, lastQuad Point
+	hasCubic, hasQuad   bool
+}
+
+func (b *pathBuilder) moveTo(p Point) {
+	b.endSubpath(false)
+	b.current = []Point{p}
+	b.pos, b.start = p, p
+}
+
+func (b *pathBuilder) lineTo(p Point) {
+	if b.current == nil {
+		b.current = []Point{b.pos}
+	}
+	b.current = append(b.current, p)
+	b.pos = p
+}
+
+// endSubpath finishes the current subpath; closed is true for an explicit
+// closepath command.
+func (b *pathBuilder) endSubpath(closed bool) {
+	if len(b.current) > 1 {
+		b.path.Subpaths = append(b.path.Subpaths, b.current)
+		b.path.Closed = append(b.path.Closed, closed)
+	}
+	b.current = nil
+}
+
+func (b *pathBuilder) cubicTo(c1, c2, end Point) {
+	p0 := b.pos
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		mt := 1 - t
+		b.lineTo(Point{
+			X: mt*mt*mt*p0.X + 3*mt*mt*t*c1.X + 3*mt*t*t*c2.X + t*t*t*end.X,
+			Y: mt*mt*mt*p0.Y + 3*mt*mt*t*c1.Y + 3*mt*t*t*c2.Y + t*t*t*end.Y,
+		})
+	}
+	b.lastCubic, b.hasCubic = c2, true
+}
+
+func (b *pathBuilder) quadTo(c, end Point) {
+	p0 := b.pos
+	for i := 1; i <= curveSegments; i++ {
+		t := float64(i) / curveSegments
+		mt := 1 - t
+		b.lineTo(Point{
+			X: mt*mt*p0.X + 2*mt*t*c.X + t*t*end.X,
+			Y: mt*mt*p0.Y + 2*mt*t*c.Y + t*t*end.Y,
+		})
+	}
+	b.lastQuad, b.hasQuad = c, true
+}
+
+// arcTo flattens an elliptical arc using the endpoint to center conversion.
+// Reference: https://www.w3.org/TR/SVG2/implnote.html#ArcImplementationNotes
+func (b *pathBuilder) arcTo(rx, ry, rotation float64, largeArc, sweep bool, end Point) {
+	p0 := b.pos
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || (p0 == end) {
+		b.lineTo(end)
+		return
+	}
+	phi := rotation * math.Pi / 180
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	dx, dy := (p0.X-end.X)/2, (p0.Y-end.Y)/2
+	x1 := cosPhi*dx + sinPhi*dy
+	y1 := -sinPhi*dx + cosPhi*dy
+
+	// Scale up radii that are too small to span the endpoints
+	if lambda := x1*x1/(rx*rx) + y1*y1/(ry*ry); lambda > 1 {
+		s := math.Sqrt(lambda)
+		rx, ry = rx*s, ry*s
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	coef := math.Sqrt(math.Max(0, num/den))
+	if largeArc == sweep {
+		coef = -coef
+	}
+	cx1 := coef * rx * y1 / ry
+	cy1 := -coef * ry * x1 / rx
+	cx := cosPhi*cx1 - sinPhi*cy1 + (p0.X+end.X)/2
+	cy := sinPhi*cx1 + cosPhi*cy1 + (p0.Y+end.Y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta1 := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	segments := int(math.Ceil(math.Abs(delta) / (math.Pi / 2) * curveSegments / 2))
+	for i := 1; i <= segments; i++ {
+		theta := theta1 + delta*float64(i)/float64(segments)
+		x := rx * math.Cos(theta)
+		y := ry * math.Sin(theta)
+		b.lineTo(Point{X: cosPhi*x - sinPhi*y + cx, Y: sinPhi*x + cosPhi*y + cy})
+	}
+	b.pos = end
+}
+
+// pathScanner tokenizes SVG path data.
+type pathScanner struct {
+	data string
+	pos  int
+}
+
+func (s *pathScanner) skipSeparators() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r', '\f', ',':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *pathScanner) done() bool {
+	s.skipSeparators()
+	return s.pos >= len(s.data)
+}
+
+// peekCommand returns the next command letter, if the next token is one.
+func (s *pathScanner) peekCommand() (byte, bool) {
+	s.skipSeparators()
+	if s.pos >= len(s.data) {
+		return 0, false
+	}
+	ch := s.data[s.pos]
+	if strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", ch) >= 0 {
+		return ch, true
+	}
+	return 0, false
+}
+
+func (s *pathScanner) number() (float64, error) {
+	s.skipSeparators()
+	start := s.pos
+	if s.pos < len(s.data) && (s.data[s.pos] == '+' || s.data[s.pos] == '-') {
+		s.pos++
+	}
+	seenDot, seenDigit := false, false
+	for s.pos < len(s.data) {
+		ch := s.data[s.pos]
+		if ch >= '0' && ch <= '9' {
+			seenDigit = true
+		} else if ch == '.' && !seenDot {
+			seenDot = true
+		} else {
+			break
+		}
+		s.pos++
+	}
+	if seenDigit && s.pos < len(s.data) && (s.data[s.pos] == 'e' || s.data[s.pos] == 'E') {
+		mark := s.pos
+		s.pos++
+		if s.pos < len(s.data) && (s.data[s.pos] == '+' || s.data[s.pos] == '-') {
+			s.pos++
+		}
+		expDigits := false
+		for s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '9' {
+			s.pos++
+			expDigits = true
+		}
+		if !expDigits {
+			s.pos = mark
+		}
+	}
+	if !seenDigit {
+		s.pos = start
+		return 0, fmt.Errorf("expected number at offset %d", start)
+	}
+	return strconv.ParseFloat(s.data[start:s.pos], 64)
+}
+
+// flag reads an arc flag, which may be written without a following separator.
+func (s *pathScanner) flag() (bool, error) {
+	s.skipSeparators()
+	if s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case '0':
+			s.pos++
+			return false, nil
+		case '1':
+			s.pos++
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("expected flag at offset %d", s.pos)
+}
+
+func (s *pathScanner) numbers(n int) ([]float64, error) {
+	values := make([]float64, n)
+	for i := range values {
+		v, err := s.number()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// ParsePathData parses SVG path data into a flattened path. As in SVG,
+// rendering stops at the first error; the path parsed so far is returned
+// together with the error.
+func ParsePathData(d string, rule FillRule) (*Path, error) {
+	b := &pathBuilder{path: &Path{FillRule: rule}}
+	s := &pathScanner{data: d}
+	var cmd byte
+	first := true
+	for !s.done() {
+		if c, ok := s.peekCommand(); ok {
+			cmd = c
+			s.pos++
+		} else if first || cmd == 'Z' || cmd == 'z' {
+			return b.finish(), fmt.Errorf("expected command at offset %d", s.pos)
+		}
+		// After a moveto, further coordinate pairs are implicit linetos
+		if first && cmd != 'M' && cmd != 'm' {
+			return b.finish(), fmt.Errorf("path data must start with a moveto")
+		}
+		first = false
+		if err := b.command(s, cmd); err != nil {
+			return b.finish(), err
+		}
+		switch cmd {
+		case 'M':
+			cmd = 'L'
+		case 'm':
+			cmd = 'l'
+		}
+	}
+	return b.finish(), nil
+}
+
+func (b *pathBuilder) finish() *Path {
+	b.endSubpath(false)
+	return b.path
+}
+
+// command executes one path command with its arguments.
+func (b *pathBuilder) command(s *pathScanner, cmd byte) error {
+	rel := cmd >= 'a' && cmd <= 'z'
+	abs := func(x, y float64) Point {
+		if rel {
+			return Point{X: b.pos.X + x, Y: b.pos.Y + y}
+		}
+		return Point{X: x, Y: y}
+	}
+	upper := cmd &^ 0x20
+	wasCubic, wasQuad := b.hasCubic, b.hasQuad
+	b.hasCubic, b.hasQuad = false, false
+
+	switch upper {
+	case 'Z':
+		b.endSubpath(true)
+		b.pos = b.start
+	case 'M':
+		v, err := s.numbers(2)
+		if err != nil {
+			return err
+		}
+		b.moveTo(abs(v[0], v[1]))
+	case 'L':
+		v, err := s.numbers(2)
+		if err != nil {
+			return err
+		}
+		b.lineTo(abs(v[0], v[1]))
+	case 'H':
+		v, err := s.number()
+		if err != nil {
+			return err
+		}
+		p := Point{X: v, Y: b.pos.Y}
+		if rel {
+			p.X += b.pos.X
+		}
+		b.lineTo(p)
+	case 'V':
+		v, err := s.number()
+		if err != nil {
+			return err
+		}
+		p := Point{X: b.pos.X, Y: v}
+		if rel {
+			p.Y += b.pos.Y
+		}
+		b.lineTo(p)
+	case 'C':
+		v, err := s.numbers(6)
+		if err != nil {
+			return err
+		}
+		b.cubicTo(abs(v[0], v[1]), abs(v[2], v[3]), abs(v[4], v[5]))
+	case 'S':
+		v, err := s.numbers(4)
+		if err != nil {
+			return err
+		}
+		c1 := b.pos
+		if wasCubic {
+			c1 = Point{X: 2*b.pos.X - b.lastCubic.X, Y: 2*b.pos.Y - b.lastCubic.Y}
+		}
+		b.cubicTo(c1, abs(v[0], v[1]), abs(v[2], v[3]))
+	case 'Q':
+		v, err := s.numbers(4)
+		if err != nil {
+			return err
+		}
+		b.quadTo(abs(v[0], v[1]), abs(v[2], v[3]))
+	case 'T':
+		v, err := s.numbers(2)
+		if err != nil {
+			return err
+		}
+		c := b.pos
+		if wasQuad {
+			c = Point{X: 2*b.pos.X - b.lastQuad.X, Y: 2*b.pos.Y - b.lastQuad.Y}
+		}
+		b.quadTo(c, abs(v[0], v[1]))
+	case 'A':
+		radii, err := s.numbers(3)
+		if err != nil {
+			return err
+		}
+		large, err := s.flag()
+		if err != nil {
+			return err
+		}
+		sweep, err := s.flag()
+		if err != nil {
+			return err
+		}
+		v, err := s.numbers(2)
+		if err != nil {
+			return err
+		}
+		b.arcTo(radii[0], radii[1], radii[2], large, sweep, abs(v[0], v[1]))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package render tests for SVG path data parsing.
+package render
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParsePathDataLines(t *testing.T) {
+	path, err := ParsePathData("M 0 0 L 10 0 L 10 10 Z", FillRuleNonZero)
+	if err != nil {
+		t.Fatalf("ParsePathData error: %v", err)
+	}
+	if len(path.Subpaths) != 1 {
+		t.Fatalf("subpaths = %d, want 1", len(path.Subpaths))
+	}
+	if !path.Contains(8, 2) {
+		t.Error("point (8, 2) should be inside the triangle")
+	}
+	if path.Contains(2, 8) {
+		t.Error("point (2, 8) should be outside the triangle")
+	}
+}
+
+func TestParsePathDataRelativeAndShorthand(t *testing.T) {
+	// h/v and implicit lineto after a relative moveto
+	path, err := ParsePathData("m10,10 20,0 v20 h-20z", FillRuleNonZero)
+	if err != nil {
+		t.Fatalf("ParsePathData error: %v", err)
+	}
+	b := path.Bounds()
+	if b.X != 10 || b.Y != 10 || b.Width != 20 || b.Height != 20 {
+		t.Errorf("bounds = %+v, want 10,10 20x20", b)
+	}
+	if !path.Contains(20, 20) || path.Contains(5, 5) {
+		t.Error("relative square containment is wrong")
+	}
+}
+
+func TestParsePathDataCurves(t *testing.T) {
+	// A quadratic bulge above the baseline from (0,10) to (20,10)
+	path, err := ParsePathData("M0 10 Q10 -10 20 10 Z", FillRuleNonZero)
+	if err != nil {
+		t.Fatalf("ParsePathData error: %v", err)
+	}
+	if !path.Contains(10, 5) {
+		t.Error("point under the curve apex should be inside")
+	}
+	if path.Contains(2, 1) {
+		t.Error("point outside the curve should be outside")
+	}
+
+	cubic, err := ParsePathData("M0 0 C0 20 20 20 20 0 S40 -20 40 0", FillRuleNonZero)
+	if err != nil {
+		t.Fatalf("cubic ParsePathData error: %v", err)
+	}
+	if b := cubic.Bounds(); b.Width != 40 {
+		t.Errorf("cubic width = %v, want 40", b.Width)
+	}
+}
+
+func TestParsePathDataArc(t *testing.T) {
+	// Two half-circle arcs make a circle of radius 10 centered at (10, 10)
+	path, err := ParsePathData("M0 10 A10 10 0 0 1 20 10 A10 10 0 0 1 0 10 Z", FillRuleNonZero)
+	if err != nil {
+		t.Fatalf("ParsePathData error: %v", err)
+	}
+	b := path.Bounds()
+	if math.Abs(b.Y) > 0.1 || math.Abs(b.Height-20) > 0.1 {
+		t.Errorf("arc bounds = %+v, want a 20px tall circle", b)
+	}
+	if !path.Contains(10, 10) || path.Contains(1, 1) {
+		t.Error("circle containment is wrong")
+	}
+}
+
+func TestParsePathDataFillRule(t *testing.T) {
+	// An outer square and an inner square drawn in the same direction
+	d := "M0 0 H30 V30 H0 Z M10 10 H20 V20 H10 Z"
+	nonzero, _ := ParsePathData(d, FillRuleNonZero)
+	evenodd, _ := ParsePathData(d, FillRuleEvenOdd)
+	if !nonzero.Contains(15, 15) {
+		t.Error("nonzero should fill the inner square")
+	}
+	if evenodd.Contains(15, 15) {
+		t.Error("evenodd should leave a hole in the inner square")
+	}
+	if !evenodd.Contains(5, 5) {
+		t.Error("evenodd should fill the outer ring")
+	}
+}
+
+func TestParsePathDataErrors(t *testing.T) {
+	if _, err := ParsePathData("L 10 10", FillRuleNonZero); err == nil {
+		t.Error("path data not starting with moveto should be an error")
+	}
+	path, err := ParsePathData("M0 0 L10 0 L10 10 X", FillRuleNonZero)
+	if err == nil {
+		t.Error("unknown command should be an error")
+	}
+	if path == nil || len(path.Subpaths) != 1 {
+		t.Error("path data before an error should be kept")
+	}
+}
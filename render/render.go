@@ -10,6 +10,8 @@ import (
 	"strings"
 
 	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/font"
 	"github.com/chrisuehlinger/viberowser/layout"
 )
 
@@ -18,6 +20,16 @@ type Canvas struct {
 	Pixels []color.RGBA
 	Width  int
 	Height int
+	// X and Y are the position of the top-left pixel of the canvas in the
+	// coordinates painted into it. Compositing layers cover only the part
+	// of the page their group paints.
+	X, Y int
+	// Scale is the number of pixels of the canvas per CSS pixel of the
+	// layout tree it paints. Zero paints one pixel per CSS pixel.
+	Scale float64
+	// Selection is the selection of the document painted, whose text is
+	// painted as selected. Nil paints no selection.
+	Selection *dom.Selection
 }
 
 // NewCanvas creates a new canvas with the given dimensions.
@@ -42,8 +54,12 @@ func (c *Canvas) Paint(layoutRoot *layout.LayoutBox) {
 		return
 	}
 
-	// Build display list for efficient rendering
+	// Build display list for efficient rendering, in the pixels of the
+	// canvas
 	displayList := c.buildDisplayList(layoutRoot)
+	if c.Scale > 0 && c.Scale != 1 {
+		displayList = scaleDisplayList(displayList, c.Scale)
+	}
 
 	// Execute display list commands
 	for _, cmd := range displayList {
@@ -204,13 +220,34 @@ type TextCommand struct {
 	FontSize  float64
 	FontStyle string
 	FontWeight string
+	// Extra space after each character and each word separator
+	LetterSpacing float64
+	WordSpacing   float64
+	// Glyphs are the shaped glyphs of the text, painted from their font
+	// outlines on the baseline Ascent below Y. Without them the text is
+	// painted with the built-in bitmap font.
+	Glyphs []font.Glyph
+	Ascent float64
+	// Vertical text runs down the line box of the given Width and Height
+	// from Y, or up it in sideways-lr, with the text-orientation of
+	// Orientation. Ascent is then measured from its right edge, or its left
+	// edge in sideways-lr. Text is in logical order, as glyph clusters are.
+	WritingMode   string
+	Orientation   string
+	Width, Height float64
 }
 
 // Execute paints the text.
 func (cmd *TextCommand) Execute(c *Canvas) {
-	// Basic text rendering using a simple bitmap approach
-	// For proper text rendering, a font library would be needed
-	c.drawText(cmd.Text, int(cmd.X), int(cmd.Y), cmd.Color, cmd.FontSize, cmd.FontWeight)
+	if cmd.Orientation != "" {
+		c.drawVerticalText(cmd)
+		return
+	}
+	if len(cmd.Glyphs) > 0 {
+		c.drawGlyphs(cmd.Glyphs, cmd.X, cmd.Y+cmd.Ascent, cmd.FontSize, cmd.Color)
+		return
+	}
+	c.drawTextSpaced(cmd.Text, cmd.X, int(cmd.Y), cmd.Color, cmd.FontSize, cmd.FontWeight, cmd.LetterSpacing, cmd.WordSpacing)
 }
 
 // PaintContext holds state during painting.
@@ -224,18 +261,11 @@ func (c *Canvas) buildDisplayList(root *layout.LayoutBox) []DisplayCommand {
 		DisplayList: make([]DisplayCommand, 0),
 	}
 
-	// Collect all stacking contexts
+	// Collect all stacking contexts; the first entry is the root of the tree
 	stackingContexts := collectStackingContexts(root)
 
-	// Sort by z-index
-	sort.SliceStable(stackingContexts, func(i, j int) bool {
-		return stackingContexts[i].ZIndex < stackingContexts[j].ZIndex
-	})
-
-	// Paint each stacking context
-	for _, sc := range stackingContexts {
-		c.paintStackingContext(sc, ctx)
-	}
+	// Paint the stacking context tree, nesting each context's descendants
+	c.paintStackingContextLayer(stackingContexts[0], ctx)
 
 	return ctx.DisplayList
 }
@@ -244,31 +274,43 @@ func (c *Canvas) buildDisplayList(root *layout.LayoutBox) []DisplayCommand {
 type StackingContextEntry struct {
 	Box    *layout.LayoutBox
 	ZIndex int
+
+	// Parent is the enclosing stacking context, nil for the root.
+	Parent *StackingContextEntry
+	// Children are the stacking contexts nested directly inside this one, in tree order.
+	Children []*StackingContextEntry
 }
 
 // collectStackingContexts collects all stacking contexts from the layout tree.
+// The root entry comes first; nested contexts are linked through Children.
 func collectStackingContexts(root *layout.LayoutBox) []*StackingContextEntry {
 	var contexts []*StackingContextEntry
 
 	// The root always creates a stacking context
-	contexts = append(contexts, &StackingContextEntry{
+	rootEntry := &StackingContextEntry{
 		Box:    root,
 		ZIndex: root.ZIndex,
-	})
+	}
+	contexts = append(contexts, rootEntry)
 
-	collectStackingContextsRecursive(root, &contexts)
+	collectStackingContextsRecursive(root, rootEntry, &contexts)
 	return contexts
 }
 
-func collectStackingContextsRecursive(box *layout.LayoutBox, contexts *[]*StackingContextEntry) {
+func collectStackingContextsRecursive(box *layout.LayoutBox, parent *StackingContextEntry, contexts *[]*StackingContextEntry) {
 	for _, child := range box.Children {
 		if child.IsStackingContext {
-			*contexts = append(*contexts, &StackingContextEntry{
+			entry := &StackingContextEntry{
 				Box:    child,
 				ZIndex: child.ZIndex,
-			})
+				Parent: parent,
+			}
+			parent.Children = append(parent.Children, entry)
+			*contexts = append(*contexts, entry)
+			collectStackingContextsRecursive(child, entry, contexts)
+			continue
 		}
-		collectStackingContextsRecursive(child, contexts)
+		collectStackingContextsRecursive(child, parent, contexts)
 	}
 }
 
@@ -290,35 +332,70 @@ func (c *Canvas) paintStackingContext(sc *StackingContextEntry, ctx *PaintContex
 		return
 	}
 
-	// 1. Paint background and borders
+	// 1. Paint shadows, background and borders
+	c.paintBoxShadows(box, ctx, false)
 	c.paintBackground(box, ctx)
+	c.paintBoxShadows(box, ctx, true)
 	c.paintBorders(box, ctx)
+	c.paintColumnRules(box, ctx)
+	c.paintReplaced(box, ctx)
+
+	children := make([]*StackingContextEntry, len(sc.Children))
+	copy(children, sc.Children)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].ZIndex < children[j].ZIndex
+	})
 
-	// Paint children (simplified - full implementation would separate by category)
+	// 2. Child stacking contexts with negative z-index
+	i := 0
+	for ; i < len(children) && children[i].ZIndex < 0; i++ {
+		c.paintStackingContextLayer(children[i], ctx)
+	}
+
+	// 3-5. Paint children (simplified - full implementation would separate by category)
 	c.paintChildren(box, ctx)
+
+	// 6-7. Child stacking contexts with zero and positive z-index
+	for ; i < len(children); i++ {
+		c.paintStackingContextLayer(children[i], ctx)
+	}
+
+	// Outlines are drawn over the box and its content
+	c.paintOutline(box, ctx)
 }
 
-// paintBackground paints the background of a box.
+// paintBackground paints the background color and image layers of a box.
 func (c *Canvas) paintBackground(box *layout.LayoutBox, ctx *PaintContext) {
 	style := box.ComputedStyle
 	if style == nil {
 		return
 	}
 
-	// Get background color
+	layers := parseBackgroundLayers(style)
 	bgColor := getBackgroundColor(style)
-	if bgColor.A == 0 {
+	if bgColor.A == 0 && !hasBackgroundImage(layers) {
 		// Transparent background
 		return
 	}
 
-	// Paint background over the border box
-	borderBox := box.Dimensions.BorderBox()
+	border := borderBoxShape(box)
+	if bgColor.A > 0 {
+		// The color is painted under all layers, clipped like the final layer
+		shape := boxArea(box, border, backgroundColorClip(layers))
+		if shape.Radii.IsZero() {
+			ctx.DisplayList = append(ctx.DisplayList, &SolidColorCommand{
+				Color: bgColor,
+				Rect:  shape.Rect,
+			})
+		} else {
+			ctx.DisplayList = append(ctx.DisplayList, &RoundedRectCommand{
+				Color: bgColor,
+				Shape: shape,
+			})
+		}
+	}
 
-	ctx.DisplayList = append(ctx.DisplayList, &SolidColorCommand{
-		Color: bgColor,
-		Rect:  borderBox,
-	})
+	c.paintBackgroundLayers(box, layers, border, ctx)
 }
 
 // paintBorders paints the borders of a box.
@@ -345,6 +422,20 @@ func (c *Canvas) paintBorders(box *layout.LayoutBox, ctx *PaintContext) {
 	borderColor := getBorderColor(style, "border-top-color")
 	borderStyle := getBorderStyle(style, "border-top-style")
 
+	// Sides without their own style or color follow the top side
+	colors, styles := borderSides(style, borderColor, borderStyle)
+	outer := borderBoxShape(box)
+	if !outer.Radii.IsZero() || !uniformBorderSides(colors, styles) {
+		ctx.DisplayList = append(ctx.DisplayList, &RoundedBorderCommand{
+			Outer:  outer,
+			Inner:  outer.Inset(box.Dimensions.Border),
+			Widths: box.Dimensions.Border,
+			Colors: colors,
+			Styles: styles,
+		})
+		return
+	}
+
 	// Only paint if border style is not "none" or "hidden"
 	if borderStyle == "none" || borderStyle == "hidden" {
 		return
@@ -374,9 +465,14 @@ func (c *Canvas) paintChildren(box *layout.LayoutBox, ctx *PaintContext) {
 			c.paintText(child, ctx)
 		} else {
 			// Recursively paint child boxes
+			c.paintBoxShadows(child, ctx, false)
 			c.paintBackground(child, ctx)
+			c.paintBoxShadows(child, ctx, true)
 			c.paintBorders(child, ctx)
+			c.paintColumnRules(child, ctx)
+			c.paintReplaced(child, ctx)
 			c.paintChildren(child, ctx)
+			c.paintOutline(child, ctx)
 		}
 	}
 }
@@ -396,6 +492,40 @@ func (c *Canvas) paintText(box *layout.LayoutBox, ctx *PaintContext) {
 	fontWeight := getFontWeight(style)
 	fontStyle := getFontStyle(style)
 
+	// Text laid out in lines paints each of its fragments, with
+	// right-to-left runs in visual order
+	if len(box.Fragments) > 0 {
+		orientation := layout.TextOrientation(style)
+		start, end, selected := c.selectedText(box)
+		for _, fragment := range box.Fragments {
+			cmd := &TextCommand{
+				Text:          fragment.VisualText(),
+				X:             fragment.Rect.X,
+				Y:             fragment.Rect.Y,
+				Color:         textColor,
+				FontSize:      fontSize,
+				FontWeight:    fontWeight,
+				FontStyle:     fontStyle,
+				LetterSpacing: fragment.LetterSpacing,
+				WordSpacing:   fragment.WordSpacing,
+				Glyphs:        fragment.Glyphs,
+				Ascent:        fragment.Ascent,
+			}
+			if orientation != "" {
+				cmd.Text = fragment.Text
+				cmd.WritingMode = layout.WritingMode(style)
+				cmd.Orientation = orientation
+				cmd.Width, cmd.Height = fragment.Rect.Width, fragment.Rect.Height
+			}
+			if selected {
+				paintSelectedFragment(fragment, cmd, start, end, style, ctx)
+				continue
+			}
+			ctx.DisplayList = append(ctx.DisplayList, cmd)
+		}
+		return
+	}
+
 	// Calculate text position
 	x := box.Dimensions.Content.X
 	y := box.Dimensions.Content.Y
@@ -531,6 +661,7 @@ func getFontStyle(style *css.ComputedStyle) string {
 
 // SetPixel sets a single pixel on the canvas.
 func (c *Canvas) SetPixel(x, y int, col color.RGBA) {
+	x, y = x-c.X, y-c.Y
 	if x >= 0 && x < c.Width && y >= 0 && y < c.Height {
 		c.Pixels[y*c.Width+x] = col
 	}
@@ -538,6 +669,7 @@ func (c *Canvas) SetPixel(x, y int, col color.RGBA) {
 
 // SetPixelBlend sets a pixel with alpha compositing.
 func (c *Canvas) SetPixelBlend(x, y int, col color.RGBA) {
+	x, y = x-c.X, y-c.Y
 	if x < 0 || x >= c.Width || y < 0 || y >= c.Height {
 		return
 	}
@@ -570,10 +702,10 @@ func (c *Canvas) SetPixelBlend(x, y int, col color.RGBA) {
 // FillRect fills a rectangle with the given color.
 func (c *Canvas) FillRect(x, y, width, height int, col color.RGBA) {
 	// Clip to canvas bounds
-	x1 := max(x, 0)
-	y1 := max(y, 0)
-	x2 := min(x+width, c.Width)
-	y2 := min(y+height, c.Height)
+	x1 := max(x, c.X)
+	y1 := max(y, c.Y)
+	x2 := min(x+width, c.X+c.Width)
+	y2 := min(y+height, c.Y+c.Height)
 
 	// Use blending if alpha is not fully opaque
 	if col.A < 255 {
@@ -585,7 +717,7 @@ func (c *Canvas) FillRect(x, y, width, height int, col color.RGBA) {
 	} else {
 		for py := y1; py < y2; py++ {
 			for px := x1; px < x2; px++ {
-				c.Pixels[py*c.Width+px] = col
+				c.Pixels[(py-c.Y)*c.Width+px-c.X] = col
 			}
 		}
 	}
@@ -713,6 +845,12 @@ var bitmapFont = map[rune][]uint8{
 
 // drawText draws text at the given position using a simple bitmap font.
 func (c *Canvas) drawText(text string, x, y int, col color.RGBA, fontSize float64, fontWeight string) {
+	c.drawTextSpaced(text, float64(x), y, col, fontSize, fontWeight, 0, 0)
+}
+
+// drawTextSpaced draws text with extra space after each character and each
+// word separator, as set by letter-spacing, word-spacing and justification.
+func (c *Canvas) drawTextSpaced(text string, x float64, y int, col color.RGBA, fontSize float64, fontWeight string, letterSpacing, wordSpacing float64) {
 	// Calculate scale factor based on font size (base font is 7 pixels tall)
 	scale := fontSize / 7.0
 	if scale < 1 {
@@ -735,8 +873,11 @@ func (c *Canvas) drawText(text string, x, y int, col color.RGBA, fontSize float6
 			bitmap = bitmapFont['?']
 		}
 
-		c.drawChar(currentX, y, bitmap, charWidth, charHeight, scale, col, bold)
-		currentX += charWidth + spacing
+		c.drawChar(int(math.Round(currentX)), y, bitmap, charWidth, charHeight, scale, col, bold)
+		currentX += float64(charWidth+spacing) + letterSpacing
+		if ch == ' ' || ch == 0x00A0 || ch == 0x3000 {
+			currentX += wordSpacing
+		}
 	}
 }
 
@@ -901,6 +1042,7 @@ func (c *Canvas) ClearToWhite() {
 
 // GetPixel returns the color of a pixel at the given coordinates.
 func (c *Canvas) GetPixel(x, y int) color.RGBA {
+	x, y = x-c.X, y-c.Y
 	if x < 0 || x >= c.Width || y < 0 || y >= c.Height {
 		return color.RGBA{0, 0, 0, 0}
 	}
@@ -915,6 +1057,9 @@ func (c *Canvas) Clone() *Canvas {
 		Pixels: newPixels,
 		Width:  c.Width,
 		Height: c.Height,
+		X:      c.X,
+		Y:      c.Y,
+		Scale:  c.Scale,
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/font"
 	"github.com/chrisuehlinger/viberowser/layout"
 )
 
@@ -355,6 +356,39 @@ func TestTextCommand(t *testing.T) {
 	}
 }
 
+func TestVerticalTextCommand(t *testing.T) {
+	// Without glyphs the characters are stacked down the line box, and up
+	// it in sideways-lr
+	black := color.RGBA{0, 0, 0, 255}
+	for _, mode := range []string{"vertical-rl", "sideways-lr"} {
+		canvas := NewCanvas(50, 100)
+		cmd := &TextCommand{Text: "HHHH", X: 10, Y: 10, Color: black, FontSize: 14, FontWeight: "normal",
+			WritingMode: mode, Orientation: "mixed", Width: 17, Height: 60, Ascent: 12}
+		cmd.Execute(canvas)
+		top, bottom := -1, -1
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 50; x++ {
+				if canvas.GetPixel(x, y) != black {
+					continue
+				}
+				if x < 10 || x >= 27 {
+					t.Errorf("%s: pixel at x = %d outside the line box", mode, x)
+				}
+				if top < 0 {
+					top = y
+				}
+				bottom = y
+			}
+		}
+		if top < 0 || bottom-top < 3*8 {
+			t.Errorf("%s: text spans y = %d to %d, want four characters stacked", mode, top, bottom)
+		}
+		if mode == "sideways-lr" && bottom < 60 {
+			t.Errorf("sideways-lr: text ends at y = %d, want it at the bottom of the line box", bottom)
+		}
+	}
+}
+
 func TestPaintNilRoot(t *testing.T) {
 	canvas := NewCanvas(100, 100)
 
@@ -482,6 +516,156 @@ func TestPaintWithText(t *testing.T) {
 	}
 }
 
+func TestPaintTextFragments(t *testing.T) {
+	canvas := NewCanvas(200, 60)
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("color", &css.ComputedValue{Color: css.Color{A: 255}})
+	style.SetPropertyValue("font-size", &css.ComputedValue{Length: 7})
+
+	// One text box wrapped onto two lines, the second with wide word spacing
+	textBox := &layout.LayoutBox{
+		BoxType:       layout.InlineBox,
+		TextContent:   "ignored",
+		ComputedStyle: style,
+		Fragments: []*layout.InlineItem{
+			{Rect: layout.Rect{X: 10, Y: 10, Width: 30, Height: 7}, Text: "I"},
+			{Rect: layout.Rect{X: 10, Y: 30, Width: 100, Height: 7}, Text: "I I", WordSpacing: 50},
+		},
+	}
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{textBox}}
+	canvas.Paint(root)
+
+	inked := func(x0, y0, x1, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				if canvas.GetPixel(x, y) != (color.RGBA{255, 255, 255, 255}) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if !inked(10, 10, 16, 17) || !inked(10, 30, 16, 37) {
+		t.Error("each fragment should paint at its own position")
+	}
+	// The second "I" starts after two 6px advances and 50px of word spacing
+	if inked(22, 30, 70, 37) || !inked(72, 30, 78, 37) {
+		t.Error("word spacing should move the second word")
+	}
+}
+
+func TestPaintRightToLeftFragments(t *testing.T) {
+	canvas := NewCanvas(100, 40)
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("color", &css.ComputedValue{Color: css.Color{A: 255}})
+	style.SetPropertyValue("font-size", &css.ComputedValue{Length: 7})
+
+	// "I " at an odd bidi level paints as " I"
+	textBox := &layout.LayoutBox{
+		BoxType:       layout.InlineBox,
+		TextContent:   "I ",
+		ComputedStyle: style,
+		Fragments: []*layout.InlineItem{
+			{Rect: layout.Rect{X: 10, Y: 10, Width: 12, Height: 7}, Text: "I ", Level: 1},
+		},
+	}
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{textBox}}
+	canvas.Paint(root)
+
+	inked := func(x0, x1 int) bool {
+		for y := 10; y < 17; y++ {
+			for x := x0; x < x1; x++ {
+				if canvas.GetPixel(x, y) != (color.RGBA{255, 255, 255, 255}) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if inked(10, 16) || !inked(16, 22) {
+		t.Error("right-to-left text should paint in visual order")
+	}
+}
+
+func TestTextCommandGlyphs(t *testing.T) {
+	canvas := NewCanvas(60, 30)
+	face := font.Default().Match(font.Style{Families: []string{"sans-serif"}, Weight: 400})
+	glyphs := font.Shape([]rune("Il"), face, 20, false, "")
+	cmd := &TextCommand{Text: "Il", X: 10, Y: 4, FontSize: 20, Color: color.RGBA{0, 0, 0, 255}, Glyphs: glyphs, Ascent: 16}
+	cmd.Execute(canvas)
+
+	// Nothing is painted above the top, below the baseline or past the
+	// advance of the run
+	x0, y0, x1, y1 := canvas.Width, canvas.Height, 0, 0
+	for y := 0; y < canvas.Height; y++ {
+		for x := 0; x < canvas.Width; x++ {
+			if canvas.GetPixel(x, y) == (color.RGBA{255, 255, 255, 255}) {
+				continue
+			}
+			if x < x0 {
+				x0 = x
+			}
+			if y < y0 {
+				y0 = y
+			}
+			if x+1 > x1 {
+				x1 = x + 1
+			}
+			if y+1 > y1 {
+				y1 = y + 1
+			}
+		}
+	}
+	if x1 == 0 {
+		t.Fatal("glyphs painted nothing")
+	}
+	if x0 < 10 || float64(x1) > 10+font.Advance(glyphs)+1 || y0 < 4 || y1 > 21 {
+		t.Errorf("ink spans (%d, %d)-(%d, %d)", x0, y0, x1, y1)
+	}
+	// The stems of I and l are solid
+	solid := 0
+	for x := 10; x < 30; x++ {
+		if canvas.GetPixel(x, 14) == (color.RGBA{0, 0, 0, 255}) {
+			solid++
+		}
+	}
+	if solid < 2 {
+		t.Errorf("%d solid pixels across the stems, want at least 2", solid)
+	}
+}
+
+func TestPaintTextFragmentGlyphs(t *testing.T) {
+	canvas := NewCanvas(100, 40)
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("color", &css.ComputedValue{Color: css.Color{A: 255}})
+	style.SetPropertyValue("font-size", &css.ComputedValue{Length: 16})
+	face := font.Default().Match(font.Style{Families: []string{"sans-serif"}, Weight: 400})
+	glyphs := font.Shape([]rune("H"), face, 16, false, "")
+	textBox := &layout.LayoutBox{
+		BoxType:       layout.InlineBox,
+		TextContent:   "H",
+		ComputedStyle: style,
+		Fragments: []*layout.InlineItem{
+			{Rect: layout.Rect{X: 50, Y: 10, Width: font.Advance(glyphs), Height: 16}, Text: "H", Glyphs: glyphs, Ascent: 12.8},
+		},
+	}
+	root := &layout.LayoutBox{BoxType: layout.BlockBox, Children: []*layout.LayoutBox{textBox}}
+	canvas.Paint(root)
+
+	cmd, ok := canvas.buildDisplayList(root)[0].(*TextCommand)
+	if !ok || len(cmd.Glyphs) != 1 || cmd.Ascent != 12.8 {
+		t.Fatalf("text command = %+v", cmd)
+	}
+	// The bitmap font would paint from the top of the fragment; the glyph
+	// sits on the baseline
+	white := color.RGBA{255, 255, 255, 255}
+	if canvas.GetPixel(52, 20) == white || canvas.GetPixel(52, 9) != white {
+		t.Error("glyph not painted on the baseline")
+	}
+}
+
 func TestPaintNoneDisplay(t *testing.T) {
 	canvas := NewCanvas(100, 100)
 
@@ -0,0 +1,198 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements painting at device resolution. A canvas with a scale
+// holds that many device pixels per CSS pixel; the display list is built in
+// CSS pixels and scaled to device pixels before it is executed, so edges,
+// text and gradients are rasterized at the full resolution of the device.
+// Reference: https://drafts.csswg.org/cssom-view/#dom-window-devicepixelratio
+package render
+
+import (
+	"github.com/chrisuehlinger/viberowser/font"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// scaleDisplayList returns the commands of a display list scaled from CSS
+// pixels to device pixels.
+func scaleDisplayList(list []DisplayCommand, s float64) []DisplayCommand {
+	scaled := make([]DisplayCommand, len(list))
+	for i, cmd := range list {
+		scaled[i] = scaleCommand(cmd, s)
+	}
+	return scaled
+}
+
+// scaleCommand returns a copy of a display command with its geometry scaled
+// by s. Commands of unknown types are painted unscaled.
+func scaleCommand(cmd DisplayCommand, s float64) DisplayCommand {
+	switch cmd := cmd.(type) {
+	case *SolidColorCommand:
+		return &SolidColorCommand{Color: cmd.Color, Rect: scaleRect(cmd.Rect, s)}
+	case *BorderCommand:
+		c := *cmd
+		c.Rect = scaleRect(cmd.Rect, s)
+		c.TopWidth, c.RightWidth = cmd.TopWidth*s, cmd.RightWidth*s
+		c.BottomWidth, c.LeftWidth = cmd.BottomWidth*s, cmd.LeftWidth*s
+		return &c
+	case *TextCommand:
+		c := *cmd
+		c.X, c.Y = cmd.X*s, cmd.Y*s
+		c.FontSize = cmd.FontSize * s
+		c.LetterSpacing, c.WordSpacing = cmd.LetterSpacing*s, cmd.WordSpacing*s
+		c.Ascent = cmd.Ascent * s
+		c.Width, c.Height = cmd.Width*s, cmd.Height*s
+		c.Glyphs = scaleGlyphs(cmd.Glyphs, s)
+		return &c
+	case *RoundedRectCommand:
+		return &RoundedRectCommand{Color: cmd.Color, Shape: cmd.Shape.scaled(s)}
+	case *RoundedBorderCommand:
+		c := *cmd
+		c.Outer, c.Inner = cmd.Outer.scaled(s), cmd.Inner.scaled(s)
+		c.Widths = scaleEdges(cmd.Widths, s)
+		return &c
+	case *BoxShadowCommand:
+		c := *cmd
+		c.Shadow.OffsetX, c.Shadow.OffsetY = cmd.Shadow.OffsetX*s, cmd.Shadow.OffsetY*s
+		c.Shadow.Blur, c.Shadow.Spread = cmd.Shadow.Blur*s, cmd.Shadow.Spread*s
+		c.BorderShape, c.PaddingShape = cmd.BorderShape.scaled(s), cmd.PaddingShape.scaled(s)
+		return &c
+	case *BackgroundImageCommand:
+		return &BackgroundImageCommand{
+			Image: cmd.Image.scaled(s),
+			Tile:  scaleRect(cmd.Tile, s),
+			StepX: cmd.StepX * s,
+			StepY: cmd.StepY * s,
+			Clip:  cmd.Clip.scaled(s),
+		}
+	case *LayerCommand:
+		c := *cmd
+		c.Commands = scaleDisplayList(cmd.Commands, s)
+		c.Filters = make([]Filter, len(cmd.Filters))
+		for i, f := range cmd.Filters {
+			c.Filters[i] = scaleFilter(f, s)
+		}
+		c.Clip = scaleClipShape(cmd.Clip, s)
+		if cmd.Mask != nil {
+			c.Mask = cmd.Mask.scaled(s)
+		}
+		return &c
+	case *SVGCommand:
+		// The viewport stays in CSS pixels; the SVG is painted through the
+		// scale along with its user space
+		c := *cmd
+		c.Scale = cmd.scale() * s
+		return &c
+	}
+	return cmd
+}
+
+// scaleRect scales a rectangle about the origin.
+func scaleRect(r layout.Rect, s float64) layout.Rect {
+	return layout.Rect{X: r.X * s, Y: r.Y * s, Width: r.Width * s, Height: r.Height * s}
+}
+
+// scaleEdges scales the widths of the four edges of a box.
+func scaleEdges(e layout.EdgeSizes, s float64) layout.EdgeSizes {
+	return layout.EdgeSizes{Top: e.Top * s, Right: e.Right * s, Bottom: e.Bottom * s, Left: e.Left * s}
+}
+
+// scaleGlyphs scales the advances and offsets of shaped glyphs. Their
+// outlines are scaled with the font size they are painted at.
+func scaleGlyphs(glyphs []font.Glyph, s float64) []font.Glyph {
+	if glyphs == nil {
+		return nil
+	}
+	scaled := make([]font.Glyph, len(glyphs))
+	for i, g := range glyphs {
+		g.XAdvance *= s
+		g.XOffset, g.YOffset = g.XOffset*s, g.YOffset*s
+		scaled[i] = g
+	}
+	return scaled
+}
+
+// scaled returns the rounded rectangle scaled about the origin.
+func (rr RoundedRect) scaled(s float64) RoundedRect {
+	corner := func(r CornerRadius) CornerRadius {
+		return CornerRadius{X: r.X * s, Y: r.Y * s}
+	}
+	return RoundedRect{
+		Rect: scaleRect(rr.Rect, s),
+		Radii: BorderRadii{
+			TopLeft:     corner(rr.Radii.TopLeft),
+			TopRight:    corner(rr.Radii.TopRight),
+			BottomRight: corner(rr.Radii.BottomRight),
+			BottomLeft:  corner(rr.Radii.BottomLeft),
+		},
+	}
+}
+
+// scaleClipShape scales a clip shape about the origin.
+func scaleClipShape(shape ClipShape, s float64) ClipShape {
+	switch shape := shape.(type) {
+	case RoundedRect:
+		return shape.scaled(s)
+	case EllipseShape:
+		return EllipseShape{CX: shape.CX * s, CY: shape.CY * s, RX: shape.RX * s, RY: shape.RY * s}
+	case *Path:
+		return shape.Transform(func(p Point) Point {
+			return Point{X: p.X * s, Y: p.Y * s}
+		})
+	}
+	return shape
+}
+
+// scaleFilter scales the lengths of a filter function.
+func scaleFilter(f Filter, s float64) Filter {
+	switch f := f.(type) {
+	case *BlurFilter:
+		return &BlurFilter{StdDeviation: f.StdDeviation * s}
+	case *DropShadowFilter:
+		return &DropShadowFilter{
+			OffsetX:      f.OffsetX * s,
+			OffsetY:      f.OffsetY * s,
+			StdDeviation: f.StdDeviation * s,
+			Color:        f.Color,
+		}
+	}
+	return f
+}
+
+// scaled returns the mask with its layers scaled about the origin.
+func (m *Mask) scaled(s float64) *Mask {
+	scaled := &Mask{Layers: make([]maskLayer, len(m.Layers))}
+	for i, layer := range m.Layers {
+		layer.Image = layer.Image.scaled(s)
+		layer.Tile = scaleRect(layer.Tile, s)
+		layer.StepX, layer.StepY = layer.StepX*s, layer.StepY*s
+		layer.Clip = layer.Clip.scaled(s)
+		scaled.Layers[i] = layer
+	}
+	return scaled
+}
+
+// scaled returns the gradient with its lengths scaled. Percentages are
+// resolved against the scaled tile, so they stay as they are.
+func (g *Gradient) scaled(s float64) *Gradient {
+	if g == nil {
+		return nil
+	}
+	length := func(lp lengthPercentage) lengthPercentage {
+		if !lp.Percent {
+			lp.Value *= s
+		}
+		return lp
+	}
+	scaled := *g
+	scaled.SizeX, scaled.SizeY = length(g.SizeX), length(g.SizeY)
+	scaled.Center.X.Offset = length(g.Center.X.Offset)
+	scaled.Center.Y.Offset = length(g.Center.Y.Offset)
+	scaled.Stops = make([]gradientStop, len(g.Stops))
+	for i, stop := range g.Stops {
+		if stop.Position != nil {
+			pos := length(*stop.Position)
+			stop.Position = &pos
+		}
+		scaled.Stops[i] = stop
+	}
+	return &scaled
+}
@@ -0,0 +1,93 @@
+// Package render tests for painting at device resolution.
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/font"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+func TestPaintScaled(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	style := css.NewComputedStyle(nil, nil)
+	style.SetPropertyValue("background-color", &css.ComputedValue{Color: css.Color{R: 255, A: 255}})
+	style.SetPropertyValue("border-top-style", &css.ComputedValue{Keyword: "solid"})
+	style.SetPropertyValue("border-top-color", &css.ComputedValue{Color: css.Color{B: 255, A: 255}})
+	box := &layout.LayoutBox{
+		BoxType:       layout.BlockBox,
+		ComputedStyle: style,
+		Dimensions: layout.Dimensions{
+			Content: layout.Rect{X: 5, Y: 5, Width: 10, Height: 10},
+			Border:  layout.EdgeSizes{Top: 1, Right: 1, Bottom: 1, Left: 1},
+		},
+	}
+
+	// The border box spans 4-16 CSS pixels, and 8-32 pixels at twice the
+	// resolution, with 2 pixel wide borders
+	canvas := NewCanvas(40, 40)
+	canvas.Scale = 2
+	canvas.Paint(box)
+	tests := []struct {
+		x    int
+		want color.RGBA
+	}{
+		{7, white},
+		{8, blue},
+		{9, blue},
+		{10, red},
+		{29, red},
+		{30, blue},
+		{31, blue},
+		{32, white},
+	}
+	for _, tt := range tests {
+		if got := canvas.GetPixel(tt.x, 20); got != tt.want {
+			t.Errorf("pixel at x = %d is %v, want %v", tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestTextCommandScaled(t *testing.T) {
+	face := font.Default().Match(font.Style{Families: []string{"sans-serif"}, Weight: 400})
+	glyphs := font.Shape([]rune("Il"), face, 20, false, "")
+	cmd := &TextCommand{Text: "Il", X: 10, Y: 4, FontSize: 20, Color: color.RGBA{0, 0, 0, 255}, Glyphs: glyphs, Ascent: 16}
+
+	// inkBounds returns the extent of the pixels text painted
+	inkBounds := func(c *Canvas) (x0, y0, x1, y1 int) {
+		x0, y0 = c.Width, c.Height
+		for y := 0; y < c.Height; y++ {
+			for x := 0; x < c.Width; x++ {
+				if c.GetPixel(x, y) == (color.RGBA{255, 255, 255, 255}) {
+					continue
+				}
+				x0, y0 = min(x0, x), min(y0, y)
+				x1, y1 = max(x1, x+1), max(y1, y+1)
+			}
+		}
+		return
+	}
+	canvas := NewCanvas(60, 30)
+	cmd.Execute(canvas)
+	x0, y0, x1, y1 := inkBounds(canvas)
+
+	// At twice the resolution the ink covers twice the extent
+	scaled := NewCanvas(120, 60)
+	scaleCommand(cmd, 2).Execute(scaled)
+	sx0, sy0, sx1, sy1 := inkBounds(scaled)
+	if sx1 == 0 {
+		t.Fatal("scaled glyphs painted nothing")
+	}
+	near := func(got, want int) bool { return got >= want-2 && got <= want+2 }
+	if !near(sx0, 2*x0) || !near(sy0, 2*y0) || !near(sx1, 2*x1) || !near(sy1, 2*y1) {
+		t.Errorf("scaled ink spans (%d, %d)-(%d, %d), want about twice (%d, %d)-(%d, %d)", sx0, sy0, sx1, sy1, x0, y0, x1, y1)
+	}
+	if cmd.FontSize != 20 || cmd.Glyphs[0].XAdvance != glyphs[0].XAdvance {
+		t.Error("scaling modified the command")
+	}
+}
@@ -0,0 +1,110 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements painting the selection: the text of the document's
+// selection is painted over a background, in the colors the ::selection
+// rules of its elements give it or else the default selection colors.
+// Reference: https://drafts.csswg.org/css-pseudo-4/#highlight-painting
+package render
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/font"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// SelectionColor is the background selected text is painted over where no
+// ::selection rule sets one. The text keeps its own color.
+var SelectionColor = color.RGBA{179, 215, 255, 255}
+
+// selectedText returns the part of the text node of a text box that the
+// selection of the canvas covers, in UTF-16 offsets. It returns false if
+// none of it is selected.
+func (c *Canvas) selectedText(box *layout.LayoutBox) (start, end int, ok bool) {
+	node := box.TextNode
+	if c.Selection == nil || node == nil {
+		return 0, 0, false
+	}
+	for i := 0; i < c.Selection.RangeCount(); i++ {
+		r, err := c.Selection.GetRangeAt(i)
+		if err != nil || r.Collapsed() || !r.IntersectsNode(node) {
+			continue
+		}
+		start, end = 0, math.MaxInt
+		if r.StartContainer() == node {
+			start = r.StartOffset()
+		}
+		if r.EndContainer() == node {
+			end = r.EndOffset()
+		}
+		if start < end {
+			return start, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// paintSelectedFragment paints a fragment of text whose text from start to
+// end is selected: the selection background behind the selected part, then
+// the text with the selected glyphs in the ::selection color, if one is set.
+func paintSelectedFragment(fragment *layout.InlineItem, cmd *TextCommand, start, end int, style *css.ComputedStyle, ctx *PaintContext) {
+	s, e := max(start, fragment.Start), min(end, fragment.End)
+	if s >= e || len(fragment.Carets) != fragment.End-fragment.Start+1 {
+		ctx.DisplayList = append(ctx.DisplayList, cmd)
+		return
+	}
+	x0, x1 := fragment.Carets[s-fragment.Start], fragment.Carets[e-fragment.Start]
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+
+	background, textColor, recolor := SelectionColor, cmd.Color, false
+	if selection := style.SelectionStyle(); selection != nil {
+		if val := selection.GetPropertyValue("background-color"); val != nil {
+			background = getBackgroundColor(selection)
+		}
+		if val := selection.GetPropertyValue("color"); val != nil {
+			textColor = getTextColor(selection)
+			recolor = textColor != cmd.Color
+		}
+	}
+	if background.A > 0 {
+		ctx.DisplayList = append(ctx.DisplayList, &SolidColorCommand{
+			Color: background,
+			Rect:  layout.Rect{X: fragment.Rect.X + x0, Y: fragment.Rect.Y, Width: x1 - x0, Height: fragment.Rect.Height},
+		})
+	}
+
+	// Vertical text and text without glyphs keep their color
+	if !recolor || cmd.Orientation != "" || len(cmd.Glyphs) == 0 {
+		ctx.DisplayList = append(ctx.DisplayList, cmd)
+		return
+	}
+	unselected, selected := splitGlyphs(cmd.Glyphs, x0, x1)
+	rest := *cmd
+	rest.Glyphs = unselected
+	highlighted := *cmd
+	highlighted.Glyphs = selected
+	highlighted.Color = textColor
+	ctx.DisplayList = append(ctx.DisplayList, &rest, &highlighted)
+}
+
+// splitGlyphs splits a run of glyphs into the glyphs outside and inside the
+// span from x0 to x1 along it. A glyph is inside if its middle is. Each run
+// keeps the advances of the glyphs left out, so its glyphs stay in place.
+func splitGlyphs(glyphs []font.Glyph, x0, x1 float64) (outside, inside []font.Glyph) {
+	outside = make([]font.Glyph, len(glyphs))
+	inside = make([]font.Glyph, len(glyphs))
+	pen := 0.0
+	for i, g := range glyphs {
+		blank := font.Glyph{XAdvance: g.XAdvance}
+		if mid := pen + g.XAdvance/2; mid >= x0 && mid < x1 {
+			outside[i], inside[i] = blank, g
+		} else {
+			outside[i], inside[i] = g, blank
+		}
+		pen += g.XAdvance
+	}
+	return outside, inside
+}
@@ -0,0 +1,87 @@
+// Package render tests for painting the selection.
+package render
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// paintSelection lays out a paragraph of text, selects part of it and
+// paints it, returning the canvas and the box of the text.
+func paintSelection(t *testing.T, styles string, start, end int) (*Canvas, *layout.LayoutBox) {
+	t.Helper()
+	var box *layout.LayoutBox
+	canvas, _ := paintHTML(t, `<body style="margin: 0"><p id="p" style="margin: 0; font-size: 20px">HHHH HHHH</p></body>`, styles, 300, 100,
+		func(doc *dom.Document, root *layout.LayoutBox) {
+			box = findBox(root, func(b *layout.LayoutBox) bool { return b.TextNode != nil })
+			if box == nil || len(box.Fragments) != 1 || len(box.Fragments[0].Glyphs) == 0 {
+				t.Fatal("the text should be shaped on one line")
+			}
+			text := doc.GetElementById("p").AsNode().FirstChild()
+			if err := doc.GetSelection().SetBaseAndExtent(text, start, text, end); err != nil {
+				t.Fatal(err)
+			}
+		})
+	return canvas, box
+}
+
+// countPixels counts the pixels in a span of a row of the canvas whose
+// color is near a color, as the edges of glyphs are blended with what is
+// below.
+func countPixels(c *Canvas, x0, x1, y int, col color.RGBA, tolerance int) int {
+	n := 0
+	for x := x0; x < x1; x++ {
+		if colorNear(c.GetPixel(x, y), col, tolerance) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPaintSelection(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+	canvas, box := paintSelection(t, ``, 0, 4)
+	f := box.Fragments[0]
+	split := int(f.Rect.X + f.Carets[4])
+	y := int(f.Rect.Y + f.Rect.Height/2)
+
+	// The selected text is painted over the default selection background,
+	// the rest over the page
+	if countPixels(canvas, int(f.Rect.X), split, y, SelectionColor, 0) == 0 {
+		t.Error("no selection background behind the selected text")
+	}
+	if n := countPixels(canvas, split+1, int(f.Rect.X+f.Rect.Width), y, SelectionColor, 0); n != 0 {
+		t.Errorf("%d pixels of selection background behind unselected text", n)
+	}
+	if countPixels(canvas, int(f.Rect.X), split, y, black, 60) == 0 {
+		t.Error("selected text is not painted in its own color")
+	}
+
+	// Nothing is painted for a collapsed selection
+	canvas, _ = paintSelection(t, ``, 2, 2)
+	if n := countPixels(canvas, 0, 300, y, SelectionColor, 0); n != 0 {
+		t.Errorf("%d pixels of selection background for a caret", n)
+	}
+}
+
+func TestPaintSelectionStyle(t *testing.T) {
+	black, lime, red := color.RGBA{0, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{255, 0, 0, 255}
+	canvas, box := paintSelection(t, `p::selection { background-color: lime; color: red }`, 5, 9)
+	f := box.Fragments[0]
+	split := int(f.Rect.X + f.Carets[5])
+	y := int(f.Rect.Y + f.Rect.Height/2)
+	end := int(f.Rect.X + f.Rect.Width)
+
+	if countPixels(canvas, split+1, end, y, lime, 60) == 0 || countPixels(canvas, split+1, end, y, red, 60) == 0 {
+		t.Error("selected text is not painted in the ::selection colors")
+	}
+	if countPixels(canvas, 0, split, y, lime, 60) != 0 || countPixels(canvas, 0, split, y, red, 60) != 0 {
+		t.Error("unselected text is painted in the ::selection colors")
+	}
+	if countPixels(canvas, 0, split, y, black, 60) == 0 {
+		t.Error("unselected text is not painted in its own color")
+	}
+}
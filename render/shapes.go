@@ -0,0 +1,306 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements the geometry of rounded boxes and anti-aliased fills.
+// Reference: https://www.w3.org/TR/css-backgrounds-3/#corner-shaping
+package render
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// CornerRadius is the horizontal and vertical radius of one elliptical corner.
+type CornerRadius struct {
+	X, Y float64
+}
+
+// IsZero reports whether the corner is square.
+func (r CornerRadius) IsZero() bool {
+	return r.X <= 0 || r.Y <= 0
+}
+
+// BorderRadii holds the four corner radii of a box.
+type BorderRadii struct {
+	TopLeft     CornerRadius
+	TopRight    CornerRadius
+	BottomRight CornerRadius
+	BottomLeft  CornerRadius
+}
+
+// IsZero reports whether all four corners are square.
+func (r BorderRadii) IsZero() bool {
+	return r.TopLeft.IsZero() && r.TopRight.IsZero() && r.BottomRight.IsZero() && r.BottomLeft.IsZero()
+}
+
+// RoundedRect is a rectangle with elliptical corners.
+type RoundedRect struct {
+	Rect  layout.Rect
+	Radii BorderRadii
+}
+
+// NewRoundedRect creates a rounded rectangle, scaling the radii down so
+// adjacent corners never overlap.
+// Reference: https://www.w3.org/TR/css-backgrounds-3/#corner-overlap
+func NewRoundedRect(rect layout.Rect, radii BorderRadii) RoundedRect {
+	rr := RoundedRect{Rect: rect, Radii: radii}
+	rr.constrainRadii()
+	return rr
+}
+
+// constrainRadii applies the corner overlap scale factor.
+func (rr *RoundedRect) constrainRadii() {
+	r := &rr.Radii
+	f := 1.0
+	scale := func(length, sum float64) {
+		if sum > 0 && length/sum < f {
+			f = length / sum
+		}
+	}
+	scale(rr.Rect.Width, r.TopLeft.X+r.TopRight.X)
+	scale(rr.Rect.Width, r.BottomLeft.X+r.BottomRight.X)
+	scale(rr.Rect.Height, r.TopLeft.Y+r.BottomLeft.Y)
+	scale(rr.Rect.Height, r.TopRight.Y+r.BottomRight.Y)
+	if f < 1 {
+		for _, c := range []*CornerRadius{&r.TopLeft, &r.TopRight, &r.BottomRight, &r.BottomLeft} {
+			c.X *= math.Max(f, 0)
+			c.Y *= math.Max(f, 0)
+		}
+	}
+}
+
+// Inset shrinks the rounded rectangle by the given edge widths. Corner radii
+// shrink by the adjacent edge width, as for the padding edge of a border box.
+func (rr RoundedRect) Inset(edges layout.EdgeSizes) RoundedRect {
+	rect := layout.Rect{
+		X:      rr.Rect.X + edges.Left,
+		Y:      rr.Rect.Y + edges.Top,
+		Width:  math.Max(0, rr.Rect.Width-edges.Left-edges.Right),
+		Height: math.Max(0, rr.Rect.Height-edges.Top-edges.Bottom),
+	}
+	shrink := func(c CornerRadius, dx, dy float64) CornerRadius {
+		return CornerRadius{X: math.Max(0, c.X-dx), Y: math.Max(0, c.Y-dy)}
+	}
+	radii := BorderRadii{
+		TopLeft:     shrink(rr.Radii.TopLeft, edges.Left, edges.Top),
+		TopRight:    shrink(rr.Radii.TopRight, edges.Right, edges.Top),
+		BottomRight: shrink(rr.Radii.BottomRight, edges.Right, edges.Bottom),
+		BottomLeft:  shrink(rr.Radii.BottomLeft, edges.Left, edges.Bottom),
+	}
+	return NewRoundedRect(rect, radii)
+}
+
+// Outset grows the rounded rectangle uniformly by spread (which may be negative).
+// Radii grow with the spread so the shape stays concentric, except that square
+// corners stay square.
+// Reference: https://www.w3.org/TR/css-backgrounds-3/#shadow-shape
+func (rr RoundedRect) Outset(spread float64) RoundedRect {
+	if spread < 0 {
+		return rr.Inset(layout.EdgeSizes{Top: -spread, Right: -spread, Bottom: -spread, Left: -spread})
+	}
+	rect := layout.Rect{
+		X:      rr.Rect.X - spread,
+		Y:      rr.Rect.Y - spread,
+		Width:  rr.Rect.Width + 2*spread,
+		Height: rr.Rect.Height + 2*spread,
+	}
+	grow := func(c CornerRadius) CornerRadius {
+		if c.IsZero() {
+			return CornerRadius{}
+		}
+		return CornerRadius{X: c.X + spread, Y: c.Y + spread}
+	}
+	radii := BorderRadii{
+		TopLeft:     grow(rr.Radii.TopLeft),
+		TopRight:    grow(rr.Radii.TopRight),
+		BottomRight: grow(rr.Radii.BottomRight),
+		BottomLeft:  grow(rr.Radii.BottomLeft),
+	}
+	return NewRoundedRect(rect, radii)
+}
+
+// Translate returns the rounded rectangle moved by (dx, dy).
+func (rr RoundedRect) Translate(dx, dy float64) RoundedRect {
+	rr.Rect.X += dx
+	rr.Rect.Y += dy
+	return rr
+}
+
+// Contains reports whether the point (x, y) lies inside the rounded rectangle.
+func (rr RoundedRect) Contains(x, y float64) bool {
+	r := rr.Rect
+	if x < r.X || y < r.Y || x >= r.X+r.Width || y >= r.Y+r.Height {
+		return false
+	}
+	if rr.Radii.IsZero() {
+		return true
+	}
+	right := r.X + r.Width
+	bottom := r.Y + r.Height
+	if c := rr.Radii.TopLeft; !c.IsZero() && x < r.X+c.X && y < r.Y+c.Y {
+		return insideEllipse(x, y, r.X+c.X, r.Y+c.Y, c)
+	}
+	if c := rr.Radii.TopRight; !c.IsZero() && x > right-c.X && y < r.Y+c.Y {
+		return insideEllipse(x, y, right-c.X, r.Y+c.Y, c)
+	}
+	if c := rr.Radii.BottomRight; !c.IsZero() && x > right-c.X && y > bottom-c.Y {
+		return insideEllipse(x, y, right-c.X, bottom-c.Y, c)
+	}
+	if c := rr.Radii.BottomLeft; !c.IsZero() && x < r.X+c.X && y > bottom-c.Y {
+		return insideEllipse(x, y, r.X+c.X, bottom-c.Y, c)
+	}
+	return true
+}
+
+// insideEllipse tests a point against the ellipse centered at (cx, cy).
+func insideEllipse(x, y, cx, cy float64, c CornerRadius) bool {
+	dx := (x - cx) / c.X
+	dy := (y - cy) / c.Y
+	return dx*dx+dy*dy <= 1
+}
+
+// isInterior reports whether the whole pixel square at (px, py) lies inside
+// the straight-edged part of the shape, so no sampling is needed.
+func (rr RoundedRect) isInterior(px, py int) bool {
+	r := rr.Rect
+	x0, y0 := float64(px), float64(py)
+	x1, y1 := x0+1, y0+1
+	if x0 < r.X || y0 < r.Y || x1 > r.X+r.Width || y1 > r.Y+r.Height {
+		return false
+	}
+	if rr.Radii.IsZero() {
+		return true
+	}
+	right := r.X + r.Width
+	bottom := r.Y + r.Height
+	overlaps := func(cx0, cy0, cx1, cy1 float64) bool {
+		return x0 < cx1 && x1 > cx0 && y0 < cy1 && y1 > cy0
+	}
+	rad := rr.Radii
+	return !overlaps(r.X, r.Y, r.X+rad.TopLeft.X, r.Y+rad.TopLeft.Y) &&
+		!overlaps(right-rad.TopRight.X, r.Y, right, r.Y+rad.TopRight.Y) &&
+		!overlaps(right-rad.BottomRight.X, bottom-rad.BottomRight.Y, right, bottom) &&
+		!overlaps(r.X, bottom-rad.BottomLeft.Y, r.X+rad.BottomLeft.X, bottom)
+}
+
+// innerRect returns a rectangle inside the shape, clear of its corners: the
+// band between the corners on the left and those on the right.
+func (rr RoundedRect) innerRect() layout.Rect {
+	r := rr.Rect
+	left := math.Max(rr.Radii.TopLeft.X, rr.Radii.BottomLeft.X)
+	right := math.Max(rr.Radii.TopRight.X, rr.Radii.BottomRight.X)
+	return layout.Rect{X: r.X + left, Y: r.Y, Width: math.Max(r.Width-left-right, 0), Height: r.Height}
+}
+
+// coverageSamples is the number of sub-samples per axis used for anti-aliasing.
+const coverageSamples = 4
+
+// Coverage returns the fraction (0..1) of the pixel at (px, py) covered by the shape.
+func (rr RoundedRect) Coverage(px, py int) float64 {
+	if rr.isInterior(px, py) {
+		return 1
+	}
+	r := rr.Rect
+	if float64(px+1) <= r.X || float64(py+1) <= r.Y ||
+		float64(px) >= r.X+r.Width || float64(py) >= r.Y+r.Height {
+		return 0
+	}
+	return sampleCoverage(px, py, rr.Contains)
+}
+
+// sampleCoverage estimates pixel coverage of an arbitrary shape by supersampling.
+func sampleCoverage(px, py int, inside func(x, y float64) bool) float64 {
+	hits := 0
+	for sy := 0; sy < coverageSamples; sy++ {
+		y := float64(py) + (float64(sy)+0.5)/coverageSamples
+		for sx := 0; sx < coverageSamples; sx++ {
+			x := float64(px) + (float64(sx)+0.5)/coverageSamples
+			if inside(x, y) {
+				hits++
+			}
+		}
+	}
+	return float64(hits) / (coverageSamples * coverageSamples)
+}
+
+// pixelBounds returns the integer pixel range touched by a rectangle, clipped to the canvas.
+func (c *Canvas) pixelBounds(r layout.Rect) (x0, y0, x1, y1 int) {
+	x0 = max(int(math.Floor(r.X)), c.X)
+	y0 = max(int(math.Floor(r.Y)), c.Y)
+	x1 = min(int(math.Ceil(r.X+r.Width)), c.X+c.Width)
+	y1 = min(int(math.Ceil(r.Y+r.Height)), c.Y+c.Height)
+	return
+}
+
+// BlendPixelCoverage composites a color onto a pixel with its alpha scaled by coverage.
+func (c *Canvas) BlendPixelCoverage(x, y int, col color.RGBA, coverage float64) {
+	if coverage <= 0 {
+		return
+	}
+	if coverage >= 1 {
+		if col.A == 255 {
+			c.SetPixel(x, y, col)
+		} else {
+			c.SetPixelBlend(x, y, col)
+		}
+		return
+	}
+	col.A = uint8(math.Round(float64(col.A) * coverage))
+	if col.A > 0 {
+		c.SetPixelBlend(x, y, col)
+	}
+}
+
+// FillRoundedRect fills a rounded rectangle with anti-aliased edges.
+func (c *Canvas) FillRoundedRect(rr RoundedRect, col color.RGBA) {
+	x0, y0, x1, y1 := c.pixelBounds(rr.Rect)
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			c.BlendPixelCoverage(px, py, col, rr.Coverage(px, py))
+		}
+	}
+}
+
+// FillRoundedRectClipped fills a rounded rectangle, restricted to the inside of clip.
+func (c *Canvas) FillRoundedRectClipped(rr RoundedRect, clip RoundedRect, col color.RGBA) {
+	x0, y0, x1, y1 := c.pixelBounds(rr.Rect)
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			cov := rr.Coverage(px, py)
+			if cov <= 0 {
+				continue
+			}
+			if !clip.isInterior(px, py) {
+				if cov >= 1 {
+					cov = clip.Coverage(px, py)
+				} else {
+					cov = sampleCoverage(px, py, func(x, y float64) bool {
+						return rr.Contains(x, y) && clip.Contains(x, y)
+					})
+				}
+			}
+			c.BlendPixelCoverage(px, py, col, cov)
+		}
+	}
+}
+
+// FillRoundedRing fills the area inside outer but outside inner with anti-aliased edges.
+func (c *Canvas) FillRoundedRing(outer, inner RoundedRect, col color.RGBA) {
+	x0, y0, x1, y1 := c.pixelBounds(outer.Rect)
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			if inner.isInterior(px, py) {
+				continue
+			}
+			var cov float64
+			if outer.isInterior(px, py) {
+				cov = 1 - inner.Coverage(px, py)
+			} else {
+				cov = sampleCoverage(px, py, func(x, y float64) bool {
+					return outer.Contains(x, y) && !inner.Contains(x, y)
+				})
+			}
+			c.BlendPixelCoverage(px, py, col, cov)
+		}
+	}
+}
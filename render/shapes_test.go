@@ -0,0 +1,155 @@
+// Package render tests for rounded rectangle geometry and anti-aliased fills.
+package render
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+func uniformRadii(r float64) BorderRadii {
+	c := CornerRadius{X: r, Y: r}
+	return BorderRadii{TopLeft: c, TopRight: c, BottomRight: c, BottomLeft: c}
+}
+
+func TestNewRoundedRectConstrainsRadii(t *testing.T) {
+	rr := NewRoundedRect(layout.Rect{Width: 100, Height: 40}, uniformRadii(50))
+
+	// Vertical sum 100 exceeds height 40, so radii scale by 0.4
+	if math.Abs(rr.Radii.TopLeft.X-20) > 1e-9 || math.Abs(rr.Radii.TopLeft.Y-20) > 1e-9 {
+		t.Errorf("TopLeft = %+v, want {20 20}", rr.Radii.TopLeft)
+	}
+}
+
+func TestRoundedRectContains(t *testing.T) {
+	rr := NewRoundedRect(layout.Rect{X: 0, Y: 0, Width: 100, Height: 100}, uniformRadii(20))
+
+	tests := []struct {
+		x, y float64
+		want bool
+	}{
+		{50, 50, true},
+		{1, 1, false},   // Cut off by the top-left corner
+		{99, 99, false}, // Cut off by the bottom-right corner
+		{10, 10, true},  // Inside the corner ellipse
+		{50, 0.5, true}, // Straight top edge
+		{-1, 50, false},
+		{100, 50, false},
+	}
+	for _, tt := range tests {
+		if got := rr.Contains(tt.x, tt.y); got != tt.want {
+			t.Errorf("Contains(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestRoundedRectInset(t *testing.T) {
+	rr := NewRoundedRect(layout.Rect{X: 0, Y: 0, Width: 100, Height: 100}, uniformRadii(20))
+	inner := rr.Inset(layout.EdgeSizes{Top: 5, Right: 5, Bottom: 5, Left: 30})
+
+	if inner.Rect != (layout.Rect{X: 30, Y: 5, Width: 65, Height: 90}) {
+		t.Errorf("Inset rect = %+v", inner.Rect)
+	}
+	if inner.Radii.TopLeft != (CornerRadius{X: 0, Y: 15}) {
+		t.Errorf("TopLeft = %+v, want {0 15}", inner.Radii.TopLeft)
+	}
+	if !inner.Radii.TopLeft.IsZero() {
+		t.Error("TopLeft should be square when the border is wider than the radius")
+	}
+	if inner.Radii.TopRight != (CornerRadius{X: 15, Y: 15}) {
+		t.Errorf("TopRight = %+v, want {15 15}", inner.Radii.TopRight)
+	}
+}
+
+func TestRoundedRectOutset(t *testing.T) {
+	radii := uniformRadii(10)
+	radii.TopLeft = CornerRadius{}
+	rr := NewRoundedRect(layout.Rect{X: 10, Y: 10, Width: 50, Height: 50}, radii)
+
+	out := rr.Outset(5)
+	if out.Rect != (layout.Rect{X: 5, Y: 5, Width: 60, Height: 60}) {
+		t.Errorf("Outset rect = %+v", out.Rect)
+	}
+	if !out.Radii.TopLeft.IsZero() {
+		t.Error("square corner should stay square")
+	}
+	if out.Radii.BottomRight != (CornerRadius{X: 15, Y: 15}) {
+		t.Errorf("BottomRight = %+v, want {15 15}", out.Radii.BottomRight)
+	}
+
+	in := rr.Outset(-5)
+	if in.Rect != (layout.Rect{X: 15, Y: 15, Width: 40, Height: 40}) {
+		t.Errorf("negative Outset rect = %+v", in.Rect)
+	}
+}
+
+func TestRoundedRectCoverage(t *testing.T) {
+	rr := NewRoundedRect(layout.Rect{X: 0.5, Y: 0, Width: 10, Height: 10}, BorderRadii{})
+
+	if got := rr.Coverage(5, 5); got != 1 {
+		t.Errorf("interior coverage = %v, want 1", got)
+	}
+	if got := rr.Coverage(0, 5); got != 0.5 {
+		t.Errorf("half-covered pixel = %v, want 0.5", got)
+	}
+	if got := rr.Coverage(20, 5); got != 0 {
+		t.Errorf("outside coverage = %v, want 0", got)
+	}
+}
+
+func TestFillRoundedRect(t *testing.T) {
+	canvas := NewCanvas(40, 40)
+	red := color.RGBA{255, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	canvas.FillRoundedRect(NewRoundedRect(layout.Rect{X: 0, Y: 0, Width: 40, Height: 40}, uniformRadii(20)), red)
+
+	if canvas.GetPixel(20, 20) != red {
+		t.Error("center should be filled")
+	}
+	if canvas.GetPixel(0, 0) != white {
+		t.Errorf("corner pixel = %v, want white", canvas.GetPixel(0, 0))
+	}
+
+	// A pixel on the curve should be partially blended
+	edge := canvas.GetPixel(5, 5)
+	if edge == red || edge == white {
+		t.Errorf("edge pixel = %v, want an anti-aliased blend", edge)
+	}
+}
+
+func TestFillRoundedRing(t *testing.T) {
+	canvas := NewCanvas(40, 40)
+	blue := color.RGBA{0, 0, 255, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	outer := NewRoundedRect(layout.Rect{X: 0, Y: 0, Width: 40, Height: 40}, uniformRadii(10))
+	inner := outer.Inset(layout.EdgeSizes{Top: 4, Right: 4, Bottom: 4, Left: 4})
+	canvas.FillRoundedRing(outer, inner, blue)
+
+	if canvas.GetPixel(20, 1) != blue {
+		t.Error("ring should be painted along the top edge")
+	}
+	if canvas.GetPixel(20, 20) != white {
+		t.Error("ring interior should be left untouched")
+	}
+}
+
+func TestFillRoundedRectClipped(t *testing.T) {
+	canvas := NewCanvas(20, 20)
+	green := color.RGBA{0, 128, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	rr := NewRoundedRect(layout.Rect{X: 0, Y: 0, Width: 20, Height: 20}, BorderRadii{})
+	clip := NewRoundedRect(layout.Rect{X: 5, Y: 5, Width: 10, Height: 10}, BorderRadii{})
+	canvas.FillRoundedRectClipped(rr, clip, green)
+
+	if canvas.GetPixel(10, 10) != green {
+		t.Error("inside the clip should be filled")
+	}
+	if canvas.GetPixel(2, 2) != white {
+		t.Error("outside the clip should not be filled")
+	}
+}
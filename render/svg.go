@@ -0,0 +1,529 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements rendering inline SVG and SVG images.
+// Reference: https://www.w3.org/TR/SVG2/render.html
+package render
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// Matrix is a 2D affine transform mapping (x, y) to
+// (A*x + C*y + E, B*x + D*y + F).
+type Matrix struct {
+	A, B, C, D, E, F float64
+}
+
+// IdentityMatrix returns the transform that leaves points unchanged.
+func IdentityMatrix() Matrix {
+	return Matrix{A: 1, D: 1}
+}
+
+// Multiply returns the transform that applies n first and then m.
+func (m Matrix) Multiply(n Matrix) Matrix {
+	return Matrix{
+		A: m.A*n.A + m.C*n.B,
+		B: m.B*n.A + m.D*n.B,
+		C: m.A*n.C + m.C*n.D,
+		D: m.B*n.C + m.D*n.D,
+		E: m.A*n.E + m.C*n.F + m.E,
+		F: m.B*n.E + m.D*n.F + m.F,
+	}
+}
+
+// Apply transforms a point.
+func (m Matrix) Apply(p Point) Point {
+	return Point{X: m.A*p.X + m.C*p.Y + m.E, Y: m.B*p.X + m.D*p.Y + m.F}
+}
+
+// Invert returns the inverse transform, or false if m is singular.
+func (m Matrix) Invert() (Matrix, bool) {
+	det := m.A*m.D - m.B*m.C
+	if det == 0 {
+		return Matrix{}, false
+	}
+	return Matrix{
+		A: m.D / det,
+		B: -m.B / det,
+		C: -m.C / det,
+		D: m.A / det,
+		E: (m.C*m.F - m.D*m.E) / det,
+		F: (m.B*m.E - m.A*m.F) / det,
+	}, true
+}
+
+// scale returns the mean scale factor of the transform, used for stroke
+// widths and font sizes.
+func (m Matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m.A*m.D - m.B*m.C))
+}
+
+func translateMatrix(tx, ty float64) Matrix {
+	return Matrix{A: 1, D: 1, E: tx, F: ty}
+}
+
+func scaleMatrixXY(sx, sy float64) Matrix {
+	return Matrix{A: sx, D: sy}
+}
+
+func rotateMatrix(degrees float64) Matrix {
+	rad := degrees * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	return Matrix{A: cos, B: sin, C: -sin, D: cos}
+}
+
+// ParseTransformList parses an SVG transform attribute. Invalid lists are
+// ignored as a whole, as if the attribute were absent.
+// Reference: https://www.w3.org/TR/css-transforms-1/#svg-syntax
+func ParseTransformList(value string) (Matrix, bool) {
+	m := IdentityMatrix()
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		open := strings.IndexByte(rest, '(')
+		closing := strings.IndexByte(rest, ')')
+		if open < 0 || closing < open {
+			return IdentityMatrix(), false
+		}
+		name := strings.TrimSpace(rest[:open])
+		args, ok := parseNumberList(rest[open+1 : closing])
+		if !ok {
+			return IdentityMatrix(), false
+		}
+		t, ok := transformFunction(name, args)
+		if !ok {
+			return IdentityMatrix(), false
+		}
+		m = m.Multiply(t)
+		rest = strings.TrimLeft(rest[closing+1:], " \t\r\n,")
+	}
+	return m, true
+}
+
+// transformFunction builds the matrix of one SVG transform function.
+func transformFunction(name string, args []float64) (Matrix, bool) {
+	switch {
+	case name == "matrix" && len(args) == 6:
+		return Matrix{A: args[0], B: args[1], C: args[2], D: args[3], E: args[4], F: args[5]}, true
+	case name == "translate" && len(args) == 1:
+		return translateMatrix(args[0], 0), true
+	case name == "translate" && len(args) == 2:
+		return translateMatrix(args[0], args[1]), true
+	case name == "scale" && len(args) == 1:
+		return scaleMatrixXY(args[0], args[0]), true
+	case name == "scale" && len(args) == 2:
+		return scaleMatrixXY(args[0], args[1]), true
+	case name == "rotate" && len(args) == 1:
+		return rotateMatrix(args[0]), true
+	case name == "rotate" && len(args) == 3:
+		// Rotate about (cx, cy)
+		return translateMatrix(args[1], args[2]).Multiply(rotateMatrix(args[0])).Multiply(translateMatrix(-args[1], -args[2])), true
+	case name == "skewX" && len(args) == 1:
+		return Matrix{A: 1, C: math.Tan(args[0] * math.Pi / 180), D: 1}, true
+	case name == "skewY" && len(args) == 1:
+		return Matrix{A: 1, B: math.Tan(args[0] * math.Pi / 180), D: 1}, true
+	}
+	return Matrix{}, false
+}
+
+// parseNumberList parses numbers separated by whitespace and/or commas.
+func parseNumberList(value string) ([]float64, bool) {
+	s := &pathScanner{data: value}
+	var numbers []float64
+	for !s.done() {
+		n, err := s.number()
+		if err != nil {
+			return nil, false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, true
+}
+
+// viewBoxTransform maps a viewBox onto a viewport according to
+// preserveAspectRatio.
+// Reference: https://www.w3.org/TR/SVG2/coords.html#ComputingAViewportsTransform
+func viewBoxTransform(viewBox, viewport layout.Rect, preserveAspectRatio string) Matrix {
+	fields := strings.Fields(preserveAspectRatio)
+	align, slice := "xMidYMid", false
+	if len(fields) > 0 {
+		align = fields[0]
+	}
+	if len(fields) > 1 && fields[1] == "slice" {
+		slice = true
+	}
+
+	sx := viewport.Width / viewBox.Width
+	sy := viewport.Height / viewBox.Height
+	if align != "none" {
+		if slice {
+			sx = math.Max(sx, sy)
+		} else {
+			sx = math.Min(sx, sy)
+		}
+		sy = sx
+	}
+	tx := viewport.X - viewBox.X*sx
+	ty := viewport.Y - viewBox.Y*sy
+	extraX := viewport.Width - viewBox.Width*sx
+	extraY := viewport.Height - viewBox.Height*sy
+	switch {
+	case strings.HasPrefix(align, "xMid"):
+		tx += extraX / 2
+	case strings.HasPrefix(align, "xMax"):
+		tx += extraX
+	}
+	switch {
+	case strings.HasSuffix(align, "YMid"):
+		ty += extraY / 2
+	case strings.HasSuffix(align, "YMax"):
+		ty += extraY
+	}
+	return Matrix{A: sx, D: sy, E: tx, F: ty}
+}
+
+// SVGCommand paints an SVG document fragment into a viewport.
+type SVGCommand struct {
+	Content  *layout.ReplacedContent
+	Viewport layout.Rect
+	// Scale maps the viewport to the canvas, for canvases painted at device
+	// resolution. Zero paints it unscaled.
+	Scale float64
+}
+
+// Execute renders the SVG.
+func (cmd *SVGCommand) Execute(c *Canvas) {
+	if cmd.Content == nil || cmd.Content.Root == nil {
+		return
+	}
+	r := &svgRenderer{content: cmd.Content, styles: cmd.Content.Styles}
+	s := cmd.scale()
+	r.paintViewport(c, cmd.Content.Root, cmd.Viewport, scaleMatrixXY(s, s))
+}
+
+// scale returns the scale the SVG is painted at.
+func (cmd *SVGCommand) scale() float64 {
+	if cmd.Scale == 0 {
+		return 1
+	}
+	return cmd.Scale
+}
+
+// paintReplaced paints the content of a replaced element into its content box.
+func (c *Canvas) paintReplaced(box *layout.LayoutBox, ctx *PaintContext) {
+	if box.Replaced == nil || box.Replaced.Root == nil {
+		return
+	}
+	ctx.DisplayList = append(ctx.DisplayList, &SVGCommand{
+		Content:  box.Replaced,
+		Viewport: box.Dimensions.Content,
+	})
+}
+
+// maxSVGUseDepth limits recursion through <use> references.
+const maxSVGUseDepth = 8
+
+// svgRenderer walks an SVG tree and paints it.
+type svgRenderer struct {
+	content *layout.ReplacedContent
+	// styles holds the computed styles for the tree being walked, which
+	// changes while painting the instance tree of a <use> element
+	styles map[*dom.Element]*css.ComputedStyle
+	// viewport is the size of the nearest viewport, used for percentages
+	viewport layout.Rect
+	useDepth int
+}
+
+// style returns the computed style of an element, if known.
+func (r *svgRenderer) style(el *dom.Element) *css.ComputedStyle {
+	if style, ok := r.styles[el]; ok {
+		return style
+	}
+	return r.content.Styles[el]
+}
+
+// property returns the value of a property of an element from its computed
+// style, falling back to the presentation attribute.
+func (r *svgRenderer) property(el *dom.Element, name string) string {
+	if style := r.style(el); style != nil {
+		// A lone url() keeps only the URL itself
+		if val := style.GetPropertyValue(name); val != nil && val.Keyword == "" && val.Value.Type == css.URLValue {
+			return "url(" + val.Value.Raw + ")"
+		}
+		return strings.TrimSpace(styleText(style, name))
+	}
+	return strings.TrimSpace(el.GetAttribute(name))
+}
+
+// paintViewport establishes a new viewport for an <svg> or <symbol> element
+// and paints its children. m maps the parent user space to the canvas.
+func (r *svgRenderer) paintViewport(c *Canvas, el *dom.Element, viewport layout.Rect, m Matrix) {
+	saved := r.viewport
+	defer func() { r.viewport = saved }()
+
+	inner := m
+	if viewBox, ok := layout.ParseViewBox(el.GetAttribute("viewBox")); ok {
+		inner = m.Multiply(viewBoxTransform(viewBox, viewport, el.GetAttribute("preserveAspectRatio")))
+		r.viewport = layout.Rect{Width: viewBox.Width, Height: viewBox.Height}
+	} else {
+		inner = m.Multiply(translateMatrix(viewport.X, viewport.Y))
+		r.viewport = layout.Rect{Width: viewport.Width, Height: viewport.Height}
+	}
+	r.paintChildren(c, el, inner)
+}
+
+// paintChildren paints the element children of a container.
+func (r *svgRenderer) paintChildren(c *Canvas, el *dom.Element, m Matrix) {
+	for child := el.FirstElementChild(); child != nil; child = child.NextElementSibling() {
+		if child.NamespaceURI() == dom.SVGNamespace {
+			r.paintElement(c, child, m)
+		}
+	}
+}
+
+// paintGroup runs paint for a container element, compositing what it paints
+// as a group when the container has opacity.
+func (r *svgRenderer) paintGroup(c *Canvas, el *dom.Element, paint func(target *Canvas)) {
+	opacity := r.opacity(el, "opacity")
+	if opacity <= 0 {
+		return
+	}
+	if opacity >= 1 {
+		paint(c)
+		return
+	}
+	layer := c.newLayer(c.X, c.Y, c.X+c.Width, c.Y+c.Height)
+	paint(layer)
+	c.Composite(layer, opacity, "normal")
+}
+
+// paintElement paints one SVG element in the user space given by m.
+func (r *svgRenderer) paintElement(c *Canvas, el *dom.Element, m Matrix) {
+	if r.property(el, "display") == "none" {
+		return
+	}
+	if t, ok := ParseTransformList(el.GetAttribute("transform")); ok {
+		m = m.Multiply(t)
+	}
+
+	switch el.LocalName() {
+	case "g", "a", "switch":
+		r.paintGroup(c, el, func(target *Canvas) {
+			r.paintChildren(target, el, m)
+		})
+	case "svg":
+		viewport := layout.Rect{
+			X:      r.length(el, "x", r.viewport.Width, 0),
+			Y:      r.length(el, "y", r.viewport.Height, 0),
+			Width:  r.length(el, "width", r.viewport.Width, r.viewport.Width),
+			Height: r.length(el, "height", r.viewport.Height, r.viewport.Height),
+		}
+		r.paintGroup(c, el, func(target *Canvas) {
+			r.paintViewport(target, el, viewport, m)
+		})
+	case "use":
+		r.paintGroup(c, el, func(target *Canvas) {
+			r.paintUse(target, el, m)
+		})
+	case "rect", "circle", "ellipse", "line", "polyline", "polygon", "path":
+		if path := r.shapePath(el); path != nil {
+			r.paintShape(c, el, path, m)
+		}
+	case "text":
+		r.paintSVGText(c, el, m)
+	}
+}
+
+// paintUse paints the element referenced by a <use> element.
+// Reference: https://www.w3.org/TR/SVG2/struct.html#UseElement
+func (r *svgRenderer) paintUse(c *Canvas, el *dom.Element, m Matrix) {
+	if r.useDepth >= maxSVGUseDepth {
+		return
+	}
+	target := layout.ResolveSVGReference(el, layout.SVGHref(el))
+	if target == nil || target.NamespaceURI() != dom.SVGNamespace {
+		return
+	}
+
+	savedStyles := r.styles
+	if instance, ok := r.content.InstanceStyles[el]; ok {
+		r.styles = instance
+	}
+	r.useDepth++
+	defer func() {
+		r.styles = savedStyles
+		r.useDepth--
+	}()
+
+	m = m.Multiply(translateMatrix(r.length(el, "x", r.viewport.Width, 0), r.length(el, "y", r.viewport.Height, 0)))
+	switch target.LocalName() {
+	case "symbol", "svg":
+		// The use element's width and height size the referenced viewport
+		viewport := layout.Rect{
+			Width:  r.length(el, "width", r.viewport.Width, r.length(target, "width", r.viewport.Width, r.viewport.Width)),
+			Height: r.length(el, "height", r.viewport.Height, r.length(target, "height", r.viewport.Height, r.viewport.Height)),
+		}
+		if t, ok := ParseTransformList(target.GetAttribute("transform")); ok && target.LocalName() == "svg" {
+			m = m.Multiply(t)
+		}
+		if r.property(target, "display") != "none" || target.LocalName() == "symbol" {
+			r.paintViewport(c, target, viewport, m)
+		}
+	default:
+		r.paintElement(c, target, m)
+	}
+}
+
+// length resolves a length attribute in user units. Percentages refer to
+// base; missing or invalid values yield def.
+func (r *svgRenderer) length(el *dom.Element, attr string, base, def float64) float64 {
+	value := strings.TrimSpace(el.GetAttribute(attr))
+	if value == "" {
+		return def
+	}
+	if strings.HasSuffix(value, "%") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return def
+		}
+		return n / 100 * base
+	}
+	fontSize := 16.0
+	if style := r.style(el); style != nil {
+		fontSize = getFontSize(style)
+	}
+	for _, unit := range []struct {
+		suffix string
+		factor float64
+	}{{"px", 1}, {"em", fontSize}, {"pt", 4.0 / 3}, {"pc", 16}, {"in", 96}, {"cm", 96 / 2.54}, {"mm", 96 / 25.4}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(value, unit.suffix), 64)
+			if err != nil {
+				return def
+			}
+			return n * unit.factor
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// diagonal returns the normalized viewport diagonal used for percentages
+// that refer to neither axis, such as a circle's radius.
+func (r *svgRenderer) diagonal() float64 {
+	return math.Hypot(r.viewport.Width, r.viewport.Height) / math.Sqrt2
+}
+
+// shapePath builds the outline of a basic shape or path element in user
+// space, or nil if the shape does not render.
+// Reference: https://www.w3.org/TR/SVG2/shapes.html
+func (r *svgRenderer) shapePath(el *dom.Element) *Path {
+	w, h := r.viewport.Width, r.viewport.Height
+	rule := FillRuleNonZero
+	if r.property(el, "fill-rule") == "evenodd" {
+		rule = FillRuleEvenOdd
+	}
+
+	switch el.LocalName() {
+	case "rect":
+		x, y := r.length(el, "x", w, 0), r.length(el, "y", h, 0)
+		width, height := r.length(el, "width", w, 0), r.length(el, "height", h, 0)
+		if width <= 0 || height <= 0 {
+			return nil
+		}
+		rx, ry := r.length(el, "rx", w, -1), r.length(el, "ry", h, -1)
+		switch {
+		case rx < 0 && ry < 0:
+			rx, ry = 0, 0
+		case rx < 0:
+			rx = ry
+		case ry < 0:
+			ry = rx
+		}
+		rx, ry = math.Min(rx, width/2), math.Min(ry, height/2)
+		if rx == 0 || ry == 0 {
+			return NewPolygonPath([]Point{{x, y}, {x + width, y}, {x + width, y + height}, {x, y + height}}, rule)
+		}
+		b := &pathBuilder{path: &Path{FillRule: rule}}
+		b.moveTo(Point{x + rx, y})
+		b.lineTo(Point{x + width - rx, y})
+		b.arcTo(rx, ry, 0, false, true, Point{x + width, y + ry})
+		b.lineTo(Point{x + width, y + height - ry})
+		b.arcTo(rx, ry, 0, false, true, Point{x + width - rx, y + height})
+		b.lineTo(Point{x + rx, y + height})
+		b.arcTo(rx, ry, 0, false, true, Point{x, y + height - ry})
+		b.lineTo(Point{x, y + ry})
+		b.arcTo(rx, ry, 0, false, true, Point{x + rx, y})
+		b.endSubpath(true)
+		return b.path
+	case "circle", "ellipse":
+		cx, cy := r.length(el, "cx", w, 0), r.length(el, "cy", h, 0)
+		var rx, ry float64
+		if el.LocalName() == "circle" {
+			rx = r.length(el, "r", r.diagonal(), 0)
+			ry = rx
+		} else {
+			rx, ry = r.length(el, "rx", w, -1), r.length(el, "ry", h, -1)
+			if rx < 0 {
+				rx = ry
+			}
+			if ry < 0 {
+				ry = rx
+			}
+		}
+		if rx <= 0 || ry <= 0 {
+			return nil
+		}
+		points := make([]Point, 0, 4*curveSegments)
+		for i := 0; i < 4*curveSegments; i++ {
+			theta := 2 * math.Pi * float64(i) / (4 * curveSegments)
+			points = append(points, Point{X: cx + rx*math.Cos(theta), Y: cy + ry*math.Sin(theta)})
+		}
+		return NewPolygonPath(points, rule)
+	case "line":
+		p1 := Point{X: r.length(el, "x1", w, 0), Y: r.length(el, "y1", h, 0)}
+		p2 := Point{X: r.length(el, "x2", w, 0), Y: r.length(el, "y2", h, 0)}
+		return &Path{Subpaths: [][]Point{{p1, p2}}, Closed: []bool{false}, FillRule: rule}
+	case "polyline", "polygon":
+		numbers, _ := parseNumberList(el.GetAttribute("points"))
+		if len(numbers) < 4 {
+			return nil
+		}
+		points := make([]Point, 0, len(numbers)/2)
+		for i := 0; i+1 < len(numbers); i += 2 {
+			points = append(points, Point{X: numbers[i], Y: numbers[i+1]})
+		}
+		return &Path{Subpaths: [][]Point{points}, Closed: []bool{el.LocalName() == "polygon"}, FillRule: rule}
+	case "path":
+		path, _ := ParsePathData(el.GetAttribute("d"), rule)
+		if len(path.Subpaths) == 0 {
+			return nil
+		}
+		return path
+	}
+	return nil
+}
+
+// opacity reads an opacity property such as fill-opacity, clamped to 0..1.
+func (r *svgRenderer) opacity(el *dom.Element, name string) float64 {
+	value := r.property(el, name)
+	if value == "" {
+		return 1
+	}
+	percent := strings.HasSuffix(value, "%")
+	n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 1
+	}
+	if percent {
+		n /= 100
+	}
+	return math.Min(math.Max(n, 0), 1)
+}
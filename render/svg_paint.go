@@ -0,0 +1,610 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements SVG painting: fills, strokes, paint servers and text.
+// Reference: https://www.w3.org/TR/SVG2/painting.html
+package render
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// paintServer returns the paint color at a canvas position.
+type paintServer func(x, y float64) color.RGBA
+
+// solidPaint returns a paint server for a single color.
+func solidPaint(col color.RGBA) paintServer {
+	return func(x, y float64) color.RGBA { return col }
+}
+
+// paintShape fills and then strokes a shape. path is in user space and m maps
+// it to the canvas.
+func (r *svgRenderer) paintShape(c *Canvas, el *dom.Element, path *Path, m Matrix) {
+	if r.property(el, "visibility") == "hidden" {
+		return
+	}
+	opacity := r.opacity(el, "opacity")
+	if opacity <= 0 {
+		return
+	}
+	target := c
+	if opacity < 1 {
+		target = c.newLayer(c.X, c.Y, c.X+c.Width, c.Y+c.Height)
+	}
+
+	bbox := path.Bounds()
+	device := path.Transform(m.Apply)
+	if fill := r.resolvePaint(el, "fill", bbox, m); fill != nil && el.LocalName() != "line" {
+		fillShape(target, device, fill, r.opacity(el, "fill-opacity"))
+	}
+	if stroke := r.resolvePaint(el, "stroke", bbox, m); stroke != nil {
+		if outline := r.strokeOutline(el, path, m); outline != nil {
+			fillShape(target, outline, stroke, r.opacity(el, "stroke-opacity"))
+		}
+	}
+
+	if target != c {
+		c.Composite(target, opacity, "normal")
+	}
+}
+
+// fillShape paints the inside of a shape with anti-aliased edges.
+func fillShape(c *Canvas, shape ClipShape, paint paintServer, opacity float64) {
+	if opacity <= 0 {
+		return
+	}
+	x0, y0, x1, y1 := c.pixelBounds(shape.Bounds())
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			cov := clipShapeCoverage(shape, px, py)
+			if cov <= 0 {
+				continue
+			}
+			c.BlendPixelCoverage(px, py, paint(float64(px)+0.5, float64(py)+0.5), cov*opacity)
+		}
+	}
+}
+
+// resolvePaint resolves the fill or stroke of an element to a paint server,
+// or nil for none. bbox is the shape's bounding box in user space.
+func (r *svgRenderer) resolvePaint(el *dom.Element, property string, bbox layout.Rect, m Matrix) paintServer {
+	value := r.property(el, property)
+	lower := strings.ToLower(value)
+	if value == "" || lower == "none" {
+		return nil
+	}
+	if strings.HasPrefix(lower, "url(") {
+		closing := strings.IndexByte(value, ')')
+		if closing < 0 {
+			return nil
+		}
+		if server := r.gradientPaint(el, value[:closing+1], bbox, m); server != nil {
+			return server
+		}
+		// An invalid reference falls back to the color after it, if any
+		value = strings.TrimSpace(value[closing+1:])
+		lower = strings.ToLower(value)
+		if value == "" || lower == "none" {
+			return nil
+		}
+	}
+	col, ok := r.color(el, value)
+	if !ok {
+		return nil
+	}
+	return solidPaint(col)
+}
+
+// color parses a color value, resolving currentcolor against the element.
+func (r *svgRenderer) color(el *dom.Element, value string) (color.RGBA, bool) {
+	if strings.EqualFold(value, "currentcolor") {
+		if style := r.style(el); style != nil {
+			return getTextColor(style), true
+		}
+		return color.RGBA{A: 255}, true
+	}
+	parts := css.NonWhitespaceComponents(css.ParseComponentValueList(value))
+	if len(parts) != 1 {
+		return color.RGBA{}, false
+	}
+	if ident, ok := css.ComponentIdent(parts[0]); ok && ident == "transparent" {
+		return color.RGBA{}, true
+	}
+	c, ok := css.ComponentColor(parts[0])
+	if !ok {
+		return color.RGBA{}, false
+	}
+	return toRGBA(c), true
+}
+
+// svgGradient is a resolved linearGradient or radialGradient.
+type svgGradient struct {
+	Radial bool
+	// Geometry in gradient space: x1, y1, x2, y2 for linear gradients and
+	// cx, cy, r, fx, fy for radial gradients
+	X1, Y1, X2, Y2 float64
+	CX, CY, R      float64
+	FX, FY         float64
+	Spread         string
+	Stops          []resolvedStop
+	// Transform maps gradient space to the canvas
+	Transform Matrix
+}
+
+// gradientAttr looks up a gradient attribute, following href to the
+// gradients it inherits from.
+func gradientAttr(el *dom.Element, name string) (string, bool) {
+	for depth := 0; el != nil && depth < maxSVGUseDepth; depth++ {
+		if el.HasAttribute(name) {
+			return el.GetAttribute(name), true
+		}
+		el = layout.ResolveSVGReference(el, layout.SVGHref(el))
+	}
+	return "", false
+}
+
+// gradientPaint builds a paint server for a url() reference to a gradient.
+// Reference: https://www.w3.org/TR/SVG2/pservers.html
+func (r *svgRenderer) gradientPaint(el *dom.Element, ref string, bbox layout.Rect, m Matrix) paintServer {
+	target := layout.ResolveSVGReference(el, ref)
+	if target == nil {
+		return nil
+	}
+	g := &svgGradient{}
+	switch target.LocalName() {
+	case "linearGradient":
+	case "radialGradient":
+		g.Radial = true
+	default:
+		return nil
+	}
+
+	stops := r.gradientStops(target)
+	if len(stops) == 0 {
+		return nil
+	}
+	if len(stops) == 1 {
+		col := stops[0].Color.rgba()
+		return solidPaint(col)
+	}
+	g.Stops = stops
+
+	units, _ := gradientAttr(target, "gradientUnits")
+	userSpace := units == "userSpaceOnUse"
+	if !userSpace && (bbox.Width == 0 || bbox.Height == 0) {
+		return nil
+	}
+	coord := func(name string, axis float64, def string) float64 {
+		value, ok := gradientAttr(target, name)
+		if !ok {
+			value = def
+		}
+		value = strings.TrimSpace(value)
+		percent := strings.HasSuffix(value, "%")
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0
+		}
+		if percent {
+			n /= 100
+			if userSpace {
+				n *= axis
+			}
+		}
+		return n
+	}
+	diagonal := r.diagonal()
+	if !userSpace {
+		diagonal = 1
+	}
+	if g.Radial {
+		g.CX = coord("cx", r.viewport.Width, "50%")
+		g.CY = coord("cy", r.viewport.Height, "50%")
+		g.R = coord("r", diagonal, "50%")
+		g.FX, g.FY = g.CX, g.CY
+		if _, ok := gradientAttr(target, "fx"); ok {
+			g.FX = coord("fx", r.viewport.Width, "50%")
+		}
+		if _, ok := gradientAttr(target, "fy"); ok {
+			g.FY = coord("fy", r.viewport.Height, "50%")
+		}
+	} else {
+		g.X1 = coord("x1", r.viewport.Width, "0%")
+		g.Y1 = coord("y1", r.viewport.Height, "0%")
+		g.X2 = coord("x2", r.viewport.Width, "100%")
+		g.Y2 = coord("y2", r.viewport.Height, "0%")
+	}
+	g.Spread, _ = gradientAttr(target, "spreadMethod")
+
+	g.Transform = m
+	if !userSpace {
+		g.Transform = g.Transform.Multiply(Matrix{A: bbox.Width, D: bbox.Height, E: bbox.X, F: bbox.Y})
+	}
+	if value, ok := gradientAttr(target, "gradientTransform"); ok {
+		if t, ok := ParseTransformList(value); ok {
+			g.Transform = g.Transform.Multiply(t)
+		}
+	}
+	inverse, ok := g.Transform.Invert()
+	if !ok {
+		return nil
+	}
+	return func(x, y float64) color.RGBA {
+		p := inverse.Apply(Point{X: x, Y: y})
+		return colorAtStops(g.Stops, g.offset(p)).rgba()
+	}
+}
+
+// offset returns the gradient offset of a point in gradient space, after
+// applying the spread method.
+func (g *svgGradient) offset(p Point) float64 {
+	var t float64
+	if g.Radial {
+		t = radialOffset(p, Point{g.FX, g.FY}, Point{g.CX, g.CY}, g.R)
+	} else {
+		dx, dy := g.X2-g.X1, g.Y2-g.Y1
+		lengthSq := dx*dx + dy*dy
+		if lengthSq == 0 {
+			return 1
+		}
+		t = ((p.X-g.X1)*dx + (p.Y-g.Y1)*dy) / lengthSq
+	}
+	switch g.Spread {
+	case "repeat":
+		t -= math.Floor(t)
+	case "reflect":
+		t = math.Mod(math.Abs(t), 2)
+		if t > 1 {
+			t = 2 - t
+		}
+	}
+	return t
+}
+
+// radialOffset returns the offset of p on the ray from the focal point f to
+// the circle of radius r around c.
+func radialOffset(p, f, c Point, r float64) float64 {
+	if r <= 0 {
+		return 1
+	}
+	dx, dy := p.X-f.X, p.Y-f.Y
+	dist := math.Hypot(dx, dy)
+	if dist == 0 {
+		return 0
+	}
+	// Solve |f + s*(dx, dy)/dist - c| = r for s > 0
+	ux, uy := dx/dist, dy/dist
+	ox, oy := f.X-c.X, f.Y-c.Y
+	b := ox*ux + oy*uy
+	disc := b*b - (ox*ox + oy*oy - r*r)
+	if disc < 0 {
+		return 1
+	}
+	edge := -b + math.Sqrt(disc)
+	if edge <= 0 {
+		return 1
+	}
+	return dist / edge
+}
+
+// gradientStops collects the stops of a gradient, inheriting them from the
+// referenced gradient when it has none of its own.
+func (r *svgRenderer) gradientStops(el *dom.Element) []resolvedStop {
+	for depth := 0; el != nil && depth < maxSVGUseDepth; depth++ {
+		var stops []gradientStop
+		for child := el.FirstElementChild(); child != nil; child = child.NextElementSibling() {
+			if child.LocalName() != "stop" {
+				continue
+			}
+			col, ok := r.color(child, r.property(child, "stop-color"))
+			if !ok {
+				col = color.RGBA{A: 255}
+			}
+			col.A = uint8(math.Round(float64(col.A) * r.opacity(child, "stop-opacity")))
+			offset := parseStopOffset(child.GetAttribute("offset"))
+			stops = append(stops, gradientStop{Color: col, Position: &lengthPercentage{Value: offset}})
+		}
+		if len(stops) > 0 {
+			return resolveStops(stops, 1)
+		}
+		el = layout.ResolveSVGReference(el, layout.SVGHref(el))
+	}
+	return nil
+}
+
+// parseStopOffset parses a stop offset as a number or percentage, clamped to 0..1.
+func parseStopOffset(value string) float64 {
+	value = strings.TrimSpace(value)
+	percent := strings.HasSuffix(value, "%")
+	n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0
+	}
+	if percent {
+		n /= 100
+	}
+	return math.Min(math.Max(n, 0), 1)
+}
+
+// strokeShape is the area covered by stroking a path. Joins are drawn round,
+// which approximates miter and bevel joins for thin strokes.
+type strokeShape struct {
+	Subpaths  [][]Point
+	Closed    []bool
+	HalfWidth float64
+	Cap       string
+	bounds    layout.Rect
+}
+
+// strokeOutline builds the stroke area of a path in canvas space, applying
+// stroke-width, stroke-linecap and stroke-dasharray.
+func (r *svgRenderer) strokeOutline(el *dom.Element, path *Path, m Matrix) ClipShape {
+	width := r.lengthValue(el, r.property(el, "stroke-width"), r.diagonal(), 1)
+	if width <= 0 {
+		return nil
+	}
+
+	subpaths, closed := path.Subpaths, path.Closed
+	if dashes := r.dashArray(el); dashes != nil {
+		subpaths, closed = dashPath(path, dashes, r.lengthValue(el, r.property(el, "stroke-dashoffset"), r.diagonal(), 0))
+	}
+	s := &strokeShape{
+		HalfWidth: width * m.scale() / 2,
+		Cap:       r.property(el, "stroke-linecap"),
+		Closed:    closed,
+	}
+	for _, sub := range subpaths {
+		mapped := make([]Point, len(sub))
+		for i, p := range sub {
+			mapped[i] = m.Apply(p)
+		}
+		s.Subpaths = append(s.Subpaths, mapped)
+	}
+	bounds := (&Path{Subpaths: s.Subpaths}).Bounds()
+	s.bounds = layout.Rect{
+		X:      bounds.X - s.HalfWidth,
+		Y:      bounds.Y - s.HalfWidth,
+		Width:  bounds.Width + 2*s.HalfWidth,
+		Height: bounds.Height + 2*s.HalfWidth,
+	}
+	return s
+}
+
+// lengthValue resolves a length property value in user units.
+func (r *svgRenderer) lengthValue(el *dom.Element, value string, base, def float64) float64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return def
+	}
+	if strings.HasSuffix(value, "%") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return def
+		}
+		return n / 100 * base
+	}
+	parts := css.NonWhitespaceComponents(css.ParseComponentValueList(value))
+	if len(parts) != 1 {
+		return def
+	}
+	if n, unit, tokType, ok := css.ComponentNumber(parts[0]); ok && tokType == css.TokenNumber && unit == "" {
+		return n
+	}
+	if length, ok := resolveComponentLength(parts[0], r.style(el), base); ok {
+		return length
+	}
+	return def
+}
+
+// dashArray returns the dash pattern of an element, or nil for solid strokes.
+func (r *svgRenderer) dashArray(el *dom.Element) []float64 {
+	value := r.property(el, "stroke-dasharray")
+	if value == "" || value == "none" {
+		return nil
+	}
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	var dashes []float64
+	total := 0.0
+	for _, f := range fields {
+		d := r.lengthValue(el, f, r.diagonal(), -1)
+		if d < 0 {
+			return nil
+		}
+		dashes = append(dashes, d)
+		total += d
+	}
+	if total == 0 {
+		return nil
+	}
+	if len(dashes)%2 == 1 {
+		dashes = append(dashes, dashes...)
+	}
+	return dashes
+}
+
+// dashPath splits the subpaths of a path into open dashes.
+func dashPath(path *Path, dashes []float64, offset float64) ([][]Point, []bool) {
+	var total float64
+	for _, d := range dashes {
+		total += d
+	}
+	var out [][]Point
+	var closed []bool
+	for i, sub := range path.Subpaths {
+		points := sub
+		if i < len(path.Closed) && path.Closed[i] {
+			points = append(append([]Point{}, sub...), sub[0])
+		}
+		// Find the starting dash for the offset
+		pos := math.Mod(offset, total)
+		if pos < 0 {
+			pos += total
+		}
+		index := 0
+		for pos >= dashes[index] {
+			pos -= dashes[index]
+			index = (index + 1) % len(dashes)
+		}
+		remaining := dashes[index] - pos
+		on := index%2 == 0
+		var current []Point
+		if on {
+			current = []Point{points[0]}
+		}
+		for j := 0; j+1 < len(points); j++ {
+			a, b := points[j], points[j+1]
+			segLen := math.Hypot(b.X-a.X, b.Y-a.Y)
+			t := 0.0
+			for segLen-t > remaining {
+				t += remaining
+				p := Point{X: a.X + (b.X-a.X)*t/segLen, Y: a.Y + (b.Y-a.Y)*t/segLen}
+				if on {
+					out = append(out, append(current, p))
+					closed = append(closed, false)
+					current = nil
+				} else {
+					current = []Point{p}
+				}
+				on = !on
+				index = (index + 1) % len(dashes)
+				remaining = dashes[index]
+			}
+			remaining -= segLen - t
+			if on {
+				current = append(current, b)
+			}
+		}
+		if on && len(current) > 1 {
+			out = append(out, current)
+			closed = append(closed, false)
+		}
+	}
+	return out, closed
+}
+
+// Bounds returns the bounding rectangle of the stroke.
+func (s *strokeShape) Bounds() layout.Rect {
+	return s.bounds
+}
+
+// Contains reports whether a point is within half the stroke width of the path.
+func (s *strokeShape) Contains(x, y float64) bool {
+	hw := s.HalfWidth
+	for i, sub := range s.Subpaths {
+		closed := i < len(s.Closed) && s.Closed[i]
+		n := len(sub)
+		segments := n - 1
+		if closed {
+			segments = n
+		}
+		for j := 0; j < segments; j++ {
+			a, b := sub[j], sub[(j+1)%n]
+			dx, dy := b.X-a.X, b.Y-a.Y
+			lengthSq := dx*dx + dy*dy
+			t := 0.0
+			if lengthSq > 0 {
+				t = ((x-a.X)*dx + (y-a.Y)*dy) / lengthSq
+			}
+			if t >= 0 && t <= 1 {
+				px, py := a.X+t*dx-x, a.Y+t*dy-y
+				if px*px+py*py <= hw*hw {
+					return true
+				}
+				continue
+			}
+			// Beyond an end of the segment: a join or a cap
+			end := a
+			atCap := !closed && j == 0
+			if t > 1 {
+				end = b
+				atCap = !closed && j == segments-1
+			}
+			if !atCap {
+				if math.Hypot(x-end.X, y-end.Y) <= hw {
+					return true
+				}
+				continue
+			}
+			switch s.Cap {
+			case "round":
+				if math.Hypot(x-end.X, y-end.Y) <= hw {
+					return true
+				}
+			case "square":
+				length := math.Sqrt(lengthSq)
+				if length == 0 {
+					if math.Abs(x-end.X) <= hw && math.Abs(y-end.Y) <= hw {
+						return true
+					}
+					continue
+				}
+				ux, uy := dx/length, dy/length
+				along := math.Abs((x-end.X)*ux + (y-end.Y)*uy)
+				across := math.Abs(-(x-end.X)*uy + (y-end.Y)*ux)
+				if along <= hw && across <= hw {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// paintSVGText paints the text content of a <text> element, including its
+// <tspan> children, as a single run.
+// Reference: https://www.w3.org/TR/SVG2/text.html
+func (r *svgRenderer) paintSVGText(c *Canvas, el *dom.Element, m Matrix) {
+	if r.property(el, "visibility") == "hidden" {
+		return
+	}
+	text := strings.Join(strings.Fields(el.TextContent()), " ")
+	if text == "" {
+		return
+	}
+	fill := r.resolvePaint(el, "fill", layout.Rect{}, m)
+	if fill == nil {
+		return
+	}
+
+	x := r.length(el, "x", r.viewport.Width, 0)
+	y := r.length(el, "y", r.viewport.Height, 0)
+	x += r.length(el, "dx", r.viewport.Width, 0)
+	y += r.length(el, "dy", r.viewport.Height, 0)
+
+	fontSize := 16.0
+	fontWeight := "normal"
+	if style := r.style(el); style != nil {
+		fontSize = getFontSize(style)
+		fontWeight = getFontWeight(style)
+	}
+	scaled := fontSize * m.scale()
+	width := textAdvance(text, scaled)
+	origin := m.Apply(Point{X: x, Y: y})
+	switch r.property(el, "text-anchor") {
+	case "middle":
+		origin.X -= width / 2
+	case "end":
+		origin.X -= width
+	}
+
+	col := fill(origin.X, origin.Y)
+	col.A = uint8(math.Round(float64(col.A) * r.opacity(el, "fill-opacity") * r.opacity(el, "opacity")))
+	// y is the baseline; the bitmap font is drawn from its top
+	c.drawText(text, int(math.Round(origin.X)), int(math.Round(origin.Y-bitmapAscent(scaled))), col, scaled, fontWeight)
+}
+
+// textAdvance returns the width of a run drawn with the bitmap font.
+func textAdvance(text string, fontSize float64) float64 {
+	scale := math.Max(fontSize/7.0, 1)
+	return float64(len([]rune(text))) * float64(int(5*scale)+int(1*scale))
+}
+
+// bitmapAscent returns the height above the baseline of the bitmap font.
+func bitmapAscent(fontSize float64) float64 {
+	return float64(int(7 * math.Max(fontSize/7.0, 1)))
+}
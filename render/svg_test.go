@@ -0,0 +1,186 @@
+// Package render tests for SVG painting.
+package render
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// svgPixels reads pixels relative to the content box of a painted <svg>.
+type svgPixels struct {
+	canvas *Canvas
+	origin layout.Rect
+}
+
+func (p svgPixels) GetPixel(x, y int) color.RGBA {
+	return p.canvas.GetPixel(int(p.origin.X)+x, int(p.origin.Y)+y)
+}
+
+// paintSVG lays out a document holding an inline SVG, paints it and returns
+// the pixels of the SVG's content box.
+func paintSVG(t *testing.T, svg string) svgPixels {
+	t.Helper()
+	doc, err := dom.ParseHTML("<body>" + svg + "</body>")
+	if err != nil {
+		t.Fatalf("ParseHTML: %v", err)
+	}
+	resolver := css.NewStyleResolver()
+	resolver.SetUserAgentStylesheet(css.GetUserAgentStylesheet())
+	resolver.AddAuthorStylesheet(css.NewParser("svg { display: block }").Parse())
+	ctx := layout.NewLayoutContext(200, 100)
+	root := layout.BuildLayoutTree(doc.DocumentElement(), resolver, ctx)
+	root.Layout(ctx)
+	var box *layout.LayoutBox
+	var find func(b *layout.LayoutBox)
+	find = func(b *layout.LayoutBox) {
+		if box == nil && b.Replaced != nil {
+			box = b
+		}
+		for _, child := range b.Children {
+			find(child)
+		}
+	}
+	find(root)
+	if box == nil {
+		t.Fatal("svg should be a replaced box")
+	}
+	canvas := NewCanvas(200, int(box.Dimensions.Content.Y+box.Dimensions.Content.Height)+50)
+	canvas.Paint(root)
+	return svgPixels{canvas: canvas, origin: box.Dimensions.Content}
+}
+
+var (
+	svgWhite = color.RGBA{255, 255, 255, 255}
+	svgRed   = color.RGBA{255, 0, 0, 255}
+	svgBlue  = color.RGBA{0, 0, 255, 255}
+)
+
+func TestSVGFillAndStroke(t *testing.T) {
+	canvas := paintSVG(t, `<svg width="100" height="100">
+		<rect x="10" y="10" width="40" height="40" fill="red" stroke="blue" stroke-width="4"/>
+		<circle cx="75" cy="75" r="10" fill="blue"/>
+		<line x1="60" y1="20" x2="90" y2="20" stroke="red" stroke-width="2"/></svg>`)
+
+	tests := []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"fill", 30, 30, svgRed},
+		{"stroke straddles the edge", 9, 30, svgBlue},
+		{"stroke inside edge", 11, 30, svgBlue},
+		{"outside", 5, 5, svgWhite},
+		{"circle", 75, 75, svgBlue},
+		{"circle corner", 67, 67, svgWhite},
+		{"line", 75, 20, svgRed},
+		{"line has no fill", 75, 25, svgWhite},
+	}
+	for _, tt := range tests {
+		if got := canvas.GetPixel(tt.x, tt.y); !colorNear(got, tt.want, 40) {
+			t.Errorf("%s: pixel(%d, %d) = %v, want %v", tt.name, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestSVGViewBoxScaling(t *testing.T) {
+	// A 10x10 viewBox scaled to 100x50 keeps its aspect ratio and is centered
+	canvas := paintSVG(t, `<svg width="100" height="50" viewBox="0 0 10 10">
+		<rect width="10" height="10" fill="red"/></svg>`)
+	if got := canvas.GetPixel(50, 25); !colorNear(got, svgRed, 0) {
+		t.Errorf("center = %v, want red", got)
+	}
+	if got := canvas.GetPixel(10, 25); !colorNear(got, svgWhite, 0) {
+		t.Errorf("letterbox = %v, want white", got)
+	}
+
+	canvas = paintSVG(t, `<svg width="100" height="50" viewBox="0 0 10 10" preserveAspectRatio="none">
+		<rect width="10" height="10" fill="red"/></svg>`)
+	if got := canvas.GetPixel(10, 25); !colorNear(got, svgRed, 0) {
+		t.Errorf("stretched = %v, want red", got)
+	}
+}
+
+func TestSVGLinearGradient(t *testing.T) {
+	canvas := paintSVG(t, `<svg width="100" height="100">
+		<defs><linearGradient id="g"><stop offset="0" stop-color="red"/><stop offset="1" stop-color="blue"/></linearGradient></defs>
+		<rect width="100" height="100" fill="url(#g)"/></svg>`)
+	if got := canvas.GetPixel(1, 50); !colorNear(got, svgRed, 10) {
+		t.Errorf("start = %v, want red", got)
+	}
+	if got := canvas.GetPixel(98, 50); !colorNear(got, svgBlue, 10) {
+		t.Errorf("end = %v, want blue", got)
+	}
+}
+
+func TestSVGUseAndTransform(t *testing.T) {
+	canvas := paintSVG(t, `<svg width="100" height="100">
+		<defs><symbol id="s" viewBox="0 0 1 1"><rect width="1" height="1"/></symbol></defs>
+		<use href="#s" x="10" y="10" width="20" height="20" fill="blue"/>
+		<g transform="translate(60 60) scale(2)"><rect width="10" height="10" fill="red"/></g></svg>`)
+	if got := canvas.GetPixel(20, 20); !colorNear(got, svgBlue, 0) {
+		t.Errorf("use = %v, want inherited blue", got)
+	}
+	if got := canvas.GetPixel(75, 75); !colorNear(got, svgRed, 0) {
+		t.Errorf("transformed = %v, want red", got)
+	}
+	if got := canvas.GetPixel(85, 85); !colorNear(got, svgWhite, 0) {
+		t.Errorf("outside transformed rect = %v, want white", got)
+	}
+}
+
+func TestSVGText(t *testing.T) {
+	canvas := paintSVG(t, `<svg width="100" height="100"><text x="10" y="30" font-size="20" fill="red">Hi</text></svg>`)
+	painted := false
+	for y := 10; y < 32 && !painted; y++ {
+		for x := 10; x < 40; x++ {
+			if canvas.GetPixel(x, y) != svgWhite {
+				painted = true
+				break
+			}
+		}
+	}
+	if !painted {
+		t.Error("text should paint glyphs above its baseline")
+	}
+}
+
+func TestParseTransformList(t *testing.T) {
+	m, ok := ParseTransformList("translate(10, 20) rotate(90) scale(2)")
+	if !ok {
+		t.Fatal("ParseTransformList failed")
+	}
+	p := m.Apply(Point{1, 0})
+	if math.Abs(p.X-10) > 1e-9 || math.Abs(p.Y-22) > 1e-9 {
+		t.Errorf("transformed point = %+v, want {10 22}", p)
+	}
+	for _, invalid := range []string{"translate(", "skewZ(3)", "matrix(1 2 3)"} {
+		if _, ok := ParseTransformList(invalid); ok {
+			t.Errorf("ParseTransformList(%q) should be invalid", invalid)
+		}
+	}
+}
+
+func TestViewBoxTransform(t *testing.T) {
+	viewBox := layout.Rect{Width: 10, Height: 20}
+	viewport := layout.Rect{X: 5, Width: 100, Height: 100}
+	tests := []struct {
+		par    string
+		corner Point
+	}{
+		{"", Point{30, 0}},
+		{"xMinYMin", Point{5, 0}},
+		{"xMaxYMax slice", Point{5, -100}},
+		{"none", Point{5, 0}},
+	}
+	for _, tt := range tests {
+		got := viewBoxTransform(viewBox, viewport, tt.par).Apply(Point{0, 0})
+		if math.Abs(got.X-tt.corner.X) > 1e-9 || math.Abs(got.Y-tt.corner.Y) > 1e-9 {
+			t.Errorf("%q: origin maps to %+v, want %+v", tt.par, got, tt.corner)
+		}
+	}
+}
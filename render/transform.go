@@ -0,0 +1,167 @@
+// Package render handles painting/rendering of the layout tree.
+// This file implements the CSS transforms of boxes.
+// Reference: https://www.w3.org/TR/css-transforms-1/
+package render
+
+import (
+	"math"
+
+	"github.com/chrisuehlinger/viberowser/css"
+	"github.com/chrisuehlinger/viberowser/layout"
+)
+
+// boxTransform returns the matrix that maps the coordinates of a box and its
+// content to those of its parent: the transform property applied about the
+// transform-origin. It returns false for boxes without a valid transform.
+// Reference: https://www.w3.org/TR/css-transforms-1/#transformation-matrix-computation
+func boxTransform(box *layout.LayoutBox) (Matrix, bool) {
+	style := box.ComputedStyle
+	if style == nil {
+		return Matrix{}, false
+	}
+	parts := styleComponents(style, "transform")
+	if len(parts) == 0 {
+		return Matrix{}, false
+	}
+	if ident, ok := css.ComponentIdent(parts[0]); ok && ident == "none" && len(parts) == 1 {
+		return Matrix{}, false
+	}
+
+	// The reference box of CSS boxes is their border box
+	ref := box.Dimensions.BorderBox()
+	m, ok := parseCSSTransform(parts, ref, style)
+	if !ok {
+		return Matrix{}, false
+	}
+	origin := centerPosition
+	if parts := styleComponents(style, "transform-origin"); len(parts) > 0 {
+		// A third value is the z offset, which has no effect in 2D
+		if len(parts) == 3 {
+			parts = parts[:2]
+		}
+		if pos, ok := parsePosition(parts, style); ok {
+			origin = pos
+		}
+	}
+	ox := ref.X + origin.X.resolve(ref.Width, 0)
+	oy := ref.Y + origin.Y.resolve(ref.Height, 0)
+	return translateMatrix(ox, oy).Multiply(m).Multiply(translateMatrix(-ox, -oy)), true
+}
+
+// parseCSSTransform parses a <transform-list>, resolving percentages in
+// translations against the reference box. Lists with 3D or unknown
+// functions are invalid.
+func parseCSSTransform(parts []css.ComponentValue, ref layout.Rect, style *css.ComputedStyle) (Matrix, bool) {
+	m := IdentityMatrix()
+	for _, part := range parts {
+		fn, ok := part.(*css.Function)
+		if !ok {
+			return Matrix{}, false
+		}
+		var args []css.ComponentValue
+		for _, arg := range css.SplitComponentValuesByComma(fn.Values) {
+			arg = css.NonWhitespaceComponents(arg)
+			if len(arg) != 1 {
+				return Matrix{}, false
+			}
+			args = append(args, arg[0])
+		}
+		t, ok := cssTransformFunction(fn.Name, args, ref, style)
+		if !ok {
+			return Matrix{}, false
+		}
+		m = m.Multiply(t)
+	}
+	return m, true
+}
+
+// cssTransformFunction builds the matrix of one CSS transform function.
+func cssTransformFunction(name string, args []css.ComponentValue, ref layout.Rect, style *css.ComputedStyle) (Matrix, bool) {
+	numbers := func() ([]float64, bool) {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			value, _, tokType, ok := css.ComponentNumber(arg)
+			if !ok || tokType != css.TokenNumber {
+				return nil, false
+			}
+			values[i] = value
+		}
+		return values, true
+	}
+	angles := func() ([]float64, bool) {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			angle, ok := componentAngle(arg)
+			if !ok {
+				return nil, false
+			}
+			values[i] = angle
+		}
+		return values, true
+	}
+	length := func(i int, base float64) (float64, bool) {
+		return resolveComponentLength(args[i], style, base)
+	}
+	tan := func(degrees float64) float64 {
+		return math.Tan(degrees * math.Pi / 180)
+	}
+
+	switch name {
+	case "matrix":
+		if n, ok := numbers(); ok && len(n) == 6 {
+			return Matrix{A: n[0], B: n[1], C: n[2], D: n[3], E: n[4], F: n[5]}, true
+		}
+	case "translate":
+		if len(args) == 1 || len(args) == 2 {
+			tx, ok := length(0, ref.Width)
+			ty := 0.0
+			if ok && len(args) == 2 {
+				ty, ok = length(1, ref.Height)
+			}
+			return translateMatrix(tx, ty), ok
+		}
+	case "translateX":
+		if len(args) == 1 {
+			tx, ok := length(0, ref.Width)
+			return translateMatrix(tx, 0), ok
+		}
+	case "translateY":
+		if len(args) == 1 {
+			ty, ok := length(0, ref.Height)
+			return translateMatrix(0, ty), ok
+		}
+	case "scale":
+		if n, ok := numbers(); ok && len(n) == 1 {
+			return scaleMatrixXY(n[0], n[0]), true
+		} else if ok && len(n) == 2 {
+			return scaleMatrixXY(n[0], n[1]), true
+		}
+	case "scaleX":
+		if n, ok := numbers(); ok && len(n) == 1 {
+			return scaleMatrixXY(n[0], 1), true
+		}
+	case "scaleY":
+		if n, ok := numbers(); ok && len(n) == 1 {
+			return scaleMatrixXY(1, n[0]), true
+		}
+	case "rotate":
+		if a, ok := angles(); ok && len(a) == 1 {
+			return rotateMatrix(a[0]), true
+		}
+	case "skew":
+		if a, ok := angles(); ok && len(a) == 1 {
+			return Matrix{A: 1, C: tan(a[0]), D: 1}, true
+		} else if ok && len(a) == 2 {
+			return Matrix{A: 1, B: tan(a[1]), C: tan(a[0]), D: 1}, true
+		}
+	case "skewX":
+		if a, ok := angles(); ok && len(a) == 1 {
+			return Matrix{A: 1, C: tan(a[0]), D: 1}, true
+		}
+	case "skewY":
+		if a, ok := angles(); ok && len(a) == 1 {
+			return Matrix{A: 1, B: tan(a[0]), D: 1}, true
+		}
+	}
+	return Matrix{}, false
+}
@@ -5,14 +5,13 @@ import (
 	"context"
 	"fmt"
 	"image"
+	"math"
 	"net/url"
 	"strings"
 	"sync"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
-	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
@@ -20,6 +19,7 @@ import (
 
 	"github.com/chrisuehlinger/viberowser/css"
 	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/font"
 	"github.com/chrisuehlinger/viberowser/js"
 	vibelayout "github.com/chrisuehlinger/viberowser/layout"
 	"github.com/chrisuehlinger/viberowser/network"
@@ -45,6 +45,9 @@ type BrowserUI struct {
 	urlEntry   *widget.Entry
 	goBtn      *widget.Button
 
+	// Find in page
+	findBar *findBar
+
 	// Network
 	httpClient *network.Client
 	loader     *network.Loader
@@ -58,32 +61,52 @@ type BrowserTab struct {
 	Title   string
 	Loading bool
 
-	// Navigation history
-	history      []string
-	historyIndex int
+	// Browsing context name that links target the tab by
+	name string
+
+	// Session history shared by the documents loaded in the tab
+	session *js.SessionHistory
 
 	// Rendered content
-	document    *dom.Document
-	layoutRoot  *vibelayout.LayoutBox
-	canvas      *render.Canvas
-	canvasImage *canvas.Image
+	document   *dom.Document
+	layoutRoot *vibelayout.LayoutBox
+	canvas     *render.Canvas
+	page       *pageView
+	renderMu   sync.Mutex // serializes layout and painting
 
-	// JavaScript execution
+	// Find in page, searched again whenever the page is painted
+	findMu sync.Mutex
+	find   findState
+
+	// JavaScript execution, all of which happens on the agent's goroutine
 	jsRuntime  *js.Runtime
 	jsExecutor *js.ScriptExecutor
-	eventLoop  *time.Ticker
+	agent      *js.Agent
 
 	// Content container
 	content *fyne.Container
 	scroll  *container.Scroll
 
+	// Size of the area the page is shown in, in units of the window, the
+	// pixels of the screen per unit and the zoom of the page, from which
+	// its viewport follows, and how far the page is scrolled. The UI
+	// goroutine keeps them up to date for the agent's goroutine, which
+	// must not read the widgets
+	viewportMu   sync.Mutex
+	viewSize     fyne.Size
+	viewScale    float32
+	zoom         float64
+	scrollOffset fyne.Position
+
 	// Loading cancellation
 	cancelFunc context.CancelFunc
 }
 
 // NewBrowserUI creates a new browser UI instance.
 func NewBrowserUI() *BrowserUI {
-	a := app.New()
+	// The app's ID keeps its preferences, such as the zoom of each origin,
+	// across sessions
+	a := app.NewWithID("io.github.chrisuehlinger.viberowser")
 	w := a.NewWindow("Viberowser")
 	w.Resize(fyne.NewSize(1280, 800))
 
@@ -142,15 +165,19 @@ func (b *BrowserUI) setupUI() {
 	b.tabBar.SetTabLocation(container.TabLocationTop)
 	b.tabBar.OnSelected = func(tab *container.TabItem) {
 		b.onTabSelected(tab)
+		b.refreshFind()
 	}
 
 	// Content area
 	b.contentBox = container.NewStack()
 
+	// Find bar, shown below the page while finding in it
+	b.findBar = b.newFindBar()
+
 	// Main layout
 	mainContent := container.NewBorder(
 		container.NewVBox(navBar, b.tabBar),
-		nil, nil, nil,
+		b.findBar.bar, nil, nil,
 		b.contentBox,
 	)
 
@@ -209,37 +236,99 @@ func (b *BrowserUI) setupKeyboardShortcuts() {
 	}, func(_ fyne.Shortcut) {
 		b.goForward()
 	})
+
+	// Ctrl+F: Find in page
+	b.window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyF,
+		Modifier: fyne.KeyModifierControl,
+	}, func(_ fyne.Shortcut) {
+		b.openFindBar()
+	})
+
+	// Ctrl+G and Ctrl+Shift+G: Next and previous match
+	b.window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyG,
+		Modifier: fyne.KeyModifierControl,
+	}, func(_ fyne.Shortcut) {
+		b.findStep(1)
+	})
+	b.window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyG,
+		Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift,
+	}, func(_ fyne.Shortcut) {
+		b.findStep(-1)
+	})
+
+	// Ctrl+C: Copy the selection of the page. Entries with focus copy
+	// their own text instead
+	b.window.Canvas().AddShortcut(&fyne.ShortcutCopy{}, func(_ fyne.Shortcut) {
+		b.copySelection()
+	})
+
+	// Ctrl+= or Ctrl++: Zoom in
+	for _, shortcut := range []*desktop.CustomShortcut{
+		{KeyName: fyne.KeyEqual, Modifier: fyne.KeyModifierControl},
+		{KeyName: fyne.KeyEqual, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift},
+		{KeyName: fyne.KeyPlus, Modifier: fyne.KeyModifierControl},
+	} {
+		b.window.Canvas().AddShortcut(shortcut, func(_ fyne.Shortcut) {
+			b.zoomIn()
+		})
+	}
+
+	// Ctrl+-: Zoom out
+	b.window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyMinus,
+		Modifier: fyne.KeyModifierControl,
+	}, func(_ fyne.Shortcut) {
+		b.zoomOut()
+	})
+
+	// Ctrl+0: Reset zoom
+	b.window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.Key0,
+		Modifier: fyne.KeyModifierControl,
+	}, func(_ fyne.Shortcut) {
+		b.resetZoom()
+	})
 }
 
 // newTab creates a new browser tab.
 func (b *BrowserUI) newTab() {
+	b.openTab()
+}
+
+// openTab creates a new tab, selects it and returns it.
+func (b *BrowserUI) openTab() *BrowserTab {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	tab := &BrowserTab{
-		URL:          "",
-		Title:        "New Tab",
-		Loading:      false,
-		history:      make([]string, 0),
-		historyIndex: -1,
+		URL:     "",
+		Title:   "New Tab",
+		Loading: false,
 	}
+	tab.session = b.newSessionHistory(tab)
 
 	// Create content container with placeholder
 	placeholder := widget.NewLabel("Enter a URL to browse")
 	placeholder.Alignment = fyne.TextAlignCenter
 	tab.content = container.NewStack(container.NewCenter(placeholder))
 	tab.scroll = container.NewScroll(tab.content)
+	tab.scroll.OnScrolled = tab.setScrollOffset
+	tab.page = newPageView(b, tab)
 
 	b.tabs = append(b.tabs, tab)
 	b.activeTab = len(b.tabs) - 1
 
 	// Add tab to tab bar
-	tabItem := container.NewTabItem(tab.Title, tab.scroll)
+	tabItem := container.NewTabItem(tab.Title, b.newViewportContainer(tab))
 	b.tabBar.Append(tabItem)
 	b.tabBar.Select(tabItem)
 
 	// Update content
 	b.updateContent()
+	return tab
 }
 
 // closeActiveTab closes the currently active tab.
@@ -254,16 +343,15 @@ func (b *BrowserUI) closeActiveTab() {
 				b.tabs[0].cancelFunc()
 			}
 			// Stop event loop
-			if b.tabs[0].eventLoop != nil {
-				b.tabs[0].eventLoop.Stop()
-				b.tabs[0].eventLoop = nil
+			if b.tabs[0].agent != nil {
+				b.tabs[0].agent.Stop()
+				b.tabs[0].agent = nil
 			}
 			b.tabs[0].jsRuntime = nil
 			b.tabs[0].jsExecutor = nil
 			b.tabs[0].URL = ""
 			b.tabs[0].Title = "New Tab"
-			b.tabs[0].history = make([]string, 0)
-			b.tabs[0].historyIndex = -1
+			b.tabs[0].session = b.newSessionHistory(b.tabs[0])
 			b.urlEntry.SetText("")
 			b.updateTabTitle(0)
 		}
@@ -280,8 +368,8 @@ func (b *BrowserUI) closeActiveTab() {
 	}
 
 	// Stop event loop
-	if b.tabs[b.activeTab].eventLoop != nil {
-		b.tabs[b.activeTab].eventLoop.Stop()
+	if b.tabs[b.activeTab].agent != nil {
+		b.tabs[b.activeTab].agent.Stop()
 	}
 
 	// Remove from tab bar
@@ -338,13 +426,14 @@ func (b *BrowserUI) updateNavigationButtons() {
 
 	tab := b.tabs[b.activeTab]
 
-	if tab.historyIndex > 0 {
+	index := tab.session.Index()
+	if index > 0 {
 		b.backBtn.Enable()
 	} else {
 		b.backBtn.Disable()
 	}
 
-	if tab.historyIndex < len(tab.history)-1 {
+	if index < tab.session.Len()-1 {
 		b.forwardBtn.Enable()
 	} else {
 		b.forwardBtn.Disable()
@@ -359,6 +448,22 @@ func (b *BrowserUI) updateNavigationButtons() {
 	}
 }
 
+// tabIndex returns the position of a tab in the tab bar, or -1 if it was
+// closed. The caller holds b.mu.
+func (b *BrowserUI) tabIndex(tab *BrowserTab) int {
+	for i, t := range b.tabs {
+		if t == tab {
+			return i
+		}
+	}
+	return -1
+}
+
+// isActive reports whether a tab is the selected one. The caller holds b.mu.
+func (b *BrowserUI) isActive(tab *BrowserTab) bool {
+	return b.activeTab >= 0 && b.activeTab < len(b.tabs) && b.tabs[b.activeTab] == tab
+}
+
 // updateTabTitle updates the title of a tab.
 func (b *BrowserUI) updateTabTitle(index int) {
 	if index < 0 || index >= len(b.tabs) || index >= len(b.tabBar.Items) {
@@ -382,40 +487,72 @@ func (b *BrowserUI) navigate(urlStr string) {
 		return
 	}
 	tab := b.tabs[b.activeTab]
-
-	// Cancel any previous loading
-	if tab.cancelFunc != nil {
-		tab.cancelFunc()
-	}
 	b.mu.Unlock()
 
-	// Normalize URL
-	urlStr = normalizeURL(urlStr)
+	b.navigateTab(tab, normalizeURL(urlStr), false)
+}
 
-	// Add to history
+// navigateTab loads a URL in a tab, adding an entry for it to the tab's
+// session history or replacing the current one.
+func (b *BrowserUI) navigateTab(tab *BrowserTab, urlStr string, replace bool) {
 	b.mu.Lock()
-	// Truncate forward history
-	if tab.historyIndex < len(tab.history)-1 {
-		tab.history = tab.history[:tab.historyIndex+1]
-	}
-	tab.history = append(tab.history, urlStr)
-	tab.historyIndex = len(tab.history) - 1
-	tab.URL = urlStr
-	tab.Loading = true
-	b.updateNavigationButtons()
-	b.urlEntry.SetText(urlStr)
+	session := tab.session
 	b.mu.Unlock()
 
+	session.Navigate(urlStr, replace)
+	b.startLoad(tab, urlStr)
+}
+
+// startLoad cancels any loading in a tab and loads a URL in it in the
+// background, without changing the tab's session history.
+func (b *BrowserUI) startLoad(tab *BrowserTab, urlStr string) {
 	// Create cancellable context
 	ctx, cancel := context.WithCancel(context.Background())
+
 	b.mu.Lock()
+	// Cancel any previous loading
+	if tab.cancelFunc != nil {
+		tab.cancelFunc()
+	}
 	tab.cancelFunc = cancel
+	tab.URL = urlStr
+	tab.Loading = true
+	if b.isActive(tab) {
+		b.updateNavigationButtons()
+		b.urlEntry.SetText(urlStr)
+	}
 	b.mu.Unlock()
 
 	// Load in background
 	go b.loadPage(tab, urlStr, ctx)
 }
 
+// newSessionHistory creates the session history of a tab. The tab's URL,
+// the URL bar and the navigation buttons follow its current entry, however
+// the page or the user moved it.
+func (b *BrowserUI) newSessionHistory(tab *BrowserTab) *js.SessionHistory {
+	session := js.NewSessionHistory()
+	session.Observe(func() {
+		entry, ok := session.Current()
+		if !ok {
+			return
+		}
+		fyne.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if tab.session != session {
+				return
+			}
+			tab.URL = entry.URL
+			if b.isActive(tab) {
+				b.updateNavigationButtons()
+				b.urlEntry.SetText(entry.URL)
+			}
+		})
+	})
+	return session
+}
+
 // loadPage loads and renders a page with JavaScript execution.
 func (b *BrowserUI) loadPage(tab *BrowserTab, urlStr string, ctx context.Context) {
 	// Show loading indicator
@@ -445,15 +582,20 @@ func (b *BrowserUI) loadPage(tab *BrowserTab, urlStr string, ctx context.Context
 		return
 	}
 
+	doc.SetURL(urlStr)
+	b.mu.Lock()
 	tab.document = doc
+	b.mu.Unlock()
 
 	// Get page title
 	title := doc.Title()
 	if title != "" {
-		b.mu.Lock()
-		tab.Title = title
-		b.updateTabTitle(b.activeTab)
-		b.mu.Unlock()
+		fyne.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			tab.Title = title
+			b.updateTabTitle(b.tabIndex(tab))
+		})
 	}
 
 	// Set base URL for resource loading
@@ -469,10 +611,16 @@ func (b *BrowserUI) loadPage(tab *BrowserTab, urlStr string, ctx context.Context
 	// Add user agent stylesheet
 	styleResolver.SetUserAgentStylesheet(css.GetUserAgentStylesheet())
 
+	// Web fonts of @font-face rules load when text first needs them
+	fonts := b.newPageFonts(ctx)
+
 	// Add external author stylesheets
 	for _, stylesheet := range loadedDoc.GetSuccessfulStylesheets() {
 		if stylesheet.Stylesheet != nil {
 			styleResolver.AddAuthorStylesheet(stylesheet.Stylesheet)
+			for _, face := range font.FontFacesFromStylesheet(stylesheet.Stylesheet, stylesheet.URL) {
+				fonts.AddFontFace(face)
+			}
 		}
 	}
 
@@ -485,6 +633,9 @@ func (b *BrowserUI) loadPage(tab *BrowserTab, urlStr string, ctx context.Context
 			parser := css.NewParser(cssContent)
 			stylesheet := parser.Parse()
 			styleResolver.AddAuthorStylesheet(stylesheet)
+			for _, face := range font.FontFacesFromStylesheet(stylesheet, urlStr) {
+				fonts.AddFontFace(face)
+			}
 		}
 	}
 
@@ -495,27 +646,77 @@ func (b *BrowserUI) loadPage(tab *BrowserTab, urlStr string, ctx context.Context
 	default:
 	}
 
-	// Initialize JavaScript execution
+	// Initialize JavaScript execution. Once the agent started, the page's
+	// scripts, its rendering and the input it receives run on the agent's
+	// goroutine, one task at a time
 	runtime := js.NewRuntime()
 	executor := js.NewScriptExecutor(runtime)
+	agent := js.NewAgent(runtime)
 
 	// Set up iframe content loader
 	executor.SetIframeContentLoader(func(src string) (*dom.Document, string) {
 		return b.loadIframeContent(ctx, src, urlStr)
 	})
 
-	// Bind the document to JavaScript
+	// Bind the document to JavaScript, with document.fonts reflecting the
+	// page's fonts and the window the size of the tab at the zoom of the
+	// page's origin
+	tab.setZoomLevel(b.originZoom(urlStr))
+	executor.SetViewport(tab.currentViewport())
+	executor.SetFonts(fonts)
+	b.mu.Lock()
+	executor.SetSessionHistory(tab.session)
+	b.mu.Unlock()
 	executor.SetupDocument(doc)
 
 	// Set up style resolver for getComputedStyle
 	executor.SetStyleResolver(styleResolver)
 
+	// Let document.elementFromPoint hit test the rendered page
+	executor.SetHitTester(tab.elementsAt)
+	executor.SetScrollOffset(tab.pageScrollOffset)
+
+	// Following links, setting the location and traversing the session
+	// history navigates this tab or others
+	executor.SetNavigator(func(req js.NavigationRequest) {
+		b.followLink(tab, req)
+	})
+
+	// The page is painted again at the agent's rendering opportunities
+	// after its document mutated or the browser asked for it
+	agent.SetRenderer(func() {
+		if rootElement := doc.DocumentElement(); rootElement != nil && ctx.Err() == nil {
+			b.renderPage(ctx, tab, rootElement, styleResolver, fonts)
+		}
+	})
+
+	// Web fonts that finish loading after the page was painted replace
+	// their fallbacks
+	fonts.Observe(func(face *font.FontFace) {
+		if face.Status() == font.Loaded && face.Available() {
+			agent.RequestRendering()
+		}
+	})
+
 	// Store in tab for event loop management
 	b.mu.Lock()
 	tab.jsRuntime = runtime
 	tab.jsExecutor = executor
+	tab.agent = agent
 	b.mu.Unlock()
 
+	// Start event loop for handling scripts, timers and callbacks
+	b.startEventLoop(agent, ctx)
+	agent.Post(js.TaskSourceNetworking, func() {
+		b.runPage(ctx, tab, agent, executor, loadedDoc, styleResolver, fonts)
+	})
+}
+
+// runPage runs the scripts of a loaded page in document order, then paints
+// the page and fires its load event. It runs as a task of the page's agent.
+func (b *BrowserUI) runPage(ctx context.Context, tab *BrowserTab, agent *js.Agent, executor *js.ScriptExecutor, loadedDoc *network.LoadedDocument, styleResolver *css.StyleResolver, fonts *font.Collection) {
+	doc := loadedDoc.Document
+
 	// Execute all scripts in document order
 	for _, script := range loadedDoc.GetOrderedSyncScripts() {
 		// Check for cancellation
@@ -549,44 +750,129 @@ func (b *BrowserUI) loadPage(tab *BrowserTab, urlStr string, ctx context.Context
 		return
 	}
 
-	// Build layout tree
-	viewportWidth := 1200.0
-	viewportHeight := 2000.0 // Allow for tall pages
-	layoutCtx := vibelayout.NewLayoutContext(viewportWidth, viewportHeight)
-	tab.layoutRoot = vibelayout.BuildLayoutTree(rootElement, styleResolver, layoutCtx)
+	// The element the URL's fragment indicates is the :target, and the
+	// page opens scrolled to it
+	fragment := ""
+	if u, err := url.Parse(doc.URL()); err == nil {
+		fragment = u.EscapedFragment()
+	}
+	doc.SetTargetElement(doc.IndicatedElement(fragment))
+
+	b.renderPage(ctx, tab, rootElement, styleResolver, fonts)
+	if fragment != "" {
+		tab.scrollToFragment(doc, fragment)
+	}
+
+	// Later mutations of the document paint it again
+	agent.ObserveDocument(doc)
 
-	if tab.layoutRoot != nil {
-		// Layout the tree
-		tab.layoutRoot.Layout(layoutCtx)
+	// Dispatch load event
+	executor.DispatchLoadEvent()
 
-		// Update element geometries for getBoundingClientRect and related APIs
-		vibelayout.UpdateElementGeometries(tab.layoutRoot, nil, 0, 0)
+	fyne.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		tab.Loading = false
+		b.updateNavigationButtons()
+	})
+}
 
-		// Calculate content height
-		contentHeight := tab.layoutRoot.Dimensions.MarginBox().Height
-		if contentHeight < viewportHeight {
-			contentHeight = viewportHeight
+// renderPage lays out and paints a page. Layout waits for the web fonts
+// it started loading while they are in their block period, and lays the
+// page out again if any of them arrived.
+func (b *BrowserUI) renderPage(ctx context.Context, tab *BrowserTab, rootElement *dom.Element, styleResolver *css.StyleResolver, fonts *font.Collection) {
+	tab.renderMu.Lock()
+	defer tab.renderMu.Unlock()
+
+	// The page is laid out in the viewport scripts see, which follows the
+	// size of the tab, and painted at the resolution of the screen
+	viewport := styleResolver.Viewport()
+	viewportWidth, viewportHeight := viewport.Width, viewport.Height
+	scale := viewport.DevicePixelRatio
+	if scale <= 0 {
+		scale = 1
+	}
+	layout := func() *vibelayout.LayoutBox {
+		layoutCtx := vibelayout.NewLayoutContext(viewportWidth, viewportHeight)
+		layoutCtx.ImageLoader = func(src string) *dom.Document {
+			return b.loadSVGImage(ctx, src)
+		}
+		layoutCtx.Fonts = fonts
+		root := vibelayout.BuildLayoutTree(rootElement, styleResolver, layoutCtx)
+		if root != nil {
+			root.Layout(layoutCtx)
 		}
+		return root
+	}
 
-		// Create canvas and paint
-		tab.canvas = render.NewCanvas(int(viewportWidth), int(contentHeight))
-		tab.canvas.Paint(tab.layoutRoot)
+	root := layout()
+	if fonts.WaitBlocking() {
+		root = layout()
+	}
+	tab.layoutRoot = root
+	if root == nil {
+		return
+	}
 
-		// Convert to image and display
-		img := tab.canvas.ToImage()
-		b.displayImage(tab, img)
+	// Update element geometries for getBoundingClientRect and related APIs
+	vibelayout.UpdateElementGeometries(root, nil, 0, 0)
+
+	// Calculate content height
+	contentHeight := root.Dimensions.MarginBox().Height
+	if contentHeight < viewportHeight {
+		contentHeight = viewportHeight
 	}
 
-	// Dispatch load event
-	executor.DispatchLoadEvent()
+	// Create canvas and paint
+	tab.canvas = render.NewCanvas(int(math.Ceil(viewportWidth*scale)), int(math.Ceil(contentHeight*scale)))
+	tab.canvas.Scale = scale
+	tab.canvas.Selection = rootElement.AsNode().OwnerDocument().GetSelection()
+	tab.canvas.Paint(root)
 
-	// Start event loop for handling timers and callbacks
-	b.startEventLoop(tab, ctx)
+	// Matches of find in page are highlighted over the page
+	found := tab.searchPage(root)
+	tab.canvas.PaintHighlights(found.painted)
 
-	b.mu.Lock()
-	tab.Loading = false
-	b.updateNavigationButtons()
-	b.mu.Unlock()
+	// Convert to image and display
+	img := tab.canvas.ToImage()
+	b.displayImage(tab, img)
+	b.showFindResult(tab, found)
+}
+
+// newPageFonts creates the font collection of a page, which downloads web
+// fonts with the browser's loader and falls back to the default fonts.
+func (b *BrowserUI) newPageFonts(ctx context.Context) *font.Collection {
+	fonts := font.NewCollection()
+	fonts.SetFallback(font.Default)
+	fonts.SetFetcher(func(url string) ([]byte, error) {
+		resp := b.loader.LoadFont(ctx, url)
+		if !resp.IsSuccess() {
+			if resp.Error != nil {
+				return nil, resp.Error
+			}
+			return nil, fmt.Errorf("failed to load font %s: status %d", url, resp.StatusCode)
+		}
+		return resp.Content, nil
+	})
+	return fonts
+}
+
+// loadSVGImage loads an image source as an SVG document. Raster images are
+// not decoded, so anything that is not SVG yields nil.
+func (b *BrowserUI) loadSVGImage(ctx context.Context, src string) *dom.Document {
+	resp := b.loader.LoadImage(ctx, src)
+	if !resp.IsSuccess() {
+		return nil
+	}
+	if resp.ContentType != "image/svg+xml" && !strings.HasSuffix(strings.ToLower(src), ".svg") {
+		return nil
+	}
+	doc, err := dom.ParseXML(string(resp.Content))
+	if err != nil {
+		return nil
+	}
+	doc.SetContentType("image/svg+xml")
+	return doc
 }
 
 // loadIframeContent loads content for an iframe src URL.
@@ -659,34 +945,15 @@ func (b *BrowserUI) loadIframeContent(ctx context.Context, src, baseURL string)
 	return doc, fullURL
 }
 
-// startEventLoop starts the JavaScript event loop for a tab.
-func (b *BrowserUI) startEventLoop(tab *BrowserTab, ctx context.Context) {
-	// Create ticker for event loop (16ms ≈ 60fps)
-	ticker := time.NewTicker(16 * time.Millisecond)
-
-	b.mu.Lock()
-	tab.eventLoop = ticker
-	b.mu.Unlock()
-
+// startEventLoop starts the agent that runs the event loop of a tab's page,
+// which stops when the page's loading is canceled.
+func (b *BrowserUI) startEventLoop(agent *js.Agent, ctx context.Context) {
+	agent.Start()
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				ticker.Stop()
-				return
-			case <-ticker.C:
-				b.mu.Lock()
-				runtime := tab.jsRuntime
-				executor := tab.jsExecutor
-				b.mu.Unlock()
-
-				if runtime != nil && executor != nil {
-					// Process timers (setTimeout, setInterval)
-					runtime.ProcessTimers()
-					// Process any pending events
-					executor.RunEventLoopOnce()
-				}
-			}
+		select {
+		case <-ctx.Done():
+			agent.Stop()
+		case <-agent.Done():
 		}
 	}()
 }
@@ -696,132 +963,141 @@ func (b *BrowserUI) stopEventLoop(tab *BrowserTab) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if tab.eventLoop != nil {
-		tab.eventLoop.Stop()
-		tab.eventLoop = nil
+	if tab.agent != nil {
+		tab.agent.Stop()
+		tab.agent = nil
 	}
 	tab.jsRuntime = nil
 	tab.jsExecutor = nil
 }
 
-// showLoading displays a loading indicator in the tab.
-func (b *BrowserUI) showLoading(tab *BrowserTab) {
+// runningAgent returns the agent of the page of a tab, or nil if the page
+// has none or it stopped.
+func (b *BrowserUI) runningAgent(tab *BrowserTab) *js.Agent {
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	agent := tab.agent
+	b.mu.Unlock()
+	if agent == nil {
+		return nil
+	}
+	select {
+	case <-agent.Done():
+		return nil
+	default:
+		return agent
+	}
+}
+
+// dispatchInput queues the dispatch of user input to the page of a tab as a
+// task of its event loop, and asks for the page to be painted again if the
+// input changed the elements that are hovered, pressed or focused. It
+// returns false if the page has no running event loop to dispatch input to.
+func (b *BrowserUI) dispatchInput(tab *BrowserTab, dispatch func(executor *js.ScriptExecutor)) bool {
+	agent := b.runningAgent(tab)
+	b.mu.Lock()
+	executor, doc := tab.jsExecutor, tab.document
+	b.mu.Unlock()
+	if agent == nil || executor == nil || doc == nil {
+		return false
+	}
 
-	loadingLabel := widget.NewLabel("Loading...")
-	loadingLabel.Alignment = fyne.TextAlignCenter
+	agent.Post(js.TaskSourceUserInteraction, func() {
+		hovered, pressed, focused := doc.HoveredElement(), doc.PressedElement(), doc.GetFocusedElement()
+		dispatch(executor)
+		if doc.HoveredElement() != hovered || doc.PressedElement() != pressed ||
+			doc.GetFocusedElement() != focused {
+			agent.RequestRendering()
+		}
+	})
+	return true
+}
+
+// showLoading displays a loading indicator in the tab. Like displayImage
+// and showError, it is called off the UI goroutine and changes the widgets
+// with fyne.Do.
+func (b *BrowserUI) showLoading(tab *BrowserTab) {
+	fyne.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
 
-	tab.content.Objects = []fyne.CanvasObject{container.NewCenter(loadingLabel)}
-	tab.content.Refresh()
+		loadingLabel := widget.NewLabel("Loading...")
+		loadingLabel.Alignment = fyne.TextAlignCenter
+
+		tab.content.Objects = []fyne.CanvasObject{container.NewCenter(loadingLabel)}
+		tab.content.Refresh()
+	})
 }
 
 // displayImage displays the rendered image in the tab.
 func (b *BrowserUI) displayImage(tab *BrowserTab, img *image.RGBA) {
-	// Create a Fyne image from the rendered content
-	fyneImg := canvas.NewImageFromImage(img)
-	fyneImg.FillMode = canvas.ImageFillOriginal
-	fyneImg.ScaleMode = canvas.ImageScalePixels
-
-	b.mu.Lock()
-	tab.canvasImage = fyneImg
+	fyne.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		tab.page.setImage(img)
 
-	// Update the content container
-	tab.content.Objects = []fyne.CanvasObject{fyneImg}
-	tab.content.Refresh()
-	tab.scroll.Refresh()
-	b.mu.Unlock()
+		// Update the content container
+		tab.content.Objects = []fyne.CanvasObject{tab.page}
+		tab.content.Refresh()
+		tab.scroll.Refresh()
+	})
 }
 
 // showError displays an error message in the tab.
 func (b *BrowserUI) showError(tab *BrowserTab, message string) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	fyne.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
 
-	tab.Loading = false
-	b.updateNavigationButtons()
+		tab.Loading = false
+		b.updateNavigationButtons()
 
-	errorLabel := widget.NewLabel(message)
-	errorLabel.Wrapping = fyne.TextWrapWord
-	errorLabel.Alignment = fyne.TextAlignCenter
+		errorLabel := widget.NewLabel(message)
+		errorLabel.Wrapping = fyne.TextWrapWord
+		errorLabel.Alignment = fyne.TextAlignCenter
 
-	errorBox := container.NewVBox(
-		widget.NewLabel("Error"),
-		errorLabel,
-	)
+		errorBox := container.NewVBox(
+			widget.NewLabel("Error"),
+			errorLabel,
+		)
 
-	tab.content.Objects = []fyne.CanvasObject{container.NewCenter(errorBox)}
-	tab.content.Refresh()
+		tab.content.Objects = []fyne.CanvasObject{container.NewCenter(errorBox)}
+		tab.content.Refresh()
+	})
 }
 
 // goBack navigates back in history.
 func (b *BrowserUI) goBack() {
-	b.mu.Lock()
-	if b.activeTab < 0 || b.activeTab >= len(b.tabs) {
-		b.mu.Unlock()
-		return
-	}
-	tab := b.tabs[b.activeTab]
-
-	if tab.historyIndex <= 0 {
-		b.mu.Unlock()
-		return
-	}
-
-	// Cancel any previous loading
-	if tab.cancelFunc != nil {
-		tab.cancelFunc()
-	}
-
-	tab.historyIndex--
-	urlStr := tab.history[tab.historyIndex]
-	tab.URL = urlStr
-	tab.Loading = true
-	b.updateNavigationButtons()
-	b.urlEntry.SetText(urlStr)
-	b.mu.Unlock()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	b.mu.Lock()
-	tab.cancelFunc = cancel
-	b.mu.Unlock()
-
-	go b.loadPage(tab, urlStr, ctx)
+	b.traverse(-1)
 }
 
 // goForward navigates forward in history.
 func (b *BrowserUI) goForward() {
+	b.traverse(1)
+}
+
+// traverse moves the active tab delta entries through its session history.
+// A page moves between its own entries in a task of its event loop, firing
+// popstate and hashchange, and asks for other entries to be loaded; without
+// a page, the entry is loaded directly.
+func (b *BrowserUI) traverse(delta int) {
 	b.mu.Lock()
 	if b.activeTab < 0 || b.activeTab >= len(b.tabs) {
 		b.mu.Unlock()
 		return
 	}
 	tab := b.tabs[b.activeTab]
+	session, executor := tab.session, tab.jsExecutor
+	b.mu.Unlock()
 
-	if tab.historyIndex >= len(tab.history)-1 {
-		b.mu.Unlock()
+	if agent := b.runningAgent(tab); agent != nil && executor != nil {
+		agent.Post(js.TaskSourceHistoryTraversal, func() {
+			executor.TraverseHistory(delta)
+		})
 		return
 	}
-
-	// Cancel any previous loading
-	if tab.cancelFunc != nil {
-		tab.cancelFunc()
+	if _, entry, ok := session.Traverse(delta); ok {
+		b.startLoad(tab, entry.URL)
 	}
-
-	tab.historyIndex++
-	urlStr := tab.history[tab.historyIndex]
-	tab.URL = urlStr
-	tab.Loading = true
-	b.updateNavigationButtons()
-	b.urlEntry.SetText(urlStr)
-	b.mu.Unlock()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	b.mu.Lock()
-	tab.cancelFunc = cancel
-	b.mu.Unlock()
-
-	go b.loadPage(tab, urlStr, ctx)
 }
 
 // refresh reloads the current page.
@@ -832,28 +1108,12 @@ func (b *BrowserUI) refresh() {
 		return
 	}
 	tab := b.tabs[b.activeTab]
-
-	if tab.URL == "" {
-		b.mu.Unlock()
-		return
-	}
-
-	// Cancel any previous loading
-	if tab.cancelFunc != nil {
-		tab.cancelFunc()
-	}
-
 	urlStr := tab.URL
-	tab.Loading = true
-	b.updateNavigationButtons()
 	b.mu.Unlock()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	b.mu.Lock()
-	tab.cancelFunc = cancel
-	b.mu.Unlock()
-
-	go b.loadPage(tab, urlStr, ctx)
+	if urlStr != "" {
+		b.startLoad(tab, urlStr)
+	}
 }
 
 // stop stops loading the current page.
@@ -0,0 +1,34 @@
+// Package ui provides the browser user interface using Fyne.
+// This file implements copying from the page to the system clipboard.
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+
+	"github.com/chrisuehlinger/viberowser/js"
+)
+
+// copySelection copies the selection of the page of the active tab to the
+// clipboard, once the page has had its copy event and the chance to replace
+// what is copied. The system clipboard holds only text, so the text/plain
+// of the copy is put on it, or the text/html where the page set no text.
+func (b *BrowserUI) copySelection() {
+	tab := b.currentTab()
+	if tab == nil {
+		return
+	}
+	clipboard := b.app.Clipboard()
+	b.dispatchInput(tab, func(executor *js.ScriptExecutor) {
+		data, ok := executor.Copy()
+		if !ok {
+			return
+		}
+		content := data.Text
+		if content == "" {
+			content = data.HTML
+		}
+		fyne.Do(func() {
+			clipboard.SetContent(content)
+		})
+	})
+}
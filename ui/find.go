@@ -0,0 +1,271 @@
+// Package ui provides the browser user interface using Fyne.
+// This file implements find in page: a bar that searches the text the page
+// of the active tab renders, highlights every match and steps through them,
+// scrolling the current one into view.
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	vibelayout "github.com/chrisuehlinger/viberowser/layout"
+	"github.com/chrisuehlinger/viberowser/render"
+)
+
+// findBar is the bar at the bottom of the window that searches the page of
+// the active tab. It is hidden until find in page is started.
+type findBar struct {
+	bar             *fyne.Container
+	entry           *findEntry
+	status          *widget.Label
+	matchCase       *widget.Check
+	matchDiacritics *widget.Check
+}
+
+// findEntry is the entry of the find bar. Enter steps to the next match,
+// Shift+Enter to the previous one and Escape closes the bar.
+type findEntry struct {
+	widget.Entry
+
+	shift    bool
+	onStep   func(step int)
+	onEscape func()
+}
+
+// newFindEntry creates the entry of the find bar.
+func newFindEntry(onStep func(step int), onEscape func()) *findEntry {
+	e := &findEntry{onStep: onStep, onEscape: onEscape}
+	e.ExtendBaseWidget(e)
+	e.SetPlaceHolder("Find in page")
+	return e
+}
+
+// KeyDown implements desktop.Keyable, tracking Shift for Shift+Enter.
+func (e *findEntry) KeyDown(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shift = true
+	}
+	e.Entry.KeyDown(key)
+}
+
+// KeyUp implements desktop.Keyable.
+func (e *findEntry) KeyUp(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shift = false
+	}
+	e.Entry.KeyUp(key)
+}
+
+// TypedKey implements fyne.Focusable.
+func (e *findEntry) TypedKey(key *fyne.KeyEvent) {
+	switch key.Name {
+	case fyne.KeyReturn, fyne.KeyEnter:
+		if e.shift {
+			e.onStep(-1)
+		} else {
+			e.onStep(1)
+		}
+	case fyne.KeyEscape:
+		e.onEscape()
+	default:
+		e.Entry.TypedKey(key)
+	}
+}
+
+// findState is the search of find in page in a tab. The page is searched
+// again each time it is painted, so the matches follow its changes.
+type findState struct {
+	query string
+	opts  vibelayout.FindOptions
+
+	// active is the index of the match stepped to, which wraps around the
+	// matches, and reveal asks for it to be scrolled into view when the
+	// page is next painted
+	active int
+	reveal bool
+}
+
+// findResult is what searching a page found, for the find bar to show.
+type findResult struct {
+	query   string
+	count   int
+	active  int
+	reveal  *vibelayout.Rect
+	painted []render.Highlight
+}
+
+// newFindBar creates the find bar, hidden.
+func (b *BrowserUI) newFindBar() *findBar {
+	f := &findBar{status: widget.NewLabel("")}
+	f.entry = newFindEntry(b.findStep, b.closeFindBar)
+	f.entry.OnChanged = func(string) {
+		b.findStep(0)
+	}
+	f.matchCase = widget.NewCheck("Match case", func(bool) {
+		b.findStep(0)
+	})
+	f.matchDiacritics = widget.NewCheck("Match diacritics", func(bool) {
+		b.findStep(0)
+	})
+
+	prevBtn := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+		b.findStep(-1)
+	})
+	nextBtn := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+		b.findStep(1)
+	})
+	closeBtn := widget.NewButtonWithIcon("", theme.CancelIcon(), b.closeFindBar)
+
+	f.bar = container.NewBorder(nil, nil,
+		widget.NewIcon(theme.SearchIcon()),
+		container.NewHBox(f.status, prevBtn, nextBtn, f.matchCase, f.matchDiacritics, closeBtn),
+		f.entry,
+	)
+	f.bar.Hide()
+	return f
+}
+
+// openFindBar shows the find bar with its query selected, searching the
+// page of the active tab for it.
+func (b *BrowserUI) openFindBar() {
+	b.findBar.bar.Show()
+	b.window.Canvas().Focus(b.findBar.entry)
+	b.findBar.entry.TypedShortcut(&fyne.ShortcutSelectAll{})
+	b.findStep(0)
+}
+
+// closeFindBar hides the find bar and removes the highlights of its search
+// from the page of the active tab.
+func (b *BrowserUI) closeFindBar() {
+	b.findBar.bar.Hide()
+	b.findBar.status.SetText("")
+	if tab := b.currentTab(); tab != nil {
+		b.findInTab(tab, "", vibelayout.FindOptions{}, 0)
+		if tab.page != nil {
+			b.window.Canvas().Focus(tab.page)
+		}
+	}
+}
+
+// refreshFind searches a newly selected tab for the query of the find bar
+// while it is open.
+func (b *BrowserUI) refreshFind() {
+	if b.findBar.bar.Visible() {
+		b.findStep(0)
+	}
+}
+
+// findStep searches the page of the active tab for the query of the find
+// bar and steps that many matches forwards or, when negative, backwards.
+// A changed query or options start again from the first match.
+func (b *BrowserUI) findStep(step int) {
+	if !b.findBar.bar.Visible() {
+		return
+	}
+	tab := b.currentTab()
+	if tab == nil {
+		return
+	}
+	opts := vibelayout.FindOptions{
+		CaseSensitive:      b.findBar.matchCase.Checked,
+		DiacriticSensitive: b.findBar.matchDiacritics.Checked,
+	}
+	b.findInTab(tab, b.findBar.entry.Text, opts, step)
+}
+
+// findInTab sets the search of find in page in a tab and has its page
+// painted again with the matches highlighted. An empty query ends it.
+func (b *BrowserUI) findInTab(tab *BrowserTab, query string, opts vibelayout.FindOptions, step int) {
+	tab.findMu.Lock()
+	state := &tab.find
+	if state.query != query || state.opts != opts {
+		state.query, state.opts, state.active = query, opts, 0
+	} else {
+		state.active += step
+	}
+	state.reveal = query != ""
+	tab.findMu.Unlock()
+
+	if agent := b.runningAgent(tab); agent != nil {
+		agent.RequestRendering()
+	} else if query != "" {
+		b.findBar.status.SetText("No results")
+	}
+}
+
+// searchPage searches the laid out page of a tab for the query of find in
+// page, returning the highlights of its matches and what to show in the
+// find bar. It runs while the page is painted.
+func (tab *BrowserTab) searchPage(root *vibelayout.LayoutBox) findResult {
+	tab.findMu.Lock()
+	defer tab.findMu.Unlock()
+	state := &tab.find
+	if state.query == "" {
+		return findResult{}
+	}
+	found := vibelayout.Find(root, state.query, state.opts)
+	result := findResult{query: state.query, count: len(found)}
+	if result.count == 0 {
+		state.reveal = false
+		return result
+	}
+
+	state.active = (state.active%result.count + result.count) % result.count
+	result.active = state.active
+	matches := render.Highlight{Color: render.FindMatchColor}
+	for i, m := range found {
+		if i != state.active {
+			matches.Rects = append(matches.Rects, m.Rects...)
+		}
+	}
+	active := render.Highlight{Color: render.ActiveFindMatchColor, Rects: found[state.active].Rects}
+	result.painted = []render.Highlight{matches, active}
+	if state.reveal {
+		r := active.Rects[0]
+		result.reveal = &r
+		state.reveal = false
+	}
+	return result
+}
+
+// showFindResult shows what searching the page of a tab found in the find
+// bar while the tab is active, and scrolls the match stepped to into view.
+func (b *BrowserUI) showFindResult(tab *BrowserTab, result findResult) {
+	if result.query == "" {
+		return
+	}
+	page := tab.page
+	fyne.Do(func() {
+		if b.currentTab() == tab && b.findBar.bar.Visible() {
+			if result.count == 0 {
+				b.findBar.status.SetText("No results")
+			} else {
+				b.findBar.status.SetText(fmt.Sprintf("%d of %d", result.active+1, result.count))
+			}
+		}
+		if result.reveal != nil {
+			tab.scrollIntoView(*result.reveal, page.scale())
+		}
+	})
+}
+
+// scrollIntoView scrolls the page of a tab the least to show an area of it,
+// given in CSS pixels, centering areas that were out of view.
+func (tab *BrowserTab) scrollIntoView(r vibelayout.Rect, scale float32) {
+	scroll := tab.scroll
+	x0, y0 := float32(r.X)/scale, float32(r.Y)/scale
+	x1, y1 := float32(r.X+r.Width)/scale, float32(r.Y+r.Height)/scale
+	offset, size := scroll.Offset, scroll.Size()
+	if y0 < offset.Y || y1 > offset.Y+size.Height {
+		offset.Y = (y0+y1)/2 - size.Height/2
+	}
+	if x0 < offset.X || x1 > offset.X+size.Width {
+		offset.X = (x0+x1)/2 - size.Width/2
+	}
+	tab.scrollTo(offset)
+}
@@ -0,0 +1,163 @@
+// Package ui provides the browser user interface using Fyne.
+// This file implements the navigations that a page starts by following
+// links, setting its location and traversing its session history: in the
+// page's tab, in new or named tabs, within the page, and downloads.
+package ui
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/js"
+	"github.com/chrisuehlinger/viberowser/network"
+)
+
+// followLink performs a navigation a link in the page of a tab requested.
+// It runs on the tab's event loop.
+func (b *BrowserUI) followLink(tab *BrowserTab, req js.NavigationRequest) {
+	switch {
+	case req.Download:
+		go b.download(req)
+	case req.SameDocument:
+		b.showMoveWithinDocument(tab, req)
+	case req.Traversal:
+		fyne.Do(func() {
+			b.startLoad(tab, req.URL)
+		})
+	default:
+		fyne.Do(func() {
+			b.navigateTab(b.targetTab(tab, req.Target), req.URL, req.Replace)
+		})
+	}
+}
+
+// targetTab returns the tab a link in a tab navigates: the tab itself, a
+// new tab for "_blank", or the tab with the target's name, which is opened
+// if there is none.
+func (b *BrowserUI) targetTab(tab *BrowserTab, target string) *BrowserTab {
+	if target == "" {
+		return tab
+	}
+	if target != "_blank" {
+		b.mu.Lock()
+		for _, t := range b.tabs {
+			if t.name == target {
+				b.mu.Unlock()
+				return t
+			}
+		}
+		b.mu.Unlock()
+	}
+	opened := b.openTab()
+	if target != "_blank" {
+		b.mu.Lock()
+		opened.name = target
+		b.mu.Unlock()
+	}
+	return opened
+}
+
+// showMoveWithinDocument paints the page of a tab again after it moved to
+// another URL of its document, which may have changed its :target, and
+// scrolls to the URL's fragment. Traversals keep the scroll position unless
+// the URL has a fragment. The tab's session history already has the move.
+// It runs on the tab's event loop.
+func (b *BrowserUI) showMoveWithinDocument(tab *BrowserTab, req js.NavigationRequest) {
+	b.mu.Lock()
+	doc, agent := tab.document, tab.agent
+	b.mu.Unlock()
+	if agent != nil {
+		agent.RequestRendering()
+	}
+	if doc == nil {
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (req.Traversal && u.Fragment == "") {
+		return
+	}
+	tab.scrollToFragment(doc, u.EscapedFragment())
+}
+
+// scrollToFragment scrolls the page of a tab to the element a fragment of
+// its URL indicates, or to the top for an empty fragment or "top". The
+// page must be laid out.
+// Reference: https://html.spec.whatwg.org/multipage/browsing-the-web.html#scroll-to-the-fragment-identifier
+func (tab *BrowserTab) scrollToFragment(doc *dom.Document, fragment string) {
+	var y float64
+	if el := doc.IndicatedElement(fragment); el != nil {
+		g := el.Geometry()
+		if g == nil {
+			return
+		}
+		y = g.Y
+	} else if fragment != "" && !strings.EqualFold(fragment, "top") {
+		return
+	}
+	page := tab.page
+	fyne.Do(func() {
+		tab.scrollTo(fyne.NewPos(tab.scroll.Offset.X, float32(y)/page.scale()))
+	})
+}
+
+// download saves the resource a link with a download attribute points to
+// in the user's downloads directory.
+func (b *BrowserUI) download(req js.NavigationRequest) {
+	resp := b.loader.Load(context.Background(), req.URL, network.ResourceTypeUnknown)
+	if !resp.IsSuccess() {
+		fmt.Printf("Download of %s failed: %v\n", req.URL, resp.Error)
+		return
+	}
+	file, err := downloadPath(req)
+	if err == nil {
+		err = os.WriteFile(file, resp.Content, 0o644)
+	}
+	if err != nil {
+		fmt.Printf("Download of %s failed: %v\n", req.URL, err)
+		return
+	}
+	fmt.Printf("Downloaded %s to %s\n", req.URL, file)
+}
+
+// downloadPath returns a path in the downloads directory that no file has
+// yet, named after the download attribute or else the URL.
+func downloadPath(req js.NavigationRequest) (string, error) {
+	dir := os.TempDir()
+	if home, err := os.UserHomeDir(); err == nil {
+		if info, err := os.Stat(filepath.Join(home, "Downloads")); err == nil && info.IsDir() {
+			dir = filepath.Join(home, "Downloads")
+		}
+	}
+
+	// Suggested names cannot leave the directory
+	name := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(req.Filename, "\\", "/")))
+	if name == "/" || name == "." {
+		name = ""
+		if u, err := url.Parse(req.URL); err == nil && u.Scheme != "data" {
+			name = path.Base(u.Path)
+		}
+		if name == "" || name == "/" || name == "." {
+			name = "download"
+		}
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	file := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return file, nil
+		} else if err != nil {
+			return "", err
+		}
+		file = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+	}
+}
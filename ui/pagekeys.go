@@ -0,0 +1,256 @@
+// Package ui provides the browser user interface using Fyne.
+// This file implements the routing of the keyboard input to a focused page
+// view into the page, and the scrolling of the page with keys the page
+// leaves to the browser.
+package ui
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+
+	"github.com/chrisuehlinger/viberowser/js"
+)
+
+// keyScrollStep is the distance the arrow keys scroll the page by.
+const keyScrollStep = 40
+
+// domKey describes a key as keyboard events report it.
+type domKey struct {
+	key      string // The key value when no modifier changes it
+	code     string // The physical key
+	location int    // One of the js.KeyLocation values
+}
+
+// namedKeys map the Fyne names of keys that do not type a character to the
+// keys of keyboard events.
+var namedKeys = map[fyne.KeyName]domKey{
+	fyne.KeyReturn:    {"Enter", "Enter", js.KeyLocationStandard},
+	fyne.KeyEnter:     {"Enter", "NumpadEnter", js.KeyLocationNumpad},
+	fyne.KeyBackspace: {"Backspace", "Backspace", js.KeyLocationStandard},
+	fyne.KeyDelete:    {"Delete", "Delete", js.KeyLocationStandard},
+	fyne.KeyInsert:    {"Insert", "Insert", js.KeyLocationStandard},
+	fyne.KeyTab:       {"Tab", "Tab", js.KeyLocationStandard},
+	fyne.KeyEscape:    {"Escape", "Escape", js.KeyLocationStandard},
+	fyne.KeyLeft:      {"ArrowLeft", "ArrowLeft", js.KeyLocationStandard},
+	fyne.KeyRight:     {"ArrowRight", "ArrowRight", js.KeyLocationStandard},
+	fyne.KeyUp:        {"ArrowUp", "ArrowUp", js.KeyLocationStandard},
+	fyne.KeyDown:      {"ArrowDown", "ArrowDown", js.KeyLocationStandard},
+	fyne.KeyPageUp:    {"PageUp", "PageUp", js.KeyLocationStandard},
+	fyne.KeyPageDown:  {"PageDown", "PageDown", js.KeyLocationStandard},
+	fyne.KeyHome:      {"Home", "Home", js.KeyLocationStandard},
+	fyne.KeyEnd:       {"End", "End", js.KeyLocationStandard},
+
+	desktop.KeyShiftLeft:    {"Shift", "ShiftLeft", js.KeyLocationLeft},
+	desktop.KeyShiftRight:   {"Shift", "ShiftRight", js.KeyLocationRight},
+	desktop.KeyControlLeft:  {"Control", "ControlLeft", js.KeyLocationLeft},
+	desktop.KeyControlRight: {"Control", "ControlRight", js.KeyLocationRight},
+	desktop.KeyAltLeft:      {"Alt", "AltLeft", js.KeyLocationLeft},
+	desktop.KeyAltRight:     {"Alt", "AltRight", js.KeyLocationRight},
+	desktop.KeySuperLeft:    {"Meta", "MetaLeft", js.KeyLocationLeft},
+	desktop.KeySuperRight:   {"Meta", "MetaRight", js.KeyLocationRight},
+	desktop.KeyMenu:         {"ContextMenu", "ContextMenu", js.KeyLocationStandard},
+	desktop.KeyCapsLock:     {"CapsLock", "CapsLock", js.KeyLocationStandard},
+	desktop.KeyPrintScreen:  {"PrintScreen", "PrintScreen", js.KeyLocationStandard},
+}
+
+// characterKeys map the Fyne names of the punctuation keys and the space
+// bar to the keys of keyboard events. Letters and digits are mapped by
+// characterKey.
+var characterKeys = map[fyne.KeyName]domKey{
+	fyne.KeySpace:        {" ", "Space", js.KeyLocationStandard},
+	fyne.KeyApostrophe:   {"'", "Quote", js.KeyLocationStandard},
+	fyne.KeyComma:        {",", "Comma", js.KeyLocationStandard},
+	fyne.KeyMinus:        {"-", "Minus", js.KeyLocationStandard},
+	fyne.KeyPeriod:       {".", "Period", js.KeyLocationStandard},
+	fyne.KeySlash:        {"/", "Slash", js.KeyLocationStandard},
+	fyne.KeyBackslash:    {"\\", "Backslash", js.KeyLocationStandard},
+	fyne.KeyLeftBracket:  {"[", "BracketLeft", js.KeyLocationStandard},
+	fyne.KeyRightBracket: {"]", "BracketRight", js.KeyLocationStandard},
+	fyne.KeySemicolon:    {";", "Semicolon", js.KeyLocationStandard},
+	fyne.KeyEqual:        {"=", "Equal", js.KeyLocationStandard},
+	fyne.KeyBackTick:     {"`", "Backquote", js.KeyLocationStandard},
+	fyne.KeyAsterisk:     {"*", "NumpadMultiply", js.KeyLocationNumpad},
+	fyne.KeyPlus:         {"+", "NumpadAdd", js.KeyLocationNumpad},
+}
+
+// characterKey returns the key of keyboard events for a key that types a
+// character.
+func characterKey(name fyne.KeyName) (domKey, bool) {
+	if k, ok := characterKeys[name]; ok {
+		return k, true
+	}
+	if len(name) == 1 {
+		switch c := name[0]; {
+		case c >= 'A' && c <= 'Z':
+			return domKey{strings.ToLower(string(name)), "Key" + string(name), js.KeyLocationStandard}, true
+		case c >= '0' && c <= '9':
+			return domKey{string(name), "Digit" + string(name), js.KeyLocationStandard}, true
+		}
+	}
+	return domKey{}, false
+}
+
+// keyboard tracks the keys pressed over a page view. Fyne reports a key
+// press as KeyDown, then TypedKey on the press and each repeat, then
+// TypedRune for the character it types, and KeyUp on its release.
+type keyboard struct {
+	fresh     map[fyne.KeyName]bool   // Keys pressed and not yet typed
+	typed     map[fyne.KeyName]string // Key values of the keys held down
+	runeKey   fyne.KeyName            // Character key waiting for its character
+	runeInput js.KeyInput             // Input of the character key waiting for its character
+}
+
+// FocusGained implements fyne.Focusable.
+func (v *pageView) FocusGained() {}
+
+// FocusLost implements fyne.Focusable. Keys released elsewhere are
+// forgotten.
+func (v *pageView) FocusLost() {
+	v.keys = keyboard{}
+}
+
+// AcceptsTab implements fyne.Tabbable. Tab moves the focus within the page
+// rather than out of it.
+func (v *pageView) AcceptsTab() bool {
+	return true
+}
+
+// KeyDown implements desktop.Keyable.
+func (v *pageView) KeyDown(e *fyne.KeyEvent) {
+	if v.keys.fresh == nil {
+		v.keys.fresh = map[fyne.KeyName]bool{}
+	}
+	v.keys.fresh[e.Name] = true
+}
+
+// KeyUp implements desktop.Keyable.
+func (v *pageView) KeyUp(e *fyne.KeyEvent) {
+	in, ok := v.keyInput(e.Name)
+	if !ok {
+		return
+	}
+	if key, ok := v.keys.typed[e.Name]; ok {
+		in.Key = key
+		delete(v.keys.typed, e.Name)
+	}
+	delete(v.keys.fresh, e.Name)
+	v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		executor.KeyUp(in)
+	})
+}
+
+// TypedKey implements fyne.Focusable. Keys that type a character wait for
+// it in TypedRune unless a shortcut modifier is held.
+func (v *pageView) TypedKey(e *fyne.KeyEvent) {
+	in, ok := v.keyInput(e.Name)
+	if !ok {
+		return
+	}
+	in.Repeat = !v.keys.fresh[e.Name]
+	delete(v.keys.fresh, e.Name)
+	if _, ok := characterKey(e.Name); ok && !in.CtrlKey && !in.AltKey && !in.MetaKey {
+		v.keys.runeKey, v.keys.runeInput = e.Name, in
+		return
+	}
+	if in.ShiftKey && len(in.Key) == 1 {
+		in.Key = strings.ToUpper(in.Key)
+	}
+	v.keyDown(e.Name, in)
+}
+
+// TypedRune implements fyne.Focusable. The character is typed by the last
+// character key pressed, or by an input method without one.
+func (v *pageView) TypedRune(r rune) {
+	in := js.KeyInput{Key: string(r)}
+	name := v.keys.runeKey
+	if name != "" {
+		in = v.keys.runeInput
+		in.Key = string(r)
+		v.keys.runeKey = ""
+	}
+	v.keyDown(name, in)
+}
+
+// keyDown dispatches a key press to the page, and scrolls the page with the
+// key unless the page handles it.
+func (v *pageView) keyDown(name fyne.KeyName, in js.KeyInput) {
+	if name != "" {
+		if v.keys.typed == nil {
+			v.keys.typed = map[fyne.KeyName]string{}
+		}
+		v.keys.typed[name] = in.Key
+	}
+	queued := v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		if executor.KeyDown(in) {
+			fyne.Do(func() { v.scrollForKey(in) })
+		}
+	})
+	if !queued {
+		v.scrollForKey(in)
+	}
+}
+
+// keyInput returns the input for a key with the modifiers held down.
+func (v *pageView) keyInput(name fyne.KeyName) (js.KeyInput, bool) {
+	k, ok := namedKeys[name]
+	if !ok {
+		if k, ok = characterKey(name); !ok {
+			return js.KeyInput{}, false
+		}
+	}
+	var modifier fyne.KeyModifier
+	if d, ok := fyne.CurrentApp().Driver().(desktop.Driver); ok {
+		modifier = d.CurrentKeyModifiers()
+	}
+	return js.KeyInput{
+		Key:      k.key,
+		Code:     k.code,
+		Location: k.location,
+		CtrlKey:  modifier&fyne.KeyModifierControl != 0,
+		ShiftKey: modifier&fyne.KeyModifierShift != 0,
+		AltKey:   modifier&fyne.KeyModifierAlt != 0,
+		MetaKey:  modifier&fyne.KeyModifierSuper != 0,
+	}, true
+}
+
+// scrollForKey scrolls the page with a key left to the browser: the arrow
+// keys scroll by a step, Page Up, Page Down and Space by the height of the
+// viewport less a step, and Home and End to the top and bottom.
+func (v *pageView) scrollForKey(in js.KeyInput) {
+	if in.CtrlKey || in.AltKey || in.MetaKey {
+		return
+	}
+	scroll := v.tab.scroll
+	offset := scroll.Offset
+	page := max(scroll.Size().Height-keyScrollStep, keyScrollStep)
+	switch in.Key {
+	case "ArrowUp":
+		offset.Y -= keyScrollStep
+	case "ArrowDown":
+		offset.Y += keyScrollStep
+	case "ArrowLeft":
+		offset.X -= keyScrollStep
+	case "ArrowRight":
+		offset.X += keyScrollStep
+	case "PageUp":
+		offset.Y -= page
+	case "PageDown":
+		offset.Y += page
+	case " ":
+		if in.ShiftKey {
+			offset.Y -= page
+		} else {
+			offset.Y += page
+		}
+	case "Home":
+		offset.Y = 0
+	case "End":
+		offset.Y = scroll.Content.MinSize().Height
+	default:
+		return
+	}
+	// The scroll container clamps the offset to the content
+	v.tab.scrollTo(offset)
+}
@@ -0,0 +1,214 @@
+// Package ui provides the browser user interface using Fyne.
+// This file implements the view of a rendered page, which routes the mouse
+// input over it into the page and takes the keyboard focus when pressed.
+package ui
+
+import (
+	"image"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/chrisuehlinger/viberowser/dom"
+	"github.com/chrisuehlinger/viberowser/js"
+	"github.com/chrisuehlinger/viberowser/render"
+)
+
+// pageView displays the rendered page of a tab. Mouse input over it is hit
+// tested against the page's layout and dispatched to the element under the
+// pointer, and keyboard input while it has focus goes to the page.
+type pageView struct {
+	widget.BaseWidget
+
+	browser *BrowserUI
+	tab     *BrowserTab
+	image   *canvas.Image
+	keys    keyboard
+}
+
+var (
+	_ desktop.Hoverable = (*pageView)(nil)
+	_ desktop.Mouseable = (*pageView)(nil)
+	_ desktop.Keyable   = (*pageView)(nil)
+	_ fyne.Tabbable     = (*pageView)(nil)
+	_ fyne.Draggable    = (*pageView)(nil)
+	_ fyne.Scrollable   = (*pageView)(nil)
+)
+
+// newPageView creates an empty view of the page of a tab.
+func newPageView(b *BrowserUI, tab *BrowserTab) *pageView {
+	v := &pageView{browser: b, tab: tab, image: &canvas.Image{}}
+	v.image.FillMode = canvas.ImageFillOriginal
+	v.image.ScaleMode = canvas.ImageScalePixels
+	v.ExtendBaseWidget(v)
+	return v
+}
+
+// CreateRenderer implements fyne.Widget.
+func (v *pageView) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(v.image)
+}
+
+// setImage shows a newly painted page.
+func (v *pageView) setImage(img image.Image) {
+	v.image.Image = img
+	v.image.Refresh()
+	v.Refresh()
+}
+
+// MouseIn implements desktop.Hoverable.
+func (v *pageView) MouseIn(e *desktop.MouseEvent) {
+	v.MouseMoved(e)
+}
+
+// MouseMoved implements desktop.Hoverable.
+func (v *pageView) MouseMoved(e *desktop.MouseEvent) {
+	target, in := v.input(e.Position, e.Modifier)
+	v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		executor.MouseMove(target, in)
+	})
+}
+
+// MouseOut implements desktop.Hoverable.
+func (v *pageView) MouseOut() {
+	v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		executor.MouseLeave(js.MouseInput{})
+	})
+}
+
+// MouseDown implements desktop.Mouseable. Pressing the page gives it the
+// keyboard focus.
+func (v *pageView) MouseDown(e *desktop.MouseEvent) {
+	if c := fyne.CurrentApp().Driver().CanvasForObject(v); c != nil {
+		c.Focus(v)
+	}
+	target, in := v.input(e.Position, e.Modifier)
+	in.Button = mouseButton(e.Button)
+	v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		executor.MouseDown(target, in)
+	})
+}
+
+// MouseUp implements desktop.Mouseable.
+func (v *pageView) MouseUp(e *desktop.MouseEvent) {
+	target, in := v.input(e.Position, e.Modifier)
+	in.Button = mouseButton(e.Button)
+	v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		executor.MouseUp(target, in)
+	})
+}
+
+// Dragged implements fyne.Draggable. While a button is held down the mouse
+// moves as drags rather than hover moves.
+func (v *pageView) Dragged(e *fyne.DragEvent) {
+	target, in := v.input(e.Position, 0)
+	v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		executor.MouseMove(target, in)
+	})
+}
+
+// DragEnd implements fyne.Draggable. The release of the button arrives as
+// MouseUp.
+func (v *pageView) DragEnd() {}
+
+// Scrolled implements fyne.Scrollable. The page scrolls unless the wheel
+// event is canceled.
+func (v *pageView) Scrolled(e *fyne.ScrollEvent) {
+	target, in := v.input(e.Position, 0)
+	// Positive deltas scroll down and to the right
+	in.DeltaX, in.DeltaY = -float64(e.Scrolled.DX), -float64(e.Scrolled.DY)
+	scroll := v.tab.scroll
+	queued := v.browser.dispatchInput(v.tab, func(executor *js.ScriptExecutor) {
+		if executor.Wheel(target, in) {
+			fyne.Do(func() { scroll.Scrolled(e) })
+		}
+	})
+	if !queued {
+		scroll.Scrolled(e)
+	}
+}
+
+// input returns the element at a position of the view and the mouse input
+// there, in CSS pixels.
+func (v *pageView) input(pos fyne.Position, modifier fyne.KeyModifier) (*dom.Element, js.MouseInput) {
+	scale := v.scale()
+	x, y := float64(pos.X*scale), float64(pos.Y*scale)
+	offset := v.tab.scroll.Offset
+	screen := fyne.CurrentApp().Driver().AbsolutePositionForObject(v).Add(pos)
+	in := js.MouseInput{
+		ClientX:  x - float64(offset.X*scale),
+		ClientY:  y - float64(offset.Y*scale),
+		PageX:    x,
+		PageY:    y,
+		ScreenX:  float64(screen.X * scale),
+		ScreenY:  float64(screen.Y * scale),
+		CtrlKey:  modifier&fyne.KeyModifierControl != 0,
+		ShiftKey: modifier&fyne.KeyModifierShift != 0,
+		AltKey:   modifier&fyne.KeyModifierAlt != 0,
+		MetaKey:  modifier&fyne.KeyModifierSuper != 0,
+	}
+	return v.elementAt(x, y), in
+}
+
+// scale returns the number of CSS pixels of the page in a unit of the view,
+// which is fewer the more the page is zoomed in.
+func (v *pageView) scale() float32 {
+	return float32(1 / v.tab.zoomLevel())
+}
+
+// elementsAt hit tests the laid out page at a point of the viewport, in CSS
+// pixels, for scripts. It returns false for points outside the viewport. It
+// runs on the agent's goroutine, so it reads the size and scroll offset of
+// the view the UI goroutine recorded rather than the widgets.
+func (tab *BrowserTab) elementsAt(x, y float64) ([]*dom.Element, bool) {
+	tab.viewportMu.Lock()
+	scale := float32(1 / tab.zoomLocked())
+	size, offset := tab.viewSize, tab.scrollOffset
+	tab.viewportMu.Unlock()
+	if x >= float64(size.Width*scale) || y >= float64(size.Height*scale) {
+		return nil, false
+	}
+	tab.renderMu.Lock()
+	defer tab.renderMu.Unlock()
+	return render.ElementsFromPoint(tab.layoutRoot, x+float64(offset.X*scale), y+float64(offset.Y*scale)), true
+}
+
+// pageScrollOffset returns how far the page is scrolled, in CSS pixels, for
+// scripts. Like elementsAt it reads the offset the UI goroutine recorded.
+func (tab *BrowserTab) pageScrollOffset() (x, y float64) {
+	tab.viewportMu.Lock()
+	defer tab.viewportMu.Unlock()
+	scale := 1 / tab.zoomLocked()
+	return float64(tab.scrollOffset.X) * scale, float64(tab.scrollOffset.Y) * scale
+}
+
+// elementAt hit tests the laid out page at a point, falling back to the
+// root element where no box is hit.
+func (v *pageView) elementAt(x, y float64) *dom.Element {
+	tab := v.tab
+	v.browser.mu.Lock()
+	doc := tab.document
+	v.browser.mu.Unlock()
+	tab.renderMu.Lock()
+	defer tab.renderMu.Unlock()
+	if el := render.HitTestElement(tab.layoutRoot, x, y); el != nil {
+		return el
+	}
+	if doc != nil {
+		return doc.DocumentElement()
+	}
+	return nil
+}
+
+// mouseButton maps a Fyne mouse button to the button of mouse events.
+func mouseButton(button desktop.MouseButton) int {
+	switch button {
+	case desktop.MouseButtonSecondary:
+		return js.MouseButtonSecondary
+	case desktop.MouseButtonTertiary:
+		return js.MouseButtonAuxiliary
+	}
+	return js.MouseButtonPrimary
+}
@@ -0,0 +1,116 @@
+// Package ui provides the browser user interface using Fyne.
+// This file implements the viewport of a tab, which follows the size of
+// the area the tab's page is shown in.
+package ui
+
+import (
+	"math"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+
+	"github.com/chrisuehlinger/viberowser/css"
+)
+
+// viewportLayout makes the scroll container of a tab fill the tab's content
+// area and reports the area's size whenever it is laid out.
+type viewportLayout struct {
+	onResize func(size fyne.Size)
+}
+
+// Layout implements fyne.Layout.
+func (l *viewportLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	for _, o := range objects {
+		o.Move(fyne.NewPos(0, 0))
+		o.Resize(size)
+	}
+	l.onResize(size)
+}
+
+// MinSize implements fyne.Layout. The page scrolls, so the tab can be made
+// as small as its scroll container.
+func (l *viewportLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	var minSize fyne.Size
+	for _, o := range objects {
+		minSize = minSize.Max(o.MinSize())
+	}
+	return minSize
+}
+
+// newViewportContainer wraps the scroll container of a tab in a container
+// that resizes the tab's viewport along with it.
+func (b *BrowserUI) newViewportContainer(tab *BrowserTab) *fyne.Container {
+	return container.New(&viewportLayout{
+		onResize: func(size fyne.Size) {
+			b.resizeViewport(tab, size)
+		},
+	}, tab.scroll)
+}
+
+// resizeViewport records the size of the content area of a tab and the
+// scale of the window it is in, resizing the tab's viewport when either
+// changed.
+func (b *BrowserUI) resizeViewport(tab *BrowserTab, size fyne.Size) {
+	scale := b.window.Canvas().Scale()
+	tab.viewportMu.Lock()
+	changed := tab.viewSize != size || tab.viewScale != scale
+	tab.viewSize, tab.viewScale = size, scale
+	tab.viewportMu.Unlock()
+	if changed {
+		b.updateViewport(tab)
+	}
+}
+
+// updateViewport tells the page of a tab the tab's viewport. Its page is
+// laid out again and its scripts see the new size at the next rendering
+// opportunity.
+func (b *BrowserUI) updateViewport(tab *BrowserTab) {
+	// Layout runs on the UI goroutine, possibly while the browser is
+	// locked, so the page is told from another goroutine. It applies the
+	// latest size in case resizes overtake each other.
+	go func() {
+		b.mu.Lock()
+		executor := tab.jsExecutor
+		b.mu.Unlock()
+		if executor != nil {
+			executor.SetViewport(tab.currentViewport())
+		}
+	}()
+}
+
+// setScrollOffset records how far the page of a tab is scrolled, in units
+// of the window. The scroll container reports the offsets it scrolls to
+// itself, other than those set with scrollTo.
+func (tab *BrowserTab) setScrollOffset(offset fyne.Position) {
+	tab.viewportMu.Lock()
+	tab.scrollOffset = offset
+	tab.viewportMu.Unlock()
+}
+
+// scrollTo scrolls the page of a tab to an offset, in units of the window,
+// which the scroll container clamps to the page.
+func (tab *BrowserTab) scrollTo(offset fyne.Position) {
+	tab.scroll.ScrollToOffset(offset)
+	tab.setScrollOffset(tab.scroll.Offset)
+}
+
+// currentViewport returns the viewport of a tab, or the default one until
+// the tab was shown. A CSS pixel is a unit of the window at 100% zoom, and
+// the page is painted with devicePixelRatio pixels of the screen per CSS
+// pixel, so zooming in shrinks the viewport and paints the page larger.
+func (tab *BrowserTab) currentViewport() css.Viewport {
+	tab.viewportMu.Lock()
+	defer tab.viewportMu.Unlock()
+	zoom := tab.zoomLocked()
+	vp := css.Viewport{
+		Width:  math.Floor(float64(tab.viewSize.Width) / zoom),
+		Height: math.Floor(float64(tab.viewSize.Height) / zoom),
+		// Scales of the window are float32s; the ratio is rounded so
+		// 110% is not 1.100000023841858
+		DevicePixelRatio: math.Round(float64(tab.viewScale)*zoom*1e4) / 1e4,
+	}
+	if vp.Width <= 0 || vp.Height <= 0 || vp.DevicePixelRatio <= 0 {
+		return css.DefaultViewport
+	}
+	return vp
+}
@@ -0,0 +1,151 @@
+// Package ui provides the browser user interface using Fyne.
+// This file implements page zoom, which scales the CSS pixels of the pages
+// of an origin and is remembered for the origin across sessions.
+package ui
+
+import (
+	"github.com/chrisuehlinger/viberowser/network"
+)
+
+// zoomLevels are the zoom factors zooming in and out steps through.
+var zoomLevels = []float64{0.25, 0.33, 0.5, 0.67, 0.75, 0.8, 0.9, 1, 1.1, 1.25, 1.5, 1.75, 2, 2.5, 3, 4, 5}
+
+// zoomIn zooms the page of the active tab in by one level.
+func (b *BrowserUI) zoomIn() {
+	if tab := b.currentTab(); tab != nil {
+		b.setZoom(tab, nextZoomLevel(tab.zoomLevel(), 1))
+	}
+}
+
+// zoomOut zooms the page of the active tab out by one level.
+func (b *BrowserUI) zoomOut() {
+	if tab := b.currentTab(); tab != nil {
+		b.setZoom(tab, nextZoomLevel(tab.zoomLevel(), -1))
+	}
+}
+
+// resetZoom shows the page of the active tab at 100%.
+func (b *BrowserUI) resetZoom() {
+	if tab := b.currentTab(); tab != nil {
+		b.setZoom(tab, 1)
+	}
+}
+
+// currentTab returns the active tab, or nil if there is none.
+func (b *BrowserUI) currentTab() *BrowserTab {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.activeTab < 0 || b.activeTab >= len(b.tabs) {
+		return nil
+	}
+	return b.tabs[b.activeTab]
+}
+
+// nextZoomLevel returns the zoom level above a zoom factor, or below it for
+// a negative direction, staying at the ends of the levels.
+func nextZoomLevel(zoom float64, direction int) float64 {
+	const epsilon = 1e-9
+	if direction > 0 {
+		for _, level := range zoomLevels {
+			if level > zoom+epsilon {
+				return level
+			}
+		}
+		return zoomLevels[len(zoomLevels)-1]
+	}
+	for i := len(zoomLevels) - 1; i >= 0; i-- {
+		if zoomLevels[i] < zoom-epsilon {
+			return zoomLevels[i]
+		}
+	}
+	return zoomLevels[0]
+}
+
+// setZoom zooms the page of a tab, along with the pages of the other tabs
+// showing the same origin, and remembers the zoom for the origin.
+func (b *BrowserUI) setZoom(tab *BrowserTab, zoom float64) {
+	b.mu.Lock()
+	origin := zoomOrigin(tab.URL)
+	tabs := []*BrowserTab{tab}
+	if origin != "" {
+		for _, t := range b.tabs {
+			if t != tab && zoomOrigin(t.URL) == origin {
+				tabs = append(tabs, t)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.rememberZoom(origin, zoom)
+	for _, t := range tabs {
+		t.setZoomLevel(zoom)
+		b.updateViewport(t)
+	}
+}
+
+// originZoom returns the zoom remembered for the origin of a URL, 100% for
+// origins never zoomed.
+func (b *BrowserUI) originZoom(rawURL string) float64 {
+	origin := zoomOrigin(rawURL)
+	if origin == "" {
+		return 1
+	}
+	zoom := b.app.Preferences().FloatWithFallback(zoomPreference(origin), 1)
+	if zoom <= 0 {
+		return 1
+	}
+	return zoom
+}
+
+// rememberZoom stores the zoom of an origin in the app's preferences, which
+// outlive the session. Origins at 100% are forgotten.
+func (b *BrowserUI) rememberZoom(origin string, zoom float64) {
+	if origin == "" {
+		return
+	}
+	prefs := b.app.Preferences()
+	if zoom == 1 {
+		prefs.RemoveValue(zoomPreference(origin))
+		return
+	}
+	prefs.SetFloat(zoomPreference(origin), zoom)
+}
+
+// zoomOrigin returns the origin a URL is zoomed with, or "" for URLs that
+// are not zoomed by origin.
+func zoomOrigin(rawURL string) string {
+	origin, err := network.GetOrigin(rawURL)
+	if err != nil {
+		return ""
+	}
+	return origin
+}
+
+// zoomPreference returns the preference key the zoom of an origin is
+// stored under.
+func zoomPreference(origin string) string {
+	return "zoom:" + origin
+}
+
+// zoomLevel returns the zoom factor of the page of a tab.
+func (tab *BrowserTab) zoomLevel() float64 {
+	tab.viewportMu.Lock()
+	defer tab.viewportMu.Unlock()
+	return tab.zoomLocked()
+}
+
+// zoomLocked returns the zoom factor of the page of a tab. The caller holds
+// tab.viewportMu.
+func (tab *BrowserTab) zoomLocked() float64 {
+	if tab.zoom <= 0 {
+		return 1
+	}
+	return tab.zoom
+}
+
+// setZoomLevel sets the zoom factor of the page of a tab.
+func (tab *BrowserTab) setZoomLevel(zoom float64) {
+	tab.viewportMu.Lock()
+	tab.zoom = zoom
+	tab.viewportMu.Unlock()
+}